@@ -0,0 +1,89 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/abuse"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/auth"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/notify"
+)
+
+// checkURLIssuance counts a delivery URL about to be handed out for
+// resource against the caller, and responds with 429 if they're blocked for
+// requesting too many. Callers are told apart by user when the request is
+// authenticated, with their plan's limits, and by IP otherwise. The
+// X-RateLimit-* headers tell clients how close they are to the limit. It
+// returns false if it responded.
+func (cfg *apiConfig) checkURLIssuance(w http.ResponseWriter, r *http.Request, resource string) bool {
+	if cfg.urlAbuse == nil {
+		return true
+	}
+
+	key := "ip:" + clientIP(r)
+	limits := cfg.urlAbuse.Limits()
+	if token, err := auth.GetBearerToken(r.Header); err == nil {
+		if userID, err := cfg.validateJWT(token); err == nil {
+			key = "user:" + userID.String()
+			limits = cfg.urlLimitsFor(userID)
+		}
+	}
+
+	if cfg.allowURLIssuance(w, key, limits, resource) {
+		return true
+	}
+	respondWithError(w, http.StatusTooManyRequests, "Too many requests, try again later", nil)
+	return false
+}
+
+// allowURLIssuance is checkURLIssuance for a caller already identified by
+// key, for handlers that issue URLs for many resources in one request and
+// report blocks per resource. It sets the same headers, and Retry-After
+// when the caller is blocked, but leaves responding to the handler.
+func (cfg *apiConfig) allowURLIssuance(w http.ResponseWriter, key string, limits abuse.Limits, resource string) bool {
+	if cfg.urlAbuse == nil {
+		return true
+	}
+
+	verdict := cfg.urlAbuse.ObserveWith(key, resource, limits)
+	if verdict.Limit > 0 {
+		w.Header().Set("X-RateLimit-Limit", strconv.Itoa(verdict.Limit))
+		w.Header().Set("X-RateLimit-Remaining", strconv.Itoa(verdict.Remaining))
+		if !verdict.Blocked {
+			w.Header().Set("X-RateLimit-Reset", strconv.Itoa(int(math.Ceil(verdict.Reset.Seconds()))))
+		}
+	}
+	if !verdict.Blocked {
+		return true
+	}
+	if verdict.NewlyBlocked {
+		cfg.notify(notify.EventAbuseDetected, "Delivery URL requests blocked", fmt.Sprintf(
+			"Blocked %s for %s after %s. Lift the block early with DELETE /api/admin/abuse/blocks/%s",
+			key, verdict.RetryAfter, verdict.Reason, key,
+		), map[string]any{"key": key, "reason": verdict.Reason, "retry_after_seconds": verdict.RetryAfter.Seconds()})
+	}
+	w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(verdict.RetryAfter.Seconds()))))
+	return false
+}
+
+func (cfg *apiConfig) handlerAdminAbuseBlocksList(w http.ResponseWriter, r *http.Request) {
+	if cfg.urlAbuse == nil {
+		respondWithError(w, http.StatusNotFound, "Abuse detection is not enabled", nil)
+		return
+	}
+	respondWithJSON(w, http.StatusOK, cfg.urlAbuse.Blocks())
+}
+
+func (cfg *apiConfig) handlerAdminAbuseBlockDelete(w http.ResponseWriter, r *http.Request) {
+	if cfg.urlAbuse == nil {
+		respondWithError(w, http.StatusNotFound, "Abuse detection is not enabled", nil)
+		return
+	}
+	if !cfg.urlAbuse.Unblock(r.PathValue("key")) {
+		respondWithError(w, http.StatusNotFound, "Couldn't find block", nil)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,169 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/accesslog"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/google/uuid"
+)
+
+type accessLogIngestResult struct {
+	FilesIngested int   `json:"files_ingested"`
+	FilesSkipped  int   `json:"files_skipped"`
+	Entries       int   `json:"entries"`
+	Unattributed  int   `json:"unattributed"`
+	Bytes         int64 `json:"bytes"`
+}
+
+type videoOwner struct {
+	videoID uuid.UUID
+	userID  uuid.UUID
+	found   bool
+}
+
+// ingestAccessLogs reads every log file under the configured logging bucket
+// prefix that hasn't been ingested yet and attributes its deliveries to
+// videos and their owners.
+func (cfg *apiConfig) ingestAccessLogs(ctx context.Context) (accessLogIngestResult, error) {
+	var result accessLogIngestResult
+	owners := map[string]videoOwner{}
+
+	paginator := s3.NewListObjectsV2Paginator(cfg.s3Client, &s3.ListObjectsV2Input{
+		Bucket: aws.String(cfg.accessLogBucket),
+		Prefix: aws.String(cfg.accessLogPrefix),
+	})
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return result, fmt.Errorf("couldn't list access logs: %w", err)
+		}
+
+		for _, obj := range page.Contents {
+			key := aws.ToString(obj.Key)
+			ingested, err := cfg.db.IsLogFileIngested(key)
+			if err != nil {
+				return result, err
+			}
+			if ingested {
+				result.FilesSkipped++
+				continue
+			}
+
+			deliveryLog, unattributed, err := cfg.readAccessLog(ctx, key, owners)
+			if err != nil {
+				return result, err
+			}
+			recorded, err := cfg.db.RecordDeliveryLog(deliveryLog)
+			if err != nil {
+				return result, err
+			}
+			if !recorded {
+				result.FilesSkipped++
+				continue
+			}
+
+			result.FilesIngested++
+			result.Entries += deliveryLog.Entries
+			result.Unattributed += unattributed
+			for _, u := range deliveryLog.Users {
+				result.Bytes += u.Bytes
+			}
+		}
+	}
+
+	log.Printf("Ingested %d access log files (%d entries, %d bytes)", result.FilesIngested, result.Entries, result.Bytes)
+	return result, nil
+}
+
+// resolveVideoOwners looks up the owners of every key in entries that isn't
+// in owners yet with a single batch query, and caches misses as not found.
+func (cfg *apiConfig) resolveVideoOwners(entries []accesslog.Entry, owners map[string]videoOwner) error {
+	keys := []string{}
+	for _, entry := range entries {
+		if _, ok := owners[entry.Key]; ok {
+			continue
+		}
+		owners[entry.Key] = videoOwner{}
+		keys = append(keys, entry.Key)
+	}
+	if len(keys) == 0 {
+		return nil
+	}
+
+	found, err := cfg.db.FindVideosByKeys(keys)
+	if err != nil {
+		return err
+	}
+	for key, owner := range found {
+		owners[key] = videoOwner{videoID: owner.VideoID, userID: owner.UserID, found: true}
+	}
+	return nil
+}
+
+func (cfg *apiConfig) readAccessLog(ctx context.Context, key string, owners map[string]videoOwner) (database.DeliveryLog, int, error) {
+	out, err := cfg.s3Client.GetObject(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(cfg.accessLogBucket),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		return database.DeliveryLog{}, 0, fmt.Errorf("couldn't get access log %s: %w", key, err)
+	}
+	defer out.Body.Close()
+
+	entries, err := accesslog.Parse(out.Body, cfg.accessLogFormat)
+	if err != nil {
+		return database.DeliveryLog{}, 0, fmt.Errorf("couldn't parse access log %s: %w", key, err)
+	}
+
+	type videoDay struct {
+		videoID uuid.UUID
+		day     string
+	}
+	type userMonth struct {
+		userID uuid.UUID
+		month  string
+	}
+	videos := map[videoDay]*database.VideoDelivery{}
+	users := map[userMonth]*database.UserDelivery{}
+	unattributed := 0
+
+	if err := cfg.resolveVideoOwners(entries, owners); err != nil {
+		return database.DeliveryLog{}, 0, err
+	}
+
+	for _, entry := range entries {
+		owner := owners[entry.Key]
+		if !owner.found {
+			unattributed++
+			continue
+		}
+
+		vd := videoDay{owner.videoID, entry.Time.Format("2006-01-02")}
+		if videos[vd] == nil {
+			videos[vd] = &database.VideoDelivery{VideoID: vd.videoID, Day: vd.day}
+		}
+		videos[vd].Bytes += entry.Bytes
+		videos[vd].Requests++
+
+		um := userMonth{owner.userID, database.UsageMonth(entry.Time)}
+		if users[um] == nil {
+			users[um] = &database.UserDelivery{UserID: um.userID, Month: um.month}
+		}
+		users[um].Bytes += entry.Bytes
+		users[um].Requests++
+	}
+
+	deliveryLog := database.DeliveryLog{Key: key, Entries: len(entries)}
+	for _, v := range videos {
+		deliveryLog.Videos = append(deliveryLog.Videos, *v)
+	}
+	for _, u := range users {
+		deliveryLog.Users = append(deliveryLog.Users, *u)
+	}
+	return deliveryLog, unattributed, nil
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/auth"
+)
+
+// middlewareAdminOnly rejects requests that aren't made by one of the users
+// listed in ADMIN_EMAILS.
+func (cfg *apiConfig) middlewareAdminOnly(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		token, err := auth.GetBearerToken(r.Header)
+		if err != nil {
+			respondWithError(w, http.StatusUnauthorized, "Couldn't find JWT", err)
+			return
+		}
+		userID, err := cfg.validateJWT(token)
+		if err != nil {
+			respondWithError(w, http.StatusUnauthorized, "Couldn't validate JWT", err)
+			return
+		}
+
+		user, err := cfg.db.GetUser(userID)
+		if err != nil {
+			respondWithError(w, http.StatusInternalServerError, "Couldn't get user", err)
+			return
+		}
+		if user == nil || !cfg.adminEmails[strings.ToLower(user.Email)] {
+			respondWithError(w, http.StatusForbidden, "Admin access required", nil)
+			return
+		}
+
+		next(w, r)
+	}
+}
+
+func parseAdminEmails(s string) map[string]bool {
+	emails := map[string]bool{}
+	for _, email := range strings.Split(s, ",") {
+		email = strings.ToLower(strings.TrimSpace(email))
+		if email != "" {
+			emails[email] = true
+		}
+	}
+	return emails
+}
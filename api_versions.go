@@ -0,0 +1,62 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// The API is served under /api/v1/ and /api/v2/. Unversioned /api/ paths
+// are v1, so existing clients keep working. Both versions share routes:
+// the prefix is stripped before routing and handlers that changed in v2
+// check requestAPIVersion. Breaking changes only ship in the latest version.
+const (
+	apiV1 = 1
+	apiV2 = 2
+
+	latestAPIVersion = apiV2
+)
+
+type apiVersionKey struct{}
+
+// middlewareAPIVersion strips the version from /api/vN/ paths. It runs
+// ahead of the maintenance check and the routes, so they only see /api/
+// paths.
+func middlewareAPIVersion(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rest, ok := strings.CutPrefix(r.URL.Path, "/api/")
+		if !ok {
+			next.ServeHTTP(w, r)
+			return
+		}
+		segment, path, _ := strings.Cut(rest, "/")
+		digits, ok := strings.CutPrefix(segment, "v")
+		version, err := strconv.Atoi(digits)
+		if !ok || err != nil {
+			w.Header().Set("API-Version", strconv.Itoa(apiV1))
+			next.ServeHTTP(w, r)
+			return
+		}
+		if version < apiV1 || version > latestAPIVersion {
+			respondWithError(w, http.StatusNotFound, "Unknown API version", nil)
+			return
+		}
+
+		r2 := r.WithContext(context.WithValue(r.Context(), apiVersionKey{}, version))
+		u := *r.URL
+		u.Path = "/api/" + path
+		u.RawPath = ""
+		r2.URL = &u
+		w.Header().Set("API-Version", strconv.Itoa(version))
+		next.ServeHTTP(w, r2)
+	})
+}
+
+// requestAPIVersion is the version the client asked for, v1 by default.
+func requestAPIVersion(r *http.Request) int {
+	if version, ok := r.Context().Value(apiVersionKey{}).(int); ok {
+		return version
+	}
+	return apiV1
+}
@@ -25,6 +25,24 @@ document
     await login();
   });
 
+document
+  .getElementById("thumbnail-upload-form")
+  .addEventListener("submit", async (event) => {
+    event.preventDefault();
+    await uploadThumbnail(currentVideo?.id);
+  });
+
+document
+  .getElementById("video-file-upload-form")
+  .addEventListener("submit", async (event) => {
+    event.preventDefault();
+    await uploadVideoFile(currentVideo?.id);
+  });
+
+document.getElementById("signup-btn").addEventListener("click", signup);
+document.getElementById("logout-btn").addEventListener("click", logout);
+document.getElementById("delete-video-btn").addEventListener("click", deleteVideo);
+
 async function createVideoDraft() {
   const title = document.getElementById("video-title").value;
   const description = document.getElementById("video-description").value;
@@ -140,10 +158,43 @@ async function uploadThumbnail(videoID) {
   }
 }
 
+// linkPreviousUpload sends the file's SHA-256 before uploading it. If the
+// same file was uploaded before, the server reuses it and the upload is
+// skipped. Any failure just means uploading as usual.
+async function linkPreviousUpload(videoID, file) {
+  if (!window.crypto || !crypto.subtle) return false;
+  try {
+    const digest = await crypto.subtle.digest("SHA-256", await file.arrayBuffer());
+    const sha256 = Array.from(new Uint8Array(digest))
+      .map((b) => b.toString(16).padStart(2, "0"))
+      .join("");
+    const res = await fetch(`/api/video_upload/${videoID}/handshake`, {
+      method: "POST",
+      headers: {
+        "Content-Type": "application/json",
+        Authorization: `Bearer ${localStorage.getItem("token")}`,
+      },
+      body: JSON.stringify({ sha256 }),
+    });
+    if (!res.ok) return false;
+    const data = await res.json();
+    return data.linked;
+  } catch (error) {
+    console.log(`Upload handshake failed: ${error.message}`);
+    return false;
+  }
+}
+
 async function uploadVideoFile(videoID) {
   const videoFile = document.getElementById("video-file").files[0];
   if (!videoFile) return;
 
+  if (await linkPreviousUpload(videoID, videoFile)) {
+    console.log("Video was uploaded before, reused it!");
+    await getVideo(videoID);
+    return;
+  }
+
   const formData = new FormData();
   formData.append("video", videoFile);
 
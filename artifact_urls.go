@@ -0,0 +1,196 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/google/uuid"
+)
+
+// videoURLs are the URLs of everything a client can play or show for a
+// video. With PRESIGN_TTL set they're presigned against the bucket and stop
+// working at ExpiresAt, otherwise they point at S3_CF_DISTRO.
+type videoURLs struct {
+	Video      *string        `json:"video"`
+	Thumbnail  *string        `json:"thumbnail"`
+	Preview    *string        `json:"preview"`
+	Captions   []artifactLink `json:"captions"`
+	Renditions []rendition    `json:"renditions"`
+	Sprites    []artifactLink `json:"sprites"`
+	// AudioDescriptions are also in the video as an audio track.
+	AudioDescriptions []artifactLink `json:"audio_descriptions"`
+	// AudioTracks are dubs, also in the video after its own audio.
+	AudioTracks []artifactLink `json:"audio_tracks"`
+	ExpiresAt   *time.Time     `json:"expires_at,omitempty"`
+}
+
+type artifactLink struct {
+	URL       string `json:"url"`
+	Width     int    `json:"width,omitempty"`
+	Height    int    `json:"height,omitempty"`
+	SizeBytes int64  `json:"size_bytes"`
+	Language  string `json:"language,omitempty"`
+}
+
+// generatePresignedURL returns a GET URL for key that expires after
+// expireTime.
+func generatePresignedURL(presignClient *s3.PresignClient, bucket, key string, expireTime time.Duration) (string, error) {
+	req, err := presignClient.PresignGetObject(context.Background(), &s3.GetObjectInput{
+		Bucket: aws.String(bucket),
+		Key:    aws.String(key),
+	}, s3.WithPresignExpires(expireTime))
+	if err != nil {
+		return "", fmt.Errorf("couldn't presign %s: %w", key, err)
+	}
+	return req.URL, nil
+}
+
+// warmCredentials fetches the AWS credentials once at startup, so the first
+// URLs presigned after a deploy don't wait on the credential provider chain.
+// The SDK caches them and refreshes them before they expire.
+func warmCredentials(awsConfig aws.Config) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if _, err := awsConfig.Credentials.Retrieve(ctx); err != nil {
+		log.Printf("Couldn't pre-fetch AWS credentials: %v", err)
+	}
+}
+
+// artifactURL is the URL clients fetch key from.
+func (cfg *apiConfig) artifactURL(key string) (string, error) {
+	if cfg.presignTTL > 0 {
+		return generatePresignedURL(cfg.s3Presign, cfg.s3Bucket, key, cfg.presignTTL)
+	}
+	return cfg.distributionURL(key), nil
+}
+
+// distributionURL is the URL of key on S3_CF_DISTRO. Each segment of the key
+// is escaped, so keys with spaces, commas or # still make valid URLs, and
+// distributionKey maps them back to the same key.
+func (cfg *apiConfig) distributionURL(key string) string {
+	segments := strings.Split(key, "/")
+	for i, segment := range segments {
+		segments[i] = url.PathEscape(segment)
+	}
+	return cfg.s3CfDistribution + "/" + strings.Join(segments, "/")
+}
+
+// distributionKey returns the key of a URL made by distributionURL.
+func (cfg *apiConfig) distributionKey(rawURL string) (string, bool) {
+	escaped, ok := strings.CutPrefix(rawURL, cfg.s3CfDistribution+"/")
+	if !ok {
+		return "", false
+	}
+	key, err := url.PathUnescape(escaped)
+	if err != nil {
+		return "", false
+	}
+	return key, true
+}
+
+// resolveVideoURLs loads the artifacts of every video with one query and
+// resolves all their URLs. Callers leave out videos that mustn't be played,
+// such as ones that were taken down.
+func (cfg *apiConfig) resolveVideoURLs(videos []database.Video) (map[uuid.UUID]videoURLs, error) {
+	ids := make([]uuid.UUID, 0, len(videos))
+	for _, video := range videos {
+		ids = append(ids, video.ID)
+	}
+	artifacts, err := cfg.db.GetArtifactsForVideos(ids)
+	if err != nil {
+		return nil, err
+	}
+
+	resolved := make(map[uuid.UUID]videoURLs, len(videos))
+	for _, video := range videos {
+		urls, err := cfg.videoURLsFromArtifacts(video, artifacts[video.ID])
+		if err != nil {
+			return nil, err
+		}
+		resolved[video.ID] = urls
+	}
+	return resolved, nil
+}
+
+func (cfg *apiConfig) videoURLsFromArtifacts(video database.Video, artifacts []database.Artifact) (videoURLs, error) {
+	urls := videoURLs{
+		// Thumbnails in the assets directory are served by this server.
+		Thumbnail:  video.ThumbnailURL,
+		Captions:   []artifactLink{},
+		Renditions: []rendition{},
+		Sprites:    []artifactLink{},
+
+		AudioDescriptions: []artifactLink{},
+		AudioTracks:       []artifactLink{},
+	}
+	if cfg.presignTTL > 0 {
+		expiresAt := time.Now().Add(cfg.presignTTL).UTC()
+		urls.ExpiresAt = &expiresAt
+	}
+
+	renditions := []database.Artifact{}
+	for _, a := range artifacts {
+		if a.Kind == database.ArtifactKindSource {
+			continue
+		}
+		if a.Kind == database.ArtifactKindRendition {
+			renditions = append(renditions, a)
+			continue
+		}
+		url, err := cfg.artifactURL(a.Key)
+		if err != nil {
+			return videoURLs{}, err
+		}
+		link := artifactLink{URL: url, Width: a.Width, Height: a.Height, SizeBytes: a.SizeBytes, Language: a.Language}
+		switch a.Kind {
+		case database.ArtifactKindVideo:
+			urls.Video = &url
+		case database.ArtifactKindThumbnail:
+			urls.Thumbnail = &url
+		case database.ArtifactKindPreview:
+			urls.Preview = &url
+		case database.ArtifactKindCaptions:
+			urls.Captions = append(urls.Captions, link)
+		case database.ArtifactKindSprite:
+			urls.Sprites = append(urls.Sprites, link)
+		case database.ArtifactKindAudioDescription:
+			urls.AudioDescriptions = append(urls.AudioDescriptions, link)
+		case database.ArtifactKindAudioTrack:
+			urls.AudioTracks = append(urls.AudioTracks, link)
+		}
+	}
+
+	var err error
+	urls.Renditions, err = cfg.renditionsFromArtifacts(renditions)
+	if err != nil {
+		return videoURLs{}, err
+	}
+	// Transcoded videos play their largest rendition, like VideoURL does.
+	if urls.Video == nil && len(urls.Renditions) > 0 {
+		urls.Video = &urls.Renditions[0].URL
+	}
+	return urls, nil
+}
+
+// videoResponse is a video with the URLs of its artifacts attached. URLs is
+// nil for videos that can't be played.
+type videoResponse struct {
+	database.Video
+	URLs *videoURLs `json:"urls"`
+}
+
+// withURLs attaches urls to video. VideoURL is replaced too, since the
+// stored URL isn't usable when delivery is presigned.
+func withURLs(video database.Video, urls *videoURLs) videoResponse {
+	if urls != nil && urls.Video != nil {
+		video.VideoURL = urls.Video
+	}
+	return videoResponse{Video: video, URLs: urls}
+}
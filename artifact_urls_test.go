@@ -0,0 +1,80 @@
+package main
+
+import (
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/credentials"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+)
+
+func FuzzDistributionURLRoundTrip(f *testing.F) {
+	for _, seed := range []string{
+		"landscape/abc.mp4",
+		"users/1/videos/2/video/a b,c.mp4",
+		"renditions/x/720p#1.mp4",
+		"a?b=c&d",
+		"%2F/%zz/",
+		"/leading//double/",
+		"ünïcödé/🎬.mp4",
+		"",
+	} {
+		f.Add(seed)
+	}
+	cfg := &apiConfig{s3CfDistribution: "https://d111111abcdef8.cloudfront.net"}
+	f.Fuzz(func(t *testing.T, key string) {
+		rawURL := cfg.distributionURL(key)
+		u, err := url.Parse(rawURL)
+		if err != nil {
+			t.Fatalf("distributionURL(%q) = %q, doesn't parse: %v", key, rawURL, err)
+		}
+		if u.RawQuery != "" || u.Fragment != "" || u.Host != "d111111abcdef8.cloudfront.net" {
+			t.Fatalf("distributionURL(%q) = %q, key leaked out of the path", key, rawURL)
+		}
+		got, ok := cfg.distributionKey(rawURL)
+		if !ok || got != key {
+			t.Fatalf("distributionKey(distributionURL(%q)) = %q, %v", key, got, ok)
+		}
+	})
+}
+
+func TestDistributionKeyOtherHost(t *testing.T) {
+	cfg := &apiConfig{s3CfDistribution: "https://d111111abcdef8.cloudfront.net"}
+	for _, rawURL := range []string{
+		"https://other.cloudfront.net/a.mp4",
+		"https://d111111abcdef8.cloudfront.net.evil.com/a.mp4",
+		"https://d111111abcdef8.cloudfront.net/%zz",
+	} {
+		if key, ok := cfg.distributionKey(rawURL); ok {
+			t.Errorf("distributionKey(%q) = %q, want no key", rawURL, key)
+		}
+	}
+}
+
+// BenchmarkGeneratePresignedURL compares presigning with the client shared
+// through apiConfig against building a presign client for every URL, as
+// generatePresignedURL used to.
+func BenchmarkGeneratePresignedURL(b *testing.B) {
+	client := s3.New(s3.Options{
+		Region:      "us-east-2",
+		Credentials: credentials.NewStaticCredentialsProvider("AKIAEXAMPLE", "secret", ""),
+	})
+	b.Run("shared", func(b *testing.B) {
+		presignClient := s3.NewPresignClient(client)
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			if _, err := generatePresignedURL(presignClient, "tubely", "landscape/abc.mp4", time.Hour); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+	b.Run("per call", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			if _, err := generatePresignedURL(s3.NewPresignClient(client), "tubely", "landscape/abc.mp4", time.Hour); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
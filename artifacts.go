@@ -0,0 +1,89 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/google/uuid"
+)
+
+// rendition is how a rendition artifact is shown to clients.
+type rendition struct {
+	ID         int64     `json:"id"`
+	CreatedAt  time.Time `json:"created_at"`
+	VideoID    uuid.UUID `json:"video_id"`
+	URL        string    `json:"url"`
+	Width      int       `json:"width"`
+	Height     int       `json:"height"`
+	DurationMS int64     `json:"duration_ms"`
+	Codec      string    `json:"codec"`
+	Bitrate    int64     `json:"bitrate"`
+	SizeBytes  int64     `json:"size_bytes"`
+}
+
+func (cfg *apiConfig) renditionsFromArtifacts(artifacts []database.Artifact) ([]rendition, error) {
+	renditions := make([]rendition, 0, len(artifacts))
+	for _, a := range artifacts {
+		url, err := cfg.artifactURL(a.Key)
+		if err != nil {
+			return nil, err
+		}
+		renditions = append(renditions, rendition{
+			ID:         a.ID,
+			CreatedAt:  a.CreatedAt,
+			VideoID:    a.VideoID,
+			URL:        url,
+			Width:      a.Width,
+			Height:     a.Height,
+			DurationMS: a.DurationMS,
+			Codec:      a.Codec,
+			Bitrate:    a.Bitrate,
+			SizeBytes:  a.SizeBytes,
+		})
+	}
+	return renditions, nil
+}
+
+// replaceArtifacts records the current artifacts of one kind for a video and
+// deletes the objects they superseded, e.g. after a video is re-uploaded.
+// Leftover objects only cost storage, so failing to delete them is logged
+// rather than returned.
+func (cfg *apiConfig) replaceArtifacts(ctx context.Context, videoID uuid.UUID, kind database.ArtifactKind, artifacts []database.CreateArtifactParams) error {
+	stale, err := cfg.db.ReplaceArtifacts(videoID, kind, artifacts)
+	if err != nil {
+		return err
+	}
+	if err := cfg.deleteObjects(ctx, stale); err != nil {
+		log.Printf("Couldn't delete superseded %s objects of video %s: %v", kind, videoID, err)
+	}
+	return nil
+}
+
+// deleteObjects removes keys from the bucket in batches of the 1000 keys
+// DeleteObjects accepts.
+func (cfg *apiConfig) deleteObjects(ctx context.Context, keys []string) error {
+	for start := 0; start < len(keys); start += 1000 {
+		batch := keys[start:min(start+1000, len(keys))]
+		objects := make([]types.ObjectIdentifier, 0, len(batch))
+		for _, key := range batch {
+			objects = append(objects, types.ObjectIdentifier{Key: aws.String(key)})
+		}
+		out, err := cfg.s3Client.DeleteObjects(ctx, &s3.DeleteObjectsInput{
+			Bucket: aws.String(cfg.s3Bucket),
+			Delete: &types.Delete{Objects: objects, Quiet: aws.Bool(true)},
+		})
+		if err != nil {
+			return err
+		}
+		if len(out.Errors) > 0 {
+			return fmt.Errorf("couldn't delete %s: %s", aws.ToString(out.Errors[0].Key), aws.ToString(out.Errors[0].Message))
+		}
+	}
+	return nil
+}
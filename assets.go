@@ -2,16 +2,20 @@ package main
 
 import (
 	"bytes"
+	"context"
 	"crypto/rand"
+	"crypto/sha256"
 	"encoding/base64"
 	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
 	"log"
+	"mime"
 	"os"
 	"os/exec"
 	"path/filepath"
-	"strings"
+	"strconv"
 )
 
 func (cfg apiConfig) ensureAssetsDir() error {
@@ -22,17 +26,56 @@ func (cfg apiConfig) ensureAssetsDir() error {
 }
 
 func generateRandomNameWithExtensionType(mediaType string) string {
+	return generateRandomName(mediaTypeToExtension(mediaType))
+}
+
+// generateRandomName returns 32 random bytes, base64 encoded, followed by
+// ext.
+func generateRandomName(ext string) string {
 	byteSlice := make([]byte, 32)
 	_, err := rand.Read(byteSlice)
 	if err != nil {
 		panic("failed to generate random bytes")
 	}
 	id := base64.RawURLEncoding.EncodeToString(byteSlice)
-
-	ext := mediaTypeToExtension(mediaType)
 	return fmt.Sprintf("%s%s", id, ext)
 }
 
+// contentAddressedName names a file after the SHA-256 of its contents, so
+// identical files share a name and a name never points at different bytes.
+func contentAddressedName(sum []byte, mediaType string) string {
+	return base64.RawURLEncoding.EncodeToString(sum) + mediaTypeToExtension(mediaType)
+}
+
+// saveAsset writes body to the assets directory under its content addressed
+// name, which it returns. Saving an image that's already there changes
+// nothing.
+func (cfg apiConfig) saveAsset(body io.Reader, mediaType string) (string, error) {
+	tmp, err := os.CreateTemp(cfg.assetsRoot, ".upload-*")
+	if err != nil {
+		return "", err
+	}
+	defer os.Remove(tmp.Name())
+
+	hash := sha256.New()
+	if _, err := io.Copy(io.MultiWriter(tmp, hash), body); err != nil {
+		tmp.Close()
+		return "", err
+	}
+	if err := tmp.Chmod(0644); err != nil {
+		tmp.Close()
+		return "", err
+	}
+	if err := tmp.Close(); err != nil {
+		return "", err
+	}
+	assetPath := contentAddressedName(hash.Sum(nil), mediaType)
+	if err := os.Rename(tmp.Name(), cfg.getAssetDiskPath(assetPath)); err != nil {
+		return "", err
+	}
+	return assetPath, nil
+}
+
 func (cfg apiConfig) getAssetDiskPath(assetPath string) string {
 	return filepath.Join(cfg.assetsRoot, assetPath)
 }
@@ -46,12 +89,49 @@ func (cfg apiConfig) getObjectURL(key string) string {
 	return fmt.Sprintf("https://%s.s3.%s.amazonaws.com/%s", cfg.s3Bucket, cfg.s3Region, key)
 }
 
+// mediaTypeExtensions are the extensions of the media types the app stores
+// or hands to ffmpeg. mime.ExtensionsByType depends on the system's
+// mime.types and lists several extensions for most types, so the common
+// ones are pinned here.
+var mediaTypeExtensions = map[string]string{
+	"video/mp4":        ".mp4",
+	"video/quicktime":  ".mov",
+	"video/webm":       ".webm",
+	"video/x-matroska": ".mkv",
+	"image/jpeg":       ".jpg",
+	"image/png":        ".png",
+	"image/webp":       ".webp",
+	"text/vtt":         ".vtt",
+	"audio/mp4":        ".m4a",
+	"audio/mpeg":       ".mp3",
+	"audio/wav":        ".wav",
+}
+
+// mediaTypeExtension returns the extension for mediaType, like .mov for
+// video/quicktime. ok is false for types without a known extension, which
+// uploads should reject.
+func mediaTypeExtension(mediaType string) (ext string, ok bool) {
+	parsed, _, err := mime.ParseMediaType(mediaType)
+	if err != nil {
+		return "", false
+	}
+	if ext, ok := mediaTypeExtensions[parsed]; ok {
+		return ext, true
+	}
+	exts, err := mime.ExtensionsByType(parsed)
+	if err != nil || len(exts) == 0 {
+		return "", false
+	}
+	return exts[0], true
+}
+
+// mediaTypeToExtension is mediaTypeExtension for types that were already
+// validated, falling back to .bin.
 func mediaTypeToExtension(mediaType string) string {
-	parts := strings.Split(mediaType, "/")
-	if len(parts) != 2 {
-		return ".bin"
+	if ext, ok := mediaTypeExtension(mediaType); ok {
+		return ext
 	}
-	return "." + parts[1]
+	return ".bin"
 }
 
 // getVideoAspectRatio uses ffprobe to retrieve the video's width and height.
@@ -72,8 +152,8 @@ func getVideoAspectRatio(filePath string) (string, error) {
 	var stdout, stderr bytes.Buffer
 	cmd.Stdout = &stdout
 	cmd.Stderr = &stderr
-	if err := cmd.Run(); err != nil {
-		return "", fmt.Errorf("ffprobe error: %s\nCommand failed with: %v", stderr.String(), err)
+	if err := runMediaTool(cmd); err != nil {
+		return "", &mediaToolError{tool: "ffprobe", stderr: stderr.String(), err: err}
 	}
 
 	var output struct {
@@ -97,6 +177,65 @@ func getVideoAspectRatio(filePath string) (string, error) {
 	return ratio, nil
 }
 
+type videoProbe struct {
+	Codec      string
+	Width      int
+	Height     int
+	Bitrate    int64
+	DurationMS int64
+}
+
+// probeVideo uses ffprobe to read the codec, dimensions and bitrate of the
+// first video stream, along with the container's duration.
+func probeVideo(filePath string) (videoProbe, error) {
+	cmd := exec.Command(
+		"ffprobe", "-v",
+		"error", "-print_format",
+		"json", "-select_streams", "v:0",
+		"-show_entries", "stream=codec_name,width,height,bit_rate:format=duration,bit_rate",
+		filePath,
+	)
+
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := runMediaTool(cmd); err != nil {
+		return videoProbe{}, &mediaToolError{tool: "ffprobe", stderr: stderr.String(), err: err}
+	}
+
+	var output struct {
+		Streams []struct {
+			CodecName string `json:"codec_name"`
+			Width     int    `json:"width"`
+			Height    int    `json:"height"`
+			BitRate   string `json:"bit_rate"`
+		} `json:"streams"`
+		Format struct {
+			Duration string `json:"duration"`
+			BitRate  string `json:"bit_rate"`
+		} `json:"format"`
+	}
+	if err := json.Unmarshal(stdout.Bytes(), &output); err != nil {
+		return videoProbe{}, fmt.Errorf("couldn't parse ffprobe output: %v", err)
+	}
+	if len(output.Streams) == 0 {
+		return videoProbe{}, errNoVideoStream
+	}
+
+	stream := output.Streams[0]
+	probe := videoProbe{Codec: stream.CodecName, Width: stream.Width, Height: stream.Height}
+	// Streams muxed without a bitrate fall back to the container's overall one.
+	bitrate := stream.BitRate
+	if bitrate == "" || bitrate == "N/A" {
+		bitrate = output.Format.BitRate
+	}
+	probe.Bitrate, _ = strconv.ParseInt(bitrate, 10, 64)
+	if seconds, err := strconv.ParseFloat(output.Format.Duration, 64); err == nil {
+		probe.DurationMS = int64(seconds * 1000)
+	}
+	return probe, nil
+}
+
 func calculateAspectRatio(width, height int) string {
 	if width == 16*height/9 { // 16:9
 		return "landscape"
@@ -106,24 +245,47 @@ func calculateAspectRatio(width, height int) string {
 	return "other"
 }
 
-// processVideoForFastStart uses ffmpeg to create an MP4 with fast start.
+// encodeFragmentedMP4 converts the input into a fragmented MP4 written to
+// w, with codecArgs from mp4CodecArgs. A fast start MP4 can't be written to
+// a pipe, since ffmpeg moves the moov atom to the front by rewriting the
+// finished file. Fragmented MP4 starts with an empty moov instead, so it
+// plays progressively just the same.
+func encodeFragmentedMP4(ctx context.Context, inputFilePath string, codecArgs []string, w io.Writer) error {
+	args := append([]string{"-i", inputFilePath}, codecArgs...)
+	args = append(args,
+		"-movflags", "frag_keyframe+empty_moov+default_base_moof",
+		"-f", "mp4",
+		"pipe:1",
+	)
+	cmd := exec.CommandContext(ctx, "ffmpeg", args...)
+
+	var stderr bytes.Buffer
+	cmd.Stdout = w
+	cmd.Stderr = &stderr
+	if err := runMediaTool(cmd); err != nil {
+		return &mediaToolError{tool: "ffmpeg", stderr: stderr.String(), err: err}
+	}
+	return nil
+}
+
+// processVideoForFastStart uses ffmpeg to create an MP4 with fast start,
+// with codecArgs from mp4CodecArgs.
 // It returns the filepath of the encoded video or an error if processing fails.
-func processVideoForFastStart(inputFilePath string) (string, error) {
+func processVideoForFastStart(inputFilePath string, codecArgs []string) (string, error) {
 	log.Println("Beginning fast start encoding...")
 	faststartPath := fmt.Sprintf("%s.processing", inputFilePath)
-	cmd := exec.Command(
-		"ffmpeg",
-		"-i", inputFilePath, // "-i": Input file option, followed by the path of the input file.
-		"-c", "copy", // "-c copy": Copy the codecs from the input to the output without re-encoding.
+	args := append([]string{"-i", inputFilePath}, codecArgs...) // "-i": Input file option, followed by the path of the input file.
+	args = append(args,
 		"-movflags", "faststart", // "-movflags faststart": Enables faststart for the MP4.
 		"-f", "mp4", // "-f mp4": Force the output format to be MP4.
 		faststartPath, // faststartPath: The destination path for the processed video file.
 	)
+	cmd := exec.Command("ffmpeg", args...)
 
 	var stderr bytes.Buffer
 	cmd.Stderr = &stderr
-	if err := cmd.Run(); err != nil {
-		return "", fmt.Errorf("ffmpeg error: %s\nCommand failed with: %v", stderr.String(), err)
+	if err := runMediaTool(cmd); err != nil {
+		return "", &mediaToolError{tool: "ffmpeg", stderr: stderr.String(), err: err}
 	}
 	fileInfo, err := os.Stat(faststartPath)
 	if err != nil {
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"net/url"
+	"path"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+// safeExtension is what an extension may look like in keys and file names.
+var safeExtension = regexp.MustCompile(`^\.[A-Za-z0-9][A-Za-z0-9._+-]*$`)
+
+func TestMediaTypeToExtension(t *testing.T) {
+	tests := map[string]string{
+		"video/mp4":                  ".mp4",
+		"video/mp4; codecs=avc1":     ".mp4",
+		"VIDEO/MP4":                  ".mp4",
+		"video/quicktime":            ".mov",
+		"video/x-matroska":           ".mkv",
+		"image/jpeg":                 ".jpg",
+		"image/png; charset=binary":  ".png",
+		"":                           ".bin",
+		"mp4":                        ".bin",
+		"video/":                     ".bin",
+		"video/../../etc/passwd":     ".bin",
+		"video/mp4,evil":             ".bin",
+		"application/x-unknown-type": ".bin",
+	}
+	for mediaType, want := range tests {
+		if got := mediaTypeToExtension(mediaType); got != want {
+			t.Errorf("mediaTypeToExtension(%q) = %q, want %q", mediaType, got, want)
+		}
+	}
+}
+
+func FuzzMediaTypeToExtension(f *testing.F) {
+	for _, seed := range []string{"video/mp4", "image/png; q=1", "text/vtt", "a/b/c", "video/mp4#x", "image/svg+xml", "x/y;z=\"/\""} {
+		f.Add(seed)
+	}
+	f.Fuzz(func(t *testing.T, mediaType string) {
+		ext := mediaTypeToExtension(mediaType)
+		if !safeExtension.MatchString(ext) {
+			t.Fatalf("mediaTypeToExtension(%q) = %q, not a safe extension", mediaType, ext)
+		}
+		if ext != ".bin" {
+			if _, ok := mediaTypeExtension(mediaType); !ok {
+				t.Fatalf("mediaTypeToExtension(%q) = %q for a type mediaTypeExtension rejects", mediaType, ext)
+			}
+		}
+	})
+}
+
+func FuzzGenerateRandomNameWithExtensionType(f *testing.F) {
+	for _, seed := range []string{"video/mp4", "image/jpeg", "", "not a type", "video/mp4; codecs=\"a/b\""} {
+		f.Add(seed)
+	}
+	f.Fuzz(func(t *testing.T, mediaType string) {
+		name := generateRandomNameWithExtensionType(mediaType)
+		if path.Base(name) != name || strings.HasPrefix(name, ".") {
+			t.Fatalf("generateRandomNameWithExtensionType(%q) = %q, not a plain file name", mediaType, name)
+		}
+		if url.PathEscape(name) != name {
+			t.Fatalf("generateRandomNameWithExtensionType(%q) = %q, needs escaping in URLs", mediaType, name)
+		}
+		if !strings.HasSuffix(name, mediaTypeToExtension(mediaType)) {
+			t.Fatalf("generateRandomNameWithExtensionType(%q) = %q, want extension %q", mediaType, name, mediaTypeToExtension(mediaType))
+		}
+	})
+}
+
+func TestContentAddressedName(t *testing.T) {
+	sum := []byte{0xfb, 0xff, 0x00, 0x3e}
+	a := contentAddressedName(sum, "image/png")
+	if a != contentAddressedName(sum, "image/png") {
+		t.Errorf("contentAddressedName isn't deterministic")
+	}
+	if url.PathEscape(a) != a || path.Base(a) != a {
+		t.Errorf("contentAddressedName() = %q, not URL and path safe", a)
+	}
+}
@@ -0,0 +1,400 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/google/uuid"
+)
+
+const (
+	maxAudioDescriptionSize = 500 << 20
+
+	audioDescriptionTitle = "Audio description"
+)
+
+// audioStream is one of a file's audio streams, by its index among all of
+// the file's streams.
+type audioStream struct {
+	index int
+	// added is set for streams flagged as a description or a dub, which are
+	// the ones muxAudioTracks adds.
+	added bool
+}
+
+func probeAudioStreams(filePath string) ([]audioStream, error) {
+	cmd := exec.Command(
+		"ffprobe", "-v", "error",
+		"-print_format", "json",
+		"-select_streams", "a",
+		"-show_entries", "stream=index:stream_disposition=visual_impaired,dub",
+		filePath,
+	)
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := runMediaTool(cmd); err != nil {
+		return nil, &mediaToolError{tool: "ffprobe", stderr: stderr.String(), err: err}
+	}
+
+	var output struct {
+		Streams []struct {
+			Index       int `json:"index"`
+			Disposition struct {
+				VisualImpaired int `json:"visual_impaired"`
+				Dub            int `json:"dub"`
+			} `json:"disposition"`
+		} `json:"streams"`
+	}
+	if err := json.Unmarshal(stdout.Bytes(), &output); err != nil {
+		return nil, fmt.Errorf("couldn't parse ffprobe output: %v", err)
+	}
+	streams := make([]audioStream, 0, len(output.Streams))
+	for _, s := range output.Streams {
+		added := s.Disposition.VisualImpaired == 1 || s.Disposition.Dub == 1
+		streams = append(streams, audioStream{index: s.Index, added: added})
+	}
+	return streams, nil
+}
+
+// encodeAudioTrack writes the first audio stream of the upload as AAC in
+// MP4, which every browser plays.
+func encodeAudioTrack(inputFilePath, outputPath string) error {
+	return runFFmpeg(
+		"-y",
+		"-i", inputFilePath,
+		"-map", "0:a:0",
+		"-c:a", "aac", "-b:a", "128k",
+		"-movflags", "faststart",
+		"-f", "mp4",
+		outputPath,
+	)
+}
+
+// addedAudioTrack is an audio file to mux into a video after its own audio.
+type addedAudioTrack struct {
+	path        string
+	disposition string
+	title       string
+	language    string
+}
+
+// muxAudioTracks rewrites the video with its own audio followed by tracks,
+// each flagged with its disposition so players can offer it as such. Tracks
+// the video already had from an earlier mux are dropped, so with no tracks
+// it's back to its own audio.
+func muxAudioTracks(videoPath string, tracks []addedAudioTrack, outputPath string) error {
+	streams, err := probeAudioStreams(videoPath)
+	if err != nil {
+		return err
+	}
+
+	args := []string{"-y", "-i", videoPath}
+	for _, t := range tracks {
+		args = append(args, "-i", t.path)
+	}
+	args = append(args, "-map", "0:v")
+	kept := 0
+	for _, s := range streams {
+		if !s.added {
+			args = append(args, "-map", fmt.Sprintf("0:%d", s.index))
+			kept++
+		}
+	}
+	for i := range tracks {
+		args = append(args, "-map", fmt.Sprintf("%d:a:0", i+1))
+	}
+	args = append(args, "-c", "copy")
+	for i, t := range tracks {
+		n := kept + i
+		args = append(args,
+			fmt.Sprintf("-c:a:%d", n), "aac",
+			fmt.Sprintf("-disposition:a:%d", n), t.disposition,
+			fmt.Sprintf("-metadata:s:a:%d", n), "title="+t.title,
+		)
+		if t.language != "" {
+			// MP4 only holds ISO 639 codes, so regions and scripts are left
+			// to the artifact.
+			primary, _, _ := strings.Cut(t.language, "-")
+			args = append(args, fmt.Sprintf("-metadata:s:a:%d", n), "language="+primary)
+		}
+	}
+	args = append(args, "-movflags", "faststart", "-f", "mp4", outputPath)
+	return runFFmpeg(args...)
+}
+
+// remuxVideoAudio replaces the video's local encode with one that has its
+// current audio description and audio tracks muxed in, downloaded from the
+// bucket. Since the mux is rebuilt from the artifacts every time, a failed
+// remux is fixed by the next one. Transcoded videos have no local encode
+// and are left alone.
+func (cfg *apiConfig) remuxVideoAudio(ctx context.Context, video *database.Video) error {
+	artifacts, err := cfg.db.GetArtifacts(video.ID, database.ArtifactKindVideo)
+	if err != nil {
+		return err
+	}
+	if len(artifacts) == 0 {
+		return nil
+	}
+	artifact := artifacts[0]
+
+	dir, err := os.MkdirTemp("", "tubely-remux_")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(dir)
+
+	originalPath := filepath.Join(dir, "original.mp4")
+	if err := cfg.downloadArtifactTo(ctx, artifact.Key, originalPath); err != nil {
+		return fmt.Errorf("couldn't download video: %w", err)
+	}
+
+	tracks := []addedAudioTrack{}
+	for _, kind := range []database.ArtifactKind{database.ArtifactKindAudioDescription, database.ArtifactKindAudioTrack} {
+		added, err := cfg.db.GetArtifacts(video.ID, kind)
+		if err != nil {
+			return err
+		}
+		sort.Slice(added, func(i, j int) bool { return added[i].Language < added[j].Language })
+		for _, a := range added {
+			path := filepath.Join(dir, fmt.Sprintf("track%d.m4a", len(tracks)))
+			if err := cfg.downloadArtifactTo(ctx, a.Key, path); err != nil {
+				return fmt.Errorf("couldn't download audio: %w", err)
+			}
+			track := addedAudioTrack{path: path, disposition: "dub", title: a.Language, language: a.Language}
+			if kind == database.ArtifactKindAudioDescription {
+				track.disposition = "visual_impaired"
+				track.title = audioDescriptionTitle
+			}
+			tracks = append(tracks, track)
+		}
+	}
+
+	muxedPath := filepath.Join(dir, "muxed.mp4")
+	if err := muxAudioTracks(originalPath, tracks, muxedPath); err != nil {
+		return err
+	}
+	muxed, err := os.Open(muxedPath)
+	if err != nil {
+		return err
+	}
+	defer muxed.Close()
+	info, err := muxed.Stat()
+	if err != nil {
+		return err
+	}
+
+	keys := cfg.objectKeys(video.UserID, video.ID)
+	newKey := func() (string, error) {
+		return keys.video("video/mp4", func() (string, error) {
+			return getVideoAspectRatio(muxedPath)
+		})
+	}
+	key, err := newKey()
+	if err != nil {
+		return err
+	}
+	key, err = putNewObject(key, newKey, func(key string) error {
+		if _, err := muxed.Seek(0, io.SeekStart); err != nil {
+			return err
+		}
+		_, err := cfg.s3Client.PutObject(ctx, &s3.PutObjectInput{
+			Bucket:      aws.String(cfg.s3Bucket),
+			Key:         aws.String(key),
+			Body:        muxed,
+			ContentType: aws.String("video/mp4"),
+			IfNoneMatch: aws.String("*"),
+			Tagging:     keys.tagging(database.ArtifactKindVideo),
+		})
+		return conditionalWriteError(err)
+	})
+	if err != nil {
+		return fmt.Errorf("couldn't upload video: %w", err)
+	}
+
+	params := artifact.CreateArtifactParams
+	params.Key = key
+	params.SizeBytes = info.Size()
+	err = cfg.replaceArtifacts(ctx, video.ID, database.ArtifactKindVideo, []database.CreateArtifactParams{params})
+	if err != nil {
+		return err
+	}
+	url := cfg.distributionURL(key)
+	video.VideoURL = &url
+	video.SizeBytes = info.Size()
+	return cfg.db.UpdateVideo(video)
+}
+
+func (cfg *apiConfig) downloadArtifactTo(ctx context.Context, key, path string) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	_, err = cfg.downloadObject(ctx, key, f)
+	return err
+}
+
+// receiveAudioUpload saves the multipart "audio" file to a temp file the
+// caller removes, after checking it has audio and the user has room for it
+// stored twice: on its own and in the video. It responds itself when it
+// fails.
+func (cfg *apiConfig) receiveAudioUpload(w http.ResponseWriter, r *http.Request, video database.Video) (*os.File, bool) {
+	if video.VideoURL == nil {
+		respondWithError(w, http.StatusConflict, "Video hasn't been uploaded yet", nil)
+		return nil, false
+	}
+
+	file, fileHeader, err := r.FormFile("audio")
+	if err != nil {
+		respondWithFormError(w, err)
+		return nil, false
+	}
+	defer file.Close()
+
+	mediaType, _, err := mime.ParseMediaType(fileHeader.Header.Get("Content-Type"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid Content-Type", err)
+		return nil, false
+	}
+	if _, ok := mediaTypeExtension(mediaType); !ok || !strings.HasPrefix(mediaType, "audio/") {
+		respondWithError(w, http.StatusBadRequest, "Invalid media type", nil)
+		return nil, false
+	}
+
+	_, limits, err := cfg.getUserLimits(video.UserID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get plan limits", err)
+		return nil, false
+	}
+	err = cfg.checkStorageQuota(video.UserID, limits, 2*fileHeader.Size, 0)
+	if errors.Is(err, errStorageQuotaExceeded) {
+		respondWithError(w, http.StatusForbidden, "Storage quota exceeded for your plan", err)
+		return nil, false
+	}
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't check storage quota", err)
+		return nil, false
+	}
+
+	upload, err := os.CreateTemp("", "tubely-audio_*"+mediaTypeToExtension(mediaType))
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Issue creating temp file", err)
+		return nil, false
+	}
+	if _, err := io.Copy(upload, file); err != nil {
+		upload.Close()
+		os.Remove(upload.Name())
+		respondWithError(w, http.StatusInternalServerError, "Couldn't write file to disk", err)
+		return nil, false
+	}
+
+	streams, err := probeAudioStreams(upload.Name())
+	if err != nil || len(streams) == 0 {
+		upload.Close()
+		os.Remove(upload.Name())
+		respondWithError(w, http.StatusUnprocessableEntity, "The file has no audio", err)
+		return nil, false
+	}
+	return upload, true
+}
+
+// handlerAudioDescriptionUpload adds an audio description to the video,
+// narration of what's on screen for blind and low vision viewers. The
+// file's first audio stream is muxed into the video as a second audio
+// track and kept as a separate file, for players that can't switch tracks.
+func (cfg *apiConfig) handlerAudioDescriptionUpload(w http.ResponseWriter, r *http.Request) {
+	r.Body = http.MaxBytesReader(w, r.Body, maxAudioDescriptionSize)
+	video, ok := cfg.ownedVideo(w, r)
+	if !ok {
+		return
+	}
+	upload, ok := cfg.receiveAudioUpload(w, r, video)
+	if !ok {
+		return
+	}
+	defer os.Remove(upload.Name())
+	defer upload.Close()
+
+	keys := cfg.objectKeys(video.UserID, video.ID)
+	artifact, err := cfg.uploadGeneratedArtifact(r.Context(), keys, database.ArtifactKindAudioDescription, "audio/mp4", nil, func(out string) error {
+		return encodeAudioTrack(upload.Name(), out)
+	})
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't process audio description", err)
+		return
+	}
+	err = cfg.replaceArtifacts(r.Context(), video.ID, database.ArtifactKindAudioDescription, []database.CreateArtifactParams{*artifact})
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't record video artifact", err)
+		return
+	}
+	err = cfg.remuxVideoAudio(r.Context(), &video)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't process audio description", err)
+		return
+	}
+	cfg.recordStorageUsage(video.UserID)
+
+	respondWithJSON(w, http.StatusOK, video)
+}
+
+// handlerAudioDescriptionDelete removes the description from the video
+// and deletes its file.
+func (cfg *apiConfig) handlerAudioDescriptionDelete(w http.ResponseWriter, r *http.Request) {
+	video, ok := cfg.ownedVideo(w, r)
+	if !ok {
+		return
+	}
+
+	artifacts, err := cfg.db.GetArtifacts(video.ID, database.ArtifactKindAudioDescription)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get video artifacts", err)
+		return
+	}
+	if len(artifacts) == 0 {
+		respondWithError(w, http.StatusNotFound, "Video has no audio description", nil)
+		return
+	}
+
+	err = cfg.replaceArtifacts(r.Context(), video.ID, database.ArtifactKindAudioDescription, nil)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't record video artifact", err)
+		return
+	}
+	err = cfg.remuxVideoAudio(r.Context(), &video)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't process audio description", err)
+		return
+	}
+	cfg.recordStorageUsage(video.UserID)
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// dropAddedAudio deletes the audio description and audio tracks of a video
+// whose file was replaced, since they were made for the old one. Failing
+// only leaves them behind, so it's logged.
+func (cfg *apiConfig) dropAddedAudio(ctx context.Context, videoID uuid.UUID) {
+	for _, kind := range []database.ArtifactKind{database.ArtifactKindAudioDescription, database.ArtifactKindAudioTrack} {
+		err := cfg.replaceArtifacts(ctx, videoID, kind, nil)
+		if err != nil {
+			log.Printf("Couldn't delete %s of video %s: %v", kind, videoID, err)
+		}
+	}
+}
@@ -0,0 +1,145 @@
+package main
+
+import (
+	"net/http"
+	"os"
+	"regexp"
+	"strings"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+)
+
+const (
+	maxAudioTrackSize = 500 << 20
+	maxAudioTracks    = 10
+)
+
+// languageTagPattern matches BCP 47 tags made of a language and optional
+// script, region or variant subtags, like "es", "pt-BR" or "zh-Hant-TW".
+var languageTagPattern = regexp.MustCompile(`^[a-zA-Z]{2,3}(-[a-zA-Z0-9]{2,8})*$`)
+
+// parseLanguageTag returns tag in its conventional case: lowercase
+// language, titlecase script and uppercase region.
+func parseLanguageTag(tag string) (string, bool) {
+	if !languageTagPattern.MatchString(tag) {
+		return "", false
+	}
+	subtags := strings.Split(strings.ToLower(tag), "-")
+	for i, s := range subtags[1:] {
+		switch {
+		case len(s) == 4 && s[0] >= 'a' && s[0] <= 'z':
+			subtags[i+1] = strings.ToUpper(s[:1]) + s[1:]
+		case len(s) == 2:
+			subtags[i+1] = strings.ToUpper(s)
+		}
+	}
+	return strings.Join(subtags, "-"), true
+}
+
+// handlerAudioTrackUpload adds or replaces the video's audio track in the
+// language of the path, a dub players can switch to. The file's first audio
+// stream is muxed into the video after its own audio and kept as a separate
+// file, for players that can't switch tracks.
+func (cfg *apiConfig) handlerAudioTrackUpload(w http.ResponseWriter, r *http.Request) {
+	r.Body = http.MaxBytesReader(w, r.Body, maxAudioTrackSize)
+	language, ok := parseLanguageTag(r.PathValue("language"))
+	if !ok {
+		respondWithError(w, http.StatusBadRequest, "Invalid language tag", nil)
+		return
+	}
+	video, ok := cfg.ownedVideo(w, r)
+	if !ok {
+		return
+	}
+
+	tracks, err := cfg.db.GetArtifacts(video.ID, database.ArtifactKindAudioTrack)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get video artifacts", err)
+		return
+	}
+	params := []database.CreateArtifactParams{}
+	for _, t := range tracks {
+		if t.Language != language {
+			params = append(params, t.CreateArtifactParams)
+		}
+	}
+	if len(params) >= maxAudioTracks {
+		respondWithErrorf(w, http.StatusConflict, nil, "A video can't have more than %d audio tracks", maxAudioTracks)
+		return
+	}
+
+	upload, ok := cfg.receiveAudioUpload(w, r, video)
+	if !ok {
+		return
+	}
+	defer os.Remove(upload.Name())
+	defer upload.Close()
+
+	keys := cfg.objectKeys(video.UserID, video.ID)
+	artifact, err := cfg.uploadGeneratedArtifact(r.Context(), keys, database.ArtifactKindAudioTrack, "audio/mp4", nil, func(out string) error {
+		return encodeAudioTrack(upload.Name(), out)
+	})
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't process audio track", err)
+		return
+	}
+	artifact.Language = language
+	params = append(params, *artifact)
+	err = cfg.replaceArtifacts(r.Context(), video.ID, database.ArtifactKindAudioTrack, params)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't record video artifact", err)
+		return
+	}
+	err = cfg.remuxVideoAudio(r.Context(), &video)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't process audio track", err)
+		return
+	}
+	cfg.recordStorageUsage(video.UserID)
+
+	respondWithJSON(w, http.StatusOK, video)
+}
+
+// handlerAudioTrackDelete removes the audio track in the language of the
+// path from the video and deletes its file.
+func (cfg *apiConfig) handlerAudioTrackDelete(w http.ResponseWriter, r *http.Request) {
+	language, ok := parseLanguageTag(r.PathValue("language"))
+	if !ok {
+		respondWithError(w, http.StatusBadRequest, "Invalid language tag", nil)
+		return
+	}
+	video, ok := cfg.ownedVideo(w, r)
+	if !ok {
+		return
+	}
+
+	tracks, err := cfg.db.GetArtifacts(video.ID, database.ArtifactKindAudioTrack)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get video artifacts", err)
+		return
+	}
+	params := []database.CreateArtifactParams{}
+	for _, t := range tracks {
+		if t.Language != language {
+			params = append(params, t.CreateArtifactParams)
+		}
+	}
+	if len(params) == len(tracks) {
+		respondWithError(w, http.StatusNotFound, "Video has no audio track in that language", nil)
+		return
+	}
+
+	err = cfg.replaceArtifacts(r.Context(), video.ID, database.ArtifactKindAudioTrack, params)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't record video artifact", err)
+		return
+	}
+	err = cfg.remuxVideoAudio(r.Context(), &video)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't process audio track", err)
+		return
+	}
+	cfg.recordStorageUsage(video.UserID)
+
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,34 @@
+package main
+
+import (
+	"log"
+	"net/http"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/google/uuid"
+)
+
+const (
+	auditEventLoginFailed            = "login_failed"
+	auditEventLoginBlocked           = "login_blocked"
+	auditEventAccountLocked          = "account_locked"
+	auditEventPasswordResetCompleted = "password_reset_completed"
+)
+
+// recordAuditEvent logs a security relevant event and stores it in the audit
+// table. Failing to store the event never fails the request.
+func (cfg *apiConfig) recordAuditEvent(r *http.Request, event string, userID *uuid.UUID, email, details string) {
+	ip := clientIP(r)
+	log.Printf("audit: %s email=%q ip=%s %s", event, email, ip, details)
+
+	err := cfg.db.CreateAuditEvent(database.CreateAuditEventParams{
+		Event:     event,
+		UserID:    userID,
+		Email:     email,
+		IPAddress: ip,
+		Details:   details,
+	})
+	if err != nil {
+		log.Printf("Couldn't store audit event %s: %v", event, err)
+	}
+}
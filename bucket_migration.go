@@ -0,0 +1,252 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/url"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/google/uuid"
+)
+
+// maxCopyObjectSize is the largest object a single CopyObject call can copy.
+const maxCopyObjectSize = 5 << 30
+
+// bucketCopier copies objects between buckets server-side, so nothing is
+// downloaded unless a copy has to be verified by content.
+type bucketCopier struct {
+	src, dst             *s3.Client
+	srcBucket, dstBucket string
+	dstPrefix            string
+	workers              int
+}
+
+type bucketObject struct {
+	key          string
+	size         int64
+	etag         string
+	lastModified time.Time
+}
+
+type copyPassResult struct {
+	copied, verified, bytes int64
+}
+
+// run makes one pass over the source bucket, copying whatever is missing or
+// different at the destination and verifying every copy. Objects already
+// copied are only compared, which is what makes an interrupted migration
+// resumable: running it again skips everything that made it across.
+func (c *bucketCopier) run(ctx context.Context) (copyPassResult, error) {
+	srcObjects, err := listBucket(ctx, c.src, c.srcBucket, "")
+	if err != nil {
+		return copyPassResult{}, fmt.Errorf("couldn't list s3://%s: %w", c.srcBucket, err)
+	}
+	dstObjects, err := listBucket(ctx, c.dst, c.dstBucket, c.dstPrefix)
+	if err != nil {
+		return copyPassResult{}, fmt.Errorf("couldn't list s3://%s: %w", c.dstBucket, err)
+	}
+	existing := make(map[string]bucketObject, len(dstObjects))
+	for _, obj := range dstObjects {
+		existing[obj.key] = obj
+	}
+
+	var result copyPassResult
+	var firstErr error
+	var errOnce sync.Once
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	jobs := make(chan bucketObject)
+	var wg sync.WaitGroup
+	for range c.workers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for obj := range jobs {
+				copied, err := c.copyObject(ctx, obj, existing)
+				if err != nil {
+					errOnce.Do(func() {
+						firstErr = fmt.Errorf("%s: %w", obj.key, err)
+						cancel()
+					})
+					continue
+				}
+				if copied {
+					atomic.AddInt64(&result.copied, 1)
+					atomic.AddInt64(&result.bytes, obj.size)
+				}
+				if n := atomic.AddInt64(&result.verified, 1); n%1000 == 0 {
+					log.Printf("Verified %d of %d objects", n, len(srcObjects))
+				}
+			}
+		}()
+	}
+	for _, obj := range srcObjects {
+		select {
+		case jobs <- obj:
+		case <-ctx.Done():
+		}
+	}
+	close(jobs)
+	wg.Wait()
+	return result, firstErr
+}
+
+// copyObject copies obj unless an identical copy already exists, then
+// verifies the copy. It reports whether anything was copied.
+func (c *bucketCopier) copyObject(ctx context.Context, obj bucketObject, existing map[string]bucketObject) (bool, error) {
+	dstKey := c.dstPrefix + obj.key
+	if dst, ok := existing[dstKey]; ok && dst.size == obj.size {
+		same, err := c.sameContent(ctx, obj, dst)
+		if err != nil {
+			return false, err
+		}
+		if same {
+			return false, nil
+		}
+	}
+
+	if obj.size > maxCopyObjectSize {
+		return false, fmt.Errorf("%d bytes is over the %d byte CopyObject limit", obj.size, maxCopyObjectSize)
+	}
+	_, err := c.dst.CopyObject(ctx, &s3.CopyObjectInput{
+		Bucket:     aws.String(c.dstBucket),
+		Key:        aws.String(dstKey),
+		CopySource: aws.String(url.PathEscape(c.srcBucket + "/" + obj.key)),
+	})
+	if err != nil {
+		return false, err
+	}
+
+	head, err := c.dst.HeadObject(ctx, &s3.HeadObjectInput{
+		Bucket: aws.String(c.dstBucket),
+		Key:    aws.String(dstKey),
+	})
+	if err != nil {
+		return false, err
+	}
+	dst := bucketObject{key: dstKey, size: aws.ToInt64(head.ContentLength), etag: aws.ToString(head.ETag)}
+	if dst.size != obj.size {
+		return false, fmt.Errorf("copy is %d bytes, expected %d", dst.size, obj.size)
+	}
+	same, err := c.sameContent(ctx, obj, dst)
+	if err != nil {
+		return false, err
+	}
+	if !same {
+		return false, errors.New("copy doesn't match the source checksum")
+	}
+	return true, nil
+}
+
+// sameContent compares checksums. ETags are MD5 sums for objects uploaded in
+// one part, which is how the app uploads; multipart ETags depend on the part
+// sizes, so those objects are hashed instead.
+func (c *bucketCopier) sameContent(ctx context.Context, src, dst bucketObject) (bool, error) {
+	if !strings.Contains(src.etag, "-") && !strings.Contains(dst.etag, "-") {
+		return src.etag == dst.etag, nil
+	}
+	srcSum, err := objectSHA256(ctx, c.src, c.srcBucket, src.key)
+	if err != nil {
+		return false, err
+	}
+	dstSum, err := objectSHA256(ctx, c.dst, c.dstBucket, dst.key)
+	if err != nil {
+		return false, err
+	}
+	return bytes.Equal(srcSum, dstSum), nil
+}
+
+func objectSHA256(ctx context.Context, client *s3.Client, bucket, key string) ([]byte, error) {
+	out, err := client.GetObject(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(bucket),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		return nil, err
+	}
+	defer out.Body.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, out.Body); err != nil {
+		return nil, err
+	}
+	return h.Sum(nil), nil
+}
+
+func listBucket(ctx context.Context, client *s3.Client, bucket, prefix string) ([]bucketObject, error) {
+	objects := []bucketObject{}
+	paginator := s3.NewListObjectsV2Paginator(client, &s3.ListObjectsV2Input{
+		Bucket: aws.String(bucket),
+		Prefix: aws.String(prefix),
+	})
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return nil, err
+		}
+		for _, obj := range page.Contents {
+			objects = append(objects, bucketObject{
+				key:          aws.ToString(obj.Key),
+				size:         aws.ToInt64(obj.Size),
+				etag:         aws.ToString(obj.ETag),
+				lastModified: aws.ToTime(obj.LastModified),
+			})
+		}
+	}
+	return objects, nil
+}
+
+// runBucketMigration makes a copy pass and records its outcome. With flip
+// set, it puts the API into maintenance mode first so no uploads land in
+// the old bucket during the final pass, then switches the database over.
+// Maintenance mode stays on: servers keep using the old bucket until they
+// restart with the new settings.
+func runBucketMigration(ctx context.Context, db database.Client, copier *bucketCopier, migration database.BucketMigration, flip bool) error {
+	if flip {
+		_, err := db.SetMaintenance(uuid.Nil, database.SetMaintenanceParams{
+			Reason:            fmt.Sprintf("moving s3://%s to s3://%s", migration.SourceBucket, migration.DestBucket),
+			RetryAfterSeconds: defaultMaintenanceRetryAfter,
+		})
+		if err != nil {
+			return fmt.Errorf("couldn't start maintenance mode: %w", err)
+		}
+		log.Printf("Maintenance mode is on, waiting %s for every instance to notice", maintenanceCacheTTL)
+		time.Sleep(maintenanceCacheTTL)
+	}
+
+	result, err := copier.run(ctx)
+	status := database.BucketMigrationCopying
+	if err == nil {
+		status = database.BucketMigrationCopied
+	}
+	updateErr := db.UpdateBucketMigrationProgress(migration.ID, status,
+		migration.ObjectsCopied+result.copied, result.verified, migration.BytesCopied+result.bytes)
+	if err != nil {
+		return fmt.Errorf("copy pass stopped after %d objects, run the command again to resume: %w", result.verified, err)
+	}
+	if updateErr != nil {
+		return updateErr
+	}
+	log.Printf("Copied %d objects (%d bytes) and verified all %d objects in s3://%s", result.copied, result.bytes, result.verified, migration.DestBucket)
+
+	if !flip {
+		return nil
+	}
+	if err := db.FlipBucketMigration(migration.ID); err != nil {
+		return err
+	}
+	log.Printf("The database now points at s3://%s. Restart every instance with\n\n\tS3_BUCKET=%s\n\tS3_REGION=%s\n\tS3_CF_DISTRO=%s\n\nthen end maintenance mode with DELETE /api/admin/maintenance. The old bucket is left as it was.",
+		migration.DestBucket, migration.DestBucket, migration.DestRegion, migration.DestURL)
+	return nil
+}
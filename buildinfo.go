@@ -0,0 +1,63 @@
+package main
+
+import (
+	"net/http"
+	"runtime/debug"
+)
+
+// version is set when building releases, with
+// go build -ldflags "-X main.version=v1.2.3".
+var version = "dev"
+
+type buildInfo struct {
+	Version    string `json:"version"`
+	Commit     string `json:"commit"`
+	CommitTime string `json:"commit_time"`
+	// Modified is set when the binary was built from a dirty working tree.
+	Modified  bool   `json:"modified"`
+	GoVersion string `json:"go_version"`
+}
+
+// readBuildInfo combines version with the VCS details the go command stamps
+// into binaries built from a checkout.
+func readBuildInfo() buildInfo {
+	info := buildInfo{Version: version}
+	build, ok := debug.ReadBuildInfo()
+	if !ok {
+		return info
+	}
+	info.GoVersion = build.GoVersion
+	for _, setting := range build.Settings {
+		switch setting.Key {
+		case "vcs.revision":
+			info.Commit = setting.Value
+		case "vcs.time":
+			info.CommitTime = setting.Value
+		case "vcs.modified":
+			info.Modified = setting.Value == "true"
+		}
+	}
+	return info
+}
+
+func (info buildInfo) String() string {
+	s := "tubely " + info.Version
+	if info.Commit != "" {
+		commit := info.Commit
+		if len(commit) > 12 {
+			commit = commit[:12]
+		}
+		if info.Modified {
+			commit += "-dirty"
+		}
+		s += " (" + commit + ")"
+	}
+	if info.GoVersion != "" {
+		s += " " + info.GoVersion
+	}
+	return s
+}
+
+func handlerBuildInfo(w http.ResponseWriter, r *http.Request) {
+	respondWithJSON(w, http.StatusOK, readBuildInfo())
+}
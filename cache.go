@@ -1,10 +1,28 @@
 package main
 
-import "net/http"
+import (
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+)
 
-func noCacheMiddleware(next http.Handler) http.Handler {
+// immutableCacheControl is for responses whose URL never points at
+// different bytes.
+const immutableCacheControl = "public, max-age=31536000, immutable"
+
+// assetCacheMiddleware lets clients cache assets for good. Asset names are
+// random or derived from their content and files are never rewritten, so
+// replacing a thumbnail changes its URL instead. Missing files aren't cached,
+// as they may show up later, e.g. after a restore.
+func assetCacheMiddleware(root string, next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		w.Header().Set("Cache-Control", "no-store")
+		name := filepath.FromSlash(path.Clean("/" + r.URL.Path))
+		if info, err := os.Stat(filepath.Join(root, name)); err == nil && info.Mode().IsRegular() {
+			w.Header().Set("Cache-Control", immutableCacheControl)
+		} else {
+			w.Header().Set("Cache-Control", "no-store")
+		}
 		next.ServeHTTP(w, r)
 	})
 }
@@ -0,0 +1,428 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/storage"
+	"github.com/google/uuid"
+)
+
+const cliUsage = `Usage: tubely [command]
+
+Without a command the API server is started. With --dev it runs against
+local storage instead of AWS and seeds a demo account with sample videos.
+
+Commands:
+  bucket-migrate  copy every object to another bucket and switch over to it
+  db-restore  restore the database from a backup in DB_BACKUP_BUCKET
+  dr-restore  restore the database, bucket and assets from the DR provider
+  lifecycle   apply the LIFECYCLE_* rules to S3_BUCKET
+  recalculate-usage  recompute users' storage usage from S3_BUCKET
+  reconcile   compare S3_BUCKET with the database and fix what differs
+  version     print the version and commit the binary was built from
+`
+
+// runCommand runs a maintenance command instead of the server. Commands
+// read the same environment as the server.
+func runCommand(args []string) error {
+	switch args[0] {
+	case "bucket-migrate":
+		return cmdBucketMigrate(args[1:])
+	case "db-restore":
+		return cmdDBRestore(args[1:])
+	case "dr-restore":
+		return cmdDRRestore(args[1:])
+	case "lifecycle":
+		return cmdLifecycle(args[1:])
+	case "recalculate-usage":
+		return cmdRecalculateUsage(args[1:])
+	case "reconcile":
+		return cmdReconcile(args[1:])
+	case "version", "--version":
+		fmt.Println(readBuildInfo())
+		return nil
+	case "help", "-h", "--help":
+		fmt.Print(cliUsage)
+		return nil
+	default:
+		fmt.Fprint(os.Stderr, cliUsage)
+		return fmt.Errorf("unknown command %q", args[0])
+	}
+}
+
+func cmdDBRestore(args []string) error {
+	flags := flag.NewFlagSet("db-restore", flag.ExitOnError)
+	force := flags.Bool("force", false, "replace an existing database file")
+	list := flags.Bool("list", false, "list available backups instead of restoring")
+	key := flags.String("key", "", "backup to restore, defaults to the latest")
+	flags.Parse(args)
+
+	ctx := context.Background()
+	bucket := os.Getenv("DB_BACKUP_BUCKET")
+	if bucket == "" {
+		return errors.New("DB_BACKUP_BUCKET environment variable is not set")
+	}
+	dbPath := os.Getenv("DB_PATH")
+	if dbPath == "" {
+		return errors.New("DB_PATH environment variable is not set")
+	}
+	awsConfig, err := config.LoadDefaultConfig(ctx)
+	if err != nil {
+		return err
+	}
+	store := storage.NewS3(s3.NewFromConfig(awsConfig), bucket)
+
+	if *list {
+		backups, err := store.List(ctx, dbBackupPrefix)
+		if err != nil {
+			return err
+		}
+		for _, obj := range backups {
+			fmt.Printf("%s\t%d\t%s\n", obj.Key, obj.Size, obj.LastModified.Format(time.RFC3339))
+		}
+		return nil
+	}
+
+	var snapshot storage.Object
+	if *key != "" {
+		snapshot = storage.Object{Key: *key}
+	} else {
+		snapshot, err = latestDBSnapshot(ctx, store, dbBackupPrefix)
+		if err != nil {
+			return err
+		}
+	}
+	if err := restoreDBSnapshot(ctx, store, snapshot, dbPath, *force); err != nil {
+		return err
+	}
+	log.Printf("Restored %s from %s to %s", snapshot.Key, store.Name(), dbPath)
+	return nil
+}
+
+func cmdDRRestore(args []string) error {
+	flags := flag.NewFlagSet("dr-restore", flag.ExitOnError)
+	force := flags.Bool("force", false, "replace an existing database file")
+	dbOnly := flags.Bool("db-only", false, "only restore the database, not the bucket and assets")
+	flags.Parse(args)
+
+	ctx := context.Background()
+	drStore, err := drStoreFromEnv()
+	if err != nil {
+		return err
+	}
+	if drStore == nil {
+		return errors.New("DR_S3_BUCKET environment variable is not set")
+	}
+	dbPath := os.Getenv("DB_PATH")
+	if dbPath == "" {
+		return errors.New("DB_PATH environment variable is not set")
+	}
+
+	snapshot, err := latestDBSnapshot(ctx, drStore, drDBPrefix)
+	if err != nil {
+		return err
+	}
+	if err := restoreDBSnapshot(ctx, drStore, snapshot, dbPath, *force); err != nil {
+		return err
+	}
+	log.Printf("Restored %s from %s to %s", snapshot.Key, drStore.Name(), dbPath)
+	if *dbOnly {
+		return nil
+	}
+
+	bucket := os.Getenv("S3_BUCKET")
+	if bucket == "" {
+		return errors.New("S3_BUCKET environment variable is not set")
+	}
+	assetsRoot := os.Getenv("ASSETS_ROOT")
+	if assetsRoot == "" {
+		return errors.New("ASSETS_ROOT environment variable is not set")
+	}
+	awsConfig, err := config.LoadDefaultConfig(ctx)
+	if err != nil {
+		return err
+	}
+
+	client, err := mediaBucketClient(awsConfig, bucket)
+	if err != nil {
+		return err
+	}
+	copied, err := storage.Mirror(ctx, storage.NewS3(client, bucket), "", drStore, drBucketPrefix)
+	if err != nil {
+		return err
+	}
+	log.Printf("Restored %d objects to s3://%s", copied, bucket)
+
+	copied, err = storage.Mirror(ctx, storage.NewDir(assetsRoot), "", drStore, drAssetsPrefix)
+	if err != nil {
+		return err
+	}
+	log.Printf("Restored %d assets to %s", copied, assetsRoot)
+	return nil
+}
+
+func cmdBucketMigrate(args []string) error {
+	flags := flag.NewFlagSet("bucket-migrate", flag.ExitOnError)
+	dest := flags.String("to", "", "destination bucket")
+	region := flags.String("region", os.Getenv("S3_REGION"), "destination bucket region")
+	prefix := flags.String("prefix", "", "key prefix for the objects in the destination bucket")
+	destURL := flags.String("url", "", "URL the destination bucket is served from, i.e. the new S3_CF_DISTRO")
+	flip := flags.Bool("flip", false, "make a final pass in maintenance mode and switch the database to the destination")
+	workers := flags.Int("workers", 8, "objects copied in parallel")
+	status := flags.Bool("status", false, "list migrations instead of running one")
+	flags.Parse(args)
+
+	ctx := context.Background()
+	dbPath := os.Getenv("DB_PATH")
+	if dbPath == "" {
+		return errors.New("DB_PATH environment variable is not set")
+	}
+	db, err := database.NewClient(dbPath)
+	if err != nil {
+		return err
+	}
+
+	if *status {
+		migrations, err := db.GetBucketMigrations()
+		if err != nil {
+			return err
+		}
+		for _, m := range migrations {
+			fmt.Printf("%s\ts3://%s -> s3://%s/%s\t%s\t%d objects copied, %d verified\t%s\n",
+				m.ID, m.SourceBucket, m.DestBucket, m.DestPrefix, m.Status, m.ObjectsCopied, m.ObjectsVerified, m.UpdatedAt.Format(time.RFC3339))
+		}
+		return nil
+	}
+
+	source := os.Getenv("S3_BUCKET")
+	if source == "" {
+		return errors.New("S3_BUCKET environment variable is not set")
+	}
+	sourceURL := os.Getenv("S3_CF_DISTRO")
+	if sourceURL == "" {
+		return errors.New("S3_CF_DISTRO environment variable is not set")
+	}
+	if *dest == "" || *destURL == "" || *region == "" {
+		return errors.New("-to, -url and -region are required")
+	}
+	if *dest == source {
+		return errors.New("the destination must be a different bucket")
+	}
+	if *prefix != "" && !strings.HasSuffix(*prefix, "/") {
+		*prefix += "/"
+	}
+
+	awsConfig, err := config.LoadDefaultConfig(ctx, config.WithRegion(os.Getenv("S3_REGION")))
+	if err != nil {
+		return err
+	}
+	src, err := mediaBucketClient(awsConfig, source)
+	if err != nil {
+		return err
+	}
+	copier := &bucketCopier{
+		src:       src,
+		dst:       s3.NewFromConfig(awsConfig, func(o *s3.Options) { o.Region = *region }),
+		srcBucket: source,
+		dstBucket: *dest,
+		dstPrefix: *prefix,
+		workers:   max(*workers, 1),
+	}
+
+	migration, err := db.StartBucketMigration(database.CreateBucketMigrationParams{
+		SourceBucket: source,
+		SourceURL:    strings.TrimSuffix(sourceURL, "/"),
+		DestBucket:   *dest,
+		DestRegion:   *region,
+		DestPrefix:   *prefix,
+		DestURL:      strings.TrimSuffix(*destURL, "/"),
+	})
+	if err != nil {
+		return err
+	}
+	log.Printf("Migration %s: s3://%s -> s3://%s/%s (%s)", migration.ID, source, *dest, *prefix, migration.Status)
+	return runBucketMigration(ctx, db, copier, migration, *flip)
+}
+
+func cmdLifecycle(args []string) error {
+	flags := flag.NewFlagSet("lifecycle", flag.ExitOnError)
+	dryRun := flags.Bool("dry-run", false, "print the rules the bucket would have instead of applying them")
+	flags.Parse(args)
+
+	lc, err := lifecycleConfigFromEnv()
+	if err != nil {
+		return err
+	}
+	print := func(rules []types.LifecycleRule) error {
+		data, err := json.MarshalIndent(viewLifecycleRules(rules), "", "  ")
+		if err != nil {
+			return err
+		}
+		fmt.Println(string(data))
+		return nil
+	}
+	ctx := context.Background()
+	bucket := os.Getenv("S3_BUCKET")
+	if bucket == "" {
+		return errors.New("S3_BUCKET environment variable is not set")
+	}
+	awsConfig, err := config.LoadDefaultConfig(ctx, config.WithRegion(os.Getenv("S3_REGION")))
+	if err != nil {
+		return err
+	}
+	client, err := mediaBucketClient(awsConfig, bucket)
+	if err != nil {
+		return err
+	}
+	if *dryRun {
+		rules, err := planLifecycle(ctx, client, bucket, lc)
+		if err != nil {
+			return err
+		}
+		log.Printf("s3://%s would have %d lifecycle rules:", bucket, len(rules))
+		return print(rules)
+	}
+	rules, err := applyLifecycle(ctx, client, bucket, lc)
+	if err != nil {
+		return err
+	}
+	log.Printf("s3://%s now has %d lifecycle rules:", bucket, len(rules))
+	return print(rules)
+}
+
+func cmdReconcile(args []string) error {
+	flags := flag.NewFlagSet("reconcile", flag.ExitOnError)
+	fixOrphans := flags.Bool("fix-orphans", false, "move objects no artifact points at to "+trashPrefix)
+	fixMissing := flags.Bool("fix-missing", false, "remove artifacts whose object is gone")
+	fixSizes := flags.Bool("fix-sizes", false, "correct recorded sizes that differ from the object's")
+	flags.Parse(args)
+
+	ctx := context.Background()
+	rc, err := reconcilerFromEnv(ctx)
+	if err != nil {
+		return err
+	}
+
+	report, err := rc.scanAndSave(ctx)
+	if err != nil {
+		return err
+	}
+	printReconciliationReport(report)
+	fixes := reconcileFixes{orphans: *fixOrphans, missing: *fixMissing, sizes: *fixSizes}
+	if fixes == (reconcileFixes{}) || len(report.Findings) == 0 {
+		return nil
+	}
+
+	fixed, err := rc.fix(ctx, report, fixes)
+	log.Printf("Fixed %d findings", fixed)
+	if err != nil {
+		return err
+	}
+	// Scan again so the admin API shows what's left.
+	report, err = rc.scanAndSave(ctx)
+	if err != nil {
+		return err
+	}
+	printReconciliationReport(report)
+	return nil
+}
+
+// reconcilerFromEnv returns a reconciler for the DB_PATH database and
+// S3_BUCKET.
+func reconcilerFromEnv(ctx context.Context) (reconciler, error) {
+	dbPath := os.Getenv("DB_PATH")
+	if dbPath == "" {
+		return reconciler{}, errors.New("DB_PATH environment variable is not set")
+	}
+	bucket := os.Getenv("S3_BUCKET")
+	if bucket == "" {
+		return reconciler{}, errors.New("S3_BUCKET environment variable is not set")
+	}
+	db, err := database.NewClient(dbPath)
+	if err != nil {
+		return reconciler{}, err
+	}
+	awsConfig, err := config.LoadDefaultConfig(ctx, config.WithRegion(os.Getenv("S3_REGION")))
+	if err != nil {
+		return reconciler{}, err
+	}
+	client, err := mediaBucketClient(awsConfig, bucket)
+	if err != nil {
+		return reconciler{}, err
+	}
+	return reconciler{
+		db:             db,
+		client:         client,
+		bucket:         bucket,
+		ignorePrefixes: reconcileIgnorePrefixesFromEnv(),
+	}, nil
+}
+
+func printReconciliationReport(report database.ReconciliationReport) {
+	for _, f := range report.Findings {
+		var objectSize, recordedSize string
+		if f.ObjectSize != nil {
+			objectSize = fmt.Sprint(*f.ObjectSize)
+		}
+		if f.RecordedSize != nil {
+			recordedSize = fmt.Sprint(*f.RecordedSize)
+		}
+		fmt.Printf("%s\t%s\tobject=%s\trecorded=%s\n", f.Kind, f.Key, objectSize, recordedSize)
+	}
+	log.Printf("s3://%s: %d objects and %d artifacts checked, %d orphaned objects, %d missing objects, %d size mismatches",
+		report.Bucket, report.ObjectsScanned, report.ArtifactsChecked, report.OrphanedObjects, report.MissingObjects, report.SizeMismatches)
+}
+
+func cmdRecalculateUsage(args []string) error {
+	flags := flag.NewFlagSet("recalculate-usage", flag.ExitOnError)
+	user := flags.String("user", "", "ID of the only user to recalculate, defaults to every user")
+	fix := flags.Bool("fix", false, "remove artifacts whose object is gone and correct wrong sizes")
+	flags.Parse(args)
+
+	userID := uuid.Nil
+	if *user != "" {
+		var err error
+		userID, err = uuid.Parse(*user)
+		if err != nil {
+			return fmt.Errorf("invalid user ID: %w", err)
+		}
+	}
+
+	ctx := context.Background()
+	rc, err := reconcilerFromEnv(ctx)
+	if err != nil {
+		return err
+	}
+	report, err := rc.recalculateUsage(ctx, userID, *fix)
+	if err != nil {
+		return err
+	}
+	for _, drift := range report.Users {
+		fmt.Printf("%s\trecorded=%d\tactual=%d\n", drift.UserID, drift.RecordedBytes, drift.ActualBytes)
+		for _, f := range drift.Findings {
+			objectSize := ""
+			if f.ObjectSize != nil {
+				objectSize = fmt.Sprint(*f.ObjectSize)
+			}
+			fmt.Printf("  %s\t%s\tobject=%s\trecorded=%d\n", f.Kind, f.Key, objectSize, *f.RecordedSize)
+		}
+	}
+	action := "found"
+	if report.Fixed {
+		action = "fixed"
+	}
+	log.Printf("%d users and %d objects checked, %s drift for %d users", report.UsersChecked, report.ObjectsChecked, action, len(report.Users))
+	return nil
+}
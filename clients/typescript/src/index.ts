@@ -0,0 +1,3329 @@
+// Code generated by go run ./cmd/tsclient. DO NOT EDIT.
+
+const BASE_PATH = "/api/v2";
+
+export interface AbuseBlock {
+  key: string;
+  reason: string;
+  blocked_until: string;
+}
+
+export interface AccessLogIngestResult {
+  files_ingested: number;
+  files_skipped: number;
+  entries: number;
+  unattributed: number;
+  bytes: number;
+}
+
+export interface AdminCreateBackupResponse {
+  key: string;
+}
+
+export interface AdminCreateNotificationChannelRequest {
+  /** kind is one of "slack", "discord" or "email". */
+  kind?: string;
+  /** target is the webhook URL, or the address for email channels. */
+  target?: string;
+  events?: string[];
+}
+
+export interface AdminCreateProcessingWindowRequest {
+  reason?: string;
+  /**
+   * daily_start and daily_end are times of day like "18:00" in timezone, for a
+   * window repeating every day. daily_end before daily_start makes the window
+   * span midnight.
+   */
+  daily_start?: string;
+  daily_end?: string;
+  timezone?: string;
+  /** starts_at and ends_at are set instead for a one-off freeze. */
+  starts_at?: string | null;
+  ends_at?: string | null;
+}
+
+export interface AdminCreateTakedownRequest {
+  kind?: TakedownKind;
+  reason?: string;
+}
+
+export interface AdminGetCostsResponse {
+  month: string;
+  days_elapsed: number;
+  days_in_month: number;
+  storage: StorageClassUsage[];
+  storage_cost: CostLine;
+  requests_cost: CostLine;
+  egress_cost: CostLine;
+  transcoding_cost: CostLine;
+  total: CostLine;
+  /**
+   * egress_source tells whether egress came from access logs or was estimated
+   * from issued URLs.
+   */
+  egress_source: string;
+}
+
+export interface AdminGetDebugLoggingResponse {
+  routes: string[];
+}
+
+export interface AdminGetMaintenanceResponse {
+  enabled: boolean;
+  enabled_at?: string;
+  enabled_by?: string;
+  /**
+   * reason tells other admins what's going on. Users only see a generic
+   * message.
+   */
+  reason?: string;
+  retry_after_seconds?: number;
+}
+
+export interface AdminGetProcessingMetricsResponse {
+  since: string;
+  groups: ProcessingReportGroup[];
+}
+
+export interface AdminListBackupsItem {
+  key: string;
+  size_bytes: number;
+  created_at: string;
+}
+
+export interface AdminListFeatureFlagsItem {
+  name: string;
+  description: string;
+  /** default applies until an admin sets the flag. */
+  default: boolean;
+  /** flag is null while the feature is on its default. */
+  flag: FeatureFlag | null;
+}
+
+export interface AdminListProcessingWindowsResponse {
+  /** active is the window pausing processing right now, if any. */
+  active: ProcessingWindow | null;
+  windows: ProcessingWindow[];
+  queued: QueuedUpload[];
+}
+
+export interface AdminListRateLimitsResponse {
+  window_seconds: number;
+  block_for_seconds: number;
+  defaults: RateLimitsView;
+  plans: PlanRateLimit[];
+}
+
+export interface AdminRecalculateStorageUsageRequest {
+  user_id?: string;
+  fix?: boolean;
+}
+
+export interface AdminResolveClaimRequest {
+  decision?: ClaimStatus;
+  note?: string;
+}
+
+export interface AdminSetDebugLoggingRequest {
+  routes?: string[];
+}
+
+export interface AdminSetFeatureFlagRequest {
+  enabled?: boolean;
+  rollout_percent?: number;
+  user_ids?: string[];
+}
+
+export interface AdminSetRateLimitRequest {
+  max_requests?: number;
+  max_distinct?: number;
+  burst?: number;
+}
+
+export interface AdminStartMaintenanceRequest {
+  /**
+   * reason tells other admins what's going on. Users only see a generic
+   * message.
+   */
+  reason?: string;
+  retry_after_seconds?: number;
+}
+
+export interface AdminStats {
+  users: number;
+  videos: number;
+  transcodes: TranscodeStats[];
+}
+
+export interface AdminTestHTTPActionRequest {
+  event?: NotificationEvent;
+  data?: Record<string, unknown>;
+}
+
+export interface AdminTestHTTPActionResponse {
+  method?: string;
+  url?: string;
+  body?: string;
+  error?: string;
+}
+
+export interface AdminTestNotificationChannelsItem {
+  id: string;
+  error?: string;
+}
+
+export type AppealStatus = "pending" | "upheld";
+
+export interface AppealTakedownRequest {
+  message?: string;
+}
+
+export type ArtifactKind = "audio_description" | "audio_track" | "captions" | "preview" | "rendition" | "source" | "sprite" | "thumbnail" | "video";
+
+export interface ArtifactLink {
+  url: string;
+  width?: number;
+  height?: number;
+  size_bytes: number;
+  language?: string;
+}
+
+export interface BatchResponse {
+  dry_run?: boolean;
+  succeeded: number;
+  failed: number;
+  results: BatchResult[];
+}
+
+export interface BatchResult {
+  video_id: string;
+  status: number;
+  /**
+   * error and code are set for failed videos, video for the others unless they
+   * were deleted, and plan for deletes made as a dry run.
+   */
+  error?: string;
+  code?: string;
+  video?: Video | null;
+  plan?: DeletionPlan | null;
+}
+
+export interface BatchVideosRequest {
+  action?: string;
+  video_ids?: string[];
+  add_tags?: string[];
+  remove_tags?: string[];
+}
+
+export interface BuildInfo {
+  version: string;
+  commit: string;
+  commit_time: string;
+  /** modified is set when the binary was built from a dirty working tree. */
+  modified: boolean;
+  go_version: string;
+}
+
+export interface ByteRange {
+  start: number;
+  end: number;
+}
+
+export interface CMSSync {
+  id: string;
+  created_at: string;
+  user_id: string;
+  url: string;
+  format: CMSSyncFormat;
+  /** graphql_query is the mutation sent by graphql syncs. */
+  graphql_query?: string;
+  /** field_map renames video fields for the CMS. */
+  field_map: Record<string, string>;
+}
+
+export interface CMSSyncEvent {
+  id: number;
+  created_at: string;
+  sync_id: string;
+  video_id: string;
+  event: string;
+  status: string;
+  attempts: number;
+  next_attempt_at: string;
+  last_error?: string;
+  delivered_at: string | null;
+}
+
+export type CMSSyncFormat = "graphql" | "rest";
+
+export interface CMSSyncWithSecret {
+  id: string;
+  created_at: string;
+  user_id: string;
+  url: string;
+  format: CMSSyncFormat;
+  /** graphql_query is the mutation sent by graphql syncs. */
+  graphql_query?: string;
+  /** field_map renames video fields for the CMS. */
+  field_map: Record<string, string>;
+  /** secret is only set when the sync is created. */
+  secret?: string;
+}
+
+export interface Claim {
+  id: string;
+  created_at: string;
+  status: ClaimStatus;
+  video_id: string;
+  claimant_id: string;
+  /** work identifies the copyrighted work the video is said to infringe. */
+  work: string;
+  details: string;
+  contact_email: string;
+  dispute_message?: string;
+  disputed_at?: string | null;
+  resolution_note?: string;
+  resolved_at?: string | null;
+}
+
+export type ClaimStatus = "disputed" | "open" | "rejected" | "upheld";
+
+export interface CompleteUploadRequest {
+  key: string;
+  quality?: string;
+}
+
+export interface ConfirmEmailVerificationRequest {
+  token: string;
+}
+
+export interface ConfirmPasswordResetRequest {
+  token: string;
+  password: string;
+}
+
+export interface CostLine {
+  month_to_date_usd: number;
+  projected_usd: number;
+}
+
+export interface CreateCMSSyncParams {
+  user_id?: string;
+  url?: string;
+  format?: CMSSyncFormat;
+  /** graphql_query is the mutation sent by graphql syncs. */
+  graphql_query?: string;
+  /** field_map renames video fields for the CMS. */
+  field_map?: Record<string, string>;
+}
+
+export interface CreateCheckoutResponse {
+  url: string;
+}
+
+export interface CreateClaimRequest {
+  work?: string;
+  details?: string;
+  contact_email?: string;
+}
+
+export interface CreateEmbedTokenRequest {
+  allowed_domains?: string[];
+}
+
+export interface CreateHTTPActionParams {
+  name?: string;
+  events?: string[];
+  method?: string;
+  /** url, the header values and body are Go text/template templates. */
+  url?: string;
+  headers?: Record<string, string>;
+  body?: string;
+}
+
+export interface CreateSlugRequest {
+  slug?: string;
+}
+
+export interface CreateUploadSessionRequest {
+  size_bytes?: number;
+  content_type?: string;
+  quality?: string;
+}
+
+export interface CreateUserRequest {
+  password: string;
+  email: string;
+}
+
+export interface CreateVideoRequest {
+  title: string;
+  description?: string;
+  user_id?: string;
+  /**
+   * metadata holds the integrator's own key/value pairs, like a course ID or a
+   * SKU.
+   */
+  metadata?: Record<string, string>;
+}
+
+export interface DeletionPlan {
+  video_id: string;
+  /** rows are how many database rows would be deleted, by table. */
+  rows: Record<string, number>;
+  /** keys are the bucket objects that would be deleted. */
+  keys: string[];
+}
+
+export interface DiagnosticsSnapshot {
+  version: string;
+  uptime_seconds: number;
+  goroutines: number;
+  open_files: number | null;
+  temp_files: number;
+  temp_files_bytes: number;
+  heap_alloc_bytes: number;
+  heap_sys_bytes: number;
+  sys_bytes: number;
+  num_gc: number;
+}
+
+export interface DisputeClaimRequest {
+  message?: string;
+}
+
+export interface Download {
+  url: string;
+  filename: string;
+  expires_at: string;
+}
+
+export interface EmbedToken {
+  token: string;
+  created_at: string;
+  video_id: string;
+  user_id: string;
+  /** allowed_domains match themselves and their subdomains. */
+  allowed_domains: string[];
+  embed_url: string;
+}
+
+export interface ErrorResponse {
+  /** The error, in the language of the request's Accept-Language. */
+  error: string;
+  /** Identifies the error independently of the language. */
+  code: string;
+  /** The errors of individual fields of a rejected request, by field name. */
+  fields?: Record<string, string>;
+}
+
+export interface FeatureFlag {
+  name: string;
+  updated_at: string;
+  enabled: boolean;
+  rollout_percent: number;
+  user_ids: string[];
+}
+
+export interface GetBillingPlanResponse {
+  plan: Plan;
+  storage_quota_bytes: number;
+  storage_used_bytes: number;
+  max_duration_seconds: number;
+  max_quality: string;
+}
+
+export interface GetVideoMetaResponse {
+  id: string;
+  title: string;
+  updated_at: string;
+  status: VideoStatus;
+  error?: string;
+  duration_ms: number;
+  size_bytes: number;
+  has_thumbnail: boolean;
+  artifacts: ({
+    kind: ArtifactKind;
+    created_at: string;
+    size_bytes: number;
+    codec: string;
+    width: number;
+    height: number;
+    bitrate: number;
+    duration_ms: number;
+  })[];
+  /** thumbnail_pending is set while a thumbnail is being generated. */
+  thumbnail_pending: boolean;
+}
+
+export interface HTTPAction {
+  id: string;
+  created_at: string;
+  name: string;
+  events: string[];
+  method: string;
+  /** url, the header values and body are Go text/template templates. */
+  url: string;
+  headers: Record<string, string>;
+  body: string;
+}
+
+export interface LifecycleConfig {
+  abort_multipart_days: number;
+  trash_days: number;
+  upload_days: number;
+  source_transition_days: number;
+  source_storage_class: string;
+}
+
+export interface LifecycleResponse {
+  config: LifecycleConfig;
+  rules: LifecycleRuleView[];
+  /** in_sync is false when the bucket's rules differ from the config's. */
+  in_sync: boolean;
+  /**
+   * dry_run is set when rules are what applying would leave rather than what
+   * the bucket has.
+   */
+  dry_run?: boolean;
+}
+
+export interface LifecycleRuleView {
+  id: string;
+  enabled: boolean;
+  prefix?: string;
+  tag?: string;
+  abort_multipart_days?: number;
+  expire_days?: number;
+  transition_days?: number;
+  storage_class?: string;
+  /** other is set for rules using features the view leaves out. */
+  other?: boolean;
+}
+
+export interface LoginRequest {
+  password: string;
+  email: string;
+}
+
+export interface LoginResponse {
+  id: string;
+  created_at: string;
+  updated_at: string;
+  email_verified_at: string | null;
+  plan: string;
+  email: string;
+  token: string;
+  refresh_token: string;
+}
+
+export interface Maintenance {
+  enabled_at: string;
+  enabled_by: string;
+  /**
+   * reason tells other admins what's going on. Users only see a generic
+   * message.
+   */
+  reason: string;
+  retry_after_seconds: number;
+}
+
+export interface NotificationChannel {
+  id: string;
+  created_at: string;
+  /** kind is one of "slack", "discord" or "email". */
+  kind: string;
+  /** target is the webhook URL, or the address for email channels. */
+  target: string;
+  events: string[];
+}
+
+export type NotificationEvent = "abuse_detected" | "moderation_report" | "processing_failed" | "quota_breach" | "video_created" | "video_deleted" | "video_ready";
+
+export interface PhasePercentiles {
+  p50: number;
+  p95: number;
+}
+
+export type Plan = "free" | "pro";
+
+export interface PlanRateLimit {
+  plan: string;
+  updated_at: string;
+  max_requests: number;
+  max_distinct: number;
+  burst: number;
+}
+
+export interface PreflightCheck {
+  name: string;
+  ok: boolean;
+  detail: string;
+  /** fix says what to do about a failed check. */
+  fix?: string;
+}
+
+export interface PreflightReport {
+  checks: PreflightCheck[];
+  checked_at: string;
+}
+
+export interface PresignArtifactsRequest {
+  items?: PresignItem[];
+}
+
+export interface PresignArtifactsResponse {
+  results: PresignResult[];
+  /** expires_at is when the URLs stop working, with PRESIGN_TTL set. */
+  expires_at?: string | null;
+}
+
+export interface PresignItem {
+  video_id?: string;
+  artifact?: ArtifactKind;
+}
+
+export interface PresignResult {
+  video_id: string;
+  artifact: ArtifactKind;
+  status: number;
+  /**
+   * urls has one URL per artifact of the kind the video has, none for one it
+   * doesn't have yet, and is null for items that failed. error and code are set
+   * for those.
+   */
+  urls: ArtifactLink[];
+  error?: string;
+  code?: string;
+}
+
+export interface PresignUploadRequest {
+  size_bytes?: number;
+  content_type?: string;
+}
+
+export interface PresignedUpload {
+  method: string;
+  url: string;
+  /** headers are signed, so they have to be sent exactly as they are. */
+  headers: Record<string, string>;
+  key: string;
+  expires_at: string;
+}
+
+export interface ProcessingEstimate {
+  /** pipeline is "ffmpeg" or the transcoder's provider. */
+  pipeline: string;
+  estimated_seconds: number;
+  /**
+   * samples is how many past uploads or jobs the estimate is based on, 0 when
+   * it's a default guess.
+   */
+  samples: number;
+  /**
+   * queued is set while a processing window holds uploads back, which the
+   * estimate doesn't include.
+   */
+  queued: boolean;
+}
+
+export interface ProcessingReportGroup {
+  pipeline: string;
+  resolution: string;
+  size: string;
+  jobs: number;
+  probe_ms: PhasePercentiles;
+  encode_ms: PhasePercentiles;
+  upload_ms: PhasePercentiles;
+  total_ms: PhasePercentiles;
+}
+
+export interface ProcessingWindow {
+  id: string;
+  created_at: string;
+  created_by: string;
+  reason: string;
+  /**
+   * daily_start and daily_end are times of day like "18:00" in timezone, for a
+   * window repeating every day. daily_end before daily_start makes the window
+   * span midnight.
+   */
+  daily_start?: string;
+  daily_end?: string;
+  timezone?: string;
+  /** starts_at and ends_at are set instead for a one-off freeze. */
+  starts_at?: string | null;
+  ends_at?: string | null;
+}
+
+export interface QueuedUpload {
+  video_id: string;
+  queued_at: string;
+  user_id: string;
+  media_type: string;
+  size_bytes: number;
+  quality: string;
+  /** attempts counts the times processing failed and will be retried. */
+  attempts: number;
+}
+
+export interface RateLimitsView {
+  max_requests: number;
+  max_distinct: number;
+  burst: number;
+}
+
+export interface ReconciliationFinding {
+  kind: ReconciliationFindingKind;
+  key: string;
+  /** artifact_id and video_id are null for orphaned objects. */
+  artifact_id?: number | null;
+  video_id?: string | null;
+  /** object_size is null for missing objects. */
+  object_size?: number | null;
+  recorded_size?: number | null;
+}
+
+export type ReconciliationFindingKind = "missing_object" | "orphaned_object" | "size_mismatch";
+
+export interface ReconciliationReport {
+  id: string;
+  created_at: string;
+  bucket: string;
+  objects_scanned: number;
+  artifacts_checked: number;
+  orphaned_objects: number;
+  missing_objects: number;
+  size_mismatches: number;
+  findings: ReconciliationFinding[];
+}
+
+export interface RefreshResponse {
+  token: string;
+}
+
+export interface Rendition {
+  id: number;
+  created_at: string;
+  video_id: string;
+  url: string;
+  width: number;
+  height: number;
+  duration_ms: number;
+  codec: string;
+  bitrate: number;
+  size_bytes: number;
+}
+
+export interface ReplayCMSSyncRequest {
+  since?: string | null;
+  backfill?: boolean;
+}
+
+export interface ReplayCMSSyncResponse {
+  queued: number;
+}
+
+export interface RequestPasswordResetRequest {
+  email: string;
+}
+
+export interface Session {
+  id: string;
+  created_at: string;
+  last_used_at: string | null;
+  expires_at: string;
+  user_agent: string;
+  ip_address: string;
+}
+
+export interface SetVideoDownloadsRequest {
+  enabled?: boolean;
+}
+
+export interface SetVideoExpiryRequest {
+  expires_at?: string | null;
+  purge?: boolean;
+}
+
+export interface SetVideoPasswordRequest {
+  password: string;
+}
+
+export interface Slug {
+  slug: string;
+  created_at: string;
+  user_id: string;
+  target_type: SlugTargetType;
+  target_id: string;
+  hits: number;
+  short_url: string;
+}
+
+export type SlugTargetType = "video";
+
+export interface StorageClassUsage {
+  storage_class: string;
+  objects: number;
+  bytes: number;
+  monthly_cost_usd: number;
+}
+
+export interface StorageUsageReport {
+  users_checked: number;
+  objects_checked: number;
+  fixed: boolean;
+  /** users are the users whose recorded usage was off. */
+  users: UserStorageDrift[];
+}
+
+export interface Takedown {
+  video_id: string;
+  created_at: string;
+  kind: TakedownKind;
+  reason: string;
+  created_by: string;
+  /**
+   * The appeal fields are empty until the owner appeals. Appeals that are
+   * granted lift the takedown, so only pending and upheld ones are stored.
+   */
+  appeal_message?: string;
+  appealed_at?: string | null;
+  appeal_status?: AppealStatus;
+}
+
+export type TakedownKind = "blocked" | "removed";
+
+export interface TranscodeStats {
+  provider: string;
+  preset: string;
+  status: string;
+  jobs: number;
+  duration_ms: number;
+  processing_ms: number;
+  estimated_cost_usd: number;
+}
+
+export interface UploadCredentials {
+  bucket: string;
+  region: string;
+  key: string;
+  access_key_id: string;
+  secret_access_key: string;
+  session_token: string;
+  expiration: string;
+}
+
+export interface UploadHandshake {
+  /**
+   * linked means the user already uploaded this file and the video now has it,
+   * so the upload can be skipped.
+   */
+  linked: boolean;
+  video?: Video | null;
+}
+
+export interface UploadHandshakeRequest {
+  sha256: string;
+}
+
+export interface UploadSession {
+  token: string;
+  created_at: string;
+  expires_at: string;
+  user_id: string;
+  video_id: string;
+  size_bytes: number;
+  part_size: number;
+  content_type: string;
+  quality: string;
+  /** parts are the parts received so far, by number. */
+  parts: UploadSessionPart[];
+  part_count: number;
+  received_bytes: number;
+  ranges: ByteRange[];
+  missing_parts: number[];
+}
+
+export interface UploadSessionPart {
+  number: number;
+  size_bytes: number;
+  etag: string;
+  uploaded_at: string;
+}
+
+export interface Usage {
+  user_id: string;
+  month: string;
+  updated_at: string | null;
+  /**
+   * storage_bytes_current isn't stored per month, it's filled in from the
+   * videos table when usage is read.
+   */
+  storage_bytes_current: number;
+  storage_bytes_peak: number;
+  /**
+   * egress_bytes_estimated assumes every issued video URL is downloaded once in
+   * full. egress_bytes_measured comes from delivery logs.
+   */
+  egress_bytes_estimated: number;
+  egress_bytes_measured: number;
+  url_issuances: number;
+  delivery_requests: number;
+}
+
+export interface User {
+  id: string;
+  created_at: string;
+  updated_at: string;
+  email_verified_at: string | null;
+  plan: string;
+  email: string;
+}
+
+export interface UserStorageDrift {
+  user_id: string;
+  recorded_bytes: number;
+  actual_bytes: number;
+  /** findings are the artifacts whose object is gone or has another size. */
+  findings: ReconciliationFinding[];
+}
+
+export interface Video {
+  id: string;
+  created_at: string;
+  updated_at: string;
+  /** published_at is set the first time the video gets a playable URL. */
+  published_at: string | null;
+  thumbnail_url: string | null;
+  video_url: string | null;
+  size_bytes: number;
+  /**
+   * password_protected videos only hand out URLs to their owner and to viewers
+   * who know the password.
+   */
+  password_protected: boolean;
+  /**
+   * expires_at is when the video stops being playable by anyone but its owner.
+   * unpublished_at is set once the expiry job has handled it, and
+   * purge_on_expiry videos are deleted altogether at that point.
+   */
+  expires_at: string | null;
+  purge_on_expiry: boolean;
+  unpublished_at: string | null;
+  /**
+   * downloads_enabled lets viewers get a download link, which only the owner
+   * can otherwise.
+   */
+  downloads_enabled: boolean;
+  /** tags are for the owner's own organizing. */
+  tags: string[];
+  title: string;
+  description: string;
+  user_id: string;
+  /**
+   * metadata holds the integrator's own key/value pairs, like a course id or a
+   * SKU.
+   */
+  metadata: Record<string, string>;
+}
+
+export interface VideoDelivery {
+  video_id: string;
+  day: string;
+  bytes: number;
+  requests: number;
+}
+
+export interface VideoExport {
+  id: string;
+  created_at: string;
+  updated_at: string;
+  /** published_at is set the first time the video gets a playable URL. */
+  published_at: string | null;
+  thumbnail_url: string | null;
+  video_url: string | null;
+  size_bytes: number;
+  /**
+   * password_protected videos only hand out URLs to their owner and to viewers
+   * who know the password.
+   */
+  password_protected: boolean;
+  /**
+   * expires_at is when the video stops being playable by anyone but its owner.
+   * unpublished_at is set once the expiry job has handled it, and
+   * purge_on_expiry videos are deleted altogether at that point.
+   */
+  expires_at: string | null;
+  purge_on_expiry: boolean;
+  unpublished_at: string | null;
+  /**
+   * downloads_enabled lets viewers get a download link, which only the owner
+   * can otherwise.
+   */
+  downloads_enabled: boolean;
+  /** tags are for the owner's own organizing. */
+  tags: string[];
+  title: string;
+  description: string;
+  user_id: string;
+  /**
+   * metadata holds the integrator's own key/value pairs, like a course id or a
+   * SKU.
+   */
+  metadata: Record<string, string>;
+  duration_ms: number;
+  /**
+   * views and delivered_bytes come from ingested access logs, so they lag
+   * behind and stay 0 without ACCESS_LOG_BUCKET.
+   */
+  views: number;
+  delivered_bytes: number;
+}
+
+export interface VideoImport {
+  id: string;
+  created_at: string;
+  updated_at: string;
+  user_id: string;
+  source: string;
+  status: VideoImportStatus;
+  finished_at: string | null;
+  total: number;
+  imported: number;
+  failed: number;
+  /** items are only set when a single import is fetched. */
+  items?: VideoImportItem[];
+}
+
+export interface VideoImportItem {
+  /** source_id is the video's ID on the platform it's imported from. */
+  source_id: string;
+  title: string;
+  status: VideoImportItemStatus;
+  video_id: string | null;
+  error?: string;
+}
+
+export type VideoImportItemStatus = "failed" | "imported" | "pending";
+
+export type VideoImportStatus = "finished" | "interrupted" | "running";
+
+/**
+ * A JSON merge patch of a video: fields left out are kept, and null clears the
+ * ones that can be empty.
+ */
+export interface VideoPatch {
+  title?: string;
+  description?: string | null;
+  /**
+   * Can only be null, which removes the thumbnail. Thumbnails are uploaded with
+   * POST /thumbnail_upload/{videoID}.
+   */
+  thumbnail_url?: string | null;
+  tags?: string[] | null;
+  /** Merged key by key, with null removing a key. */
+  metadata?: Record<string, string | null> | null;
+  downloads_enabled?: boolean;
+}
+
+export type VideoStatus = "draft" | "queued" | "processing" | "failed" | "ready";
+
+export interface VideoURLs {
+  video: string | null;
+  thumbnail: string | null;
+  preview: string | null;
+  captions: ArtifactLink[];
+  renditions: Rendition[];
+  sprites: ArtifactLink[];
+  /** audio_descriptions are also in the video as an audio track. */
+  audio_descriptions: ArtifactLink[];
+  /** audio_tracks are dubs, also in the video after its own audio. */
+  audio_tracks: ArtifactLink[];
+  expires_at?: string | null;
+}
+
+export interface VideoV2 {
+  id: string;
+  created_at: string;
+  updated_at: string;
+  published_at: string | null;
+  title: string;
+  description: string;
+  size_bytes: number;
+  user_id: string;
+  status: VideoStatus;
+  urls: VideoURLs | null;
+  /** password_protected videos need the X-Video-Password header. */
+  password_protected: boolean;
+  expires_at: string | null;
+  purge_on_expiry: boolean;
+  unpublished_at: string | null;
+  downloads_enabled: boolean;
+  tags: string[];
+  metadata: Record<string, string>;
+}
+
+export interface ListVideosOptions extends RequestOptions {
+  /** How many videos to return, 50 by default. */
+  limit?: number;
+  /** The X-Next-Cursor of the previous page. */
+  cursor?: string;
+  /**
+   * Comma-separated fields to return, e.g. id,title. The rest are left out of
+   * each video.
+   */
+  fields?: string;
+  /**
+   * The ETag of an earlier response. The response is 304 if nothing changed.
+   */
+  ifNoneMatch?: string;
+  /**
+   * Only videos whose metadata has the key after the prefix set to the value.
+   * The key has to be indexed for filtering.
+   */
+  metadata?: Record<string, string>;
+}
+
+export interface UploadThumbnailOptions extends RequestOptions {
+  /**
+   * Fails the request with 412 if the video changed since then, e.g. the
+   * Last-Modified of an earlier response.
+   */
+  ifUnmodifiedSince?: string;
+}
+
+export interface UploadThumbnailForm {
+  /** A JPEG, PNG or WebP image. */
+  thumbnail: Blob;
+}
+
+export interface UploadVideoOptions extends RequestOptions {
+  /**
+   * Fails the request with 412 if the video changed since then, e.g. the
+   * Last-Modified of an earlier response.
+   */
+  ifUnmodifiedSince?: string;
+  /**
+   * Identical uploads with the same key are processed once, and share the
+   * result.
+   */
+  idempotencyKey?: string;
+}
+
+export interface UploadVideoForm {
+  /** The transcode preset: sd, hd or fhd. It has to come before the file. */
+  quality?: string;
+  /** An MP4 or another supported format. */
+  video: Blob;
+}
+
+export interface CompleteUploadOptions extends RequestOptions {
+  /**
+   * Identical uploads with the same key are processed once, and share the
+   * result.
+   */
+  idempotencyKey?: string;
+}
+
+export interface UploadPartOptions extends RequestOptions {
+  /** The base64 MD5 of the part, checked before it's stored. */
+  contentMD5?: string;
+}
+
+export interface CompleteUploadSessionOptions extends RequestOptions {
+  /**
+   * Identical uploads with the same key are processed once, and share the
+   * result.
+   */
+  idempotencyKey?: string;
+}
+
+export interface GetProcessingEstimateOptions extends RequestOptions {
+  /** The file's size. */
+  sizeBytes: number;
+  /** The video's duration. */
+  durationMs: number;
+  /** The transcode preset, the server's default if left out. */
+  quality?: "sd" | "hd" | "fhd";
+}
+
+export interface TusCreateOptions extends RequestOptions {
+  /** The file's size. */
+  uploadLength: number;
+  /**
+   * Comma-separated key and base64 value pairs. filetype is the file's media
+   * type, and quality the transcode preset.
+   */
+  uploadMetadata?: string;
+}
+
+export interface TusPatchOptions extends RequestOptions {
+  /** How many bytes of the file the server already has. */
+  uploadOffset: number;
+  /**
+   * Identical uploads with the same key are processed once, and share the
+   * result.
+   */
+  idempotencyKey?: string;
+}
+
+export interface UploadAudioDescriptionForm {
+  /** An audio or video file; its first audio stream is used. */
+  audio: Blob;
+}
+
+export interface UploadAudioTrackForm {
+  /** An audio or video file; its first audio stream is used. */
+  audio: Blob;
+}
+
+export interface GetVideoOptions extends RequestOptions {
+  /** The video's password, if it has one. */
+  videoPassword?: string;
+  /**
+   * The ETag of an earlier response. The response is 304 if nothing changed.
+   */
+  ifNoneMatch?: string;
+}
+
+export interface UpdateVideoOptions extends RequestOptions {
+  /**
+   * Fails the request with 412 if the video changed since then, e.g. the
+   * Last-Modified of an earlier response.
+   */
+  ifUnmodifiedSince?: string;
+}
+
+export interface DeleteVideoOptions extends RequestOptions {
+  /** Report what would change instead of making the changes. */
+  dryRun?: boolean;
+  /**
+   * Fails the request with 412 if the video changed since then, e.g. the
+   * Last-Modified of an earlier response.
+   */
+  ifUnmodifiedSince?: string;
+}
+
+export interface GetVideoMetaOptions extends RequestOptions {
+  /**
+   * The ETag of an earlier response. The response is 304 if nothing changed.
+   */
+  ifNoneMatch?: string;
+}
+
+export interface ListRenditionsOptions extends RequestOptions {
+  /** The video's password, if it has one. */
+  videoPassword?: string;
+}
+
+export interface GetVideoDownloadOptions extends RequestOptions {
+  /** The video's password, if it has one. */
+  videoPassword?: string;
+}
+
+export interface BatchVideosOptions extends RequestOptions {
+  /** Report what would change instead of making the changes. */
+  dryRun?: boolean;
+}
+
+export interface GetShareQROptions extends RequestOptions {
+  /** The image's width in pixels. */
+  size?: number;
+  /**
+   * The error correction level. Higher levels survive a logo printed over the
+   * code at the cost of denser codes.
+   */
+  ec?: "L" | "M" | "Q" | "H";
+  /**
+   * The short link to encode, the video's oldest one by default. A video
+   * without any gets one.
+   */
+  slug?: string;
+}
+
+export interface ListCMSSyncEventsOptions extends RequestOptions {
+  /** How many events to return. */
+  limit?: number;
+}
+
+export interface GetUsageOptions extends RequestOptions {
+  /** The month as YYYY-MM, the current one by default. */
+  month?: string;
+}
+
+export interface ExportVideosOptions extends RequestOptions {
+  /** The export's format. */
+  format?: "csv" | "json";
+}
+
+export interface ImportYouTubeForm {
+  /** The export's video metadata CSV or JSON. */
+  metadata: Blob;
+  /** The export's video files. */
+  files?: Blob[];
+}
+
+export interface AdminApplyLifecycleOptions extends RequestOptions {
+  /** Report what would change instead of making the changes. */
+  dryRun?: boolean;
+}
+
+export interface AdminListUsageOptions extends RequestOptions {
+  /** The month as YYYY-MM, the current one by default. */
+  month?: string;
+}
+
+export interface AdminGetProcessingMetricsOptions extends RequestOptions {
+  /** How many days back to report on. */
+  days?: number;
+  /** Narrows the report to "ffmpeg" or a transcoder provider. */
+  pipeline?: string;
+}
+
+export interface AdminListTakedownsOptions extends RequestOptions {
+  /** Only takedowns with an appeal in this state. */
+  appealStatus?: "pending" | "upheld";
+}
+
+export interface AdminListClaimsOptions extends RequestOptions {
+  /** Only claims in this state. */
+  status?: ClaimStatus;
+}
+
+export interface ClientOptions {
+  /** The server's URL, e.g. https://tubely.example.com. Requests go to the page's own origin by default. */
+  baseURL?: string;
+  /** An access token saved from an earlier login. */
+  token?: string;
+  /** A refresh token saved from an earlier login. */
+  refreshToken?: string;
+  /** The function requests are made with, globalThis.fetch by default. */
+  fetch?: typeof fetch;
+  /** Called when the tokens change, e.g. to save them. */
+  onTokens?: (tokens: Tokens) => void;
+}
+
+export interface Tokens {
+  token: string;
+  refreshToken: string;
+}
+
+export interface RequestOptions {
+  /** Extra headers to send. */
+  headers?: Record<string, string>;
+  signal?: AbortSignal;
+}
+
+/** The data of a response along with its headers, for operations whose headers carry something. */
+export interface Result<T> {
+  data: T;
+  headers: Headers;
+}
+
+/** An error response from the server. */
+export class APIError extends Error {
+  /** Identifies the error independently of the language message is in. */
+  readonly code: string;
+  /** The errors of individual fields of a rejected request, by field name. */
+  readonly fields: Record<string, string>;
+
+  constructor(
+    readonly status: number,
+    body: Partial<ErrorResponse> = {},
+  ) {
+    super(body.error || `tubely: ${status}`);
+    this.name = "APIError";
+    this.code = body.code ?? "";
+    this.fields = body.fields ?? {};
+  }
+}
+
+type Auth = "bearer" | "optional" | "public" | "refresh";
+
+interface Call {
+  method: string;
+  path: string;
+  auth: Auth;
+  query?: Record<string, string | number | boolean | undefined>;
+  headers?: Record<string, string | number | undefined>;
+  json?: unknown;
+  body?: BodyInit;
+  contentType?: string;
+  options: RequestOptions;
+}
+
+function encodeQuery(query: Call["query"]): string {
+  const params = new URLSearchParams();
+  for (const [name, value] of Object.entries(query ?? {})) {
+    if (value !== undefined) {
+      params.append(name, String(value));
+    }
+  }
+  const encoded = params.toString();
+  return encoded ? `?${encoded}` : "";
+}
+
+function prefixed(prefix: string, values: Record<string, string> | undefined): Record<string, string> {
+  const out: Record<string, string> = {};
+  for (const [key, value] of Object.entries(values ?? {})) {
+    out[prefix + key] = value;
+  }
+  return out;
+}
+
+function formData(fields: Record<string, string | Blob | Blob[] | undefined>): FormData {
+  const form = new FormData();
+  for (const [name, value] of Object.entries(fields)) {
+    if (value === undefined) {
+      continue;
+    }
+    for (const item of Array.isArray(value) ? value : [value]) {
+      form.append(name, item);
+    }
+  }
+  return form;
+}
+
+async function decode<T>(resp: Response): Promise<T> {
+  const text = await resp.text();
+  return (text ? JSON.parse(text) : undefined) as T;
+}
+
+export class TubelyClient {
+  private readonly baseURL: string;
+  private readonly fetchFn: typeof fetch;
+  private readonly onTokens?: (tokens: Tokens) => void;
+  private token: string;
+  private refreshToken: string;
+  private refreshing?: Promise<void>;
+
+  constructor(options: ClientOptions = {}) {
+    this.baseURL = (options.baseURL ?? "").replace(/\/+$/, "") + BASE_PATH;
+    this.fetchFn = options.fetch ?? ((input, init) => globalThis.fetch(input, init));
+    this.onTokens = options.onTokens;
+    this.token = options.token ?? "";
+    this.refreshToken = options.refreshToken ?? "";
+  }
+
+  /** The client's current tokens, which change when the access token is refreshed. */
+  get tokens(): Tokens {
+    return { token: this.token, refreshToken: this.refreshToken };
+  }
+
+  /** Replaces the client's tokens. An empty refresh token keeps the current one. */
+  setTokens(token: string, refreshToken = ""): void {
+    this.token = token;
+    if (refreshToken) {
+      this.refreshToken = refreshToken;
+    }
+    this.onTokens?.(this.tokens);
+  }
+
+  /** Forgets both tokens without revoking them. */
+  clearTokens(): void {
+    this.token = "";
+    this.refreshToken = "";
+    this.onTokens?.(this.tokens);
+  }
+
+  /**
+   * Makes a call. One the server rejects because the access token expired
+   * is retried once with a refreshed token, unless its body is a stream
+   * that can't be sent again.
+   */
+  private async request(call: Call): Promise<Response> {
+    let resp = await this.send(call);
+    const retryable = !(typeof ReadableStream !== "undefined" && call.body instanceof ReadableStream);
+    if (resp.status === 401 && call.auth === "bearer" && retryable && this.refreshToken) {
+      await this.refreshOnce();
+      resp = await this.send(call);
+    }
+    if (!resp.ok) {
+      let body: Partial<ErrorResponse> = {};
+      // Errors from proxies in front of the server aren't JSON, in which
+      // case only the status is known.
+      try {
+        body = await resp.json();
+      } catch {
+        // Keep the status alone.
+      }
+      throw new APIError(resp.status, body);
+    }
+    return resp;
+  }
+
+  private send(call: Call): Promise<Response> {
+    const headers: Record<string, string> = {};
+    for (const [name, value] of Object.entries(call.headers ?? {})) {
+      if (value !== undefined) {
+        headers[name] = String(value);
+      }
+    }
+    let body = call.body;
+    if (call.json !== undefined) {
+      body = JSON.stringify(call.json);
+      headers["Content-Type"] = call.contentType ?? "application/json";
+    } else if (call.contentType) {
+      headers["Content-Type"] = call.contentType;
+    }
+    const token = call.auth === "refresh" ? this.refreshToken : call.auth === "public" ? "" : this.token;
+    if (token) {
+      headers["Authorization"] = `Bearer ${token}`;
+    }
+    Object.assign(headers, call.options.headers);
+    return this.fetchFn(this.baseURL + call.path + encodeQuery(call.query), {
+      method: call.method,
+      headers,
+      body,
+      signal: call.options.signal,
+    });
+  }
+
+  /** Refreshes the access token, sharing one refresh between concurrent calls. */
+  private refreshOnce(): Promise<void> {
+    if (!this.refreshing) {
+      this.refreshing = this.refresh()
+        .then(() => undefined)
+        .finally(() => {
+          this.refreshing = undefined;
+        });
+    }
+    return this.refreshing;
+  }
+
+  /**
+   * Get the server's version.
+   *
+   * Reports the version, commit and build time of the server.
+   */
+  async getBuildInfo(options: RequestOptions = {}): Promise<BuildInfo> {
+    const resp = await this.request({
+      method: "GET",
+      path: "/build_info",
+      auth: "public",
+      options,
+    });
+    return decode<BuildInfo>(resp);
+  }
+
+  /**
+   * Log in.
+   *
+   * Returns the user with an access token and a refresh token. Repeated
+   * failures for an email or from an address are delayed and eventually locked
+   * out.
+   */
+  async login(body: LoginRequest, options: RequestOptions = {}): Promise<LoginResponse> {
+    const resp = await this.request({
+      method: "POST",
+      path: "/login",
+      auth: "public",
+      json: body,
+      options,
+    });
+    const data = await decode<LoginResponse>(resp);
+    this.setTokens(data.token, data.refresh_token);
+    return data;
+  }
+
+  /**
+   * Refresh the access token.
+   *
+   * Returns a new access token for the refresh token in the Authorization
+   * header.
+   */
+  async refresh(options: RequestOptions = {}): Promise<RefreshResponse> {
+    const resp = await this.request({
+      method: "POST",
+      path: "/refresh",
+      auth: "refresh",
+      options,
+    });
+    const data = await decode<RefreshResponse>(resp);
+    this.setTokens(data.token);
+    return data;
+  }
+
+  /**
+   * Revoke a refresh token.
+   *
+   * Logs out the session of the refresh token in the Authorization header.
+   */
+  async revoke(options: RequestOptions = {}): Promise<void> {
+    await this.request({
+      method: "POST",
+      path: "/revoke",
+      auth: "refresh",
+      options,
+    });
+    this.clearTokens();
+  }
+
+  /**
+   * Sign up.
+   *
+   * Creates a user. It doesn't log them in.
+   */
+  async createUser(body: CreateUserRequest, options: RequestOptions = {}): Promise<User> {
+    const resp = await this.request({
+      method: "POST",
+      path: "/users",
+      auth: "public",
+      json: body,
+      options,
+    });
+    return decode<User>(resp);
+  }
+
+  /** List the caller's sessions. */
+  async listSessions(options: RequestOptions = {}): Promise<Session[]> {
+    const resp = await this.request({
+      method: "GET",
+      path: "/users/me/sessions",
+      auth: "bearer",
+      options,
+    });
+    return decode<Session[]>(resp);
+  }
+
+  /**
+   * Get the caller's features.
+   *
+   * Tells the frontend which features to show.
+   */
+  async getFeatures(options: RequestOptions = {}): Promise<Record<string, boolean>> {
+    const resp = await this.request({
+      method: "GET",
+      path: "/users/me/features",
+      auth: "bearer",
+      options,
+    });
+    return decode<Record<string, boolean>>(resp);
+  }
+
+  /** Log out a session. */
+  async revokeSession(sessionID: string, options: RequestOptions = {}): Promise<void> {
+    await this.request({
+      method: "DELETE",
+      path: `/users/me/sessions/${encodeURIComponent(sessionID)}`,
+      auth: "bearer",
+      options,
+    });
+  }
+
+  /**
+   * Request a password reset.
+   *
+   * Emails a reset link if the address belongs to a user. The response is the
+   * same either way.
+   */
+  async requestPasswordReset(body: RequestPasswordResetRequest, options: RequestOptions = {}): Promise<void> {
+    await this.request({
+      method: "POST",
+      path: "/password_reset",
+      auth: "public",
+      json: body,
+      options,
+    });
+  }
+
+  /**
+   * Reset a password.
+   *
+   * Sets a new password with the token from a reset email, logging out every
+   * session.
+   */
+  async confirmPasswordReset(body: ConfirmPasswordResetRequest, options: RequestOptions = {}): Promise<void> {
+    await this.request({
+      method: "POST",
+      path: "/password_reset/confirm",
+      auth: "public",
+      json: body,
+      options,
+    });
+  }
+
+  /** Resend the verification email. */
+  async sendEmailVerification(options: RequestOptions = {}): Promise<void> {
+    await this.request({
+      method: "POST",
+      path: "/email_verification",
+      auth: "bearer",
+      options,
+    });
+  }
+
+  /** Verify an email address. */
+  async confirmEmailVerification(body: ConfirmEmailVerificationRequest, options: RequestOptions = {}): Promise<void> {
+    await this.request({
+      method: "POST",
+      path: "/email_verification/confirm",
+      auth: "public",
+      json: body,
+      options,
+    });
+  }
+
+  /**
+   * Create a video.
+   *
+   * Creates a draft video, which gets its file from one of the upload
+   * endpoints.
+   */
+  async createVideo(body: CreateVideoRequest, options: RequestOptions = {}): Promise<Video> {
+    const resp = await this.request({
+      method: "POST",
+      path: "/videos",
+      auth: "bearer",
+      json: body,
+      options,
+    });
+    return decode<Video>(resp);
+  }
+
+  /**
+   * List the caller's videos.
+   *
+   * Lists the caller's videos, newest first. The whole list is returned unless
+   * limit or cursor is given; X-Next-Cursor then has the cursor of the next
+   * page, and is absent on the last. Videos can be filtered by indexed metadata
+   * keys with metadata.<key>=<value>.
+   */
+  async listVideos(options: ListVideosOptions = {}): Promise<Result<VideoV2[]>> {
+    const resp = await this.request({
+      method: "GET",
+      path: "/videos",
+      auth: "bearer",
+      query: { limit: options.limit, cursor: options.cursor, fields: options.fields, ...prefixed("metadata.", options.metadata) },
+      headers: { "If-None-Match": options.ifNoneMatch },
+      options,
+    });
+    const data = await decode<VideoV2[]>(resp);
+    return { data, headers: resp.headers };
+  }
+
+  /** Upload a thumbnail. */
+  async uploadThumbnail(videoID: string, form: UploadThumbnailForm, options: UploadThumbnailOptions = {}): Promise<Video> {
+    const resp = await this.request({
+      method: "POST",
+      path: `/thumbnail_upload/${encodeURIComponent(videoID)}`,
+      auth: "bearer",
+      body: formData({ thumbnail: form.thumbnail }),
+      headers: { "If-Unmodified-Since": options.ifUnmodifiedSince },
+      options,
+    });
+    return decode<Video>(resp);
+  }
+
+  /**
+   * Upload a video.
+   *
+   * Uploads the video's file in a single request. The response is 202 if
+   * processing was queued for a processing window.
+   */
+  async uploadVideo(videoID: string, form: UploadVideoForm, options: UploadVideoOptions = {}): Promise<Video> {
+    const resp = await this.request({
+      method: "POST",
+      path: `/video_upload/${encodeURIComponent(videoID)}`,
+      auth: "bearer",
+      body: formData({ quality: form.quality, video: form.video }),
+      headers: { "If-Unmodified-Since": options.ifUnmodifiedSince, "Idempotency-Key": options.idempotencyKey },
+      options,
+    });
+    return decode<Video>(resp);
+  }
+
+  /**
+   * Skip uploading a known file.
+   *
+   * Lets clients skip uploading a file they uploaded before. The client sends
+   * the file's SHA-256 (crypto.subtle.digest in a browser); if one of the
+   * user's playable videos was made from the same file, its objects are copied
+   * to this video within the bucket and the response says so. Otherwise the
+   * client goes on with the regular upload.
+   */
+  async uploadHandshake(videoID: string, body: UploadHandshakeRequest, options: RequestOptions = {}): Promise<UploadHandshake> {
+    const resp = await this.request({
+      method: "POST",
+      path: `/video_upload/${encodeURIComponent(videoID)}/handshake`,
+      auth: "bearer",
+      json: body,
+      options,
+    });
+    return decode<UploadHandshake>(resp);
+  }
+
+  /**
+   * Get credentials for a direct upload.
+   *
+   * Returns credentials for uploading the video's file to the key in the
+   * response. Once it's there, the client calls POST
+   * /video_upload/{videoID}/complete.
+   */
+  async getUploadCredentials(videoID: string, options: RequestOptions = {}): Promise<UploadCredentials> {
+    const resp = await this.request({
+      method: "POST",
+      path: `/video_upload/${encodeURIComponent(videoID)}/credentials`,
+      auth: "bearer",
+      options,
+    });
+    return decode<UploadCredentials>(resp);
+  }
+
+  /**
+   * Presign a direct upload.
+   *
+   * Returns a presigned PUT for uploading the video's file to the key in the
+   * response. Its size and type are signed, so only the announced file can be
+   * uploaded with it. Once it's there, the client calls POST
+   * /video_upload/{videoID}/complete. Unlike POST
+   * /video_upload/{videoID}/credentials it needs no role to assume, but the
+   * file goes in a single request.
+   */
+  async presignUpload(videoID: string, body: PresignUploadRequest, options: RequestOptions = {}): Promise<PresignedUpload> {
+    const resp = await this.request({
+      method: "POST",
+      path: `/video_upload/${encodeURIComponent(videoID)}/presign`,
+      auth: "bearer",
+      json: body,
+      options,
+    });
+    return decode<PresignedUpload>(resp);
+  }
+
+  /**
+   * Process a direct upload.
+   *
+   * Processes a file the client uploaded with POST
+   * /video_upload/{videoID}/credentials' credentials or POST
+   * /video_upload/{videoID}/presign's request like any other upload, then
+   * removes it.
+   */
+  async completeUpload(videoID: string, body: CompleteUploadRequest, options: CompleteUploadOptions = {}): Promise<Video> {
+    const resp = await this.request({
+      method: "POST",
+      path: `/video_upload/${encodeURIComponent(videoID)}/complete`,
+      auth: "bearer",
+      json: body,
+      headers: { "Idempotency-Key": options.idempotencyKey },
+      options,
+    });
+    return decode<Video>(resp);
+  }
+
+  /**
+   * Start an upload in parts.
+   *
+   * Starts an upload the client sends in parts with PUT
+   * /upload_sessions/{token}/parts/{partNumber}. The token in the response is
+   * all it needs to keep to resume the upload, e.g. after the app was
+   * restarted.
+   */
+  async createUploadSession(videoID: string, body: CreateUploadSessionRequest, options: RequestOptions = {}): Promise<UploadSession> {
+    const resp = await this.request({
+      method: "POST",
+      path: `/video_upload/${encodeURIComponent(videoID)}/sessions`,
+      auth: "bearer",
+      json: body,
+      options,
+    });
+    return decode<UploadSession>(resp);
+  }
+
+  /**
+   * Get an upload session.
+   *
+   * Reports which parts of the file the server has, so a resuming client only
+   * sends the missing ones.
+   */
+  async getUploadSession(token: string, options: RequestOptions = {}): Promise<UploadSession> {
+    const resp = await this.request({
+      method: "GET",
+      path: `/upload_sessions/${encodeURIComponent(token)}`,
+      auth: "bearer",
+      options,
+    });
+    return decode<UploadSession>(resp);
+  }
+
+  /**
+   * Cancel an upload in parts.
+   *
+   * Cancels an upload and discards its parts.
+   */
+  async deleteUploadSession(token: string, options: RequestOptions = {}): Promise<void> {
+    await this.request({
+      method: "DELETE",
+      path: `/upload_sessions/${encodeURIComponent(token)}`,
+      auth: "bearer",
+      options,
+    });
+  }
+
+  /**
+   * Upload a part.
+   *
+   * Receives one part of the file as the raw request body. Parts can be sent in
+   * any order, and sending a part again replaces it.
+   */
+  async uploadPart(token: string, partNumber: number, body: BodyInit, options: UploadPartOptions = {}): Promise<UploadSession> {
+    const resp = await this.request({
+      method: "PUT",
+      path: `/upload_sessions/${encodeURIComponent(token)}/parts/${encodeURIComponent(partNumber)}`,
+      auth: "bearer",
+      body,
+      contentType: "application/octet-stream",
+      headers: { "Content-MD5": options.contentMD5 },
+      options,
+    });
+    return decode<UploadSession>(resp);
+  }
+
+  /**
+   * Finish an upload in parts.
+   *
+   * Assembles the parts once they're all there and processes the file like any
+   * other upload.
+   */
+  async completeUploadSession(token: string, options: CompleteUploadSessionOptions = {}): Promise<Video> {
+    const resp = await this.request({
+      method: "POST",
+      path: `/upload_sessions/${encodeURIComponent(token)}/complete`,
+      auth: "bearer",
+      headers: { "Idempotency-Key": options.idempotencyKey },
+      options,
+    });
+    return decode<Video>(resp);
+  }
+
+  /**
+   * Estimate processing time.
+   *
+   * Estimates how long processing a file of size_bytes and duration_ms would
+   * take for the user, from the throughput of past uploads, so clients can set
+   * expectations before a big upload. Uploads processed with ffmpeg take time
+   * with their size, transcoder jobs with their duration.
+   */
+  async getProcessingEstimate(options: GetProcessingEstimateOptions): Promise<ProcessingEstimate> {
+    const resp = await this.request({
+      method: "GET",
+      path: "/processing_estimate",
+      auth: "bearer",
+      query: { size_bytes: options.sizeBytes, duration_ms: options.durationMs, quality: options.quality },
+      options,
+    });
+    return decode<ProcessingEstimate>(resp);
+  }
+
+  /**
+   * Get tus capabilities.
+   *
+   * Tells tus clients what the server supports.
+   */
+  async tusOptionsCreate(videoID: string, options: RequestOptions = {}): Promise<Result<void>> {
+    const resp = await this.request({
+      method: "OPTIONS",
+      path: `/video_upload/${encodeURIComponent(videoID)}/tus`,
+      auth: "public",
+      options,
+    });
+    return { data: undefined, headers: resp.headers };
+  }
+
+  /**
+   * Start a tus upload.
+   *
+   * Starts a tus upload of the video's file. The Location of the response is
+   * where the client sends the bytes, with PATCH /tus/{uploadID}, and asks how
+   * far it got, with HEAD /tus/{uploadID}.
+   */
+  async tusCreate(videoID: string, options: TusCreateOptions): Promise<Result<void>> {
+    const resp = await this.request({
+      method: "POST",
+      path: `/video_upload/${encodeURIComponent(videoID)}/tus`,
+      auth: "bearer",
+      headers: { "Tus-Resumable": "1.0.0", "Upload-Length": options.uploadLength, "Upload-Metadata": options.uploadMetadata },
+      options,
+    });
+    return { data: undefined, headers: resp.headers };
+  }
+
+  /**
+   * Get tus capabilities.
+   *
+   * Tells tus clients what the server supports.
+   */
+  async tusOptions(uploadID: string, options: RequestOptions = {}): Promise<Result<void>> {
+    const resp = await this.request({
+      method: "OPTIONS",
+      path: `/tus/${encodeURIComponent(uploadID)}`,
+      auth: "public",
+      options,
+    });
+    return { data: undefined, headers: resp.headers };
+  }
+
+  /**
+   * Get a tus upload's offset.
+   *
+   * Reports how many bytes of the upload the server has, so a resuming client
+   * sends the rest from there.
+   */
+  async tusHead(uploadID: string, options: RequestOptions = {}): Promise<Result<void>> {
+    const resp = await this.request({
+      method: "HEAD",
+      path: `/tus/${encodeURIComponent(uploadID)}`,
+      auth: "bearer",
+      headers: { "Tus-Resumable": "1.0.0" },
+      options,
+    });
+    return { data: undefined, headers: resp.headers };
+  }
+
+  /**
+   * Append to a tus upload.
+   *
+   * Appends the request body to the upload at Upload-Offset, which has to be
+   * where the upload got to. Whatever arrives is kept, even if the connection
+   * drops midway. Once every byte is there the file is processed like a regular
+   * upload, and the response is the video, with 202 if processing was queued;
+   * until then it's 204.
+   */
+  async tusPatch(uploadID: string, body: BodyInit, options: TusPatchOptions): Promise<Result<Video | undefined>> {
+    const resp = await this.request({
+      method: "PATCH",
+      path: `/tus/${encodeURIComponent(uploadID)}`,
+      auth: "bearer",
+      body,
+      contentType: "application/offset+octet-stream",
+      headers: { "Tus-Resumable": "1.0.0", "Upload-Offset": options.uploadOffset, "Idempotency-Key": options.idempotencyKey },
+      options,
+    });
+    const data = await decode<Video | undefined>(resp);
+    return { data, headers: resp.headers };
+  }
+
+  /**
+   * Cancel a tus upload.
+   *
+   * Cancels an upload and discards its bytes.
+   */
+  async tusDelete(uploadID: string, options: RequestOptions = {}): Promise<void> {
+    await this.request({
+      method: "DELETE",
+      path: `/tus/${encodeURIComponent(uploadID)}`,
+      auth: "bearer",
+      headers: { "Tus-Resumable": "1.0.0" },
+      options,
+    });
+  }
+
+  /**
+   * Add an audio description.
+   *
+   * Adds an audio description to the video, narration of what's on screen for
+   * blind and low vision viewers. The file's first audio stream is muxed into
+   * the video as a second audio track and kept as a separate file, for players
+   * that can't switch tracks.
+   */
+  async uploadAudioDescription(videoID: string, form: UploadAudioDescriptionForm, options: RequestOptions = {}): Promise<Video> {
+    const resp = await this.request({
+      method: "PUT",
+      path: `/videos/${encodeURIComponent(videoID)}/audio_description`,
+      auth: "bearer",
+      body: formData({ audio: form.audio }),
+      options,
+    });
+    return decode<Video>(resp);
+  }
+
+  /**
+   * Remove the audio description.
+   *
+   * Removes the description from the video and deletes its file.
+   */
+  async deleteAudioDescription(videoID: string, options: RequestOptions = {}): Promise<void> {
+    await this.request({
+      method: "DELETE",
+      path: `/videos/${encodeURIComponent(videoID)}/audio_description`,
+      auth: "bearer",
+      options,
+    });
+  }
+
+  /**
+   * Add or replace a dub.
+   *
+   * Adds or replaces the video's audio track in the language of the path, a dub
+   * players can switch to. The file's first audio stream is muxed into the
+   * video after its own audio and kept as a separate file, for players that
+   * can't switch tracks.
+   */
+  async uploadAudioTrack(videoID: string, language: string, form: UploadAudioTrackForm, options: RequestOptions = {}): Promise<Video> {
+    const resp = await this.request({
+      method: "PUT",
+      path: `/videos/${encodeURIComponent(videoID)}/audio_tracks/${encodeURIComponent(language)}`,
+      auth: "bearer",
+      body: formData({ audio: form.audio }),
+      options,
+    });
+    return decode<Video>(resp);
+  }
+
+  /**
+   * Remove a dub.
+   *
+   * Removes the audio track in the language of the path from the video and
+   * deletes its file.
+   */
+  async deleteAudioTrack(videoID: string, language: string, options: RequestOptions = {}): Promise<void> {
+    await this.request({
+      method: "DELETE",
+      path: `/videos/${encodeURIComponent(videoID)}/audio_tracks/${encodeURIComponent(language)}`,
+      auth: "bearer",
+      options,
+    });
+  }
+
+  /**
+   * Get a video.
+   *
+   * Returns a published video to anyone who can play it; unpublished videos
+   * only to their owner. Password protected videos need X-Video-Password.
+   */
+  async getVideo(videoID: string, options: GetVideoOptions = {}): Promise<Result<VideoV2>> {
+    const resp = await this.request({
+      method: "GET",
+      path: `/videos/${encodeURIComponent(videoID)}`,
+      auth: "optional",
+      headers: { "X-Video-Password": options.videoPassword, "If-None-Match": options.ifNoneMatch },
+      options,
+    });
+    const data = await decode<VideoV2>(resp);
+    return { data, headers: resp.headers };
+  }
+
+  /**
+   * Update a video.
+   *
+   * Updates the fields of the video that the JSON merge patch in the body has,
+   * leaving the rest as they are. The patch is applied to the video as it's
+   * stored when the update is saved: if the video changes meanwhile it's
+   * applied again, or with If-Unmodified-Since, the request fails with 412.
+   */
+  async updateVideo(videoID: string, body: VideoPatch, options: UpdateVideoOptions = {}): Promise<Video> {
+    const resp = await this.request({
+      method: "PATCH",
+      path: `/videos/${encodeURIComponent(videoID)}`,
+      auth: "bearer",
+      json: body,
+      contentType: "application/merge-patch+json",
+      headers: { "If-Unmodified-Since": options.ifUnmodifiedSince },
+      options,
+    });
+    return decode<Video>(resp);
+  }
+
+  /**
+   * Delete a video.
+   *
+   * Deletes the video and its files. With ?dry_run=true nothing is deleted and
+   * the response lists what would be.
+   */
+  async deleteVideo(videoID: string, options: DeleteVideoOptions = {}): Promise<DeletionPlan | undefined> {
+    const resp = await this.request({
+      method: "DELETE",
+      path: `/videos/${encodeURIComponent(videoID)}`,
+      auth: "bearer",
+      query: { dry_run: options.dryRun },
+      headers: { "If-Unmodified-Since": options.ifUnmodifiedSince },
+      options,
+    });
+    return decode<DeletionPlan | undefined>(resp);
+  }
+
+  /**
+   * Describe a video without URLs.
+   *
+   * Describes a video and its artifacts without issuing any URLs, so dashboards
+   * and crawlers can poll it cheaply.
+   */
+  async getVideoMeta(videoID: string, options: GetVideoMetaOptions = {}): Promise<Result<GetVideoMetaResponse>> {
+    const resp = await this.request({
+      method: "GET",
+      path: `/videos/${encodeURIComponent(videoID)}/meta`,
+      auth: "public",
+      headers: { "If-None-Match": options.ifNoneMatch },
+      options,
+    });
+    const data = await decode<GetVideoMetaResponse>(resp);
+    return { data, headers: resp.headers };
+  }
+
+  /** List a video's renditions. */
+  async listRenditions(videoID: string, options: ListRenditionsOptions = {}): Promise<Rendition[]> {
+    const resp = await this.request({
+      method: "GET",
+      path: `/videos/${encodeURIComponent(videoID)}/renditions`,
+      auth: "optional",
+      headers: { "X-Video-Password": options.videoPassword },
+      options,
+    });
+    return decode<Rendition[]>(resp);
+  }
+
+  /**
+   * Set a video's password.
+   *
+   * Sets or replaces the password viewers need to play the video.
+   */
+  async setVideoPassword(videoID: string, body: SetVideoPasswordRequest, options: RequestOptions = {}): Promise<Video> {
+    const resp = await this.request({
+      method: "PUT",
+      path: `/videos/${encodeURIComponent(videoID)}/password`,
+      auth: "bearer",
+      json: body,
+      options,
+    });
+    return decode<Video>(resp);
+  }
+
+  /**
+   * Remove a video's password.
+   *
+   * Makes the video playable without a password again.
+   */
+  async deleteVideoPassword(videoID: string, options: RequestOptions = {}): Promise<Video> {
+    const resp = await this.request({
+      method: "DELETE",
+      path: `/videos/${encodeURIComponent(videoID)}/password`,
+      auth: "bearer",
+      options,
+    });
+    return decode<Video>(resp);
+  }
+
+  /**
+   * Set a video's expiry.
+   *
+   * Makes the video expire at expires_at, deleting it then if purge is set.
+   */
+  async setVideoExpiry(videoID: string, body: SetVideoExpiryRequest, options: RequestOptions = {}): Promise<Video> {
+    const resp = await this.request({
+      method: "PUT",
+      path: `/videos/${encodeURIComponent(videoID)}/expiry`,
+      auth: "bearer",
+      json: body,
+      options,
+    });
+    return decode<Video>(resp);
+  }
+
+  /**
+   * Remove a video's expiry.
+   *
+   * Keeps the video published indefinitely, publishing it again if it already
+   * expired but wasn't purged.
+   */
+  async deleteVideoExpiry(videoID: string, options: RequestOptions = {}): Promise<Video> {
+    const resp = await this.request({
+      method: "DELETE",
+      path: `/videos/${encodeURIComponent(videoID)}/expiry`,
+      auth: "bearer",
+      options,
+    });
+    return decode<Video>(resp);
+  }
+
+  /**
+   * Get a download link.
+   *
+   * Hands out a link that downloads the video, to its owner and, if the owner
+   * enabled downloads, to anyone who can play it.
+   */
+  async getVideoDownload(videoID: string, options: GetVideoDownloadOptions = {}): Promise<Download> {
+    const resp = await this.request({
+      method: "GET",
+      path: `/videos/${encodeURIComponent(videoID)}/download`,
+      auth: "optional",
+      headers: { "X-Video-Password": options.videoPassword },
+      options,
+    });
+    return decode<Download>(resp);
+  }
+
+  /**
+   * Turn viewer downloads on or off.
+   *
+   * Turns downloads of the video by viewers on or off.
+   */
+  async setVideoDownloads(videoID: string, body: SetVideoDownloadsRequest, options: RequestOptions = {}): Promise<Video> {
+    const resp = await this.request({
+      method: "PUT",
+      path: `/videos/${encodeURIComponent(videoID)}/downloads`,
+      auth: "bearer",
+      json: body,
+      options,
+    });
+    return decode<Video>(resp);
+  }
+
+  /**
+   * Replace a video's metadata.
+   *
+   * Replaces the video's metadata with the JSON object of strings in the body.
+   */
+  async setVideoMetadata(videoID: string, body: Record<string, string>, options: RequestOptions = {}): Promise<Video> {
+    const resp = await this.request({
+      method: "PUT",
+      path: `/videos/${encodeURIComponent(videoID)}/metadata`,
+      auth: "bearer",
+      json: body,
+      options,
+    });
+    return decode<Video>(resp);
+  }
+
+  /**
+   * Apply an action to many videos.
+   *
+   * Applies one action to many of the caller's videos. Each video is handled on
+   * its own, like the single-video endpoint would, so some can fail while the
+   * rest succeed; the response reports every video's outcome. Deletes can be
+   * made as a dry run with ?dry_run=true, reporting what each would remove
+   * instead.
+   */
+  async batchVideos(body: BatchVideosRequest, options: BatchVideosOptions = {}): Promise<BatchResponse> {
+    const resp = await this.request({
+      method: "POST",
+      path: "/videos/batch",
+      auth: "bearer",
+      json: body,
+      query: { dry_run: options.dryRun },
+      options,
+    });
+    return decode<BatchResponse>(resp);
+  }
+
+  /**
+   * Resolve many artifact URLs.
+   *
+   * Resolves the URLs of many artifacts of the caller's videos at once, so a
+   * gallery can get all its thumbnails in one request rather than one per
+   * video. Each item succeeds or fails on its own, like a batch.
+   */
+  async presignArtifacts(body: PresignArtifactsRequest, options: RequestOptions = {}): Promise<PresignArtifactsResponse> {
+    const resp = await this.request({
+      method: "POST",
+      path: "/presign",
+      auth: "bearer",
+      json: body,
+      options,
+    });
+    return decode<PresignArtifactsResponse>(resp);
+  }
+
+  /** Get a video's delivery stats. */
+  async getVideoDeliveryStats(videoID: string, options: RequestOptions = {}): Promise<VideoDelivery[]> {
+    const resp = await this.request({
+      method: "GET",
+      path: `/videos/${encodeURIComponent(videoID)}/delivery_stats`,
+      auth: "bearer",
+      options,
+    });
+    return decode<VideoDelivery[]>(resp);
+  }
+
+  /** Appeal a takedown. */
+  async appealTakedown(videoID: string, body: AppealTakedownRequest, options: RequestOptions = {}): Promise<Takedown> {
+    const resp = await this.request({
+      method: "POST",
+      path: `/videos/${encodeURIComponent(videoID)}/appeal`,
+      auth: "bearer",
+      json: body,
+      options,
+    });
+    return decode<Takedown>(resp);
+  }
+
+  /**
+   * File a claim against a video.
+   *
+   * Lets a rights holder file a claim against someone else's video.
+   */
+  async createClaim(videoID: string, body: CreateClaimRequest, options: RequestOptions = {}): Promise<Claim> {
+    const resp = await this.request({
+      method: "POST",
+      path: `/videos/${encodeURIComponent(videoID)}/claims`,
+      auth: "bearer",
+      json: body,
+      options,
+    });
+    return decode<Claim>(resp);
+  }
+
+  /**
+   * List a video's claims.
+   *
+   * Shows the video's owner every claim against it, and anyone else the claims
+   * they filed.
+   */
+  async listVideoClaims(videoID: string, options: RequestOptions = {}): Promise<Claim[]> {
+    const resp = await this.request({
+      method: "GET",
+      path: `/videos/${encodeURIComponent(videoID)}/claims`,
+      auth: "bearer",
+      options,
+    });
+    return decode<Claim[]>(resp);
+  }
+
+  /** Dispute a claim. */
+  async disputeClaim(claimID: string, body: DisputeClaimRequest, options: RequestOptions = {}): Promise<Claim> {
+    const resp = await this.request({
+      method: "POST",
+      path: `/claims/${encodeURIComponent(claimID)}/dispute`,
+      auth: "bearer",
+      json: body,
+      options,
+    });
+    return decode<Claim>(resp);
+  }
+
+  /** Create an embed token. */
+  async createEmbedToken(videoID: string, body: CreateEmbedTokenRequest, options: RequestOptions = {}): Promise<EmbedToken> {
+    const resp = await this.request({
+      method: "POST",
+      path: `/videos/${encodeURIComponent(videoID)}/embed_tokens`,
+      auth: "bearer",
+      json: body,
+      options,
+    });
+    return decode<EmbedToken>(resp);
+  }
+
+  /** List a video's embed tokens. */
+  async listEmbedTokens(videoID: string, options: RequestOptions = {}): Promise<EmbedToken[]> {
+    const resp = await this.request({
+      method: "GET",
+      path: `/videos/${encodeURIComponent(videoID)}/embed_tokens`,
+      auth: "bearer",
+      options,
+    });
+    return decode<EmbedToken[]>(resp);
+  }
+
+  /** Delete an embed token. */
+  async deleteEmbedToken(videoID: string, token: string, options: RequestOptions = {}): Promise<void> {
+    await this.request({
+      method: "DELETE",
+      path: `/videos/${encodeURIComponent(videoID)}/embed_tokens/${encodeURIComponent(token)}`,
+      auth: "bearer",
+      options,
+    });
+  }
+
+  /**
+   * Create a short link.
+   *
+   * Gives the video a short link. Without a slug in the body, a random one is
+   * picked.
+   */
+  async createSlug(videoID: string, body: CreateSlugRequest, options: RequestOptions = {}): Promise<Slug> {
+    const resp = await this.request({
+      method: "POST",
+      path: `/videos/${encodeURIComponent(videoID)}/slugs`,
+      auth: "bearer",
+      json: body,
+      options,
+    });
+    return decode<Slug>(resp);
+  }
+
+  /** List a video's short links. */
+  async listSlugs(videoID: string, options: RequestOptions = {}): Promise<Slug[]> {
+    const resp = await this.request({
+      method: "GET",
+      path: `/videos/${encodeURIComponent(videoID)}/slugs`,
+      auth: "bearer",
+      options,
+    });
+    return decode<Slug[]>(resp);
+  }
+
+  /** Delete a short link. */
+  async deleteSlug(videoID: string, slug: string, options: RequestOptions = {}): Promise<void> {
+    await this.request({
+      method: "DELETE",
+      path: `/videos/${encodeURIComponent(videoID)}/slugs/${encodeURIComponent(slug)}`,
+      auth: "bearer",
+      options,
+    });
+  }
+
+  /**
+   * Render a short link as a QR code.
+   *
+   * Renders a QR code of one of the video's short links, for slides and
+   * printouts. ?slug= picks the link; otherwise it's the oldest one, and a
+   * video without any gets one. ?size= is the image's width in pixels and ?ec=
+   * the error correction level, L, M (the default), Q or H; higher levels
+   * survive a logo printed over the code at the cost of denser codes.
+   */
+  async getShareQR(videoID: string, options: GetShareQROptions = {}): Promise<Response> {
+    return this.request({
+      method: "GET",
+      path: `/videos/${encodeURIComponent(videoID)}/share/qr.png`,
+      auth: "bearer",
+      query: { size: options.size, ec: options.ec, slug: options.slug },
+      options,
+    });
+  }
+
+  /**
+   * Start syncing to a CMS.
+   *
+   * Starts pushing changes to the caller's videos to a CMS endpoint. The secret
+   * to verify requests with is only returned here.
+   */
+  async createCMSSync(body: CreateCMSSyncParams, options: RequestOptions = {}): Promise<CMSSyncWithSecret> {
+    const resp = await this.request({
+      method: "POST",
+      path: "/cms_syncs",
+      auth: "bearer",
+      json: body,
+      options,
+    });
+    return decode<CMSSyncWithSecret>(resp);
+  }
+
+  /** List the caller's CMS syncs. */
+  async listCMSSyncs(options: RequestOptions = {}): Promise<CMSSync[]> {
+    const resp = await this.request({
+      method: "GET",
+      path: "/cms_syncs",
+      auth: "bearer",
+      options,
+    });
+    return decode<CMSSync[]>(resp);
+  }
+
+  /** Stop syncing to a CMS. */
+  async deleteCMSSync(syncID: string, options: RequestOptions = {}): Promise<void> {
+    await this.request({
+      method: "DELETE",
+      path: `/cms_syncs/${encodeURIComponent(syncID)}`,
+      auth: "bearer",
+      options,
+    });
+  }
+
+  /**
+   * List a CMS sync's events.
+   *
+   * Lists the sync's latest events and how their delivery went.
+   */
+  async listCMSSyncEvents(syncID: string, options: ListCMSSyncEventsOptions = {}): Promise<CMSSyncEvent[]> {
+    const resp = await this.request({
+      method: "GET",
+      path: `/cms_syncs/${encodeURIComponent(syncID)}/events`,
+      auth: "bearer",
+      query: { limit: options.limit },
+      options,
+    });
+    return decode<CMSSyncEvent[]>(resp);
+  }
+
+  /**
+   * Queue CMS sync events again.
+   *
+   * Queues events again: those created since "since", or the failed ones
+   * without it. "backfill" queues an update for every video instead, to push a
+   * whole catalog to a new CMS.
+   */
+  async replayCMSSync(syncID: string, body: ReplayCMSSyncRequest, options: RequestOptions = {}): Promise<ReplayCMSSyncResponse> {
+    const resp = await this.request({
+      method: "POST",
+      path: `/cms_syncs/${encodeURIComponent(syncID)}/replay`,
+      auth: "bearer",
+      json: body,
+      options,
+    });
+    return decode<ReplayCMSSyncResponse>(resp);
+  }
+
+  /** Get the caller's usage. */
+  async getUsage(options: GetUsageOptions = {}): Promise<Usage> {
+    const resp = await this.request({
+      method: "GET",
+      path: "/users/me/usage",
+      auth: "bearer",
+      query: { month: options.month },
+      options,
+    });
+    return decode<Usage>(resp);
+  }
+
+  /**
+   * Export the caller's videos.
+   *
+   * Downloads the caller's whole catalog as CSV or JSON, written while it's
+   * read from the database. Once the first row is out the status can't change,
+   * so a failure after that only cuts the file short.
+   */
+  async exportVideos(options: ExportVideosOptions = {}): Promise<Response> {
+    return this.request({
+      method: "GET",
+      path: "/users/me/videos/export",
+      auth: "bearer",
+      query: { format: options.format },
+      options,
+    });
+  }
+
+  /**
+   * Import a YouTube Takeout export.
+   *
+   * Starts importing videos from a YouTube Takeout export: a multipart form
+   * with the metadata file as "metadata" and any number of video files as
+   * "files". Files are matched to videos by name, since Takeout names them
+   * after the video's ID or title; videos without one are downloaded from their
+   * file URL instead. The import runs in the background and is reported by GET
+   * /imports/{importID}.
+   */
+  async importYouTube(form: ImportYouTubeForm, options: RequestOptions = {}): Promise<VideoImport> {
+    const resp = await this.request({
+      method: "POST",
+      path: "/imports/youtube",
+      auth: "bearer",
+      body: formData({ metadata: form.metadata, files: form.files }),
+      options,
+    });
+    return decode<VideoImport>(resp);
+  }
+
+  /** List the caller's imports. */
+  async listImports(options: RequestOptions = {}): Promise<VideoImport[]> {
+    const resp = await this.request({
+      method: "GET",
+      path: "/imports",
+      auth: "bearer",
+      options,
+    });
+    return decode<VideoImport[]>(resp);
+  }
+
+  /**
+   * Get an import.
+   *
+   * Reports an import's progress, video by video.
+   */
+  async getImport(importID: string, options: RequestOptions = {}): Promise<VideoImport> {
+    const resp = await this.request({
+      method: "GET",
+      path: `/imports/${encodeURIComponent(importID)}`,
+      auth: "bearer",
+      options,
+    });
+    return decode<VideoImport>(resp);
+  }
+
+  /** Get the caller's plan. */
+  async getBillingPlan(options: RequestOptions = {}): Promise<GetBillingPlanResponse> {
+    const resp = await this.request({
+      method: "GET",
+      path: "/billing/plan",
+      auth: "bearer",
+      options,
+    });
+    return decode<GetBillingPlanResponse>(resp);
+  }
+
+  /** Start upgrading the caller's plan. */
+  async createCheckout(options: RequestOptions = {}): Promise<CreateCheckoutResponse> {
+    const resp = await this.request({
+      method: "POST",
+      path: "/billing/checkout",
+      auth: "bearer",
+      options,
+    });
+    return decode<CreateCheckoutResponse>(resp);
+  }
+
+  /**
+   * Get server stats.
+   *
+   * Admins only.
+   */
+  async adminGetStats(options: RequestOptions = {}): Promise<AdminStats> {
+    const resp = await this.request({
+      method: "GET",
+      path: "/admin/stats",
+      auth: "bearer",
+      options,
+    });
+    return decode<AdminStats>(resp);
+  }
+
+  /**
+   * Rerun the startup checks.
+   *
+   * Reruns the checks, so an operator can confirm a fix without restarting.
+   * Admins only.
+   */
+  async adminPreflight(options: RequestOptions = {}): Promise<PreflightReport> {
+    const resp = await this.request({
+      method: "GET",
+      path: "/admin/preflight",
+      auth: "bearer",
+      options,
+    });
+    return decode<PreflightReport>(resp);
+  }
+
+  /**
+   * Get runtime diagnostics.
+   *
+   * Admins only.
+   */
+  async adminGetDiagnostics(options: RequestOptions = {}): Promise<DiagnosticsSnapshot> {
+    const resp = await this.request({
+      method: "GET",
+      path: "/admin/diagnostics",
+      auth: "bearer",
+      options,
+    });
+    return decode<DiagnosticsSnapshot>(resp);
+  }
+
+  /**
+   * Get the bucket's lifecycle rules.
+   *
+   * Shows the bucket's rules next to the config, so drift is visible before
+   * applying. Admins only.
+   */
+  async adminGetLifecycle(options: RequestOptions = {}): Promise<LifecycleResponse> {
+    const resp = await this.request({
+      method: "GET",
+      path: "/admin/lifecycle",
+      auth: "bearer",
+      options,
+    });
+    return decode<LifecycleResponse>(resp);
+  }
+
+  /**
+   * Apply the configured lifecycle rules.
+   *
+   * Admins only.
+   */
+  async adminApplyLifecycle(options: AdminApplyLifecycleOptions = {}): Promise<LifecycleResponse> {
+    const resp = await this.request({
+      method: "PUT",
+      path: "/admin/lifecycle",
+      auth: "bearer",
+      query: { dry_run: options.dryRun },
+      options,
+    });
+    return decode<LifecycleResponse>(resp);
+  }
+
+  /**
+   * Get the latest reconciliation report.
+   *
+   * Admins only.
+   */
+  async adminGetReconciliation(options: RequestOptions = {}): Promise<ReconciliationReport> {
+    const resp = await this.request({
+      method: "GET",
+      path: "/admin/reconciliation",
+      auth: "bearer",
+      options,
+    });
+    return decode<ReconciliationReport>(resp);
+  }
+
+  /**
+   * List every user's usage.
+   *
+   * Admins only.
+   */
+  async adminListUsage(options: AdminListUsageOptions = {}): Promise<Usage[]> {
+    const resp = await this.request({
+      method: "GET",
+      path: "/admin/usage",
+      auth: "bearer",
+      query: { month: options.month },
+      options,
+    });
+    return decode<Usage[]>(resp);
+  }
+
+  /**
+   * Recalculate storage usage.
+   *
+   * Recalculates storage usage, for a single user if user_id is given. It
+   * checks every object, so for large buckets the recalculate-usage command is
+   * the better fit. Admins only.
+   */
+  async adminRecalculateStorageUsage(body: AdminRecalculateStorageUsageRequest, options: RequestOptions = {}): Promise<StorageUsageReport> {
+    const resp = await this.request({
+      method: "POST",
+      path: "/admin/storage_usage/recalculate",
+      auth: "bearer",
+      json: body,
+      options,
+    });
+    return decode<StorageUsageReport>(resp);
+  }
+
+  /**
+   * Estimate storage and delivery costs.
+   *
+   * Admins only.
+   */
+  async adminGetCosts(options: RequestOptions = {}): Promise<AdminGetCostsResponse> {
+    const resp = await this.request({
+      method: "GET",
+      path: "/admin/costs",
+      auth: "bearer",
+      options,
+    });
+    return decode<AdminGetCostsResponse>(resp);
+  }
+
+  /**
+   * Get processing time percentiles.
+   *
+   * Reports how long processing took over the last ?days (30 by default), as
+   * percentiles of each phase by pipeline, resolution and file size, for
+   * capacity planning. ?pipeline narrows it to "ffmpeg" or a transcoder
+   * provider. Admins only.
+   */
+  async adminGetProcessingMetrics(options: AdminGetProcessingMetricsOptions = {}): Promise<AdminGetProcessingMetricsResponse> {
+    const resp = await this.request({
+      method: "GET",
+      path: "/admin/processing_metrics",
+      auth: "bearer",
+      query: { days: options.days, pipeline: options.pipeline },
+      options,
+    });
+    return decode<AdminGetProcessingMetricsResponse>(resp);
+  }
+
+  /**
+   * List database backups.
+   *
+   * Admins only.
+   */
+  async adminListBackups(options: RequestOptions = {}): Promise<AdminListBackupsItem[]> {
+    const resp = await this.request({
+      method: "GET",
+      path: "/admin/backups",
+      auth: "bearer",
+      options,
+    });
+    return decode<AdminListBackupsItem[]>(resp);
+  }
+
+  /**
+   * Back up the database.
+   *
+   * Admins only.
+   */
+  async adminCreateBackup(options: RequestOptions = {}): Promise<AdminCreateBackupResponse> {
+    const resp = await this.request({
+      method: "POST",
+      path: "/admin/backups",
+      auth: "bearer",
+      options,
+    });
+    return decode<AdminCreateBackupResponse>(resp);
+  }
+
+  /**
+   * Ingest CDN access logs.
+   *
+   * Admins only.
+   */
+  async adminIngestAccessLogs(options: RequestOptions = {}): Promise<AccessLogIngestResult> {
+    const resp = await this.request({
+      method: "POST",
+      path: "/admin/access_logs/ingest",
+      auth: "bearer",
+      options,
+    });
+    return decode<AccessLogIngestResult>(resp);
+  }
+
+  /**
+   * List notification channels.
+   *
+   * Admins only.
+   */
+  async adminListNotificationChannels(options: RequestOptions = {}): Promise<NotificationChannel[]> {
+    const resp = await this.request({
+      method: "GET",
+      path: "/admin/notification_channels",
+      auth: "bearer",
+      options,
+    });
+    return decode<NotificationChannel[]>(resp);
+  }
+
+  /**
+   * Add a notification channel.
+   *
+   * Admins only.
+   */
+  async adminCreateNotificationChannel(body: AdminCreateNotificationChannelRequest, options: RequestOptions = {}): Promise<NotificationChannel> {
+    const resp = await this.request({
+      method: "POST",
+      path: "/admin/notification_channels",
+      auth: "bearer",
+      json: body,
+      options,
+    });
+    return decode<NotificationChannel>(resp);
+  }
+
+  /**
+   * Send a test notification.
+   *
+   * Sends a message to every configured channel synchronously so admins can see
+   * delivery errors straight away. Admins only.
+   */
+  async adminTestNotificationChannels(options: RequestOptions = {}): Promise<AdminTestNotificationChannelsItem[]> {
+    const resp = await this.request({
+      method: "POST",
+      path: "/admin/notification_channels/test",
+      auth: "bearer",
+      options,
+    });
+    return decode<AdminTestNotificationChannelsItem[]>(resp);
+  }
+
+  /**
+   * Remove a notification channel.
+   *
+   * Admins only.
+   */
+  async adminDeleteNotificationChannel(channelID: string, options: RequestOptions = {}): Promise<void> {
+    await this.request({
+      method: "DELETE",
+      path: `/admin/notification_channels/${encodeURIComponent(channelID)}`,
+      auth: "bearer",
+      options,
+    });
+  }
+
+  /**
+   * List HTTP actions.
+   *
+   * Admins only.
+   */
+  async adminListHTTPActions(options: RequestOptions = {}): Promise<HTTPAction[]> {
+    const resp = await this.request({
+      method: "GET",
+      path: "/admin/http_actions",
+      auth: "bearer",
+      options,
+    });
+    return decode<HTTPAction[]>(resp);
+  }
+
+  /**
+   * Add an HTTP action.
+   *
+   * Admins only.
+   */
+  async adminCreateHTTPAction(body: CreateHTTPActionParams, options: RequestOptions = {}): Promise<HTTPAction> {
+    const resp = await this.request({
+      method: "POST",
+      path: "/admin/http_actions",
+      auth: "bearer",
+      json: body,
+      options,
+    });
+    return decode<HTTPAction>(resp);
+  }
+
+  /**
+   * Send an HTTP action.
+   *
+   * Sends an action synchronously with sample data, or the "event" and "data"
+   * of the body, so admins can see the rendered request and delivery errors
+   * straight away. Admins only.
+   */
+  async adminTestHTTPAction(actionID: string, body: AdminTestHTTPActionRequest, options: RequestOptions = {}): Promise<AdminTestHTTPActionResponse> {
+    const resp = await this.request({
+      method: "POST",
+      path: `/admin/http_actions/${encodeURIComponent(actionID)}/test`,
+      auth: "bearer",
+      json: body,
+      options,
+    });
+    return decode<AdminTestHTTPActionResponse>(resp);
+  }
+
+  /**
+   * Remove an HTTP action.
+   *
+   * Admins only.
+   */
+  async adminDeleteHTTPAction(actionID: string, options: RequestOptions = {}): Promise<void> {
+    await this.request({
+      method: "DELETE",
+      path: `/admin/http_actions/${encodeURIComponent(actionID)}`,
+      auth: "bearer",
+      options,
+    });
+  }
+
+  /**
+   * List takedowns.
+   *
+   * Admins only.
+   */
+  async adminListTakedowns(options: AdminListTakedownsOptions = {}): Promise<Takedown[]> {
+    const resp = await this.request({
+      method: "GET",
+      path: "/admin/takedowns",
+      auth: "bearer",
+      query: { appeal_status: options.appealStatus },
+      options,
+    });
+    return decode<Takedown[]>(resp);
+  }
+
+  /**
+   * Take a video down.
+   *
+   * Admins only.
+   */
+  async adminCreateTakedown(videoID: string, body: AdminCreateTakedownRequest, options: RequestOptions = {}): Promise<Takedown> {
+    const resp = await this.request({
+      method: "POST",
+      path: `/admin/takedowns/${encodeURIComponent(videoID)}`,
+      auth: "bearer",
+      json: body,
+      options,
+    });
+    return decode<Takedown>(resp);
+  }
+
+  /**
+   * Reinstate a video.
+   *
+   * Reinstates a video, which is also how an appeal is granted. Admins only.
+   */
+  async adminDeleteTakedown(videoID: string, options: RequestOptions = {}): Promise<void> {
+    await this.request({
+      method: "DELETE",
+      path: `/admin/takedowns/${encodeURIComponent(videoID)}`,
+      auth: "bearer",
+      options,
+    });
+  }
+
+  /**
+   * Reject a takedown appeal.
+   *
+   * Rejects the owner's appeal, leaving the video down. Admins only.
+   */
+  async adminUpholdTakedown(videoID: string, options: RequestOptions = {}): Promise<void> {
+    await this.request({
+      method: "POST",
+      path: `/admin/takedowns/${encodeURIComponent(videoID)}/uphold`,
+      auth: "bearer",
+      options,
+    });
+  }
+
+  /**
+   * List claims.
+   *
+   * Admins only.
+   */
+  async adminListClaims(options: AdminListClaimsOptions = {}): Promise<Claim[]> {
+    const resp = await this.request({
+      method: "GET",
+      path: "/admin/claims",
+      auth: "bearer",
+      query: { status: options.status },
+      options,
+    });
+    return decode<Claim[]>(resp);
+  }
+
+  /**
+   * Resolve a claim.
+   *
+   * Closes a claim. Upholding it takes the video down as blocked, so it's
+   * served as 451 from then on. Admins only.
+   */
+  async adminResolveClaim(claimID: string, body: AdminResolveClaimRequest, options: RequestOptions = {}): Promise<Claim> {
+    const resp = await this.request({
+      method: "POST",
+      path: `/admin/claims/${encodeURIComponent(claimID)}/resolve`,
+      auth: "bearer",
+      json: body,
+      options,
+    });
+    return decode<Claim>(resp);
+  }
+
+  /**
+   * Get the maintenance window.
+   *
+   * Admins only.
+   */
+  async adminGetMaintenance(options: RequestOptions = {}): Promise<AdminGetMaintenanceResponse> {
+    const resp = await this.request({
+      method: "GET",
+      path: "/admin/maintenance",
+      auth: "bearer",
+      options,
+    });
+    return decode<AdminGetMaintenanceResponse>(resp);
+  }
+
+  /**
+   * Start maintenance.
+   *
+   * Admins only.
+   */
+  async adminStartMaintenance(body: AdminStartMaintenanceRequest, options: RequestOptions = {}): Promise<Maintenance> {
+    const resp = await this.request({
+      method: "PUT",
+      path: "/admin/maintenance",
+      auth: "bearer",
+      json: body,
+      options,
+    });
+    return decode<Maintenance>(resp);
+  }
+
+  /**
+   * End maintenance.
+   *
+   * Admins only.
+   */
+  async adminEndMaintenance(options: RequestOptions = {}): Promise<void> {
+    await this.request({
+      method: "DELETE",
+      path: "/admin/maintenance",
+      auth: "bearer",
+      options,
+    });
+  }
+
+  /**
+   * List processing windows.
+   *
+   * Admins only.
+   */
+  async adminListProcessingWindows(options: RequestOptions = {}): Promise<AdminListProcessingWindowsResponse> {
+    const resp = await this.request({
+      method: "GET",
+      path: "/admin/processing_windows",
+      auth: "bearer",
+      options,
+    });
+    return decode<AdminListProcessingWindowsResponse>(resp);
+  }
+
+  /**
+   * Add a processing window.
+   *
+   * Admins only.
+   */
+  async adminCreateProcessingWindow(body: AdminCreateProcessingWindowRequest, options: RequestOptions = {}): Promise<ProcessingWindow> {
+    const resp = await this.request({
+      method: "POST",
+      path: "/admin/processing_windows",
+      auth: "bearer",
+      json: body,
+      options,
+    });
+    return decode<ProcessingWindow>(resp);
+  }
+
+  /**
+   * Remove a processing window.
+   *
+   * Removes a window. Uploads it queued are processed on the next run unless
+   * another window is active. Admins only.
+   */
+  async adminDeleteProcessingWindow(windowID: string, options: RequestOptions = {}): Promise<void> {
+    await this.request({
+      method: "DELETE",
+      path: `/admin/processing_windows/${encodeURIComponent(windowID)}`,
+      auth: "bearer",
+      options,
+    });
+  }
+
+  /**
+   * List feature flags.
+   *
+   * Admins only.
+   */
+  async adminListFeatureFlags(options: RequestOptions = {}): Promise<AdminListFeatureFlagsItem[]> {
+    const resp = await this.request({
+      method: "GET",
+      path: "/admin/feature_flags",
+      auth: "bearer",
+      options,
+    });
+    return decode<AdminListFeatureFlagsItem[]>(resp);
+  }
+
+  /**
+   * Set a feature flag.
+   *
+   * Admins only.
+   */
+  async adminSetFeatureFlag(name: string, body: AdminSetFeatureFlagRequest, options: RequestOptions = {}): Promise<void> {
+    await this.request({
+      method: "PUT",
+      path: `/admin/feature_flags/${encodeURIComponent(name)}`,
+      auth: "bearer",
+      json: body,
+      options,
+    });
+  }
+
+  /**
+   * Reset a feature flag.
+   *
+   * Puts the feature back on its default. Admins only.
+   */
+  async adminDeleteFeatureFlag(name: string, options: RequestOptions = {}): Promise<void> {
+    await this.request({
+      method: "DELETE",
+      path: `/admin/feature_flags/${encodeURIComponent(name)}`,
+      auth: "bearer",
+      options,
+    });
+  }
+
+  /**
+   * Get the routes with debug logging.
+   *
+   * Admins only.
+   */
+  async adminGetDebugLogging(options: RequestOptions = {}): Promise<AdminGetDebugLoggingResponse> {
+    const resp = await this.request({
+      method: "GET",
+      path: "/admin/debug_logging",
+      auth: "bearer",
+      options,
+    });
+    return decode<AdminGetDebugLoggingResponse>(resp);
+  }
+
+  /**
+   * Set the routes with debug logging.
+   *
+   * Replaces the routes debug logging is on for, on the instance that handles
+   * the request. Admins only.
+   */
+  async adminSetDebugLogging(body: AdminSetDebugLoggingRequest, options: RequestOptions = {}): Promise<AdminGetDebugLoggingResponse> {
+    const resp = await this.request({
+      method: "PUT",
+      path: "/admin/debug_logging",
+      auth: "bearer",
+      json: body,
+      options,
+    });
+    return decode<AdminGetDebugLoggingResponse>(resp);
+  }
+
+  /**
+   * List abuse blocks.
+   *
+   * Admins only.
+   */
+  async adminListAbuseBlocks(options: RequestOptions = {}): Promise<AbuseBlock[]> {
+    const resp = await this.request({
+      method: "GET",
+      path: "/admin/abuse/blocks",
+      auth: "bearer",
+      options,
+    });
+    return decode<AbuseBlock[]>(resp);
+  }
+
+  /**
+   * Lift an abuse block.
+   *
+   * Admins only.
+   */
+  async adminDeleteAbuseBlock(key: string, options: RequestOptions = {}): Promise<void> {
+    await this.request({
+      method: "DELETE",
+      path: `/admin/abuse/blocks/${encodeURIComponent(key)}`,
+      auth: "bearer",
+      options,
+    });
+  }
+
+  /**
+   * List delivery rate limits.
+   *
+   * Shows the default delivery URL limits and the plans overriding them. Admins
+   * only.
+   */
+  async adminListRateLimits(options: RequestOptions = {}): Promise<AdminListRateLimitsResponse> {
+    const resp = await this.request({
+      method: "GET",
+      path: "/admin/rate_limits",
+      auth: "bearer",
+      options,
+    });
+    return decode<AdminListRateLimitsResponse>(resp);
+  }
+
+  /**
+   * Override a plan's rate limits.
+   *
+   * Admins only.
+   */
+  async adminSetRateLimit(plan: Plan, body: AdminSetRateLimitRequest, options: RequestOptions = {}): Promise<void> {
+    await this.request({
+      method: "PUT",
+      path: `/admin/rate_limits/${encodeURIComponent(plan)}`,
+      auth: "bearer",
+      json: body,
+      options,
+    });
+  }
+
+  /**
+   * Reset a plan's rate limits.
+   *
+   * Puts the plan back on the default limits. Admins only.
+   */
+  async adminDeleteRateLimit(plan: Plan, options: RequestOptions = {}): Promise<void> {
+    await this.request({
+      method: "DELETE",
+      path: `/admin/rate_limits/${encodeURIComponent(plan)}`,
+      auth: "bearer",
+      options,
+    });
+  }
+
+  /** Get this spec. */
+  async getOpenAPI(options: RequestOptions = {}): Promise<Record<string, unknown>> {
+    const resp = await this.request({
+      method: "GET",
+      path: "/openapi.json",
+      auth: "public",
+      options,
+    });
+    return decode<Record<string, unknown>>(resp);
+  }
+}
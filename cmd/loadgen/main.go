@@ -0,0 +1,254 @@
+// Loadgen uploads synthesized videos to a Tubely server concurrently and
+// reports throughput and latency, to measure how changes affect upload
+// performance.
+//
+//	go run ./cmd/loadgen -url http://localhost:8091 -n 50 -concurrency 8 -sizes 640x360,1920x1080
+//
+// The defaults log in as the demo account of a server started with --dev.
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"os/signal"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/pkg/client"
+	"github.com/google/uuid"
+)
+
+type options struct {
+	url         string
+	email       string
+	password    string
+	n           int
+	concurrency int
+	sizes       []string
+	duration    time.Duration
+	bitrate     string
+	resumable   bool
+	fixtures    string
+	keep        bool
+}
+
+func main() {
+	opts := options{}
+	var sizes string
+	flag.StringVar(&opts.url, "url", "http://localhost:8091", "base URL of the server")
+	flag.StringVar(&opts.email, "email", "demo@tubely.local", "email to log in with")
+	flag.StringVar(&opts.password, "password", "tubely-demo", "password to log in with")
+	flag.IntVar(&opts.n, "n", 20, "number of videos to upload")
+	flag.IntVar(&opts.concurrency, "concurrency", 4, "number of uploads in flight")
+	flag.StringVar(&sizes, "sizes", "640x360,1280x720", "comma-separated resolutions the videos cycle through")
+	flag.DurationVar(&opts.duration, "duration", 10*time.Second, "length of each video")
+	flag.StringVar(&opts.bitrate, "bitrate", "2M", "video bitrate, which with -duration sets the file size")
+	flag.BoolVar(&opts.resumable, "resumable", false, "upload through resumable upload sessions")
+	flag.StringVar(&opts.fixtures, "fixtures", "", "directory to keep rendered videos in and reuse them from (default a temporary one)")
+	flag.BoolVar(&opts.keep, "keep", false, "keep the uploaded videos instead of deleting them")
+	flag.Parse()
+	opts.sizes = strings.Split(sizes, ",")
+
+	if opts.n < 1 || opts.concurrency < 1 {
+		log.Fatal("-n and -concurrency must be at least 1")
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	if err := run(ctx, opts); err != nil {
+		log.Fatal(err)
+	}
+}
+
+func run(ctx context.Context, opts options) error {
+	if opts.fixtures == "" {
+		dir, err := os.MkdirTemp("", "tubely-loadgen_*")
+		if err != nil {
+			return err
+		}
+		defer os.RemoveAll(dir)
+		opts.fixtures = dir
+	}
+	fixtures, err := renderFixtures(opts)
+	if err != nil {
+		return err
+	}
+
+	c := client.New(opts.url)
+	if _, err := c.Login(ctx, opts.email, opts.password); err != nil {
+		return fmt.Errorf("couldn't log in: %w", err)
+	}
+
+	log.Printf("Uploading %d videos, %d at a time", opts.n, opts.concurrency)
+	jobs := make(chan string)
+	results := make(chan result)
+	var wg sync.WaitGroup
+	for range opts.concurrency {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for path := range jobs {
+				results <- upload(ctx, c, path, opts)
+			}
+		}()
+	}
+	go func() {
+		defer close(jobs)
+		for i := range opts.n {
+			select {
+			case jobs <- fixtures[i%len(fixtures)]:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	go func() {
+		wg.Wait()
+		close(results)
+	}()
+
+	start := time.Now()
+	var all []result
+	for res := range results {
+		if res.err != nil {
+			log.Printf("Upload failed: %v", res.err)
+		}
+		all = append(all, res)
+	}
+	report(all, time.Since(start))
+
+	if !opts.keep {
+		for _, res := range all {
+			if res.videoID == uuid.Nil {
+				continue
+			}
+			if err := c.DeleteVideo(context.Background(), res.videoID); err != nil {
+				log.Printf("Couldn't delete video %s: %v", res.videoID, err)
+			}
+		}
+	}
+	return nil
+}
+
+// renderFixtures renders one video per size with ffmpeg's test pattern,
+// reusing the ones already in the fixtures directory.
+func renderFixtures(opts options) ([]string, error) {
+	paths := make([]string, 0, len(opts.sizes))
+	for _, size := range opts.sizes {
+		size = strings.TrimSpace(size)
+		name := fmt.Sprintf("%s-%s-%s.mp4", size, opts.duration, opts.bitrate)
+		path := filepath.Join(opts.fixtures, name)
+		paths = append(paths, path)
+		if _, err := os.Stat(path); err == nil {
+			continue
+		}
+
+		log.Printf("Rendering %s", name)
+		seconds := fmt.Sprintf("%g", opts.duration.Seconds())
+		var stderr bytes.Buffer
+		cmd := exec.Command("ffmpeg", "-y", "-v", "error",
+			"-f", "lavfi", "-i", "testsrc2=size="+size+":rate=30:duration="+seconds,
+			"-f", "lavfi", "-i", "sine=frequency=440:duration="+seconds,
+			"-c:v", "libx264", "-preset", "veryfast", "-b:v", opts.bitrate, "-pix_fmt", "yuv420p",
+			"-c:a", "aac", "-shortest", "-movflags", "faststart", path)
+		cmd.Stderr = &stderr
+		if err := cmd.Run(); err != nil {
+			return nil, fmt.Errorf("ffmpeg error: %s, %v", stderr.String(), err)
+		}
+	}
+	return paths, nil
+}
+
+type result struct {
+	videoID   uuid.UUID
+	sizeBytes int64
+	// latency is the time from sending the file until the server accepted
+	// it.
+	latency time.Duration
+	err     error
+}
+
+func upload(ctx context.Context, c *client.Client, path string, opts options) result {
+	f, err := os.Open(path)
+	if err != nil {
+		return result{err: err}
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return result{err: err}
+	}
+
+	video, err := c.CreateVideo(ctx, client.CreateVideoParams{
+		Title:       "loadgen " + filepath.Base(path),
+		Description: "Uploaded by cmd/loadgen",
+	})
+	if err != nil {
+		return result{err: fmt.Errorf("couldn't create video: %w", err)}
+	}
+
+	res := result{videoID: video.ID, sizeBytes: info.Size()}
+	start := time.Now()
+	if opts.resumable {
+		_, err = c.UploadResumable(ctx, video.ID, f, info.Size(), client.ResumableUploadParams{})
+	} else {
+		_, err = c.Upload(ctx, video.ID, f, client.UploadParams{})
+	}
+	res.latency = time.Since(start)
+	res.err = err
+	return res
+}
+
+func report(results []result, elapsed time.Duration) {
+	var latencies []time.Duration
+	var totalBytes int64
+	failures := map[string]int{}
+	for _, res := range results {
+		if res.err != nil {
+			failures[failureReason(res.err)]++
+			continue
+		}
+		latencies = append(latencies, res.latency)
+		totalBytes += res.sizeBytes
+	}
+	slices.Sort(latencies)
+
+	fmt.Printf("\nUploads:     %d succeeded, %d failed in %s\n", len(latencies), len(results)-len(latencies), elapsed.Round(time.Millisecond))
+	for reason, count := range failures {
+		fmt.Printf("  %4d x %s\n", count, reason)
+	}
+	if len(latencies) == 0 {
+		return
+	}
+	fmt.Printf("Throughput:  %.2f uploads/s, %.2f MB/s\n",
+		float64(len(latencies))/elapsed.Seconds(), float64(totalBytes)/1e6/elapsed.Seconds())
+	fmt.Printf("Latency:     p50 %s  p90 %s  p99 %s  max %s\n",
+		percentile(latencies, 50), percentile(latencies, 90), percentile(latencies, 99), percentile(latencies, 100))
+}
+
+// percentile returns the nearest-rank percentile p of sorted latencies.
+func percentile(sorted []time.Duration, p int) time.Duration {
+	i := (len(sorted)*p + 99) / 100
+	return sorted[max(i-1, 0)].Round(time.Millisecond)
+}
+
+// failureReason is what failures are grouped by in the report.
+func failureReason(err error) string {
+	var apiErr *client.APIError
+	if errors.As(err, &apiErr) {
+		return fmt.Sprintf("%d %s", apiErr.StatusCode, apiErr.Message)
+	}
+	if errors.Is(err, context.Canceled) {
+		return "canceled"
+	}
+	return err.Error()
+}
@@ -0,0 +1,538 @@
+package main
+
+import (
+	_ "embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// runtime is the part of the client that doesn't depend on the spec: the
+// options, errors and the start of the client class, which the generated
+// methods complete.
+//
+//go:embed runtime.ts
+var runtime string
+
+const generatedHeader = "// Code generated by go run ./cmd/tsclient. DO NOT EDIT.\n"
+
+// tokenHooks update the client's tokens from the responses of the
+// operations that hand them out or revoke them.
+var tokenHooks = map[string]string{
+	"login":   "this.setTokens(data.token, data.refresh_token);",
+	"refresh": "this.setTokens(data.token);",
+	"revoke":  "this.clearTokens();",
+}
+
+type generator struct {
+	spec *spec
+	b    strings.Builder
+	// methods are written after the runtime, but collected while the
+	// operations' types are written.
+	methods strings.Builder
+}
+
+func generate(data []byte) ([]byte, error) {
+	s := &spec{}
+	if err := json.Unmarshal(data, s); err != nil {
+		return nil, err
+	}
+	if len(s.Servers) != 1 {
+		return nil, errors.New("spec must have exactly one server")
+	}
+	g := &generator{spec: s}
+	g.b.WriteString(generatedHeader)
+	fmt.Fprintf(&g.b, "\nconst BASE_PATH = %s;\n", quote(s.Servers[0].URL))
+
+	for _, name := range s.Components.Schemas.keys {
+		if err := g.schemaType(name, s.Components.Schemas.values[name]); err != nil {
+			return nil, fmt.Errorf("schema %s: %w", name, err)
+		}
+	}
+	for _, path := range s.Paths.keys {
+		item := s.Paths.values[path]
+		for _, method := range item.keys {
+			op := item.values[method]
+			if err := g.operation(path, strings.ToUpper(method), op); err != nil {
+				return nil, fmt.Errorf("%s %s: %w", strings.ToUpper(method), path, err)
+			}
+		}
+	}
+
+	g.b.WriteString("\n")
+	g.b.WriteString(runtime)
+	g.b.WriteString(g.methods.String())
+	g.b.WriteString("}\n")
+	return []byte(g.b.String()), nil
+}
+
+func (g *generator) schemaType(name string, s *schema) error {
+	g.b.WriteString("\n")
+	writeDoc(&g.b, "", s.Description)
+	if s.Type == "object" && s.Properties.keys != nil && s.AdditionalProperties == nil {
+		fmt.Fprintf(&g.b, "export interface %s ", name)
+		body, err := g.objectType(s, "")
+		if err != nil {
+			return err
+		}
+		g.b.WriteString(body + "\n")
+		return nil
+	}
+	t, err := g.tsType(s, "")
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(&g.b, "export type %s = %s;\n", name, t)
+	return nil
+}
+
+// objectType is the body of an interface or inline object type, indented
+// by indent.
+func (g *generator) objectType(s *schema, indent string) (string, error) {
+	var b strings.Builder
+	b.WriteString("{\n")
+	for _, prop := range s.Properties.keys {
+		ps := s.Properties.values[prop]
+		t, err := g.tsType(ps, indent+"  ")
+		if err != nil {
+			return "", fmt.Errorf("%s: %w", prop, err)
+		}
+		optional := "?"
+		if slices.Contains(s.Required, prop) {
+			optional = ""
+		}
+		writeDoc(&b, indent+"  ", ps.Description)
+		fmt.Fprintf(&b, "%s  %s%s: %s;\n", indent, propertyName(prop), optional, t)
+	}
+	b.WriteString(indent + "}")
+	return b.String(), nil
+}
+
+func (g *generator) tsType(s *schema, indent string) (string, error) {
+	t, err := g.baseType(s, indent)
+	if err != nil {
+		return "", err
+	}
+	if s.Nullable && t != "unknown" {
+		t += " | null"
+	}
+	return t, nil
+}
+
+func (g *generator) baseType(s *schema, indent string) (string, error) {
+	switch {
+	case s.Ref != "":
+		name, err := refName(s.Ref, "schemas")
+		if err != nil {
+			return "", err
+		}
+		if _, ok := g.spec.Components.Schemas.values[name]; !ok {
+			return "", fmt.Errorf("unknown schema %q", name)
+		}
+		return name, nil
+	case len(s.AllOf) == 1:
+		return g.baseType(s.AllOf[0], indent)
+	case len(s.AllOf) > 1:
+		return "", errors.New("allOf with more than one schema is unsupported")
+	case len(s.Enum) > 0:
+		values := make([]string, 0, len(s.Enum))
+		for _, v := range s.Enum {
+			data, err := json.Marshal(v)
+			if err != nil {
+				return "", err
+			}
+			values = append(values, string(data))
+		}
+		return strings.Join(values, " | "), nil
+	}
+	switch s.Type {
+	case "string":
+		if s.Format == "binary" {
+			return "Blob", nil
+		}
+		return "string", nil
+	case "integer", "number":
+		return "number", nil
+	case "boolean":
+		return "boolean", nil
+	case "array":
+		if s.Items == nil {
+			return "", errors.New("array without items")
+		}
+		item, err := g.tsType(s.Items, indent)
+		if err != nil {
+			return "", err
+		}
+		if strings.Contains(item, " ") {
+			item = "(" + item + ")"
+		}
+		return item + "[]", nil
+	case "object":
+		if s.AdditionalProperties != nil {
+			value, err := g.tsType(s.AdditionalProperties, indent)
+			if err != nil {
+				return "", err
+			}
+			return "Record<string, " + value + ">", nil
+		}
+		if s.Properties.keys == nil {
+			return "Record<string, unknown>", nil
+		}
+		return g.objectType(s, indent)
+	case "":
+		return "unknown", nil
+	}
+	return "", fmt.Errorf("unsupported type %q", s.Type)
+}
+
+// param is a query or header parameter of an operation, named in the
+// options of its method.
+type param struct {
+	*parameter
+	field string
+	// constant is the value of parameters with only one, which are sent
+	// without the caller passing them.
+	constant string
+}
+
+func (g *generator) operation(path, method string, op *operation) error {
+	if op.OperationID == "" {
+		return errors.New("missing operationId")
+	}
+	name := pascal(op.OperationID)
+
+	var pathParams []*parameter
+	var params []param
+	optionsRequired := false
+	for _, p := range op.Parameters {
+		p, err := g.spec.parameter(p)
+		if err != nil {
+			return err
+		}
+		switch p.In {
+		case "path":
+			pathParams = append(pathParams, p)
+		case "query", "header":
+			pp := param{parameter: p, field: camel(p.Name)}
+			if p.Required && p.Schema != nil && len(p.Schema.Enum) == 1 {
+				pp.constant = fmt.Sprint(p.Schema.Enum[0])
+			} else if p.Required {
+				optionsRequired = true
+			}
+			params = append(params, pp)
+		default:
+			return fmt.Errorf("unsupported parameter location %q", p.In)
+		}
+	}
+
+	// The options type has the operation's own parameters along with the
+	// ones every request takes.
+	optionsType := "RequestOptions"
+	var options strings.Builder
+	for _, p := range params {
+		if p.constant != "" {
+			continue
+		}
+		t, err := g.tsType(p.Schema, "  ")
+		if err != nil {
+			return fmt.Errorf("parameter %s: %w", p.Name, err)
+		}
+		optional := "?"
+		if p.Required {
+			optional = ""
+		}
+		writeDoc(&options, "  ", p.Description)
+		fmt.Fprintf(&options, "  %s%s: %s;\n", p.field, optional, t)
+	}
+	for _, prefix := range op.QueryPrefixes {
+		writeDoc(&options, "  ", prefix.Description)
+		fmt.Fprintf(&options, "  %s?: Record<string, string>;\n", camel(strings.TrimSuffix(prefix.Prefix, ".")))
+	}
+	if options.Len() > 0 {
+		optionsType = name + "Options"
+		fmt.Fprintf(&g.b, "\nexport interface %s extends RequestOptions {\n%s}\n", optionsType, options.String())
+	}
+
+	args := make([]string, 0, len(pathParams)+2)
+	for _, p := range pathParams {
+		t, err := g.tsType(p.Schema, "")
+		if err != nil {
+			return fmt.Errorf("parameter %s: %w", p.Name, err)
+		}
+		args = append(args, p.Name+": "+t)
+	}
+	call := []string{
+		"method: " + quote(method),
+		"path: " + pathTemplate(path),
+		"auth: " + quote(authOf(op)),
+	}
+
+	if op.RequestBody != nil {
+		if len(op.RequestBody.Content.keys) != 1 {
+			return errors.New("request bodies must have exactly one content type")
+		}
+		contentType := op.RequestBody.Content.keys[0]
+		bodySchema := op.RequestBody.Content.values[contentType].Schema
+		switch {
+		case contentType == "multipart/form-data":
+			formType := name + "Form"
+			body, err := g.objectType(bodySchema, "")
+			if err != nil {
+				return err
+			}
+			fmt.Fprintf(&g.b, "\nexport interface %s %s\n", formType, body)
+			args = append(args, "form: "+formType)
+			fields := make([]string, 0, len(bodySchema.Properties.keys))
+			for _, field := range bodySchema.Properties.keys {
+				fields = append(fields, fmt.Sprintf("%s: form.%s", propertyName(field), propertyName(field)))
+			}
+			call = append(call, "body: formData({ "+strings.Join(fields, ", ")+" })")
+		case contentType == "application/json" || strings.HasSuffix(contentType, "+json"):
+			t, err := g.tsType(bodySchema, "")
+			if err != nil {
+				return err
+			}
+			args = append(args, "body: "+t)
+			call = append(call, "json: body")
+			if contentType != "application/json" {
+				call = append(call, "contentType: "+quote(contentType))
+			}
+		default:
+			args = append(args, "body: BodyInit")
+			call = append(call, "body", "contentType: "+quote(contentType))
+		}
+	}
+
+	var query, headers []string
+	for _, p := range params {
+		value := "options." + p.field
+		if p.constant != "" {
+			value = quote(p.constant)
+		}
+		entry := propertyName(p.Name) + ": " + value
+		if p.In == "query" {
+			query = append(query, entry)
+		} else {
+			headers = append(headers, entry)
+		}
+	}
+	for _, prefix := range op.QueryPrefixes {
+		query = append(query, fmt.Sprintf("...prefixed(%s, options.%s)", quote(prefix.Prefix), camel(strings.TrimSuffix(prefix.Prefix, "."))))
+	}
+	if len(query) > 0 {
+		call = append(call, "query: { "+strings.Join(query, ", ")+" }")
+	}
+	if len(headers) > 0 {
+		call = append(call, "headers: { "+strings.Join(headers, ", ")+" }")
+	}
+	call = append(call, "options")
+	if optionsRequired {
+		args = append(args, "options: "+optionsType)
+	} else {
+		args = append(args, "options: "+optionsType+" = {}")
+	}
+
+	result, err := g.result(op)
+	if err != nil {
+		return err
+	}
+
+	m := &g.methods
+	m.WriteString("\n")
+	doc := op.Summary + "."
+	if op.Description != "" {
+		doc += "\n\n" + op.Description
+	}
+	writeDoc(m, "  ", doc)
+	fmt.Fprintf(m, "  async %s(%s): Promise<%s> {\n", op.OperationID, strings.Join(args, ", "), result.returns)
+	request := "this.request({\n"
+	for _, c := range call {
+		request += "      " + c + ",\n"
+	}
+	request += "    })"
+	hook := tokenHooks[op.OperationID]
+	switch {
+	case result.raw:
+		fmt.Fprintf(m, "    return %s;\n", request)
+	case result.data == "void" && !result.headers && hook == "":
+		fmt.Fprintf(m, "    await %s;\n", request)
+	case result.data == "void" && !result.headers:
+		fmt.Fprintf(m, "    await %s;\n    %s\n", request, hook)
+	default:
+		fmt.Fprintf(m, "    const resp = await %s;\n", request)
+		if result.data == "void" {
+			m.WriteString("    return { data: undefined, headers: resp.headers };\n")
+			break
+		}
+		if hook == "" && !result.headers {
+			fmt.Fprintf(m, "    return decode<%s>(resp);\n", result.data)
+			break
+		}
+		fmt.Fprintf(m, "    const data = await decode<%s>(resp);\n", result.data)
+		if hook != "" {
+			fmt.Fprintf(m, "    %s\n", hook)
+		}
+		if result.headers {
+			m.WriteString("    return { data, headers: resp.headers };\n")
+		} else {
+			m.WriteString("    return data;\n")
+		}
+	}
+	m.WriteString("  }\n")
+	return nil
+}
+
+type result struct {
+	// returns is the method's return type, without the Promise.
+	returns string
+	// data is the type of the decoded body.
+	data string
+	// headers is set when the response headers are returned too.
+	headers bool
+	// raw is set for bodies that aren't JSON, which are left to the
+	// caller to read from the Response.
+	raw bool
+}
+
+// result works out what a method returns from the operation's successful
+// responses.
+func (g *generator) result(op *operation) (result, error) {
+	var types []string
+	empty, headers := false, false
+	for _, status := range op.Responses.keys {
+		code, err := strconv.Atoi(status)
+		if err != nil || code < 200 || code > 299 {
+			continue
+		}
+		resp, err := g.spec.response(op.Responses.values[status])
+		if err != nil {
+			return result{}, err
+		}
+		headers = headers || len(resp.Headers.keys) > 0
+		if len(resp.Content.keys) == 0 {
+			empty = true
+			continue
+		}
+		if len(resp.Content.keys) > 1 || resp.Content.keys[0] != "application/json" {
+			return result{returns: "Response", raw: true}, nil
+		}
+		t, err := g.tsType(resp.Content.values["application/json"].Schema, "")
+		if err != nil {
+			return result{}, fmt.Errorf("response %s: %w", status, err)
+		}
+		if !slices.Contains(types, t) {
+			types = append(types, t)
+		}
+	}
+	if len(types) == 0 {
+		types = []string{"void"}
+	} else if empty {
+		types = append(types, "undefined")
+	}
+	r := result{data: strings.Join(types, " | "), headers: headers}
+	r.returns = r.data
+	if headers {
+		r.returns = "Result<" + r.data + ">"
+	}
+	return r, nil
+}
+
+// authOf is how a call authenticates, see Auth in runtime.ts.
+func authOf(op *operation) string {
+	if op.Security == nil {
+		return "bearer"
+	}
+	security := *op.Security
+	switch {
+	case len(security) == 0:
+		return "public"
+	case len(security) == 2 && len(security[0]) == 0:
+		return "optional"
+	case len(security) == 1 && security[0]["refreshToken"] != nil:
+		return "refresh"
+	}
+	return "bearer"
+}
+
+var pathParam = regexp.MustCompile(`\{(\w+)\}`)
+
+func pathTemplate(path string) string {
+	if !strings.Contains(path, "{") {
+		return quote(path)
+	}
+	return "`" + pathParam.ReplaceAllString(path, "$${encodeURIComponent($1)}") + "`"
+}
+
+var identifier = regexp.MustCompile(`^[A-Za-z_$][A-Za-z0-9_$]*$`)
+
+func propertyName(name string) string {
+	if identifier.MatchString(name) {
+		return name
+	}
+	return quote(name)
+}
+
+func quote(s string) string {
+	data, _ := json.Marshal(s)
+	return string(data)
+}
+
+func pascal(s string) string {
+	if s == "" {
+		return s
+	}
+	return strings.ToUpper(s[:1]) + s[1:]
+}
+
+// camel names a parameter in a method's options: dry_run is dryRun and
+// X-Video-Password is videoPassword.
+func camel(s string) string {
+	s = strings.TrimPrefix(s, "X-")
+	words := strings.FieldsFunc(s, func(r rune) bool { return r == '-' || r == '_' || r == '.' })
+	for i, word := range words {
+		if i == 0 {
+			words[i] = strings.ToLower(word[:1]) + word[1:]
+		} else {
+			words[i] = pascal(word)
+		}
+	}
+	return strings.Join(words, "")
+}
+
+// writeDoc writes text as a JSDoc comment, wrapped at 80 columns.
+func writeDoc(b *strings.Builder, indent, text string) {
+	text = strings.TrimSpace(text)
+	if text == "" {
+		return
+	}
+	text = strings.ReplaceAll(text, "*/", "*\\/")
+	if len(indent)+len(text)+7 <= 80 && !strings.Contains(text, "\n") {
+		fmt.Fprintf(b, "%s/** %s */\n", indent, text)
+		return
+	}
+	fmt.Fprintf(b, "%s/**\n", indent)
+	for i, paragraph := range strings.Split(text, "\n\n") {
+		if i > 0 {
+			fmt.Fprintf(b, "%s *\n", indent)
+		}
+		line := ""
+		for _, word := range strings.Fields(paragraph) {
+			if line != "" && len(indent)+3+len(line)+1+len(word) > 80 {
+				fmt.Fprintf(b, "%s * %s\n", indent, line)
+				line = ""
+			}
+			if line != "" {
+				line += " "
+			}
+			line += word
+		}
+		if line != "" {
+			fmt.Fprintf(b, "%s * %s\n", indent, line)
+		}
+	}
+	fmt.Fprintf(b, "%s */\n", indent)
+}
@@ -0,0 +1,34 @@
+// Tsclient generates the TypeScript client in clients/typescript from the
+// OpenAPI spec of the API, so the frontend and other integrations don't
+// write their own request code. It runs with go generate from the
+// repository's root:
+//
+//	go generate
+//
+// The spec is maintained by hand alongside the handlers, and the client is
+// checked in, so changes to both show up in review.
+package main
+
+import (
+	"flag"
+	"log"
+	"os"
+)
+
+func main() {
+	specPath := flag.String("spec", "openapi.json", "OpenAPI spec to generate the client from")
+	outPath := flag.String("out", "clients/typescript/src/index.ts", "file to write the client to")
+	flag.Parse()
+
+	data, err := os.ReadFile(*specPath)
+	if err != nil {
+		log.Fatalf("Couldn't read spec: %v", err)
+	}
+	src, err := generate(data)
+	if err != nil {
+		log.Fatalf("Couldn't generate client from %s: %v", *specPath, err)
+	}
+	if err := os.WriteFile(*outPath, src, 0o644); err != nil {
+		log.Fatalf("Couldn't write client: %v", err)
+	}
+}
@@ -0,0 +1,26 @@
+package main
+
+import (
+	"os"
+	"testing"
+)
+
+// TestClientUpToDate fails when openapi.json changed without the client
+// being generated again.
+func TestClientUpToDate(t *testing.T) {
+	data, err := os.ReadFile("../../openapi.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want, err := generate(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := os.ReadFile("../../clients/typescript/src/index.ts")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != string(want) {
+		t.Error("clients/typescript/src/index.ts is out of date with openapi.json, run go generate")
+	}
+}
@@ -0,0 +1,200 @@
+export interface ClientOptions {
+  /** The server's URL, e.g. https://tubely.example.com. Requests go to the page's own origin by default. */
+  baseURL?: string;
+  /** An access token saved from an earlier login. */
+  token?: string;
+  /** A refresh token saved from an earlier login. */
+  refreshToken?: string;
+  /** The function requests are made with, globalThis.fetch by default. */
+  fetch?: typeof fetch;
+  /** Called when the tokens change, e.g. to save them. */
+  onTokens?: (tokens: Tokens) => void;
+}
+
+export interface Tokens {
+  token: string;
+  refreshToken: string;
+}
+
+export interface RequestOptions {
+  /** Extra headers to send. */
+  headers?: Record<string, string>;
+  signal?: AbortSignal;
+}
+
+/** The data of a response along with its headers, for operations whose headers carry something. */
+export interface Result<T> {
+  data: T;
+  headers: Headers;
+}
+
+/** An error response from the server. */
+export class APIError extends Error {
+  /** Identifies the error independently of the language message is in. */
+  readonly code: string;
+  /** The errors of individual fields of a rejected request, by field name. */
+  readonly fields: Record<string, string>;
+
+  constructor(
+    readonly status: number,
+    body: Partial<ErrorResponse> = {},
+  ) {
+    super(body.error || `tubely: ${status}`);
+    this.name = "APIError";
+    this.code = body.code ?? "";
+    this.fields = body.fields ?? {};
+  }
+}
+
+type Auth = "bearer" | "optional" | "public" | "refresh";
+
+interface Call {
+  method: string;
+  path: string;
+  auth: Auth;
+  query?: Record<string, string | number | boolean | undefined>;
+  headers?: Record<string, string | number | undefined>;
+  json?: unknown;
+  body?: BodyInit;
+  contentType?: string;
+  options: RequestOptions;
+}
+
+function encodeQuery(query: Call["query"]): string {
+  const params = new URLSearchParams();
+  for (const [name, value] of Object.entries(query ?? {})) {
+    if (value !== undefined) {
+      params.append(name, String(value));
+    }
+  }
+  const encoded = params.toString();
+  return encoded ? `?${encoded}` : "";
+}
+
+function prefixed(prefix: string, values: Record<string, string> | undefined): Record<string, string> {
+  const out: Record<string, string> = {};
+  for (const [key, value] of Object.entries(values ?? {})) {
+    out[prefix + key] = value;
+  }
+  return out;
+}
+
+function formData(fields: Record<string, string | Blob | Blob[] | undefined>): FormData {
+  const form = new FormData();
+  for (const [name, value] of Object.entries(fields)) {
+    if (value === undefined) {
+      continue;
+    }
+    for (const item of Array.isArray(value) ? value : [value]) {
+      form.append(name, item);
+    }
+  }
+  return form;
+}
+
+async function decode<T>(resp: Response): Promise<T> {
+  const text = await resp.text();
+  return (text ? JSON.parse(text) : undefined) as T;
+}
+
+export class TubelyClient {
+  private readonly baseURL: string;
+  private readonly fetchFn: typeof fetch;
+  private readonly onTokens?: (tokens: Tokens) => void;
+  private token: string;
+  private refreshToken: string;
+  private refreshing?: Promise<void>;
+
+  constructor(options: ClientOptions = {}) {
+    this.baseURL = (options.baseURL ?? "").replace(/\/+$/, "") + BASE_PATH;
+    this.fetchFn = options.fetch ?? ((input, init) => globalThis.fetch(input, init));
+    this.onTokens = options.onTokens;
+    this.token = options.token ?? "";
+    this.refreshToken = options.refreshToken ?? "";
+  }
+
+  /** The client's current tokens, which change when the access token is refreshed. */
+  get tokens(): Tokens {
+    return { token: this.token, refreshToken: this.refreshToken };
+  }
+
+  /** Replaces the client's tokens. An empty refresh token keeps the current one. */
+  setTokens(token: string, refreshToken = ""): void {
+    this.token = token;
+    if (refreshToken) {
+      this.refreshToken = refreshToken;
+    }
+    this.onTokens?.(this.tokens);
+  }
+
+  /** Forgets both tokens without revoking them. */
+  clearTokens(): void {
+    this.token = "";
+    this.refreshToken = "";
+    this.onTokens?.(this.tokens);
+  }
+
+  /**
+   * Makes a call. One the server rejects because the access token expired
+   * is retried once with a refreshed token, unless its body is a stream
+   * that can't be sent again.
+   */
+  private async request(call: Call): Promise<Response> {
+    let resp = await this.send(call);
+    const retryable = !(typeof ReadableStream !== "undefined" && call.body instanceof ReadableStream);
+    if (resp.status === 401 && call.auth === "bearer" && retryable && this.refreshToken) {
+      await this.refreshOnce();
+      resp = await this.send(call);
+    }
+    if (!resp.ok) {
+      let body: Partial<ErrorResponse> = {};
+      // Errors from proxies in front of the server aren't JSON, in which
+      // case only the status is known.
+      try {
+        body = await resp.json();
+      } catch {
+        // Keep the status alone.
+      }
+      throw new APIError(resp.status, body);
+    }
+    return resp;
+  }
+
+  private send(call: Call): Promise<Response> {
+    const headers: Record<string, string> = {};
+    for (const [name, value] of Object.entries(call.headers ?? {})) {
+      if (value !== undefined) {
+        headers[name] = String(value);
+      }
+    }
+    let body = call.body;
+    if (call.json !== undefined) {
+      body = JSON.stringify(call.json);
+      headers["Content-Type"] = call.contentType ?? "application/json";
+    } else if (call.contentType) {
+      headers["Content-Type"] = call.contentType;
+    }
+    const token = call.auth === "refresh" ? this.refreshToken : call.auth === "public" ? "" : this.token;
+    if (token) {
+      headers["Authorization"] = `Bearer ${token}`;
+    }
+    Object.assign(headers, call.options.headers);
+    return this.fetchFn(this.baseURL + call.path + encodeQuery(call.query), {
+      method: call.method,
+      headers,
+      body,
+      signal: call.options.signal,
+    });
+  }
+
+  /** Refreshes the access token, sharing one refresh between concurrent calls. */
+  private refreshOnce(): Promise<void> {
+    if (!this.refreshing) {
+      this.refreshing = this.refresh()
+        .then(() => undefined)
+        .finally(() => {
+          this.refreshing = undefined;
+        });
+    }
+    return this.refreshing;
+  }
@@ -0,0 +1,145 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// ordered is a JSON object whose keys keep the spec's order, so the client
+// lists types and methods in the same order as the spec.
+type ordered[T any] struct {
+	keys   []string
+	values map[string]T
+}
+
+func (o *ordered[T]) UnmarshalJSON(data []byte) error {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	if _, err := decoder.Token(); err != nil {
+		return err
+	}
+	o.keys, o.values = nil, map[string]T{}
+	for decoder.More() {
+		token, err := decoder.Token()
+		if err != nil {
+			return err
+		}
+		key := token.(string)
+		var value T
+		if err := decoder.Decode(&value); err != nil {
+			return fmt.Errorf("%s: %w", key, err)
+		}
+		o.keys = append(o.keys, key)
+		o.values[key] = value
+	}
+	return nil
+}
+
+type spec struct {
+	Servers []struct {
+		URL string `json:"url"`
+	} `json:"servers"`
+	Paths      ordered[ordered[*operation]] `json:"paths"`
+	Components struct {
+		Schemas    ordered[*schema]      `json:"schemas"`
+		Parameters map[string]*parameter `json:"parameters"`
+		Responses  map[string]*response  `json:"responses"`
+	} `json:"components"`
+}
+
+type operation struct {
+	OperationID string                 `json:"operationId"`
+	Summary     string                 `json:"summary"`
+	Description string                 `json:"description"`
+	Security    *[]map[string][]string `json:"security"`
+	Parameters  []*parameter           `json:"parameters"`
+	RequestBody *struct {
+		Content ordered[mediaType] `json:"content"`
+	} `json:"requestBody"`
+	Responses ordered[*response] `json:"responses"`
+	// QueryPrefixes are families of query parameters named by a prefix and
+	// a key of the caller's choosing, which OpenAPI has no way to describe.
+	QueryPrefixes []struct {
+		Prefix      string `json:"prefix"`
+		Description string `json:"description"`
+	} `json:"x-query-prefixes"`
+}
+
+type parameter struct {
+	Ref         string  `json:"$ref"`
+	Name        string  `json:"name"`
+	In          string  `json:"in"`
+	Description string  `json:"description"`
+	Required    bool    `json:"required"`
+	Schema      *schema `json:"schema"`
+}
+
+type response struct {
+	Ref         string             `json:"$ref"`
+	Description string             `json:"description"`
+	Headers     ordered[*header]   `json:"headers"`
+	Content     ordered[mediaType] `json:"content"`
+}
+
+type header struct {
+	Description string  `json:"description"`
+	Schema      *schema `json:"schema"`
+}
+
+type mediaType struct {
+	Schema *schema `json:"schema"`
+}
+
+type schema struct {
+	Ref                  string           `json:"$ref"`
+	Type                 string           `json:"type"`
+	Format               string           `json:"format"`
+	Description          string           `json:"description"`
+	Nullable             bool             `json:"nullable"`
+	Enum                 []any            `json:"enum"`
+	Items                *schema          `json:"items"`
+	Properties           ordered[*schema] `json:"properties"`
+	Required             []string         `json:"required"`
+	AdditionalProperties *schema          `json:"additionalProperties"`
+	AllOf                []*schema        `json:"allOf"`
+}
+
+// refName is the component a $ref points to.
+func refName(ref, kind string) (string, error) {
+	name, ok := strings.CutPrefix(ref, "#/components/"+kind+"/")
+	if !ok {
+		return "", fmt.Errorf("unsupported $ref %q", ref)
+	}
+	return name, nil
+}
+
+func (s *spec) parameter(p *parameter) (*parameter, error) {
+	if p.Ref == "" {
+		return p, nil
+	}
+	name, err := refName(p.Ref, "parameters")
+	if err != nil {
+		return nil, err
+	}
+	resolved, ok := s.Components.Parameters[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown parameter %q", name)
+	}
+	return resolved, nil
+}
+
+func (s *spec) response(r *response) (*response, error) {
+	if r.Ref == "" {
+		return r, nil
+	}
+	name, err := refName(r.Ref, "responses")
+	if err != nil {
+		return nil, err
+	}
+	resolved, ok := s.Components.Responses[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown response %q", name)
+	}
+	return resolved, nil
+}
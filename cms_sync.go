@@ -0,0 +1,500 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/auth"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/transcoder"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/validate"
+	"github.com/google/uuid"
+)
+
+const (
+	maxCMSSyncs         = 5
+	maxCMSFieldMapSize  = 50
+	maxCMSFieldNameSize = 100
+	maxGraphQLQuerySize = 10000
+
+	// cmsSyncBatchSize bounds how many pending events one run looks at.
+	cmsSyncBatchSize = 500
+	// An event is given up on after cmsSyncMaxAttempts, retried with
+	// backoff doubling from cmsSyncRetryDelay up to cmsSyncMaxRetryDelay.
+	cmsSyncMaxAttempts   = 10
+	cmsSyncRetryDelay    = 30 * time.Second
+	cmsSyncMaxRetryDelay = 6 * time.Hour
+
+	defaultCMSSyncEventsLimit = 50
+)
+
+// cmsEventIDHeader lets the CMS drop an event it already handled, since a
+// replay or a lost response sends it again.
+const cmsEventIDHeader = "X-Tubely-Event-ID"
+
+// cmsSyncHTTPClient pushes to CMS endpoints, which users choose, so like
+// importHTTPClient it refuses to connect to private addresses.
+var cmsSyncHTTPClient = &http.Client{
+	Timeout: 30 * time.Second,
+	Transport: &http.Transport{
+		DialContext: (&net.Dialer{
+			Timeout: 10 * time.Second,
+			Control: publicAddressesOnly,
+		}).DialContext,
+		TLSHandshakeTimeout: 10 * time.Second,
+	},
+}
+
+type cmsSyncResponse struct {
+	database.CMSSync
+	// Secret is only set when the sync is created.
+	Secret string `json:"secret,omitempty"`
+}
+
+// validCMSSourceField reports whether field names a field of the /api/v2
+// video, or one entry of its urls or metadata.
+func validCMSSourceField(field string) bool {
+	if slices.Contains(videoFieldsV2, field) {
+		return true
+	}
+	if key, ok := strings.CutPrefix(field, "metadata."); ok {
+		return database.ValidMetadataKey(key)
+	}
+	if name, ok := strings.CutPrefix(field, "urls."); ok {
+		return name != "" && !strings.Contains(name, ".")
+	}
+	return false
+}
+
+func validateCMSSync(errs validate.Errors, params database.CreateCMSSyncParams) {
+	errs.Check(validate.HTTPSURL(params.URL), "url", "must be an https URL")
+	errs.Check(validate.OneOf(params.Format, database.CMSSyncFormatREST, database.CMSSyncFormatGraphQL), "format", "must be rest or graphql")
+	if params.Format == database.CMSSyncFormatGraphQL {
+		errs.Check(validate.Required(params.GraphQLQuery), "graphql_query", "is required for graphql syncs")
+	}
+	errs.Check(len(params.GraphQLQuery) <= maxGraphQLQuerySize, "graphql_query", "must be at most "+strconv.Itoa(maxGraphQLQuerySize)+" bytes")
+	errs.Check(len(params.FieldMap) <= maxCMSFieldMapSize, "field_map", "must have at most "+strconv.Itoa(maxCMSFieldMapSize)+" fields")
+	for from, to := range params.FieldMap {
+		errs.Check(validCMSSourceField(from), "field_map", "has unknown video field "+strconv.Quote(from))
+		errs.Check(validate.Required(to) && validate.MaxLength(to, maxCMSFieldNameSize), "field_map", "must map to names of 1 to "+strconv.Itoa(maxCMSFieldNameSize)+" characters")
+	}
+}
+
+// mapCMSFields picks the mapped fields out of a video in its /api/v2 JSON
+// form. Dots in a CMS field name nest it, so "media.url" ends up as
+// {"media": {"url": ...}}. With no mapping the whole video is sent.
+func mapCMSFields(video map[string]any, fieldMap map[string]string) map[string]any {
+	if len(fieldMap) == 0 {
+		return video
+	}
+	mapped := map[string]any{}
+	for from, to := range fieldMap {
+		var value any = video
+		for _, part := range strings.Split(from, ".") {
+			obj, ok := value.(map[string]any)
+			if !ok {
+				value = nil
+				break
+			}
+			value = obj[part]
+		}
+
+		parts := strings.Split(to, ".")
+		obj := mapped
+		for _, part := range parts[:len(parts)-1] {
+			child, ok := obj[part].(map[string]any)
+			if !ok {
+				child = map[string]any{}
+				obj[part] = child
+			}
+			obj = child
+		}
+		obj[parts[len(parts)-1]] = value
+	}
+	return mapped
+}
+
+// cmsVideo returns the video as /api/v2 shows it to its owner, as a JSON
+// object, or nil if it no longer exists.
+func (cfg *apiConfig) cmsVideo(videoID uuid.UUID) (map[string]any, error) {
+	video, err := cfg.db.GetVideo(videoID)
+	if err != nil {
+		return nil, err
+	}
+	if video.ID == uuid.Nil {
+		return nil, nil
+	}
+	job, err := cfg.db.GetLatestTranscodeJob(video.ID)
+	if err != nil {
+		return nil, err
+	}
+	queued, err := cfg.db.GetQueuedUpload(video.ID)
+	if err != nil {
+		return nil, err
+	}
+	status, _ := videoStatus(video, job, queued != nil)
+	unavailable, err := cfg.unavailableVideos([]uuid.UUID{video.ID})
+	if err != nil {
+		return nil, err
+	}
+	var urls *videoURLs
+	if !unavailable[video.ID] {
+		resolved, err := cfg.resolveVideoURLs([]database.Video{video})
+		if err != nil {
+			return nil, err
+		}
+		if u, ok := resolved[video.ID]; ok {
+			urls = &u
+		}
+	}
+
+	data, err := json.Marshal(videoToV2(video, urls, status))
+	if err != nil {
+		return nil, err
+	}
+	obj := map[string]any{}
+	if err := json.Unmarshal(data, &obj); err != nil {
+		return nil, err
+	}
+	return obj, nil
+}
+
+// cmsSyncBody builds the request for an event. REST syncs get the event
+// as is; GraphQL syncs get their query with the event as its variables.
+func cmsSyncBody(sync database.CMSSync, event database.CMSSyncEvent, video map[string]any) ([]byte, error) {
+	var mapped map[string]any
+	if video != nil {
+		mapped = mapCMSFields(video, sync.FieldMap)
+	}
+	if sync.Format == database.CMSSyncFormatGraphQL {
+		return json.Marshal(map[string]any{
+			"query": sync.GraphQLQuery,
+			"variables": map[string]any{
+				"event":      event.Event,
+				"videoId":    event.VideoID,
+				"occurredAt": event.CreatedAt,
+				"video":      mapped,
+			},
+		})
+	}
+	return json.Marshal(map[string]any{
+		"event":       event.Event,
+		"video_id":    event.VideoID,
+		"occurred_at": event.CreatedAt,
+		"video":       mapped,
+	})
+}
+
+// deliverCMSSyncEvent pushes one event. Requests are signed like the
+// transcoder's webhooks, with the sync's secret.
+func (cfg *apiConfig) deliverCMSSyncEvent(ctx context.Context, sync database.CMSSync, event database.CMSSyncEvent) error {
+	var video map[string]any
+	if event.Event != database.CMSSyncEventDeleted {
+		var err error
+		video, err = cfg.cmsVideo(event.VideoID)
+		if err != nil {
+			return err
+		}
+		if video == nil {
+			// The video was deleted since, and that's queued after this.
+			return nil
+		}
+	}
+	body, err := cmsSyncBody(sync, event, video)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, sync.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	timestamp := time.Now().Unix()
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(cmsEventIDHeader, strconv.FormatInt(event.ID, 10))
+	req.Header.Set(transcoder.TimestampHeader, strconv.FormatInt(timestamp, 10))
+	req.Header.Set(transcoder.SignatureHeader, "sha256="+transcoder.Sign(sync.Secret, timestamp, body))
+
+	resp, err := cmsSyncHTTPClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	respBody, _ := io.ReadAll(io.LimitReader(resp.Body, 64<<10))
+	if resp.StatusCode > 299 {
+		return fmt.Errorf("responded with status %d", resp.StatusCode)
+	}
+	if sync.Format == database.CMSSyncFormatGraphQL {
+		// GraphQL reports failures in a 200 response.
+		var result struct {
+			Errors []struct {
+				Message string `json:"message"`
+			} `json:"errors"`
+		}
+		if json.Unmarshal(respBody, &result) == nil && len(result.Errors) > 0 {
+			return fmt.Errorf("GraphQL error: %s", result.Errors[0].Message)
+		}
+	}
+	return nil
+}
+
+func cmsSyncRetryAt(attempts int) time.Time {
+	if attempts >= cmsSyncMaxAttempts {
+		return time.Time{}
+	}
+	delay := cmsSyncRetryDelay
+	for i := 1; i < attempts && delay < cmsSyncMaxRetryDelay; i++ {
+		delay *= 2
+	}
+	return time.Now().Add(min(delay, cmsSyncMaxRetryDelay))
+}
+
+// runCMSSync delivers pending events. Each sync gets its events in order,
+// so a failing or backed off event holds back the ones after it until it's
+// delivered or given up on.
+func (cfg *apiConfig) runCMSSync(ctx context.Context) error {
+	events, err := cfg.db.GetPendingCMSSyncEvents(cmsSyncBatchSize)
+	if err != nil {
+		return err
+	}
+
+	syncs := map[uuid.UUID]*database.CMSSync{}
+	blocked := map[uuid.UUID]bool{}
+	for _, event := range events {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if blocked[event.SyncID] {
+			continue
+		}
+		if event.NextAttemptAt.After(time.Now()) {
+			blocked[event.SyncID] = true
+			continue
+		}
+		sync, ok := syncs[event.SyncID]
+		if !ok {
+			sync, err = cfg.db.GetCMSSync(event.SyncID)
+			if err != nil {
+				return err
+			}
+			syncs[event.SyncID] = sync
+		}
+		if sync == nil {
+			continue
+		}
+
+		err := cfg.deliverCMSSyncEvent(ctx, *sync, event)
+		if err == nil {
+			err = cfg.db.MarkCMSSyncEventDelivered(event.ID)
+			if err != nil {
+				return err
+			}
+			continue
+		}
+		retryAt := cmsSyncRetryAt(event.Attempts + 1)
+		if retryAt.IsZero() {
+			log.Printf("Giving up on CMS sync %s event %d: %v", sync.ID, event.ID, err)
+		} else {
+			blocked[event.SyncID] = true
+		}
+		if err := cfg.db.MarkCMSSyncEventFailed(event.ID, err.Error(), retryAt); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ownedCMSSync loads the sync in the path for its owner. It responds
+// itself when it fails.
+func (cfg *apiConfig) ownedCMSSync(w http.ResponseWriter, r *http.Request) (database.CMSSync, bool) {
+	syncID, err := uuid.Parse(r.PathValue("syncID"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid ID", err)
+		return database.CMSSync{}, false
+	}
+	token, err := auth.GetBearerToken(r.Header)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Couldn't find JWT", err)
+		return database.CMSSync{}, false
+	}
+	userID, err := cfg.validateJWT(token)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Couldn't validate JWT", err)
+		return database.CMSSync{}, false
+	}
+	sync, err := cfg.db.GetCMSSync(syncID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get CMS sync", err)
+		return database.CMSSync{}, false
+	}
+	if sync == nil || sync.UserID != userID {
+		respondWithError(w, http.StatusNotFound, "Couldn't find CMS sync", nil)
+		return database.CMSSync{}, false
+	}
+	return *sync, true
+}
+
+// handlerCMSSyncCreate starts pushing changes to the caller's videos to a
+// CMS endpoint. The secret to verify requests with is only returned here.
+func (cfg *apiConfig) handlerCMSSyncCreate(w http.ResponseWriter, r *http.Request) {
+	token, err := auth.GetBearerToken(r.Header)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Couldn't find JWT", err)
+		return
+	}
+	userID, err := cfg.validateJWT(token)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Couldn't validate JWT", err)
+		return
+	}
+
+	params := database.CreateCMSSyncParams{}
+	if err := json.NewDecoder(r.Body).Decode(&params); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Couldn't decode parameters", err)
+		return
+	}
+	params.UserID = userID
+	if params.Format == "" {
+		params.Format = database.CMSSyncFormatREST
+	}
+	errs := validate.Errors{}
+	validateCMSSync(errs, params)
+	if errs.Err() != nil {
+		respondWithValidationErrors(w, errs)
+		return
+	}
+
+	existing, err := cfg.db.GetCMSSyncsForUser(userID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get CMS syncs", err)
+		return
+	}
+	if len(existing) >= maxCMSSyncs {
+		respondWithErrorf(w, http.StatusConflict, nil, "You can't have more than %d CMS syncs", maxCMSSyncs)
+		return
+	}
+
+	params.Secret, err = auth.MakeRefreshToken()
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't create CMS sync", err)
+		return
+	}
+	sync, err := cfg.db.CreateCMSSync(params)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't create CMS sync", err)
+		return
+	}
+	respondWithJSON(w, http.StatusCreated, cmsSyncResponse{CMSSync: sync, Secret: sync.Secret})
+}
+
+func (cfg *apiConfig) handlerCMSSyncsList(w http.ResponseWriter, r *http.Request) {
+	token, err := auth.GetBearerToken(r.Header)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Couldn't find JWT", err)
+		return
+	}
+	userID, err := cfg.validateJWT(token)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Couldn't validate JWT", err)
+		return
+	}
+
+	syncs, err := cfg.db.GetCMSSyncsForUser(userID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get CMS syncs", err)
+		return
+	}
+	respondWithJSON(w, http.StatusOK, syncs)
+}
+
+func (cfg *apiConfig) handlerCMSSyncDelete(w http.ResponseWriter, r *http.Request) {
+	sync, ok := cfg.ownedCMSSync(w, r)
+	if !ok {
+		return
+	}
+	err := cfg.db.DeleteCMSSync(sync.UserID, sync.ID)
+	if errors.Is(err, sql.ErrNoRows) {
+		respondWithError(w, http.StatusNotFound, "Couldn't find CMS sync", err)
+		return
+	}
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't delete CMS sync", err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handlerCMSSyncEvents lists the sync's latest events and how their
+// delivery went.
+func (cfg *apiConfig) handlerCMSSyncEvents(w http.ResponseWriter, r *http.Request) {
+	sync, ok := cfg.ownedCMSSync(w, r)
+	if !ok {
+		return
+	}
+	limit := defaultCMSSyncEventsLimit
+	if s := r.URL.Query().Get("limit"); s != "" {
+		n, err := strconv.Atoi(s)
+		if err != nil || n < 1 || n > maxPageSize {
+			respondWithErrorf(w, http.StatusBadRequest, err, "limit must be between 1 and %d", maxPageSize)
+			return
+		}
+		limit = n
+	}
+	events, err := cfg.db.GetCMSSyncEvents(sync.ID, limit)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get CMS sync events", err)
+		return
+	}
+	respondWithJSON(w, http.StatusOK, events)
+}
+
+// handlerCMSSyncReplay queues events again: those created since "since",
+// or the failed ones without it. "backfill" queues an update for every
+// video instead, to push a whole catalog to a new CMS.
+func (cfg *apiConfig) handlerCMSSyncReplay(w http.ResponseWriter, r *http.Request) {
+	type parameters struct {
+		Since    *time.Time `json:"since"`
+		Backfill bool       `json:"backfill"`
+	}
+	type response struct {
+		Queued int64 `json:"queued"`
+	}
+
+	sync, ok := cfg.ownedCMSSync(w, r)
+	if !ok {
+		return
+	}
+	params := parameters{}
+	if err := json.NewDecoder(r.Body).Decode(&params); err != nil && !errors.Is(err, io.EOF) {
+		respondWithError(w, http.StatusBadRequest, "Couldn't decode parameters", err)
+		return
+	}
+
+	var queued int64
+	var err error
+	switch {
+	case params.Backfill:
+		queued, err = cfg.db.BackfillCMSSync(sync)
+	case params.Since != nil:
+		queued, err = cfg.db.ReplayCMSSyncEvents(sync.ID, *params.Since)
+	default:
+		queued, err = cfg.db.ReplayCMSSyncEvents(sync.ID, time.Time{})
+	}
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't queue CMS sync events", err)
+		return
+	}
+	respondWithJSON(w, http.StatusAccepted, response{Queued: queued})
+}
@@ -0,0 +1,26 @@
+package main
+
+import (
+	_ "embed"
+	"os"
+
+	"github.com/joho/godotenv"
+)
+
+//go:embed defaults.env
+var defaultConfig string
+
+// loadDefaultConfig fills in settings from defaults.env that weren't set in
+// the environment or .env, so a bare binary runs with sensible defaults.
+func loadDefaultConfig() error {
+	defaults, err := godotenv.Unmarshal(defaultConfig)
+	if err != nil {
+		return err
+	}
+	for key, value := range defaults {
+		if _, ok := os.LookupEnv(key); !ok {
+			os.Setenv(key, value)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,326 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"net/url"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/auth"
+)
+
+const (
+	auditEventDebugLoggingChanged = "debug_logging_changed"
+
+	// debugLogAllRoutes turns debug logging on for every route.
+	debugLogAllRoutes = "*"
+	// maxDebugLogBody is how much of each body is logged.
+	maxDebugLogBody = 16 << 10
+)
+
+// debugLogger logs API request and response bodies for the routes it's
+// turned on for, identified by their mux pattern, e.g. "POST /api/videos".
+// Routes are toggled at runtime through the admin API and start out as
+// DEBUG_LOG_ROUTES lists them. The setting isn't shared between instances.
+type debugLogger struct {
+	mu     sync.RWMutex
+	routes map[string]bool
+}
+
+func newDebugLogger(routes string) *debugLogger {
+	l := &debugLogger{routes: map[string]bool{}}
+	for _, route := range strings.Split(routes, ",") {
+		if route = strings.TrimSpace(route); route != "" {
+			l.routes[route] = true
+		}
+	}
+	return l
+}
+
+func (l *debugLogger) enabled(pattern string) bool {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	return l.routes[debugLogAllRoutes] || l.routes[pattern]
+}
+
+func (l *debugLogger) list() []string {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	routes := make([]string, 0, len(l.routes))
+	for route := range l.routes {
+		routes = append(routes, route)
+	}
+	sort.Strings(routes)
+	return routes
+}
+
+func (l *debugLogger) set(routes []string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.routes = map[string]bool{}
+	for _, route := range routes {
+		l.routes[route] = true
+	}
+}
+
+// middleware logs the requests mux routes to an enabled pattern.
+func (l *debugLogger) middleware(mux *http.ServeMux) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, pattern := mux.Handler(r)
+		if pattern == "" || !strings.HasPrefix(r.URL.Path, "/api/") || !l.enabled(pattern) {
+			mux.ServeHTTP(w, r)
+			return
+		}
+
+		requestBody := "[not logged]"
+		if isLoggableBody(r.Header.Get("Content-Type")) {
+			prefix, err := io.ReadAll(io.LimitReader(r.Body, maxDebugLogBody))
+			if err != nil {
+				log.Printf("debug: couldn't read request body: %v", err)
+			}
+			requestBody = redactBody(r.Header.Get("Content-Type"), prefix)
+			// The handler still gets the whole body.
+			r.Body = struct {
+				io.Reader
+				io.Closer
+			}{io.MultiReader(bytes.NewReader(prefix), r.Body), r.Body}
+		}
+
+		dw := &debugResponseWriter{ResponseWriter: w, status: http.StatusOK}
+		mux.ServeHTTP(dw, r)
+
+		responseBody := "[not logged]"
+		if isLoggableBody(dw.Header().Get("Content-Type")) {
+			responseBody = redactBody(dw.Header().Get("Content-Type"), dw.body.Bytes())
+		}
+		log.Printf("debug: %s %s route=%q headers=%s body=%s -> %d body=%s",
+			r.Method, redactURL(r.URL), pattern, redactHeaders(r.Header), requestBody, dw.status, responseBody)
+	})
+}
+
+// isLoggableBody skips uploads and anything else that isn't text, including
+// bodies that don't say what they are.
+func isLoggableBody(contentType string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+	return mediaType == "application/json" || strings.HasPrefix(mediaType, "text/") ||
+		mediaType == "application/x-www-form-urlencoded"
+}
+
+type debugResponseWriter struct {
+	http.ResponseWriter
+	status int
+	body   bytes.Buffer
+}
+
+func (w *debugResponseWriter) WriteHeader(status int) {
+	w.status = status
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *debugResponseWriter) Write(b []byte) (int, error) {
+	if room := maxDebugLogBody - w.body.Len(); room > 0 {
+		w.body.Write(b[:min(len(b), room)])
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *debugResponseWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+const redacted = "[REDACTED]"
+
+var (
+	// sensitiveKey matches JSON keys, query parameters and headers whose
+	// values are never logged.
+	sensitiveKey = regexp.MustCompile(`(?i)token|password|secret|authorization|cookie|signature|^sig$|api[_-]?key`)
+	emailPattern = regexp.MustCompile(`[A-Za-z0-9._%+\-]+@[A-Za-z0-9.\-]+\.[A-Za-z]{2,}`)
+	jwtPattern   = regexp.MustCompile(`eyJ[A-Za-z0-9_\-]+\.[A-Za-z0-9_\-]+\.[A-Za-z0-9_\-]+`)
+	urlPattern   = regexp.MustCompile(`https?://[^\s"'<>]+`)
+	// jsonMember matches a "key": value pair of JSON that doesn't parse,
+	// like a body cut off at maxDebugLogBody. The value may be a string
+	// missing its closing quote.
+	jsonMember = regexp.MustCompile(`"((?:[^"\\]|\\.)*)"(\s*:\s*)("(?:[^"\\]|\\.)*"?|[^\s,{}\[\]"]*)`)
+)
+
+// redactString hides emails, JWTs and the signatures of presigned URLs
+// wherever they appear.
+func redactString(s string) string {
+	s = urlPattern.ReplaceAllStringFunc(s, redactSignedURL)
+	s = jwtPattern.ReplaceAllString(s, redacted)
+	return emailPattern.ReplaceAllString(s, "[EMAIL]")
+}
+
+// redactSignedURL drops the X-Amz-* parameters of a presigned URL, which
+// would let anyone reading the log fetch the object, and redacts other
+// sensitive parameters.
+func redactSignedURL(rawURL string) string {
+	// URLs in JSON that didn't parse still have their & escaped.
+	u, err := url.Parse(strings.ReplaceAll(rawURL, `\u0026`, "&"))
+	if err != nil {
+		return redacted
+	}
+	if u.RawQuery == "" {
+		return rawURL
+	}
+	query := u.Query()
+	for key := range query {
+		switch {
+		case strings.HasPrefix(strings.ToLower(key), "x-amz-"):
+			query.Del(key)
+		case sensitiveKey.MatchString(key):
+			query.Set(key, redacted)
+		}
+	}
+	u.RawQuery = query.Encode()
+	return u.String()
+}
+
+// redactBody redacts sensitive keys in JSON and form bodies, and emails,
+// tokens and signed URLs in any body. JSON that doesn't parse, usually
+// because it was cut off, has its keys redacted as text.
+func redactBody(contentType string, body []byte) string {
+	if len(body) == 0 {
+		return `""`
+	}
+	if mediaType, _, _ := mime.ParseMediaType(contentType); mediaType == "application/x-www-form-urlencoded" {
+		return fmt.Sprintf("%q", redactForm(string(body)))
+	}
+	var v any
+	if err := json.Unmarshal(body, &v); err != nil {
+		return fmt.Sprintf("%q", redactString(redactJSONText(string(body))))
+	}
+	data, err := json.Marshal(redactJSON(v))
+	if err != nil {
+		return redacted
+	}
+	return string(data)
+}
+
+func redactJSON(v any) any {
+	switch v := v.(type) {
+	case map[string]any:
+		for key, value := range v {
+			if sensitiveKey.MatchString(key) {
+				v[key] = redacted
+			} else {
+				v[key] = redactJSON(value)
+			}
+		}
+	case []any:
+		for i := range v {
+			v[i] = redactJSON(v[i])
+		}
+	case string:
+		return redactString(v)
+	}
+	return v
+}
+
+func redactJSONText(s string) string {
+	return jsonMember.ReplaceAllStringFunc(s, func(member string) string {
+		m := jsonMember.FindStringSubmatch(member)
+		if !sensitiveKey.MatchString(m[1]) {
+			return member
+		}
+		return `"` + m[1] + `"` + m[2] + `"` + redacted + `"`
+	})
+}
+
+func redactForm(s string) string {
+	// A form cut off mid-escape still parses up to the bad value.
+	values, _ := url.ParseQuery(s)
+	for key, vs := range values {
+		for i := range vs {
+			if sensitiveKey.MatchString(key) {
+				vs[i] = redacted
+			} else {
+				vs[i] = redactString(vs[i])
+			}
+		}
+	}
+	return values.Encode()
+}
+
+func redactURL(u *url.URL) string {
+	query := u.Query()
+	for key := range query {
+		if sensitiveKey.MatchString(key) {
+			query.Set(key, redacted)
+		}
+	}
+	redactedURL := *u
+	redactedURL.RawQuery = query.Encode()
+	return redactString(redactedURL.RequestURI())
+}
+
+func redactHeaders(header http.Header) string {
+	keys := make([]string, 0, len(header))
+	for key := range header {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	var b strings.Builder
+	b.WriteString("{")
+	for i, key := range keys {
+		if i > 0 {
+			b.WriteString(", ")
+		}
+		value := redacted
+		if !sensitiveKey.MatchString(key) {
+			value = redactString(strings.Join(header[key], ", "))
+		}
+		fmt.Fprintf(&b, "%s: %q", key, value)
+	}
+	b.WriteString("}")
+	return b.String()
+}
+
+func (cfg *apiConfig) handlerAdminDebugLoggingGet(w http.ResponseWriter, r *http.Request) {
+	type response struct {
+		Routes []string `json:"routes"`
+	}
+	respondWithJSON(w, http.StatusOK, response{Routes: cfg.debugLog.list()})
+}
+
+// handlerAdminDebugLoggingSet replaces the routes debug logging is on for,
+// on the instance that handles the request.
+func (cfg *apiConfig) handlerAdminDebugLoggingSet(w http.ResponseWriter, r *http.Request) {
+	type parameters struct {
+		Routes []string `json:"routes"`
+	}
+
+	token, err := auth.GetBearerToken(r.Header)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Couldn't find JWT", err)
+		return
+	}
+	adminID, err := cfg.validateJWT(token)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Couldn't validate JWT", err)
+		return
+	}
+
+	decoder := json.NewDecoder(r.Body)
+	params := parameters{}
+	err = decoder.Decode(&params)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't decode parameters", err)
+		return
+	}
+
+	cfg.debugLog.set(params.Routes)
+	cfg.recordAuditEvent(r, auditEventDebugLoggingChanged, &adminID, "", fmt.Sprintf("routes=%q", params.Routes))
+	cfg.handlerAdminDebugLoggingGet(w, r)
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestRedactBody(t *testing.T) {
+	signedURL := "https://tubely.s3.us-east-2.amazonaws.com/videos/a.mp4?X-Amz-Algorithm=AWS4-HMAC-SHA256&X-Amz-Credential=AKIAEXAMPLE%2F20260101&X-Amz-Signature=deadbeef&response-content-disposition=attachment"
+	longTitle := strings.Repeat("x", maxDebugLogBody)
+
+	tests := []struct {
+		name        string
+		contentType string
+		body        string
+		secrets     []string
+		kept        []string
+	}{
+		{
+			name:        "json",
+			contentType: "application/json",
+			body:        `{"email":"ann@example.com","password":"hunter22","refresh_token":"abc123"}`,
+			secrets:     []string{"ann@example.com", "hunter22", "abc123"},
+		},
+		{
+			name:        "truncated json",
+			contentType: "application/json",
+			body:        (`{"password": "hunter22", "refresh_token":"abc123", "nested": {"api_key": 12345}, "title": "` + longTitle + `"}`)[:maxDebugLogBody],
+			secrets:     []string{"hunter22", "abc123", "12345"},
+			kept:        []string{`\"title\": \"xxx`},
+		},
+		{
+			name:        "json cut inside a secret",
+			contentType: "application/json",
+			body:        `{"title": "a", "password": "hunter2`,
+			secrets:     []string{"hunter2"},
+			kept:        []string{`\"title\": \"a\"`},
+		},
+		{
+			name:        "form",
+			contentType: "application/x-www-form-urlencoded; charset=utf-8",
+			body:        "email=ann%40example.com&password=hunter22&title=hello",
+			secrets:     []string{"ann%40example.com", "ann@example.com", "hunter22"},
+			kept:        []string{"title=hello"},
+		},
+		{
+			name:        "signed url in json",
+			contentType: "application/json",
+			body:        `{"video_url":"` + signedURL + `"}`,
+			secrets:     []string{"AKIAEXAMPLE", "deadbeef", "X-Amz-"},
+			kept:        []string{"response-content-disposition=attachment"},
+		},
+		{
+			name:        "signed url in truncated json",
+			contentType: "application/json",
+			body:        `{"video_url":"` + strings.ReplaceAll(signedURL, "&", `\u0026`) + `","title":"`,
+			secrets:     []string{"AKIAEXAMPLE", "deadbeef", "X-Amz-"},
+			kept:        []string{"response-content-disposition=attachment"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := redactBody(tt.contentType, []byte(tt.body))
+			for _, secret := range tt.secrets {
+				if strings.Contains(got, secret) {
+					t.Errorf("redactBody() = %s, contains %q", got[:min(len(got), 300)], secret)
+				}
+			}
+			for _, kept := range tt.kept {
+				if !strings.Contains(got, kept) {
+					t.Errorf("redactBody() = %s, doesn't contain %q", got[:min(len(got), 300)], kept)
+				}
+			}
+		})
+	}
+}
+
+func TestIsLoggableBody(t *testing.T) {
+	tests := []struct {
+		contentType string
+		want        bool
+	}{
+		{"application/json", true},
+		{"application/json; charset=utf-8", true},
+		{"text/plain", true},
+		{"application/x-www-form-urlencoded", true},
+		{"", false},
+		{"multipart/form-data; boundary=x", false},
+		{"application/octet-stream", false},
+		{"video/mp4", false},
+		{"not a media type;", false},
+	}
+	for _, tt := range tests {
+		if got := isLoggableBody(tt.contentType); got != tt.want {
+			t.Errorf("isLoggableBody(%q) = %v, want %v", tt.contentType, got, tt.want)
+		}
+	}
+}
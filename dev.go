@@ -0,0 +1,243 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"mime/multipart"
+	"net/http"
+	"net/textproto"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/google/uuid"
+)
+
+// Dev mode (tubely --dev) runs everything on one machine: the bucket is
+// kept in devDataDir and served from the server's own localS3Path route, and
+// a demo account with a few sample videos is seeded on first start.
+const (
+	devDataDir  = "./tubely-dev"
+	devEmail    = "demo@tubely.local"
+	devPassword = "tubely-demo"
+)
+
+// devDefaults are applied before defaults.env, so dev mode keeps its data
+// apart from a regular install. The environment and .env still win.
+var devDefaults = map[string]string{
+	"PLATFORM":     "dev",
+	"JWT_SECRET":   "tubely-dev-secret",
+	"DB_PATH":      devDataDir + "/tubely.db",
+	"ASSETS_ROOT":  devDataDir + "/assets",
+	"ADMIN_EMAILS": devEmail,
+}
+
+func applyDevDefaults() error {
+	for key, value := range devDefaults {
+		if _, ok := os.LookupEnv(key); !ok {
+			os.Setenv(key, value)
+		}
+	}
+	return os.MkdirAll(devDataDir, 0755)
+}
+
+type devSample struct {
+	title       string
+	description string
+	size        string
+}
+
+var devSamples = []devSample{
+	{"Test pattern (landscape)", "A 16:9 sample pushed through the upload pipeline.", "1280x720"},
+	{"Test pattern (portrait)", "A 9:16 sample, stored under the portrait prefix.", "720x1280"},
+	{"Test pattern (square)", "Neither landscape nor portrait, so it's filed under other.", "640x640"},
+}
+
+// seedDevData creates the demo account and uploads the samples through the
+// API like a real client would, then prints how to sign in. It does nothing
+// but print the credentials if the demo account already exists.
+func (cfg *apiConfig) seedDevData(ctx context.Context) error {
+	user, err := cfg.db.GetUserByEmail(devEmail)
+	if err != nil {
+		return err
+	}
+	api := devClient{baseURL: "http://localhost:" + cfg.port}
+
+	if user.ID == uuid.Nil {
+		var created struct {
+			ID uuid.UUID `json:"id"`
+		}
+		err = api.postJSON(ctx, "/api/users", map[string]string{"email": devEmail, "password": devPassword}, &created)
+		if err != nil {
+			return fmt.Errorf("couldn't create demo user: %w", err)
+		}
+		if err := cfg.db.MarkUserEmailVerified(created.ID); err != nil {
+			return err
+		}
+		if err := api.login(ctx); err != nil {
+			return err
+		}
+		if err := api.uploadSamples(ctx); err != nil {
+			return err
+		}
+	} else if err := api.login(ctx); err != nil {
+		return err
+	}
+
+	fmt.Printf(`
+Tubely is running in dev mode with local storage in %s
+
+  App:      %s/app/
+  Email:    %s
+  Password: %s
+  Token:    %s
+
+Delete %s to start over with fresh sample data.
+
+`, devDataDir, cfg.baseURL, devEmail, devPassword, api.token, devDataDir)
+	return nil
+}
+
+type devClient struct {
+	baseURL string
+	token   string
+}
+
+func (c *devClient) login(ctx context.Context) error {
+	var resp struct {
+		Token string `json:"token"`
+	}
+	err := c.postJSON(ctx, "/api/login", map[string]string{"email": devEmail, "password": devPassword}, &resp)
+	if err != nil {
+		return fmt.Errorf("couldn't log in as demo user: %w", err)
+	}
+	c.token = resp.Token
+	return nil
+}
+
+// uploadSamples renders each sample with ffmpeg's test sources and uploads
+// it with a thumbnail. Without ffmpeg the upload pipeline can't run either,
+// so only the video drafts are created.
+func (c *devClient) uploadSamples(ctx context.Context) error {
+	_, err := exec.LookPath("ffmpeg")
+	haveFFmpeg := err == nil
+	if !haveFFmpeg {
+		log.Println("dev: ffmpeg not found, sample videos are created without media")
+	}
+
+	dir, err := os.MkdirTemp("", "tubely-dev-samples")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(dir)
+
+	for i, sample := range devSamples {
+		var video struct {
+			ID uuid.UUID `json:"id"`
+		}
+		err := c.postJSON(ctx, "/api/videos", map[string]string{"title": sample.title, "description": sample.description}, &video)
+		if err != nil {
+			return fmt.Errorf("couldn't create sample video: %w", err)
+		}
+		if !haveFFmpeg {
+			continue
+		}
+
+		videoPath := filepath.Join(dir, fmt.Sprintf("sample-%d.mp4", i))
+		thumbnailPath := filepath.Join(dir, fmt.Sprintf("sample-%d.png", i))
+		if err := renderDevSample(sample.size, videoPath, thumbnailPath); err != nil {
+			return fmt.Errorf("couldn't render sample video: %w", err)
+		}
+		if err := c.postFile(ctx, "/api/thumbnail_upload/"+video.ID.String(), "thumbnail", thumbnailPath, "image/png"); err != nil {
+			return fmt.Errorf("couldn't upload sample thumbnail: %w", err)
+		}
+		if err := c.postFile(ctx, "/api/video_upload/"+video.ID.String(), "video", videoPath, "video/mp4"); err != nil {
+			return fmt.Errorf("couldn't upload sample video: %w", err)
+		}
+		log.Printf("dev: seeded sample video %q", sample.title)
+	}
+	return nil
+}
+
+// renderDevSample writes a two second test pattern with a tone, and a still
+// of the same pattern for the thumbnail.
+func renderDevSample(size, videoPath, thumbnailPath string) error {
+	pattern := "testsrc2=size=" + size + ":rate=24"
+	commands := [][]string{
+		{"-f", "lavfi", "-i", pattern + ":duration=2", "-f", "lavfi", "-i", "sine=frequency=440:duration=2",
+			"-c:v", "libx264", "-preset", "veryfast", "-crf", "35", "-pix_fmt", "yuv420p", "-c:a", "aac", "-shortest", videoPath},
+		{"-f", "lavfi", "-i", pattern, "-frames:v", "1", thumbnailPath},
+	}
+	for _, args := range commands {
+		var stderr bytes.Buffer
+		cmd := exec.Command("ffmpeg", append([]string{"-y", "-v", "error"}, args...)...)
+		cmd.Stderr = &stderr
+		if err := cmd.Run(); err != nil {
+			return fmt.Errorf("ffmpeg error: %s, %v", stderr.String(), err)
+		}
+	}
+	return nil
+}
+
+func (c *devClient) postJSON(ctx context.Context, path string, body, out any) error {
+	data, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+	return c.do(ctx, path, "application/json", bytes.NewReader(data), out)
+}
+
+func (c *devClient) postFile(ctx context.Context, path, field, filePath, contentType string) error {
+	f, err := os.Open(filePath)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	var body bytes.Buffer
+	form := multipart.NewWriter(&body)
+	header := textproto.MIMEHeader{}
+	header.Set("Content-Disposition", fmt.Sprintf(`form-data; name=%q; filename=%q`, field, filepath.Base(filePath)))
+	header.Set("Content-Type", contentType)
+	part, err := form.CreatePart(header)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(part, f); err != nil {
+		return err
+	}
+	if err := form.Close(); err != nil {
+		return err
+	}
+	return c.do(ctx, path, form.FormDataContentType(), &body, nil)
+}
+
+func (c *devClient) do(ctx context.Context, path, contentType string, body io.Reader, out any) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.baseURL+path, body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", contentType)
+	if c.token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.token)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("POST %s: %s: %s", path, resp.Status, strings.TrimSpace(string(msg)))
+	}
+	if out == nil {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"expvar"
+	"net/http"
+	"net/http/pprof"
+	"os"
+	"path/filepath"
+	"runtime"
+	"time"
+)
+
+// tempFilePattern matches the temp files and directories the server creates,
+// see os.CreateTemp calls such as the one in handlerUploadVideo.
+const tempFilePattern = "tubely-*"
+
+var processStart = time.Now()
+
+type diagnosticsSnapshot struct {
+	Version        string `json:"version"`
+	UptimeSeconds  int64  `json:"uptime_seconds"`
+	Goroutines     int    `json:"goroutines"`
+	OpenFiles      *int   `json:"open_files"`
+	TempFiles      int    `json:"temp_files"`
+	TempFilesBytes int64  `json:"temp_files_bytes"`
+	HeapAllocBytes uint64 `json:"heap_alloc_bytes"`
+	HeapSysBytes   uint64 `json:"heap_sys_bytes"`
+	SysBytes       uint64 `json:"sys_bytes"`
+	NumGC          uint32 `json:"num_gc"`
+}
+
+// takeDiagnosticsSnapshot reads the process' resource usage. Reading the
+// memory stats briefly stops the world, so it isn't meant to be polled
+// more than every few seconds.
+func takeDiagnosticsSnapshot() diagnosticsSnapshot {
+	var mem runtime.MemStats
+	runtime.ReadMemStats(&mem)
+	snapshot := diagnosticsSnapshot{
+		Version:        readBuildInfo().Version,
+		UptimeSeconds:  int64(time.Since(processStart).Seconds()),
+		Goroutines:     runtime.NumGoroutine(),
+		HeapAllocBytes: mem.HeapAlloc,
+		HeapSysBytes:   mem.HeapSys,
+		SysBytes:       mem.Sys,
+		NumGC:          mem.NumGC,
+	}
+	// Only Linux lists open descriptors in /proc, elsewhere it stays null.
+	if fds, err := os.ReadDir("/proc/self/fd"); err == nil {
+		n := len(fds)
+		snapshot.OpenFiles = &n
+	}
+	matches, _ := filepath.Glob(filepath.Join(os.TempDir(), tempFilePattern))
+	for _, match := range matches {
+		info, err := os.Stat(match)
+		if err != nil {
+			continue
+		}
+		snapshot.TempFiles++
+		snapshot.TempFilesBytes += info.Size()
+	}
+	return snapshot
+}
+
+func init() {
+	expvar.Publish("diagnostics", expvar.Func(func() any { return takeDiagnosticsSnapshot() }))
+}
+
+// diagnosticsHandler serves pprof profiles, expvar and the diagnostics
+// snapshot. None of it is authenticated, so it's only served on
+// DIAGNOSTICS_ADDR, which should be an address only operators can reach.
+func diagnosticsHandler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/debug/pprof/", pprof.Index)
+	mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+	mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+	mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+	mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+	mux.Handle("GET /debug/vars", expvar.Handler())
+	mux.HandleFunc("GET /debug/diagnostics", func(w http.ResponseWriter, r *http.Request) {
+		respondWithJSON(w, http.StatusOK, takeDiagnosticsSnapshot())
+	})
+	return mux
+}
+
+func (cfg *apiConfig) handlerAdminDiagnostics(w http.ResponseWriter, r *http.Request) {
+	respondWithJSON(w, http.StatusOK, takeDiagnosticsSnapshot())
+}
@@ -0,0 +1,418 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/s3/manager"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/aws/aws-sdk-go-v2/service/sts"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/auth"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/validate"
+	"github.com/google/uuid"
+)
+
+// uploadsPrefix is where clients upload files themselves. Files are removed
+// once processed, and the expire-uploads lifecycle rule catches the ones
+// that never were.
+const uploadsPrefix = "uploads/"
+
+const (
+	defaultUploadCredentialsTTL = 15 * time.Minute
+	// STS won't issue credentials for less than 15 minutes, and roles allow
+	// at most 12 hours.
+	minUploadCredentialsTTL = 15 * time.Minute
+	maxUploadCredentialsTTL = 12 * time.Hour
+	// presignedUploadTTL is how long a presigned upload URL can be used.
+	// The upload only has to start by then.
+	presignedUploadTTL = 15 * time.Minute
+)
+
+// directUploader hands out short-lived credentials that can only write
+// under one video's upload prefix, so clients can upload with an AWS SDK,
+// multipart and retries included, straight to the bucket.
+type directUploader struct {
+	sts     *sts.Client
+	roleARN string
+	ttl     time.Duration
+}
+
+// directUploadPrefix is the only place a video's upload credentials can
+// write to.
+func directUploadPrefix(userID, videoID uuid.UUID) string {
+	return uploadsPrefix + userID.String() + "/" + videoID.String() + "/"
+}
+
+type uploadCredentials struct {
+	Bucket          string    `json:"bucket"`
+	Region          string    `json:"region"`
+	Key             string    `json:"key"`
+	AccessKeyID     string    `json:"access_key_id"`
+	SecretAccessKey string    `json:"secret_access_key"`
+	SessionToken    string    `json:"session_token"`
+	Expiration      time.Time `json:"expiration"`
+}
+
+// credentials assumes the upload role with a session policy narrowing it
+// to prefix. The role itself needs s3:PutObject, s3:AbortMultipartUpload
+// and s3:ListMultipartUploadParts on the bucket's uploads/ prefix.
+func (d *directUploader) credentials(ctx context.Context, bucket, prefix, sessionName string) (aws.Credentials, error) {
+	policy, err := json.Marshal(map[string]any{
+		"Version": "2012-10-17",
+		"Statement": []map[string]any{{
+			"Effect":   "Allow",
+			"Action":   []string{"s3:PutObject", "s3:AbortMultipartUpload", "s3:ListMultipartUploadParts"},
+			"Resource": fmt.Sprintf("arn:aws:s3:::%s/%s*", bucket, prefix),
+		}},
+	})
+	if err != nil {
+		return aws.Credentials{}, err
+	}
+	out, err := d.sts.AssumeRole(ctx, &sts.AssumeRoleInput{
+		RoleArn:         aws.String(d.roleARN),
+		RoleSessionName: aws.String(sessionName),
+		Policy:          aws.String(string(policy)),
+		DurationSeconds: aws.Int32(int32(d.ttl.Seconds())),
+	})
+	if err != nil {
+		return aws.Credentials{}, err
+	}
+	return aws.Credentials{
+		AccessKeyID:     aws.ToString(out.Credentials.AccessKeyId),
+		SecretAccessKey: aws.ToString(out.Credentials.SecretAccessKey),
+		SessionToken:    aws.ToString(out.Credentials.SessionToken),
+		Expires:         aws.ToTime(out.Credentials.Expiration),
+	}, nil
+}
+
+// ownedVideo authenticates the request and returns the video in its path
+// if the user owns it and it's available. It responds and returns false
+// otherwise.
+func (cfg *apiConfig) ownedVideo(w http.ResponseWriter, r *http.Request) (database.Video, bool) {
+	videoID, err := uuid.Parse(r.PathValue("videoID"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid ID", err)
+		return database.Video{}, false
+	}
+	token, err := auth.GetBearerToken(r.Header)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Couldn't find JWT", err)
+		return database.Video{}, false
+	}
+	userID, err := cfg.validateJWT(token)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Couldn't validate JWT", err)
+		return database.Video{}, false
+	}
+
+	video, err := cfg.db.GetVideo(videoID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't find video", err)
+		return database.Video{}, false
+	}
+	if video.UserID != userID {
+		respondWithError(w, http.StatusForbidden, "Not authorized to update video", nil)
+		return database.Video{}, false
+	}
+	if !cfg.checkVideoAvailable(w, video.ID) {
+		return database.Video{}, false
+	}
+	return video, true
+}
+
+// handlerUploadCredentials returns credentials for uploading the video's
+// file to the key in the response. Once it's there, the client calls
+// handlerUploadComplete.
+func (cfg *apiConfig) handlerUploadCredentials(w http.ResponseWriter, r *http.Request) {
+	if cfg.directUploads == nil {
+		respondWithError(w, http.StatusNotFound, "Direct uploads aren't enabled", nil)
+		return
+	}
+	video, ok := cfg.ownedVideo(w, r)
+	if !ok {
+		return
+	}
+
+	prefix := directUploadPrefix(video.UserID, video.ID)
+	creds, err := cfg.directUploads.credentials(r.Context(), cfg.s3Bucket, prefix, "tubely-"+video.ID.String())
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get upload credentials", err)
+		return
+	}
+	respondWithJSON(w, http.StatusOK, uploadCredentials{
+		Bucket:          cfg.s3Bucket,
+		Region:          cfg.s3Region,
+		Key:             prefix + generateRandomNameWithExtensionType("video/mp4"),
+		AccessKeyID:     creds.AccessKeyID,
+		SecretAccessKey: creds.SecretAccessKey,
+		SessionToken:    creds.SessionToken,
+		Expiration:      creds.Expires.UTC(),
+	})
+}
+
+// presignedUpload is a request the client makes to upload a file straight
+// to the bucket without an AWS SDK.
+type presignedUpload struct {
+	Method string `json:"method"`
+	URL    string `json:"url"`
+	// Headers are signed, so they have to be sent exactly as they are.
+	Headers   map[string]string `json:"headers"`
+	Key       string            `json:"key"`
+	ExpiresAt time.Time         `json:"expires_at"`
+}
+
+// handlerUploadPresign returns a presigned PUT for uploading the video's
+// file to the key in the response. Its size and type are signed, so only
+// the announced file can be uploaded with it. Once it's there, the client
+// calls handlerUploadComplete. Unlike handlerUploadCredentials it needs no
+// role to assume, but the file goes in a single request.
+func (cfg *apiConfig) handlerUploadPresign(w http.ResponseWriter, r *http.Request) {
+	video, ok := cfg.ownedVideo(w, r)
+	if !ok {
+		return
+	}
+
+	type parameters struct {
+		SizeBytes   int64  `json:"size_bytes"`
+		ContentType string `json:"content_type"`
+	}
+	params := parameters{}
+	if err := json.NewDecoder(r.Body).Decode(&params); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Couldn't decode parameters", err)
+		return
+	}
+	if params.ContentType == "" {
+		params.ContentType = "video/mp4"
+	}
+	errs := validate.Errors{}
+	errs.Check(params.SizeBytes > 0, "size_bytes", "is required")
+	errs.Check(params.SizeBytes <= maxUploadLimit, "size_bytes", "must be at most 1GB")
+	if errs.Err() != nil {
+		respondWithValidationErrors(w, errs)
+		return
+	}
+	if uerr := cfg.checkVideoType(params.ContentType); uerr != nil {
+		respondWithUploadError(w, uerr)
+		return
+	}
+
+	_, limits, err := cfg.getUserLimits(video.UserID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get plan limits", err)
+		return
+	}
+	err = cfg.checkStorageQuota(video.UserID, limits, params.SizeBytes, video.SizeBytes)
+	if errors.Is(err, errStorageQuotaExceeded) {
+		respondWithError(w, http.StatusForbidden, "Storage quota exceeded for your plan", err)
+		return
+	}
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't check storage quota", err)
+		return
+	}
+
+	key := directUploadPrefix(video.UserID, video.ID) + generateRandomNameWithExtensionType(params.ContentType)
+	req, err := cfg.s3Presign.PresignPutObject(r.Context(), &s3.PutObjectInput{
+		Bucket:        aws.String(cfg.s3Bucket),
+		Key:           aws.String(key),
+		ContentType:   aws.String(params.ContentType),
+		ContentLength: aws.Int64(params.SizeBytes),
+	}, s3.WithPresignExpires(presignedUploadTTL))
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't presign upload", err)
+		return
+	}
+	headers := map[string]string{}
+	for name, values := range req.SignedHeader {
+		// Clients set Host from the URL themselves.
+		if name != "Host" && len(values) > 0 {
+			headers[name] = values[0]
+		}
+	}
+	respondWithJSON(w, http.StatusOK, presignedUpload{
+		Method:    req.Method,
+		URL:       req.URL,
+		Headers:   headers,
+		Key:       key,
+		ExpiresAt: time.Now().Add(presignedUploadTTL).UTC(),
+	})
+}
+
+// handlerUploadComplete processes a file the client uploaded with
+// handlerUploadCredentials' credentials or handlerUploadPresign's request
+// like any other upload, then removes it.
+func (cfg *apiConfig) handlerUploadComplete(w http.ResponseWriter, r *http.Request) {
+	video, ok := cfg.ownedVideo(w, r)
+	if !ok {
+		return
+	}
+
+	type parameters struct {
+		Key     string `json:"key"`
+		Quality string `json:"quality"`
+	}
+	params := parameters{}
+	if err := json.NewDecoder(r.Body).Decode(&params); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Couldn't decode parameters", err)
+		return
+	}
+	prefix := directUploadPrefix(video.UserID, video.ID)
+	if !strings.HasPrefix(params.Key, prefix) || path.Clean(params.Key) != params.Key {
+		respondWithError(w, http.StatusBadRequest, "Couldn't find the uploaded file", nil)
+		return
+	}
+
+	release, ok := cfg.acquireUploadSlot(w, video.UserID)
+	if !ok {
+		return
+	}
+	defer release()
+
+	cfg.processUploadedObject(w, r, video, params.Key, params.Quality)
+}
+
+// processUploadedObject processes a file the client uploaded to key in the
+// bucket like any other upload, then removes it.
+func (cfg *apiConfig) processUploadedObject(w http.ResponseWriter, r *http.Request, video database.Video, key, quality string) {
+	head, err := cfg.s3Client.HeadObject(r.Context(), &s3.HeadObjectInput{
+		Bucket: aws.String(cfg.s3Bucket),
+		Key:    aws.String(key),
+	})
+	var notFound *types.NotFound
+	if errors.As(err, &notFound) {
+		respondWithError(w, http.StatusBadRequest, "Couldn't find the uploaded file", err)
+		return
+	}
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't find the uploaded file", err)
+		return
+	}
+	defer func() {
+		_, err := cfg.s3Client.DeleteObject(context.Background(), &s3.DeleteObjectInput{
+			Bucket: aws.String(cfg.s3Bucket),
+			Key:    aws.String(key),
+		})
+		if err != nil {
+			log.Printf("Couldn't delete uploaded file %s: %v", key, err)
+		}
+	}()
+
+	size := aws.ToInt64(head.ContentLength)
+	if size > maxUploadLimit {
+		respondWithError(w, http.StatusRequestEntityTooLarge, "Video file is too large", nil)
+		return
+	}
+	mediaType, _, err := mime.ParseMediaType(aws.ToString(head.ContentType))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid media type", err)
+		return
+	}
+	if uerr := cfg.checkVideoType(mediaType); uerr != nil {
+		respondWithUploadError(w, uerr)
+		return
+	}
+
+	_, limits, err := cfg.getUserLimits(video.UserID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get plan limits", err)
+		return
+	}
+	err = cfg.checkStorageQuota(video.UserID, limits, size, video.SizeBytes)
+	if errors.Is(err, errStorageQuotaExceeded) {
+		respondWithError(w, http.StatusForbidden, "Storage quota exceeded for your plan", err)
+		return
+	}
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't check storage quota", err)
+		return
+	}
+
+	tempVidFile, err := createSourceFile()
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Issue creating temp file", err)
+		return
+	}
+	defer tempVidFile.release()
+
+	contentHash, err := cfg.downloadObject(r.Context(), key, tempVidFile.File)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't write file to disk", err)
+		return
+	}
+
+	cfg.processVideoUpload(w, r, videoUpload{
+		video:       video,
+		userID:      video.UserID,
+		limits:      limits,
+		file:        tempVidFile,
+		mediaType:   mediaType,
+		size:        size,
+		contentHash: contentHash,
+		quality:     quality,
+	})
+}
+
+// downloadObject writes key to f and returns its hex SHA-256, leaving f at
+// the start. The object is fetched in ranged parts in parallel, which cuts
+// the wait on originals of a gigabyte or more, and hashed from disk after.
+func (cfg *apiConfig) downloadObject(ctx context.Context, key string, f *os.File) (string, error) {
+	_, err := cfg.s3Downloader.Download(ctx, f, &s3.GetObjectInput{
+		Bucket: aws.String(cfg.s3Bucket),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		return "", err
+	}
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return "", err
+	}
+
+	hash := sha256.New()
+	if _, err := io.Copy(hash, f); err != nil {
+		return "", err
+	}
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// newS3Downloader returns the downloader downloadObject uses, reading
+// S3_DOWNLOAD_PART_MB (default 16) and S3_DOWNLOAD_CONCURRENCY (default 8).
+func newS3Downloader(client *s3.Client) (*manager.Downloader, error) {
+	partMB, concurrency := 16, 8
+	for name, n := range map[string]*int{
+		"S3_DOWNLOAD_PART_MB":     &partMB,
+		"S3_DOWNLOAD_CONCURRENCY": &concurrency,
+	} {
+		v := os.Getenv(name)
+		if v == "" {
+			continue
+		}
+		parsed, err := strconv.Atoi(v)
+		if err != nil || parsed < 1 {
+			return nil, fmt.Errorf("%s must be a positive number", name)
+		}
+		*n = parsed
+	}
+	return manager.NewDownloader(client, func(d *manager.Downloader) {
+		d.PartSize = int64(partMB) << 20
+		d.Concurrency = concurrency
+	}), nil
+}
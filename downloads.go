@@ -0,0 +1,169 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"mime"
+	"net/http"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/auth"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/google/uuid"
+)
+
+// defaultDownloadTTL is how long download links work when PRESIGN_TTL isn't
+// set. They're always presigned, since only a presigned URL can ask S3 to
+// send the file as an attachment.
+const defaultDownloadTTL = 15 * time.Minute
+
+type downloadResponse struct {
+	URL       string    `json:"url"`
+	Filename  string    `json:"filename"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// downloadFilename turns a video's title into a filename that works on any
+// OS.
+func downloadFilename(title string) string {
+	name := strings.Map(func(r rune) rune {
+		if strings.ContainsRune(`<>:"/\|?*`, r) || unicode.IsControl(r) {
+			return -1
+		}
+		return r
+	}, title)
+	name = strings.Trim(strings.TrimSpace(name), ".")
+	if name == "" {
+		name = "video"
+	}
+	return name + ".mp4"
+}
+
+// presignDownloadURL presigns key with a Content-Disposition override, so
+// browsers save the file under filename instead of playing it.
+func presignDownloadURL(presignClient *s3.PresignClient, bucket, key, filename string, expireTime time.Duration) (string, error) {
+	req, err := presignClient.PresignGetObject(context.Background(), &s3.GetObjectInput{
+		Bucket:                     aws.String(bucket),
+		Key:                        aws.String(key),
+		ResponseContentDisposition: aws.String(mime.FormatMediaType("attachment", map[string]string{"filename": filename})),
+	}, s3.WithPresignExpires(expireTime))
+	if err != nil {
+		return "", fmt.Errorf("couldn't presign %s: %w", key, err)
+	}
+	return req.URL, nil
+}
+
+// downloadArtifact picks the file a download gets: the processed video, or
+// the largest rendition of transcoded ones.
+func (cfg *apiConfig) downloadArtifact(videoID uuid.UUID) (*database.Artifact, error) {
+	for _, kind := range []database.ArtifactKind{database.ArtifactKindVideo, database.ArtifactKindRendition} {
+		artifacts, err := cfg.db.GetArtifacts(videoID, kind)
+		if err != nil {
+			return nil, err
+		}
+		if len(artifacts) > 0 {
+			return &artifacts[0], nil
+		}
+	}
+	return nil, nil
+}
+
+// handlerVideoDownload hands out a link that downloads the video, to its
+// owner and, if the owner enabled downloads, to anyone who can play it.
+func (cfg *apiConfig) handlerVideoDownload(w http.ResponseWriter, r *http.Request) {
+	videoID, err := uuid.Parse(r.PathValue("videoID"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid video ID", err)
+		return
+	}
+	video, err := cfg.db.GetVideo(videoID)
+	if err != nil {
+		respondWithError(w, http.StatusNotFound, "Couldn't get video", err)
+		return
+	}
+	if !cfg.checkVideoAvailable(w, video.ID) {
+		return
+	}
+	if !cfg.checkVideoPublished(w, r, video) {
+		return
+	}
+	if !cfg.checkVideoPassword(w, r, video) {
+		return
+	}
+	if !video.DownloadsEnabled {
+		owner := false
+		if token, err := auth.GetBearerToken(r.Header); err == nil {
+			userID, err := cfg.validateJWT(token)
+			owner = err == nil && userID == video.UserID
+		}
+		if !owner {
+			respondWithError(w, http.StatusForbidden, "Downloads are disabled for this video", nil)
+			return
+		}
+	}
+
+	artifact, err := cfg.downloadArtifact(video.ID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get video artifacts", err)
+		return
+	}
+	if artifact == nil {
+		respondWithError(w, http.StatusNotFound, "Video hasn't been uploaded yet", nil)
+		return
+	}
+
+	if !cfg.checkURLIssuance(w, r, video.ID.String()) {
+		return
+	}
+	err = cfg.db.RecordURLIssuance(video.UserID, artifact.SizeBytes)
+	if err != nil {
+		log.Printf("Couldn't record URL issuance for video %s: %v", video.ID, err)
+	}
+
+	ttl := cfg.presignTTL
+	if ttl == 0 {
+		ttl = defaultDownloadTTL
+	}
+	filename := downloadFilename(video.Title)
+	url, err := presignDownloadURL(cfg.s3Presign, cfg.s3Bucket, artifact.Key, filename, ttl)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't create download link", err)
+		return
+	}
+	w.Header().Set("Cache-Control", "private, no-store")
+	respondWithJSON(w, http.StatusOK, downloadResponse{
+		URL:       url,
+		Filename:  filename,
+		ExpiresAt: time.Now().Add(ttl).UTC(),
+	})
+}
+
+// handlerVideoDownloadsSet turns downloads of the video by viewers on or
+// off.
+func (cfg *apiConfig) handlerVideoDownloadsSet(w http.ResponseWriter, r *http.Request) {
+	type parameters struct {
+		Enabled bool `json:"enabled"`
+	}
+
+	video, ok := cfg.ownedVideo(w, r)
+	if !ok {
+		return
+	}
+
+	params := parameters{}
+	if err := json.NewDecoder(r.Body).Decode(&params); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Couldn't decode parameters", err)
+		return
+	}
+	if err := cfg.db.SetVideoDownloadsEnabled(&video, params.Enabled); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't update video downloads", err)
+		return
+	}
+	respondWithJSON(w, http.StatusOK, video)
+}
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/storage"
+)
+
+// Layout of the disaster recovery copy on the secondary provider.
+const (
+	drBucketPrefix = "bucket/"
+	drAssetsPrefix = "assets/"
+	drDBPrefix     = "db/"
+)
+
+// drStoreFromEnv returns the secondary provider backups are mirrored to, or
+// nil when DR_S3_BUCKET isn't set.
+func drStoreFromEnv() (storage.Store, error) {
+	bucket := os.Getenv("DR_S3_BUCKET")
+	if bucket == "" {
+		return nil, nil
+	}
+	accessKeyID := os.Getenv("DR_S3_ACCESS_KEY_ID")
+	secretAccessKey := os.Getenv("DR_S3_SECRET_ACCESS_KEY")
+	if accessKeyID == "" || secretAccessKey == "" {
+		return nil, errors.New("DR_S3_ACCESS_KEY_ID and DR_S3_SECRET_ACCESS_KEY must be set when DR_S3_BUCKET is")
+	}
+	return storage.NewS3Compatible(storage.S3CompatibleConfig{
+		Endpoint:        os.Getenv("DR_S3_ENDPOINT"),
+		Region:          os.Getenv("DR_S3_REGION"),
+		Bucket:          bucket,
+		AccessKeyID:     accessKeyID,
+		SecretAccessKey: secretAccessKey,
+	}), nil
+}
+
+// runDRBackup mirrors the bucket, the local assets and a fresh database
+// snapshot to the secondary provider.
+func (cfg *apiConfig) runDRBackup(ctx context.Context) error {
+	start := time.Now()
+
+	copied, err := storage.Mirror(ctx, cfg.drStore, drBucketPrefix, storage.NewS3(cfg.s3Client, cfg.s3Bucket), "")
+	if err != nil {
+		return fmt.Errorf("couldn't mirror bucket: %w", err)
+	}
+	assetsCopied, err := storage.Mirror(ctx, cfg.drStore, drAssetsPrefix, storage.NewDir(cfg.assetsRoot), "")
+	if err != nil {
+		return fmt.Errorf("couldn't mirror assets: %w", err)
+	}
+
+	key, err := uploadDBSnapshot(ctx, cfg.db, cfg.drStore, drDBPrefix)
+	if err != nil {
+		return err
+	}
+
+	log.Printf("DR backup to %s: %d objects, %d assets and %s in %s",
+		cfg.drStore.Name(), copied, assetsCopied, key, time.Since(start).Round(time.Second))
+	return nil
+}
+
+// uploadDBSnapshot snapshots db to a temp file and uploads it under prefix,
+// returning the key it was stored at.
+func uploadDBSnapshot(ctx context.Context, db database.Client, store storage.Store, prefix string) (string, error) {
+	dir, err := os.MkdirTemp("", "tubely-backup")
+	if err != nil {
+		return "", err
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "tubely.db")
+	if err := db.Snapshot(path); err != nil {
+		return "", fmt.Errorf("couldn't snapshot database: %w", err)
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return "", err
+	}
+
+	key := prefix + "tubely-" + time.Now().UTC().Format("20060102T150405Z") + ".db"
+	if err := store.Put(ctx, key, f, info.Size(), "application/vnd.sqlite3"); err != nil {
+		return "", err
+	}
+	return key, nil
+}
+
+// latestDBSnapshot finds the newest snapshot under prefix. Keys embed the
+// time they were taken so sorting them is enough.
+func latestDBSnapshot(ctx context.Context, store storage.Store, prefix string) (storage.Object, error) {
+	objects, err := store.List(ctx, prefix)
+	if err != nil {
+		return storage.Object{}, err
+	}
+	snapshots := []storage.Object{}
+	for _, obj := range objects {
+		if strings.HasSuffix(obj.Key, ".db") {
+			snapshots = append(snapshots, obj)
+		}
+	}
+	if len(snapshots) == 0 {
+		return storage.Object{}, fmt.Errorf("no database snapshots in %s/%s", store.Name(), prefix)
+	}
+	sort.Slice(snapshots, func(i, j int) bool { return snapshots[i].Key < snapshots[j].Key })
+	return snapshots[len(snapshots)-1], nil
+}
+
+// restoreDBSnapshot downloads a snapshot to dbPath. An existing database is
+// only replaced when force is set, and is kept next to it as a .bak file.
+func restoreDBSnapshot(ctx context.Context, store storage.Store, snapshot storage.Object, dbPath string, force bool) error {
+	if _, err := os.Stat(dbPath); err == nil {
+		if !force {
+			return fmt.Errorf("%s already exists, stop the server and pass -force to replace it", dbPath)
+		}
+		if err := os.Rename(dbPath, dbPath+".bak"); err != nil {
+			return err
+		}
+		log.Printf("Moved existing database to %s.bak", dbPath)
+	}
+
+	tmp := dbPath + ".restoring"
+	if err := storage.Copy(ctx, storage.NewDir(filepath.Dir(tmp)), filepath.Base(tmp), store, snapshot); err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("couldn't download %s: %w", snapshot.Key, err)
+	}
+	return os.Rename(tmp, dbPath)
+}
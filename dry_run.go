@@ -0,0 +1,68 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"slices"
+	"strconv"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/google/uuid"
+)
+
+// deletionPlan is what deleting a video would remove. Destructive endpoints
+// return it instead of acting when called with ?dry_run=true, so operators
+// can check what a delete touches before making it.
+type deletionPlan struct {
+	VideoID uuid.UUID `json:"video_id"`
+	// Rows are how many database rows would be deleted, by table.
+	Rows map[string]int `json:"rows"`
+	// Keys are the bucket objects that would be deleted.
+	Keys []string `json:"keys"`
+}
+
+// parseDryRun reads the dry_run query parameter. A value that isn't a
+// boolean is an error rather than false, so a typo can't turn a preview
+// into the real thing.
+func parseDryRun(r *http.Request) (bool, error) {
+	v := r.URL.Query().Get("dry_run")
+	if v == "" {
+		return false, nil
+	}
+	dryRun, err := strconv.ParseBool(v)
+	if err != nil {
+		return false, fmt.Errorf("invalid dry_run %q: %w", v, err)
+	}
+	return dryRun, nil
+}
+
+// planVideoDeletion lists what purgeVideo would remove for the video, the
+// same way deleteVideoObjects and DeleteVideo find it, without changing
+// anything.
+func (cfg *apiConfig) planVideoDeletion(ctx context.Context, video database.Video) (deletionPlan, error) {
+	rows, err := cfg.db.CountVideoRows(video.ID)
+	if err != nil {
+		return deletionPlan{}, err
+	}
+	artifacts, err := cfg.db.GetAllArtifacts(video.ID)
+	if err != nil {
+		return deletionPlan{}, err
+	}
+	keys, err := cfg.listPrefix(ctx, cfg.objectKeys(video.UserID, video.ID).videoPrefix())
+	if err != nil {
+		return deletionPlan{}, err
+	}
+	for _, a := range artifacts {
+		keys = append(keys, a.Key)
+	}
+	queued, err := cfg.queuedUploadKey(video.ID)
+	if err != nil {
+		return deletionPlan{}, err
+	}
+	if queued != "" {
+		keys = append(keys, queued)
+	}
+	slices.Sort(keys)
+	return deletionPlan{VideoID: video.ID, Rows: rows, Keys: slices.Compact(keys)}, nil
+}
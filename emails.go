@@ -0,0 +1,33 @@
+package main
+
+import (
+	"embed"
+	"fmt"
+	"strings"
+	"text/template"
+)
+
+// emailTemplates start with a "Subject: ..." line and a blank line, followed
+// by the plain text body.
+//
+//go:embed templates/email/*.txt
+var emailTemplateFiles embed.FS
+
+var emailTemplates = template.Must(template.ParseFS(emailTemplateFiles, "templates/email/*.txt"))
+
+// sendTemplatedEmail renders templates/email/<name>.txt with data and sends
+// it to the given address.
+func (cfg *apiConfig) sendTemplatedEmail(to, name string, data any) error {
+	var rendered strings.Builder
+	err := emailTemplates.ExecuteTemplate(&rendered, name+".txt", data)
+	if err != nil {
+		return err
+	}
+
+	header, body, ok := strings.Cut(rendered.String(), "\n\n")
+	subject, hasSubject := strings.CutPrefix(header, "Subject: ")
+	if !ok || !hasSubject {
+		return fmt.Errorf("email template %s doesn't start with a subject line", name)
+	}
+	return cfg.mailer.Send(to, subject, strings.TrimRight(body, "\n"))
+}
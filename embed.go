@@ -0,0 +1,540 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html/template"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"net/url"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/auth"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/validate"
+	"github.com/google/uuid"
+)
+
+const (
+	maxEmbedDomains = 20
+	// embedMediaTTL is how long the media URL on an embed page works, which
+	// bounds how long a page can sit open before playback stops working.
+	embedMediaTTL = 6 * time.Hour
+
+	defaultEmbedWidth  = 640
+	defaultEmbedHeight = 360
+)
+
+type embedTokenResponse struct {
+	database.EmbedToken
+	EmbedURL string `json:"embed_url"`
+}
+
+// embedURL is the player page for an embed token. Pages under the video's
+// ID with ?token= are still served, for links handed out before tokens
+// could stand in for the ID.
+func (cfg *apiConfig) embedURL(token string) string {
+	return cfg.baseURL + "/embed/" + url.PathEscape(token)
+}
+
+// signEmbedMedia signs a media URL for the embed player, so the video is
+// streamed through us rather than handing out the object's own URL.
+func (cfg *apiConfig) signEmbedMedia(videoID uuid.UUID, expires int64) string {
+	mac := hmac.New(sha256.New, []byte(cfg.jwtSecret))
+	fmt.Fprintf(mac, "embed-media:%s:%d", videoID, expires)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// embedRequestAllowed refuses to play in frames on sites the token doesn't
+// allow. Pages opened directly in a browser, e.g. by clicking a link in
+// chat, aren't framed, so they're served whatever their Referer; the
+// frame-ancestors policy keeps other sites from framing those responses
+// anyway. Everything else needs a Referer on one of the token's domains.
+func embedRequestAllowed(r *http.Request, domains []string) bool {
+	if r.Header.Get("Sec-Fetch-Dest") == "document" {
+		return true
+	}
+	return embedRefererAllowed(r.Header.Get("Referer"), domains)
+}
+
+// embedRefererAllowed checks the page embedding the player against the
+// token's domains. Requests without a Referer are refused, since anyone
+// can leave it out.
+func embedRefererAllowed(referer string, domains []string) bool {
+	u, err := url.Parse(referer)
+	if err != nil {
+		return false
+	}
+	host := strings.ToLower(u.Hostname())
+	if host == "" {
+		return false
+	}
+	for _, domain := range domains {
+		if host == domain || strings.HasSuffix(host, "."+domain) {
+			return true
+		}
+	}
+	return false
+}
+
+func (cfg *apiConfig) handlerEmbedTokenCreate(w http.ResponseWriter, r *http.Request) {
+	type parameters struct {
+		AllowedDomains []string `json:"allowed_domains"`
+	}
+
+	videoID, err := uuid.Parse(r.PathValue("videoID"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid video ID", err)
+		return
+	}
+
+	token, err := auth.GetBearerToken(r.Header)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Couldn't find JWT", err)
+		return
+	}
+	userID, err := cfg.validateJWT(token)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Couldn't validate JWT", err)
+		return
+	}
+
+	decoder := json.NewDecoder(r.Body)
+	params := parameters{}
+	err = decoder.Decode(&params)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't decode parameters", err)
+		return
+	}
+
+	domains := make([]string, 0, len(params.AllowedDomains))
+	errs := validate.Errors{}
+	errs.Check(len(params.AllowedDomains) > 0, "allowed_domains", "must include at least one domain")
+	errs.Check(len(params.AllowedDomains) <= maxEmbedDomains, "allowed_domains", "has too many domains")
+	for _, domain := range params.AllowedDomains {
+		domain = strings.ToLower(strings.TrimSpace(domain))
+		errs.Check(validate.Hostname(domain), "allowed_domains", "must be domain names like example.com")
+		domains = append(domains, domain)
+	}
+	if errs.Err() != nil {
+		respondWithValidationErrors(w, errs)
+		return
+	}
+
+	video, err := cfg.db.GetVideo(videoID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get video", err)
+		return
+	}
+	if video.UserID != userID {
+		respondWithError(w, http.StatusNotFound, "Couldn't get video", nil)
+		return
+	}
+
+	embedToken, err := auth.MakeRefreshToken()
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't create embed token", err)
+		return
+	}
+	created, err := cfg.db.CreateEmbedToken(embedToken, database.CreateEmbedTokenParams{
+		VideoID:        videoID,
+		UserID:         userID,
+		AllowedDomains: domains,
+	})
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't create embed token", err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusCreated, embedTokenResponse{
+		EmbedToken: created,
+		EmbedURL:   cfg.embedURL(created.Token),
+	})
+}
+
+func (cfg *apiConfig) handlerEmbedTokensList(w http.ResponseWriter, r *http.Request) {
+	videoID, err := uuid.Parse(r.PathValue("videoID"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid video ID", err)
+		return
+	}
+
+	token, err := auth.GetBearerToken(r.Header)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Couldn't find JWT", err)
+		return
+	}
+	userID, err := cfg.validateJWT(token)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Couldn't validate JWT", err)
+		return
+	}
+
+	video, err := cfg.db.GetVideo(videoID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get video", err)
+		return
+	}
+	if video.UserID != userID {
+		respondWithError(w, http.StatusNotFound, "Couldn't get video", nil)
+		return
+	}
+
+	tokens, err := cfg.db.GetEmbedTokensForVideo(videoID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't retrieve embed tokens", err)
+		return
+	}
+
+	response := make([]embedTokenResponse, 0, len(tokens))
+	for _, t := range tokens {
+		response = append(response, embedTokenResponse{
+			EmbedToken: t,
+			EmbedURL:   cfg.embedURL(t.Token),
+		})
+	}
+	respondWithJSON(w, http.StatusOK, response)
+}
+
+func (cfg *apiConfig) handlerEmbedTokenDelete(w http.ResponseWriter, r *http.Request) {
+	videoID, err := uuid.Parse(r.PathValue("videoID"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid video ID", err)
+		return
+	}
+
+	token, err := auth.GetBearerToken(r.Header)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Couldn't find JWT", err)
+		return
+	}
+	userID, err := cfg.validateJWT(token)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Couldn't validate JWT", err)
+		return
+	}
+
+	video, err := cfg.db.GetVideo(videoID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get video", err)
+		return
+	}
+	if video.UserID != userID {
+		respondWithError(w, http.StatusNotFound, "Couldn't get video", nil)
+		return
+	}
+
+	err = cfg.db.DeleteEmbedToken(videoID, r.PathValue("token"))
+	if errors.Is(err, sql.ErrNoRows) {
+		respondWithError(w, http.StatusNotFound, "Couldn't find embed token", err)
+		return
+	}
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't delete embed token", err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// embedTarget is what an embed URL resolves to.
+type embedTarget struct {
+	token    database.EmbedToken
+	video    database.Video
+	artifact database.Artifact
+}
+
+// loadEmbedTarget looks up the video an embed token is for, responding and
+// returning false if the token doesn't grant access to it. id is the
+// token, or the video's ID with the token in token.
+func (cfg *apiConfig) loadEmbedTarget(w http.ResponseWriter, id, token string) (embedTarget, bool) {
+	videoID, err := uuid.Parse(id)
+	if err != nil {
+		token = id
+	}
+
+	embedToken, err := cfg.db.GetEmbedToken(token)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get embed token", err)
+		return embedTarget{}, false
+	}
+	if embedToken == nil || videoID != uuid.Nil && embedToken.VideoID != videoID {
+		respondWithError(w, http.StatusNotFound, "Couldn't find embed token", nil)
+		return embedTarget{}, false
+	}
+
+	video, artifact, ok := cfg.embedVideo(w, embedToken.VideoID)
+	if !ok {
+		return embedTarget{}, false
+	}
+	return embedTarget{token: *embedToken, video: video, artifact: artifact}, true
+}
+
+// embedVideo loads a video and the artifact embeds play, provided it's
+// available at all and published. That's the local encode, or for
+// transcoded videos their largest rendition, like the video's own URL.
+func (cfg *apiConfig) embedVideo(w http.ResponseWriter, videoID uuid.UUID) (database.Video, database.Artifact, bool) {
+	if !cfg.checkVideoAvailable(w, videoID) {
+		return database.Video{}, database.Artifact{}, false
+	}
+	video, err := cfg.db.GetVideo(videoID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get video", err)
+		return database.Video{}, database.Artifact{}, false
+	}
+	if msg := unpublishedMessage(video); msg != "" {
+		respondWithError(w, http.StatusGone, msg, nil)
+		return database.Video{}, database.Artifact{}, false
+	}
+	artifacts, err := cfg.db.GetArtifacts(videoID, database.ArtifactKindVideo)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get video artifacts", err)
+		return database.Video{}, database.Artifact{}, false
+	}
+	if len(artifacts) == 0 {
+		artifacts, err = cfg.db.GetArtifacts(videoID, database.ArtifactKindRendition)
+		if err != nil {
+			respondWithError(w, http.StatusInternalServerError, "Couldn't get video artifacts", err)
+			return database.Video{}, database.Artifact{}, false
+		}
+	}
+	if len(artifacts) == 0 {
+		respondWithError(w, http.StatusNotFound, "Video hasn't been uploaded yet", nil)
+		return database.Video{}, database.Artifact{}, false
+	}
+	return video, artifacts[0], true
+}
+
+var embedPlayerTemplate = template.Must(template.New("embed").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>{{.Title}}</title>
+<link rel="canonical" href="{{.PageURL}}">
+<link rel="alternate" type="application/json+oembed" href="{{.OEmbedURL}}" title="{{.Title}}">
+<meta property="og:site_name" content="Tubely">
+<meta property="og:type" content="video.other">
+<meta property="og:title" content="{{.Title}}">
+{{- if .Description}}
+<meta property="og:description" content="{{.Description}}">
+<meta name="description" content="{{.Description}}">
+{{- end}}
+<meta property="og:url" content="{{.PageURL}}">
+{{- if .PosterURL}}
+<meta property="og:image" content="{{.PosterURL}}">
+{{- end}}
+<meta property="og:video" content="{{.MediaURL}}">
+<meta property="og:video:secure_url" content="{{.MediaURL}}">
+<meta property="og:video:type" content="{{.MediaType}}">
+<meta property="og:video:width" content="{{.Width}}">
+<meta property="og:video:height" content="{{.Height}}">
+<meta name="twitter:card" content="player">
+<meta name="twitter:title" content="{{.Title}}">
+<meta name="twitter:player" content="{{.PageURL}}">
+<meta name="twitter:player:width" content="{{.Width}}">
+<meta name="twitter:player:height" content="{{.Height}}">
+{{- if .PosterURL}}
+<meta name="twitter:image" content="{{.PosterURL}}">
+{{- end}}
+<style>html,body{margin:0;height:100%;background:#000}video{display:block;width:100%;height:100%}</style>
+</head>
+<body>
+<video controls playsinline preload="metadata" src="{{.MediaURL}}"{{if .PosterURL}} poster="{{.PosterURL}}"{{end}}></video>
+</body>
+</html>
+`))
+
+// embedSize is the artifact's size, or the default for artifacts that
+// weren't probed.
+func embedSize(artifact database.Artifact) (width, height int) {
+	if artifact.Width <= 0 || artifact.Height <= 0 {
+		return defaultEmbedWidth, defaultEmbedHeight
+	}
+	return artifact.Width, artifact.Height
+}
+
+// handlerEmbedPlayer serves the player page third-party sites put in an
+// iframe. Its Open Graph, Twitter and oEmbed tags let chat apps and social
+// sites unfurl embed links pasted into them.
+func (cfg *apiConfig) handlerEmbedPlayer(w http.ResponseWriter, r *http.Request) {
+	target, ok := cfg.loadEmbedTarget(w, r.PathValue("id"), r.URL.Query().Get("token"))
+	if !ok {
+		return
+	}
+	if !embedRequestAllowed(r, target.token.AllowedDomains) {
+		respondWithError(w, http.StatusForbidden, "This video can't be embedded on this site", nil)
+		return
+	}
+	cfg.securityHeaders.embedFrameAncestors(w, target.token.AllowedDomains)
+
+	video := target.video
+	if !cfg.checkURLIssuance(w, r, video.ID.String()) {
+		return
+	}
+	err := cfg.db.RecordURLIssuance(video.UserID, video.SizeBytes)
+	if err != nil {
+		log.Printf("Couldn't record URL issuance for video %s: %v", video.ID, err)
+	}
+
+	expires := time.Now().Add(embedMediaTTL).Unix()
+	mediaType := mime.TypeByExtension(path.Ext(target.artifact.Key))
+	if mediaType == "" {
+		mediaType = "video/mp4"
+	}
+	data := struct {
+		Title       string
+		Description string
+		PageURL     string
+		MediaURL    string
+		MediaType   string
+		Width       int
+		Height      int
+		PosterURL   string
+		OEmbedURL   string
+	}{
+		Title:       video.Title,
+		Description: video.Description,
+		PageURL:     cfg.embedURL(target.token.Token),
+		MediaURL: fmt.Sprintf("%s/embed/%s/media?expires=%d&sig=%s",
+			cfg.baseURL, video.ID, expires, cfg.signEmbedMedia(video.ID, expires)),
+		MediaType: mediaType,
+		OEmbedURL: cfg.baseURL + "/oembed?url=" + url.QueryEscape(cfg.embedURL(target.token.Token)),
+	}
+	data.Width, data.Height = embedSize(target.artifact)
+	if video.ThumbnailURL != nil {
+		data.PosterURL = *video.ThumbnailURL
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	err = embedPlayerTemplate.Execute(w, data)
+	if err != nil {
+		log.Printf("Couldn't render embed player for video %s: %v", video.ID, err)
+	}
+}
+
+// handlerEmbedMedia streams the video for the embed player from a signed
+// URL, passing Range requests through so seeking works.
+func (cfg *apiConfig) handlerEmbedMedia(w http.ResponseWriter, r *http.Request) {
+	videoID, err := uuid.Parse(r.PathValue("videoID"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid video ID", err)
+		return
+	}
+	expires, err := strconv.ParseInt(r.URL.Query().Get("expires"), 10, 64)
+	if err != nil || time.Now().Unix() > expires {
+		respondWithError(w, http.StatusForbidden, "Invalid or expired token", err)
+		return
+	}
+	sig := r.URL.Query().Get("sig")
+	if !hmac.Equal([]byte(sig), []byte(cfg.signEmbedMedia(videoID, expires))) {
+		respondWithError(w, http.StatusForbidden, "Invalid or expired token", nil)
+		return
+	}
+
+	_, artifact, ok := cfg.embedVideo(w, videoID)
+	if !ok {
+		return
+	}
+
+	input := &s3.GetObjectInput{
+		Bucket: aws.String(cfg.s3Bucket),
+		Key:    aws.String(artifact.Key),
+	}
+	if rangeHeader := r.Header.Get("Range"); rangeHeader != "" {
+		input.Range = aws.String(rangeHeader)
+	}
+	object, err := cfg.s3Client.GetObject(r.Context(), input)
+	if err != nil {
+		respondWithError(w, http.StatusBadGateway, "Couldn't stream video", err)
+		return
+	}
+	defer object.Body.Close()
+
+	w.Header().Set("Content-Type", aws.ToString(object.ContentType))
+	w.Header().Set("Accept-Ranges", "bytes")
+	w.Header().Set("Cache-Control", "private, max-age=3600")
+	if object.ContentLength != nil {
+		w.Header().Set("Content-Length", strconv.FormatInt(*object.ContentLength, 10))
+	}
+	status := http.StatusOK
+	if object.ContentRange != nil {
+		w.Header().Set("Content-Range", *object.ContentRange)
+		status = http.StatusPartialContent
+	}
+	w.WriteHeader(status)
+	_, err = io.Copy(w, object.Body)
+	if err != nil {
+		log.Printf("Couldn't stream video %s to embed: %v", videoID, err)
+	}
+}
+
+// handlerOEmbed implements https://oembed.com for embed URLs, so sites that
+// support oEmbed can turn a pasted embed link into a player.
+func (cfg *apiConfig) handlerOEmbed(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	if format := query.Get("format"); format != "" && format != "json" {
+		respondWithError(w, http.StatusNotImplemented, "Only the json format is supported", nil)
+		return
+	}
+
+	embedLink, err := url.Parse(query.Get("url"))
+	if err != nil || !strings.HasPrefix(embedLink.String(), cfg.baseURL+"/embed/") {
+		respondWithError(w, http.StatusNotFound, "Not an embed URL", err)
+		return
+	}
+	target, ok := cfg.loadEmbedTarget(w, strings.TrimPrefix(embedLink.Path, "/embed/"), embedLink.Query().Get("token"))
+	if !ok {
+		return
+	}
+	video := target.video
+
+	width, height := embedSize(target.artifact)
+	if maxWidth, err := strconv.Atoi(query.Get("maxwidth")); err == nil && maxWidth > 0 && width > maxWidth {
+		height = height * maxWidth / width
+		width = maxWidth
+	}
+	if maxHeight, err := strconv.Atoi(query.Get("maxheight")); err == nil && maxHeight > 0 && height > maxHeight {
+		width = width * maxHeight / height
+		height = maxHeight
+	}
+
+	type oEmbed struct {
+		Version      string `json:"version"`
+		Type         string `json:"type"`
+		ProviderName string `json:"provider_name"`
+		ProviderURL  string `json:"provider_url"`
+		Title        string `json:"title"`
+		HTML         string `json:"html"`
+		Width        int    `json:"width"`
+		Height       int    `json:"height"`
+		ThumbnailURL string `json:"thumbnail_url,omitempty"`
+	}
+	response := oEmbed{
+		Version:      "1.0",
+		Type:         "video",
+		ProviderName: "Tubely",
+		ProviderURL:  cfg.baseURL,
+		Title:        video.Title,
+		HTML: fmt.Sprintf(`<iframe src="%s" width="%d" height="%d" frameborder="0" allow="fullscreen; picture-in-picture" allowfullscreen></iframe>`,
+			template.HTMLEscapeString(cfg.embedURL(target.token.Token)), width, height),
+		Width:  width,
+		Height: height,
+	}
+	if video.ThumbnailURL != nil {
+		response.ThumbnailURL = *video.ThumbnailURL
+	}
+	respondWithJSON(w, http.StatusOK, response)
+}
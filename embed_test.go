@@ -0,0 +1,38 @@
+package main
+
+import (
+	"net/http/httptest"
+	"testing"
+)
+
+func TestEmbedRequestAllowed(t *testing.T) {
+	domains := []string{"example.com"}
+	tests := []struct {
+		name    string
+		dest    string
+		referer string
+		want    bool
+	}{
+		{name: "opened directly", dest: "document", want: true},
+		{name: "framed on an allowed domain", dest: "iframe", referer: "https://blog.example.com/post", want: true},
+		{name: "framed elsewhere", dest: "iframe", referer: "https://evil.test/", want: false},
+		{name: "framed without a referer", dest: "iframe", want: false},
+		{name: "non-browser client with a referer", referer: "https://example.com/", want: true},
+		{name: "non-browser client without a referer", want: false},
+		{name: "lookalike domain", referer: "https://notexample.com/", want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest("GET", "/embed/token", nil)
+			if tt.dest != "" {
+				r.Header.Set("Sec-Fetch-Dest", tt.dest)
+			}
+			if tt.referer != "" {
+				r.Header.Set("Referer", tt.referer)
+			}
+			if got := embedRequestAllowed(r, domains); got != tt.want {
+				t.Errorf("embedRequestAllowed = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,144 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/smithy-go"
+	"github.com/aws/smithy-go/middleware"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/errreport"
+)
+
+// maxReportedStderr is how much of a media tool's stderr goes into a report,
+// counted from the end where the actual error is.
+const maxReportedStderr = 8 << 10
+
+// mediaToolError is a failed ffmpeg or ffprobe run, with its stderr kept
+// separately so the error tracker can show it in full.
+type mediaToolError struct {
+	tool   string
+	stderr string
+	err    error
+}
+
+func (e *mediaToolError) Error() string {
+	return fmt.Sprintf("%s error: %s\nCommand failed with: %v", e.tool, e.stderr, e.err)
+}
+
+func (e *mediaToolError) Unwrap() error {
+	return e.err
+}
+
+// s3ObjectError records the bucket and key an S3 call failed on, which the
+// SDK's own errors leave out.
+type s3ObjectError struct {
+	bucket string
+	key    string
+	err    error
+}
+
+func (e *s3ObjectError) Error() string {
+	return e.err.Error()
+}
+
+func (e *s3ObjectError) Unwrap() error {
+	return e.err
+}
+
+// tagS3Errors is an S3 client option that wraps every failed call in an
+// s3ObjectError.
+func tagS3Errors(o *s3.Options) {
+	o.APIOptions = append(o.APIOptions, func(stack *middleware.Stack) error {
+		return stack.Initialize.Add(middleware.InitializeMiddlewareFunc("TagS3Errors",
+			func(ctx context.Context, in middleware.InitializeInput, next middleware.InitializeHandler) (middleware.InitializeOutput, middleware.Metadata, error) {
+				out, metadata, err := next.HandleInitialize(ctx, in)
+				if err != nil {
+					bucket, key := s3ObjectOf(in.Parameters)
+					err = &s3ObjectError{bucket: bucket, key: key, err: err}
+				}
+				return out, metadata, err
+			}), middleware.After)
+	})
+}
+
+// s3ObjectOf returns the bucket and key, or prefix for listings, of the
+// calls the app makes.
+func s3ObjectOf(params any) (bucket, key string) {
+	switch p := params.(type) {
+	case *s3.PutObjectInput:
+		return aws.ToString(p.Bucket), aws.ToString(p.Key)
+	case *s3.GetObjectInput:
+		return aws.ToString(p.Bucket), aws.ToString(p.Key)
+	case *s3.HeadObjectInput:
+		return aws.ToString(p.Bucket), aws.ToString(p.Key)
+	case *s3.DeleteObjectInput:
+		return aws.ToString(p.Bucket), aws.ToString(p.Key)
+	case *s3.CopyObjectInput:
+		return aws.ToString(p.Bucket), aws.ToString(p.Key)
+	case *s3.DeleteObjectsInput:
+		return aws.ToString(p.Bucket), ""
+	case *s3.ListObjectsV2Input:
+		return aws.ToString(p.Bucket), aws.ToString(p.Prefix)
+	}
+	return "", ""
+}
+
+// errorEvent builds a report for err, tagging it with whatever the errors
+// it wraps know about the failure.
+func errorEvent(msg string, err error) errreport.Event {
+	event := errreport.Event{
+		Level:   errreport.LevelError,
+		Message: msg,
+		Err:     err,
+		Tags:    map[string]string{},
+		Extra:   map[string]string{},
+	}
+	var toolErr *mediaToolError
+	if errors.As(err, &toolErr) {
+		event.Tags["media_tool"] = toolErr.tool
+		stderr := toolErr.stderr
+		if len(stderr) > maxReportedStderr {
+			stderr = stderr[len(stderr)-maxReportedStderr:]
+		}
+		event.Extra["stderr"] = stderr
+	}
+	var objectErr *s3ObjectError
+	if errors.As(err, &objectErr) {
+		event.Tags["s3_bucket"] = objectErr.bucket
+		event.Tags["s3_key"] = objectErr.key
+	}
+	var opErr *smithy.OperationError
+	if errors.As(err, &opErr) {
+		event.Tags["aws_operation"] = opErr.Operation()
+	}
+	var apiErr smithy.APIError
+	if errors.As(err, &apiErr) {
+		event.Tags["aws_error_code"] = apiErr.ErrorCode()
+	}
+	return event
+}
+
+// reportResponseError reports a 5XX response sent with respondWithError.
+// The request it belongs to is found through the recovery middleware's
+// writer, which is skipped for responses written outside of it.
+func reportResponseError(w http.ResponseWriter, msg string, err error) {
+	for {
+		if rw, ok := w.(*recoveryWriter); ok {
+			event := errorEvent(msg, err)
+			event.RequestID = requestID(rw.request)
+			event.Method = rw.request.Method
+			event.URL = rw.request.URL.Path
+			rw.cfg.reportError(event)
+			return
+		}
+		unwrapper, ok := w.(interface{ Unwrap() http.ResponseWriter })
+		if !ok {
+			return
+		}
+		w = unwrapper.Unwrap()
+	}
+}
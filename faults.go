@@ -0,0 +1,123 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/smithy-go/middleware"
+)
+
+// errInjectedFault is the error injected calls fail with.
+var errInjectedFault = errors.New("injected fault")
+
+// faultRule fails or delays a share of calls at random, so retries and
+// cleanup can be exercised in testing. The zero rule injects nothing.
+type faultRule struct {
+	failRate  float64
+	delayRate float64
+	maxDelay  time.Duration
+}
+
+// mediaFaults is the rule for ffmpeg and ffprobe runs, which happen outside
+// of any handler that could carry it.
+var mediaFaults faultRule
+
+// parseFaultRule reads a rule like "fail=0.05,delay=0.2,max_delay=2s":
+// 5% of calls fail and 20% wait up to 2 seconds first.
+func parseFaultRule(s string) (faultRule, error) {
+	rule := faultRule{maxDelay: time.Second}
+	for _, pair := range strings.Split(s, ",") {
+		name, value, _ := strings.Cut(strings.TrimSpace(pair), "=")
+		var err error
+		switch name {
+		case "fail":
+			rule.failRate, err = strconv.ParseFloat(value, 64)
+		case "delay":
+			rule.delayRate, err = strconv.ParseFloat(value, 64)
+		case "max_delay":
+			rule.maxDelay, err = time.ParseDuration(value)
+		default:
+			return faultRule{}, fmt.Errorf("unknown fault setting %q", name)
+		}
+		if err != nil {
+			return faultRule{}, fmt.Errorf("invalid fault setting %q: %w", pair, err)
+		}
+	}
+	if rule.failRate < 0 || rule.failRate > 1 || rule.delayRate < 0 || rule.delayRate > 1 {
+		return faultRule{}, errors.New("fault rates must be between 0 and 1")
+	}
+	return rule, nil
+}
+
+func (r faultRule) String() string {
+	return fmt.Sprintf("%g%% failed, %g%% delayed up to %s", r.failRate*100, r.delayRate*100, r.maxDelay)
+}
+
+// inject delays and fails the call named op as the rule says.
+func (r faultRule) inject(ctx context.Context, op string) error {
+	if r.delayRate > 0 && rand.Float64() < r.delayRate {
+		t := time.NewTimer(rand.N(r.maxDelay + 1))
+		select {
+		case <-t.C:
+		case <-ctx.Done():
+			t.Stop()
+			return ctx.Err()
+		}
+	}
+	if r.failRate > 0 && rand.Float64() < r.failRate {
+		return fmt.Errorf("%w: %s", errInjectedFault, op)
+	}
+	return nil
+}
+
+// faultRulesFromEnv reads FAULT_INJECTION_S3 and FAULT_INJECTION_MEDIA.
+func faultRulesFromEnv() (s3Rule, mediaRule faultRule, err error) {
+	if v := os.Getenv("FAULT_INJECTION_S3"); v != "" {
+		if s3Rule, err = parseFaultRule(v); err != nil {
+			return faultRule{}, faultRule{}, fmt.Errorf("FAULT_INJECTION_S3: %w", err)
+		}
+	}
+	if v := os.Getenv("FAULT_INJECTION_MEDIA"); v != "" {
+		if mediaRule, err = parseFaultRule(v); err != nil {
+			return faultRule{}, faultRule{}, fmt.Errorf("FAULT_INJECTION_MEDIA: %w", err)
+		}
+	}
+	return s3Rule, mediaRule, nil
+}
+
+// injectS3Faults is an S3 client option that applies rule to every call.
+// Faults are injected ahead of the SDK's retries, so they reach the app
+// like an outage that outlasted them.
+func injectS3Faults(rule faultRule) func(*s3.Options) {
+	return func(o *s3.Options) {
+		if rule == (faultRule{}) {
+			return
+		}
+		o.APIOptions = append(o.APIOptions, func(stack *middleware.Stack) error {
+			return stack.Initialize.Add(middleware.InitializeMiddlewareFunc("InjectFaults",
+				func(ctx context.Context, in middleware.InitializeInput, next middleware.InitializeHandler) (middleware.InitializeOutput, middleware.Metadata, error) {
+					if err := rule.inject(ctx, "S3 "+middleware.GetOperationName(ctx)); err != nil {
+						return middleware.InitializeOutput{}, middleware.Metadata{}, err
+					}
+					return next.HandleInitialize(ctx, in)
+				}), middleware.After)
+		})
+	}
+}
+
+// runMediaTool runs an ffmpeg or ffprobe command, subject to mediaFaults.
+func runMediaTool(cmd *exec.Cmd) error {
+	if err := mediaFaults.inject(context.Background(), filepath.Base(cmd.Path)); err != nil {
+		return err
+	}
+	return cmd.Run()
+}
@@ -0,0 +1,210 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/auth"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/validate"
+	"github.com/google/uuid"
+)
+
+const (
+	featureCloudTranscoding = "cloud_transcoding"
+	featureHLS              = "hls"
+	featureTranscription    = "transcription"
+	featureLiveIngest       = "live_ingest"
+	featureStreamingEncode  = "streaming_encode"
+
+	auditEventFeatureFlagChanged = "feature_flag_changed"
+)
+
+type featureDefinition struct {
+	Description string `json:"description"`
+	// Default applies until an admin sets the flag.
+	Default bool `json:"default"`
+}
+
+// features lists every flag handlers may consult. Only these can be set
+// through the admin API, so a typo can't create a flag nothing reads.
+var features = map[string]featureDefinition{
+	featureCloudTranscoding: {"Send uploads to the configured cloud transcoder instead of processing them with ffmpeg", true},
+	featureHLS:              {"Package renditions for HLS adaptive streaming", false},
+	featureTranscription:    {"Generate captions from the audio track", false},
+	featureLiveIngest:       {"Accept live streams", false},
+	featureStreamingEncode:  {"Upload the encode as fragmented MP4 while ffmpeg writes it, instead of writing a fast start MP4 to disk first", false},
+}
+
+// featureFlagCacheTTL bounds how long other instances keep serving a flag
+// after an admin changes it. The instance handling the change sees it
+// straight away.
+const featureFlagCacheTTL = 30 * time.Second
+
+type featureFlagCache struct {
+	mu       sync.Mutex
+	flags    map[string]database.FeatureFlag
+	loadedAt time.Time
+}
+
+func (c *featureFlagCache) get(db database.Client) (map[string]database.FeatureFlag, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.flags != nil && time.Since(c.loadedAt) < featureFlagCacheTTL {
+		return c.flags, nil
+	}
+	flags, err := db.GetFeatureFlags()
+	if err != nil {
+		return nil, err
+	}
+	c.flags = make(map[string]database.FeatureFlag, len(flags))
+	for _, f := range flags {
+		c.flags[f.Name] = f
+	}
+	c.loadedAt = time.Now()
+	return c.flags, nil
+}
+
+func (c *featureFlagCache) invalidate() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.flags = nil
+}
+
+// featureEnabled reports whether userID gets the feature. If the flags
+// can't be loaded the feature is off, unless it's on by default.
+func (cfg *apiConfig) featureEnabled(name string, userID uuid.UUID) bool {
+	flags, err := cfg.featureFlags.get(cfg.db)
+	if err != nil {
+		log.Printf("Couldn't load feature flags: %v", err)
+		return features[name].Default
+	}
+	flag, ok := flags[name]
+	if !ok {
+		return features[name].Default
+	}
+	return flag.EnabledFor(userID)
+}
+
+// handlerFeaturesGet tells the frontend which features to show.
+func (cfg *apiConfig) handlerFeaturesGet(w http.ResponseWriter, r *http.Request) {
+	token, err := auth.GetBearerToken(r.Header)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Couldn't find JWT", err)
+		return
+	}
+	userID, err := cfg.validateJWT(token)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Couldn't validate JWT", err)
+		return
+	}
+
+	enabled := map[string]bool{}
+	for name := range features {
+		enabled[name] = cfg.featureEnabled(name, userID)
+	}
+	respondWithJSON(w, http.StatusOK, enabled)
+}
+
+func (cfg *apiConfig) handlerAdminFeatureFlagsList(w http.ResponseWriter, r *http.Request) {
+	type response struct {
+		Name string `json:"name"`
+		featureDefinition
+		// Flag is nil while the feature is on its default.
+		Flag *database.FeatureFlag `json:"flag"`
+	}
+
+	flags, err := cfg.db.GetFeatureFlags()
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get feature flags", err)
+		return
+	}
+	set := map[string]database.FeatureFlag{}
+	for _, f := range flags {
+		set[f.Name] = f
+	}
+
+	resp := []response{}
+	for name, def := range features {
+		item := response{featureDefinition: def, Name: name}
+		if f, ok := set[name]; ok {
+			item.Flag = &f
+		}
+		resp = append(resp, item)
+	}
+	sort.Slice(resp, func(i, j int) bool { return resp[i].Name < resp[j].Name })
+	respondWithJSON(w, http.StatusOK, resp)
+}
+
+func (cfg *apiConfig) handlerAdminFeatureFlagSet(w http.ResponseWriter, r *http.Request) {
+	type parameters struct {
+		database.SetFeatureFlagParams
+	}
+
+	name := r.PathValue("name")
+	if _, ok := features[name]; !ok {
+		respondWithError(w, http.StatusNotFound, "Unknown feature", nil)
+		return
+	}
+
+	token, err := auth.GetBearerToken(r.Header)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Couldn't find JWT", err)
+		return
+	}
+	adminID, err := cfg.validateJWT(token)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Couldn't validate JWT", err)
+		return
+	}
+
+	decoder := json.NewDecoder(r.Body)
+	params := parameters{}
+	err = decoder.Decode(&params)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't decode parameters", err)
+		return
+	}
+
+	errs := validate.Errors{}
+	errs.Check(params.RolloutPercent >= 0 && params.RolloutPercent <= 100, "rollout_percent", "must be between 0 and 100")
+	if errs.Err() != nil {
+		respondWithValidationErrors(w, errs)
+		return
+	}
+
+	err = cfg.db.SetFeatureFlag(name, params.SetFeatureFlagParams)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't set feature flag", err)
+		return
+	}
+	cfg.featureFlags.invalidate()
+	cfg.recordAuditEvent(r, auditEventFeatureFlagChanged, &adminID, "", fmt.Sprintf("flag=%s enabled=%t rollout_percent=%d users=%d",
+		name, params.Enabled, params.RolloutPercent, len(params.UserIDs)))
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handlerAdminFeatureFlagDelete puts the feature back on its default.
+func (cfg *apiConfig) handlerAdminFeatureFlagDelete(w http.ResponseWriter, r *http.Request) {
+	name := r.PathValue("name")
+	if _, ok := features[name]; !ok {
+		respondWithError(w, http.StatusNotFound, "Unknown feature", nil)
+		return
+	}
+
+	err := cfg.db.DeleteFeatureFlag(name)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't delete feature flag", err)
+		return
+	}
+	cfg.featureFlags.invalidate()
+	cfg.recordAuditEvent(r, auditEventFeatureFlagChanged, nil, "", fmt.Sprintf("flag=%s reset to default", name))
+
+	w.WriteHeader(http.StatusNoContent)
+}
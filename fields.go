@@ -0,0 +1,73 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"slices"
+	"strings"
+)
+
+// videoFields are the top-level fields of a video in list responses, which
+// ?fields= can pick from.
+var videoFields = []string{
+	"id", "created_at", "updated_at", "published_at", "title", "description",
+	"thumbnail_url", "video_url", "size_bytes", "user_id", "password_protected",
+	"expires_at", "purge_on_expiry", "unpublished_at", "downloads_enabled",
+	"tags", "metadata", "urls", "renditions",
+}
+
+// fieldSet is nil when every field was asked for.
+type fieldSet map[string]bool
+
+// has reports whether any of names was asked for.
+func (f fieldSet) has(names ...string) bool {
+	if f == nil {
+		return true
+	}
+	for _, name := range names {
+		if f[name] {
+			return true
+		}
+	}
+	return false
+}
+
+// parseFields reads ?fields=id,title,... and rejects names not in allowed.
+func parseFields(w http.ResponseWriter, r *http.Request, allowed []string) (fieldSet, bool) {
+	param := r.URL.Query().Get("fields")
+	if param == "" {
+		return nil, true
+	}
+	fields := fieldSet{}
+	for _, name := range strings.Split(param, ",") {
+		name = strings.TrimSpace(name)
+		if !slices.Contains(allowed, name) {
+			respondWithErrorf(w, http.StatusBadRequest, nil, "Unknown field %q", name)
+			return nil, false
+		}
+		fields[name] = true
+	}
+	return fields, true
+}
+
+// selectFields trims v, which must marshal to a JSON object, down to fields.
+func selectFields(v any, fields fieldSet) (any, error) {
+	if fields == nil {
+		return v, nil
+	}
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	all := map[string]json.RawMessage{}
+	if err := json.Unmarshal(data, &all); err != nil {
+		return nil, err
+	}
+	selected := make(map[string]json.RawMessage, len(fields))
+	for name := range fields {
+		if value, ok := all[name]; ok {
+			selected[name] = value
+		}
+	}
+	return selected, nil
+}
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"errors"
+	"io"
+	"io/fs"
+	"mime/multipart"
+	"net/http"
+)
+
+// respondWithFormError responds to a request whose multipart form couldn't
+// be read. Nearly every failure is the client's: a body that isn't
+// multipart or has no boundary, one that was cut off, one over the size
+// limit or one without the expected file. Only failing to buffer the form
+// on disk is the server's.
+func respondWithFormError(w http.ResponseWriter, err error) {
+	respondWithUploadError(w, formError(err))
+}
+
+// formError is how respondWithFormError responds to err, for failures that
+// surface while the form is still being read, like those of an upload
+// streamed to the bucket.
+func formError(err error) *uploadError {
+	var maxBytesErr *http.MaxBytesError
+	var pathErr *fs.PathError
+	switch {
+	case errors.As(err, &maxBytesErr), errors.Is(err, multipart.ErrMessageTooLarge):
+		return &uploadError{status: http.StatusRequestEntityTooLarge, format: "Request body is too large", err: err}
+	case errors.Is(err, http.ErrNotMultipart), errors.Is(err, http.ErrMissingBoundary):
+		return &uploadError{status: http.StatusBadRequest, format: "Request isn't a multipart form", err: err}
+	case errors.Is(err, io.ErrUnexpectedEOF), errors.Is(err, io.EOF):
+		// A body that ends in the middle of a part, including when the
+		// client disconnects mid-upload. One cut off before a part's
+		// headers end fails with a wrapped io.EOF.
+		return &uploadError{status: http.StatusBadRequest, format: "Request body was cut off", err: err}
+	case errors.Is(err, http.ErrMissingFile):
+		return &uploadError{status: http.StatusBadRequest, format: "Couldn't parse form file", err: err}
+	case errors.As(err, &pathErr):
+		return &uploadError{status: http.StatusInternalServerError, format: "Couldn't parse form data", err: err}
+	default:
+		return &uploadError{status: http.StatusBadRequest, format: "Couldn't parse multipart form", err: err}
+	}
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// multipartBody returns a form with a file part named field, and its
+// Content-Type.
+func multipartBody(t *testing.T, field string, size int) ([]byte, string) {
+	t.Helper()
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+	part, err := mw.CreateFormFile(field, "file.bin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	part.Write(bytes.Repeat([]byte{0}, size))
+	mw.Close()
+	return body.Bytes(), mw.FormDataContentType()
+}
+
+// videoFormHandler reads the form like handlerUploadVideo, up to the end
+// of the video part, without a database behind it.
+func videoFormHandler(limit int64) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		r.Body = http.MaxBytesReader(w, r.Body, limit)
+		form, err := readVideoForm(r)
+		if err != nil {
+			respondWithFormError(w, err)
+			return
+		}
+		if _, err := io.Copy(io.Discard, form.video); err != nil {
+			respondWithUploadError(w, formError(err))
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}
+}
+
+func TestFormErrors(t *testing.T) {
+	cfg := newTestConfig(t)
+	video, token := newTestVideo(t, cfg)
+
+	thumbnail, thumbnailType := multipartBody(t, "thumbnail", 1024)
+	videoBody, videoType := multipartBody(t, "video", 1024)
+	bigVideo, _ := multipartBody(t, "video", 8192)
+	other, otherType := multipartBody(t, "other", 1024)
+
+	tests := []struct {
+		name        string
+		handler     http.HandlerFunc
+		body        []byte
+		contentType string
+		wantStatus  int
+		wantCode    string
+	}{
+		{"thumbnail truncated", cfg.handlerUploadThumbnail, thumbnail[:len(thumbnail)/2], thumbnailType, http.StatusBadRequest, "truncated_body"},
+		{"thumbnail truncated in headers", cfg.handlerUploadThumbnail, thumbnail[:50], thumbnailType, http.StatusBadRequest, "truncated_body"},
+		{"thumbnail missing boundary", cfg.handlerUploadThumbnail, thumbnail, "multipart/form-data", http.StatusBadRequest, "not_multipart"},
+		{"thumbnail not multipart", cfg.handlerUploadThumbnail, thumbnail, "application/json", http.StatusBadRequest, "not_multipart"},
+		{"thumbnail missing file", cfg.handlerUploadThumbnail, other, otherType, http.StatusBadRequest, "missing_file"},
+		{"video truncated", videoFormHandler(4096), videoBody[:len(videoBody)/2], videoType, http.StatusBadRequest, "truncated_body"},
+		{"video truncated in headers", videoFormHandler(4096), videoBody[:50], videoType, http.StatusBadRequest, "truncated_body"},
+		{"video oversize", videoFormHandler(4096), bigVideo, videoType, http.StatusRequestEntityTooLarge, "body_too_large"},
+		{"video missing boundary", videoFormHandler(4096), videoBody, "multipart/form-data", http.StatusBadRequest, "not_multipart"},
+		{"video missing file", videoFormHandler(4096), other, otherType, http.StatusBadRequest, "missing_file"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/api/upload/"+video.ID.String(), bytes.NewReader(tt.body))
+			req.SetPathValue("videoID", video.ID.String())
+			req.Header.Set("Content-Type", tt.contentType)
+			req.Header.Set("Authorization", "Bearer "+token)
+			rec := httptest.NewRecorder()
+			tt.handler(rec, req)
+
+			if rec.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d, body %s", rec.Code, tt.wantStatus, strings.TrimSpace(rec.Body.String()))
+			}
+			var resp struct {
+				Code string `json:"code"`
+			}
+			if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+				t.Fatalf("couldn't decode %q: %v", rec.Body.String(), err)
+			}
+			if resp.Code != tt.wantCode {
+				t.Errorf("code = %q, want %q", resp.Code, tt.wantCode)
+			}
+		})
+	}
+}
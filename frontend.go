@@ -0,0 +1,98 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"embed"
+	"encoding/hex"
+	"io/fs"
+	"mime"
+	"net/http"
+	"path"
+	"strings"
+	"time"
+)
+
+// embeddedApp is the frontend built into the binary, so a deployment is the
+// executable alone. FILEPATH_ROOT points at a directory to use instead.
+//
+//go:embed app
+var embeddedApp embed.FS
+
+// frontend serves the single page app. Assets are served under names with
+// a content hash, e.g. app.3f2a9c1d.js, which index.html is rewritten to
+// use, so they can be cached forever while index.html is always revalidated.
+type frontend struct {
+	index   []byte
+	assets  map[string][]byte
+	hashed  map[string]string
+	startup time.Time
+}
+
+// newFrontend loads the app from files. prefix is the path it's served
+// under, which index.html links assets by so they resolve from any
+// client-side route.
+func newFrontend(files fs.FS, prefix string) (*frontend, error) {
+	f := &frontend{
+		assets:  map[string][]byte{},
+		hashed:  map[string]string{},
+		startup: time.Now(),
+	}
+	err := fs.WalkDir(files, ".", func(name string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		data, err := fs.ReadFile(files, name)
+		if err != nil {
+			return err
+		}
+		if name == "index.html" {
+			f.index = data
+			return nil
+		}
+		f.assets[name] = data
+		sum := sha256.Sum256(data)
+		ext := path.Ext(name)
+		f.hashed[strings.TrimSuffix(name, ext)+"."+hex.EncodeToString(sum[:4])+ext] = name
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	for hashedName, name := range f.hashed {
+		f.index = bytes.ReplaceAll(f.index, []byte(`="`+name+`"`), []byte(`="`+prefix+hashedName+`"`))
+	}
+	return f, nil
+}
+
+func (f *frontend) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	name := strings.TrimPrefix(path.Clean("/"+r.URL.Path), "/")
+
+	if original, ok := f.hashed[name]; ok {
+		w.Header().Set("Cache-Control", immutableCacheControl)
+		f.serve(w, r, original, f.assets[original])
+		return
+	}
+	// Unhashed names still work for pages loaded before a deploy.
+	if data, ok := f.assets[name]; ok {
+		w.Header().Set("Cache-Control", "no-cache")
+		f.serve(w, r, name, data)
+		return
+	}
+	if path.Ext(name) != "" && name != "index.html" {
+		http.NotFound(w, r)
+		return
+	}
+
+	// Anything else is a client-side route.
+	w.Header().Set("Cache-Control", "no-cache")
+	f.serve(w, r, "index.html", f.index)
+}
+
+func (f *frontend) serve(w http.ResponseWriter, r *http.Request, name string, data []byte) {
+	if contentType := mime.TypeByExtension(path.Ext(name)); contentType != "" {
+		w.Header().Set("Content-Type", contentType)
+	}
+	http.ServeContent(w, r, name, f.startup, bytes.NewReader(data))
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"net/http"
+	"time"
+)
+
+const dbBackupPrefix = "backups/db/"
+
+func (cfg *apiConfig) handlerAdminBackupCreate(w http.ResponseWriter, r *http.Request) {
+	type response struct {
+		Key string `json:"key"`
+	}
+
+	if cfg.backupStore == nil {
+		respondWithError(w, http.StatusNotFound, "Database backups are not configured", nil)
+		return
+	}
+
+	key, err := uploadDBSnapshot(r.Context(), cfg.db, cfg.backupStore, dbBackupPrefix)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't back up database", err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusCreated, response{Key: key})
+}
+
+func (cfg *apiConfig) handlerAdminBackupsList(w http.ResponseWriter, r *http.Request) {
+	type backup struct {
+		Key       string    `json:"key"`
+		SizeBytes int64     `json:"size_bytes"`
+		CreatedAt time.Time `json:"created_at"`
+	}
+
+	if cfg.backupStore == nil {
+		respondWithError(w, http.StatusNotFound, "Database backups are not configured", nil)
+		return
+	}
+
+	objects, err := cfg.backupStore.List(r.Context(), dbBackupPrefix)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't list backups", err)
+		return
+	}
+
+	backups := make([]backup, 0, len(objects))
+	for _, obj := range objects {
+		backups = append(backups, backup{
+			Key:       obj.Key,
+			SizeBytes: obj.Size,
+			CreatedAt: obj.LastModified,
+		})
+	}
+
+	respondWithJSON(w, http.StatusOK, backups)
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/costs"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+)
+
+func (cfg *apiConfig) handlerAdminCosts(w http.ResponseWriter, r *http.Request) {
+	type response struct {
+		costs.Estimate
+		// EgressSource tells whether egress came from access logs or was
+		// estimated from issued URLs.
+		EgressSource string `json:"egress_source"`
+	}
+
+	now := time.Now().UTC()
+	monthStart := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC)
+
+	storage := map[string]costs.StorageClassUsage{}
+	var putRequests int64
+	paginator := s3.NewListObjectsV2Paginator(cfg.s3Client, &s3.ListObjectsV2Input{
+		Bucket: aws.String(cfg.s3Bucket),
+	})
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(r.Context())
+		if err != nil {
+			respondWithError(w, http.StatusBadGateway, "Couldn't list bucket objects", err)
+			return
+		}
+		for _, obj := range page.Contents {
+			class := string(obj.StorageClass)
+			if class == "" {
+				class = "STANDARD"
+			}
+			usage := storage[class]
+			usage.Objects++
+			usage.Bytes += aws.ToInt64(obj.Size)
+			storage[class] = usage
+
+			// Each object written this month cost at least one PUT.
+			if obj.LastModified != nil && !obj.LastModified.Before(monthStart) {
+				putRequests++
+			}
+		}
+	}
+
+	totals, err := cfg.db.GetMonthTotals(database.UsageMonth(now))
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get usage totals", err)
+		return
+	}
+
+	egressSource := "measured"
+	egressBytes, getRequests := totals.EgressBytesMeasured, totals.DeliveryRequests
+	if totals.DeliveryRequests == 0 {
+		egressSource = "estimated"
+		egressBytes, getRequests = totals.EgressBytesEstimated, totals.URLIssuances
+	}
+
+	estimate := costs.Calculate(costs.Inputs{
+		Now:            now,
+		Storage:        storage,
+		GetRequests:    getRequests,
+		PutRequests:    putRequests,
+		EgressBytes:    egressBytes,
+		TranscodingUSD: totals.TranscodingCostUSD,
+	})
+
+	respondWithJSON(w, http.StatusOK, response{
+		Estimate:     estimate,
+		EgressSource: egressSource,
+	})
+}
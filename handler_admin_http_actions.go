@@ -0,0 +1,144 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/notify"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/validate"
+	"github.com/google/uuid"
+)
+
+func (cfg *apiConfig) handlerHTTPActionsList(w http.ResponseWriter, r *http.Request) {
+	actions, err := cfg.db.GetHTTPActions()
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't retrieve HTTP actions", err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, actions)
+}
+
+func (cfg *apiConfig) handlerHTTPActionCreate(w http.ResponseWriter, r *http.Request) {
+	decoder := json.NewDecoder(r.Body)
+	params := database.CreateHTTPActionParams{}
+	err := decoder.Decode(&params)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Couldn't decode parameters", err)
+		return
+	}
+	params.Method = strings.ToUpper(params.Method)
+	if params.Method == "" {
+		params.Method = http.MethodPost
+	}
+
+	errs := validate.Errors{}
+	validateHTTPAction(errs, params)
+	if errs.Err() != nil {
+		respondWithValidationErrors(w, errs)
+		return
+	}
+
+	action, err := cfg.db.CreateHTTPAction(params)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't create HTTP action", err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusCreated, action)
+}
+
+func (cfg *apiConfig) handlerHTTPActionDelete(w http.ResponseWriter, r *http.Request) {
+	actionID, err := uuid.Parse(r.PathValue("actionID"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid ID", err)
+		return
+	}
+
+	err = cfg.db.DeleteHTTPAction(actionID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't delete HTTP action", err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handlerHTTPActionTest sends an action synchronously with sample data, or
+// the "event" and "data" of the body, so admins can see the rendered request
+// and delivery errors straight away.
+func (cfg *apiConfig) handlerHTTPActionTest(w http.ResponseWriter, r *http.Request) {
+	type parameters struct {
+		Event notify.Event   `json:"event"`
+		Data  map[string]any `json:"data"`
+	}
+	type result struct {
+		Method string `json:"method,omitempty"`
+		URL    string `json:"url,omitempty"`
+		Body   string `json:"body,omitempty"`
+		Error  string `json:"error,omitempty"`
+	}
+
+	actionID, err := uuid.Parse(r.PathValue("actionID"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid ID", err)
+		return
+	}
+	params := parameters{}
+	if err := json.NewDecoder(r.Body).Decode(&params); err != nil && !errors.Is(err, io.EOF) {
+		respondWithError(w, http.StatusBadRequest, "Couldn't decode parameters", err)
+		return
+	}
+
+	actions, err := cfg.db.GetHTTPActions()
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't retrieve HTTP actions", err)
+		return
+	}
+	var action *database.HTTPAction
+	for i := range actions {
+		if actions[i].ID == actionID {
+			action = &actions[i]
+		}
+	}
+	if action == nil {
+		respondWithError(w, http.StatusNotFound, "Couldn't find HTTP action", nil)
+		return
+	}
+
+	if params.Event == "" && len(action.Events) > 0 {
+		params.Event = notify.Event(action.Events[0])
+	}
+	msg := sampleHTTPActionMessage(params.Event)
+	if params.Data != nil {
+		msg.Data = params.Data
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), notifyTimeout)
+	defer cancel()
+
+	res := result{}
+	notifier, err := notify.ParseHTTPAction(action.Method, action.URL, action.Headers, action.Body)
+	if err == nil {
+		var req *http.Request
+		req, err = notifier.Request(ctx, msg)
+		if err == nil {
+			res.Method, res.URL = req.Method, req.URL.String()
+			if req.Body != nil {
+				body, _ := io.ReadAll(req.Body)
+				res.Body = string(body)
+			}
+			err = notifier.Notify(ctx, msg)
+		}
+	}
+	if err != nil {
+		res.Error = err.Error()
+	}
+
+	respondWithJSON(w, http.StatusOK, res)
+}
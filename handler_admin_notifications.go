@@ -0,0 +1,103 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/notify"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/validate"
+	"github.com/google/uuid"
+)
+
+func (cfg *apiConfig) handlerNotificationChannelsList(w http.ResponseWriter, r *http.Request) {
+	channels, err := cfg.db.GetNotificationChannels()
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't retrieve notification channels", err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, channels)
+}
+
+func (cfg *apiConfig) handlerNotificationChannelCreate(w http.ResponseWriter, r *http.Request) {
+	type parameters struct {
+		database.CreateNotificationChannelParams
+	}
+
+	decoder := json.NewDecoder(r.Body)
+	params := parameters{}
+	err := decoder.Decode(&params)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't decode parameters", err)
+		return
+	}
+
+	errs := validate.Errors{}
+	validateNotificationChannel(errs, params.CreateNotificationChannelParams)
+	if errs.Err() != nil {
+		respondWithValidationErrors(w, errs)
+		return
+	}
+
+	channel, err := cfg.db.CreateNotificationChannel(params.CreateNotificationChannelParams)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't create notification channel", err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusCreated, channel)
+}
+
+func (cfg *apiConfig) handlerNotificationChannelDelete(w http.ResponseWriter, r *http.Request) {
+	channelID, err := uuid.Parse(r.PathValue("channelID"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid ID", err)
+		return
+	}
+
+	err = cfg.db.DeleteNotificationChannel(channelID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't delete notification channel", err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handlerNotificationChannelTest sends a message to every configured channel
+// synchronously so admins can see delivery errors straight away.
+func (cfg *apiConfig) handlerNotificationChannelTest(w http.ResponseWriter, r *http.Request) {
+	type result struct {
+		ID    uuid.UUID `json:"id"`
+		Error string    `json:"error,omitempty"`
+	}
+
+	channels, err := cfg.db.GetNotificationChannels()
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't retrieve notification channels", err)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), notifyTimeout)
+	defer cancel()
+
+	results := []result{}
+	for _, channel := range channels {
+		res := result{ID: channel.ID}
+		notifier, err := cfg.notifierForChannel(channel)
+		if err == nil {
+			err = notifier.Notify(ctx, notify.Message{
+				Title: "Test notification",
+				Text:  "This channel is configured to receive Tubely notifications.",
+			})
+		}
+		if err != nil {
+			res.Error = err.Error()
+		}
+		results = append(results, res)
+	}
+
+	respondWithJSON(w, http.StatusOK, results)
+}
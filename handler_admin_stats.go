@@ -0,0 +1,13 @@
+package main
+
+import "net/http"
+
+func (cfg *apiConfig) handlerAdminStats(w http.ResponseWriter, r *http.Request) {
+	stats, err := cfg.db.GetAdminStats()
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get stats", err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, stats)
+}
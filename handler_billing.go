@@ -0,0 +1,187 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/auth"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/billing"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/notify"
+	"github.com/google/uuid"
+)
+
+var errStorageQuotaExceeded = errors.New("storage quota exceeded")
+
+func (cfg *apiConfig) handlerBillingPlanGet(w http.ResponseWriter, r *http.Request) {
+	type response struct {
+		Plan               billing.Plan `json:"plan"`
+		StorageQuotaBytes  int64        `json:"storage_quota_bytes"`
+		StorageUsedBytes   int64        `json:"storage_used_bytes"`
+		MaxDurationSeconds int64        `json:"max_duration_seconds"`
+		MaxQuality         string       `json:"max_quality"`
+	}
+
+	token, err := auth.GetBearerToken(r.Header)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Couldn't find JWT", err)
+		return
+	}
+	userID, err := cfg.validateJWT(token)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Couldn't validate JWT", err)
+		return
+	}
+
+	plan, limits, err := cfg.getUserLimits(userID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get plan", err)
+		return
+	}
+	used, err := cfg.db.GetStorageUsed(userID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get storage usage", err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, response{
+		Plan:               plan,
+		StorageQuotaBytes:  limits.StorageQuotaBytes,
+		StorageUsedBytes:   used,
+		MaxDurationSeconds: int64(limits.MaxDuration.Seconds()),
+		MaxQuality:         string(limits.MaxPreset),
+	})
+}
+
+func (cfg *apiConfig) handlerBillingCheckout(w http.ResponseWriter, r *http.Request) {
+	type response struct {
+		URL string `json:"url"`
+	}
+
+	if cfg.stripe == nil {
+		respondWithError(w, http.StatusNotFound, "Billing is not enabled", nil)
+		return
+	}
+
+	token, err := auth.GetBearerToken(r.Header)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Couldn't find JWT", err)
+		return
+	}
+	userID, err := cfg.validateJWT(token)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Couldn't validate JWT", err)
+		return
+	}
+
+	user, err := cfg.db.GetUser(userID)
+	if err != nil || user == nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get user", err)
+		return
+	}
+	if billing.Plan(user.Plan) == billing.PlanPro {
+		respondWithError(w, http.StatusConflict, "Already subscribed to the pro plan", nil)
+		return
+	}
+	userBilling, err := cfg.db.GetUserBilling(userID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get billing details", err)
+		return
+	}
+
+	url, err := cfg.stripe.CreateCheckoutSession(r.Context(), billing.CheckoutParams{
+		UserID:     userID.String(),
+		Email:      user.Email,
+		CustomerID: userBilling.StripeCustomerID,
+		SuccessURL: cfg.baseURL + "/app/?checkout=success",
+		CancelURL:  cfg.baseURL + "/app/?checkout=cancel",
+	})
+	if err != nil {
+		respondWithError(w, http.StatusBadGateway, "Couldn't create checkout session", err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, response{URL: url})
+}
+
+func (cfg *apiConfig) handlerStripeWebhook(w http.ResponseWriter, r *http.Request) {
+	if cfg.stripe == nil {
+		respondWithError(w, http.StatusNotFound, "Billing is not enabled", nil)
+		return
+	}
+
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxWebhookBodySize))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Couldn't read request body", err)
+		return
+	}
+
+	event, err := cfg.stripe.ParseWebhook(r.Header.Get("Stripe-Signature"), body, time.Now())
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid webhook", err)
+		return
+	}
+
+	obj := event.Data.Object
+	switch event.Type {
+	case "checkout.session.completed":
+		userID, err := uuid.Parse(obj.ClientReferenceID)
+		if err != nil {
+			respondWithError(w, http.StatusBadRequest, "Invalid client reference ID", err)
+			return
+		}
+		err = cfg.db.UpdateUserBilling(userID, database.UserBilling{
+			Plan:                 string(billing.PlanPro),
+			StripeCustomerID:     obj.Customer,
+			StripeSubscriptionID: obj.Subscription,
+		})
+		if err != nil {
+			respondWithError(w, http.StatusInternalServerError, "Couldn't update plan", err)
+			return
+		}
+	case "customer.subscription.updated", "customer.subscription.deleted":
+		plan := billing.PlanFree
+		if event.Type == "customer.subscription.updated" && (obj.Status == "active" || obj.Status == "trialing") {
+			plan = billing.PlanPro
+		}
+		err = cfg.db.SetPlanByStripeCustomer(obj.Customer, string(plan))
+		if err != nil {
+			respondWithError(w, http.StatusInternalServerError, "Couldn't update plan", err)
+			return
+		}
+	default:
+		log.Printf("Ignoring stripe event %s of type %s", event.ID, event.Type)
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (cfg *apiConfig) getUserLimits(userID uuid.UUID) (billing.Plan, billing.Limits, error) {
+	userBilling, err := cfg.db.GetUserBilling(userID)
+	if err != nil {
+		return "", billing.Limits{}, err
+	}
+	plan := billing.Plan(userBilling.Plan)
+	return plan, billing.LimitsFor(plan), nil
+}
+
+// checkStorageQuota returns errStorageQuotaExceeded if storing additional
+// bytes, in place of replaced bytes, would take the user over their quota.
+func (cfg *apiConfig) checkStorageQuota(userID uuid.UUID, limits billing.Limits, additional, replaced int64) error {
+	used, err := cfg.db.GetStorageUsed(userID)
+	if err != nil {
+		return err
+	}
+	if used-replaced+additional > limits.StorageQuotaBytes {
+		cfg.notify(notify.EventQuotaBreach, "Storage quota exceeded", fmt.Sprintf(
+			"User %s tried to store %d bytes with %d of %d bytes already used",
+			userID, additional, used, limits.StorageQuotaBytes,
+		), map[string]any{"user_id": userID, "additional_bytes": additional, "used_bytes": used, "quota_bytes": limits.StorageQuotaBytes})
+		return errStorageQuotaExceeded
+	}
+	return nil
+}
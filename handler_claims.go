@@ -0,0 +1,303 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/auth"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/notify"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/validate"
+	"github.com/google/uuid"
+)
+
+const (
+	maxClaimWorkLength    = 500
+	maxClaimDetailsLength = 5000
+)
+
+// handlerClaimCreate lets a rights holder file a claim against someone
+// else's video.
+func (cfg *apiConfig) handlerClaimCreate(w http.ResponseWriter, r *http.Request) {
+	type parameters struct {
+		Work         string `json:"work"`
+		Details      string `json:"details"`
+		ContactEmail string `json:"contact_email"`
+	}
+
+	videoID, err := uuid.Parse(r.PathValue("videoID"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid video ID", err)
+		return
+	}
+
+	token, err := auth.GetBearerToken(r.Header)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Couldn't find JWT", err)
+		return
+	}
+	userID, err := cfg.validateJWT(token)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Couldn't validate JWT", err)
+		return
+	}
+
+	decoder := json.NewDecoder(r.Body)
+	params := parameters{}
+	err = decoder.Decode(&params)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't decode parameters", err)
+		return
+	}
+
+	errs := validate.Errors{}
+	errs.Check(validate.Required(params.Work), "work", "is required")
+	errs.Check(validate.MaxLength(params.Work, maxClaimWorkLength), "work", "is too long")
+	errs.Check(validate.MaxLength(params.Details, maxClaimDetailsLength), "details", "is too long")
+	errs.Check(validate.Email(params.ContactEmail), "contact_email", "must be a valid email address")
+	if errs.Err() != nil {
+		respondWithValidationErrors(w, errs)
+		return
+	}
+
+	video, err := cfg.db.GetVideo(videoID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get video", err)
+		return
+	}
+	if video.ID == uuid.Nil {
+		respondWithError(w, http.StatusNotFound, "Couldn't get video", nil)
+		return
+	}
+	if video.UserID == userID {
+		respondWithError(w, http.StatusBadRequest, "You can't claim your own video", nil)
+		return
+	}
+
+	claim, err := cfg.db.CreateClaim(database.CreateClaimParams{
+		VideoID:      videoID,
+		ClaimantID:   userID,
+		Work:         params.Work,
+		Details:      params.Details,
+		ContactEmail: params.ContactEmail,
+	})
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't create claim", err)
+		return
+	}
+
+	cfg.notify(notify.EventModerationReport, "Copyright claim filed", fmt.Sprintf(
+		"Claim %s was filed against video %s for %q by %s", claim.ID, videoID, claim.Work, claim.ContactEmail,
+	), map[string]any{"claim_id": claim.ID, "video_id": videoID})
+
+	respondWithJSON(w, http.StatusCreated, claim)
+}
+
+// handlerClaimsForVideo shows the video's owner every claim against it, and
+// anyone else the claims they filed.
+func (cfg *apiConfig) handlerClaimsForVideo(w http.ResponseWriter, r *http.Request) {
+	videoID, err := uuid.Parse(r.PathValue("videoID"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid video ID", err)
+		return
+	}
+
+	token, err := auth.GetBearerToken(r.Header)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Couldn't find JWT", err)
+		return
+	}
+	userID, err := cfg.validateJWT(token)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Couldn't validate JWT", err)
+		return
+	}
+
+	video, err := cfg.db.GetVideo(videoID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get video", err)
+		return
+	}
+
+	claims, err := cfg.db.GetClaimsForVideo(videoID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't retrieve claims", err)
+		return
+	}
+	if video.UserID != userID {
+		filed := []database.Claim{}
+		for _, claim := range claims {
+			if claim.ClaimantID == userID {
+				filed = append(filed, claim)
+			}
+		}
+		claims = filed
+	}
+
+	respondWithJSON(w, http.StatusOK, claims)
+}
+
+func (cfg *apiConfig) handlerClaimDispute(w http.ResponseWriter, r *http.Request) {
+	type parameters struct {
+		Message string `json:"message"`
+	}
+
+	claimID, err := uuid.Parse(r.PathValue("claimID"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid ID", err)
+		return
+	}
+
+	token, err := auth.GetBearerToken(r.Header)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Couldn't find JWT", err)
+		return
+	}
+	userID, err := cfg.validateJWT(token)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Couldn't validate JWT", err)
+		return
+	}
+
+	decoder := json.NewDecoder(r.Body)
+	params := parameters{}
+	err = decoder.Decode(&params)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't decode parameters", err)
+		return
+	}
+
+	errs := validate.Errors{}
+	errs.Check(validate.Required(params.Message), "message", "is required")
+	errs.Check(validate.MaxLength(params.Message, maxClaimDetailsLength), "message", "is too long")
+	if errs.Err() != nil {
+		respondWithValidationErrors(w, errs)
+		return
+	}
+
+	claim, err := cfg.db.GetClaim(claimID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get claim", err)
+		return
+	}
+	if claim == nil {
+		respondWithError(w, http.StatusNotFound, "Couldn't find claim", nil)
+		return
+	}
+	video, err := cfg.db.GetVideo(claim.VideoID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get video", err)
+		return
+	}
+	if video.UserID != userID {
+		respondWithError(w, http.StatusNotFound, "Couldn't find claim", nil)
+		return
+	}
+
+	disputed, err := cfg.db.DisputeClaim(claimID, params.Message)
+	if errors.Is(err, database.ErrClaimClosed) {
+		respondWithError(w, http.StatusConflict, "Only open claims can be disputed", err)
+		return
+	}
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't dispute claim", err)
+		return
+	}
+
+	cfg.notify(notify.EventModerationReport, "Copyright claim disputed", fmt.Sprintf(
+		"The owner of video %s disputed claim %s:\n\n%s", claim.VideoID, claimID, params.Message,
+	), map[string]any{"claim_id": claimID, "video_id": claim.VideoID})
+
+	respondWithJSON(w, http.StatusOK, disputed)
+}
+
+func (cfg *apiConfig) handlerAdminClaimsList(w http.ResponseWriter, r *http.Request) {
+	status := database.ClaimStatus(r.URL.Query().Get("status"))
+	if !validate.OneOf(status, "", database.ClaimOpen, database.ClaimDisputed, database.ClaimUpheld, database.ClaimRejected) {
+		respondWithValidationErrors(w, validate.Errors{"status": "must be open, disputed, upheld or rejected"})
+		return
+	}
+
+	claims, err := cfg.db.GetClaims(status)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't retrieve claims", err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, claims)
+}
+
+// handlerAdminClaimResolve closes a claim. Upholding it takes the video down
+// as blocked, so it's served as 451 from then on.
+func (cfg *apiConfig) handlerAdminClaimResolve(w http.ResponseWriter, r *http.Request) {
+	type parameters struct {
+		Decision database.ClaimStatus `json:"decision"`
+		Note     string               `json:"note"`
+	}
+
+	claimID, err := uuid.Parse(r.PathValue("claimID"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid ID", err)
+		return
+	}
+
+	token, err := auth.GetBearerToken(r.Header)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Couldn't find JWT", err)
+		return
+	}
+	adminID, err := cfg.validateJWT(token)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Couldn't validate JWT", err)
+		return
+	}
+
+	decoder := json.NewDecoder(r.Body)
+	params := parameters{}
+	err = decoder.Decode(&params)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't decode parameters", err)
+		return
+	}
+
+	errs := validate.Errors{}
+	errs.Check(validate.OneOf(params.Decision, database.ClaimUpheld, database.ClaimRejected), "decision", "must be upheld or rejected")
+	errs.Check(validate.MaxLength(params.Note, maxClaimDetailsLength), "note", "is too long")
+	if errs.Err() != nil {
+		respondWithValidationErrors(w, errs)
+		return
+	}
+
+	claim, err := cfg.db.ResolveClaim(claimID, params.Decision, params.Note)
+	if errors.Is(err, sql.ErrNoRows) {
+		respondWithError(w, http.StatusNotFound, "Couldn't find claim", err)
+		return
+	}
+	if errors.Is(err, database.ErrClaimClosed) {
+		respondWithError(w, http.StatusConflict, "Claim was already resolved", err)
+		return
+	}
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't resolve claim", err)
+		return
+	}
+
+	if claim.Status == database.ClaimUpheld {
+		_, err = cfg.db.CreateTakedown(database.CreateTakedownParams{
+			VideoID:   claim.VideoID,
+			Kind:      database.TakedownBlocked,
+			Reason:    "Copyright claim: " + claim.Work,
+			CreatedBy: adminID,
+		})
+		if err != nil {
+			respondWithError(w, http.StatusInternalServerError, "Couldn't take down video", err)
+			return
+		}
+		cfg.recordAuditEvent(r, auditEventVideoTakenDown, &adminID, "", fmt.Sprintf("video=%s kind=%s claim=%s", claim.VideoID, database.TakedownBlocked, claim.ID))
+	}
+
+	respondWithJSON(w, http.StatusOK, claim)
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"net/http"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/auth"
+	"github.com/google/uuid"
+)
+
+func (cfg *apiConfig) handlerVideoDeliveryStats(w http.ResponseWriter, r *http.Request) {
+	videoIDString := r.PathValue("videoID")
+	videoID, err := uuid.Parse(videoIDString)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid video ID", err)
+		return
+	}
+
+	token, err := auth.GetBearerToken(r.Header)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Couldn't find JWT", err)
+		return
+	}
+	userID, err := cfg.validateJWT(token)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Couldn't validate JWT", err)
+		return
+	}
+
+	video, err := cfg.db.GetVideo(videoID)
+	if err != nil {
+		respondWithError(w, http.StatusNotFound, "Couldn't get video", err)
+		return
+	}
+	if video.UserID != userID {
+		respondWithError(w, http.StatusForbidden, "You can't view stats for this video", nil)
+		return
+	}
+
+	stats, err := cfg.db.GetVideoDeliveryStats(videoID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get delivery stats", err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, stats)
+}
+
+func (cfg *apiConfig) handlerAdminIngestAccessLogs(w http.ResponseWriter, r *http.Request) {
+	if cfg.accessLogBucket == "" {
+		respondWithError(w, http.StatusNotFound, "Access log ingestion is not configured", nil)
+		return
+	}
+
+	result, err := cfg.ingestAccessLogs(r.Context())
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't ingest access logs", err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, result)
+}
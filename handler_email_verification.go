@@ -0,0 +1,100 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/auth"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/validate"
+	"github.com/google/uuid"
+)
+
+const emailVerificationTokenTTL = time.Hour * 24
+
+func (cfg *apiConfig) handlerEmailVerificationSend(w http.ResponseWriter, r *http.Request) {
+	token, err := auth.GetBearerToken(r.Header)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Couldn't find JWT", err)
+		return
+	}
+	userID, err := cfg.validateJWT(token)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Couldn't validate JWT", err)
+		return
+	}
+
+	user, err := cfg.db.GetUser(userID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get user", err)
+		return
+	}
+	if user == nil {
+		respondWithError(w, http.StatusNotFound, "Couldn't find user", nil)
+		return
+	}
+	if user.EmailVerifiedAt != nil {
+		respondWithError(w, http.StatusConflict, "Email is already verified", nil)
+		return
+	}
+
+	err = cfg.sendEmailVerification(user.ID, user.Email)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't send verification email", err)
+		return
+	}
+
+	w.WriteHeader(http.StatusAccepted)
+}
+
+func (cfg *apiConfig) handlerEmailVerificationConfirm(w http.ResponseWriter, r *http.Request) {
+	type parameters struct {
+		Token string `json:"token"`
+	}
+
+	decoder := json.NewDecoder(r.Body)
+	params := parameters{}
+	err := decoder.Decode(&params)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't decode parameters", err)
+		return
+	}
+	errs := validate.Errors{}
+	validateToken(errs, params.Token)
+	if errs.Err() != nil {
+		respondWithValidationErrors(w, errs)
+		return
+	}
+
+	userID, err := cfg.db.ConsumeUserToken(auth.HashToken(params.Token), database.UserTokenPurposeEmailVerification)
+	if err != nil {
+		if errors.Is(err, database.ErrTokenInvalid) {
+			respondWithError(w, http.StatusBadRequest, "Invalid or expired token", err)
+			return
+		}
+		respondWithError(w, http.StatusInternalServerError, "Couldn't verify token", err)
+		return
+	}
+
+	err = cfg.db.MarkUserEmailVerified(userID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't verify email", err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (cfg *apiConfig) sendEmailVerification(userID uuid.UUID, email string) error {
+	token, err := cfg.issueUserToken(userID, database.UserTokenPurposeEmailVerification, emailVerificationTokenTTL)
+	if err != nil {
+		return err
+	}
+
+	return cfg.sendTemplatedEmail(email, "verify_email", map[string]string{
+		"Link": fmt.Sprintf("%s/app/?verify_token=%s", cfg.baseURL, token),
+	})
+}
@@ -2,11 +2,17 @@ package main
 
 import (
 	"encoding/json"
+	"fmt"
+	"log"
+	"math"
 	"net/http"
+	"strconv"
 	"time"
 
 	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/auth"
 	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/validate"
+	"github.com/google/uuid"
 )
 
 func (cfg *apiConfig) handlerLogin(w http.ResponseWriter, r *http.Request) {
@@ -28,6 +34,27 @@ func (cfg *apiConfig) handlerLogin(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	errs := validate.Errors{}
+	errs.Check(validate.Required(params.Email), "email", "is required")
+	errs.Check(validate.Required(params.Password), "password", "is required")
+	if errs.Err() != nil {
+		respondWithValidationErrors(w, errs)
+		return
+	}
+
+	ip := clientIP(r)
+	retryAfter, err := cfg.loginRetryAfter(params.Email, ip)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't check login attempts", err)
+		return
+	}
+	if retryAfter > 0 {
+		cfg.recordAuditEvent(r, auditEventLoginBlocked, nil, params.Email, fmt.Sprintf("retry_after=%s", retryAfter))
+		w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(retryAfter.Seconds()))))
+		respondWithError(w, http.StatusTooManyRequests, "Too many failed login attempts, try again later", nil)
+		return
+	}
+
 	user, err := cfg.db.GetUserByEmail(params.Email)
 	if err != nil {
 		respondWithError(w, http.StatusUnauthorized, "Incorrect email or password", err)
@@ -36,17 +63,14 @@ func (cfg *apiConfig) handlerLogin(w http.ResponseWriter, r *http.Request) {
 
 	err = auth.CheckPasswordHash(params.Password, user.Password)
 	if err != nil {
+		cfg.recordLoginFailure(r, user.ID, params.Email, ip)
 		respondWithError(w, http.StatusUnauthorized, "Incorrect email or password", err)
 		return
 	}
 
-	accessToken, err := auth.MakeJWT(
-		user.ID,
-		cfg.jwtSecret,
-		time.Hour*24*30,
-	)
+	err = cfg.db.RecordLoginAttempt(params.Email, ip, true)
 	if err != nil {
-		respondWithError(w, http.StatusInternalServerError, "Couldn't create access JWT", err)
+		respondWithError(w, http.StatusInternalServerError, "Couldn't record login attempt", err)
 		return
 	}
 
@@ -56,19 +80,55 @@ func (cfg *apiConfig) handlerLogin(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	_, err = cfg.db.CreateRefreshToken(database.CreateRefreshTokenParams{
+	session, err := cfg.db.CreateRefreshToken(database.CreateRefreshTokenParams{
 		UserID:    user.ID,
 		Token:     refreshToken,
 		ExpiresAt: time.Now().UTC().Add(time.Hour * 24 * 60),
+		UserAgent: r.UserAgent(),
+		IPAddress: clientIP(r),
 	})
 	if err != nil {
 		respondWithError(w, http.StatusInternalServerError, "Couldn't save refresh token", err)
 		return
 	}
 
+	accessToken, err := auth.MakeJWT(
+		user.ID,
+		session.ID,
+		cfg.jwtSecret,
+		time.Hour*24*30,
+	)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't create access JWT", err)
+		return
+	}
+
 	respondWithJSON(w, http.StatusOK, response{
 		User:         user,
 		Token:        accessToken,
 		RefreshToken: refreshToken,
 	})
 }
+
+func (cfg *apiConfig) recordLoginFailure(r *http.Request, userID uuid.UUID, email, ip string) {
+	var auditUserID *uuid.UUID
+	if userID != uuid.Nil {
+		auditUserID = &userID
+	}
+
+	err := cfg.db.RecordLoginAttempt(email, ip, false)
+	if err != nil {
+		log.Printf("Couldn't record login attempt: %v", err)
+		return
+	}
+	cfg.recordAuditEvent(r, auditEventLoginFailed, auditUserID, email, "")
+
+	failures, err := cfg.db.GetLoginFailuresForEmail(email, time.Now().UTC().Add(-loginAttemptWindow))
+	if err != nil {
+		log.Printf("Couldn't count login failures: %v", err)
+		return
+	}
+	if failures.Count == loginLockoutAttempts {
+		cfg.recordAuditEvent(r, auditEventAccountLocked, auditUserID, email, fmt.Sprintf("failures=%d", failures.Count))
+	}
+}
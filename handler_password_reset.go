@@ -0,0 +1,153 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/auth"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/validate"
+	"github.com/google/uuid"
+)
+
+const passwordResetTokenTTL = time.Hour
+
+func (cfg *apiConfig) handlerPasswordResetRequest(w http.ResponseWriter, r *http.Request) {
+	type parameters struct {
+		Email string `json:"email"`
+	}
+
+	decoder := json.NewDecoder(r.Body)
+	params := parameters{}
+	err := decoder.Decode(&params)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't decode parameters", err)
+		return
+	}
+	errs := validate.Errors{}
+	validateEmail(errs, params.Email)
+	if errs.Err() != nil {
+		respondWithValidationErrors(w, errs)
+		return
+	}
+
+	// The account is looked up and the email sent after responding, so the
+	// response is the same, and as quick, whether or not the account
+	// exists, and the endpoint can't be used to discover registered emails.
+	go cfg.requestPasswordReset(params.Email)
+
+	w.WriteHeader(http.StatusAccepted)
+}
+
+// requestPasswordReset emails a reset link to the account with the email, if
+// there is one.
+func (cfg *apiConfig) requestPasswordReset(email string) {
+	user, err := cfg.db.GetUserByEmail(email)
+	if err != nil {
+		log.Printf("Couldn't get user for password reset: %v", err)
+		return
+	}
+	if user.ID == uuid.Nil {
+		return
+	}
+	err = cfg.sendPasswordResetEmail(user.ID, user.Email)
+	if err != nil {
+		log.Printf("Couldn't send password reset email: %v", err)
+	}
+}
+
+func (cfg *apiConfig) handlerPasswordResetConfirm(w http.ResponseWriter, r *http.Request) {
+	type parameters struct {
+		Token    string `json:"token"`
+		Password string `json:"password"`
+	}
+
+	decoder := json.NewDecoder(r.Body)
+	params := parameters{}
+	err := decoder.Decode(&params)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't decode parameters", err)
+		return
+	}
+	errs := validate.Errors{}
+	validateToken(errs, params.Token)
+	validateNewPassword(errs, params.Password)
+	if errs.Err() != nil {
+		respondWithValidationErrors(w, errs)
+		return
+	}
+
+	userID, err := cfg.db.ConsumeUserToken(auth.HashToken(params.Token), database.UserTokenPurposePasswordReset)
+	if err != nil {
+		if errors.Is(err, database.ErrTokenInvalid) {
+			respondWithError(w, http.StatusBadRequest, "Invalid or expired token", err)
+			return
+		}
+		respondWithError(w, http.StatusInternalServerError, "Couldn't verify token", err)
+		return
+	}
+
+	hashedPassword, err := auth.HashPassword(params.Password)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't hash password", err)
+		return
+	}
+
+	err = cfg.db.UpdateUserPassword(userID, hashedPassword)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't update password", err)
+		return
+	}
+
+	// Any other outstanding reset links and existing sessions are no longer
+	// trustworthy once the password has changed. Revoking the sessions also
+	// signs out their access tokens, see validateJWT.
+	err = cfg.db.DeleteUserTokens(userID, database.UserTokenPurposePasswordReset)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't clear reset tokens", err)
+		return
+	}
+	err = cfg.db.RevokeRefreshTokensForUser(userID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't revoke sessions", err)
+		return
+	}
+	cfg.recordAuditEvent(r, auditEventPasswordResetCompleted, &userID, "", "")
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (cfg *apiConfig) sendPasswordResetEmail(userID uuid.UUID, email string) error {
+	token, err := cfg.issueUserToken(userID, database.UserTokenPurposePasswordReset, passwordResetTokenTTL)
+	if err != nil {
+		return err
+	}
+
+	return cfg.sendTemplatedEmail(email, "reset_password", map[string]string{
+		"Link": fmt.Sprintf("%s/app/?reset_token=%s", cfg.baseURL, token),
+	})
+}
+
+// issueUserToken creates a random single-use token for the given purpose,
+// stores only its hash and returns the raw value to be sent to the user.
+func (cfg *apiConfig) issueUserToken(userID uuid.UUID, purpose database.UserTokenPurpose, ttl time.Duration) (string, error) {
+	token, err := auth.MakeRefreshToken()
+	if err != nil {
+		return "", err
+	}
+
+	err = cfg.db.CreateUserToken(database.CreateUserTokenParams{
+		TokenHash: auth.HashToken(token),
+		UserID:    userID,
+		Purpose:   purpose,
+		ExpiresAt: time.Now().UTC().Add(ttl),
+	})
+	if err != nil {
+		return "", err
+	}
+	return token, nil
+}
@@ -23,9 +23,26 @@ func (cfg *apiConfig) handlerRefresh(w http.ResponseWriter, r *http.Request) {
 		respondWithError(w, http.StatusUnauthorized, "Couldn't get user for refresh token", err)
 		return
 	}
+	if user == nil {
+		respondWithError(w, http.StatusUnauthorized, "Refresh token is invalid, expired or revoked", nil)
+		return
+	}
+
+	session, err := cfg.db.GetRefreshToken(refreshToken)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get session", err)
+		return
+	}
+
+	err = cfg.db.TouchRefreshToken(refreshToken)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't update session", err)
+		return
+	}
 
 	accessToken, err := auth.MakeJWT(
 		user.ID,
+		session.ID,
 		cfg.jwtSecret,
 		time.Hour,
 	)
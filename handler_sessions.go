@@ -0,0 +1,78 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/auth"
+	"github.com/google/uuid"
+)
+
+var errSessionRevoked = errors.New("session was revoked or has expired")
+
+// validateJWT returns the user an access token was issued to, as long as
+// the session it was issued for is still active. Revoking a session, or
+// every session when the password is reset, signs out its access tokens
+// along with its refresh token.
+func (cfg *apiConfig) validateJWT(token string) (uuid.UUID, error) {
+	userID, sessionID, err := auth.ValidateJWT(token, cfg.jwtSecret)
+	if err != nil {
+		return uuid.Nil, err
+	}
+	active, err := cfg.db.SessionActive(userID, sessionID)
+	if err != nil {
+		return uuid.Nil, err
+	}
+	if !active {
+		return uuid.Nil, errSessionRevoked
+	}
+	return userID, nil
+}
+
+func (cfg *apiConfig) handlerSessionsList(w http.ResponseWriter, r *http.Request) {
+	token, err := auth.GetBearerToken(r.Header)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Couldn't find JWT", err)
+		return
+	}
+	userID, err := cfg.validateJWT(token)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Couldn't validate JWT", err)
+		return
+	}
+
+	sessions, err := cfg.db.GetSessions(userID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't retrieve sessions", err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, sessions)
+}
+
+func (cfg *apiConfig) handlerSessionRevoke(w http.ResponseWriter, r *http.Request) {
+	sessionID := r.PathValue("sessionID")
+
+	token, err := auth.GetBearerToken(r.Header)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Couldn't find JWT", err)
+		return
+	}
+	userID, err := cfg.validateJWT(token)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Couldn't validate JWT", err)
+		return
+	}
+
+	revoked, err := cfg.db.RevokeSession(userID, sessionID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't revoke session", err)
+		return
+	}
+	if !revoked {
+		respondWithError(w, http.StatusNotFound, "Couldn't find session", nil)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/auth"
+	"github.com/google/uuid"
+)
+
+func TestRevokedSessionSignsOutAccessToken(t *testing.T) {
+	cfg := newTestConfig(t)
+	userID := uuid.New()
+	token := newTestToken(t, cfg, userID)
+	otherToken := newTestToken(t, cfg, userID)
+
+	listSessions := func(token string) int {
+		req := httptest.NewRequest(http.MethodGet, "/api/users/me/sessions", nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		rec := httptest.NewRecorder()
+		cfg.handlerSessionsList(rec, req)
+		return rec.Code
+	}
+
+	if code := listSessions(token); code != http.StatusOK {
+		t.Fatalf("before revoking: status = %d, want %d", code, http.StatusOK)
+	}
+
+	_, sessionID, err := auth.ValidateJWT(token, cfg.jwtSecret)
+	if err != nil {
+		t.Fatal(err)
+	}
+	revoked, err := cfg.db.RevokeSession(userID, sessionID)
+	if err != nil || !revoked {
+		t.Fatalf("RevokeSession = %v, %v", revoked, err)
+	}
+
+	if code := listSessions(token); code != http.StatusUnauthorized {
+		t.Errorf("revoked session: status = %d, want %d", code, http.StatusUnauthorized)
+	}
+	if code := listSessions(otherToken); code != http.StatusOK {
+		t.Errorf("other session: status = %d, want %d", code, http.StatusOK)
+	}
+
+	err = cfg.db.RevokeRefreshTokensForUser(userID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if code := listSessions(otherToken); code != http.StatusUnauthorized {
+		t.Errorf("after revoking every session: status = %d, want %d", code, http.StatusUnauthorized)
+	}
+}
+
+func TestAccessTokenWithoutSession(t *testing.T) {
+	cfg := newTestConfig(t)
+	token, err := auth.MakeJWT(uuid.New(), "", cfg.jwtSecret, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := cfg.validateJWT(token); err == nil {
+		t.Error("validateJWT accepted a token that isn't tied to a session")
+	}
+}
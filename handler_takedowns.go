@@ -0,0 +1,284 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/auth"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/notify"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/validate"
+	"github.com/google/uuid"
+)
+
+const (
+	auditEventVideoTakenDown  = "video_taken_down"
+	auditEventVideoReinstated = "video_reinstated"
+
+	maxTakedownReasonLength = 2000
+)
+
+// checkVideoAvailable responds with the video's tombstone if an admin took it
+// down, or with a 451 while it has a pending copyright claim if those unlist
+// videos. It returns false if it responded.
+func (cfg *apiConfig) checkVideoAvailable(w http.ResponseWriter, videoID uuid.UUID) bool {
+	takedown, err := cfg.db.GetTakedown(videoID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get takedown", err)
+		return false
+	}
+	if takedown != nil {
+		respondWithTombstone(w, *takedown)
+		return false
+	}
+
+	if !cfg.claimsAutoUnlist {
+		return true
+	}
+	claimed, err := cfg.db.HasPendingClaim(videoID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get copyright claims", err)
+		return false
+	}
+	if claimed {
+		respondWithError(w, http.StatusUnavailableForLegalReasons, "This video is unavailable while a copyright claim is reviewed", nil)
+		return false
+	}
+	return true
+}
+
+// unavailableVideos is checkVideoAvailable for many videos at once.
+func (cfg *apiConfig) unavailableVideos(videoIDs []uuid.UUID) (map[uuid.UUID]bool, error) {
+	unavailable := map[uuid.UUID]bool{}
+	if cfg.claimsAutoUnlist {
+		claimed, err := cfg.db.GetVideosWithPendingClaims(videoIDs)
+		if err != nil {
+			return nil, err
+		}
+		unavailable = claimed
+	}
+	takedowns, err := cfg.db.GetTakedownsForVideos(videoIDs)
+	if err != nil {
+		return nil, err
+	}
+	for id := range takedowns {
+		unavailable[id] = true
+	}
+	return unavailable, nil
+}
+
+// respondWithTombstone tells clients why a video is gone instead of a plain
+// 404, so the frontend can show the reason and offer the owner an appeal.
+func respondWithTombstone(w http.ResponseWriter, takedown database.Takedown) {
+	status, msg := http.StatusGone, "This video has been removed"
+	if takedown.Kind == database.TakedownBlocked {
+		status, msg = http.StatusUnavailableForLegalReasons, "This video is unavailable for legal reasons"
+	}
+	code, translated := errorMessages.Translate(responseLanguage(w), msg)
+
+	type tombstone struct {
+		Error        string                `json:"error"`
+		Code         string                `json:"code"`
+		Reason       string                `json:"reason"`
+		TakenDownAt  time.Time             `json:"taken_down_at"`
+		AppealStatus database.AppealStatus `json:"appeal_status,omitempty"`
+	}
+	respondWithJSON(w, status, tombstone{
+		Error:        translated,
+		Code:         code,
+		Reason:       takedown.Reason,
+		TakenDownAt:  takedown.CreatedAt,
+		AppealStatus: takedown.AppealStatus,
+	})
+}
+
+func (cfg *apiConfig) handlerAdminTakedownsList(w http.ResponseWriter, r *http.Request) {
+	appealStatus := database.AppealStatus(r.URL.Query().Get("appeal_status"))
+	if !validate.OneOf(appealStatus, "", database.AppealPending, database.AppealUpheld) {
+		respondWithValidationErrors(w, validate.Errors{"appeal_status": "must be pending or upheld"})
+		return
+	}
+
+	takedowns, err := cfg.db.GetTakedowns(appealStatus)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't retrieve takedowns", err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, takedowns)
+}
+
+func (cfg *apiConfig) handlerAdminTakedownCreate(w http.ResponseWriter, r *http.Request) {
+	type parameters struct {
+		Kind   database.TakedownKind `json:"kind"`
+		Reason string                `json:"reason"`
+	}
+
+	videoID, err := uuid.Parse(r.PathValue("videoID"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid video ID", err)
+		return
+	}
+
+	token, err := auth.GetBearerToken(r.Header)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Couldn't find JWT", err)
+		return
+	}
+	adminID, err := cfg.validateJWT(token)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Couldn't validate JWT", err)
+		return
+	}
+
+	decoder := json.NewDecoder(r.Body)
+	params := parameters{}
+	err = decoder.Decode(&params)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't decode parameters", err)
+		return
+	}
+
+	errs := validate.Errors{}
+	errs.Check(validate.OneOf(params.Kind, database.TakedownBlocked, database.TakedownRemoved), "kind", "must be blocked or removed")
+	errs.Check(validate.Required(params.Reason), "reason", "is required")
+	errs.Check(validate.MaxLength(params.Reason, maxTakedownReasonLength), "reason", "is too long")
+	if errs.Err() != nil {
+		respondWithValidationErrors(w, errs)
+		return
+	}
+
+	video, err := cfg.db.GetVideo(videoID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get video", err)
+		return
+	}
+	if video.ID == uuid.Nil {
+		respondWithError(w, http.StatusNotFound, "Couldn't get video", nil)
+		return
+	}
+
+	takedown, err := cfg.db.CreateTakedown(database.CreateTakedownParams{
+		VideoID:   videoID,
+		Kind:      params.Kind,
+		Reason:    params.Reason,
+		CreatedBy: adminID,
+	})
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't take down video", err)
+		return
+	}
+	cfg.recordAuditEvent(r, auditEventVideoTakenDown, &adminID, "", fmt.Sprintf("video=%s kind=%s", videoID, params.Kind))
+
+	respondWithJSON(w, http.StatusCreated, takedown)
+}
+
+// handlerAdminTakedownDelete reinstates a video, which is also how an appeal
+// is granted.
+func (cfg *apiConfig) handlerAdminTakedownDelete(w http.ResponseWriter, r *http.Request) {
+	videoID, err := uuid.Parse(r.PathValue("videoID"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid video ID", err)
+		return
+	}
+
+	err = cfg.db.DeleteTakedown(videoID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't reinstate video", err)
+		return
+	}
+	cfg.recordAuditEvent(r, auditEventVideoReinstated, nil, "", fmt.Sprintf("video=%s", videoID))
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handlerAdminTakedownUphold rejects the owner's appeal, leaving the video
+// down.
+func (cfg *apiConfig) handlerAdminTakedownUphold(w http.ResponseWriter, r *http.Request) {
+	videoID, err := uuid.Parse(r.PathValue("videoID"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid video ID", err)
+		return
+	}
+
+	err = cfg.db.UpholdTakedown(videoID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't uphold takedown", err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (cfg *apiConfig) handlerTakedownAppeal(w http.ResponseWriter, r *http.Request) {
+	type parameters struct {
+		Message string `json:"message"`
+	}
+
+	videoID, err := uuid.Parse(r.PathValue("videoID"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid video ID", err)
+		return
+	}
+
+	token, err := auth.GetBearerToken(r.Header)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Couldn't find JWT", err)
+		return
+	}
+	userID, err := cfg.validateJWT(token)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Couldn't validate JWT", err)
+		return
+	}
+
+	decoder := json.NewDecoder(r.Body)
+	params := parameters{}
+	err = decoder.Decode(&params)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't decode parameters", err)
+		return
+	}
+
+	errs := validate.Errors{}
+	errs.Check(validate.Required(params.Message), "message", "is required")
+	errs.Check(validate.MaxLength(params.Message, maxTakedownReasonLength), "message", "is too long")
+	if errs.Err() != nil {
+		respondWithValidationErrors(w, errs)
+		return
+	}
+
+	video, err := cfg.db.GetVideo(videoID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get video", err)
+		return
+	}
+	if video.UserID != userID {
+		respondWithError(w, http.StatusNotFound, "Couldn't get video", nil)
+		return
+	}
+
+	takedown, err := cfg.db.AppealTakedown(videoID, params.Message)
+	if errors.Is(err, sql.ErrNoRows) {
+		respondWithError(w, http.StatusConflict, "Video isn't taken down", err)
+		return
+	}
+	if errors.Is(err, database.ErrAlreadyAppealed) {
+		respondWithError(w, http.StatusConflict, "Takedown was already appealed", err)
+		return
+	}
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't appeal takedown", err)
+		return
+	}
+
+	cfg.notify(notify.EventModerationReport, "Takedown appealed", fmt.Sprintf(
+		"The owner of video %s appealed its takedown (%s: %s):\n\n%s", videoID, takedown.Kind, takedown.Reason, params.Message,
+	), map[string]any{"video_id": videoID})
+
+	respondWithJSON(w, http.StatusOK, takedown)
+}
@@ -0,0 +1,286 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/notify"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/transcoder"
+	"github.com/google/uuid"
+)
+
+const maxWebhookBodySize = 1 << 20 // 1 MB
+
+func (cfg *apiConfig) handlerTranscoderWebhook(w http.ResponseWriter, r *http.Request) {
+	if cfg.transcoder == nil {
+		respondWithError(w, http.StatusNotFound, "External transcoding is not enabled", nil)
+		return
+	}
+
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxWebhookBodySize))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Couldn't read request body", err)
+		return
+	}
+
+	err = transcoder.VerifySignature(cfg.transcoderWebhookSecret, r.Header, body, time.Now())
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Invalid signature", err)
+		return
+	}
+
+	result, err := cfg.transcoder.ParseCompletion(body)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Couldn't parse webhook payload", err)
+		return
+	}
+
+	job, err := cfg.db.GetTranscodeJob(result.JobID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get transcode job", err)
+		return
+	}
+	if job.ID == "" {
+		respondWithError(w, http.StatusNotFound, "Unknown transcode job", nil)
+		return
+	}
+
+	if result.Status == transcoder.JobStatusComplete {
+		err = cfg.checkTranscodeDuration(job.VideoID, result)
+		if err != nil {
+			result.Status = transcoder.JobStatusError
+			result.Error = err.Error()
+		}
+	}
+	if result.Status == transcoder.JobStatusError {
+		cfg.notify(notify.EventProcessingFailed, "Transcoding job failed",
+			fmt.Sprintf("%s job %s for video %s failed: %s", job.Provider, job.ID, job.VideoID, result.Error),
+			map[string]any{"video_id": job.VideoID, "job_id": job.ID, "error": result.Error})
+	}
+	if result.Status == transcoder.JobStatusComplete {
+		err = cfg.applyTranscodeOutputs(r.Context(), job.VideoID, result.Outputs)
+		if err != nil {
+			respondWithError(w, http.StatusInternalServerError, "Couldn't update video renditions", err)
+			return
+		}
+		video, err := cfg.db.GetVideo(job.VideoID)
+		if err == nil && video.ID != uuid.Nil {
+			cfg.notify(notify.EventVideoReady, "Video ready", fmt.Sprintf("Video %s finished transcoding", video.ID), videoEventData(video))
+			cfg.recordProcessingMetric(transcodeMetric(job, video, result))
+		}
+	}
+
+	err = cfg.db.UpdateTranscodeJob(job.ID, string(result.Status), database.UpdateTranscodeJobParams{
+		Error:            result.Error,
+		DurationMS:       result.DurationMS(),
+		ProcessingMS:     result.ProcessingMS,
+		EstimatedCostUSD: result.EstimatedCostUSD,
+	})
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't update transcode job", err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// transcodeMetric is the processing metric of a completed job. The source
+// was uploaded before the job was submitted, so the total runs from the
+// submission and the upload isn't timed.
+func transcodeMetric(job database.TranscodeJob, video database.Video, result transcoder.JobResult) database.ProcessingMetric {
+	metric := database.ProcessingMetric{
+		VideoID:   video.ID,
+		Pipeline:  job.Provider,
+		SizeBytes: video.SizeBytes,
+		EncodeMS:  result.ProcessingMS,
+		TotalMS:   time.Since(job.CreatedAt).Milliseconds(),
+	}
+	for _, output := range result.Outputs {
+		if output.Height > metric.Height {
+			metric.Width, metric.Height, metric.DurationMS = output.Width, output.Height, output.DurationMS
+		}
+	}
+	return metric
+}
+
+// checkTranscodeDuration enforces the owner's plan limit on the transcoded
+// duration, since the original isn't probed locally in this mode.
+func (cfg *apiConfig) checkTranscodeDuration(videoID uuid.UUID, result transcoder.JobResult) error {
+	video, err := cfg.db.GetVideo(videoID)
+	if err != nil {
+		return err
+	}
+	_, limits, err := cfg.getUserLimits(video.UserID)
+	if err != nil {
+		return err
+	}
+	for _, output := range result.Outputs {
+		if time.Duration(output.DurationMS)*time.Millisecond > limits.MaxDuration {
+			return fmt.Errorf("video is longer than the plan maximum of %s", limits.MaxDuration)
+		}
+	}
+	return nil
+}
+
+// applyTranscodeOutputs records the renditions of a finished job and points
+// the video at the highest resolution one.
+func (cfg *apiConfig) applyTranscodeOutputs(ctx context.Context, videoID uuid.UUID, outputs []transcoder.Output) error {
+	if len(outputs) == 0 {
+		return errors.New("transcode job completed without outputs")
+	}
+
+	video, err := cfg.db.GetVideo(videoID)
+	if err != nil {
+		return err
+	}
+
+	keys := cfg.objectKeys(video.UserID, videoID)
+	artifacts := make([]database.CreateArtifactParams, 0, len(outputs))
+	best := outputs[0]
+	for _, output := range outputs {
+		// Completion events don't include sizes, so ask the bucket.
+		head, err := cfg.s3Client.HeadObject(ctx, &s3.HeadObjectInput{
+			Bucket: aws.String(cfg.s3Bucket),
+			Key:    aws.String(output.Key),
+		})
+		if err != nil {
+			return fmt.Errorf("couldn't get size of %s: %w", output.Key, err)
+		}
+		size := aws.ToInt64(head.ContentLength)
+		// The transcoder can't tag what it writes, so tag it here. Untagged
+		// renditions still play, they're only missed by tag-based rules.
+		_, err = cfg.s3Client.PutObjectTagging(ctx, &s3.PutObjectTaggingInput{
+			Bucket:  aws.String(cfg.s3Bucket),
+			Key:     aws.String(output.Key),
+			Tagging: &types.Tagging{TagSet: keys.tags(database.ArtifactKindRendition)},
+		})
+		if err != nil {
+			log.Printf("Couldn't tag %s: %v", output.Key, err)
+		}
+
+		var bitrate int64
+		if output.DurationMS > 0 {
+			bitrate = size * 8 * 1000 / output.DurationMS
+		}
+		artifacts = append(artifacts, database.CreateArtifactParams{
+			VideoID:    videoID,
+			Kind:       database.ArtifactKindRendition,
+			Key:        output.Key,
+			SizeBytes:  size,
+			Width:      output.Width,
+			Height:     output.Height,
+			Bitrate:    bitrate,
+			DurationMS: output.DurationMS,
+		})
+		if output.Height > best.Height {
+			best = output
+		}
+	}
+
+	err = cfg.replaceArtifacts(ctx, videoID, database.ArtifactKindRendition, artifacts)
+	if err != nil {
+		return err
+	}
+
+	url := cfg.distributionURL(best.Key)
+	video.VideoURL = &url
+	err = cfg.db.UpdateVideo(&video)
+	if err != nil {
+		return err
+	}
+	cfg.recordStorageUsage(video.UserID)
+	return nil
+}
+
+// uploadSource stores the original as-is for the external transcoder, with
+// put writing it to the key it's given. It returns the key and size.
+func (cfg *apiConfig) uploadSource(video database.Video, mediaType string, put func(key string, tagging *string) (int64, error)) (string, int64, error) {
+	keys := cfg.objectKeys(video.UserID, video.ID)
+	newKey := func() (string, error) {
+		return keys.source(mediaType), nil
+	}
+	var size int64
+	sourceKey, _ := newKey()
+	sourceKey, err := putNewObject(sourceKey, newKey, func(key string) (err error) {
+		size, err = put(key, keys.tagging(database.ArtifactKindSource))
+		return err
+	})
+	if err != nil {
+		return "", 0, fmt.Errorf("couldn't upload original: %w", err)
+	}
+	return sourceKey, size, nil
+}
+
+// submitTranscodeJob hands the original stored by uploadSource to the
+// external transcoder, which reports back through handlerTranscoderWebhook.
+func (cfg *apiConfig) submitTranscodeJob(ctx context.Context, video database.Video, sourceKey string, size int64, preset transcoder.Preset) error {
+	videoID := video.ID
+	keys := cfg.objectKeys(video.UserID, videoID)
+	err := cfg.replaceArtifacts(ctx, videoID, database.ArtifactKindSource, []database.CreateArtifactParams{{
+		VideoID:   videoID,
+		Kind:      database.ArtifactKindSource,
+		Key:       sourceKey,
+		SizeBytes: size,
+	}})
+	if err != nil {
+		return err
+	}
+
+	jobID, err := cfg.transcoder.Submit(ctx, videoID, sourceKey, keys.renditions(), preset)
+	if err != nil {
+		return err
+	}
+
+	return cfg.db.CreateTranscodeJob(database.CreateTranscodeJobParams{
+		ID:       jobID,
+		VideoID:  videoID,
+		Provider: cfg.transcoder.Provider(),
+		Preset:   string(preset),
+		Status:   string(transcoder.JobStatusSubmitted),
+	})
+}
+
+func (cfg *apiConfig) handlerRenditionsGet(w http.ResponseWriter, r *http.Request) {
+	videoIDString := r.PathValue("videoID")
+	videoID, err := uuid.Parse(videoIDString)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid video ID", err)
+		return
+	}
+	if !cfg.checkVideoAvailable(w, videoID) {
+		return
+	}
+	video, err := cfg.db.GetVideo(videoID)
+	if err != nil {
+		respondWithError(w, http.StatusNotFound, "Couldn't get video", err)
+		return
+	}
+	if !cfg.checkVideoPublished(w, r, video) {
+		return
+	}
+	if !cfg.checkVideoPassword(w, r, video) {
+		return
+	}
+
+	artifacts, err := cfg.db.GetArtifacts(videoID, database.ArtifactKindRendition)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't retrieve renditions", err)
+		return
+	}
+
+	renditions, err := cfg.renditionsFromArtifacts(artifacts)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't sign rendition URLs", err)
+		return
+	}
+	respondWithJSON(w, http.StatusOK, renditions)
+}
@@ -1,14 +1,15 @@
 package main
 
 import (
+	"errors"
 	"fmt"
 	"io"
 	"mime"
-	"os"
 
 	"net/http"
 
 	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/auth"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
 	"github.com/google/uuid"
 )
 
@@ -26,7 +27,7 @@ func (cfg *apiConfig) handlerUploadThumbnail(w http.ResponseWriter, r *http.Requ
 		return
 	}
 
-	userID, err := auth.ValidateJWT(token, cfg.jwtSecret)
+	userID, err := cfg.validateJWT(token)
 	if err != nil {
 		respondWithError(w, http.StatusUnauthorized, "Couldn't validate JWT", err)
 		return
@@ -34,16 +35,32 @@ func (cfg *apiConfig) handlerUploadThumbnail(w http.ResponseWriter, r *http.Requ
 
 	fmt.Println("uploading thumbnail for video", videoID, "by user", userID)
 
+	video, err := cfg.db.GetVideo(videoID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't find video", err)
+		return
+	}
+	if video.UserID != userID {
+		respondWithError(w, http.StatusForbidden, "Not authorized to update video", nil)
+		return
+	}
+	if !checkUnmodifiedSince(w, r, video) {
+		return
+	}
+	if !cfg.checkVideoAvailable(w, video.ID) {
+		return
+	}
+
 	const maxMemory = 10 << 20 // 10 MB
 	err = r.ParseMultipartForm(maxMemory)
 	if err != nil {
-		respondWithError(w, http.StatusInternalServerError, "Couldn't parse form data", err)
+		respondWithFormError(w, err)
 		return
 	}
 
 	file, fileHeader, err := r.FormFile("thumbnail")
 	if err != nil {
-		respondWithError(w, http.StatusBadRequest, "Couldn't parse form file", err)
+		respondWithFormError(w, err)
 		return
 	}
 	defer file.Close()
@@ -57,38 +74,54 @@ func (cfg *apiConfig) handlerUploadThumbnail(w http.ResponseWriter, r *http.Requ
 		respondWithError(w, http.StatusBadRequest, "Invalid media type", nil)
 		return
 	}
-
-	video, err := cfg.db.GetVideo(videoID)
-	if err != nil {
-		respondWithError(w, http.StatusInternalServerError, "Couldn't find video", err)
+	if err := checkImageContent(file, mediaType); err != nil {
+		respondWithError(w, http.StatusBadRequest, "The file isn't a valid image", err)
 		return
 	}
-
-	assetPath := generateRandomNameWithExtensionType(mediaType)
-	assetDiskPath := cfg.getAssetDiskPath(assetPath)
-
-	dst, err := os.Create(assetDiskPath)
-	if err != nil {
-		respondWithError(w, http.StatusInternalServerError, "Couldn't create video file", err)
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't reset file pointer", err)
 		return
 	}
-	defer dst.Close()
 
-	cpBytes, err := io.Copy(dst, file)
+	// Named after its content, so a new thumbnail gets a new URL and the
+	// old one can be cached forever.
+	assetPath, err := cfg.saveAsset(file, mediaType)
 	if err != nil {
 		respondWithError(w, http.StatusInternalServerError, "Couldn't save the file", err)
 		return
 	}
-	fmt.Printf("Copied: %v bytes\n", cpBytes)
 
 	url := cfg.getAssetURL(assetPath)
 	video.ThumbnailURL = &url
 
-	err = cfg.db.UpdateVideo(video)
+	if r.Header.Get("If-Unmodified-Since") != "" {
+		// Don't overwrite a change made while the thumbnail was uploading.
+		err = cfg.db.UpdateVideoIfUnchanged(&video)
+	} else {
+		err = cfg.db.UpdateVideo(&video)
+	}
+	if errors.Is(err, database.ErrVideoModified) {
+		respondWithError(w, http.StatusPreconditionFailed, "Video was modified during the upload", err)
+		return
+	}
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't update video information", err)
+		return
+	}
+
+	// The uploaded thumbnail replaces the one generated from the video,
+	// including one still being generated.
+	err = cfg.db.CancelThumbnailJob(video.ID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't update video information", err)
+		return
+	}
+	err = cfg.replaceArtifacts(r.Context(), video.ID, database.ArtifactKindThumbnail, nil)
 	if err != nil {
 		respondWithError(w, http.StatusInternalServerError, "Couldn't update video information", err)
 		return
 	}
 
+	setLastModified(w, video)
 	respondWithJSON(w, http.StatusOK, video)
 }
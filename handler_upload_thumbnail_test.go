@@ -0,0 +1,48 @@
+package main
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+func TestUploadThumbnailOwnership(t *testing.T) {
+	cfg := newTestConfig(t)
+	video, ownerToken := newTestVideo(t, cfg)
+	otherToken := newTestToken(t, cfg, uuid.New())
+	body, contentType := multipartBody(t, "thumbnail", 16)
+
+	upload := func(token string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/api/thumbnail_upload/"+video.ID.String(), bytes.NewReader(body))
+		req.SetPathValue("videoID", video.ID.String())
+		req.Header.Set("Content-Type", contentType)
+		req.Header.Set("Authorization", "Bearer "+token)
+		rec := httptest.NewRecorder()
+		cfg.handlerUploadThumbnail(rec, req)
+		return rec
+	}
+
+	if rec := upload(otherToken); rec.Code != http.StatusForbidden {
+		t.Errorf("upload by another user: status = %d, want %d", rec.Code, http.StatusForbidden)
+	}
+	if entries, _ := os.ReadDir(cfg.assetsRoot); len(entries) != 0 {
+		t.Errorf("upload by another user saved %d assets", len(entries))
+	}
+	got, err := cfg.db.GetVideo(video.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.ThumbnailURL != nil {
+		t.Errorf("upload by another user set the thumbnail to %s", *got.ThumbnailURL)
+	}
+
+	// The owner gets past the ownership check, to the file, which isn't an
+	// image.
+	if rec := upload(ownerToken); rec.Code != http.StatusBadRequest {
+		t.Errorf("upload by the owner: status = %d, want %d", rec.Code, http.StatusBadRequest)
+	}
+}
@@ -1,16 +1,25 @@
 package main
 
 import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
 	"fmt"
 	"io"
+	"io/fs"
+	"log"
 	"mime"
 	"net/http"
 	"os"
-	"path/filepath"
+	"time"
 
-	"github.com/aws/aws-sdk-go-v2/aws"
-	"github.com/aws/aws-sdk-go-v2/service/s3"
 	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/auth"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/billing"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/notify"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/transcoder"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/validate"
 	"github.com/google/uuid"
 )
 
@@ -18,6 +27,8 @@ const maxUploadLimit = 1 << 30 // 1GB
 
 func (cfg *apiConfig) handlerUploadVideo(w http.ResponseWriter, r *http.Request) {
 	r.Body = http.MaxBytesReader(w, r.Body, maxUploadLimit)
+	audit := cfg.uploadAudit.start(r)
+	defer audit.finish()
 
 	videoIDString := r.PathValue("videoID")
 	videoID, err := uuid.Parse(videoIDString)
@@ -29,9 +40,10 @@ func (cfg *apiConfig) handlerUploadVideo(w http.ResponseWriter, r *http.Request)
 	token, err := auth.GetBearerToken(r.Header)
 	if err != nil {
 		respondWithError(w, http.StatusUnauthorized, "Couldn't find JWT", err)
+		return
 	}
 
-	userID, err := auth.ValidateJWT(token, cfg.jwtSecret)
+	userID, err := cfg.validateJWT(token)
 	if err != nil {
 		respondWithError(w, http.StatusUnauthorized, "Couldn't validate JWT", err)
 		return
@@ -44,37 +56,87 @@ func (cfg *apiConfig) handlerUploadVideo(w http.ResponseWriter, r *http.Request)
 	}
 	// validate video ownership
 	if video.UserID != userID {
-		respondWithError(w, http.StatusUnauthorized, "Not authorized to update video", err)
+		respondWithError(w, http.StatusForbidden, "Not authorized to update video", nil)
+		return
+	}
+	if !checkUnmodifiedSince(w, r, video) {
+		return
+	}
+	if !cfg.checkVideoAvailable(w, video.ID) {
+		return
+	}
+	release, ok := cfg.acquireUploadSlot(w, userID)
+	if !ok {
+		return
 	}
+	defer release()
 
 	// handle video file
-	file, fileHeader, err := r.FormFile("video")
+	form, err := readVideoForm(r)
+	if err != nil {
+		respondWithFormError(w, err)
+		return
+	}
+	file := form.video
+
+	_, limits, err := cfg.getUserLimits(userID)
 	if err != nil {
-		respondWithError(w, http.StatusBadRequest, "Couldn't parse form file", err)
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get plan limits", err)
 		return
 	}
-	defer file.Close()
 
-	mediaType, _, err := mime.ParseMediaType(fileHeader.Header.Get("Content-Type"))
+	mediaType, _, err := mime.ParseMediaType(file.Header.Get("Content-Type"))
 	if err != nil {
 		respondWithError(w, http.StatusBadRequest, "Invalid Content-Type", err)
 		return
 	}
-	if mediaType != "video/mp4" {
-		respondWithError(w, http.StatusBadRequest, "Invalid media type, only mp4 is supported", nil)
+	if uerr := cfg.checkVideoType(mediaType); uerr != nil {
+		respondWithUploadError(w, uerr)
+		return
+	}
+
+	// The sniffed type replaces the claimed one.
+	body, mediaType, uerr := cfg.sniffVideo(file)
+	if uerr != nil {
+		respondWithUploadError(w, uerr)
+		return
+	}
+
+	upload := videoUpload{
+		video:     video,
+		userID:    userID,
+		limits:    limits,
+		mediaType: mediaType,
+		quality:   form.value("quality"),
+		audit:     audit,
+	}
+
+	// The transcoder gets the original as-is, so there's nothing to probe
+	// or encode here and the file goes straight from the request to the
+	// bucket. Uploads queued for a processing window are stored as files.
+	if cfg.transcodesInCloud(userID) && cfg.activeProcessingWindow() == nil {
+		upload.stream = newUploadStream(body)
+		cfg.processVideoUpload(w, r, upload)
 		return
 	}
 
-	tempVidFile, err := os.CreateTemp("", "tubely-upload_*.mp4")
+	tempVidFile, err := createSourceFile()
 	if err != nil {
 		respondWithError(w, http.StatusInternalServerError, "Issue creating temp file", err)
 		return
 	}
-	defer os.Remove(tempVidFile.Name())
-	defer tempVidFile.Close()
+	defer tempVidFile.release()
+	audit.trackTempFile(tempVidFile.Name())
 
-	if _, err := io.Copy(tempVidFile, file); err != nil {
-		respondWithError(w, http.StatusInternalServerError, "Couldn't write file to disk", err)
+	hash := sha256.New()
+	size, err := io.Copy(io.MultiWriter(tempVidFile, hash), body)
+	if err != nil {
+		var pathErr *fs.PathError
+		if errors.As(err, &pathErr) {
+			respondWithError(w, http.StatusInternalServerError, "Couldn't write file to disk", err)
+			return
+		}
+		respondWithFormError(w, err)
 		return
 	}
 	_, err = tempVidFile.Seek(0, io.SeekStart)
@@ -83,48 +145,344 @@ func (cfg *apiConfig) handlerUploadVideo(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	// process vid for fast start
-	processedFilePath, err := processVideoForFastStart(tempVidFile.Name())
+	err = cfg.checkStorageQuota(userID, limits, size, video.SizeBytes)
 	if err != nil {
-		respondWithError(w, http.StatusInternalServerError, "Couldn't process video", err)
+		if errors.Is(err, errStorageQuotaExceeded) {
+			respondWithError(w, http.StatusForbidden, "Storage quota exceeded for your plan", err)
+			return
+		}
+		respondWithError(w, http.StatusInternalServerError, "Couldn't check storage quota", err)
 		return
 	}
-	defer os.Remove(processedFilePath)
 
-	fastEncodedVid, err := os.Open(processedFilePath)
-	if err != nil {
-		respondWithError(w, http.StatusInternalServerError, "Couldn't open encoded file", err)
+	upload.file = tempVidFile
+	upload.size = size
+	upload.contentHash = hex.EncodeToString(hash.Sum(nil))
+	cfg.processVideoUpload(w, r, upload)
+}
+
+// videoUpload is an uploaded video file, saved to a temp file and checked
+// against the user's quota, waiting to be processed.
+type videoUpload struct {
+	video       database.Video
+	userID      uuid.UUID
+	limits      billing.Limits
+	file        *sourceFile
+	mediaType   string
+	size        int64
+	contentHash string
+	// stream is set instead of file, size and contentHash for an upload
+	// that's still being read from the request, to be stored as the
+	// transcoder's source. It's checked against the quota once stored.
+	stream *uploadStream
+	// quality picks the transcoding preset, the default if empty.
+	quality string
+	audit   *uploadAudit
+}
+
+// uploadError is why processVideo failed, as the upload handlers respond
+// with it.
+type uploadError struct {
+	status int
+	// fields are set for validation errors, format and args otherwise.
+	fields validate.Errors
+	format string
+	args   []any
+	err    error
+}
+
+// message is what's wrong, without the underlying error that may reveal
+// internals.
+func (e *uploadError) message() string {
+	if e.fields != nil {
+		return e.fields.Error()
 	}
-	defer fastEncodedVid.Close()
+	return fmt.Sprintf(e.format, e.args...)
+}
 
-	// handle video metadata
-	aspectRatio, err := getVideoAspectRatio(tempVidFile.Name())
-	if err != nil {
-		respondWithError(w, http.StatusInternalServerError, "Couldn't handle aspect ratio", err)
+func (e *uploadError) Error() string {
+	if e.err != nil {
+		return e.message() + ": " + e.err.Error()
+	}
+	return e.message()
+}
+
+func (e *uploadError) Unwrap() error {
+	return e.err
+}
+
+func respondWithUploadError(w http.ResponseWriter, e *uploadError) {
+	if e.fields != nil {
+		respondWithValidationErrors(w, e.fields)
 		return
 	}
-	//generate key for s3 with aspect ratio as prefix
-	key := generateRandomNameWithExtensionType(mediaType)
-	key = filepath.Join(aspectRatio, key)
+	respondWithErrorf(w, e.status, e.err, e.format, e.args...)
+}
 
-	// Upload to S3
-	_, err = cfg.s3Client.PutObject(r.Context(), &s3.PutObjectInput{
-		Bucket:      aws.String(cfg.s3Bucket),
-		Key:         aws.String(key),
-		Body:        fastEncodedVid,
-		ContentType: aws.String(mediaType),
-	})
+// processVideoUpload encodes the upload, or hands it to the transcoder, and
+// responds with the updated video. An identical upload already in flight
+// is waited for rather than processed again, so the upload keeps going if
+// its own client goes away while others wait for it.
+func (cfg *apiConfig) processVideoUpload(w http.ResponseWriter, r *http.Request, upload videoUpload) {
+	process := func() (database.Video, int, *uploadError) {
+		return cfg.processVideo(context.WithoutCancel(r.Context()), upload)
+	}
+	var video database.Video
+	var status int
+	var err *uploadError
+	var coalesced bool
+	if key, ok := uploadKey(r, upload); ok {
+		video, status, err, coalesced = cfg.uploads.do(key, process)
+	} else {
+		video, status, err = process()
+	}
+	if coalesced {
+		log.Printf("Upload of video %s coalesced with an identical one in flight", upload.video.ID)
+	}
 	if err != nil {
-		respondWithError(w, http.StatusInternalServerError, "Issue uploading video to S3", err)
+		respondWithUploadError(w, err)
 		return
 	}
+	respondWithJSON(w, status, video)
+}
+
+// processVideo is processVideoUpload without the response, for uploads that
+// don't come from a request. It returns the updated video and 200, or 202
+// if the video was handed to the transcoder or queued until a processing
+// window ends.
+func (cfg *apiConfig) processVideo(ctx context.Context, upload videoUpload) (database.Video, int, *uploadError) {
+	// Streams are sniffed as they're read, since they can't be probed.
+	if upload.stream == nil {
+		if uerr := cfg.checkVideoContent(&upload); uerr != nil {
+			return upload.video, 0, uerr
+		}
+	}
+	// A stream is already on its way to the transcoder, even if a window
+	// started since.
+	if upload.stream == nil && cfg.activeProcessingWindow() != nil {
+		return cfg.queueVideoUpload(ctx, upload)
+	}
+	return cfg.processVideoNow(ctx, upload)
+}
+
+// transcodesInCloud reports whether the user's uploads go to the external
+// transcoder rather than being processed with ffmpeg.
+func (cfg *apiConfig) transcodesInCloud(userID uuid.UUID) bool {
+	return cfg.transcoder != nil && cfg.featureEnabled(featureCloudTranscoding, userID)
+}
+
+// checkStreamedQuota checks a streamed upload against the user's quota now
+// that it's stored at key with its size known, deleting it if it's over.
+func (cfg *apiConfig) checkStreamedQuota(upload videoUpload, key string, size int64) *uploadError {
+	err := cfg.checkStorageQuota(upload.userID, upload.limits, size, upload.video.SizeBytes)
+	if err == nil {
+		return nil
+	}
+	if err := cfg.deleteObjects(context.Background(), []string{key}); err != nil {
+		log.Printf("Couldn't delete upload %s over quota: %v", key, err)
+	}
+	if errors.Is(err, errStorageQuotaExceeded) {
+		return &uploadError{status: http.StatusForbidden, format: "Storage quota exceeded for your plan", err: err}
+	}
+	return &uploadError{status: http.StatusInternalServerError, format: "Couldn't check storage quota", err: err}
+}
+
+// processVideoNow is processVideo ignoring processing windows.
+func (cfg *apiConfig) processVideoNow(ctx context.Context, upload videoUpload) (database.Video, int, *uploadError) {
+	video, userID, limits := upload.video, upload.userID, upload.limits
+	tempVidFile, mediaType, audit := upload.file, upload.mediaType, upload.audit
+	var err error
+
+	if cfg.transcodesInCloud(userID) {
+		preset := cfg.defaultTranscodePreset
+		if quality := upload.quality; quality != "" {
+			preset, err = transcoder.ParsePreset(quality)
+			if err != nil {
+				return video, 0, &uploadError{status: http.StatusUnprocessableEntity, fields: validate.Errors{"quality": "must be sd, hd or fhd"}}
+			}
+		}
+		preset = limits.CapPreset(preset)
+		submitFailed := func(err error) *uploadError {
+			cfg.notify(notify.EventProcessingFailed, "Transcoding job submission failed",
+				fmt.Sprintf("Couldn't submit video %s to %s: %v", video.ID, cfg.transcoder.Provider(), err),
+				map[string]any{"video_id": video.ID, "user_id": video.UserID, "error": err.Error()})
+			return &uploadError{status: http.StatusInternalServerError, format: "Couldn't submit transcoding job", err: err}
+		}
+
+		put := func(key string, tagging *string) (int64, error) {
+			return cfg.putFile(ctx, key, mediaType, tagging, tempVidFile.File)
+		}
+		if upload.stream != nil {
+			put = func(key string, tagging *string) (int64, error) {
+				return cfg.putStream(ctx, key, mediaType, tagging, upload.stream)
+			}
+		}
+		sourceKey, size, err := cfg.uploadSource(video, mediaType, put)
+		if err != nil {
+			if upload.stream != nil && upload.stream.err != nil {
+				return video, 0, formError(upload.stream.err)
+			}
+			return video, 0, submitFailed(err)
+		}
+		contentHash := upload.contentHash
+		if upload.stream != nil {
+			contentHash = upload.stream.contentHash()
+			if uerr := cfg.checkStreamedQuota(upload, sourceKey, size); uerr != nil {
+				return video, 0, uerr
+			}
+		}
+
+		video.SizeBytes = size
+		err = cfg.db.UpdateVideo(&video)
+		if err != nil {
+			return video, 0, &uploadError{status: http.StatusInternalServerError, format: "Couldn't update video information", err: err}
+		}
+
+		err = cfg.submitTranscodeJob(ctx, video, sourceKey, size, preset)
+		if err != nil {
+			return video, 0, submitFailed(err)
+		}
+		cfg.dropAddedAudio(ctx, video.ID)
+		cfg.recordContentHash(video.ID, contentHash)
+		cfg.recordStorageUsage(userID)
+		return video, http.StatusAccepted, nil
+	}
+
+	started := time.Now()
+	metric := database.ProcessingMetric{VideoID: video.ID, Pipeline: ffmpegPipeline, SizeBytes: upload.size}
+	duration, err := tempVidFile.duration()
+	if err != nil {
+		return video, 0, &uploadError{status: http.StatusInternalServerError, format: "Couldn't read video duration", err: err}
+	}
+	metric.ProbeMS = time.Since(started).Milliseconds()
+	if duration > limits.MaxDuration {
+		return video, 0, &uploadError{status: http.StatusForbidden, format: "Videos on your plan can be at most %s long", args: []any{limits.MaxDuration}}
+	}
+
+	storedType := storedVideoType(mediaType)
+	keys := cfg.objectKeys(userID, video.ID)
+	newKey := func() (string, error) {
+		return keys.video(storedType, tempVidFile.aspectRatio)
+	}
+	key, err := newKey()
+	if err != nil {
+		return video, 0, &uploadError{status: http.StatusInternalServerError, format: "Couldn't handle aspect ratio", err: err}
+	}
+	// duration already probed the source successfully.
+	sourceProbe, _ := tempVidFile.probe()
+	codecArgs := mp4CodecArgs(mediaType, sourceProbe)
+
+	encodeStarted := time.Now()
+	switch {
+	case passthroughVideoTypes[mediaType]:
+		// Browser-safe formats are stored as uploaded.
+		uploadStarted := time.Now()
+		key, err = putNewObject(key, newKey, func(key string) (err error) {
+			video.SizeBytes, err = cfg.putFile(ctx, key, storedType, keys.tagging(database.ArtifactKindVideo), tempVidFile.File)
+			return err
+		})
+		if err != nil {
+			return video, 0, &uploadError{status: http.StatusInternalServerError, format: "Issue uploading video to S3", err: err}
+		}
+		metric.UploadMS = time.Since(uploadStarted).Milliseconds()
+	case cfg.featureEnabled(featureStreamingEncode, userID):
+		// The fragments are uploaded as they're encoded, so the upload is
+		// timed as part of the encode.
+		key, err = putNewObject(key, newKey, func(key string) (err error) {
+			video.SizeBytes, err = cfg.uploadFragmentedVideo(ctx, tempVidFile.Name(), codecArgs, key, keys.tagging(database.ArtifactKindVideo))
+			return err
+		})
+		if err != nil {
+			cfg.notify(notify.EventProcessingFailed, "Video processing failed",
+				fmt.Sprintf("Streaming encode failed for video %s: %v", video.ID, err),
+				map[string]any{"video_id": video.ID, "user_id": video.UserID, "error": err.Error()})
+			return video, 0, &uploadError{status: http.StatusInternalServerError, format: "Couldn't process video", err: err}
+		}
+		metric.EncodeMS = time.Since(encodeStarted).Milliseconds()
+	default:
+		// process vid for fast start
+		processedFilePath, err := processVideoForFastStart(tempVidFile.Name(), codecArgs)
+		if err != nil {
+			cfg.notify(notify.EventProcessingFailed, "Video processing failed",
+				fmt.Sprintf("Fast start encoding failed for video %s: %v", video.ID, err),
+				map[string]any{"video_id": video.ID, "user_id": video.UserID, "error": err.Error()})
+			return video, 0, &uploadError{status: http.StatusInternalServerError, format: "Couldn't process video", err: err}
+		}
+		defer os.Remove(processedFilePath)
+		audit.trackTempFile(processedFilePath)
+		metric.EncodeMS = time.Since(encodeStarted).Milliseconds()
+
+		fastEncodedVid, err := os.Open(processedFilePath)
+		if err != nil {
+			return video, 0, &uploadError{status: http.StatusInternalServerError, format: "Couldn't open encoded file", err: err}
+		}
+		defer fastEncodedVid.Close()
+
+		encodedInfo, err := fastEncodedVid.Stat()
+		if err != nil {
+			return video, 0, &uploadError{status: http.StatusInternalServerError, format: "Couldn't stat encoded file", err: err}
+		}
+		video.SizeBytes = encodedInfo.Size()
+
+		// Upload to S3
+		uploadStarted := time.Now()
+		key, err = putNewObject(key, newKey, func(key string) error {
+			_, err := cfg.putFile(ctx, key, storedType, keys.tagging(database.ArtifactKindVideo), fastEncodedVid)
+			return err
+		})
+		if err != nil {
+			return video, 0, &uploadError{status: http.StatusInternalServerError, format: "Issue uploading video to S3", err: err}
+		}
+		metric.UploadMS = time.Since(uploadStarted).Milliseconds()
+	}
 
-	url := fmt.Sprintf("%s/%s", cfg.s3CfDistribution, key)
+	// The probe here runs alongside the preview encode, which is the bulk
+	// of the time.
+	extractStarted := time.Now()
+	media, err := cfg.extractMedia(ctx, keys, tempVidFile, audit)
+	if err != nil {
+		return video, 0, &uploadError{status: http.StatusInternalServerError, format: "Couldn't probe encoded video", err: err}
+	}
+	metric.EncodeMS += time.Since(extractStarted).Milliseconds()
+	probe := media.probe
+	err = cfg.replaceArtifacts(ctx, video.ID, database.ArtifactKindVideo, []database.CreateArtifactParams{{
+		VideoID:    video.ID,
+		Kind:       database.ArtifactKindVideo,
+		Key:        key,
+		SizeBytes:  video.SizeBytes,
+		Codec:      probe.Codec,
+		Width:      probe.Width,
+		Height:     probe.Height,
+		Bitrate:    probe.Bitrate,
+		DurationMS: probe.DurationMS,
+	}})
+	if err != nil {
+		return video, 0, &uploadError{status: http.StatusInternalServerError, format: "Couldn't record video artifact", err: err}
+	}
+	err = cfg.recordExtractedMedia(ctx, media, video.ID)
+	if err != nil {
+		return video, 0, &uploadError{status: http.StatusInternalServerError, format: "Couldn't record video artifact", err: err}
+	}
+
+	url := cfg.distributionURL(key)
 	video.VideoURL = &url
-	err = cfg.db.UpdateVideo(video)
+	err = cfg.db.UpdateVideo(&video)
 	if err != nil {
-		respondWithError(w, http.StatusInternalServerError, "Couldn't update video information", err)
-		return
+		return video, 0, &uploadError{status: http.StatusInternalServerError, format: "Couldn't update video information", err: err}
 	}
-	respondWithJSON(w, http.StatusOK, video)
+	// Uploaded thumbnails take precedence over generated ones.
+	if video.ThumbnailURL == nil {
+		if err := cfg.queueThumbnail(video.ID, tempVidFile); err != nil {
+			log.Printf("Couldn't queue thumbnail of video %s: %v", video.ID, err)
+		}
+	}
+	metric.DurationMS, metric.Width, metric.Height = probe.DurationMS, probe.Width, probe.Height
+	metric.TotalMS = time.Since(started).Milliseconds()
+	cfg.recordProcessingMetric(metric)
+	cfg.dropAddedAudio(ctx, video.ID)
+	cfg.recordContentHash(video.ID, upload.contentHash)
+	cfg.recordStorageUsage(userID)
+	cfg.notify(notify.EventVideoReady, "Video ready", fmt.Sprintf("Video %s finished processing", video.ID), videoEventData(video))
+
+	return video, http.StatusOK, nil
 }
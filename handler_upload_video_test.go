@@ -0,0 +1,71 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+func TestUploadVideoRejectedBeforeUpload(t *testing.T) {
+	cfg := newTestConfig(t)
+	cfg.uploadSlots = newUploadSlots(1)
+	video, _ := newTestVideo(t, cfg)
+	otherID := uuid.New()
+	body, contentType := multipartBody(t, "video", 1024)
+
+	tests := []struct {
+		name          string
+		authorization string
+		wantStatus    int
+		wantCode      string
+	}{
+		{"no token", "", http.StatusUnauthorized, "missing_token"},
+		{"another user", "Bearer " + newTestToken(t, cfg, otherID), http.StatusForbidden, "video_forbidden"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/api/video_upload/"+video.ID.String(), bytes.NewReader(body))
+			req.SetPathValue("videoID", video.ID.String())
+			req.Header.Set("Content-Type", contentType)
+			if tt.authorization != "" {
+				req.Header.Set("Authorization", tt.authorization)
+			}
+			rec := httptest.NewRecorder()
+			cfg.handlerUploadVideo(rec, req)
+
+			if rec.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d", rec.Code, tt.wantStatus)
+			}
+			// A handler that carries on after the error writes a second
+			// response after the first.
+			var resp struct {
+				Code string `json:"code"`
+			}
+			decoder := json.NewDecoder(rec.Body)
+			if err := decoder.Decode(&resp); err != nil {
+				t.Fatal(err)
+			}
+			if resp.Code != tt.wantCode {
+				t.Errorf("code = %q, want %q", resp.Code, tt.wantCode)
+			}
+			if decoder.More() {
+				t.Errorf("more than one response written: %s", rec.Body.String())
+			}
+		})
+	}
+
+	if _, ok := cfg.uploadSlots.acquire(otherID); !ok {
+		t.Errorf("rejected upload kept an upload slot")
+	}
+	got, err := cfg.db.GetVideo(video.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.VideoURL != nil {
+		t.Errorf("rejected upload set the video URL to %s", *got.VideoURL)
+	}
+}
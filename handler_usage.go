@@ -0,0 +1,80 @@
+package main
+
+import (
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/auth"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/validate"
+	"github.com/google/uuid"
+)
+
+func (cfg *apiConfig) handlerUsageGet(w http.ResponseWriter, r *http.Request) {
+	token, err := auth.GetBearerToken(r.Header)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Couldn't find JWT", err)
+		return
+	}
+	userID, err := cfg.validateJWT(token)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Couldn't validate JWT", err)
+		return
+	}
+
+	month, ok := parseUsageMonth(w, r)
+	if !ok {
+		return
+	}
+
+	usage, err := cfg.db.GetUsage(userID, month)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get usage", err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, usage)
+}
+
+func (cfg *apiConfig) handlerAdminUsageList(w http.ResponseWriter, r *http.Request) {
+	month, ok := parseUsageMonth(w, r)
+	if !ok {
+		return
+	}
+
+	usages, err := cfg.db.GetAllUsage(month)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get usage", err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, usages)
+}
+
+// parseUsageMonth reads the optional ?month=YYYY-MM parameter, defaulting to
+// the current month. It responds with an error itself if the value is invalid.
+func parseUsageMonth(w http.ResponseWriter, r *http.Request) (string, bool) {
+	month := r.URL.Query().Get("month")
+	if month == "" {
+		return database.UsageMonth(time.Now()), true
+	}
+	t, err := time.Parse("2006-01", month)
+	if err != nil {
+		respondWithValidationErrors(w, validate.Errors{"month": "must be formatted as YYYY-MM"})
+		return "", false
+	}
+	if !validate.Between(t, time.Date(2000, 1, 1, 0, 0, 0, 0, time.UTC), time.Now()) {
+		respondWithValidationErrors(w, validate.Errors{"month": "must be between 2000-01 and the current month"})
+		return "", false
+	}
+	return month, true
+}
+
+// recordStorageUsage updates the user's monthly peak after their stored
+// bytes changed. Accounting failures are logged rather than failing uploads.
+func (cfg *apiConfig) recordStorageUsage(userID uuid.UUID) {
+	if err := cfg.db.RecordStorageUsage(userID); err != nil {
+		log.Printf("Couldn't record storage usage for %s: %v", userID, err)
+	}
+}
@@ -2,10 +2,12 @@ package main
 
 import (
 	"encoding/json"
+	"log"
 	"net/http"
 
 	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/auth"
 	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/validate"
 )
 
 func (cfg *apiConfig) handlerUsersCreate(w http.ResponseWriter, r *http.Request) {
@@ -22,8 +24,11 @@ func (cfg *apiConfig) handlerUsersCreate(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	if params.Password == "" || params.Email == "" {
-		respondWithError(w, http.StatusBadRequest, "Email and password are required", nil)
+	errs := validate.Errors{}
+	validateEmail(errs, params.Email)
+	validateNewPassword(errs, params.Password)
+	if errs.Err() != nil {
+		respondWithValidationErrors(w, errs)
 		return
 	}
 
@@ -42,5 +47,10 @@ func (cfg *apiConfig) handlerUsersCreate(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
+	err = cfg.sendEmailVerification(user.ID, user.Email)
+	if err != nil {
+		log.Printf("Couldn't send verification email: %v", err)
+	}
+
 	respondWithJSON(w, http.StatusCreated, user)
 }
@@ -1,11 +1,18 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
+	"fmt"
+	"log"
 	"net/http"
+	"time"
 
 	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/auth"
 	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/notify"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/transcoder"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/validate"
 	"github.com/google/uuid"
 )
 
@@ -19,7 +26,7 @@ func (cfg *apiConfig) handlerVideoMetaCreate(w http.ResponseWriter, r *http.Requ
 		respondWithError(w, http.StatusUnauthorized, "Couldn't find JWT", err)
 		return
 	}
-	userID, err := auth.ValidateJWT(token, cfg.jwtSecret)
+	userID, err := cfg.validateJWT(token)
 	if err != nil {
 		respondWithError(w, http.StatusUnauthorized, "Couldn't validate JWT", err)
 		return
@@ -34,15 +41,48 @@ func (cfg *apiConfig) handlerVideoMetaCreate(w http.ResponseWriter, r *http.Requ
 	}
 	params.UserID = userID
 
+	errs := validate.Errors{}
+	validateVideoParams(errs, params.CreateVideoParams)
+	if errs.Err() != nil {
+		respondWithValidationErrors(w, errs)
+		return
+	}
+
 	video, err := cfg.db.CreateVideo(params.CreateVideoParams)
 	if err != nil {
 		respondWithError(w, http.StatusInternalServerError, "Couldn't create video", err)
 		return
 	}
+	cfg.notify(notify.EventVideoCreated, "Video created", fmt.Sprintf("Video %s was created", video.ID), videoEventData(video))
 
 	respondWithJSON(w, http.StatusCreated, video)
 }
 
+// deleteVideoObjects deletes every object of the video: its artifacts, an
+// upload waiting in the processing queue and anything else under its
+// prefix.
+func (cfg *apiConfig) deleteVideoObjects(ctx context.Context, userID, videoID uuid.UUID) error {
+	artifacts, err := cfg.db.GetAllArtifacts(videoID)
+	if err != nil {
+		return err
+	}
+	keys := make([]string, 0, len(artifacts))
+	for _, a := range artifacts {
+		keys = append(keys, a.Key)
+	}
+	queued, err := cfg.queuedUploadKey(videoID)
+	if err != nil {
+		return err
+	}
+	if queued != "" {
+		keys = append(keys, queued)
+	}
+	if err := cfg.deleteObjects(ctx, keys); err != nil {
+		return err
+	}
+	return cfg.deletePrefix(ctx, cfg.objectKeys(userID, videoID).videoPrefix())
+}
+
 func (cfg *apiConfig) handlerVideoMetaDelete(w http.ResponseWriter, r *http.Request) {
 	videoIDString := r.PathValue("videoID")
 	videoID, err := uuid.Parse(videoIDString)
@@ -56,7 +96,7 @@ func (cfg *apiConfig) handlerVideoMetaDelete(w http.ResponseWriter, r *http.Requ
 		respondWithError(w, http.StatusUnauthorized, "Couldn't find JWT", err)
 		return
 	}
-	userID, err := auth.ValidateJWT(token, cfg.jwtSecret)
+	userID, err := cfg.validateJWT(token)
 	if err != nil {
 		respondWithError(w, http.StatusUnauthorized, "Couldn't validate JWT", err)
 		return
@@ -71,12 +111,38 @@ func (cfg *apiConfig) handlerVideoMetaDelete(w http.ResponseWriter, r *http.Requ
 		respondWithError(w, http.StatusForbidden, "You can't delete this video", err)
 		return
 	}
+	if !checkUnmodifiedSince(w, r, video) {
+		return
+	}
+
+	dryRun, err := parseDryRun(r)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "dry_run must be true or false", err)
+		return
+	}
+	if dryRun {
+		plan, err := cfg.planVideoDeletion(r.Context(), video)
+		if err != nil {
+			respondWithError(w, http.StatusInternalServerError, "Couldn't plan video deletion", err)
+			return
+		}
+		respondWithJSON(w, http.StatusOK, plan)
+		return
+	}
+
+	err = cfg.deleteVideoObjects(r.Context(), userID, videoID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't delete video files", err)
+		return
+	}
 
 	err = cfg.db.DeleteVideo(videoID)
 	if err != nil {
 		respondWithError(w, http.StatusInternalServerError, "Couldn't delete video", err)
 		return
 	}
+	cfg.recordStorageUsage(userID)
+	cfg.notify(notify.EventVideoDeleted, "Video deleted", fmt.Sprintf("Video %s was deleted", video.ID), videoEventData(video))
 
 	w.WriteHeader(http.StatusNoContent)
 }
@@ -94,8 +160,247 @@ func (cfg *apiConfig) handlerVideoGet(w http.ResponseWriter, r *http.Request) {
 		respondWithError(w, http.StatusNotFound, "Couldn't get video", err)
 		return
 	}
+	if !cfg.checkVideoAvailable(w, video.ID) {
+		return
+	}
+	if !cfg.checkVideoPublished(w, r, video) {
+		return
+	}
+	if !cfg.checkVideoPassword(w, r, video) {
+		return
+	}
+	// v2 responses include the processing status, which changes without
+	// the video being updated.
+	version := requestAPIVersion(r)
+	etag := []any{video.ID, video.UpdatedAt.UnixNano()}
+	status := ""
+	if version >= apiV2 {
+		job, err := cfg.db.GetLatestTranscodeJob(video.ID)
+		if err != nil {
+			respondWithError(w, http.StatusInternalServerError, "Couldn't get transcode job", err)
+			return
+		}
+		queued, err := cfg.db.GetQueuedUpload(video.ID)
+		if err != nil {
+			respondWithError(w, http.StatusInternalServerError, "Couldn't get queued upload", err)
+			return
+		}
+		status, _ = videoStatus(video, job, queued != nil)
+		etag = append(etag, status)
+	}
+	setLastModified(w, video)
+	if !checkNoneMatch(w, r, cfg.responseETag(etag...)) {
+		return
+	}
+
+	if video.VideoURL != nil {
+		if !cfg.checkURLIssuance(w, r, video.ID.String()) {
+			return
+		}
+		err = cfg.db.RecordURLIssuance(video.UserID, video.SizeBytes)
+		if err != nil {
+			log.Printf("Couldn't record URL issuance for video %s: %v", video.ID, err)
+		}
+	}
+
+	urls, err := cfg.resolveVideoURLs([]database.Video{video})
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't resolve video URLs", err)
+		return
+	}
+	videoURLs := urls[video.ID]
+
+	if version >= apiV2 {
+		respondWithJSON(w, http.StatusOK, videoToV2(video, &videoURLs, status))
+		return
+	}
+	respondWithJSON(w, http.StatusOK, withURLs(video, &videoURLs))
+}
+
+// videoV2 is how /api/v2 shows a video: every URL is under urls rather
+// than in video_url and thumbnail_url, and the processing status is
+// included.
+type videoV2 struct {
+	ID          uuid.UUID  `json:"id"`
+	CreatedAt   time.Time  `json:"created_at"`
+	UpdatedAt   time.Time  `json:"updated_at"`
+	PublishedAt *time.Time `json:"published_at"`
+	Title       string     `json:"title"`
+	Description string     `json:"description"`
+	SizeBytes   int64      `json:"size_bytes"`
+	UserID      uuid.UUID  `json:"user_id"`
+	Status      string     `json:"status"`
+	URLs        *videoURLs `json:"urls"`
+
+	// PasswordProtected videos need the X-Video-Password header.
+	PasswordProtected bool       `json:"password_protected"`
+	ExpiresAt         *time.Time `json:"expires_at"`
+	PurgeOnExpiry     bool       `json:"purge_on_expiry"`
+	UnpublishedAt     *time.Time `json:"unpublished_at"`
+	DownloadsEnabled  bool       `json:"downloads_enabled"`
+	Tags              []string   `json:"tags"`
+
+	Metadata map[string]string `json:"metadata"`
+}
+
+var videoFieldsV2 = []string{
+	"id", "created_at", "updated_at", "published_at", "title", "description",
+	"size_bytes", "user_id", "password_protected", "expires_at", "purge_on_expiry",
+	"unpublished_at", "downloads_enabled", "tags", "metadata", "status", "urls",
+}
+
+func videoToV2(video database.Video, urls *videoURLs, status string) videoV2 {
+	return videoV2{
+		ID:          video.ID,
+		CreatedAt:   video.CreatedAt,
+		UpdatedAt:   video.UpdatedAt,
+		PublishedAt: video.PublishedAt,
+		Title:       video.Title,
+		Description: video.Description,
+		SizeBytes:   video.SizeBytes,
+		UserID:      video.UserID,
+		Status:      status,
+		URLs:        urls,
 
-	respondWithJSON(w, http.StatusOK, video)
+		PasswordProtected: video.PasswordProtected,
+		ExpiresAt:         video.ExpiresAt,
+		PurgeOnExpiry:     video.PurgeOnExpiry,
+		UnpublishedAt:     video.UnpublishedAt,
+		DownloadsEnabled:  video.DownloadsEnabled,
+		Tags:              video.Tags,
+
+		Metadata: video.Metadata,
+	}
+}
+
+// Processing statuses reported by handlerVideoMetaGet and /api/v2.
+const (
+	videoStatusDraft      = "draft"
+	videoStatusQueued     = "queued"
+	videoStatusProcessing = "processing"
+	videoStatusFailed     = "failed"
+	videoStatusReady      = "ready"
+)
+
+// videoStatus derives a video's processing status from its latest transcode
+// job, which is nil if it never had one, and whether an upload is waiting
+// in the processing queue. jobError says why a job failed.
+func videoStatus(video database.Video, job *database.TranscodeJob, queued bool) (status, jobError string) {
+	switch {
+	case video.VideoURL != nil:
+		return videoStatusReady, ""
+	case queued:
+		return videoStatusQueued, ""
+	case job != nil && job.Status == string(transcoder.JobStatusError):
+		return videoStatusFailed, job.Error
+	case job != nil:
+		return videoStatusProcessing, ""
+	}
+	return videoStatusDraft, ""
+}
+
+// handlerVideoMetaGet describes a video and its artifacts without issuing
+// any URLs, so dashboards and crawlers can poll it cheaply.
+func (cfg *apiConfig) handlerVideoMetaGet(w http.ResponseWriter, r *http.Request) {
+	type artifactMeta struct {
+		Kind       database.ArtifactKind `json:"kind"`
+		CreatedAt  time.Time             `json:"created_at"`
+		SizeBytes  int64                 `json:"size_bytes"`
+		Codec      string                `json:"codec"`
+		Width      int                   `json:"width"`
+		Height     int                   `json:"height"`
+		Bitrate    int64                 `json:"bitrate"`
+		DurationMS int64                 `json:"duration_ms"`
+	}
+	type response struct {
+		ID           uuid.UUID      `json:"id"`
+		Title        string         `json:"title"`
+		UpdatedAt    time.Time      `json:"updated_at"`
+		Status       string         `json:"status"`
+		Error        string         `json:"error,omitempty"`
+		DurationMS   int64          `json:"duration_ms"`
+		SizeBytes    int64          `json:"size_bytes"`
+		HasThumbnail bool           `json:"has_thumbnail"`
+		Artifacts    []artifactMeta `json:"artifacts"`
+
+		// ThumbnailPending is set while a thumbnail is being generated.
+		ThumbnailPending bool `json:"thumbnail_pending"`
+	}
+
+	videoID, err := uuid.Parse(r.PathValue("videoID"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid video ID", err)
+		return
+	}
+	video, err := cfg.db.GetVideo(videoID)
+	if err != nil {
+		respondWithError(w, http.StatusNotFound, "Couldn't get video", err)
+		return
+	}
+	if !cfg.checkVideoAvailable(w, video.ID) {
+		return
+	}
+
+	artifacts, err := cfg.db.GetAllArtifacts(video.ID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get video artifacts", err)
+		return
+	}
+	job, err := cfg.db.GetLatestTranscodeJob(video.ID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get transcode job", err)
+		return
+	}
+	queued, err := cfg.db.GetQueuedUpload(video.ID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get queued upload", err)
+		return
+	}
+	thumbnailJob, err := cfg.db.GetThumbnailJob(video.ID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get thumbnail job", err)
+		return
+	}
+	// Jobs finish without touching the video, so they're part of the tag,
+	// as is leaving the processing queue.
+	etag := []any{video.ID, video.UpdatedAt.UnixNano(), queued != nil, thumbnailJob != nil}
+	if job != nil {
+		etag = append(etag, job.ID, job.Status, job.UpdatedAt.UnixNano())
+	}
+	setLastModified(w, video)
+	if !checkNoneMatch(w, r, cfg.responseETag(etag...)) {
+		return
+	}
+
+	resp := response{
+		ID:           video.ID,
+		Title:        video.Title,
+		UpdatedAt:    video.UpdatedAt,
+		SizeBytes:    video.SizeBytes,
+		HasThumbnail: video.ThumbnailURL != nil,
+		Artifacts:    make([]artifactMeta, 0, len(artifacts)),
+
+		ThumbnailPending: thumbnailJob != nil,
+	}
+	for _, a := range artifacts {
+		resp.Artifacts = append(resp.Artifacts, artifactMeta{
+			Kind:       a.Kind,
+			CreatedAt:  a.CreatedAt,
+			SizeBytes:  a.SizeBytes,
+			Codec:      a.Codec,
+			Width:      a.Width,
+			Height:     a.Height,
+			Bitrate:    a.Bitrate,
+			DurationMS: a.DurationMS,
+		})
+		if a.Kind == database.ArtifactKindVideo || a.Kind == database.ArtifactKindRendition {
+			resp.DurationMS = max(resp.DurationMS, a.DurationMS)
+		}
+	}
+
+	resp.Status, resp.Error = videoStatus(video, job, queued != nil)
+
+	respondWithJSON(w, http.StatusOK, resp)
 }
 
 func (cfg *apiConfig) handlerVideosRetrieve(w http.ResponseWriter, r *http.Request) {
@@ -104,17 +409,136 @@ func (cfg *apiConfig) handlerVideosRetrieve(w http.ResponseWriter, r *http.Reque
 		respondWithError(w, http.StatusUnauthorized, "Couldn't find JWT", err)
 		return
 	}
-	userID, err := auth.ValidateJWT(token, cfg.jwtSecret)
+	userID, err := cfg.validateJWT(token)
 	if err != nil {
 		respondWithError(w, http.StatusUnauthorized, "Couldn't validate JWT", err)
 		return
 	}
 
-	videos, err := cfg.db.GetVideos(userID)
+	page, paged, ok := parsePageParams(w, r)
+	if !ok {
+		return
+	}
+	version := requestAPIVersion(r)
+	allowedFields := videoFields
+	if version >= apiV2 {
+		allowedFields = videoFieldsV2
+	}
+	fields, ok := parseFields(w, r, allowedFields)
+	if !ok {
+		return
+	}
+	filter, ok := cfg.parseMetadataFilter(w, r.URL.Query())
+	if !ok {
+		return
+	}
+
+	var videos []database.Video
+	if paged || filter.Metadata != nil {
+		var next *database.VideoCursor
+		videos, next, err = cfg.db.GetFilteredVideosPage(userID, filter, page.after, page.limit)
+		if next != nil {
+			w.Header().Set(nextCursorHeader, next.Encode())
+		}
+	} else {
+		videos, err = cfg.db.GetVideos(userID)
+	}
 	if err != nil {
 		respondWithError(w, http.StatusInternalServerError, "Couldn't retrieve videos", err)
 		return
 	}
 
-	respondWithJSON(w, http.StatusOK, videos)
+	ids := make([]uuid.UUID, 0, len(videos))
+	for _, video := range videos {
+		ids = append(ids, video.ID)
+	}
+	// Unavailable videos stay listed for their owner, but without a URL.
+	unavailable, err := cfg.unavailableVideos(ids)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't retrieve takedowns", err)
+		return
+	}
+	statuses := map[uuid.UUID]string{}
+	if version >= apiV2 && fields.has("status") {
+		jobs, err := cfg.db.GetLatestTranscodeJobs(ids)
+		if err != nil {
+			respondWithError(w, http.StatusInternalServerError, "Couldn't get transcode jobs", err)
+			return
+		}
+		queued, err := cfg.db.GetQueuedUploadsByVideo(ids)
+		if err != nil {
+			respondWithError(w, http.StatusInternalServerError, "Couldn't get queued uploads", err)
+			return
+		}
+		for _, video := range videos {
+			var job *database.TranscodeJob
+			if j, ok := jobs[video.ID]; ok {
+				job = &j
+			}
+			_, isQueued := queued[video.ID]
+			statuses[video.ID], _ = videoStatus(video, job, isQueued)
+		}
+	}
+
+	// The tag covers the query too, since it shapes the response.
+	etag := []any{r.URL.RawQuery, w.Header().Get(nextCursorHeader)}
+	for _, video := range videos {
+		etag = append(etag, video.ID, video.UpdatedAt.UnixNano(), unavailable[video.ID], statuses[video.ID])
+	}
+	if !checkNoneMatch(w, r, cfg.responseETag(etag...)) {
+		return
+	}
+
+	available := make([]database.Video, 0, len(videos))
+	for i := range videos {
+		if unavailable[videos[i].ID] {
+			videos[i].VideoURL = nil
+			continue
+		}
+		available = append(available, videos[i])
+	}
+	// Presigning is the expensive part, so it's skipped unless a field
+	// that carries a URL was asked for.
+	urls := map[uuid.UUID]videoURLs{}
+	if fields.has("urls", "video_url", "renditions") {
+		urls, err = cfg.resolveVideoURLs(available)
+		if err != nil {
+			respondWithError(w, http.StatusInternalServerError, "Couldn't resolve video URLs", err)
+			return
+		}
+	}
+
+	// include=renditions predates urls and is kept for older clients.
+	type videoWithRenditions struct {
+		videoResponse
+		Renditions []rendition `json:"renditions"`
+	}
+	includeRenditions := r.URL.Query().Get("include") == "renditions" || fields["renditions"]
+
+	response := make([]any, 0, len(videos))
+	for _, video := range videos {
+		var item videoResponse
+		if videoURLs, ok := urls[video.ID]; ok {
+			item = withURLs(video, &videoURLs)
+		} else {
+			item = withURLs(video, nil)
+		}
+		var entry any = item
+		if version >= apiV2 {
+			entry = videoToV2(video, item.URLs, statuses[video.ID])
+		} else if includeRenditions {
+			renditions := []rendition{}
+			if item.URLs != nil {
+				renditions = item.URLs.Renditions
+			}
+			entry = videoWithRenditions{videoResponse: item, Renditions: renditions}
+		}
+		entry, err = selectFields(entry, fields)
+		if err != nil {
+			respondWithError(w, http.StatusInternalServerError, "Couldn't select fields", err)
+			return
+		}
+		response = append(response, entry)
+	}
+	respondWithJSON(w, http.StatusOK, response)
 }
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/auth"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/google/uuid"
+)
+
+// newTestConfig returns a config with a fresh database, enough for handlers
+// that don't touch S3 or ffmpeg.
+func newTestConfig(t *testing.T) *apiConfig {
+	t.Helper()
+	db, err := database.NewClient(filepath.Join(t.TempDir(), "tubely.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &apiConfig{db: db, jwtSecret: "secret", assetsRoot: t.TempDir()}
+}
+
+// newTestVideo creates a user with a video, returning the video and an
+// access token of its owner.
+func newTestVideo(t *testing.T, cfg *apiConfig) (database.Video, string) {
+	t.Helper()
+	user, err := cfg.db.CreateUser(database.CreateUserParams{Email: uuid.NewString() + "@example.com", Password: "password"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	video, err := cfg.db.CreateVideo(database.CreateVideoParams{Title: "Test", UserID: user.ID})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return video, newTestToken(t, cfg, user.ID)
+}
+
+// newTestToken logs the user in, returning an access token of the new
+// session.
+func newTestToken(t *testing.T, cfg *apiConfig, userID uuid.UUID) string {
+	t.Helper()
+	session, err := cfg.db.CreateRefreshToken(database.CreateRefreshTokenParams{
+		Token:     uuid.NewString(),
+		UserID:    userID,
+		ExpiresAt: time.Now().UTC().Add(time.Hour),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	token, err := auth.MakeJWT(userID, session.ID, cfg.jwtSecret, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return token
+}
@@ -0,0 +1,226 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/inbound"
+	"github.com/google/uuid"
+)
+
+const (
+	importSourceEmail = "email"
+
+	// maxInboundEmailVideos bounds the attachments and links imported from
+	// one email.
+	maxInboundEmailVideos = 10
+)
+
+// handlerInboundEmailWebhook receives the SNS messages SES publishes for
+// received email. The email is handled in the background, since SNS gives
+// up on slow endpoints and retries.
+func (cfg *apiConfig) handlerInboundEmailWebhook(w http.ResponseWriter, r *http.Request) {
+	if cfg.inboundEmail == nil {
+		respondWithError(w, http.StatusNotFound, "Inbound email is not enabled", nil)
+		return
+	}
+
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxWebhookBodySize))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Couldn't read request body", err)
+		return
+	}
+	msg, err := cfg.inboundEmail.Parse(r.Context(), body)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Invalid signature", err)
+		return
+	}
+
+	switch msg.Type {
+	case inbound.TypeSubscriptionConfirmation:
+		if err := cfg.inboundEmail.Confirm(r.Context(), msg); err != nil {
+			respondWithError(w, http.StatusBadGateway, "Couldn't confirm SNS subscription", err)
+			return
+		}
+		log.Printf("Confirmed SNS subscription to %s", msg.TopicARN)
+	case inbound.TypeNotification:
+		var notification inbound.SESNotification
+		if err := json.Unmarshal([]byte(msg.Message), &notification); err != nil {
+			respondWithError(w, http.StatusBadRequest, "Couldn't parse webhook payload", err)
+			return
+		}
+		if notification.NotificationType == "Received" {
+			go cfg.receiveEmail(notification)
+		}
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// receiveEmail imports the videos attached to or linked from an email as
+// drafts of the sender, who has to be a user with a verified address. Mail
+// from anyone else is dropped without a reply, so forged senders can't use
+// the app to send mail.
+func (cfg *apiConfig) receiveEmail(notification inbound.SESNotification) {
+	ctx := context.Background()
+	messageID := notification.Mail.MessageID
+
+	sender, err := notification.Sender()
+	if err != nil {
+		log.Printf("Dropping email %s: %v", messageID, err)
+		return
+	}
+	user, err := cfg.db.GetUserByEmail(sender)
+	if err != nil {
+		log.Printf("Couldn't look up the sender of email %s: %v", messageID, err)
+		return
+	}
+	if user.ID == uuid.Nil || user.EmailVerifiedAt == nil {
+		log.Printf("Dropping email %s from %s, who isn't a verified user", messageID, sender)
+		return
+	}
+	isNew, err := cfg.db.RecordInboundEmail(messageID)
+	if err != nil {
+		log.Printf("Couldn't record email %s: %v", messageID, err)
+		return
+	}
+	if !isNew {
+		return
+	}
+
+	raw, err := cfg.openInboundEmail(ctx, notification)
+	if err != nil {
+		log.Printf("Couldn't read email %s: %v", messageID, err)
+		return
+	}
+	defer raw.Close()
+
+	dir, err := os.MkdirTemp("", "tubely-email_*")
+	if err != nil {
+		log.Printf("Couldn't stage email %s: %v", messageID, err)
+		return
+	}
+	videos, files, email, err := stageEmailVideos(raw, dir)
+	if err != nil {
+		os.RemoveAll(dir)
+		log.Printf("Couldn't parse email %s: %v", messageID, err)
+		return
+	}
+	if len(videos) == 0 {
+		os.RemoveAll(dir)
+		err := cfg.sendTemplatedEmail(sender, "inbound_email_empty", map[string]string{"Subject": email.Subject})
+		if err != nil {
+			log.Printf("Couldn't reply to email %s: %v", messageID, err)
+		}
+		return
+	}
+
+	items := make([]database.CreateVideoImportItemParams, 0, len(videos))
+	for _, video := range videos {
+		items = append(items, database.CreateVideoImportItemParams{SourceID: video.id, Title: video.title})
+	}
+	imp, err := cfg.db.CreateVideoImport(user.ID, importSourceEmail, items)
+	if err != nil {
+		os.RemoveAll(dir)
+		log.Printf("Couldn't create import for email %s: %v", messageID, err)
+		return
+	}
+	cfg.runVideoImport(imp.ID, user.ID, videos, files, dir)
+}
+
+// openInboundEmail returns the raw email, read from the bucket of an S3
+// receipt action or the content of an SNS one.
+func (cfg *apiConfig) openInboundEmail(ctx context.Context, notification inbound.SESNotification) (io.ReadCloser, error) {
+	action := notification.Receipt.Action
+	if action.Type != "S3" {
+		r, err := notification.RawContent()
+		return io.NopCloser(r), err
+	}
+	if cfg.inboundEmailBucket == "" || action.BucketName != cfg.inboundEmailBucket {
+		return nil, fmt.Errorf("email was stored in bucket %q instead of INBOUND_EMAIL_BUCKET", action.BucketName)
+	}
+	obj, err := cfg.s3Client.GetObject(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(action.BucketName),
+		Key:    aws.String(action.ObjectKey),
+	})
+	if err != nil {
+		return nil, err
+	}
+	return obj.Body, nil
+}
+
+// stageEmailVideos stages an email's video attachments in dir and lists
+// them, followed by the links to video files in its text, as draft videos
+// named after the email's subject.
+func stageEmailVideos(raw io.Reader, dir string) ([]takeoutVideo, map[string]importFile, inbound.Email, error) {
+	videos := []takeoutVideo{}
+	files := map[string]importFile{}
+	email, err := inbound.ParseEmail(raw, func(filename, contentType string, r io.Reader) error {
+		mediaType := importMediaType(contentType, filename)
+		if !strings.HasPrefix(mediaType, "video/") || len(videos) == maxInboundEmailVideos {
+			return nil
+		}
+		filePath, err := stageImportFile(dir, r)
+		if err != nil {
+			return err
+		}
+		// Attachments are keyed by name, made unique as senders can attach
+		// two files called video.mp4.
+		id := filepath.Base(filename)
+		if _, ok := files[id]; ok || id == "." {
+			id = fmt.Sprintf("%s (%d)", id, len(videos)+1)
+		}
+		files[id] = importFile{path: filePath, mediaType: mediaType}
+		videos = append(videos, takeoutVideo{id: id, draft: true})
+		return nil
+	})
+	if err != nil {
+		return nil, nil, inbound.Email{}, err
+	}
+
+	for _, link := range email.Links {
+		if len(videos) == maxInboundEmailVideos {
+			break
+		}
+		u, err := url.Parse(link)
+		if err != nil {
+			continue
+		}
+		mediaType, _, _ := mime.ParseMediaType(mime.TypeByExtension(strings.ToLower(path.Ext(u.Path))))
+		if !strings.HasPrefix(mediaType, "video/") {
+			continue
+		}
+		videos = append(videos, takeoutVideo{id: link, fileURL: link, draft: true})
+	}
+
+	// Videos are named after the subject, or their file name if there's
+	// none.
+	subject := []rune(strings.TrimSpace(email.Subject))
+	if len(subject) > maxTitleLength {
+		subject = subject[:maxTitleLength]
+	}
+	for i, video := range videos {
+		name := video.id
+		if u, err := url.Parse(video.fileURL); err == nil && video.fileURL != "" {
+			name = path.Base(u.Path)
+		}
+		videos[i].title = string(subject)
+		if len(subject) == 0 {
+			videos[i].title = strings.TrimSuffix(name, path.Ext(name))
+		}
+	}
+	return videos, files, email, nil
+}
@@ -0,0 +1,216 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/auth"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/validate"
+	"github.com/google/uuid"
+)
+
+type uploadHandshakeResponse struct {
+	// Linked means the user already uploaded this file and the video now
+	// has it, so the upload can be skipped.
+	Linked bool            `json:"linked"`
+	Video  *database.Video `json:"video,omitempty"`
+}
+
+// handlerUploadHandshake lets clients skip uploading a file they uploaded
+// before. The client sends the file's SHA-256 (crypto.subtle.digest in a
+// browser); if one of the user's playable videos was made from the same
+// file, its objects are copied to this video within the bucket and the
+// response says so. Otherwise the client goes on with the regular upload.
+func (cfg *apiConfig) handlerUploadHandshake(w http.ResponseWriter, r *http.Request) {
+	videoID, err := uuid.Parse(r.PathValue("videoID"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid ID", err)
+		return
+	}
+
+	token, err := auth.GetBearerToken(r.Header)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Couldn't find JWT", err)
+		return
+	}
+	userID, err := cfg.validateJWT(token)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Couldn't validate JWT", err)
+		return
+	}
+
+	type parameters struct {
+		SHA256 string `json:"sha256"`
+	}
+	params := parameters{}
+	if err := json.NewDecoder(r.Body).Decode(&params); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Couldn't decode parameters", err)
+		return
+	}
+	sum := strings.ToLower(params.SHA256)
+	if decoded, err := hex.DecodeString(sum); err != nil || len(decoded) != 32 {
+		respondWithValidationErrors(w, validate.Errors{"sha256": "must be a hex encoded SHA-256"})
+		return
+	}
+
+	video, err := cfg.db.GetVideo(videoID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't find video", err)
+		return
+	}
+	if video.UserID != userID {
+		respondWithError(w, http.StatusForbidden, "Not authorized to update video", nil)
+		return
+	}
+	if !cfg.checkVideoAvailable(w, video.ID) {
+		return
+	}
+
+	source, err := cfg.db.FindVideoByContentHash(userID, sum)
+	if errors.Is(err, sql.ErrNoRows) {
+		respondWithJSON(w, http.StatusOK, uploadHandshakeResponse{})
+		return
+	}
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't look up previous uploads", err)
+		return
+	}
+	if source.ID == video.ID {
+		respondWithJSON(w, http.StatusOK, uploadHandshakeResponse{Linked: true, Video: &video})
+		return
+	}
+	// Taken down content can't come back under another video.
+	takedown, err := cfg.db.GetTakedown(source.ID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get takedown", err)
+		return
+	}
+	if takedown != nil {
+		respondWithJSON(w, http.StatusOK, uploadHandshakeResponse{})
+		return
+	}
+
+	_, limits, err := cfg.getUserLimits(userID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get plan limits", err)
+		return
+	}
+	err = cfg.checkStorageQuota(userID, limits, source.SizeBytes, video.SizeBytes)
+	if errors.Is(err, errStorageQuotaExceeded) {
+		respondWithError(w, http.StatusForbidden, "Storage quota exceeded for your plan", err)
+		return
+	}
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't check storage quota", err)
+		return
+	}
+
+	if err := cfg.linkVideo(r.Context(), &video, source); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't link previous upload", err)
+		return
+	}
+	cfg.recordContentHash(video.ID, sum)
+	cfg.recordStorageUsage(userID)
+	respondWithJSON(w, http.StatusOK, uploadHandshakeResponse{Linked: true, Video: &video})
+}
+
+// linkVideo gives video copies of all of source's objects and points it at
+// them, as if source's file had been uploaded to it. Copies are made within
+// the bucket, so nothing is transferred. Uploaded thumbnails are content
+// addressed and never deleted, so those are shared instead.
+func (cfg *apiConfig) linkVideo(ctx context.Context, video *database.Video, source database.Video) error {
+	artifacts, err := cfg.db.GetAllArtifacts(source.ID)
+	if err != nil {
+		return err
+	}
+
+	// Every kind the video has now is replaced, even those source lacks.
+	current, err := cfg.db.GetAllArtifacts(video.ID)
+	if err != nil {
+		return err
+	}
+	byKind := map[database.ArtifactKind][]database.CreateArtifactParams{}
+	for _, a := range current {
+		byKind[a.Kind] = []database.CreateArtifactParams{}
+	}
+
+	keys := cfg.objectKeys(video.UserID, video.ID)
+	copied := []string{}
+	newKeys := map[string]string{}
+	for _, a := range artifacts {
+		// Uploaded thumbnails take precedence over generated ones.
+		if a.Kind == database.ArtifactKindThumbnail && video.ThumbnailURL != nil {
+			continue
+		}
+		if a.SizeBytes > maxCopyObjectSize {
+			err = fmt.Errorf("%s is over the %d byte CopyObject limit", a.Key, maxCopyObjectSize)
+			break
+		}
+		key := keys.copyOf(a)
+		_, err = cfg.s3Client.CopyObject(ctx, &s3.CopyObjectInput{
+			Bucket:           aws.String(cfg.s3Bucket),
+			Key:              aws.String(key),
+			CopySource:       aws.String(url.PathEscape(cfg.s3Bucket + "/" + a.Key)),
+			Tagging:          keys.tagging(a.Kind),
+			TaggingDirective: types.TaggingDirectiveReplace,
+		})
+		if err != nil {
+			err = fmt.Errorf("couldn't copy %s: %w", a.Key, err)
+			break
+		}
+		copied = append(copied, key)
+		newKeys[a.Key] = key
+
+		params := a.CreateArtifactParams
+		params.VideoID = video.ID
+		params.Key = key
+		byKind[a.Kind] = append(byKind[a.Kind], params)
+	}
+	if err == nil && source.VideoURL != nil {
+		sourceKey, _ := cfg.distributionKey(*source.VideoURL)
+		if key, ok := newKeys[sourceKey]; ok {
+			videoURL := cfg.distributionURL(key)
+			video.VideoURL = &videoURL
+		} else {
+			err = fmt.Errorf("video URL %s isn't one of the video's artifacts", *source.VideoURL)
+		}
+	}
+	if err != nil {
+		if cleanupErr := cfg.deleteObjects(context.Background(), copied); cleanupErr != nil {
+			log.Printf("Couldn't delete copies made for video %s: %v", video.ID, cleanupErr)
+		}
+		return err
+	}
+
+	for kind, params := range byKind {
+		if err := cfg.replaceArtifacts(ctx, video.ID, kind, params); err != nil {
+			return err
+		}
+	}
+	if video.ThumbnailURL == nil {
+		video.ThumbnailURL = source.ThumbnailURL
+	}
+	video.SizeBytes = source.SizeBytes
+	return cfg.db.UpdateVideo(video)
+}
+
+// recordContentHash remembers which file a video was made from, for the
+// upload handshake. Failing only costs a future instant upload, so it's
+// logged.
+func (cfg *apiConfig) recordContentHash(videoID uuid.UUID, sum string) {
+	if err := cfg.db.SetVideoContentHash(videoID, sum); err != nil {
+		log.Printf("Couldn't record content hash of video %s: %v", videoID, err)
+	}
+}
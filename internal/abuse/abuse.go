@@ -0,0 +1,173 @@
+// Package abuse spots clients requesting far more delivery URLs than anyone
+// watching videos would, and blocks them for a while. State is kept in
+// memory, so limits apply per instance.
+package abuse
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+type Limits struct {
+	// Window is the period requests are counted over.
+	Window time.Duration
+	// MaxRequests per window catches clients hammering URLs, MaxDistinct
+	// catches ones walking the catalog.
+	MaxRequests int
+	MaxDistinct int
+	// Burst is how many requests a client may make over MaxRequests before
+	// being blocked, so MaxRequests is a soft limit that a short spike can
+	// exceed.
+	Burst int
+	// BlockFor is how long a client stays blocked once over a limit.
+	BlockFor time.Duration
+}
+
+// Verdict is the outcome of observing one request.
+type Verdict struct {
+	Blocked    bool
+	RetryAfter time.Duration
+	// NewlyBlocked is only set on the request that triggered the block, so
+	// callers alert once per block.
+	NewlyBlocked bool
+	Reason       string
+	// Limit and Remaining are the window's MaxRequests and how many of them
+	// are left, and Reset is when the window ends, for telling clients to
+	// slow down before they're blocked. Remaining doesn't count the burst.
+	Limit     int
+	Remaining int
+	Reset     time.Duration
+}
+
+// Block is a client that's currently blocked.
+type Block struct {
+	Key          string    `json:"key"`
+	Reason       string    `json:"reason"`
+	BlockedUntil time.Time `json:"blocked_until"`
+}
+
+type Detector struct {
+	limits Limits
+	now    func() time.Time
+
+	mu        sync.Mutex
+	clients   map[string]*client
+	lastSweep time.Time
+}
+
+type client struct {
+	windowStart  time.Time
+	requests     int
+	resources    map[string]struct{}
+	blockedUntil time.Time
+	reason       string
+}
+
+func NewDetector(limits Limits) *Detector {
+	return &Detector{
+		limits:  limits,
+		now:     time.Now,
+		clients: map[string]*client{},
+	}
+}
+
+// Limits returns the limits the detector was created with.
+func (d *Detector) Limits() Limits {
+	return d.limits
+}
+
+// Observe counts a request by key, e.g. a user or IP, for resource, e.g. a
+// video ID, and reports whether the client is blocked.
+func (d *Detector) Observe(key, resource string) Verdict {
+	return d.ObserveWith(key, resource, d.limits)
+}
+
+// ObserveWith is Observe with other limits for this client, such as those
+// of their plan. Window should be the detector's own, which clients are
+// forgotten after.
+func (d *Detector) ObserveWith(key, resource string, limits Limits) Verdict {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	now := d.now()
+	d.sweep(now)
+
+	c := d.clients[key]
+	if c == nil {
+		c = &client{}
+		d.clients[key] = c
+	}
+	if now.Before(c.blockedUntil) {
+		return Verdict{Blocked: true, RetryAfter: c.blockedUntil.Sub(now), Reason: c.reason, Limit: limits.MaxRequests}
+	}
+	if now.Sub(c.windowStart) >= limits.Window {
+		c.windowStart = now
+		c.requests = 0
+		c.resources = map[string]struct{}{}
+	}
+
+	c.requests++
+	c.resources[resource] = struct{}{}
+	switch {
+	case limits.MaxRequests > 0 && c.requests > limits.MaxRequests+limits.Burst:
+		c.reason = "too many requests"
+	case limits.MaxDistinct > 0 && len(c.resources) > limits.MaxDistinct:
+		c.reason = "too many distinct videos"
+	default:
+		return Verdict{
+			Limit:     limits.MaxRequests,
+			Remaining: max(limits.MaxRequests-c.requests, 0),
+			Reset:     c.windowStart.Add(limits.Window).Sub(now),
+		}
+	}
+
+	c.blockedUntil = now.Add(limits.BlockFor)
+	c.windowStart = time.Time{}
+	return Verdict{Blocked: true, RetryAfter: limits.BlockFor, NewlyBlocked: true, Reason: c.reason, Limit: limits.MaxRequests}
+}
+
+// Blocks lists the clients that are blocked right now, soonest unblocked
+// first.
+func (d *Detector) Blocks() []Block {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	now := d.now()
+	blocks := []Block{}
+	for key, c := range d.clients {
+		if now.Before(c.blockedUntil) {
+			blocks = append(blocks, Block{Key: key, Reason: c.reason, BlockedUntil: c.blockedUntil})
+		}
+	}
+	sort.Slice(blocks, func(i, j int) bool { return blocks[i].BlockedUntil.Before(blocks[j].BlockedUntil) })
+	return blocks
+}
+
+// Unblock lifts a block early and forgets the client's counts. It reports
+// whether the client was blocked.
+func (d *Detector) Unblock(key string) bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	c, ok := d.clients[key]
+	if !ok {
+		return false
+	}
+	delete(d.clients, key)
+	return d.now().Before(c.blockedUntil)
+}
+
+// sweep drops clients that are neither blocked nor counted in a current
+// window, at most once per window.
+func (d *Detector) sweep(now time.Time) {
+	if now.Sub(d.lastSweep) < d.limits.Window {
+		return
+	}
+	d.lastSweep = now
+	for key, c := range d.clients {
+		if !now.Before(c.blockedUntil) && now.Sub(c.windowStart) >= d.limits.Window {
+			delete(d.clients, key)
+		}
+	}
+}
@@ -0,0 +1,158 @@
+package accesslog
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type Format string
+
+const (
+	FormatS3         Format = "s3"
+	FormatCloudFront Format = "cloudfront"
+)
+
+func ParseFormat(s string) (Format, error) {
+	switch f := Format(s); f {
+	case FormatS3, FormatCloudFront:
+		return f, nil
+	}
+	return "", fmt.Errorf("unknown access log format %q", s)
+}
+
+// Entry is a single successful object delivery.
+type Entry struct {
+	Time  time.Time
+	Key   string
+	Bytes int64
+}
+
+// Parse reads a whole log file, transparently decompressing gzip files as
+// CloudFront writes them, and returns the object deliveries it contains.
+// Lines that aren't successful downloads are skipped.
+func Parse(r io.Reader, format Format) ([]Entry, error) {
+	br := bufio.NewReader(r)
+	magic, err := br.Peek(2)
+	if err == nil && bytes.Equal(magic, []byte{0x1f, 0x8b}) {
+		gz, err := gzip.NewReader(br)
+		if err != nil {
+			return nil, err
+		}
+		defer gz.Close()
+		r = gz
+	} else {
+		r = br
+	}
+
+	parseLine := parseS3Line
+	if format == FormatCloudFront {
+		parseLine = parseCloudFrontLine
+	}
+
+	entries := []Entry{}
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		if entry, ok := parseLine(scanner.Text()); ok {
+			entries = append(entries, entry)
+		}
+	}
+	return entries, scanner.Err()
+}
+
+// parseS3Line parses a line of S3 server access logs. Only GET.OBJECT
+// requests that returned content are counted.
+func parseS3Line(line string) (Entry, bool) {
+	fields := splitS3Fields(line)
+	if len(fields) < 12 {
+		return Entry{}, false
+	}
+	if fields[6] != "REST.GET.OBJECT" || !isSuccess(fields[9]) {
+		return Entry{}, false
+	}
+
+	t, err := time.Parse("02/Jan/2006:15:04:05 -0700", fields[2])
+	if err != nil {
+		return Entry{}, false
+	}
+	key, err := url.PathUnescape(fields[7])
+	if err != nil {
+		return Entry{}, false
+	}
+	sent, err := strconv.ParseInt(fields[11], 10, 64)
+	if err != nil {
+		return Entry{}, false
+	}
+	return Entry{Time: t.UTC(), Key: key, Bytes: sent}, true
+}
+
+// splitS3Fields splits on spaces, keeping [bracketed] and "quoted" values
+// together and without their delimiters.
+func splitS3Fields(line string) []string {
+	var fields []string
+	for i := 0; i < len(line); {
+		switch line[i] {
+		case ' ':
+			i++
+		case '[', '"':
+			closing := byte(']')
+			if line[i] == '"' {
+				closing = '"'
+			}
+			end := strings.IndexByte(line[i+1:], closing)
+			if end < 0 {
+				return append(fields, line[i+1:])
+			}
+			fields = append(fields, line[i+1:i+1+end])
+			i += end + 2
+		default:
+			end := strings.IndexByte(line[i:], ' ')
+			if end < 0 {
+				return append(fields, line[i:])
+			}
+			fields = append(fields, line[i:i+end])
+			i += end
+		}
+	}
+	return fields
+}
+
+// parseCloudFrontLine parses a line of CloudFront standard logs, which are
+// tab separated with a fixed field order.
+func parseCloudFrontLine(line string) (Entry, bool) {
+	if strings.HasPrefix(line, "#") {
+		return Entry{}, false
+	}
+	fields := strings.Split(line, "\t")
+	if len(fields) < 9 {
+		return Entry{}, false
+	}
+	if fields[5] != "GET" || !isSuccess(fields[8]) {
+		return Entry{}, false
+	}
+
+	t, err := time.Parse("2006-01-02 15:04:05", fields[0]+" "+fields[1])
+	if err != nil {
+		return Entry{}, false
+	}
+	key, err := url.PathUnescape(strings.TrimPrefix(fields[7], "/"))
+	if err != nil {
+		return Entry{}, false
+	}
+	sent, err := strconv.ParseInt(fields[3], 10, 64)
+	if err != nil {
+		return Entry{}, false
+	}
+	return Entry{Time: t.UTC(), Key: key, Bytes: sent}, true
+}
+
+func isSuccess(status string) bool {
+	return status == "200" || status == "206"
+}
@@ -0,0 +1,67 @@
+package billing
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/transcoder"
+)
+
+type Plan string
+
+const (
+	PlanFree Plan = "free"
+	PlanPro  Plan = "pro"
+)
+
+// Limits are what a plan entitles a user to.
+type Limits struct {
+	StorageQuotaBytes int64
+	MaxDuration       time.Duration
+	// MaxPreset is the highest rendition ladder jobs may be transcoded with.
+	MaxPreset transcoder.Preset
+}
+
+var planLimits = map[Plan]Limits{
+	PlanFree: {
+		StorageQuotaBytes: 1 << 30, // 1 GB
+		MaxDuration:       10 * time.Minute,
+		MaxPreset:         transcoder.PresetSD,
+	},
+	PlanPro: {
+		StorageQuotaBytes: 100 << 30, // 100 GB
+		MaxDuration:       2 * time.Hour,
+		MaxPreset:         transcoder.PresetFHD,
+	},
+}
+
+func ParsePlan(s string) (Plan, error) {
+	if _, ok := planLimits[Plan(s)]; !ok {
+		return "", fmt.Errorf("unknown plan %q", s)
+	}
+	return Plan(s), nil
+}
+
+// LimitsFor returns the limits of a plan, falling back to the free plan for
+// unknown values.
+func LimitsFor(plan Plan) Limits {
+	if limits, ok := planLimits[plan]; ok {
+		return limits
+	}
+	return planLimits[PlanFree]
+}
+
+var presetRank = map[transcoder.Preset]int{
+	transcoder.PresetSD:  0,
+	transcoder.PresetHD:  1,
+	transcoder.PresetFHD: 2,
+}
+
+// CapPreset returns the requested preset, lowered to the plan's maximum if
+// it is above it.
+func (l Limits) CapPreset(requested transcoder.Preset) transcoder.Preset {
+	if presetRank[requested] > presetRank[l.MaxPreset] {
+		return l.MaxPreset
+	}
+	return requested
+}
@@ -0,0 +1,151 @@
+package billing
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	stripeAPIBase = "https://api.stripe.com/v1"
+	// maxSignatureAge matches the tolerance used by Stripe's own libraries.
+	maxSignatureAge = 5 * time.Minute
+)
+
+var ErrInvalidSignature = errors.New("invalid stripe signature")
+
+// Stripe is a minimal client for the parts of the Stripe API used for
+// subscriptions: hosted checkout and webhooks.
+type Stripe struct {
+	secretKey     string
+	webhookSecret string
+	proPriceID    string
+	httpClient    *http.Client
+}
+
+func NewStripe(secretKey, webhookSecret, proPriceID string) *Stripe {
+	return &Stripe{
+		secretKey:     secretKey,
+		webhookSecret: webhookSecret,
+		proPriceID:    proPriceID,
+		httpClient:    &http.Client{Timeout: 15 * time.Second},
+	}
+}
+
+type CheckoutParams struct {
+	UserID     string
+	Email      string
+	CustomerID string
+	SuccessURL string
+	CancelURL  string
+}
+
+// CreateCheckoutSession starts a hosted checkout for the pro subscription and
+// returns the URL to redirect the user to.
+func (s *Stripe) CreateCheckoutSession(ctx context.Context, params CheckoutParams) (string, error) {
+	form := url.Values{}
+	form.Set("mode", "subscription")
+	form.Set("line_items[0][price]", s.proPriceID)
+	form.Set("line_items[0][quantity]", "1")
+	form.Set("success_url", params.SuccessURL)
+	form.Set("cancel_url", params.CancelURL)
+	form.Set("client_reference_id", params.UserID)
+	if params.CustomerID != "" {
+		form.Set("customer", params.CustomerID)
+	} else {
+		form.Set("customer_email", params.Email)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, stripeAPIBase+"/checkout/sessions", strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", err
+	}
+	req.SetBasicAuth(s.secretKey, "")
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	resp, err := s.httpClient.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	var session struct {
+		URL   string `json:"url"`
+		Error struct {
+			Message string `json:"message"`
+		} `json:"error"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&session); err != nil {
+		return "", fmt.Errorf("couldn't decode stripe response: %w", err)
+	}
+	if resp.StatusCode > 299 {
+		return "", fmt.Errorf("stripe responded with status %d: %s", resp.StatusCode, session.Error.Message)
+	}
+	return session.URL, nil
+}
+
+// Event is the subset of a Stripe webhook event the app reacts to.
+type Event struct {
+	ID   string `json:"id"`
+	Type string `json:"type"`
+	Data struct {
+		Object struct {
+			ID                string `json:"id"`
+			Customer          string `json:"customer"`
+			Subscription      string `json:"subscription"`
+			ClientReferenceID string `json:"client_reference_id"`
+			Status            string `json:"status"`
+		} `json:"object"`
+	} `json:"data"`
+}
+
+// ParseWebhook verifies the Stripe-Signature header and decodes the event.
+func (s *Stripe) ParseWebhook(header string, body []byte, now time.Time) (Event, error) {
+	var timestamp string
+	var signatures []string
+	for _, part := range strings.Split(header, ",") {
+		key, value, _ := strings.Cut(strings.TrimSpace(part), "=")
+		switch key {
+		case "t":
+			timestamp = value
+		case "v1":
+			signatures = append(signatures, value)
+		}
+	}
+
+	ts, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil || now.Sub(time.Unix(ts, 0)) > maxSignatureAge {
+		return Event{}, ErrInvalidSignature
+	}
+
+	mac := hmac.New(sha256.New, []byte(s.webhookSecret))
+	mac.Write([]byte(timestamp + "."))
+	mac.Write(body)
+	expected := hex.EncodeToString(mac.Sum(nil))
+
+	valid := false
+	for _, sig := range signatures {
+		if hmac.Equal([]byte(sig), []byte(expected)) {
+			valid = true
+			break
+		}
+	}
+	if !valid {
+		return Event{}, ErrInvalidSignature
+	}
+
+	var event Event
+	if err := json.Unmarshal(body, &event); err != nil {
+		return Event{}, fmt.Errorf("couldn't decode stripe event: %w", err)
+	}
+	return event, nil
+}
@@ -0,0 +1,108 @@
+package costs
+
+import (
+	"time"
+)
+
+// List prices in USD for us-east-1. They are only used to give admins a
+// ballpark figure, the AWS bill remains the source of truth.
+var storagePerGBMonth = map[string]float64{
+	"STANDARD":            0.023,
+	"INTELLIGENT_TIERING": 0.023,
+	"STANDARD_IA":         0.0125,
+	"ONEZONE_IA":          0.01,
+	"GLACIER_IR":          0.004,
+	"GLACIER":             0.0036,
+	"DEEP_ARCHIVE":        0.00099,
+}
+
+const (
+	getPer1000     = 0.0004
+	putPer1000     = 0.005
+	egressPerGB    = 0.085
+	bytesPerGB     = 1 << 30
+	defaultStorage = "STANDARD"
+)
+
+type StorageClassUsage struct {
+	StorageClass   string  `json:"storage_class"`
+	Objects        int64   `json:"objects"`
+	Bytes          int64   `json:"bytes"`
+	MonthlyCostUSD float64 `json:"monthly_cost_usd"`
+}
+
+type Line struct {
+	MonthToDateUSD float64 `json:"month_to_date_usd"`
+	ProjectedUSD   float64 `json:"projected_usd"`
+}
+
+// Inputs are the month-to-date figures an estimate is built from.
+type Inputs struct {
+	Now            time.Time
+	Storage        map[string]StorageClassUsage
+	GetRequests    int64
+	PutRequests    int64
+	EgressBytes    int64
+	TranscodingUSD float64
+}
+
+type Estimate struct {
+	Month       string              `json:"month"`
+	DaysElapsed float64             `json:"days_elapsed"`
+	DaysInMonth int                 `json:"days_in_month"`
+	Storage     []StorageClassUsage `json:"storage"`
+	StorageCost Line                `json:"storage_cost"`
+	Requests    Line                `json:"requests_cost"`
+	Egress      Line                `json:"egress_cost"`
+	Transcoding Line                `json:"transcoding_cost"`
+	Total       Line                `json:"total"`
+}
+
+// Calculate prices the inputs and projects month-to-date activity linearly
+// to the end of the month. Storage is billed on what is stored now, as if it
+// had been stored for the whole month.
+func Calculate(in Inputs) Estimate {
+	now := in.Now.UTC()
+	start := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC)
+	daysInMonth := start.AddDate(0, 1, -1).Day()
+	elapsed := now.Sub(start).Hours() / 24
+	if elapsed < 1.0/24 {
+		elapsed = 1.0 / 24
+	}
+	fraction := elapsed / float64(daysInMonth)
+
+	est := Estimate{
+		Month:       start.Format("2006-01"),
+		DaysElapsed: elapsed,
+		DaysInMonth: daysInMonth,
+		Storage:     []StorageClassUsage{},
+	}
+
+	var storageMonthly float64
+	for class, usage := range in.Storage {
+		rate, ok := storagePerGBMonth[class]
+		if !ok {
+			rate = storagePerGBMonth[defaultStorage]
+		}
+		usage.StorageClass = class
+		usage.MonthlyCostUSD = float64(usage.Bytes) / bytesPerGB * rate
+		storageMonthly += usage.MonthlyCostUSD
+		est.Storage = append(est.Storage, usage)
+	}
+	est.StorageCost = Line{MonthToDateUSD: storageMonthly * fraction, ProjectedUSD: storageMonthly}
+
+	requests := float64(in.GetRequests)/1000*getPer1000 + float64(in.PutRequests)/1000*putPer1000
+	est.Requests = project(requests, fraction)
+	est.Egress = project(float64(in.EgressBytes)/bytesPerGB*egressPerGB, fraction)
+	est.Transcoding = project(in.TranscodingUSD, fraction)
+
+	for _, line := range []Line{est.StorageCost, est.Requests, est.Egress, est.Transcoding} {
+		est.Total.MonthToDateUSD += line.MonthToDateUSD
+		est.Total.ProjectedUSD += line.ProjectedUSD
+	}
+	return est
+}
+
+func project(monthToDate, fraction float64) Line {
+	return Line{MonthToDateUSD: monthToDate, ProjectedUSD: monthToDate / fraction}
+}
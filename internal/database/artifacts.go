@@ -0,0 +1,185 @@
+package database
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// ArtifactKind says what role an object plays for its video.
+type ArtifactKind string
+
+const (
+	// ArtifactKindSource is an untouched original kept for external
+	// transcoding.
+	ArtifactKindSource ArtifactKind = "source"
+	// ArtifactKindVideo is the single fast start encode made locally.
+	ArtifactKindVideo ArtifactKind = "video"
+	// ArtifactKindRendition is one output of an external transcode.
+	ArtifactKindRendition ArtifactKind = "rendition"
+	// ArtifactKindThumbnail is a thumbnail kept in the bucket rather than
+	// in the assets directory.
+	ArtifactKindThumbnail ArtifactKind = "thumbnail"
+	// ArtifactKindCaptions is a WebVTT captions track.
+	ArtifactKindCaptions ArtifactKind = "captions"
+	// ArtifactKindPreview is a short clip played on hover.
+	ArtifactKindPreview ArtifactKind = "preview"
+	// ArtifactKindSprite is a sheet of frames for scrubbing previews.
+	ArtifactKindSprite ArtifactKind = "sprite"
+	// ArtifactKindAudioDescription is an audio track narrating what's on
+	// screen, also muxed into the video.
+	ArtifactKindAudioDescription ArtifactKind = "audio_description"
+	// ArtifactKindAudioTrack is an audio track in another language, also
+	// muxed into the video.
+	ArtifactKindAudioTrack ArtifactKind = "audio_track"
+)
+
+// Artifact is an object in the bucket derived from a video.
+type Artifact struct {
+	ID        int64     `json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+	CreateArtifactParams
+}
+
+type CreateArtifactParams struct {
+	VideoID    uuid.UUID    `json:"video_id"`
+	Kind       ArtifactKind `json:"kind"`
+	Key        string       `json:"key"`
+	SizeBytes  int64        `json:"size_bytes"`
+	Codec      string       `json:"codec"`
+	Width      int          `json:"width"`
+	Height     int          `json:"height"`
+	Bitrate    int64        `json:"bitrate"`
+	DurationMS int64        `json:"duration_ms"`
+	// Language is the BCP 47 tag of an audio track, empty for other kinds.
+	Language string `json:"language,omitempty"`
+}
+
+const artifactColumns = `id, created_at, video_id, kind, key, size_bytes, codec, width, height, bitrate, duration_ms, language`
+
+type rowScanner interface {
+	Scan(dest ...any) error
+}
+
+func scanArtifact(row rowScanner) (Artifact, error) {
+	var a Artifact
+	err := row.Scan(
+		&a.ID,
+		&a.CreatedAt,
+		&a.VideoID,
+		&a.Kind,
+		&a.Key,
+		&a.SizeBytes,
+		&a.Codec,
+		&a.Width,
+		&a.Height,
+		&a.Bitrate,
+		&a.DurationMS,
+		&a.Language,
+	)
+	return a, err
+}
+
+// ReplaceArtifacts swaps all artifacts of one kind for a video in a single
+// transaction, so a re-delivered webhook never leaves duplicates. It returns
+// the keys of the artifacts that were replaced and aren't part of the new
+// set, so the caller can remove those objects.
+func (c Client) ReplaceArtifacts(videoID uuid.UUID, kind ArtifactKind, artifacts []CreateArtifactParams) ([]string, error) {
+	tx, err := c.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.Query(`DELETE FROM artifacts WHERE video_id = ? AND kind = ? RETURNING key`, videoID, kind)
+	if err != nil {
+		return nil, err
+	}
+	removed := map[string]bool{}
+	for rows.Next() {
+		var key string
+		if err := rows.Scan(&key); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		removed[key] = true
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	query := `
+	INSERT INTO artifacts (
+		created_at,
+		video_id,
+		kind,
+		key,
+		size_bytes,
+		codec,
+		width,
+		height,
+		bitrate,
+		duration_ms,
+		language
+	) VALUES (CURRENT_TIMESTAMP, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+	ON CONFLICT(key) DO UPDATE SET
+		video_id = excluded.video_id,
+		kind = excluded.kind,
+		size_bytes = excluded.size_bytes,
+		codec = excluded.codec,
+		width = excluded.width,
+		height = excluded.height,
+		bitrate = excluded.bitrate,
+		duration_ms = excluded.duration_ms,
+		language = excluded.language
+	`
+	for _, a := range artifacts {
+		_, err = tx.Exec(query, videoID, kind, a.Key, a.SizeBytes, a.Codec, a.Width, a.Height, a.Bitrate, a.DurationMS, a.Language)
+		if err != nil {
+			return nil, err
+		}
+		delete(removed, a.Key)
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	keys := make([]string, 0, len(removed))
+	for key := range removed {
+		keys = append(keys, key)
+	}
+	return keys, nil
+}
+
+// GetArtifacts returns a video's artifacts of the given kind, largest
+// resolution first.
+func (c Client) GetArtifacts(videoID uuid.UUID, kind ArtifactKind) ([]Artifact, error) {
+	artifacts, err := c.GetArtifactsForVideos([]uuid.UUID{videoID}, kind)
+	if err != nil {
+		return nil, err
+	}
+	if artifacts[videoID] == nil {
+		return []Artifact{}, nil
+	}
+	return artifacts[videoID], nil
+}
+
+// GetAllArtifacts returns every artifact of a video regardless of kind.
+func (c Client) GetAllArtifacts(videoID uuid.UUID) ([]Artifact, error) {
+	rows, err := c.db.Query(`SELECT `+artifactColumns+` FROM artifacts WHERE video_id = ? ORDER BY id`, videoID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	artifacts := []Artifact{}
+	for rows.Next() {
+		a, err := scanArtifact(rows)
+		if err != nil {
+			return nil, err
+		}
+		artifacts = append(artifacts, a)
+	}
+	return artifacts, rows.Err()
+}
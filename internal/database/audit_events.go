@@ -0,0 +1,35 @@
+package database
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type AuditEvent struct {
+	ID        int64     `json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+	CreateAuditEventParams
+}
+
+type CreateAuditEventParams struct {
+	Event     string     `json:"event"`
+	UserID    *uuid.UUID `json:"user_id"`
+	Email     string     `json:"email"`
+	IPAddress string     `json:"ip_address"`
+	Details   string     `json:"details"`
+}
+
+func (c Client) CreateAuditEvent(params CreateAuditEventParams) error {
+	query := `
+		INSERT INTO audit_events (created_at, event, user_id, email, ip_address, details)
+		VALUES (CURRENT_TIMESTAMP, ?, ?, ?, ?, ?)
+	`
+	var userID *string
+	if params.UserID != nil {
+		id := params.UserID.String()
+		userID = &id
+	}
+	_, err := c.db.Exec(query, params.Event, userID, params.Email, params.IPAddress, params.Details)
+	return err
+}
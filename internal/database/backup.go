@@ -0,0 +1,8 @@
+package database
+
+// Snapshot writes a consistent copy of the database to path while it stays
+// online. path must not exist yet.
+func (c Client) Snapshot(path string) error {
+	_, err := c.db.Exec(`VACUUM INTO ?`, path)
+	return err
+}
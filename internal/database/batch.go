@@ -0,0 +1,157 @@
+package database
+
+import (
+	"strings"
+
+	"github.com/google/uuid"
+)
+
+// maxBatchSize keeps IN lists below SQLite's bound parameter limit.
+const maxBatchSize = 500
+
+// inClause returns "(?, ?, ...)" for n parameters.
+func inClause(n int) string {
+	return "(" + strings.TrimSuffix(strings.Repeat("?, ", n), ", ") + ")"
+}
+
+// chunks splits items into slices of at most maxBatchSize, converted to query
+// arguments.
+func chunks[T any](items []T) [][]any {
+	var batches [][]any
+	for start := 0; start < len(items); start += maxBatchSize {
+		end := min(start+maxBatchSize, len(items))
+		args := make([]any, 0, end-start)
+		for _, item := range items[start:end] {
+			args = append(args, item)
+		}
+		batches = append(batches, args)
+	}
+	return batches
+}
+
+// GetVideosByIDs loads many videos at once. Missing IDs are simply absent
+// from the result.
+func (c Client) GetVideosByIDs(ids []uuid.UUID) (map[uuid.UUID]Video, error) {
+	videos := make(map[uuid.UUID]Video, len(ids))
+	missing := []uuid.UUID{}
+	for _, id := range ids {
+		if c.videoCache != nil {
+			if video, ok := c.videoCache.get(id); ok {
+				videos[id] = video
+				continue
+			}
+		}
+		missing = append(missing, id)
+	}
+
+	ctx, cancel := c.readContext()
+	defer cancel()
+
+	for _, args := range chunks(missing) {
+		query := `
+		SELECT ` + videoColumns + `
+		FROM videos
+		WHERE id IN ` + inClause(len(args))
+		rows, err := c.reader.QueryContext(ctx, query, args...)
+		if err != nil {
+			return nil, err
+		}
+		for rows.Next() {
+			video, err := scanVideo(rows)
+			if err != nil {
+				rows.Close()
+				return nil, err
+			}
+			videos[video.ID] = video
+		}
+		err = rows.Err()
+		rows.Close()
+		if err != nil {
+			return nil, err
+		}
+	}
+	return videos, nil
+}
+
+// GetArtifactsForVideos loads the artifacts of the given kinds, or of every
+// kind if none are given, for many videos in one go, keyed by video ID and
+// ordered like GetArtifacts.
+func (c Client) GetArtifactsForVideos(videoIDs []uuid.UUID, kinds ...ArtifactKind) (map[uuid.UUID][]Artifact, error) {
+	ctx, cancel := c.readContext()
+	defer cancel()
+
+	kindFilter := ""
+	kindArgs := []any{}
+	if len(kinds) > 0 {
+		kindFilter = "kind IN " + inClause(len(kinds)) + " AND "
+		for _, kind := range kinds {
+			kindArgs = append(kindArgs, kind)
+		}
+	}
+
+	artifacts := make(map[uuid.UUID][]Artifact, len(videoIDs))
+	for _, args := range chunks(videoIDs) {
+		query := `
+		SELECT ` + artifactColumns + `
+		FROM artifacts
+		WHERE ` + kindFilter + `video_id IN ` + inClause(len(args)) + `
+		ORDER BY video_id, height DESC, id
+		`
+		rows, err := c.reader.QueryContext(ctx, query, append(append([]any{}, kindArgs...), args...)...)
+		if err != nil {
+			return nil, err
+		}
+		for rows.Next() {
+			a, err := scanArtifact(rows)
+			if err != nil {
+				rows.Close()
+				return nil, err
+			}
+			artifacts[a.VideoID] = append(artifacts[a.VideoID], a)
+		}
+		err = rows.Err()
+		rows.Close()
+		if err != nil {
+			return nil, err
+		}
+	}
+	return artifacts, nil
+}
+
+// VideoOwner identifies the video a delivered URL belongs to.
+type VideoOwner struct {
+	VideoID uuid.UUID
+	UserID  uuid.UUID
+}
+
+// FindVideosByKeys returns the video and owner each object key belongs to.
+// Keys that aren't an artifact of any video are absent from the result.
+func (c Client) FindVideosByKeys(keys []string) (map[string]VideoOwner, error) {
+	owners := make(map[string]VideoOwner, len(keys))
+	for _, args := range chunks(keys) {
+		query := `
+		SELECT a.key, v.id, v.user_id
+		FROM artifacts a
+		JOIN videos v ON v.id = a.video_id
+		WHERE a.key IN ` + inClause(len(args))
+		rows, err := c.db.Query(query, args...)
+		if err != nil {
+			return nil, err
+		}
+		for rows.Next() {
+			var key string
+			var owner VideoOwner
+			if err := rows.Scan(&key, &owner.VideoID, &owner.UserID); err != nil {
+				rows.Close()
+				return nil, err
+			}
+			owners[key] = owner
+		}
+		err = rows.Err()
+		rows.Close()
+		if err != nil {
+			return nil, err
+		}
+	}
+	return owners, nil
+}
@@ -0,0 +1,57 @@
+package database
+
+import (
+	"github.com/google/uuid"
+)
+
+type UserBilling struct {
+	Plan                 string
+	StripeCustomerID     string
+	StripeSubscriptionID string
+}
+
+func (c Client) GetUserBilling(userID uuid.UUID) (UserBilling, error) {
+	query := `
+		SELECT plan, stripe_customer_id, stripe_subscription_id
+		FROM users
+		WHERE id = ?
+	`
+	var b UserBilling
+	err := c.db.QueryRow(query, userID.String()).Scan(&b.Plan, &b.StripeCustomerID, &b.StripeSubscriptionID)
+	return b, err
+}
+
+func (c Client) UpdateUserBilling(userID uuid.UUID, billing UserBilling) error {
+	query := `
+		UPDATE users
+		SET plan = ?, stripe_customer_id = ?, stripe_subscription_id = ?, updated_at = CURRENT_TIMESTAMP
+		WHERE id = ?
+	`
+	_, err := c.db.Exec(query, billing.Plan, billing.StripeCustomerID, billing.StripeSubscriptionID, userID.String())
+	return err
+}
+
+// SetPlanByStripeCustomer changes the plan of whichever user is linked to the
+// Stripe customer, as subscription events only carry the customer ID.
+func (c Client) SetPlanByStripeCustomer(customerID, plan string) error {
+	query := `
+		UPDATE users
+		SET plan = ?, updated_at = CURRENT_TIMESTAMP
+		WHERE stripe_customer_id = ?
+	`
+	_, err := c.db.Exec(query, plan, customerID)
+	return err
+}
+
+// GetStorageUsed returns the total size of every object stored for the
+// user's videos in bytes.
+func (c Client) GetStorageUsed(userID uuid.UUID) (int64, error) {
+	var used int64
+	err := c.db.QueryRow(`
+	SELECT COALESCE(SUM(a.size_bytes), 0)
+	FROM artifacts a
+	JOIN videos v ON v.id = a.video_id
+	WHERE v.user_id = ?
+	`, userID).Scan(&used)
+	return used, err
+}
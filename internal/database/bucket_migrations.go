@@ -0,0 +1,162 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type BucketMigrationStatus string
+
+const (
+	// BucketMigrationCopying is set until a pass finds every object copied
+	// and verified.
+	BucketMigrationCopying BucketMigrationStatus = "copying"
+	BucketMigrationCopied  BucketMigrationStatus = "copied"
+	// BucketMigrationFlipped means the database points at the destination.
+	BucketMigrationFlipped BucketMigrationStatus = "flipped"
+)
+
+// BucketMigration moves every object to another bucket, optionally under a
+// key prefix, and then switches the database over to it.
+type BucketMigration struct {
+	ID        uuid.UUID `json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+	CreateBucketMigrationParams
+	Status          BucketMigrationStatus `json:"status"`
+	ObjectsCopied   int64                 `json:"objects_copied"`
+	ObjectsVerified int64                 `json:"objects_verified"`
+	BytesCopied     int64                 `json:"bytes_copied"`
+	FlippedAt       *time.Time            `json:"flipped_at"`
+}
+
+type CreateBucketMigrationParams struct {
+	SourceBucket string `json:"source_bucket"`
+	// SourceURL and DestURL are where each bucket is served from, i.e. the
+	// old and new S3_CF_DISTRO.
+	SourceURL  string `json:"source_url"`
+	DestBucket string `json:"dest_bucket"`
+	DestRegion string `json:"dest_region"`
+	DestPrefix string `json:"dest_prefix"`
+	DestURL    string `json:"dest_url"`
+}
+
+const bucketMigrationColumns = `id, created_at, updated_at, source_bucket, source_url, dest_bucket, dest_region, dest_prefix, dest_url,
+	status, objects_copied, objects_verified, bytes_copied, flipped_at`
+
+func scanBucketMigration(row rowScanner) (BucketMigration, error) {
+	var m BucketMigration
+	err := row.Scan(&m.ID, &m.CreatedAt, &m.UpdatedAt, &m.SourceBucket, &m.SourceURL, &m.DestBucket, &m.DestRegion, &m.DestPrefix, &m.DestURL,
+		&m.Status, &m.ObjectsCopied, &m.ObjectsVerified, &m.BytesCopied, &m.FlippedAt)
+	return m, err
+}
+
+// StartBucketMigration returns the unfinished migration between the same
+// buckets if there is one, so an interrupted migration picks up where it
+// left off, and creates one otherwise.
+func (c Client) StartBucketMigration(params CreateBucketMigrationParams) (BucketMigration, error) {
+	row := c.db.QueryRow(`
+	SELECT `+bucketMigrationColumns+`
+	FROM bucket_migrations
+	WHERE source_bucket = ? AND dest_bucket = ? AND dest_prefix = ? AND status != ?
+	`, params.SourceBucket, params.DestBucket, params.DestPrefix, BucketMigrationFlipped)
+	m, err := scanBucketMigration(row)
+	if err == nil {
+		return m, nil
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		return BucketMigration{}, err
+	}
+
+	id := uuid.New()
+	timestamp := formatTimestamp(now())
+	_, err = c.db.Exec(`
+	INSERT INTO bucket_migrations (id, created_at, updated_at, source_bucket, source_url, dest_bucket, dest_region, dest_prefix, dest_url, status)
+	VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`, id, timestamp, timestamp, params.SourceBucket, params.SourceURL, params.DestBucket, params.DestRegion, params.DestPrefix, params.DestURL, BucketMigrationCopying)
+	if err != nil {
+		return BucketMigration{}, err
+	}
+	return scanBucketMigration(c.db.QueryRow(`SELECT `+bucketMigrationColumns+` FROM bucket_migrations WHERE id = ?`, id))
+}
+
+func (c Client) GetBucketMigrations() ([]BucketMigration, error) {
+	rows, err := c.db.Query(`SELECT ` + bucketMigrationColumns + ` FROM bucket_migrations ORDER BY created_at`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	migrations := []BucketMigration{}
+	for rows.Next() {
+		m, err := scanBucketMigration(rows)
+		if err != nil {
+			return nil, err
+		}
+		migrations = append(migrations, m)
+	}
+	return migrations, rows.Err()
+}
+
+// UpdateBucketMigrationProgress records the totals of the latest copy pass.
+func (c Client) UpdateBucketMigrationProgress(id uuid.UUID, status BucketMigrationStatus, copied, verified, bytes int64) error {
+	_, err := c.db.Exec(`
+	UPDATE bucket_migrations
+	SET updated_at = ?, status = ?, objects_copied = ?, objects_verified = ?, bytes_copied = ?
+	WHERE id = ?
+	`, formatTimestamp(now()), status, copied, verified, bytes, id)
+	return err
+}
+
+// FlipBucketMigration points every artifact key and video URL at the
+// destination in one transaction, so clients see either the old bucket or
+// the new one, never a mix.
+func (c Client) FlipBucketMigration(id uuid.UUID) error {
+	tx, err := c.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	m, err := scanBucketMigration(tx.QueryRow(`SELECT `+bucketMigrationColumns+` FROM bucket_migrations WHERE id = ?`, id))
+	if err != nil {
+		return err
+	}
+	if m.Status != BucketMigrationCopied {
+		return fmt.Errorf("migration is %s, it can only be flipped once every object is copied", m.Status)
+	}
+
+	if m.DestPrefix != "" {
+		if _, err := tx.Exec(`UPDATE artifacts SET key = ? || key`, m.DestPrefix); err != nil {
+			return err
+		}
+	}
+	// video_url is "<source_url>/<key>"; the key gains the prefix too.
+	_, err = tx.Exec(`
+	UPDATE videos
+	SET video_url = ? || substr(video_url, ?)
+	WHERE substr(video_url, 1, ?) = ?
+	`, m.DestURL+"/"+m.DestPrefix, len(m.SourceURL)+2, len(m.SourceURL)+1, m.SourceURL+"/")
+	if err != nil {
+		return err
+	}
+
+	timestamp := formatTimestamp(now())
+	_, err = tx.Exec(`UPDATE bucket_migrations SET status = ?, updated_at = ?, flipped_at = ? WHERE id = ?`,
+		BucketMigrationFlipped, timestamp, timestamp, id)
+	if err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	if c.videoCache != nil {
+		c.videoCache.clear()
+		c.videoListCache.clear()
+	}
+	return nil
+}
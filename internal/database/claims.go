@@ -0,0 +1,207 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type ClaimStatus string
+
+const (
+	ClaimOpen     ClaimStatus = "open"
+	ClaimDisputed ClaimStatus = "disputed"
+	ClaimUpheld   ClaimStatus = "upheld"
+	ClaimRejected ClaimStatus = "rejected"
+)
+
+type Claim struct {
+	ID        uuid.UUID   `json:"id"`
+	CreatedAt time.Time   `json:"created_at"`
+	Status    ClaimStatus `json:"status"`
+	CreateClaimParams
+	DisputeMessage string     `json:"dispute_message,omitempty"`
+	DisputedAt     *time.Time `json:"disputed_at,omitempty"`
+	ResolutionNote string     `json:"resolution_note,omitempty"`
+	ResolvedAt     *time.Time `json:"resolved_at,omitempty"`
+}
+
+type CreateClaimParams struct {
+	VideoID    uuid.UUID `json:"video_id"`
+	ClaimantID uuid.UUID `json:"claimant_id"`
+	// Work identifies the copyrighted work the video is said to infringe.
+	Work         string `json:"work"`
+	Details      string `json:"details"`
+	ContactEmail string `json:"contact_email"`
+}
+
+// ErrClaimClosed is returned when disputing or resolving a claim that has
+// already been resolved, or disputing one twice.
+var ErrClaimClosed = errors.New("claim is not in a state that allows this")
+
+const claimColumns = `id, created_at, status, video_id, claimant_id, work, details, contact_email, dispute_message, disputed_at, resolution_note, resolved_at`
+
+func scanClaim(row rowScanner) (Claim, error) {
+	var claim Claim
+	err := row.Scan(
+		&claim.ID,
+		&claim.CreatedAt,
+		&claim.Status,
+		&claim.VideoID,
+		&claim.ClaimantID,
+		&claim.Work,
+		&claim.Details,
+		&claim.ContactEmail,
+		&claim.DisputeMessage,
+		&claim.DisputedAt,
+		&claim.ResolutionNote,
+		&claim.ResolvedAt,
+	)
+	return claim, err
+}
+
+func (c Client) CreateClaim(params CreateClaimParams) (Claim, error) {
+	id := uuid.New()
+	query := `
+	INSERT INTO copyright_claims (id, created_at, status, video_id, claimant_id, work, details, contact_email)
+	VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+	`
+	_, err := c.db.Exec(query, id, formatTimestamp(now()), ClaimOpen, params.VideoID, params.ClaimantID, params.Work, params.Details, params.ContactEmail)
+	if err != nil {
+		return Claim{}, err
+	}
+	claim, err := c.GetClaim(id)
+	if err != nil {
+		return Claim{}, err
+	}
+	return *claim, nil
+}
+
+// GetClaim returns nil if there's no such claim.
+func (c Client) GetClaim(id uuid.UUID) (*Claim, error) {
+	claim, err := scanClaim(c.db.QueryRow(`SELECT `+claimColumns+` FROM copyright_claims WHERE id = ?`, id))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &claim, nil
+}
+
+// GetClaims lists claims, newest first, optionally only those in status.
+func (c Client) GetClaims(status ClaimStatus) ([]Claim, error) {
+	if status == "" {
+		return c.getClaims("")
+	}
+	return c.getClaims("WHERE status = ?", status)
+}
+
+func (c Client) GetClaimsForVideo(videoID uuid.UUID) ([]Claim, error) {
+	return c.getClaims("WHERE video_id = ?", videoID)
+}
+
+// HasPendingClaim reports whether the video has a claim that's open or
+// disputed, i.e. not yet resolved.
+func (c Client) HasPendingClaim(videoID uuid.UUID) (bool, error) {
+	var n int
+	err := c.db.QueryRow(`SELECT COUNT(*) FROM copyright_claims WHERE video_id = ? AND status IN (?, ?)`, videoID, ClaimOpen, ClaimDisputed).Scan(&n)
+	return n > 0, err
+}
+
+// GetVideosWithPendingClaims returns which of videoIDs have a pending claim.
+func (c Client) GetVideosWithPendingClaims(videoIDs []uuid.UUID) (map[uuid.UUID]bool, error) {
+	claimed := map[uuid.UUID]bool{}
+	for _, args := range chunks(videoIDs) {
+		query := `
+		SELECT DISTINCT video_id
+		FROM copyright_claims
+		WHERE status IN (?, ?) AND video_id IN ` + inClause(len(args))
+		rows, err := c.db.Query(query, append([]any{ClaimOpen, ClaimDisputed}, args...)...)
+		if err != nil {
+			return nil, err
+		}
+		for rows.Next() {
+			var id uuid.UUID
+			if err := rows.Scan(&id); err != nil {
+				rows.Close()
+				return nil, err
+			}
+			claimed[id] = true
+		}
+		err = rows.Err()
+		rows.Close()
+		if err != nil {
+			return nil, err
+		}
+	}
+	return claimed, nil
+}
+
+// DisputeClaim records the video owner's side of an open claim.
+func (c Client) DisputeClaim(id uuid.UUID, message string) (Claim, error) {
+	query := `
+	UPDATE copyright_claims
+	SET status = ?, dispute_message = ?, disputed_at = ?
+	WHERE id = ? AND status = ?
+	`
+	return c.transitionClaim(id, query, ClaimDisputed, message, formatTimestamp(now()), id, ClaimOpen)
+}
+
+// ResolveClaim closes a pending claim as upheld or rejected.
+func (c Client) ResolveClaim(id uuid.UUID, status ClaimStatus, note string) (Claim, error) {
+	query := `
+	UPDATE copyright_claims
+	SET status = ?, resolution_note = ?, resolved_at = ?
+	WHERE id = ? AND status IN (?, ?)
+	`
+	return c.transitionClaim(id, query, status, note, formatTimestamp(now()), id, ClaimOpen, ClaimDisputed)
+}
+
+func (c Client) transitionClaim(id uuid.UUID, query string, args ...any) (Claim, error) {
+	result, err := c.db.Exec(query, args...)
+	if err != nil {
+		return Claim{}, err
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return Claim{}, err
+	}
+	claim, err := c.GetClaim(id)
+	if err != nil {
+		return Claim{}, err
+	}
+	if claim == nil {
+		return Claim{}, sql.ErrNoRows
+	}
+	if n == 0 {
+		return Claim{}, ErrClaimClosed
+	}
+	return *claim, nil
+}
+
+func (c Client) getClaims(where string, args ...any) ([]Claim, error) {
+	query := `
+	SELECT ` + claimColumns + `
+	FROM copyright_claims
+	` + where + `
+	ORDER BY created_at DESC
+	`
+	rows, err := c.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	claims := []Claim{}
+	for rows.Next() {
+		claim, err := scanClaim(rows)
+		if err != nil {
+			return nil, err
+		}
+		claims = append(claims, claim)
+	}
+	return claims, rows.Err()
+}
@@ -0,0 +1,259 @@
+package database
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// CMSSyncFormat is how a CMS sync shapes its requests.
+type CMSSyncFormat string
+
+const (
+	CMSSyncFormatREST    CMSSyncFormat = "rest"
+	CMSSyncFormatGraphQL CMSSyncFormat = "graphql"
+)
+
+// CMSSync pushes changes to a user's videos to an external CMS.
+type CMSSync struct {
+	ID        uuid.UUID `json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+	CreateCMSSyncParams
+}
+
+type CreateCMSSyncParams struct {
+	UserID uuid.UUID     `json:"user_id"`
+	URL    string        `json:"url"`
+	Format CMSSyncFormat `json:"format"`
+	// GraphQLQuery is the mutation sent by graphql syncs.
+	GraphQLQuery string `json:"graphql_query,omitempty"`
+	// FieldMap renames video fields for the CMS, see cmsVideoFields.
+	FieldMap map[string]string `json:"field_map"`
+	// Secret signs the requests. It's only shown when the sync is created.
+	Secret string `json:"-"`
+}
+
+// CMS sync event kinds, recorded by triggers on the videos table so every
+// write is captured wherever it's made.
+const (
+	CMSSyncEventCreated = "video.created"
+	CMSSyncEventUpdated = "video.updated"
+	CMSSyncEventDeleted = "video.deleted"
+)
+
+// CMS sync event statuses.
+const (
+	CMSSyncEventPending   = "pending"
+	CMSSyncEventDelivered = "delivered"
+	CMSSyncEventFailed    = "failed"
+)
+
+// CMSSyncEvent is a change to one video waiting to be pushed, or already
+// pushed, to a sync. Events carry no video data; the video's state when
+// it's delivered is sent, so replays never push stale data.
+type CMSSyncEvent struct {
+	ID            int64      `json:"id"`
+	CreatedAt     time.Time  `json:"created_at"`
+	SyncID        uuid.UUID  `json:"sync_id"`
+	VideoID       uuid.UUID  `json:"video_id"`
+	Event         string     `json:"event"`
+	Status        string     `json:"status"`
+	Attempts      int        `json:"attempts"`
+	NextAttemptAt time.Time  `json:"next_attempt_at"`
+	LastError     string     `json:"last_error,omitempty"`
+	DeliveredAt   *time.Time `json:"delivered_at"`
+}
+
+const cmsSyncColumns = `id, created_at, user_id, url, format, graphql_query, field_map, secret`
+
+func scanCMSSync(row rowScanner) (CMSSync, error) {
+	var s CMSSync
+	var fieldMap string
+	err := row.Scan(&s.ID, &s.CreatedAt, &s.UserID, &s.URL, &s.Format, &s.GraphQLQuery, &fieldMap, &s.Secret)
+	s.FieldMap = map[string]string{}
+	if fieldMap != "" {
+		json.Unmarshal([]byte(fieldMap), &s.FieldMap)
+	}
+	return s, err
+}
+
+const cmsSyncEventColumns = `id, created_at, sync_id, video_id, event, status, attempts, next_attempt_at, last_error, delivered_at`
+
+func scanCMSSyncEvent(row rowScanner) (CMSSyncEvent, error) {
+	var e CMSSyncEvent
+	err := row.Scan(&e.ID, &e.CreatedAt, &e.SyncID, &e.VideoID, &e.Event, &e.Status, &e.Attempts, &e.NextAttemptAt, &e.LastError, &e.DeliveredAt)
+	return e, err
+}
+
+func (c Client) CreateCMSSync(params CreateCMSSyncParams) (CMSSync, error) {
+	id := uuid.New()
+	fieldMap, err := json.Marshal(params.FieldMap)
+	if err != nil {
+		return CMSSync{}, err
+	}
+	if params.FieldMap == nil {
+		fieldMap = []byte("{}")
+	}
+	_, err = c.db.Exec(`
+	INSERT INTO cms_syncs (id, created_at, user_id, url, format, graphql_query, field_map, secret)
+	VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+	`, id, formatTimestamp(now()), params.UserID, params.URL, params.Format, params.GraphQLQuery, string(fieldMap), params.Secret)
+	if err != nil {
+		return CMSSync{}, err
+	}
+	return scanCMSSync(c.db.QueryRow(`SELECT `+cmsSyncColumns+` FROM cms_syncs WHERE id = ?`, id))
+}
+
+// GetCMSSync returns nil if the sync doesn't exist.
+func (c Client) GetCMSSync(id uuid.UUID) (*CMSSync, error) {
+	s, err := scanCMSSync(c.db.QueryRow(`SELECT `+cmsSyncColumns+` FROM cms_syncs WHERE id = ?`, id))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &s, nil
+}
+
+func (c Client) GetCMSSyncsForUser(userID uuid.UUID) ([]CMSSync, error) {
+	rows, err := c.db.Query(`SELECT `+cmsSyncColumns+` FROM cms_syncs WHERE user_id = ? ORDER BY created_at`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	syncs := []CMSSync{}
+	for rows.Next() {
+		s, err := scanCMSSync(rows)
+		if err != nil {
+			return nil, err
+		}
+		syncs = append(syncs, s)
+	}
+	return syncs, rows.Err()
+}
+
+// DeleteCMSSync deletes the sync and its events. It returns sql.ErrNoRows
+// if the user has no such sync.
+func (c Client) DeleteCMSSync(userID, id uuid.UUID) error {
+	tx, err := c.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	result, err := tx.Exec(`DELETE FROM cms_syncs WHERE id = ? AND user_id = ?`, id, userID)
+	if err != nil {
+		return err
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return sql.ErrNoRows
+	}
+	_, err = tx.Exec(`DELETE FROM cms_sync_events WHERE sync_id = ?`, id)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// GetCMSSyncEvents returns up to limit of the sync's events, newest first.
+func (c Client) GetCMSSyncEvents(syncID uuid.UUID, limit int) ([]CMSSyncEvent, error) {
+	return c.getCMSSyncEvents(`WHERE sync_id = ? ORDER BY id DESC LIMIT ?`, syncID, limit)
+}
+
+// GetPendingCMSSyncEvents returns up to limit pending events of every sync,
+// oldest first, whether or not they're due yet.
+func (c Client) GetPendingCMSSyncEvents(limit int) ([]CMSSyncEvent, error) {
+	return c.getCMSSyncEvents(`WHERE status = ? ORDER BY id LIMIT ?`, CMSSyncEventPending, limit)
+}
+
+func (c Client) getCMSSyncEvents(where string, args ...any) ([]CMSSyncEvent, error) {
+	rows, err := c.db.Query(`SELECT `+cmsSyncEventColumns+` FROM cms_sync_events `+where, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	events := []CMSSyncEvent{}
+	for rows.Next() {
+		e, err := scanCMSSyncEvent(rows)
+		if err != nil {
+			return nil, err
+		}
+		events = append(events, e)
+	}
+	return events, rows.Err()
+}
+
+func (c Client) MarkCMSSyncEventDelivered(id int64) error {
+	_, err := c.db.Exec(`
+	UPDATE cms_sync_events
+	SET status = ?, attempts = attempts + 1, last_error = '', delivered_at = ?
+	WHERE id = ?
+	`, CMSSyncEventDelivered, formatTimestamp(now()), id)
+	return err
+}
+
+// MarkCMSSyncEventFailed records a failed attempt. With a zero retryAt the
+// event is given up on, otherwise it's tried again then.
+func (c Client) MarkCMSSyncEventFailed(id int64, message string, retryAt time.Time) error {
+	status, next := CMSSyncEventPending, formatTimestamp(retryAt)
+	if retryAt.IsZero() {
+		status, next = CMSSyncEventFailed, formatTimestamp(now())
+	}
+	_, err := c.db.Exec(`
+	UPDATE cms_sync_events
+	SET status = ?, attempts = attempts + 1, last_error = ?, next_attempt_at = ?
+	WHERE id = ?
+	`, status, message, next, id)
+	return err
+}
+
+// ReplayCMSSyncEvents queues the sync's events created since the given
+// time again, delivered or not, and returns how many there were. With a
+// zero since only the failed ones are.
+func (c Client) ReplayCMSSyncEvents(syncID uuid.UUID, since time.Time) (int64, error) {
+	query := `
+	UPDATE cms_sync_events
+	SET status = ?, attempts = 0, last_error = '', next_attempt_at = ?, delivered_at = NULL
+	WHERE sync_id = ?
+	`
+	args := []any{CMSSyncEventPending, formatTimestamp(now()), syncID}
+	if since.IsZero() {
+		query += ` AND status = ?`
+		args = append(args, CMSSyncEventFailed)
+	} else {
+		query += ` AND created_at >= ?`
+		args = append(args, formatTimestamp(since))
+	}
+	result, err := c.db.Exec(query, args...)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+// BackfillCMSSync queues an update for every video of the sync's user, to
+// push a whole catalog, and returns how many there were.
+func (c Client) BackfillCMSSync(sync CMSSync) (int64, error) {
+	timestamp := formatTimestamp(now())
+	result, err := c.db.Exec(`
+	INSERT INTO cms_sync_events (created_at, sync_id, video_id, event, next_attempt_at)
+	SELECT ?, ?, id, ?, ?
+	FROM videos
+	WHERE user_id = ?
+	ORDER BY created_at
+	`, timestamp, sync.ID, CMSSyncEventUpdated, timestamp, sync.UserID)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
@@ -0,0 +1,44 @@
+package database
+
+// MonthTotals sums the month's activity across all users.
+type MonthTotals struct {
+	EgressBytesEstimated int64
+	EgressBytesMeasured  int64
+	URLIssuances         int64
+	DeliveryRequests     int64
+	TranscodingCostUSD   float64
+}
+
+func (c Client) GetMonthTotals(month string) (MonthTotals, error) {
+	ctx, cancel := c.readContext()
+	defer cancel()
+
+	var totals MonthTotals
+	err := c.reader.QueryRowContext(ctx, `
+	SELECT
+		COALESCE(SUM(egress_bytes_estimated), 0),
+		COALESCE(SUM(egress_bytes_measured), 0),
+		COALESCE(SUM(url_issuances), 0),
+		COALESCE(SUM(delivery_requests), 0)
+	FROM monthly_usage
+	WHERE month = ?
+	`, month).Scan(
+		&totals.EgressBytesEstimated,
+		&totals.EgressBytesMeasured,
+		&totals.URLIssuances,
+		&totals.DeliveryRequests,
+	)
+	if err != nil {
+		return MonthTotals{}, err
+	}
+
+	err = c.reader.QueryRowContext(ctx, `
+	SELECT COALESCE(SUM(estimated_cost_usd), 0)
+	FROM transcode_jobs
+	WHERE strftime('%Y-%m', created_at) = ?
+	`, month).Scan(&totals.TranscodingCostUSD)
+	if err != nil {
+		return MonthTotals{}, err
+	}
+	return totals, nil
+}
@@ -1,89 +1,386 @@
 package database
 
 import (
+	"context"
 	"database/sql"
 	"fmt"
+	"time"
 
+	"github.com/google/uuid"
 	_ "github.com/mattn/go-sqlite3"
 )
 
 type Client struct {
 	db *sql.DB
+	// reader serves list and analytics queries. It's the same pool as db
+	// unless a separate read DSN is configured.
+	reader           *sql.DB
+	statementTimeout time.Duration
+
+	// videoCache and videoListCache are nil when caching is disabled.
+	videoCache     *ttlCache[uuid.UUID, Video]
+	videoListCache *ttlCache[uuid.UUID, []Video]
+}
+
+// Options tunes the connection pools. Zero values keep database/sql's
+// defaults.
+type Options struct {
+	// ReadDSN points list and analytics queries at a replica (or a read-only
+	// connection to the same file) so they can't starve writes.
+	ReadDSN         string
+	MaxOpenConns    int
+	MaxIdleConns    int
+	ConnMaxLifetime time.Duration
+	// StatementTimeout bounds queries made through the reader.
+	StatementTimeout time.Duration
+	// VideoCacheTTL enables caching of GetVideo and GetVideos. Writes made
+	// through this client invalidate it, so it only suits a single instance.
+	VideoCacheTTL     time.Duration
+	VideoCacheEntries int
+	// MetadataIndexKeys are the video metadata keys to index for
+	// filtering.
+	MetadataIndexKeys []string
 }
 
 func NewClient(pathToDB string) (Client, error) {
+	return NewClientWithOptions(pathToDB, Options{})
+}
+
+func NewClientWithOptions(pathToDB string, opts Options) (Client, error) {
 	db, err := sql.Open("sqlite3", pathToDB)
 	if err != nil {
 		return Client{}, err
 	}
-	c := Client{db}
+	opts.apply(db)
+	c := Client{db: db, reader: db, statementTimeout: opts.StatementTimeout}
+	if opts.VideoCacheTTL > 0 {
+		entries := opts.VideoCacheEntries
+		if entries <= 0 {
+			entries = 10000
+		}
+		c.videoCache = newTTLCache[uuid.UUID, Video](opts.VideoCacheTTL, entries)
+		c.videoListCache = newTTLCache[uuid.UUID, []Video](opts.VideoCacheTTL, entries)
+	}
 	err = c.autoMigrate()
 	if err != nil {
 		return Client{}, err
 	}
+	err = c.indexMetadataKeys(opts.MetadataIndexKeys)
+	if err != nil {
+		return Client{}, err
+	}
+
+	if opts.ReadDSN != "" {
+		c.reader, err = sql.Open("sqlite3", opts.ReadDSN)
+		if err != nil {
+			return Client{}, err
+		}
+		opts.apply(c.reader)
+		if err := c.reader.Ping(); err != nil {
+			return Client{}, fmt.Errorf("couldn't connect to read database: %w", err)
+		}
+	}
 	return c, nil
+}
 
+func (opts Options) apply(db *sql.DB) {
+	if opts.MaxOpenConns > 0 {
+		db.SetMaxOpenConns(opts.MaxOpenConns)
+	}
+	if opts.MaxIdleConns > 0 {
+		db.SetMaxIdleConns(opts.MaxIdleConns)
+	}
+	if opts.ConnMaxLifetime > 0 {
+		db.SetConnMaxLifetime(opts.ConnMaxLifetime)
+	}
+}
+
+// readContext returns the context reader queries run under, cancelling them
+// once the statement timeout has passed.
+func (c Client) readContext() (context.Context, context.CancelFunc) {
+	if c.statementTimeout <= 0 {
+		return context.Background(), func() {}
+	}
+	return context.WithTimeout(context.Background(), c.statementTimeout)
 }
 
+// autoMigrate applies the embedded SQL migrations, then brings databases
+// created by older versions of the app up to date.
 func (c *Client) autoMigrate() error {
-	userTable := `
-	CREATE TABLE IF NOT EXISTS users (
-		id TEXT PRIMARY KEY,
-		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
-		updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
-		password TEXT NOT NULL,
-		email TEXT UNIQUE NOT NULL
-	);
-	`
-	_, err := c.db.Exec(userTable)
+	err := c.runMigrations()
+	if err != nil {
+		return err
+	}
+
+	for _, col := range []struct{ name, definition string }{
+		{"email_verified_at", "TIMESTAMP"},
+		{"plan", "TEXT NOT NULL DEFAULT 'free'"},
+		{"stripe_customer_id", "TEXT NOT NULL DEFAULT ''"},
+		{"stripe_subscription_id", "TEXT NOT NULL DEFAULT ''"},
+	} {
+		err = c.addColumnIfNotExists("users", col.name, col.definition)
+		if err != nil {
+			return err
+		}
+	}
+
+	err = c.addColumnIfNotExists("videos", "size_bytes", "INTEGER NOT NULL DEFAULT 0")
+	if err != nil {
+		return err
+	}
+	err = c.addColumnIfNotExists("videos", "published_at", "TIMESTAMP")
 	if err != nil {
 		return err
 	}
-	refreshTokenTable := `
-	CREATE TABLE IF NOT EXISTS refresh_tokens (
-		token TEXT PRIMARY KEY,
-		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
-		updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
-		revoked_at TIMESTAMP,
-		user_id TEXT NOT NULL,
-		expires_at TIMESTAMP NOT NULL,
-		FOREIGN KEY(user_id) REFERENCES users(id)
-	);
-	`
-	_, err = c.db.Exec(refreshTokenTable)
+	err = c.normalizeTimestamps("videos", "created_at", "updated_at", "published_at")
 	if err != nil {
 		return err
 	}
+	_, err = c.db.Exec(`UPDATE videos SET published_at = updated_at WHERE published_at IS NULL AND video_url IS NOT NULL`)
+	if err != nil {
+		return err
+	}
+	_, err = c.db.Exec(`CREATE INDEX IF NOT EXISTS idx_videos_user_created ON videos(user_id, created_at DESC, id DESC)`)
+	if err != nil {
+		return err
+	}
+
+	for _, col := range []struct{ name, definition string }{
+		{"user_agent", "TEXT NOT NULL DEFAULT ''"},
+		{"ip_address", "TEXT NOT NULL DEFAULT ''"},
+		{"last_used_at", "TIMESTAMP"},
+	} {
+		err = c.addColumnIfNotExists("refresh_tokens", col.name, col.definition)
+		if err != nil {
+			return err
+		}
+	}
 
-	videoTable := `
-	CREATE TABLE IF NOT EXISTS videos (
-		id TEXT PRIMARY KEY,
-		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
-		updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
-		title TEXT NOT NULL,
-		description TEXT,
-		thumbnail_url TEXT,
-		video_url TEXT TEXT,
-		user_id INTEGER,
-		FOREIGN KEY(user_id) REFERENCES users(id)
-	);
-	`
-	_, err = c.db.Exec(videoTable)
+	for _, col := range []struct{ name, definition string }{
+		{"preset", "TEXT NOT NULL DEFAULT ''"},
+		{"duration_ms", "INTEGER NOT NULL DEFAULT 0"},
+		{"processing_ms", "INTEGER NOT NULL DEFAULT 0"},
+		{"estimated_cost_usd", "REAL NOT NULL DEFAULT 0"},
+	} {
+		err = c.addColumnIfNotExists("transcode_jobs", col.name, col.definition)
+		if err != nil {
+			return err
+		}
+	}
+
+	return c.backfillArtifacts()
+}
+
+// backfillArtifacts fills the artifacts table of databases from before it
+// existed from the old video_renditions table and the videos' own URLs,
+// which is the last place object keys are recovered by parsing URLs. Those
+// databases are told apart by video_renditions, or by having no artifacts
+// at all.
+func (c *Client) backfillArtifacts() error {
+	hadRenditions, err := c.tableExists("video_renditions")
 	if err != nil {
 		return err
 	}
-	return nil
+	var hasArtifacts bool
+	err = c.db.QueryRow(`SELECT EXISTS (SELECT 1 FROM artifacts)`).Scan(&hasArtifacts)
+	if err != nil {
+		return err
+	}
+	if hasArtifacts && !hadRenditions {
+		return nil
+	}
+
+	tx, err := c.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	// URLs look like https://<distribution>/<key>.
+	const keyFromURL = `substr(%[1]s, instr(substr(%[1]s, 9), '/') + 9)`
+	if hadRenditions {
+		_, err = tx.Exec(fmt.Sprintf(`
+		INSERT OR IGNORE INTO artifacts (created_at, video_id, kind, key, width, height, duration_ms)
+		SELECT created_at, video_id, 'rendition', `+keyFromURL+`, width, height, duration_ms
+		FROM video_renditions
+		`, "url"))
+		if err != nil {
+			return err
+		}
+		_, err = tx.Exec(`DROP TABLE video_renditions`)
+		if err != nil {
+			return err
+		}
+	}
+	_, err = tx.Exec(fmt.Sprintf(`
+	INSERT OR IGNORE INTO artifacts (created_at, video_id, kind, key, size_bytes)
+	SELECT updated_at, id, 'video', `+keyFromURL+`, size_bytes
+	FROM videos
+	WHERE video_url IS NOT NULL AND video_url != ''
+	`, "video_url"))
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (c *Client) tableExists(name string) (bool, error) {
+	var n int
+	err := c.db.QueryRow(`SELECT COUNT(*) FROM sqlite_master WHERE type = 'table' AND name = ?`, name).Scan(&n)
+	return n > 0, err
+}
+
+// addColumnIfNotExists adds a column to an existing table, since SQLite has no
+// ADD COLUMN IF NOT EXISTS and databases created by older versions of the app
+// need to pick up new columns on startup.
+func (c *Client) addColumnIfNotExists(table, column, definition string) error {
+	exists, err := c.columnExists(table, column)
+	if err != nil || exists {
+		return err
+	}
+	_, err = c.db.Exec(fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s %s", table, column, definition))
+	return err
+}
+
+func (c *Client) columnExists(table, column string) (bool, error) {
+	rows, err := c.db.Query(fmt.Sprintf("PRAGMA table_info(%s)", table))
+	if err != nil {
+		return false, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var (
+			cid        int
+			name       string
+			colType    string
+			notNull    int
+			defaultVal sql.NullString
+			primaryKey int
+		)
+		if err := rows.Scan(&cid, &name, &colType, &notNull, &defaultVal, &primaryKey); err != nil {
+			return false, err
+		}
+		if name == column {
+			return true, nil
+		}
+	}
+	return false, rows.Err()
 }
 
 func (c Client) Reset() error {
+	// Syncs go before videos, or deleting videos would queue their events.
+	if _, err := c.db.Exec("DELETE FROM cms_syncs"); err != nil {
+		return fmt.Errorf("failed to reset table cms_syncs: %w", err)
+	}
+	if _, err := c.db.Exec("DELETE FROM cms_sync_events"); err != nil {
+		return fmt.Errorf("failed to reset table cms_sync_events: %w", err)
+	}
+	if _, err := c.db.Exec("DELETE FROM slugs"); err != nil {
+		return fmt.Errorf("failed to reset table slugs: %w", err)
+	}
+	if _, err := c.db.Exec("DELETE FROM video_import_items"); err != nil {
+		return fmt.Errorf("failed to reset table video_import_items: %w", err)
+	}
+	if _, err := c.db.Exec("DELETE FROM video_imports"); err != nil {
+		return fmt.Errorf("failed to reset table video_imports: %w", err)
+	}
+	if _, err := c.db.Exec("DELETE FROM video_password_attempts"); err != nil {
+		return fmt.Errorf("failed to reset table video_password_attempts: %w", err)
+	}
+	if _, err := c.db.Exec("DELETE FROM reconciliation_findings"); err != nil {
+		return fmt.Errorf("failed to reset table reconciliation_findings: %w", err)
+	}
+	if _, err := c.db.Exec("DELETE FROM reconciliation_reports"); err != nil {
+		return fmt.Errorf("failed to reset table reconciliation_reports: %w", err)
+	}
+	if _, err := c.db.Exec("DELETE FROM bucket_migrations"); err != nil {
+		return fmt.Errorf("failed to reset table bucket_migrations: %w", err)
+	}
+	if _, err := c.db.Exec("DELETE FROM maintenance_mode"); err != nil {
+		return fmt.Errorf("failed to reset table maintenance_mode: %w", err)
+	}
+	if _, err := c.db.Exec("DELETE FROM feature_flags"); err != nil {
+		return fmt.Errorf("failed to reset table feature_flags: %w", err)
+	}
+	if _, err := c.db.Exec("DELETE FROM plan_rate_limits"); err != nil {
+		return fmt.Errorf("failed to reset table plan_rate_limits: %w", err)
+	}
+	if _, err := c.db.Exec("DELETE FROM processing_windows"); err != nil {
+		return fmt.Errorf("failed to reset table processing_windows: %w", err)
+	}
+	if _, err := c.db.Exec("DELETE FROM queued_uploads"); err != nil {
+		return fmt.Errorf("failed to reset table queued_uploads: %w", err)
+	}
+	if _, err := c.db.Exec("DELETE FROM thumbnail_jobs"); err != nil {
+		return fmt.Errorf("failed to reset table thumbnail_jobs: %w", err)
+	}
+	if _, err := c.db.Exec("DELETE FROM embed_tokens"); err != nil {
+		return fmt.Errorf("failed to reset table embed_tokens: %w", err)
+	}
+	if _, err := c.db.Exec("DELETE FROM copyright_claims"); err != nil {
+		return fmt.Errorf("failed to reset table copyright_claims: %w", err)
+	}
+	if _, err := c.db.Exec("DELETE FROM video_takedowns"); err != nil {
+		return fmt.Errorf("failed to reset table video_takedowns: %w", err)
+	}
+	if _, err := c.db.Exec("DELETE FROM video_delivery_stats"); err != nil {
+		return fmt.Errorf("failed to reset table video_delivery_stats: %w", err)
+	}
+	if _, err := c.db.Exec("DELETE FROM ingested_log_files"); err != nil {
+		return fmt.Errorf("failed to reset table ingested_log_files: %w", err)
+	}
+	if _, err := c.db.Exec("DELETE FROM monthly_usage"); err != nil {
+		return fmt.Errorf("failed to reset table monthly_usage: %w", err)
+	}
+	if _, err := c.db.Exec("DELETE FROM notification_channels"); err != nil {
+		return fmt.Errorf("failed to reset table notification_channels: %w", err)
+	}
+	if _, err := c.db.Exec("DELETE FROM http_actions"); err != nil {
+		return fmt.Errorf("failed to reset table http_actions: %w", err)
+	}
+	if _, err := c.db.Exec("DELETE FROM inbound_emails"); err != nil {
+		return fmt.Errorf("failed to reset table inbound_emails: %w", err)
+	}
+	if _, err := c.db.Exec("DELETE FROM upload_session_parts"); err != nil {
+		return fmt.Errorf("failed to reset table upload_session_parts: %w", err)
+	}
+	if _, err := c.db.Exec("DELETE FROM upload_sessions"); err != nil {
+		return fmt.Errorf("failed to reset table upload_sessions: %w", err)
+	}
+	if _, err := c.db.Exec("DELETE FROM tus_uploads"); err != nil {
+		return fmt.Errorf("failed to reset table tus_uploads: %w", err)
+	}
+	if _, err := c.db.Exec("DELETE FROM processing_metrics"); err != nil {
+		return fmt.Errorf("failed to reset table processing_metrics: %w", err)
+	}
+	if _, err := c.db.Exec("DELETE FROM login_attempts"); err != nil {
+		return fmt.Errorf("failed to reset table login_attempts: %w", err)
+	}
+	if _, err := c.db.Exec("DELETE FROM audit_events"); err != nil {
+		return fmt.Errorf("failed to reset table audit_events: %w", err)
+	}
+	if _, err := c.db.Exec("DELETE FROM user_tokens"); err != nil {
+		return fmt.Errorf("failed to reset table user_tokens: %w", err)
+	}
 	if _, err := c.db.Exec("DELETE FROM refresh_tokens"); err != nil {
 		return fmt.Errorf("failed to reset table refresh_tokens: %w", err)
 	}
 	if _, err := c.db.Exec("DELETE FROM users"); err != nil {
 		return fmt.Errorf("failed to reset table users: %w", err)
 	}
+	if _, err := c.db.Exec("DELETE FROM artifacts"); err != nil {
+		return fmt.Errorf("failed to reset table artifacts: %w", err)
+	}
+	if _, err := c.db.Exec("DELETE FROM transcode_jobs"); err != nil {
+		return fmt.Errorf("failed to reset table transcode_jobs: %w", err)
+	}
 	if _, err := c.db.Exec("DELETE FROM videos"); err != nil {
 		return fmt.Errorf("failed to reset table videos: %w", err)
 	}
+	if c.videoCache != nil {
+		c.videoCache.clear()
+		c.videoListCache.clear()
+	}
 	return nil
 }
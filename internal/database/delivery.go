@@ -0,0 +1,111 @@
+package database
+
+import (
+	"github.com/google/uuid"
+)
+
+type VideoDelivery struct {
+	VideoID  uuid.UUID `json:"video_id"`
+	Day      string    `json:"day"`
+	Bytes    int64     `json:"bytes"`
+	Requests int64     `json:"requests"`
+}
+
+type UserDelivery struct {
+	UserID   uuid.UUID
+	Month    string
+	Bytes    int64
+	Requests int64
+}
+
+// DeliveryLog is everything attributed from a single access log file.
+type DeliveryLog struct {
+	Key     string
+	Entries int
+	Videos  []VideoDelivery
+	Users   []UserDelivery
+}
+
+// RecordDeliveryLog stores the stats from one log file in a transaction. It
+// returns false without changing anything if the file was already ingested,
+// so re-running ingestion never double counts.
+func (c Client) RecordDeliveryLog(log DeliveryLog) (bool, error) {
+	tx, err := c.db.Begin()
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	result, err := tx.Exec(`INSERT OR IGNORE INTO ingested_log_files (key, ingested_at, entries) VALUES (?, CURRENT_TIMESTAMP, ?)`, log.Key, log.Entries)
+	if err != nil {
+		return false, err
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	if n == 0 {
+		return false, nil
+	}
+
+	for _, v := range log.Videos {
+		_, err = tx.Exec(`
+		INSERT INTO video_delivery_stats (video_id, day, bytes, requests)
+		VALUES (?, ?, ?, ?)
+		ON CONFLICT (video_id, day) DO UPDATE SET
+			bytes = bytes + excluded.bytes,
+			requests = requests + excluded.requests
+		`, v.VideoID, v.Day, v.Bytes, v.Requests)
+		if err != nil {
+			return false, err
+		}
+	}
+
+	for _, u := range log.Users {
+		_, err = tx.Exec(`
+		INSERT INTO monthly_usage (user_id, month, updated_at, egress_bytes_measured, delivery_requests)
+		VALUES (?, ?, CURRENT_TIMESTAMP, ?, ?)
+		ON CONFLICT (user_id, month) DO UPDATE SET
+			egress_bytes_measured = egress_bytes_measured + excluded.egress_bytes_measured,
+			delivery_requests = delivery_requests + excluded.delivery_requests,
+			updated_at = CURRENT_TIMESTAMP
+		`, u.UserID.String(), u.Month, u.Bytes, u.Requests)
+		if err != nil {
+			return false, err
+		}
+	}
+
+	return true, tx.Commit()
+}
+
+func (c Client) IsLogFileIngested(key string) (bool, error) {
+	var exists bool
+	err := c.db.QueryRow(`SELECT EXISTS (SELECT 1 FROM ingested_log_files WHERE key = ?)`, key).Scan(&exists)
+	return exists, err
+}
+
+func (c Client) GetVideoDeliveryStats(videoID uuid.UUID) ([]VideoDelivery, error) {
+	query := `
+	SELECT video_id, day, bytes, requests
+	FROM video_delivery_stats
+	WHERE video_id = ?
+	ORDER BY day
+	`
+	ctx, cancel := c.readContext()
+	defer cancel()
+	rows, err := c.reader.QueryContext(ctx, query, videoID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	stats := []VideoDelivery{}
+	for rows.Next() {
+		var s VideoDelivery
+		if err := rows.Scan(&s.VideoID, &s.Day, &s.Bytes, &s.Requests); err != nil {
+			return nil, err
+		}
+		stats = append(stats, s)
+	}
+	return stats, rows.Err()
+}
@@ -0,0 +1,100 @@
+package database
+
+import (
+	"database/sql"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// EmbedToken lets third-party sites embed a video. The token is part of the
+// embed URL and so not a secret; what guards it is the referrer check
+// against AllowedDomains.
+type EmbedToken struct {
+	Token     string    `json:"token"`
+	CreatedAt time.Time `json:"created_at"`
+	CreateEmbedTokenParams
+}
+
+type CreateEmbedTokenParams struct {
+	VideoID uuid.UUID `json:"video_id"`
+	UserID  uuid.UUID `json:"user_id"`
+	// AllowedDomains match themselves and their subdomains.
+	AllowedDomains []string `json:"allowed_domains"`
+}
+
+func (c Client) CreateEmbedToken(token string, params CreateEmbedTokenParams) (EmbedToken, error) {
+	query := `
+	INSERT INTO embed_tokens (token, created_at, video_id, user_id, allowed_domains)
+	VALUES (?, ?, ?, ?, ?)
+	`
+	_, err := c.db.Exec(query, token, formatTimestamp(now()), params.VideoID, params.UserID, strings.Join(params.AllowedDomains, ","))
+	if err != nil {
+		return EmbedToken{}, err
+	}
+	embedToken, err := c.GetEmbedToken(token)
+	if err != nil {
+		return EmbedToken{}, err
+	}
+	return *embedToken, nil
+}
+
+// GetEmbedToken returns nil if the token doesn't exist.
+func (c Client) GetEmbedToken(token string) (*EmbedToken, error) {
+	tokens, err := c.getEmbedTokens("WHERE token = ?", token)
+	if err != nil {
+		return nil, err
+	}
+	if len(tokens) == 0 {
+		return nil, nil
+	}
+	return &tokens[0], nil
+}
+
+func (c Client) GetEmbedTokensForVideo(videoID uuid.UUID) ([]EmbedToken, error) {
+	return c.getEmbedTokens("WHERE video_id = ?", videoID)
+}
+
+// DeleteEmbedToken revokes a token, returning sql.ErrNoRows if the video
+// has no such token.
+func (c Client) DeleteEmbedToken(videoID uuid.UUID, token string) error {
+	result, err := c.db.Exec(`DELETE FROM embed_tokens WHERE video_id = ? AND token = ?`, videoID, token)
+	if err != nil {
+		return err
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+func (c Client) getEmbedTokens(where string, args ...any) ([]EmbedToken, error) {
+	query := `
+	SELECT token, created_at, video_id, user_id, allowed_domains
+	FROM embed_tokens
+	` + where + `
+	ORDER BY created_at
+	`
+	rows, err := c.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	tokens := []EmbedToken{}
+	for rows.Next() {
+		var t EmbedToken
+		var domains string
+		if err := rows.Scan(&t.Token, &t.CreatedAt, &t.VideoID, &t.UserID, &domains); err != nil {
+			return nil, err
+		}
+		t.AllowedDomains = strings.Split(domains, ",")
+		tokens = append(tokens, t)
+	}
+	return tokens, rows.Err()
+}
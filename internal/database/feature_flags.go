@@ -0,0 +1,98 @@
+package database
+
+import (
+	"hash/fnv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// FeatureFlag gates a feature that's still being rolled out. A disabled flag
+// is off for everyone; an enabled one is on for UserIDs and for
+// RolloutPercent of all other users.
+type FeatureFlag struct {
+	Name      string    `json:"name"`
+	UpdatedAt time.Time `json:"updated_at"`
+	SetFeatureFlagParams
+}
+
+type SetFeatureFlagParams struct {
+	Enabled        bool        `json:"enabled"`
+	RolloutPercent int         `json:"rollout_percent"`
+	UserIDs        []uuid.UUID `json:"user_ids"`
+}
+
+// EnabledFor decides the flag for one user. Users are bucketed by a hash of
+// the flag name and their ID, so raising the percentage only ever adds
+// users, and different flags roll out to different users.
+func (f FeatureFlag) EnabledFor(userID uuid.UUID) bool {
+	if !f.Enabled {
+		return false
+	}
+	for _, id := range f.UserIDs {
+		if id == userID {
+			return true
+		}
+	}
+	if f.RolloutPercent >= 100 {
+		return true
+	}
+	if f.RolloutPercent <= 0 || userID == uuid.Nil {
+		return false
+	}
+	h := fnv.New32a()
+	h.Write([]byte(f.Name))
+	h.Write(userID[:])
+	return int(h.Sum32()%100) < f.RolloutPercent
+}
+
+func (c Client) GetFeatureFlags() ([]FeatureFlag, error) {
+	rows, err := c.db.Query(`
+	SELECT name, updated_at, enabled, rollout_percent, user_ids
+	FROM feature_flags
+	ORDER BY name
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	flags := []FeatureFlag{}
+	for rows.Next() {
+		var f FeatureFlag
+		var userIDs string
+		if err := rows.Scan(&f.Name, &f.UpdatedAt, &f.Enabled, &f.RolloutPercent, &userIDs); err != nil {
+			return nil, err
+		}
+		f.UserIDs = []uuid.UUID{}
+		for _, s := range strings.Split(userIDs, ",") {
+			if id, err := uuid.Parse(s); err == nil {
+				f.UserIDs = append(f.UserIDs, id)
+			}
+		}
+		flags = append(flags, f)
+	}
+	return flags, rows.Err()
+}
+
+// SetFeatureFlag creates or replaces the flag.
+func (c Client) SetFeatureFlag(name string, params SetFeatureFlagParams) error {
+	userIDs := make([]string, len(params.UserIDs))
+	for i, id := range params.UserIDs {
+		userIDs[i] = id.String()
+	}
+	query := `
+	INSERT OR REPLACE INTO feature_flags (name, updated_at, enabled, rollout_percent, user_ids)
+	VALUES (?, ?, ?, ?, ?)
+	`
+	_, err := c.db.Exec(query, name, formatTimestamp(now()), params.Enabled, params.RolloutPercent, strings.Join(userIDs, ","))
+	return err
+}
+
+// DeleteFeatureFlag forgets the flag, so the feature falls back to its
+// default.
+func (c Client) DeleteFeatureFlag(name string) error {
+	_, err := c.db.Exec(`DELETE FROM feature_flags WHERE name = ?`, name)
+	return err
+}
@@ -0,0 +1,97 @@
+package database
+
+import (
+	"encoding/json"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// HTTPAction is an admin-configured request sent on notification events,
+// see notify.HTTPAction.
+type HTTPAction struct {
+	ID        uuid.UUID `json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+	CreateHTTPActionParams
+}
+
+type CreateHTTPActionParams struct {
+	Name   string   `json:"name"`
+	Events []string `json:"events"`
+	Method string   `json:"method"`
+	// URL, the header values and Body are Go templates.
+	URL     string            `json:"url"`
+	Headers map[string]string `json:"headers"`
+	Body    string            `json:"body"`
+}
+
+func (c Client) CreateHTTPAction(params CreateHTTPActionParams) (HTTPAction, error) {
+	id := uuid.New()
+	headers := []byte("{}")
+	if len(params.Headers) > 0 {
+		var err error
+		headers, err = json.Marshal(params.Headers)
+		if err != nil {
+			return HTTPAction{}, err
+		}
+	}
+	_, err := c.db.Exec(`
+	INSERT INTO http_actions (id, created_at, name, events, method, url, headers, body)
+	VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+	`, id, formatTimestamp(now()), params.Name, strings.Join(params.Events, ","), params.Method, params.URL, string(headers), params.Body)
+	if err != nil {
+		return HTTPAction{}, err
+	}
+
+	actions, err := c.getHTTPActions("WHERE id = ?", id)
+	if err != nil || len(actions) == 0 {
+		return HTTPAction{}, err
+	}
+	return actions[0], nil
+}
+
+func (c Client) GetHTTPActions() ([]HTTPAction, error) {
+	return c.getHTTPActions("")
+}
+
+// GetHTTPActionsForEvent returns the actions triggered by event.
+func (c Client) GetHTTPActionsForEvent(event string) ([]HTTPAction, error) {
+	return c.getHTTPActions("WHERE ',' || events || ',' LIKE ?", "%,"+event+",%")
+}
+
+func (c Client) DeleteHTTPAction(id uuid.UUID) error {
+	_, err := c.db.Exec(`DELETE FROM http_actions WHERE id = ?`, id)
+	return err
+}
+
+func (c Client) getHTTPActions(where string, args ...any) ([]HTTPAction, error) {
+	query := `
+	SELECT id, created_at, name, events, method, url, headers, body
+	FROM http_actions
+	` + where + `
+	ORDER BY created_at
+	`
+	rows, err := c.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	actions := []HTTPAction{}
+	for rows.Next() {
+		var a HTTPAction
+		var events, headers string
+		if err := rows.Scan(&a.ID, &a.CreatedAt, &a.Name, &events, &a.Method, &a.URL, &headers, &a.Body); err != nil {
+			return nil, err
+		}
+		a.Events = []string{}
+		if events != "" {
+			a.Events = strings.Split(events, ",")
+		}
+		a.Headers = map[string]string{}
+		json.Unmarshal([]byte(headers), &a.Headers)
+		actions = append(actions, a)
+	}
+	return actions, rows.Err()
+}
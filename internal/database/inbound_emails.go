@@ -0,0 +1,16 @@
+package database
+
+// RecordInboundEmail records a received email by its SES message ID. It
+// returns false if the email was recorded before, since SNS can deliver a
+// notification more than once.
+func (c Client) RecordInboundEmail(messageID string) (bool, error) {
+	result, err := c.db.Exec(`INSERT OR IGNORE INTO inbound_emails (message_id, received_at) VALUES (?, ?)`, messageID, formatTimestamp(now()))
+	if err != nil {
+		return false, err
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return n > 0, nil
+}
@@ -0,0 +1,76 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+)
+
+type LoginFailures struct {
+	Count         int
+	LastFailureAt time.Time
+}
+
+func (c Client) RecordLoginAttempt(email, ipAddress string, succeeded bool) error {
+	query := `
+		INSERT INTO login_attempts (created_at, email, ip_address, succeeded)
+		VALUES (?, ?, ?, ?)
+	`
+	_, err := c.db.Exec(query, time.Now().UTC(), email, ipAddress, succeeded)
+	return err
+}
+
+// GetLoginFailuresForEmail counts failed logins for an account since the
+// given time, ignoring any failures that happened before the account's most
+// recent successful login.
+func (c Client) GetLoginFailuresForEmail(email string, since time.Time) (LoginFailures, error) {
+	var lastSuccess time.Time
+	err := c.db.QueryRow(`
+		SELECT created_at
+		FROM login_attempts
+		WHERE email = ? AND succeeded = 1
+		ORDER BY created_at DESC
+		LIMIT 1
+	`, email).Scan(&lastSuccess)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return LoginFailures{}, err
+	}
+	if lastSuccess.After(since) {
+		since = lastSuccess
+	}
+	return c.getLoginFailures("email", email, since)
+}
+
+// GetLoginFailuresForIP counts failed logins from an address since the given
+// time. Successful logins don't reset the count, otherwise an attacker could
+// clear it by logging into their own account.
+func (c Client) GetLoginFailuresForIP(ipAddress string, since time.Time) (LoginFailures, error) {
+	return c.getLoginFailures("ip_address", ipAddress, since)
+}
+
+func (c Client) getLoginFailures(column, value string, since time.Time) (LoginFailures, error) {
+	query := `
+		SELECT created_at
+		FROM login_attempts
+		WHERE ` + column + ` = ? AND succeeded = 0 AND created_at > ?
+		ORDER BY created_at DESC
+	`
+	rows, err := c.db.Query(query, value, since)
+	if err != nil {
+		return LoginFailures{}, err
+	}
+	defer rows.Close()
+
+	var failures LoginFailures
+	for rows.Next() {
+		var createdAt time.Time
+		if err := rows.Scan(&createdAt); err != nil {
+			return LoginFailures{}, err
+		}
+		if failures.Count == 0 {
+			failures.LastFailureAt = createdAt
+		}
+		failures.Count++
+	}
+	return failures, rows.Err()
+}
@@ -0,0 +1,66 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Maintenance is the single row that exists while the API is read-only.
+type Maintenance struct {
+	EnabledAt time.Time `json:"enabled_at"`
+	EnabledBy uuid.UUID `json:"enabled_by"`
+	SetMaintenanceParams
+}
+
+type SetMaintenanceParams struct {
+	// Reason tells other admins what's going on. Users only see a generic
+	// message.
+	Reason            string `json:"reason"`
+	RetryAfterSeconds int    `json:"retry_after_seconds"`
+}
+
+// GetMaintenance returns nil when maintenance mode is off.
+func (c Client) GetMaintenance() (*Maintenance, error) {
+	var m Maintenance
+	err := c.db.QueryRow(`
+	SELECT enabled_at, enabled_by, reason, retry_after_seconds
+	FROM maintenance_mode
+	WHERE id = 1
+	`).Scan(&m.EnabledAt, &m.EnabledBy, &m.Reason, &m.RetryAfterSeconds)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &m, nil
+}
+
+// SetMaintenance turns maintenance mode on, or updates it if it's already on.
+func (c Client) SetMaintenance(enabledBy uuid.UUID, params SetMaintenanceParams) (Maintenance, error) {
+	query := `
+	INSERT INTO maintenance_mode (id, enabled_at, enabled_by, reason, retry_after_seconds)
+	VALUES (1, ?, ?, ?, ?)
+	ON CONFLICT (id) DO UPDATE SET
+		enabled_by = excluded.enabled_by,
+		reason = excluded.reason,
+		retry_after_seconds = excluded.retry_after_seconds
+	`
+	_, err := c.db.Exec(query, formatTimestamp(now()), enabledBy, params.Reason, params.RetryAfterSeconds)
+	if err != nil {
+		return Maintenance{}, err
+	}
+	m, err := c.GetMaintenance()
+	if err != nil {
+		return Maintenance{}, err
+	}
+	return *m, nil
+}
+
+func (c Client) ClearMaintenance() error {
+	_, err := c.db.Exec(`DELETE FROM maintenance_mode`)
+	return err
+}
@@ -0,0 +1,132 @@
+package database
+
+import (
+	"embed"
+	"fmt"
+	"io/fs"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// migrations are applied in file name order, each once. They're written to
+// be safe on databases that predate the schema_migrations table, which is
+// why they use IF NOT EXISTS. SQLite has no ADD COLUMN IF NOT EXISTS, so
+// ALTER TABLE ... ADD COLUMN statements are skipped instead when the column
+// is already there, as it is in databases older versions of the app added
+// it to on startup.
+//
+//go:embed migrations/*.sql
+var migrations embed.FS
+
+func (c *Client) runMigrations() error {
+	_, err := c.db.Exec(`
+	CREATE TABLE IF NOT EXISTS schema_migrations (
+		version TEXT PRIMARY KEY,
+		applied_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+	);
+	`)
+	if err != nil {
+		return err
+	}
+
+	applied := map[string]bool{}
+	rows, err := c.db.Query(`SELECT version FROM schema_migrations`)
+	if err != nil {
+		return err
+	}
+	for rows.Next() {
+		var version string
+		if err := rows.Scan(&version); err != nil {
+			rows.Close()
+			return err
+		}
+		applied[version] = true
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	names, err := fs.Glob(migrations, "migrations/*.sql")
+	if err != nil {
+		return err
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		version := strings.TrimSuffix(strings.TrimPrefix(name, "migrations/"), ".sql")
+		if applied[version] {
+			continue
+		}
+		if err := c.applyMigration(name, version); err != nil {
+			return fmt.Errorf("migration %s: %w", version, err)
+		}
+	}
+	return nil
+}
+
+func (c *Client) applyMigration(name, version string) error {
+	data, err := migrations.ReadFile(name)
+	if err != nil {
+		return err
+	}
+	script, err := c.skipExistingColumns(string(data))
+	if err != nil {
+		return err
+	}
+
+	tx, err := c.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec(script)
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec(`INSERT INTO schema_migrations (version) VALUES (?)`, version)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+var addColumnStatement = regexp.MustCompile(`(?im)^\s*ALTER\s+TABLE\s+(\w+)\s+ADD\s+COLUMN\s+(\w+)[^;]*;`)
+
+// skipExistingColumns drops the ADD COLUMN statements of script whose column
+// already exists.
+func (c *Client) skipExistingColumns(script string) (string, error) {
+	var err error
+	script = addColumnStatement.ReplaceAllStringFunc(script, func(statement string) string {
+		match := addColumnStatement.FindStringSubmatch(statement)
+		exists, existsErr := c.columnExists(match[1], match[2])
+		if existsErr != nil {
+			err = existsErr
+		}
+		if exists {
+			return ""
+		}
+		return statement
+	})
+	return script, err
+}
+
+// SchemaVersion returns the newest migration applied to the database and the
+// newest one embedded in this binary. applied sorts after latest when the
+// database was last opened by a newer release.
+func (c Client) SchemaVersion() (applied, latest string, err error) {
+	err = c.db.QueryRow(`SELECT COALESCE(MAX(version), '') FROM schema_migrations`).Scan(&applied)
+	if err != nil {
+		return "", "", err
+	}
+	names, err := fs.Glob(migrations, "migrations/*.sql")
+	if err != nil {
+		return "", "", err
+	}
+	sort.Strings(names)
+	if len(names) > 0 {
+		latest = strings.TrimSuffix(strings.TrimPrefix(names[len(names)-1], "migrations/"), ".sql")
+	}
+	return applied, latest, nil
+}
@@ -0,0 +1,9 @@
+CREATE TABLE IF NOT EXISTS user_tokens (
+	token_hash TEXT PRIMARY KEY,
+	created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+	user_id TEXT NOT NULL,
+	purpose TEXT NOT NULL,
+	expires_at TIMESTAMP NOT NULL,
+	used_at TIMESTAMP,
+	FOREIGN KEY(user_id) REFERENCES users(id)
+);
@@ -0,0 +1,9 @@
+CREATE TABLE IF NOT EXISTS login_attempts (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	created_at TIMESTAMP NOT NULL,
+	email TEXT NOT NULL,
+	ip_address TEXT NOT NULL,
+	succeeded BOOLEAN NOT NULL
+);
+CREATE INDEX IF NOT EXISTS idx_login_attempts_email ON login_attempts(email, created_at);
+CREATE INDEX IF NOT EXISTS idx_login_attempts_ip ON login_attempts(ip_address, created_at);
@@ -0,0 +1,9 @@
+CREATE TABLE IF NOT EXISTS audit_events (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+	event TEXT NOT NULL,
+	user_id TEXT,
+	email TEXT NOT NULL DEFAULT '',
+	ip_address TEXT NOT NULL DEFAULT '',
+	details TEXT NOT NULL DEFAULT ''
+);
@@ -0,0 +1,10 @@
+CREATE TABLE IF NOT EXISTS transcode_jobs (
+	id TEXT PRIMARY KEY,
+	created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+	updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+	video_id TEXT NOT NULL,
+	provider TEXT NOT NULL,
+	status TEXT NOT NULL,
+	error TEXT NOT NULL DEFAULT '',
+	FOREIGN KEY(video_id) REFERENCES videos(id)
+);
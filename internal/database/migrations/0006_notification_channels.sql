@@ -0,0 +1,7 @@
+CREATE TABLE IF NOT EXISTS notification_channels (
+	id TEXT PRIMARY KEY,
+	created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+	kind TEXT NOT NULL,
+	target TEXT NOT NULL,
+	events TEXT NOT NULL
+);
@@ -0,0 +1,12 @@
+CREATE TABLE IF NOT EXISTS monthly_usage (
+	user_id TEXT NOT NULL,
+	month TEXT NOT NULL,
+	updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+	storage_bytes_peak INTEGER NOT NULL DEFAULT 0,
+	egress_bytes_estimated INTEGER NOT NULL DEFAULT 0,
+	egress_bytes_measured INTEGER NOT NULL DEFAULT 0,
+	url_issuances INTEGER NOT NULL DEFAULT 0,
+	delivery_requests INTEGER NOT NULL DEFAULT 0,
+	PRIMARY KEY (user_id, month),
+	FOREIGN KEY(user_id) REFERENCES users(id)
+);
@@ -0,0 +1,13 @@
+CREATE TABLE IF NOT EXISTS video_delivery_stats (
+	video_id TEXT NOT NULL,
+	day TEXT NOT NULL,
+	bytes INTEGER NOT NULL DEFAULT 0,
+	requests INTEGER NOT NULL DEFAULT 0,
+	PRIMARY KEY (video_id, day),
+	FOREIGN KEY(video_id) REFERENCES videos(id)
+);
+CREATE TABLE IF NOT EXISTS ingested_log_files (
+	key TEXT PRIMARY KEY,
+	ingested_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+	entries INTEGER NOT NULL
+);
@@ -0,0 +1,11 @@
+CREATE TABLE IF NOT EXISTS video_takedowns (
+	video_id TEXT PRIMARY KEY,
+	created_at TIMESTAMP NOT NULL,
+	kind TEXT NOT NULL,
+	reason TEXT NOT NULL,
+	created_by TEXT NOT NULL,
+	appeal_message TEXT NOT NULL DEFAULT '',
+	appealed_at TIMESTAMP,
+	appeal_status TEXT NOT NULL DEFAULT '',
+	FOREIGN KEY(video_id) REFERENCES videos(id)
+);
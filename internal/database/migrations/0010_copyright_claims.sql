@@ -0,0 +1,17 @@
+CREATE TABLE IF NOT EXISTS copyright_claims (
+	id TEXT PRIMARY KEY,
+	created_at TIMESTAMP NOT NULL,
+	status TEXT NOT NULL,
+	video_id TEXT NOT NULL,
+	claimant_id TEXT NOT NULL,
+	work TEXT NOT NULL,
+	details TEXT NOT NULL DEFAULT '',
+	contact_email TEXT NOT NULL,
+	dispute_message TEXT NOT NULL DEFAULT '',
+	disputed_at TIMESTAMP,
+	resolution_note TEXT NOT NULL DEFAULT '',
+	resolved_at TIMESTAMP,
+	FOREIGN KEY(video_id) REFERENCES videos(id),
+	FOREIGN KEY(claimant_id) REFERENCES users(id)
+);
+CREATE INDEX IF NOT EXISTS idx_copyright_claims_video ON copyright_claims(video_id, status);
@@ -0,0 +1,10 @@
+CREATE TABLE IF NOT EXISTS embed_tokens (
+	token TEXT PRIMARY KEY,
+	created_at TIMESTAMP NOT NULL,
+	video_id TEXT NOT NULL,
+	user_id TEXT NOT NULL,
+	allowed_domains TEXT NOT NULL,
+	FOREIGN KEY(video_id) REFERENCES videos(id),
+	FOREIGN KEY(user_id) REFERENCES users(id)
+);
+CREATE INDEX IF NOT EXISTS idx_embed_tokens_video ON embed_tokens(video_id);
@@ -0,0 +1,7 @@
+CREATE TABLE IF NOT EXISTS feature_flags (
+	name TEXT PRIMARY KEY,
+	updated_at TIMESTAMP NOT NULL,
+	enabled BOOLEAN NOT NULL DEFAULT FALSE,
+	rollout_percent INTEGER NOT NULL DEFAULT 0,
+	user_ids TEXT NOT NULL DEFAULT ''
+);
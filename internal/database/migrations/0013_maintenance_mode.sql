@@ -0,0 +1,7 @@
+CREATE TABLE IF NOT EXISTS maintenance_mode (
+	id INTEGER PRIMARY KEY CHECK (id = 1),
+	enabled_at TIMESTAMP NOT NULL,
+	enabled_by TEXT NOT NULL,
+	reason TEXT NOT NULL,
+	retry_after_seconds INTEGER NOT NULL
+);
@@ -0,0 +1,16 @@
+CREATE TABLE IF NOT EXISTS bucket_migrations (
+	id TEXT PRIMARY KEY,
+	created_at TIMESTAMP NOT NULL,
+	updated_at TIMESTAMP NOT NULL,
+	source_bucket TEXT NOT NULL,
+	source_url TEXT NOT NULL,
+	dest_bucket TEXT NOT NULL,
+	dest_region TEXT NOT NULL,
+	dest_prefix TEXT NOT NULL,
+	dest_url TEXT NOT NULL,
+	status TEXT NOT NULL,
+	objects_copied INTEGER NOT NULL DEFAULT 0,
+	objects_verified INTEGER NOT NULL DEFAULT 0,
+	bytes_copied INTEGER NOT NULL DEFAULT 0,
+	flipped_at TIMESTAMP
+);
@@ -0,0 +1,24 @@
+CREATE TABLE IF NOT EXISTS reconciliation_reports (
+	id TEXT PRIMARY KEY,
+	created_at TIMESTAMP NOT NULL,
+	bucket TEXT NOT NULL,
+	objects_scanned INTEGER NOT NULL,
+	artifacts_checked INTEGER NOT NULL,
+	orphaned_objects INTEGER NOT NULL,
+	missing_objects INTEGER NOT NULL,
+	size_mismatches INTEGER NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS reconciliation_findings (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	report_id TEXT NOT NULL,
+	kind TEXT NOT NULL,
+	key TEXT NOT NULL,
+	artifact_id INTEGER,
+	video_id TEXT,
+	object_size INTEGER,
+	recorded_size INTEGER,
+	FOREIGN KEY(report_id) REFERENCES reconciliation_reports(id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_reconciliation_findings_report ON reconciliation_findings(report_id);
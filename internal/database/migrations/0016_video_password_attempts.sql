@@ -0,0 +1,8 @@
+CREATE TABLE IF NOT EXISTS video_password_attempts (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	created_at TIMESTAMP NOT NULL,
+	video_id TEXT NOT NULL,
+	ip_address TEXT NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_video_password_attempts_video_ip ON video_password_attempts(video_id, ip_address, created_at);
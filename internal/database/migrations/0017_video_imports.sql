@@ -0,0 +1,22 @@
+CREATE TABLE IF NOT EXISTS video_imports (
+	id TEXT PRIMARY KEY,
+	created_at TIMESTAMP NOT NULL,
+	updated_at TIMESTAMP NOT NULL,
+	user_id TEXT NOT NULL,
+	source TEXT NOT NULL,
+	status TEXT NOT NULL,
+	finished_at TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_video_imports_user ON video_imports(user_id, created_at);
+
+CREATE TABLE IF NOT EXISTS video_import_items (
+	import_id TEXT NOT NULL,
+	position INTEGER NOT NULL,
+	source_id TEXT NOT NULL,
+	title TEXT NOT NULL,
+	status TEXT NOT NULL,
+	video_id TEXT,
+	error TEXT NOT NULL DEFAULT '',
+	PRIMARY KEY (import_id, position)
+);
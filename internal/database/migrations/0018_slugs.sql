@@ -0,0 +1,10 @@
+CREATE TABLE IF NOT EXISTS slugs (
+	slug TEXT PRIMARY KEY,
+	created_at TIMESTAMP NOT NULL,
+	user_id TEXT NOT NULL,
+	target_type TEXT NOT NULL,
+	target_id TEXT NOT NULL,
+	hits INTEGER NOT NULL DEFAULT 0
+);
+
+CREATE INDEX IF NOT EXISTS idx_slugs_target ON slugs(target_type, target_id);
@@ -0,0 +1,59 @@
+CREATE TABLE IF NOT EXISTS cms_syncs (
+	id TEXT PRIMARY KEY,
+	created_at TIMESTAMP NOT NULL,
+	user_id TEXT NOT NULL,
+	url TEXT NOT NULL,
+	format TEXT NOT NULL,
+	graphql_query TEXT NOT NULL DEFAULT '',
+	field_map TEXT NOT NULL DEFAULT '{}',
+	secret TEXT NOT NULL,
+	FOREIGN KEY(user_id) REFERENCES users(id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_cms_syncs_user ON cms_syncs(user_id);
+
+CREATE TABLE IF NOT EXISTS cms_sync_events (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	created_at TIMESTAMP NOT NULL,
+	sync_id TEXT NOT NULL,
+	video_id TEXT NOT NULL,
+	event TEXT NOT NULL,
+	status TEXT NOT NULL DEFAULT 'pending',
+	attempts INTEGER NOT NULL DEFAULT 0,
+	next_attempt_at TIMESTAMP NOT NULL,
+	last_error TEXT NOT NULL DEFAULT '',
+	delivered_at TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_cms_sync_events_status ON cms_sync_events(status, id);
+CREATE INDEX IF NOT EXISTS idx_cms_sync_events_sync ON cms_sync_events(sync_id, id);
+
+CREATE TRIGGER IF NOT EXISTS cms_sync_video_created AFTER INSERT ON videos
+BEGIN
+	INSERT INTO cms_sync_events (created_at, sync_id, video_id, event, next_attempt_at)
+	SELECT strftime('%Y-%m-%d %H:%M:%f', 'now'), id, NEW.id, 'video.created', strftime('%Y-%m-%d %H:%M:%f', 'now')
+	FROM cms_syncs
+	WHERE user_id = NEW.user_id;
+END;
+
+CREATE TRIGGER IF NOT EXISTS cms_sync_video_updated AFTER UPDATE OF updated_at ON videos
+WHEN NEW.updated_at IS NOT OLD.updated_at
+BEGIN
+	INSERT INTO cms_sync_events (created_at, sync_id, video_id, event, next_attempt_at)
+	SELECT strftime('%Y-%m-%d %H:%M:%f', 'now'), s.id, NEW.id, 'video.updated', strftime('%Y-%m-%d %H:%M:%f', 'now')
+	FROM cms_syncs s
+	WHERE s.user_id = NEW.user_id
+	AND NOT EXISTS (
+		SELECT 1 FROM cms_sync_events e
+		WHERE e.sync_id = s.id AND e.video_id = NEW.id AND e.event = 'video.updated'
+		AND e.status = 'pending' AND e.attempts = 0
+	);
+END;
+
+CREATE TRIGGER IF NOT EXISTS cms_sync_video_deleted AFTER DELETE ON videos
+BEGIN
+	INSERT INTO cms_sync_events (created_at, sync_id, video_id, event, next_attempt_at)
+	SELECT strftime('%Y-%m-%d %H:%M:%f', 'now'), id, OLD.id, 'video.deleted', strftime('%Y-%m-%d %H:%M:%f', 'now')
+	FROM cms_syncs
+	WHERE user_id = OLD.user_id;
+END;
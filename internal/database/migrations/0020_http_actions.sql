@@ -0,0 +1,10 @@
+CREATE TABLE IF NOT EXISTS http_actions (
+	id TEXT PRIMARY KEY,
+	created_at TIMESTAMP NOT NULL,
+	name TEXT NOT NULL,
+	events TEXT NOT NULL,
+	method TEXT NOT NULL,
+	url TEXT NOT NULL,
+	headers TEXT NOT NULL DEFAULT '{}',
+	body TEXT NOT NULL DEFAULT ''
+);
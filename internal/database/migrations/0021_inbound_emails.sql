@@ -0,0 +1,4 @@
+CREATE TABLE IF NOT EXISTS inbound_emails (
+	message_id TEXT PRIMARY KEY,
+	received_at TIMESTAMP NOT NULL
+);
@@ -0,0 +1,24 @@
+CREATE TABLE IF NOT EXISTS upload_sessions (
+	token TEXT PRIMARY KEY,
+	created_at TIMESTAMP NOT NULL,
+	expires_at TIMESTAMP NOT NULL,
+	user_id TEXT NOT NULL,
+	video_id TEXT NOT NULL,
+	size_bytes INTEGER NOT NULL,
+	part_size INTEGER NOT NULL,
+	content_type TEXT NOT NULL,
+	quality TEXT NOT NULL DEFAULT '',
+	s3_key TEXT NOT NULL,
+	s3_upload_id TEXT NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_upload_sessions_video ON upload_sessions(video_id);
+
+CREATE TABLE IF NOT EXISTS upload_session_parts (
+	token TEXT NOT NULL,
+	number INTEGER NOT NULL,
+	size_bytes INTEGER NOT NULL,
+	etag TEXT NOT NULL,
+	uploaded_at TIMESTAMP NOT NULL,
+	PRIMARY KEY (token, number)
+);
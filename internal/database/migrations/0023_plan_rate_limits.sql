@@ -0,0 +1,7 @@
+CREATE TABLE IF NOT EXISTS plan_rate_limits (
+	plan TEXT PRIMARY KEY,
+	updated_at TIMESTAMP NOT NULL,
+	max_requests INTEGER NOT NULL,
+	max_distinct INTEGER NOT NULL,
+	burst INTEGER NOT NULL
+);
@@ -0,0 +1,22 @@
+CREATE TABLE IF NOT EXISTS processing_windows (
+	id TEXT PRIMARY KEY,
+	created_at TIMESTAMP NOT NULL,
+	created_by TEXT NOT NULL,
+	reason TEXT NOT NULL,
+	daily_start TEXT NOT NULL DEFAULT '',
+	daily_end TEXT NOT NULL DEFAULT '',
+	timezone TEXT NOT NULL DEFAULT '',
+	starts_at TIMESTAMP,
+	ends_at TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS queued_uploads (
+	video_id TEXT PRIMARY KEY,
+	queued_at TIMESTAMP NOT NULL,
+	user_id TEXT NOT NULL,
+	s3_key TEXT NOT NULL,
+	media_type TEXT NOT NULL,
+	size_bytes INTEGER NOT NULL,
+	quality TEXT NOT NULL DEFAULT '',
+	attempts INTEGER NOT NULL DEFAULT 0
+);
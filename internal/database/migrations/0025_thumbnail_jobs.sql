@@ -0,0 +1,6 @@
+CREATE TABLE IF NOT EXISTS thumbnail_jobs (
+	video_id TEXT PRIMARY KEY,
+	id TEXT NOT NULL,
+	queued_at TIMESTAMP NOT NULL,
+	attempts INTEGER NOT NULL DEFAULT 0
+);
@@ -0,0 +1,12 @@
+CREATE TABLE IF NOT EXISTS tus_uploads (
+	id TEXT PRIMARY KEY,
+	created_at TIMESTAMP NOT NULL,
+	expires_at TIMESTAMP NOT NULL,
+	user_id TEXT NOT NULL,
+	video_id TEXT NOT NULL,
+	size_bytes INTEGER NOT NULL,
+	content_type TEXT NOT NULL,
+	quality TEXT NOT NULL DEFAULT ''
+);
+
+CREATE INDEX IF NOT EXISTS idx_tus_uploads_video ON tus_uploads(video_id);
@@ -0,0 +1,16 @@
+CREATE TABLE IF NOT EXISTS processing_metrics (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	recorded_at TIMESTAMP NOT NULL,
+	video_id TEXT NOT NULL,
+	pipeline TEXT NOT NULL,
+	size_bytes INTEGER NOT NULL,
+	duration_ms INTEGER NOT NULL,
+	width INTEGER NOT NULL,
+	height INTEGER NOT NULL,
+	probe_ms INTEGER NOT NULL,
+	encode_ms INTEGER NOT NULL,
+	upload_ms INTEGER NOT NULL,
+	total_ms INTEGER NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_processing_metrics_pipeline ON processing_metrics(pipeline, recorded_at);
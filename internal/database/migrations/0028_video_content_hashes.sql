@@ -0,0 +1,3 @@
+ALTER TABLE videos ADD COLUMN content_sha256 TEXT NOT NULL DEFAULT '';
+
+CREATE INDEX IF NOT EXISTS idx_videos_user_content_sha256 ON videos(user_id, content_sha256);
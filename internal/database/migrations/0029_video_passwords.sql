@@ -0,0 +1 @@
+ALTER TABLE videos ADD COLUMN password_hash TEXT NOT NULL DEFAULT '';
@@ -0,0 +1,4 @@
+ALTER TABLE videos ADD COLUMN expires_at TIMESTAMP;
+ALTER TABLE videos ADD COLUMN purge_on_expiry BOOLEAN NOT NULL DEFAULT 0;
+
+CREATE INDEX IF NOT EXISTS idx_videos_expires_at ON videos(expires_at);
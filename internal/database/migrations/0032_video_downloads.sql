@@ -0,0 +1 @@
+ALTER TABLE videos ADD COLUMN downloads_enabled BOOLEAN NOT NULL DEFAULT 0;
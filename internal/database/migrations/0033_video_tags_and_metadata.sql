@@ -0,0 +1,2 @@
+ALTER TABLE videos ADD COLUMN tags TEXT NOT NULL DEFAULT '';
+ALTER TABLE videos ADD COLUMN metadata TEXT NOT NULL DEFAULT '{}';
@@ -0,0 +1,21 @@
+-- Databases from before this migration made the artifacts table on startup,
+-- without the language column. backfillArtifacts fills it on databases
+-- older than that.
+CREATE TABLE IF NOT EXISTS artifacts (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+	video_id TEXT NOT NULL,
+	kind TEXT NOT NULL,
+	key TEXT UNIQUE NOT NULL,
+	size_bytes INTEGER NOT NULL DEFAULT 0,
+	codec TEXT NOT NULL DEFAULT '',
+	width INTEGER NOT NULL DEFAULT 0,
+	height INTEGER NOT NULL DEFAULT 0,
+	bitrate INTEGER NOT NULL DEFAULT 0,
+	duration_ms INTEGER NOT NULL DEFAULT 0,
+	FOREIGN KEY(video_id) REFERENCES videos(id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_artifacts_video ON artifacts(video_id, kind);
+
+ALTER TABLE artifacts ADD COLUMN language TEXT NOT NULL DEFAULT '';
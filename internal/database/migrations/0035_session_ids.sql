@@ -0,0 +1,11 @@
+ALTER TABLE refresh_tokens ADD COLUMN id TEXT;
+
+-- Sessions created before refresh tokens had their own IDs still need one so
+-- they can be listed and revoked individually, as do any that were given the
+-- same random one.
+UPDATE refresh_tokens
+SET id = lower(hex(randomblob(16)))
+WHERE id IS NULL
+	OR id IN (SELECT id FROM refresh_tokens GROUP BY id HAVING COUNT(*) > 1);
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_refresh_tokens_id ON refresh_tokens(id);
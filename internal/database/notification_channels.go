@@ -0,0 +1,88 @@
+package database
+
+import (
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type NotificationChannel struct {
+	ID        uuid.UUID `json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+	CreateNotificationChannelParams
+}
+
+type CreateNotificationChannelParams struct {
+	// Kind is one of "slack", "discord" or "email".
+	Kind string `json:"kind"`
+	// Target is the webhook URL, or the address for email channels.
+	Target string   `json:"target"`
+	Events []string `json:"events"`
+}
+
+func (c Client) CreateNotificationChannel(params CreateNotificationChannelParams) (NotificationChannel, error) {
+	id := uuid.New()
+	query := `
+	INSERT INTO notification_channels (
+		id,
+		created_at,
+		kind,
+		target,
+		events
+	) VALUES (?, CURRENT_TIMESTAMP, ?, ?, ?)
+	`
+	_, err := c.db.Exec(query, id, params.Kind, params.Target, strings.Join(params.Events, ","))
+	if err != nil {
+		return NotificationChannel{}, err
+	}
+
+	channels, err := c.getNotificationChannels("WHERE id = ?", id)
+	if err != nil || len(channels) == 0 {
+		return NotificationChannel{}, err
+	}
+	return channels[0], nil
+}
+
+func (c Client) GetNotificationChannels() ([]NotificationChannel, error) {
+	return c.getNotificationChannels("")
+}
+
+// GetNotificationChannelsForEvent returns the channels subscribed to event.
+func (c Client) GetNotificationChannelsForEvent(event string) ([]NotificationChannel, error) {
+	return c.getNotificationChannels("WHERE ',' || events || ',' LIKE ?", "%,"+event+",%")
+}
+
+func (c Client) DeleteNotificationChannel(id uuid.UUID) error {
+	_, err := c.db.Exec(`DELETE FROM notification_channels WHERE id = ?`, id)
+	return err
+}
+
+func (c Client) getNotificationChannels(where string, args ...any) ([]NotificationChannel, error) {
+	query := `
+	SELECT id, created_at, kind, target, events
+	FROM notification_channels
+	` + where + `
+	ORDER BY created_at
+	`
+	rows, err := c.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	channels := []NotificationChannel{}
+	for rows.Next() {
+		var ch NotificationChannel
+		var events string
+		if err := rows.Scan(&ch.ID, &ch.CreatedAt, &ch.Kind, &ch.Target, &events); err != nil {
+			return nil, err
+		}
+		ch.Events = []string{}
+		if events != "" {
+			ch.Events = strings.Split(events, ",")
+		}
+		channels = append(channels, ch)
+	}
+	return channels, rows.Err()
+}
@@ -0,0 +1,104 @@
+package database
+
+import (
+	"encoding/base64"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// VideoCursor marks the last video of a page. The next page starts strictly
+// after it in (created_at, id) descending order, so rows inserted while
+// paging never shift or repeat results the way OFFSET does.
+type VideoCursor struct {
+	CreatedAt time.Time
+	ID        uuid.UUID
+}
+
+// Encode returns the cursor as an opaque URL-safe string.
+func (c VideoCursor) Encode() string {
+	raw := c.CreatedAt.UTC().Format(time.RFC3339Nano) + "|" + c.ID.String()
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+func DecodeVideoCursor(s string) (VideoCursor, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return VideoCursor{}, ErrInvalidCursor
+	}
+	createdAt, id, ok := strings.Cut(string(raw), "|")
+	if !ok {
+		return VideoCursor{}, ErrInvalidCursor
+	}
+	var cursor VideoCursor
+	cursor.CreatedAt, err = time.Parse(time.RFC3339Nano, createdAt)
+	if err != nil {
+		return VideoCursor{}, ErrInvalidCursor
+	}
+	cursor.ID, err = uuid.Parse(id)
+	if err != nil {
+		return VideoCursor{}, ErrInvalidCursor
+	}
+	return cursor, nil
+}
+
+// GetVideosPage returns up to limit of a user's videos, newest first,
+// starting after the cursor (or from the newest when it's nil). The returned
+// cursor is nil on the last page.
+func (c Client) GetVideosPage(userID uuid.UUID, after *VideoCursor, limit int) ([]Video, *VideoCursor, error) {
+	return c.GetFilteredVideosPage(userID, VideoFilter{}, after, limit)
+}
+
+// GetFilteredVideosPage is GetVideosPage for the videos matching filter. A
+// limit of 0 returns all of them at once.
+func (c Client) GetFilteredVideosPage(userID uuid.UUID, filter VideoFilter, after *VideoCursor, limit int) ([]Video, *VideoCursor, error) {
+	where, filterArgs := filter.where()
+	query := `
+	SELECT ` + videoColumns + `
+	FROM videos
+	WHERE user_id = ?` + where + `
+	`
+	args := append([]any{userID}, filterArgs...)
+	if after != nil {
+		createdAt := formatTimestamp(after.CreatedAt)
+		query += ` AND (created_at < ? OR (created_at = ? AND id < ?))`
+		args = append(args, createdAt, createdAt, after.ID)
+	}
+	// One extra row tells us whether there's another page.
+	query += ` ORDER BY created_at DESC, id DESC`
+	if limit > 0 {
+		query += ` LIMIT ?`
+		args = append(args, limit+1)
+	}
+
+	ctx, cancel := c.readContext()
+	defer cancel()
+	rows, err := c.reader.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer rows.Close()
+
+	videos := []Video{}
+	for rows.Next() {
+		video, err := scanVideo(rows)
+		if err != nil {
+			return nil, nil, err
+		}
+		videos = append(videos, video)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, nil, err
+	}
+
+	if limit <= 0 || len(videos) <= limit {
+		return videos, nil, nil
+	}
+	videos = videos[:limit]
+	last := videos[limit-1]
+	return videos, &VideoCursor{CreatedAt: last.CreatedAt, ID: last.ID}, nil
+}
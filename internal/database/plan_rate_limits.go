@@ -0,0 +1,54 @@
+package database
+
+import "time"
+
+// PlanRateLimit overrides the delivery URL rate limits for users on a plan.
+type PlanRateLimit struct {
+	Plan      string    `json:"plan"`
+	UpdatedAt time.Time `json:"updated_at"`
+	SetPlanRateLimitParams
+}
+
+type SetPlanRateLimitParams struct {
+	MaxRequests int `json:"max_requests"`
+	MaxDistinct int `json:"max_distinct"`
+	Burst       int `json:"burst"`
+}
+
+func (c Client) GetPlanRateLimits() ([]PlanRateLimit, error) {
+	rows, err := c.db.Query(`
+	SELECT plan, updated_at, max_requests, max_distinct, burst
+	FROM plan_rate_limits
+	ORDER BY plan
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	limits := []PlanRateLimit{}
+	for rows.Next() {
+		var l PlanRateLimit
+		if err := rows.Scan(&l.Plan, &l.UpdatedAt, &l.MaxRequests, &l.MaxDistinct, &l.Burst); err != nil {
+			return nil, err
+		}
+		limits = append(limits, l)
+	}
+	return limits, rows.Err()
+}
+
+// SetPlanRateLimit creates or replaces the plan's limits.
+func (c Client) SetPlanRateLimit(plan string, params SetPlanRateLimitParams) error {
+	query := `
+	INSERT OR REPLACE INTO plan_rate_limits (plan, updated_at, max_requests, max_distinct, burst)
+	VALUES (?, ?, ?, ?, ?)
+	`
+	_, err := c.db.Exec(query, plan, formatTimestamp(now()), params.MaxRequests, params.MaxDistinct, params.Burst)
+	return err
+}
+
+// DeletePlanRateLimit puts the plan back on the default limits.
+func (c Client) DeletePlanRateLimit(plan string) error {
+	_, err := c.db.Exec(`DELETE FROM plan_rate_limits WHERE plan = ?`, plan)
+	return err
+}
@@ -0,0 +1,87 @@
+package database
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// ProcessingMetric is how long one upload took to process, phase by phase.
+// Metrics outlive their videos, since they describe the server rather than
+// the video.
+type ProcessingMetric struct {
+	RecordedAt time.Time `json:"recorded_at"`
+	VideoID    uuid.UUID `json:"video_id"`
+	// Pipeline is "ffmpeg" or the transcoder's provider.
+	Pipeline   string `json:"pipeline"`
+	SizeBytes  int64  `json:"size_bytes"`
+	DurationMS int64  `json:"duration_ms"`
+	Width      int    `json:"width"`
+	Height     int    `json:"height"`
+	ProbeMS    int64  `json:"probe_ms"`
+	EncodeMS   int64  `json:"encode_ms"`
+	UploadMS   int64  `json:"upload_ms"`
+	// TotalMS covers every phase, including the ones not timed on their
+	// own.
+	TotalMS int64 `json:"total_ms"`
+}
+
+func (c Client) CreateProcessingMetric(m ProcessingMetric) error {
+	_, err := c.db.Exec(`
+	INSERT INTO processing_metrics (recorded_at, video_id, pipeline, size_bytes, duration_ms, width, height, probe_ms, encode_ms, upload_ms, total_ms)
+	VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`, formatTimestamp(now()), m.VideoID, m.Pipeline, m.SizeBytes, m.DurationMS, m.Width, m.Height,
+		m.ProbeMS, m.EncodeMS, m.UploadMS, m.TotalMS)
+	return err
+}
+
+// GetProcessingMetrics returns the metrics recorded since the given time,
+// oldest first, of every pipeline if pipeline is empty.
+func (c Client) GetProcessingMetrics(pipeline string, since time.Time) ([]ProcessingMetric, error) {
+	if pipeline == "" {
+		return c.getProcessingMetrics("WHERE recorded_at >= ? ORDER BY id", formatTimestamp(since))
+	}
+	return c.getProcessingMetrics("WHERE pipeline = ? AND recorded_at >= ? ORDER BY id", pipeline, formatTimestamp(since))
+}
+
+// GetRecentProcessingMetrics returns the pipeline's latest limit metrics,
+// newest first.
+func (c Client) GetRecentProcessingMetrics(pipeline string, limit int) ([]ProcessingMetric, error) {
+	return c.getProcessingMetrics("WHERE pipeline = ? ORDER BY id DESC LIMIT ?", pipeline, limit)
+}
+
+// DeleteProcessingMetricsBefore removes the metrics recorded before the
+// given time and returns how many there were.
+func (c Client) DeleteProcessingMetricsBefore(before time.Time) (int64, error) {
+	result, err := c.db.Exec(`DELETE FROM processing_metrics WHERE recorded_at < ?`, formatTimestamp(before))
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+func (c Client) getProcessingMetrics(where string, args ...any) ([]ProcessingMetric, error) {
+	query := `
+	SELECT recorded_at, video_id, pipeline, size_bytes, duration_ms, width, height, probe_ms, encode_ms, upload_ms, total_ms
+	FROM processing_metrics
+	` + where
+	ctx, cancel := c.readContext()
+	defer cancel()
+	rows, err := c.reader.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	metrics := []ProcessingMetric{}
+	for rows.Next() {
+		var m ProcessingMetric
+		err := rows.Scan(&m.RecordedAt, &m.VideoID, &m.Pipeline, &m.SizeBytes, &m.DurationMS, &m.Width, &m.Height,
+			&m.ProbeMS, &m.EncodeMS, &m.UploadMS, &m.TotalMS)
+		if err != nil {
+			return nil, err
+		}
+		metrics = append(metrics, m)
+	}
+	return metrics, rows.Err()
+}
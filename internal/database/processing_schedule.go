@@ -0,0 +1,198 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// ProcessingWindow is a time during which uploads are accepted but not
+// processed, so heavy transcoding stays out of peak viewing hours.
+type ProcessingWindow struct {
+	ID        uuid.UUID `json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+	CreatedBy uuid.UUID `json:"created_by"`
+	CreateProcessingWindowParams
+}
+
+type CreateProcessingWindowParams struct {
+	Reason string `json:"reason"`
+	// DailyStart and DailyEnd are times of day like "18:00" in Timezone,
+	// for a window repeating every day. DailyEnd before DailyStart makes
+	// the window span midnight.
+	DailyStart string `json:"daily_start,omitempty"`
+	DailyEnd   string `json:"daily_end,omitempty"`
+	Timezone   string `json:"timezone,omitempty"`
+	// StartsAt and EndsAt are set instead for a one-off freeze.
+	StartsAt *time.Time `json:"starts_at,omitempty"`
+	EndsAt   *time.Time `json:"ends_at,omitempty"`
+}
+
+func (c Client) CreateProcessingWindow(createdBy uuid.UUID, params CreateProcessingWindowParams) (ProcessingWindow, error) {
+	var startsAt, endsAt *string
+	if params.StartsAt != nil && params.EndsAt != nil {
+		s, e := formatTimestamp(*params.StartsAt), formatTimestamp(*params.EndsAt)
+		startsAt, endsAt = &s, &e
+	}
+	id := uuid.New()
+	_, err := c.db.Exec(`
+	INSERT INTO processing_windows (id, created_at, created_by, reason, daily_start, daily_end, timezone, starts_at, ends_at)
+	VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`, id, formatTimestamp(now()), createdBy, params.Reason, params.DailyStart, params.DailyEnd, params.Timezone, startsAt, endsAt)
+	if err != nil {
+		return ProcessingWindow{}, err
+	}
+	windows, err := c.getProcessingWindows("WHERE id = ?", id)
+	if err != nil || len(windows) == 0 {
+		return ProcessingWindow{}, err
+	}
+	return windows[0], nil
+}
+
+func (c Client) GetProcessingWindows() ([]ProcessingWindow, error) {
+	return c.getProcessingWindows("")
+}
+
+func (c Client) DeleteProcessingWindow(id uuid.UUID) error {
+	_, err := c.db.Exec(`DELETE FROM processing_windows WHERE id = ?`, id)
+	return err
+}
+
+// DeleteEndedProcessingWindows removes freezes that ended before t. Daily
+// windows never end.
+func (c Client) DeleteEndedProcessingWindows(t time.Time) error {
+	_, err := c.db.Exec(`DELETE FROM processing_windows WHERE ends_at < ?`, formatTimestamp(t))
+	return err
+}
+
+func (c Client) getProcessingWindows(where string, args ...any) ([]ProcessingWindow, error) {
+	rows, err := c.db.Query(`
+	SELECT id, created_at, created_by, reason, daily_start, daily_end, timezone, starts_at, ends_at
+	FROM processing_windows
+	`+where+`
+	ORDER BY created_at
+	`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	windows := []ProcessingWindow{}
+	for rows.Next() {
+		var w ProcessingWindow
+		if err := rows.Scan(&w.ID, &w.CreatedAt, &w.CreatedBy, &w.Reason, &w.DailyStart, &w.DailyEnd, &w.Timezone, &w.StartsAt, &w.EndsAt); err != nil {
+			return nil, err
+		}
+		windows = append(windows, w)
+	}
+	return windows, rows.Err()
+}
+
+// QueuedUpload is an upload waiting for processing to resume. The file is
+// kept in the bucket under S3Key until then.
+type QueuedUpload struct {
+	VideoID   uuid.UUID `json:"video_id"`
+	QueuedAt  time.Time `json:"queued_at"`
+	UserID    uuid.UUID `json:"user_id"`
+	S3Key     string    `json:"-"`
+	MediaType string    `json:"media_type"`
+	SizeBytes int64     `json:"size_bytes"`
+	Quality   string    `json:"quality"`
+	// Attempts counts the times processing failed and will be retried.
+	Attempts int `json:"attempts"`
+}
+
+// QueueUpload queues the video's upload, replacing any it already had
+// queued. It returns the key of the replaced upload's file, or "" if there
+// was none.
+func (c Client) QueueUpload(q QueuedUpload) (string, error) {
+	tx, err := c.db.Begin()
+	if err != nil {
+		return "", err
+	}
+	defer tx.Rollback()
+
+	var replaced string
+	err = tx.QueryRow(`SELECT s3_key FROM queued_uploads WHERE video_id = ?`, q.VideoID).Scan(&replaced)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return "", err
+	}
+
+	_, err = tx.Exec(`
+	INSERT OR REPLACE INTO queued_uploads (video_id, queued_at, user_id, s3_key, media_type, size_bytes, quality, attempts)
+	VALUES (?, ?, ?, ?, ?, ?, ?, 0)
+	`, q.VideoID, formatTimestamp(now()), q.UserID, q.S3Key, q.MediaType, q.SizeBytes, q.Quality)
+	if err != nil {
+		return "", err
+	}
+	return replaced, tx.Commit()
+}
+
+// GetQueuedUploads returns every queued upload, oldest first.
+func (c Client) GetQueuedUploads() ([]QueuedUpload, error) {
+	return c.getQueuedUploads("")
+}
+
+// GetQueuedUploadsByVideo is GetQueuedUpload for many videos, keyed by video
+// ID. Videos without a queued upload are left out.
+func (c Client) GetQueuedUploadsByVideo(videoIDs []uuid.UUID) (map[uuid.UUID]QueuedUpload, error) {
+	queued := make(map[uuid.UUID]QueuedUpload, len(videoIDs))
+	for _, args := range chunks(videoIDs) {
+		uploads, err := c.getQueuedUploads("WHERE video_id IN "+inClause(len(args)), args...)
+		if err != nil {
+			return nil, err
+		}
+		for _, q := range uploads {
+			queued[q.VideoID] = q
+		}
+	}
+	return queued, nil
+}
+
+// GetQueuedUpload returns the video's queued upload, or nil if it has none.
+func (c Client) GetQueuedUpload(videoID uuid.UUID) (*QueuedUpload, error) {
+	uploads, err := c.getQueuedUploads("WHERE video_id = ?", videoID)
+	if err != nil || len(uploads) == 0 {
+		return nil, err
+	}
+	return &uploads[0], nil
+}
+
+// RetryQueuedUpload counts a failed attempt at processing the upload.
+func (c Client) RetryQueuedUpload(videoID uuid.UUID) error {
+	_, err := c.db.Exec(`UPDATE queued_uploads SET attempts = attempts + 1 WHERE video_id = ?`, videoID)
+	return err
+}
+
+// DeleteQueuedUpload removes the upload from the queue if it's still the one
+// stored under key, so a newer upload of the same video queued meanwhile is
+// kept.
+func (c Client) DeleteQueuedUpload(videoID uuid.UUID, key string) error {
+	_, err := c.db.Exec(`DELETE FROM queued_uploads WHERE video_id = ? AND s3_key = ?`, videoID, key)
+	return err
+}
+
+func (c Client) getQueuedUploads(where string, args ...any) ([]QueuedUpload, error) {
+	rows, err := c.db.Query(`
+	SELECT video_id, queued_at, user_id, s3_key, media_type, size_bytes, quality, attempts
+	FROM queued_uploads
+	`+where+`
+	ORDER BY queued_at
+	`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	uploads := []QueuedUpload{}
+	for rows.Next() {
+		var q QueuedUpload
+		if err := rows.Scan(&q.VideoID, &q.QueuedAt, &q.UserID, &q.S3Key, &q.MediaType, &q.SizeBytes, &q.Quality, &q.Attempts); err != nil {
+			return nil, err
+		}
+		uploads = append(uploads, q)
+	}
+	return uploads, rows.Err()
+}
@@ -0,0 +1,200 @@
+package database
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// maxReconciliationReports is how many reports are kept. Older ones are
+// removed when a new one is saved.
+const maxReconciliationReports = 30
+
+type ReconciliationFindingKind string
+
+const (
+	// FindingOrphanedObject is an object in the bucket no artifact points at.
+	FindingOrphanedObject ReconciliationFindingKind = "orphaned_object"
+	// FindingMissingObject is an artifact whose object isn't in the bucket.
+	FindingMissingObject ReconciliationFindingKind = "missing_object"
+	// FindingSizeMismatch is an artifact whose recorded size differs from
+	// its object's.
+	FindingSizeMismatch ReconciliationFindingKind = "size_mismatch"
+)
+
+// ReconciliationReport compares the bucket with the artifacts table.
+type ReconciliationReport struct {
+	ID               uuid.UUID               `json:"id"`
+	CreatedAt        time.Time               `json:"created_at"`
+	Bucket           string                  `json:"bucket"`
+	ObjectsScanned   int64                   `json:"objects_scanned"`
+	ArtifactsChecked int64                   `json:"artifacts_checked"`
+	OrphanedObjects  int64                   `json:"orphaned_objects"`
+	MissingObjects   int64                   `json:"missing_objects"`
+	SizeMismatches   int64                   `json:"size_mismatches"`
+	Findings         []ReconciliationFinding `json:"findings"`
+}
+
+type ReconciliationFinding struct {
+	Kind ReconciliationFindingKind `json:"kind"`
+	Key  string                    `json:"key"`
+	// ArtifactID and VideoID are nil for orphaned objects.
+	ArtifactID *int64     `json:"artifact_id,omitempty"`
+	VideoID    *uuid.UUID `json:"video_id,omitempty"`
+	// ObjectSize is nil for missing objects.
+	ObjectSize   *int64 `json:"object_size,omitempty"`
+	RecordedSize *int64 `json:"recorded_size,omitempty"`
+}
+
+const reconciliationReportColumns = `id, created_at, bucket, objects_scanned, artifacts_checked, orphaned_objects, missing_objects, size_mismatches`
+
+// ListArtifactObjects returns every artifact's ID, video, key and recorded
+// size, which is all a reconciliation needs.
+func (c Client) ListArtifactObjects() ([]Artifact, error) {
+	ctx, cancel := c.readContext()
+	defer cancel()
+
+	rows, err := c.reader.QueryContext(ctx, `SELECT id, video_id, key, size_bytes FROM artifacts ORDER BY key`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	artifacts := []Artifact{}
+	for rows.Next() {
+		var a Artifact
+		if err := rows.Scan(&a.ID, &a.VideoID, &a.Key, &a.SizeBytes); err != nil {
+			return nil, err
+		}
+		artifacts = append(artifacts, a)
+	}
+	return artifacts, rows.Err()
+}
+
+// ListUserArtifactObjects is ListArtifactObjects grouped by the user owning
+// each artifact's video, for one user or every user if userID is uuid.Nil.
+func (c Client) ListUserArtifactObjects(userID uuid.UUID) (map[uuid.UUID][]Artifact, error) {
+	ctx, cancel := c.readContext()
+	defer cancel()
+
+	query := `
+	SELECT v.user_id, a.id, a.video_id, a.key, a.size_bytes
+	FROM artifacts a
+	JOIN videos v ON v.id = a.video_id
+	`
+	args := []any{}
+	if userID != uuid.Nil {
+		query += `WHERE v.user_id = ?`
+		args = append(args, userID)
+	}
+	rows, err := c.reader.QueryContext(ctx, query+` ORDER BY a.key`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	artifacts := map[uuid.UUID][]Artifact{}
+	for rows.Next() {
+		var owner uuid.UUID
+		var a Artifact
+		if err := rows.Scan(&owner, &a.ID, &a.VideoID, &a.Key, &a.SizeBytes); err != nil {
+			return nil, err
+		}
+		artifacts[owner] = append(artifacts[owner], a)
+	}
+	return artifacts, rows.Err()
+}
+
+// CreateReconciliationReport saves report and its findings, filling in its
+// ID and creation time, and removes the oldest reports past
+// maxReconciliationReports.
+func (c Client) CreateReconciliationReport(report *ReconciliationReport) error {
+	tx, err := c.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	report.ID = uuid.New()
+	report.CreatedAt = now()
+	_, err = tx.Exec(`
+	INSERT INTO reconciliation_reports (`+reconciliationReportColumns+`)
+	VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+	`, report.ID, formatTimestamp(report.CreatedAt), report.Bucket, report.ObjectsScanned, report.ArtifactsChecked,
+		report.OrphanedObjects, report.MissingObjects, report.SizeMismatches)
+	if err != nil {
+		return err
+	}
+	for _, f := range report.Findings {
+		_, err = tx.Exec(`
+		INSERT INTO reconciliation_findings (report_id, kind, key, artifact_id, video_id, object_size, recorded_size)
+		VALUES (?, ?, ?, ?, ?, ?, ?)
+		`, report.ID, f.Kind, f.Key, f.ArtifactID, f.VideoID, f.ObjectSize, f.RecordedSize)
+		if err != nil {
+			return err
+		}
+	}
+
+	stale := `SELECT id FROM reconciliation_reports ORDER BY created_at DESC LIMIT -1 OFFSET ?`
+	if _, err := tx.Exec(`DELETE FROM reconciliation_findings WHERE report_id IN (`+stale+`)`, maxReconciliationReports); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(`DELETE FROM reconciliation_reports WHERE id IN (`+stale+`)`, maxReconciliationReports); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// GetLatestReconciliationReport returns the newest report with its
+// findings, or sql.ErrNoRows if none was made yet.
+func (c Client) GetLatestReconciliationReport() (ReconciliationReport, error) {
+	var r ReconciliationReport
+	err := c.db.QueryRow(`
+	SELECT `+reconciliationReportColumns+`
+	FROM reconciliation_reports
+	ORDER BY created_at DESC
+	LIMIT 1
+	`).Scan(&r.ID, &r.CreatedAt, &r.Bucket, &r.ObjectsScanned, &r.ArtifactsChecked,
+		&r.OrphanedObjects, &r.MissingObjects, &r.SizeMismatches)
+	if err != nil {
+		return ReconciliationReport{}, err
+	}
+
+	rows, err := c.db.Query(`
+	SELECT kind, key, artifact_id, video_id, object_size, recorded_size
+	FROM reconciliation_findings
+	WHERE report_id = ?
+	ORDER BY kind, key
+	`, r.ID)
+	if err != nil {
+		return ReconciliationReport{}, err
+	}
+	defer rows.Close()
+
+	r.Findings = []ReconciliationFinding{}
+	for rows.Next() {
+		var f ReconciliationFinding
+		if err := rows.Scan(&f.Kind, &f.Key, &f.ArtifactID, &f.VideoID, &f.ObjectSize, &f.RecordedSize); err != nil {
+			return ReconciliationReport{}, err
+		}
+		r.Findings = append(r.Findings, f)
+	}
+	return r, rows.Err()
+}
+
+// DeleteArtifactsByID removes artifact rows, e.g. ones whose objects are
+// gone, leaving their objects alone.
+func (c Client) DeleteArtifactsByID(ids []int64) error {
+	for _, args := range chunks(ids) {
+		if _, err := c.db.Exec(`DELETE FROM artifacts WHERE id IN `+inClause(len(args)), args...); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// UpdateArtifactSize corrects an artifact's recorded size.
+func (c Client) UpdateArtifactSize(id, size int64) error {
+	_, err := c.db.Exec(`UPDATE artifacts SET size_bytes = ? WHERE id = ?`, size, id)
+	return err
+}
@@ -9,28 +9,54 @@ import (
 
 type RefreshToken struct {
 	CreateRefreshTokenParams
-	CreatedAt time.Time  `json:"created_at"`
-	UpdatedAt time.Time  `json:"updated_at"`
-	RevokedAt *time.Time `json:"revoked_at"`
+	ID         string     `json:"id"`
+	CreatedAt  time.Time  `json:"created_at"`
+	UpdatedAt  time.Time  `json:"updated_at"`
+	RevokedAt  *time.Time `json:"revoked_at"`
+	LastUsedAt *time.Time `json:"last_used_at"`
 }
 
 type CreateRefreshTokenParams struct {
 	Token     string    `json:"token"`
 	UserID    uuid.UUID `json:"user_id"`
 	ExpiresAt time.Time `json:"expires_at"`
+	UserAgent string    `json:"user_agent"`
+	IPAddress string    `json:"ip_address"`
+}
+
+// Session is the user-visible view of a refresh token. It never includes the
+// token itself.
+type Session struct {
+	ID         string     `json:"id"`
+	CreatedAt  time.Time  `json:"created_at"`
+	LastUsedAt *time.Time `json:"last_used_at"`
+	ExpiresAt  time.Time  `json:"expires_at"`
+	UserAgent  string     `json:"user_agent"`
+	IPAddress  string     `json:"ip_address"`
 }
 
 func (c Client) CreateRefreshToken(params CreateRefreshTokenParams) (RefreshToken, error) {
 	query := `
 		INSERT INTO refresh_tokens (
+			id,
 			token,
 			created_at,
 			updated_at,
 			user_id,
-			expires_at
-		) VALUES (?, CURRENT_TIMESTAMP, CURRENT_TIMESTAMP, ?, ?)
+			expires_at,
+			user_agent,
+			ip_address
+		) VALUES (?, ?, CURRENT_TIMESTAMP, CURRENT_TIMESTAMP, ?, ?, ?, ?)
 	`
-	_, err := c.db.Exec(query, params.Token, params.UserID.String(), params.ExpiresAt)
+	_, err := c.db.Exec(
+		query,
+		uuid.New().String(),
+		params.Token,
+		params.UserID.String(),
+		params.ExpiresAt,
+		params.UserAgent,
+		params.IPAddress,
+	)
 	if err != nil {
 		return RefreshToken{}, err
 	}
@@ -48,16 +74,36 @@ func (c Client) RevokeRefreshToken(token string) error {
 	return err
 }
 
+func (c Client) RevokeRefreshTokensForUser(userID uuid.UUID) error {
+	query := `
+		UPDATE refresh_tokens
+		SET revoked_at = CURRENT_TIMESTAMP
+		WHERE user_id = ? AND revoked_at IS NULL
+	`
+	_, err := c.db.Exec(query, userID.String())
+	return err
+}
+
+func (c Client) TouchRefreshToken(token string) error {
+	query := `
+		UPDATE refresh_tokens
+		SET last_used_at = CURRENT_TIMESTAMP
+		WHERE token = ?
+	`
+	_, err := c.db.Exec(query, token)
+	return err
+}
+
 func (c Client) GetRefreshToken(token string) (RefreshToken, error) {
 	query := `
-		SELECT token, created_at, updated_at, user_id, expires_at, revoked_at
+		SELECT id, token, created_at, updated_at, user_id, expires_at, revoked_at, last_used_at, user_agent, ip_address
 		FROM refresh_tokens
 		WHERE token = ?
 	`
 	var rt RefreshToken
 	var userID string
 	err := c.db.QueryRow(query, token).
-		Scan(&rt.Token, &rt.CreatedAt, &rt.UpdatedAt, &userID, &rt.ExpiresAt, &rt.RevokedAt)
+		Scan(&rt.ID, &rt.Token, &rt.CreatedAt, &rt.UpdatedAt, &userID, &rt.ExpiresAt, &rt.RevokedAt, &rt.LastUsedAt, &rt.UserAgent, &rt.IPAddress)
 	if err != nil {
 		if err == sql.ErrNoRows {
 			return RefreshToken{}, nil
@@ -73,6 +119,69 @@ func (c Client) GetRefreshToken(token string) (RefreshToken, error) {
 	return rt, nil
 }
 
+// GetSessions returns the user's refresh tokens that are neither revoked nor
+// expired, most recently created first.
+func (c Client) GetSessions(userID uuid.UUID) ([]Session, error) {
+	query := `
+		SELECT id, created_at, last_used_at, expires_at, user_agent, ip_address
+		FROM refresh_tokens
+		WHERE user_id = ?
+			AND revoked_at IS NULL
+			AND expires_at > ?
+		ORDER BY created_at DESC
+	`
+	rows, err := c.db.Query(query, userID.String(), time.Now().UTC())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	sessions := []Session{}
+	for rows.Next() {
+		var s Session
+		if err := rows.Scan(&s.ID, &s.CreatedAt, &s.LastUsedAt, &s.ExpiresAt, &s.UserAgent, &s.IPAddress); err != nil {
+			return nil, err
+		}
+		sessions = append(sessions, s)
+	}
+
+	return sessions, rows.Err()
+}
+
+// RevokeSession revokes a single session belonging to the user. It reports
+// false if no active session with that ID exists for the user.
+func (c Client) RevokeSession(userID uuid.UUID, sessionID string) (bool, error) {
+	query := `
+		UPDATE refresh_tokens
+		SET revoked_at = CURRENT_TIMESTAMP
+		WHERE id = ? AND user_id = ? AND revoked_at IS NULL
+	`
+	result, err := c.db.Exec(query, sessionID, userID.String())
+	if err != nil {
+		return false, err
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return n > 0, nil
+}
+
+// SessionActive reports whether the user's session exists and is neither
+// revoked nor expired.
+func (c Client) SessionActive(userID uuid.UUID, sessionID string) (bool, error) {
+	query := `
+		SELECT EXISTS (
+			SELECT 1
+			FROM refresh_tokens
+			WHERE id = ? AND user_id = ? AND revoked_at IS NULL AND expires_at > ?
+		)
+	`
+	var active bool
+	err := c.db.QueryRow(query, sessionID, userID.String(), time.Now().UTC()).Scan(&active)
+	return active, err
+}
+
 func (c Client) DeleteRefreshToken(token string) error {
 	query := `
 		DELETE FROM refresh_tokens
@@ -0,0 +1,45 @@
+package database
+
+// SitemapVideo is a video listed in the sitemap, under the share page of
+// its oldest short link.
+type SitemapVideo struct {
+	Video
+	Slug       string
+	DurationMS int64
+}
+
+// GetSitemapVideos returns uploaded videos with a short link that anyone
+// can watch without a password, newest first. Expiry, takedowns and claims
+// are left to the caller.
+func (c Client) GetSitemapVideos(limit int) ([]SitemapVideo, error) {
+	rows, err := c.reader.Query(`
+	SELECT `+videoColumns+`,
+		(SELECT slug FROM slugs WHERE target_type = ? AND target_id = videos.id ORDER BY created_at, slug LIMIT 1),
+		COALESCE((SELECT MAX(duration_ms) FROM artifacts WHERE artifacts.video_id = videos.id), 0)
+	FROM videos
+	WHERE video_url IS NOT NULL
+		AND password_hash = ''
+		AND unpublished_at IS NULL
+		AND EXISTS (SELECT 1 FROM slugs WHERE target_type = ? AND target_id = videos.id)
+	ORDER BY created_at DESC
+	LIMIT ?
+	`, SlugTargetVideo, SlugTargetVideo, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	videos := []SitemapVideo{}
+	for rows.Next() {
+		var video SitemapVideo
+		video.Video, err = scanVideo(extraScanner{
+			row:   rows,
+			extra: []any{&video.Slug, &video.DurationMS},
+		})
+		if err != nil {
+			return nil, err
+		}
+		videos = append(videos, video)
+	}
+	return videos, rows.Err()
+}
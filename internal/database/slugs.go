@@ -0,0 +1,115 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// ErrSlugTaken is returned by CreateSlug when the slug is already in use.
+var ErrSlugTaken = errors.New("slug is taken")
+
+// SlugTargetType is what kind of thing a slug points at.
+type SlugTargetType string
+
+const SlugTargetVideo SlugTargetType = "video"
+
+// Slug is a short, human-friendly name for a share link.
+type Slug struct {
+	Slug      string    `json:"slug"`
+	CreatedAt time.Time `json:"created_at"`
+	CreateSlugParams
+	Hits int64 `json:"hits"`
+}
+
+type CreateSlugParams struct {
+	UserID     uuid.UUID      `json:"user_id"`
+	TargetType SlugTargetType `json:"target_type"`
+	TargetID   uuid.UUID      `json:"target_id"`
+}
+
+const slugColumns = `slug, created_at, user_id, target_type, target_id, hits`
+
+func scanSlug(row rowScanner) (Slug, error) {
+	var s Slug
+	err := row.Scan(&s.Slug, &s.CreatedAt, &s.UserID, &s.TargetType, &s.TargetID, &s.Hits)
+	return s, err
+}
+
+// CreateSlug returns ErrSlugTaken if slug is in use, by anyone.
+func (c Client) CreateSlug(slug string, params CreateSlugParams) (Slug, error) {
+	result, err := c.db.Exec(`
+	INSERT OR IGNORE INTO slugs (slug, created_at, user_id, target_type, target_id)
+	VALUES (?, ?, ?, ?, ?)
+	`, slug, formatTimestamp(now()), params.UserID, params.TargetType, params.TargetID)
+	if err != nil {
+		return Slug{}, err
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return Slug{}, err
+	}
+	if n == 0 {
+		return Slug{}, ErrSlugTaken
+	}
+	return scanSlug(c.db.QueryRow(`SELECT `+slugColumns+` FROM slugs WHERE slug = ?`, slug))
+}
+
+// GetSlug returns nil if the slug doesn't exist.
+func (c Client) GetSlug(slug string) (*Slug, error) {
+	s, err := scanSlug(c.db.QueryRow(`SELECT `+slugColumns+` FROM slugs WHERE slug = ?`, slug))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &s, nil
+}
+
+func (c Client) GetSlugsForTarget(targetType SlugTargetType, targetID uuid.UUID) ([]Slug, error) {
+	rows, err := c.db.Query(`
+	SELECT `+slugColumns+`
+	FROM slugs
+	WHERE target_type = ? AND target_id = ?
+	ORDER BY created_at
+	`, targetType, targetID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	slugs := []Slug{}
+	for rows.Next() {
+		s, err := scanSlug(rows)
+		if err != nil {
+			return nil, err
+		}
+		slugs = append(slugs, s)
+	}
+	return slugs, rows.Err()
+}
+
+// DeleteSlug removes a slug of the target, returning sql.ErrNoRows if it
+// has no such slug.
+func (c Client) DeleteSlug(targetType SlugTargetType, targetID uuid.UUID, slug string) error {
+	result, err := c.db.Exec(`DELETE FROM slugs WHERE slug = ? AND target_type = ? AND target_id = ?`, slug, targetType, targetID)
+	if err != nil {
+		return err
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+func (c Client) RecordSlugHit(slug string) error {
+	_, err := c.db.Exec(`UPDATE slugs SET hits = hits + 1 WHERE slug = ?`, slug)
+	return err
+}
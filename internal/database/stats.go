@@ -0,0 +1,27 @@
+package database
+
+type AdminStats struct {
+	Users      int              `json:"users"`
+	Videos     int              `json:"videos"`
+	Transcodes []TranscodeStats `json:"transcodes"`
+}
+
+func (c Client) GetAdminStats() (AdminStats, error) {
+	ctx, cancel := c.readContext()
+	defer cancel()
+
+	var stats AdminStats
+	err := c.reader.QueryRowContext(ctx, "SELECT COUNT(*) FROM users").Scan(&stats.Users)
+	if err != nil {
+		return AdminStats{}, err
+	}
+	err = c.reader.QueryRowContext(ctx, "SELECT COUNT(*) FROM videos").Scan(&stats.Videos)
+	if err != nil {
+		return AdminStats{}, err
+	}
+	stats.Transcodes, err = c.GetTranscodeStats()
+	if err != nil {
+		return AdminStats{}, err
+	}
+	return stats, nil
+}
@@ -0,0 +1,181 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type TakedownKind string
+
+const (
+	// TakedownBlocked withholds a video for legal reasons, e.g. in response
+	// to a court order, and is served as 451.
+	TakedownBlocked TakedownKind = "blocked"
+	// TakedownRemoved is for videos that broke the rules, served as 410.
+	TakedownRemoved TakedownKind = "removed"
+)
+
+type AppealStatus string
+
+const (
+	AppealPending AppealStatus = "pending"
+	AppealUpheld  AppealStatus = "upheld"
+)
+
+type Takedown struct {
+	VideoID   uuid.UUID    `json:"video_id"`
+	CreatedAt time.Time    `json:"created_at"`
+	Kind      TakedownKind `json:"kind"`
+	Reason    string       `json:"reason"`
+	CreatedBy uuid.UUID    `json:"created_by"`
+	// The appeal fields are empty until the owner appeals. Appeals that are
+	// granted lift the takedown, so only pending and upheld ones are stored.
+	AppealMessage string       `json:"appeal_message,omitempty"`
+	AppealedAt    *time.Time   `json:"appealed_at,omitempty"`
+	AppealStatus  AppealStatus `json:"appeal_status,omitempty"`
+}
+
+type CreateTakedownParams struct {
+	VideoID   uuid.UUID
+	Kind      TakedownKind
+	Reason    string
+	CreatedBy uuid.UUID
+}
+
+// ErrAlreadyAppealed is returned when the owner appeals a takedown twice.
+var ErrAlreadyAppealed = errors.New("takedown was already appealed")
+
+const takedownColumns = `video_id, created_at, kind, reason, created_by, appeal_message, appealed_at, appeal_status`
+
+func scanTakedown(row rowScanner) (Takedown, error) {
+	var t Takedown
+	err := row.Scan(&t.VideoID, &t.CreatedAt, &t.Kind, &t.Reason, &t.CreatedBy, &t.AppealMessage, &t.AppealedAt, &t.AppealStatus)
+	return t, err
+}
+
+// CreateTakedown takes a video down, replacing any earlier takedown along
+// with its appeal.
+func (c Client) CreateTakedown(params CreateTakedownParams) (Takedown, error) {
+	query := `
+	INSERT OR REPLACE INTO video_takedowns (video_id, created_at, kind, reason, created_by)
+	VALUES (?, ?, ?, ?, ?)
+	`
+	_, err := c.db.Exec(query, params.VideoID, formatTimestamp(now()), params.Kind, params.Reason, params.CreatedBy)
+	if err != nil {
+		return Takedown{}, err
+	}
+	takedown, err := c.GetTakedown(params.VideoID)
+	if err != nil {
+		return Takedown{}, err
+	}
+	return *takedown, nil
+}
+
+// GetTakedown returns nil if the video isn't taken down.
+func (c Client) GetTakedown(videoID uuid.UUID) (*Takedown, error) {
+	takedown, err := scanTakedown(c.db.QueryRow(`SELECT `+takedownColumns+` FROM video_takedowns WHERE video_id = ?`, videoID))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &takedown, nil
+}
+
+// GetTakedowns lists takedowns, newest first, optionally only those with an
+// appeal in the given status.
+func (c Client) GetTakedowns(appealStatus AppealStatus) ([]Takedown, error) {
+	query := `SELECT ` + takedownColumns + ` FROM video_takedowns`
+	args := []any{}
+	if appealStatus != "" {
+		query += ` WHERE appeal_status = ?`
+		args = append(args, appealStatus)
+	}
+	query += ` ORDER BY created_at DESC`
+
+	rows, err := c.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	takedowns := []Takedown{}
+	for rows.Next() {
+		takedown, err := scanTakedown(rows)
+		if err != nil {
+			return nil, err
+		}
+		takedowns = append(takedowns, takedown)
+	}
+	return takedowns, rows.Err()
+}
+
+// GetTakedownsForVideos returns the takedowns among videoIDs, keyed by video.
+func (c Client) GetTakedownsForVideos(videoIDs []uuid.UUID) (map[uuid.UUID]Takedown, error) {
+	takedowns := map[uuid.UUID]Takedown{}
+	for _, args := range chunks(videoIDs) {
+		rows, err := c.db.Query(`SELECT `+takedownColumns+` FROM video_takedowns WHERE video_id IN `+inClause(len(args)), args...)
+		if err != nil {
+			return nil, err
+		}
+		for rows.Next() {
+			takedown, err := scanTakedown(rows)
+			if err != nil {
+				rows.Close()
+				return nil, err
+			}
+			takedowns[takedown.VideoID] = takedown
+		}
+		err = rows.Err()
+		rows.Close()
+		if err != nil {
+			return nil, err
+		}
+	}
+	return takedowns, nil
+}
+
+// AppealTakedown records the owner's appeal. It returns ErrAlreadyAppealed
+// if there already is one, and sql.ErrNoRows if the video isn't taken down.
+func (c Client) AppealTakedown(videoID uuid.UUID, message string) (Takedown, error) {
+	query := `
+	UPDATE video_takedowns
+	SET appeal_message = ?, appealed_at = ?, appeal_status = ?
+	WHERE video_id = ? AND appeal_status = ''
+	`
+	result, err := c.db.Exec(query, message, formatTimestamp(now()), AppealPending, videoID)
+	if err != nil {
+		return Takedown{}, err
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return Takedown{}, err
+	}
+	takedown, err := c.GetTakedown(videoID)
+	if err != nil {
+		return Takedown{}, err
+	}
+	if takedown == nil {
+		return Takedown{}, sql.ErrNoRows
+	}
+	if n == 0 {
+		return Takedown{}, ErrAlreadyAppealed
+	}
+	return *takedown, nil
+}
+
+// UpholdTakedown rejects a pending appeal.
+func (c Client) UpholdTakedown(videoID uuid.UUID) error {
+	_, err := c.db.Exec(`UPDATE video_takedowns SET appeal_status = ? WHERE video_id = ? AND appeal_status = ?`, AppealUpheld, videoID, AppealPending)
+	return err
+}
+
+// DeleteTakedown reinstates a video.
+func (c Client) DeleteTakedown(videoID uuid.UUID) error {
+	_, err := c.db.Exec(`DELETE FROM video_takedowns WHERE video_id = ?`, videoID)
+	return err
+}
@@ -0,0 +1,88 @@
+package database
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// ThumbnailJob is a thumbnail waiting to be generated for a video. A video
+// has at most one; queueing another replaces it.
+type ThumbnailJob struct {
+	ID       uuid.UUID `json:"id"`
+	VideoID  uuid.UUID `json:"video_id"`
+	QueuedAt time.Time `json:"queued_at"`
+	// Attempts counts the times the job was picked up again after its
+	// worker never finished it.
+	Attempts int `json:"attempts"`
+}
+
+// QueueThumbnailJob queues a thumbnail for the video, replacing any job it
+// already had.
+func (c Client) QueueThumbnailJob(videoID uuid.UUID) (ThumbnailJob, error) {
+	job := ThumbnailJob{ID: uuid.New(), VideoID: videoID, QueuedAt: now()}
+	_, err := c.db.Exec(`
+	INSERT OR REPLACE INTO thumbnail_jobs (video_id, id, queued_at, attempts)
+	VALUES (?, ?, ?, 0)
+	`, job.VideoID, job.ID, formatTimestamp(job.QueuedAt))
+	if err != nil {
+		return ThumbnailJob{}, err
+	}
+	return job, nil
+}
+
+// GetThumbnailJobs returns every queued thumbnail job, oldest first.
+func (c Client) GetThumbnailJobs() ([]ThumbnailJob, error) {
+	return c.getThumbnailJobs("")
+}
+
+// GetThumbnailJob returns the video's thumbnail job, or nil if it has none.
+func (c Client) GetThumbnailJob(videoID uuid.UUID) (*ThumbnailJob, error) {
+	jobs, err := c.getThumbnailJobs("WHERE video_id = ?", videoID)
+	if err != nil || len(jobs) == 0 {
+		return nil, err
+	}
+	return &jobs[0], nil
+}
+
+// RetryThumbnailJob counts another attempt at the job.
+func (c Client) RetryThumbnailJob(id uuid.UUID) error {
+	_, err := c.db.Exec(`UPDATE thumbnail_jobs SET attempts = attempts + 1 WHERE id = ?`, id)
+	return err
+}
+
+// DeleteThumbnailJob removes the job if it's still queued, so a job
+// queued for the same video meanwhile is kept.
+func (c Client) DeleteThumbnailJob(id uuid.UUID) error {
+	_, err := c.db.Exec(`DELETE FROM thumbnail_jobs WHERE id = ?`, id)
+	return err
+}
+
+// CancelThumbnailJob removes the video's job, whichever it is.
+func (c Client) CancelThumbnailJob(videoID uuid.UUID) error {
+	_, err := c.db.Exec(`DELETE FROM thumbnail_jobs WHERE video_id = ?`, videoID)
+	return err
+}
+
+func (c Client) getThumbnailJobs(where string, args ...any) ([]ThumbnailJob, error) {
+	rows, err := c.db.Query(`
+	SELECT id, video_id, queued_at, attempts
+	FROM thumbnail_jobs
+	`+where+`
+	ORDER BY queued_at
+	`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	jobs := []ThumbnailJob{}
+	for rows.Next() {
+		var j ThumbnailJob
+		if err := rows.Scan(&j.ID, &j.VideoID, &j.QueuedAt, &j.Attempts); err != nil {
+			return nil, err
+		}
+		jobs = append(jobs, j)
+	}
+	return jobs, rows.Err()
+}
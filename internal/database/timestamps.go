@@ -0,0 +1,30 @@
+package database
+
+import "time"
+
+// timestampFormat is how the timestamps this package manages are stored: UTC
+// with fixed millisecond precision, so they sort correctly as strings and
+// updated_at is precise enough to detect concurrent updates.
+const timestampFormat = "2006-01-02 15:04:05.000"
+
+// now returns the current time as it will be stored and read back.
+func now() time.Time {
+	return time.Now().UTC().Truncate(time.Millisecond)
+}
+
+func formatTimestamp(t time.Time) string {
+	return t.UTC().Format(timestampFormat)
+}
+
+// normalizeTimestamps rewrites timestamp columns written before
+// timestampFormat, e.g. by CURRENT_TIMESTAMP, into it.
+func (c *Client) normalizeTimestamps(table string, columns ...string) error {
+	for _, column := range columns {
+		_, err := c.db.Exec(`UPDATE ` + table + ` SET ` + column + ` = strftime('%Y-%m-%d %H:%M:%f', ` + column + `)
+		WHERE ` + column + ` IS NOT NULL AND length(` + column + `) != 23`)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,233 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type TranscodeJob struct {
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+	CreateTranscodeJobParams
+	UpdateTranscodeJobParams
+}
+
+type CreateTranscodeJobParams struct {
+	ID       string    `json:"id"`
+	VideoID  uuid.UUID `json:"video_id"`
+	Provider string    `json:"provider"`
+	Preset   string    `json:"preset"`
+	Status   string    `json:"status"`
+}
+
+type UpdateTranscodeJobParams struct {
+	Error            string  `json:"error"`
+	DurationMS       int64   `json:"duration_ms"`
+	ProcessingMS     int64   `json:"processing_ms"`
+	EstimatedCostUSD float64 `json:"estimated_cost_usd"`
+}
+
+// TranscodeStats aggregates jobs sharing a provider, preset and status.
+type TranscodeStats struct {
+	Provider         string  `json:"provider"`
+	Preset           string  `json:"preset"`
+	Status           string  `json:"status"`
+	Jobs             int     `json:"jobs"`
+	DurationMS       int64   `json:"duration_ms"`
+	ProcessingMS     int64   `json:"processing_ms"`
+	EstimatedCostUSD float64 `json:"estimated_cost_usd"`
+}
+
+func (c Client) CreateTranscodeJob(params CreateTranscodeJobParams) error {
+	query := `
+	INSERT INTO transcode_jobs (
+		id,
+		created_at,
+		updated_at,
+		video_id,
+		provider,
+		preset,
+		status
+	) VALUES (?, CURRENT_TIMESTAMP, CURRENT_TIMESTAMP, ?, ?, ?, ?)
+	`
+	_, err := c.db.Exec(query, params.ID, params.VideoID, params.Provider, params.Preset, params.Status)
+	return err
+}
+
+func (c Client) GetTranscodeJob(id string) (TranscodeJob, error) {
+	query := `
+	SELECT
+		id,
+		created_at,
+		updated_at,
+		video_id,
+		provider,
+		preset,
+		status,
+		error,
+		duration_ms,
+		processing_ms,
+		estimated_cost_usd
+	FROM transcode_jobs
+	WHERE id = ?
+	`
+	var job TranscodeJob
+	err := c.db.QueryRow(query, id).Scan(
+		&job.ID,
+		&job.CreatedAt,
+		&job.UpdatedAt,
+		&job.VideoID,
+		&job.Provider,
+		&job.Preset,
+		&job.Status,
+		&job.Error,
+		&job.DurationMS,
+		&job.ProcessingMS,
+		&job.EstimatedCostUSD,
+	)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return TranscodeJob{}, nil
+		}
+		return TranscodeJob{}, err
+	}
+	return job, nil
+}
+
+// GetLatestTranscodeJob returns the last job submitted for a video, or nil
+// if it was never sent to a transcoder.
+func (c Client) GetLatestTranscodeJob(videoID uuid.UUID) (*TranscodeJob, error) {
+	jobs, err := c.GetLatestTranscodeJobs([]uuid.UUID{videoID})
+	if err != nil {
+		return nil, err
+	}
+	job, ok := jobs[videoID]
+	if !ok {
+		return nil, nil
+	}
+	return &job, nil
+}
+
+// GetLatestTranscodeJobs is GetLatestTranscodeJob for many videos, keyed by
+// video ID. Videos that were never transcoded are left out.
+func (c Client) GetLatestTranscodeJobs(videoIDs []uuid.UUID) (map[uuid.UUID]TranscodeJob, error) {
+	jobs := make(map[uuid.UUID]TranscodeJob, len(videoIDs))
+	for _, args := range chunks(videoIDs) {
+		query := `
+		SELECT
+			id,
+			created_at,
+			updated_at,
+			video_id,
+			provider,
+			preset,
+			status,
+			error,
+			duration_ms,
+			processing_ms,
+			estimated_cost_usd
+		FROM transcode_jobs
+		WHERE video_id IN ` + inClause(len(args)) + `
+		ORDER BY created_at, rowid
+		`
+		rows, err := c.db.Query(query, args...)
+		if err != nil {
+			return nil, err
+		}
+		for rows.Next() {
+			var job TranscodeJob
+			if err := rows.Scan(
+				&job.ID,
+				&job.CreatedAt,
+				&job.UpdatedAt,
+				&job.VideoID,
+				&job.Provider,
+				&job.Preset,
+				&job.Status,
+				&job.Error,
+				&job.DurationMS,
+				&job.ProcessingMS,
+				&job.EstimatedCostUSD,
+			); err != nil {
+				rows.Close()
+				return nil, err
+			}
+			// Later jobs overwrite earlier ones.
+			jobs[job.VideoID] = job
+		}
+		err = rows.Err()
+		rows.Close()
+		if err != nil {
+			return nil, err
+		}
+	}
+	return jobs, nil
+}
+
+func (c Client) UpdateTranscodeJob(id, status string, params UpdateTranscodeJobParams) error {
+	query := `
+	UPDATE transcode_jobs
+	SET
+		status = ?,
+		error = ?,
+		duration_ms = ?,
+		processing_ms = ?,
+		estimated_cost_usd = ?,
+		updated_at = CURRENT_TIMESTAMP
+	WHERE id = ?
+	`
+	_, err := c.db.Exec(
+		query,
+		status,
+		params.Error,
+		params.DurationMS,
+		params.ProcessingMS,
+		params.EstimatedCostUSD,
+		id,
+	)
+	return err
+}
+
+func (c Client) GetTranscodeStats() ([]TranscodeStats, error) {
+	query := `
+	SELECT
+		provider,
+		preset,
+		status,
+		COUNT(*),
+		COALESCE(SUM(duration_ms), 0),
+		COALESCE(SUM(processing_ms), 0),
+		COALESCE(SUM(estimated_cost_usd), 0)
+	FROM transcode_jobs
+	GROUP BY provider, preset, status
+	ORDER BY provider, preset, status
+	`
+	ctx, cancel := c.readContext()
+	defer cancel()
+	rows, err := c.reader.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	stats := []TranscodeStats{}
+	for rows.Next() {
+		var s TranscodeStats
+		if err := rows.Scan(
+			&s.Provider,
+			&s.Preset,
+			&s.Status,
+			&s.Jobs,
+			&s.DurationMS,
+			&s.ProcessingMS,
+			&s.EstimatedCostUSD,
+		); err != nil {
+			return nil, err
+		}
+		stats = append(stats, s)
+	}
+	return stats, rows.Err()
+}
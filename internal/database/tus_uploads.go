@@ -0,0 +1,82 @@
+package database
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// TusUpload is a video upload sent with the tus resumable upload protocol.
+// Its bytes are appended to a file on the server's disk as they arrive, so
+// how far it got is the size of that file rather than a column here.
+type TusUpload struct {
+	ID        uuid.UUID `json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+	ExpiresAt time.Time `json:"expires_at"`
+	CreateTusUploadParams
+}
+
+type CreateTusUploadParams struct {
+	UserID      uuid.UUID `json:"user_id"`
+	VideoID     uuid.UUID `json:"video_id"`
+	SizeBytes   int64     `json:"size_bytes"`
+	ContentType string    `json:"content_type"`
+	Quality     string    `json:"quality"`
+}
+
+func (c Client) CreateTusUpload(expiresAt time.Time, params CreateTusUploadParams) (TusUpload, error) {
+	upload := TusUpload{ID: uuid.New(), CreatedAt: now(), ExpiresAt: expiresAt, CreateTusUploadParams: params}
+	_, err := c.db.Exec(`
+	INSERT INTO tus_uploads (id, created_at, expires_at, user_id, video_id, size_bytes, content_type, quality)
+	VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+	`, upload.ID, formatTimestamp(upload.CreatedAt), formatTimestamp(expiresAt), params.UserID, params.VideoID,
+		params.SizeBytes, params.ContentType, params.Quality)
+	if err != nil {
+		return TusUpload{}, err
+	}
+	return upload, nil
+}
+
+// GetTusUpload returns the upload, or nil if it doesn't exist.
+func (c Client) GetTusUpload(id uuid.UUID) (*TusUpload, error) {
+	uploads, err := c.getTusUploads("WHERE id = ?", id)
+	if err != nil || len(uploads) == 0 {
+		return nil, err
+	}
+	return &uploads[0], nil
+}
+
+// GetExpiredTusUploads returns the uploads that expired before now.
+func (c Client) GetExpiredTusUploads() ([]TusUpload, error) {
+	return c.getTusUploads("WHERE expires_at <= ?", formatTimestamp(now()))
+}
+
+func (c Client) DeleteTusUpload(id uuid.UUID) error {
+	_, err := c.db.Exec(`DELETE FROM tus_uploads WHERE id = ?`, id)
+	return err
+}
+
+func (c Client) getTusUploads(where string, args ...any) ([]TusUpload, error) {
+	query := `
+	SELECT id, created_at, expires_at, user_id, video_id, size_bytes, content_type, quality
+	FROM tus_uploads
+	` + where + `
+	ORDER BY created_at
+	`
+	rows, err := c.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	uploads := []TusUpload{}
+	for rows.Next() {
+		var u TusUpload
+		err := rows.Scan(&u.ID, &u.CreatedAt, &u.ExpiresAt, &u.UserID, &u.VideoID, &u.SizeBytes, &u.ContentType, &u.Quality)
+		if err != nil {
+			return nil, err
+		}
+		uploads = append(uploads, u)
+	}
+	return uploads, rows.Err()
+}
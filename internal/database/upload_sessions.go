@@ -0,0 +1,141 @@
+package database
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// UploadSession is a video upload sent in parts, which the client can
+// resume with its token after losing its connection or being restarted.
+// The parts go into an S3 multipart upload as they arrive.
+type UploadSession struct {
+	Token     string    `json:"token"`
+	CreatedAt time.Time `json:"created_at"`
+	ExpiresAt time.Time `json:"expires_at"`
+	CreateUploadSessionParams
+	// Parts are the parts received so far, by number.
+	Parts []UploadSessionPart `json:"parts"`
+}
+
+type CreateUploadSessionParams struct {
+	UserID      uuid.UUID `json:"user_id"`
+	VideoID     uuid.UUID `json:"video_id"`
+	SizeBytes   int64     `json:"size_bytes"`
+	PartSize    int64     `json:"part_size"`
+	ContentType string    `json:"content_type"`
+	Quality     string    `json:"quality"`
+	S3Key       string    `json:"-"`
+	S3UploadID  string    `json:"-"`
+}
+
+type UploadSessionPart struct {
+	Number     int32     `json:"number"`
+	SizeBytes  int64     `json:"size_bytes"`
+	ETag       string    `json:"etag"`
+	UploadedAt time.Time `json:"uploaded_at"`
+}
+
+func (c Client) CreateUploadSession(token string, expiresAt time.Time, params CreateUploadSessionParams) (UploadSession, error) {
+	_, err := c.db.Exec(`
+	INSERT INTO upload_sessions (token, created_at, expires_at, user_id, video_id, size_bytes, part_size, content_type, quality, s3_key, s3_upload_id)
+	VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`, token, formatTimestamp(now()), formatTimestamp(expiresAt), params.UserID, params.VideoID, params.SizeBytes, params.PartSize,
+		params.ContentType, params.Quality, params.S3Key, params.S3UploadID)
+	if err != nil {
+		return UploadSession{}, err
+	}
+	session, err := c.GetUploadSession(token)
+	if err != nil {
+		return UploadSession{}, err
+	}
+	return *session, nil
+}
+
+// GetUploadSession returns the session with its parts, or nil if it doesn't
+// exist.
+func (c Client) GetUploadSession(token string) (*UploadSession, error) {
+	sessions, err := c.getUploadSessions("WHERE token = ?", token)
+	if err != nil || len(sessions) == 0 {
+		return nil, err
+	}
+	session := sessions[0]
+
+	rows, err := c.db.Query(`
+	SELECT number, size_bytes, etag, uploaded_at
+	FROM upload_session_parts
+	WHERE token = ?
+	ORDER BY number
+	`, token)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	session.Parts = []UploadSessionPart{}
+	for rows.Next() {
+		var part UploadSessionPart
+		if err := rows.Scan(&part.Number, &part.SizeBytes, &part.ETag, &part.UploadedAt); err != nil {
+			return nil, err
+		}
+		session.Parts = append(session.Parts, part)
+	}
+	return &session, rows.Err()
+}
+
+// GetExpiredUploadSessions returns the sessions that expired before now,
+// without their parts.
+func (c Client) GetExpiredUploadSessions() ([]UploadSession, error) {
+	return c.getUploadSessions("WHERE expires_at <= ?", formatTimestamp(now()))
+}
+
+// SetUploadSessionPart records a received part, replacing the part with the
+// same number if it was sent before.
+func (c Client) SetUploadSessionPart(token string, part UploadSessionPart) error {
+	_, err := c.db.Exec(`
+	INSERT OR REPLACE INTO upload_session_parts (token, number, size_bytes, etag, uploaded_at)
+	VALUES (?, ?, ?, ?, ?)
+	`, token, part.Number, part.SizeBytes, part.ETag, formatTimestamp(now()))
+	return err
+}
+
+func (c Client) DeleteUploadSession(token string) error {
+	tx, err := c.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(`DELETE FROM upload_session_parts WHERE token = ?`, token); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(`DELETE FROM upload_sessions WHERE token = ?`, token); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (c Client) getUploadSessions(where string, args ...any) ([]UploadSession, error) {
+	query := `
+	SELECT token, created_at, expires_at, user_id, video_id, size_bytes, part_size, content_type, quality, s3_key, s3_upload_id
+	FROM upload_sessions
+	` + where + `
+	ORDER BY created_at
+	`
+	rows, err := c.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	sessions := []UploadSession{}
+	for rows.Next() {
+		var s UploadSession
+		err := rows.Scan(&s.Token, &s.CreatedAt, &s.ExpiresAt, &s.UserID, &s.VideoID, &s.SizeBytes, &s.PartSize,
+			&s.ContentType, &s.Quality, &s.S3Key, &s.S3UploadID)
+		if err != nil {
+			return nil, err
+		}
+		sessions = append(sessions, s)
+	}
+	return sessions, rows.Err()
+}
@@ -0,0 +1,129 @@
+package database
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Usage is one user's accounting for one calendar month (UTC).
+type Usage struct {
+	UserID    uuid.UUID  `json:"user_id"`
+	Month     string     `json:"month"`
+	UpdatedAt *time.Time `json:"updated_at"`
+	// StorageBytesCurrent isn't stored per month, it's filled in from the
+	// videos table when usage is read.
+	StorageBytesCurrent int64 `json:"storage_bytes_current"`
+	StorageBytesPeak    int64 `json:"storage_bytes_peak"`
+	// EgressBytesEstimated assumes every issued video URL is downloaded once
+	// in full. EgressBytesMeasured comes from delivery logs.
+	EgressBytesEstimated int64 `json:"egress_bytes_estimated"`
+	EgressBytesMeasured  int64 `json:"egress_bytes_measured"`
+	URLIssuances         int64 `json:"url_issuances"`
+	DeliveryRequests     int64 `json:"delivery_requests"`
+}
+
+func UsageMonth(t time.Time) string {
+	return t.UTC().Format("2006-01")
+}
+
+// RecordStorageUsage raises the user's peak storage for the current month if
+// their current storage is above it.
+func (c Client) RecordStorageUsage(userID uuid.UUID) error {
+	used, err := c.GetStorageUsed(userID)
+	if err != nil {
+		return err
+	}
+	query := `
+	INSERT INTO monthly_usage (user_id, month, updated_at, storage_bytes_peak)
+	VALUES (?, ?, CURRENT_TIMESTAMP, ?)
+	ON CONFLICT (user_id, month) DO UPDATE SET
+		storage_bytes_peak = MAX(storage_bytes_peak, excluded.storage_bytes_peak),
+		updated_at = CURRENT_TIMESTAMP
+	`
+	_, err = c.db.Exec(query, userID.String(), UsageMonth(time.Now()), used)
+	return err
+}
+
+// RecordURLIssuance counts a delivery URL handed out for one of the user's
+// objects, with its size as the estimated egress.
+func (c Client) RecordURLIssuance(userID uuid.UUID, sizeBytes int64) error {
+	query := `
+	INSERT INTO monthly_usage (user_id, month, updated_at, egress_bytes_estimated, url_issuances)
+	VALUES (?, ?, CURRENT_TIMESTAMP, ?, 1)
+	ON CONFLICT (user_id, month) DO UPDATE SET
+		egress_bytes_estimated = egress_bytes_estimated + excluded.egress_bytes_estimated,
+		url_issuances = url_issuances + 1,
+		updated_at = CURRENT_TIMESTAMP
+	`
+	_, err := c.db.Exec(query, userID.String(), UsageMonth(time.Now()), sizeBytes)
+	return err
+}
+
+func (c Client) GetUsage(userID uuid.UUID, month string) (Usage, error) {
+	usages, err := c.getUsage("WHERE u.id = ?", month, userID.String())
+	if err != nil {
+		return Usage{}, err
+	}
+	if len(usages) == 0 {
+		return Usage{UserID: userID, Month: month}, nil
+	}
+	return usages[0], nil
+}
+
+// GetAllUsage returns the month's usage of every user, heaviest egress first.
+func (c Client) GetAllUsage(month string) ([]Usage, error) {
+	return c.getUsage("", month)
+}
+
+func (c Client) getUsage(where, month string, args ...any) ([]Usage, error) {
+	query := `
+	SELECT
+		u.id,
+		m.updated_at,
+		(SELECT COALESCE(SUM(a.size_bytes), 0) FROM artifacts a JOIN videos v ON v.id = a.video_id WHERE v.user_id = u.id),
+		COALESCE(m.storage_bytes_peak, 0),
+		COALESCE(m.egress_bytes_estimated, 0),
+		COALESCE(m.egress_bytes_measured, 0),
+		COALESCE(m.url_issuances, 0),
+		COALESCE(m.delivery_requests, 0)
+	FROM users u
+	LEFT JOIN monthly_usage m ON m.user_id = u.id AND m.month = ?
+	` + where + `
+	ORDER BY COALESCE(m.egress_bytes_measured, 0) + COALESCE(m.egress_bytes_estimated, 0) DESC
+	`
+	ctx, cancel := c.readContext()
+	defer cancel()
+	rows, err := c.reader.QueryContext(ctx, query, append([]any{month}, args...)...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	usages := []Usage{}
+	for rows.Next() {
+		usage := Usage{Month: month}
+		var id string
+		if err := rows.Scan(
+			&id,
+			&usage.UpdatedAt,
+			&usage.StorageBytesCurrent,
+			&usage.StorageBytesPeak,
+			&usage.EgressBytesEstimated,
+			&usage.EgressBytesMeasured,
+			&usage.URLIssuances,
+			&usage.DeliveryRequests,
+		); err != nil {
+			return nil, err
+		}
+		usage.UserID, err = uuid.Parse(id)
+		if err != nil {
+			return nil, err
+		}
+		if month == UsageMonth(time.Now()) && usage.StorageBytesPeak < usage.StorageBytesCurrent {
+			usage.StorageBytesPeak = usage.StorageBytesCurrent
+		}
+		usages = append(usages, usage)
+	}
+	return usages, rows.Err()
+}
@@ -0,0 +1,79 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type UserTokenPurpose string
+
+const (
+	UserTokenPurposePasswordReset     UserTokenPurpose = "password_reset"
+	UserTokenPurposeEmailVerification UserTokenPurpose = "email_verification"
+)
+
+var ErrTokenInvalid = errors.New("token is invalid, expired or already used")
+
+type UserToken struct {
+	CreateUserTokenParams
+	CreatedAt time.Time  `json:"created_at"`
+	UsedAt    *time.Time `json:"used_at"`
+}
+
+type CreateUserTokenParams struct {
+	TokenHash string           `json:"-"`
+	UserID    uuid.UUID        `json:"user_id"`
+	Purpose   UserTokenPurpose `json:"purpose"`
+	ExpiresAt time.Time        `json:"expires_at"`
+}
+
+func (c Client) CreateUserToken(params CreateUserTokenParams) error {
+	query := `
+		INSERT INTO user_tokens (
+			token_hash,
+			created_at,
+			user_id,
+			purpose,
+			expires_at
+		) VALUES (?, CURRENT_TIMESTAMP, ?, ?, ?)
+	`
+	_, err := c.db.Exec(query, params.TokenHash, params.UserID.String(), params.Purpose, params.ExpiresAt)
+	return err
+}
+
+// ConsumeUserToken marks an unused, unexpired token as used and returns the
+// user it was issued to. The update and the lookup happen in one statement so
+// a token can only ever be redeemed once.
+func (c Client) ConsumeUserToken(tokenHash string, purpose UserTokenPurpose) (uuid.UUID, error) {
+	query := `
+		UPDATE user_tokens
+		SET used_at = ?
+		WHERE token_hash = ?
+			AND purpose = ?
+			AND used_at IS NULL
+			AND expires_at > ?
+		RETURNING user_id
+	`
+	now := time.Now().UTC()
+	var userID string
+	err := c.db.QueryRow(query, now, tokenHash, purpose, now).Scan(&userID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return uuid.Nil, ErrTokenInvalid
+		}
+		return uuid.Nil, err
+	}
+	return uuid.Parse(userID)
+}
+
+func (c Client) DeleteUserTokens(userID uuid.UUID, purpose UserTokenPurpose) error {
+	query := `
+		DELETE FROM user_tokens
+		WHERE user_id = ? AND purpose = ?
+	`
+	_, err := c.db.Exec(query, userID.String(), purpose)
+	return err
+}
@@ -9,9 +9,11 @@ import (
 )
 
 type User struct {
-	ID        uuid.UUID `json:"id"`
-	CreatedAt time.Time `json:"created_at"`
-	UpdatedAt time.Time `json:"updated_at"`
+	ID              uuid.UUID  `json:"id"`
+	CreatedAt       time.Time  `json:"created_at"`
+	UpdatedAt       time.Time  `json:"updated_at"`
+	EmailVerifiedAt *time.Time `json:"email_verified_at"`
+	Plan            string     `json:"plan"`
 	CreateUserParams
 }
 
@@ -53,13 +55,13 @@ func (c Client) GetUsers() ([]User, error) {
 
 func (c Client) GetUserByEmail(email string) (User, error) {
 	query := `
-		SELECT id, created_at, updated_at, email, password
+		SELECT id, created_at, updated_at, email_verified_at, plan, email, password
 		FROM users
 		WHERE email = ?
 	`
 	var user User
 	var id string
-	err := c.db.QueryRow(query, email).Scan(&id, &user.CreatedAt, &user.UpdatedAt, &user.Email, &user.Password)
+	err := c.db.QueryRow(query, email).Scan(&id, &user.CreatedAt, &user.UpdatedAt, &user.EmailVerifiedAt, &user.Plan, &user.Email, &user.Password)
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
 			return User{}, nil
@@ -75,15 +77,17 @@ func (c Client) GetUserByEmail(email string) (User, error) {
 
 func (c Client) GetUserByRefreshToken(token string) (*User, error) {
 	query := `
-		SELECT u.id, u.email, u.created_at, u.updated_at, u.password
+		SELECT u.id, u.email, u.created_at, u.updated_at, u.email_verified_at, u.plan, u.password
 		FROM users u
 		JOIN refresh_tokens rt ON u.id = rt.user_id
 		WHERE rt.token = ?
+			AND rt.revoked_at IS NULL
+			AND rt.expires_at > ?
 	`
 
 	var user User
 	var id string
-	err := c.db.QueryRow(query, token).Scan(&id, &user.Email, &user.CreatedAt, &user.UpdatedAt, &user.Password)
+	err := c.db.QueryRow(query, token, time.Now().UTC()).Scan(&id, &user.Email, &user.CreatedAt, &user.UpdatedAt, &user.EmailVerifiedAt, &user.Plan, &user.Password)
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
 			return nil, nil
@@ -117,13 +121,13 @@ func (c Client) CreateUser(params CreateUserParams) (*User, error) {
 
 func (c Client) GetUser(id uuid.UUID) (*User, error) {
 	query := `
-		SELECT id, created_at, updated_at, email, password
+		SELECT id, created_at, updated_at, email_verified_at, plan, email, password
 		FROM users
 		WHERE id = ?
 	`
 	var user User
 	var idStr string
-	err := c.db.QueryRow(query, id.String()).Scan(&idStr, &user.CreatedAt, &user.UpdatedAt, &user.Email, &user.Password)
+	err := c.db.QueryRow(query, id.String()).Scan(&idStr, &user.CreatedAt, &user.UpdatedAt, &user.EmailVerifiedAt, &user.Plan, &user.Email, &user.Password)
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
 			return nil, nil
@@ -137,6 +141,26 @@ func (c Client) GetUser(id uuid.UUID) (*User, error) {
 	return &user, nil
 }
 
+func (c Client) UpdateUserPassword(id uuid.UUID, hashedPassword string) error {
+	query := `
+		UPDATE users
+		SET password = ?, updated_at = CURRENT_TIMESTAMP
+		WHERE id = ?
+	`
+	_, err := c.db.Exec(query, hashedPassword, id.String())
+	return err
+}
+
+func (c Client) MarkUserEmailVerified(id uuid.UUID) error {
+	query := `
+		UPDATE users
+		SET email_verified_at = CURRENT_TIMESTAMP, updated_at = CURRENT_TIMESTAMP
+		WHERE id = ? AND email_verified_at IS NULL
+	`
+	_, err := c.db.Exec(query, id.String())
+	return err
+}
+
 func (c Client) DeleteUser(id uuid.UUID) error {
 	query := `
 		DELETE FROM users
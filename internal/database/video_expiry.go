@@ -0,0 +1,85 @@
+package database
+
+import (
+	"time"
+)
+
+// SetVideoExpiry sets when the video expires and whether it's deleted then,
+// or removes the expiry when expiresAt is nil. A video that already expired
+// is published again unless the new expiry has passed too.
+func (c Client) SetVideoExpiry(video *Video, expiresAt *time.Time, purge bool) error {
+	var expires *string
+	if expiresAt != nil {
+		formatted := formatTimestamp(*expiresAt)
+		expires = &formatted
+	}
+	err := c.db.QueryRow(`
+	UPDATE videos
+	SET
+		expires_at = ?,
+		purge_on_expiry = ?,
+		unpublished_at = CASE WHEN ? IS NOT NULL AND ? <= ? THEN unpublished_at END,
+		updated_at = ?
+	WHERE id = ?
+	RETURNING expires_at, purge_on_expiry, unpublished_at, updated_at
+	`, expires, purge && expiresAt != nil, expires, expires, formatTimestamp(now()), formatTimestamp(now()), video.ID,
+	).Scan(&video.ExpiresAt, &video.PurgeOnExpiry, &video.UnpublishedAt, &video.UpdatedAt)
+	c.invalidateVideo(video.ID, video.UserID)
+	return err
+}
+
+// GetExpiredVideos returns videos whose expiry has passed and that still
+// need unpublishing, or purging if they're PurgeOnExpiry.
+func (c Client) GetExpiredVideos(before time.Time) ([]Video, error) {
+	rows, err := c.db.Query(`
+	SELECT `+videoColumns+`
+	FROM videos
+	WHERE expires_at <= ? AND (unpublished_at IS NULL OR purge_on_expiry = 1)
+	ORDER BY expires_at
+	`, formatTimestamp(before))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	videos := []Video{}
+	for rows.Next() {
+		video, err := scanVideo(rows)
+		if err != nil {
+			return nil, err
+		}
+		videos = append(videos, video)
+	}
+	return videos, rows.Err()
+}
+
+// MarkVideoUnpublished hides the video from viewers, e.g. once its expiry
+// was handled.
+func (c Client) MarkVideoUnpublished(video *Video) error {
+	err := c.db.QueryRow(`
+	UPDATE videos
+	SET unpublished_at = ?, updated_at = ?
+	WHERE id = ?
+	RETURNING unpublished_at, updated_at
+	`, formatTimestamp(now()), formatTimestamp(now()), video.ID).Scan(&video.UnpublishedAt, &video.UpdatedAt)
+	c.invalidateVideo(video.ID, video.UserID)
+	return err
+}
+
+// PublishVideo makes an unpublished or expired video playable again. An
+// expiry that has passed is removed, a future one is kept.
+func (c Client) PublishVideo(video *Video) error {
+	timestamp := formatTimestamp(now())
+	err := c.db.QueryRow(`
+	UPDATE videos
+	SET
+		unpublished_at = NULL,
+		purge_on_expiry = CASE WHEN expires_at <= ? THEN 0 ELSE purge_on_expiry END,
+		expires_at = CASE WHEN expires_at <= ? THEN NULL ELSE expires_at END,
+		updated_at = ?
+	WHERE id = ?
+	RETURNING expires_at, purge_on_expiry, unpublished_at, updated_at
+	`, timestamp, timestamp, timestamp, video.ID).Scan(&video.ExpiresAt, &video.PurgeOnExpiry, &video.UnpublishedAt, &video.UpdatedAt)
+	c.invalidateVideo(video.ID, video.UserID)
+	return err
+}
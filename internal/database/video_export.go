@@ -0,0 +1,62 @@
+package database
+
+import (
+	"github.com/google/uuid"
+)
+
+// VideoExport is a video with the stats a creator's catalog export adds.
+type VideoExport struct {
+	Video
+	DurationMS int64 `json:"duration_ms"`
+	// Views and DeliveredBytes come from ingested access logs, so they lag
+	// behind and stay 0 without ACCESS_LOG_BUCKET.
+	Views          int64 `json:"views"`
+	DeliveredBytes int64 `json:"delivered_bytes"`
+}
+
+// extraScanner scans a row's trailing columns into extra, after the ones a
+// scanX function asks for.
+type extraScanner struct {
+	row   rowScanner
+	extra []any
+}
+
+func (s extraScanner) Scan(dest ...any) error {
+	return s.row.Scan(append(dest, s.extra...)...)
+}
+
+// ExportVideos calls fn with each of the user's videos, oldest first, while
+// reading them, so exports of large catalogs aren't held in memory. It stops
+// at the first error fn returns. There's no statement timeout, since how
+// fast fn writes to the client paces the query.
+func (c Client) ExportVideos(userID uuid.UUID, fn func(VideoExport) error) error {
+	query := `
+	SELECT ` + videoColumns + `,
+		COALESCE((SELECT MAX(duration_ms) FROM artifacts WHERE artifacts.video_id = videos.id), 0),
+		COALESCE((SELECT SUM(requests) FROM video_delivery_stats WHERE video_delivery_stats.video_id = videos.id), 0),
+		COALESCE((SELECT SUM(bytes) FROM video_delivery_stats WHERE video_delivery_stats.video_id = videos.id), 0)
+	FROM videos
+	WHERE user_id = ?
+	ORDER BY created_at, id
+	`
+	rows, err := c.reader.Query(query, userID)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var export VideoExport
+		export.Video, err = scanVideo(extraScanner{
+			row:   rows,
+			extra: []any{&export.DurationMS, &export.Views, &export.DeliveredBytes},
+		})
+		if err != nil {
+			return err
+		}
+		if err := fn(export); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
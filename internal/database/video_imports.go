@@ -0,0 +1,223 @@
+package database
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type VideoImportStatus string
+
+const (
+	VideoImportRunning  VideoImportStatus = "running"
+	VideoImportFinished VideoImportStatus = "finished"
+	// VideoImportInterrupted imports were running when the server stopped.
+	// Their staged files are gone, so they can't be resumed.
+	VideoImportInterrupted VideoImportStatus = "interrupted"
+)
+
+type VideoImportItemStatus string
+
+const (
+	VideoImportItemPending  VideoImportItemStatus = "pending"
+	VideoImportItemImported VideoImportItemStatus = "imported"
+	VideoImportItemFailed   VideoImportItemStatus = "failed"
+)
+
+// VideoImport creates videos from another platform's export, one item at a
+// time in the background.
+type VideoImport struct {
+	ID         uuid.UUID         `json:"id"`
+	CreatedAt  time.Time         `json:"created_at"`
+	UpdatedAt  time.Time         `json:"updated_at"`
+	UserID     uuid.UUID         `json:"user_id"`
+	Source     string            `json:"source"`
+	Status     VideoImportStatus `json:"status"`
+	FinishedAt *time.Time        `json:"finished_at"`
+	Total      int               `json:"total"`
+	Imported   int               `json:"imported"`
+	Failed     int               `json:"failed"`
+	// Items are only loaded by GetVideoImport.
+	Items []VideoImportItem `json:"items,omitempty"`
+}
+
+type VideoImportItem struct {
+	// SourceID is the video's ID on the platform it's imported from.
+	SourceID string                `json:"source_id"`
+	Title    string                `json:"title"`
+	Status   VideoImportItemStatus `json:"status"`
+	VideoID  *uuid.UUID            `json:"video_id"`
+	Error    string                `json:"error,omitempty"`
+}
+
+type CreateVideoImportItemParams struct {
+	SourceID string
+	Title    string
+}
+
+const videoImportColumns = `id, created_at, updated_at, user_id, source, status, finished_at,
+	(SELECT COUNT(*) FROM video_import_items WHERE import_id = video_imports.id),
+	(SELECT COUNT(*) FROM video_import_items WHERE import_id = video_imports.id AND status = 'imported'),
+	(SELECT COUNT(*) FROM video_import_items WHERE import_id = video_imports.id AND status = 'failed')`
+
+func scanVideoImport(row rowScanner) (VideoImport, error) {
+	var imp VideoImport
+	err := row.Scan(&imp.ID, &imp.CreatedAt, &imp.UpdatedAt, &imp.UserID, &imp.Source, &imp.Status, &imp.FinishedAt,
+		&imp.Total, &imp.Imported, &imp.Failed)
+	return imp, err
+}
+
+// CreateVideoImport records a running import with its items pending, in the
+// order they're imported.
+func (c Client) CreateVideoImport(userID uuid.UUID, source string, items []CreateVideoImportItemParams) (VideoImport, error) {
+	tx, err := c.db.Begin()
+	if err != nil {
+		return VideoImport{}, err
+	}
+	defer tx.Rollback()
+
+	id := uuid.New()
+	timestamp := formatTimestamp(now())
+	_, err = tx.Exec(`
+	INSERT INTO video_imports (id, created_at, updated_at, user_id, source, status)
+	VALUES (?, ?, ?, ?, ?, ?)
+	`, id, timestamp, timestamp, userID, source, VideoImportRunning)
+	if err != nil {
+		return VideoImport{}, err
+	}
+	for i, item := range items {
+		_, err = tx.Exec(`
+		INSERT INTO video_import_items (import_id, position, source_id, title, status)
+		VALUES (?, ?, ?, ?, ?)
+		`, id, i, item.SourceID, item.Title, VideoImportItemPending)
+		if err != nil {
+			return VideoImport{}, err
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return VideoImport{}, err
+	}
+	return c.GetVideoImport(id)
+}
+
+// GetVideoImport returns the import with its items.
+func (c Client) GetVideoImport(id uuid.UUID) (VideoImport, error) {
+	imp, err := scanVideoImport(c.db.QueryRow(`SELECT `+videoImportColumns+` FROM video_imports WHERE id = ?`, id))
+	if err != nil {
+		return VideoImport{}, err
+	}
+
+	rows, err := c.db.Query(`
+	SELECT source_id, title, status, video_id, error
+	FROM video_import_items
+	WHERE import_id = ?
+	ORDER BY position
+	`, id)
+	if err != nil {
+		return VideoImport{}, err
+	}
+	defer rows.Close()
+
+	imp.Items = []VideoImportItem{}
+	for rows.Next() {
+		var item VideoImportItem
+		if err := rows.Scan(&item.SourceID, &item.Title, &item.Status, &item.VideoID, &item.Error); err != nil {
+			return VideoImport{}, err
+		}
+		imp.Items = append(imp.Items, item)
+	}
+	return imp, rows.Err()
+}
+
+// GetVideoImports returns the user's imports, newest first, without their
+// items.
+func (c Client) GetVideoImports(userID uuid.UUID) ([]VideoImport, error) {
+	rows, err := c.db.Query(`
+	SELECT `+videoImportColumns+`
+	FROM video_imports
+	WHERE user_id = ?
+	ORDER BY created_at DESC
+	`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	imports := []VideoImport{}
+	for rows.Next() {
+		imp, err := scanVideoImport(rows)
+		if err != nil {
+			return nil, err
+		}
+		imports = append(imports, imp)
+	}
+	return imports, rows.Err()
+}
+
+func (c Client) HasRunningVideoImport(userID uuid.UUID) (bool, error) {
+	var exists bool
+	err := c.db.QueryRow(`SELECT EXISTS (SELECT 1 FROM video_imports WHERE user_id = ? AND status = ?)`,
+		userID, VideoImportRunning).Scan(&exists)
+	return exists, err
+}
+
+// UpdateVideoImportItem records the outcome of the item at position.
+func (c Client) UpdateVideoImportItem(importID uuid.UUID, position int, status VideoImportItemStatus, videoID *uuid.UUID, errMsg string) error {
+	tx, err := c.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec(`
+	UPDATE video_import_items
+	SET status = ?, video_id = ?, error = ?
+	WHERE import_id = ? AND position = ?
+	`, status, videoID, errMsg, importID, position)
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec(`UPDATE video_imports SET updated_at = ? WHERE id = ?`, formatTimestamp(now()), importID)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (c Client) FinishVideoImport(id uuid.UUID) error {
+	timestamp := formatTimestamp(now())
+	_, err := c.db.Exec(`UPDATE video_imports SET status = ?, updated_at = ?, finished_at = ? WHERE id = ?`,
+		VideoImportFinished, timestamp, timestamp, id)
+	return err
+}
+
+// InterruptVideoImports marks imports left running by a previous process as
+// interrupted, failing their pending items with errMsg. It returns how many
+// imports were interrupted.
+func (c Client) InterruptVideoImports(errMsg string) (int64, error) {
+	tx, err := c.db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec(`
+	UPDATE video_import_items
+	SET status = ?, error = ?
+	WHERE status = ? AND import_id IN (SELECT id FROM video_imports WHERE status = ?)
+	`, VideoImportItemFailed, errMsg, VideoImportItemPending, VideoImportRunning)
+	if err != nil {
+		return 0, err
+	}
+	timestamp := formatTimestamp(now())
+	result, err := tx.Exec(`UPDATE video_imports SET status = ?, updated_at = ?, finished_at = ? WHERE status = ?`,
+		VideoImportInterrupted, timestamp, timestamp, VideoImportRunning)
+	if err != nil {
+		return 0, err
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return 0, err
+	}
+	return n, tx.Commit()
+}
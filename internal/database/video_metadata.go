@@ -0,0 +1,109 @@
+package database
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// metadataKeyPattern keeps keys safe to put in JSON paths and index names.
+var metadataKeyPattern = regexp.MustCompile(`^[a-z][a-z0-9_]{0,39}$`)
+
+// ValidMetadataKey reports whether key can name a metadata value: a
+// lowercase letter followed by up to 39 lowercase letters, digits or
+// underscores.
+func ValidMetadataKey(key string) bool {
+	return metadataKeyPattern.MatchString(key)
+}
+
+// Metadata is stored as a JSON object of strings.
+func parseMetadata(metadata string) map[string]string {
+	parsed := map[string]string{}
+	if metadata != "" {
+		// Only SetVideoMetadata and CreateVideo write it, so it's valid.
+		json.Unmarshal([]byte(metadata), &parsed)
+	}
+	return parsed
+}
+
+func formatMetadata(metadata map[string]string) string {
+	if len(metadata) == 0 {
+		return "{}"
+	}
+	data, _ := json.Marshal(metadata)
+	return string(data)
+}
+
+// SetVideoMetadata replaces the video's metadata.
+func (c Client) SetVideoMetadata(video *Video, metadata map[string]string) error {
+	err := c.db.QueryRow(`
+	UPDATE videos
+	SET metadata = ?, updated_at = ?
+	WHERE id = ?
+	RETURNING updated_at
+	`, formatMetadata(metadata), formatTimestamp(now()), video.ID).Scan(&video.UpdatedAt)
+	c.invalidateVideo(video.ID, video.UserID)
+	if err != nil {
+		return err
+	}
+	if metadata == nil {
+		metadata = map[string]string{}
+	}
+	video.Metadata = metadata
+	return nil
+}
+
+// indexMetadataKeys creates an index per key so VideoFilter can look
+// videos up by it. Indexes of keys no longer listed are left in place, since
+// tools open the database without any.
+func (c *Client) indexMetadataKeys(keys []string) error {
+	for _, key := range keys {
+		if !ValidMetadataKey(key) {
+			return fmt.Errorf("invalid metadata key %q", key)
+		}
+		_, err := c.db.Exec(fmt.Sprintf(
+			`CREATE INDEX IF NOT EXISTS idx_videos_metadata_%s ON videos(user_id, %s)`, key, metadataExpr(key),
+		))
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// metadataExpr must match the indexed expression exactly for SQLite to use
+// the index, so the key is spelled out rather than bound.
+func metadataExpr(key string) string {
+	return fmt.Sprintf(`json_extract(metadata, '$.%s')`, key)
+}
+
+// VideoFilter narrows a video listing. Metadata keys must be valid, and
+// should be indexed since they're otherwise matched by scanning every one
+// of the user's videos.
+type VideoFilter struct {
+	Metadata map[string]string
+}
+
+func (f VideoFilter) where() (string, []any) {
+	keys := make([]string, 0, len(f.Metadata))
+	for key := range f.Metadata {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var clauses strings.Builder
+	args := []any{}
+	for _, key := range keys {
+		if !ValidMetadataKey(key) {
+			// Never matches, rather than splicing the key into SQL.
+			clauses.WriteString(` AND 0`)
+			continue
+		}
+		clauses.WriteString(` AND ` + metadataExpr(key) + ` = ?`)
+		args = append(args, f.Metadata[key])
+	}
+	return clauses.String(), args
+}
@@ -0,0 +1,81 @@
+package database
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// SetVideoPassword stores the bcrypt hash of the video's password, or
+// removes it when hash is empty. Failed attempts against the old password
+// are forgotten.
+func (c Client) SetVideoPassword(video *Video, hash string) error {
+	tx, err := c.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	err = tx.QueryRow(`
+	UPDATE videos
+	SET password_hash = ?, updated_at = ?
+	WHERE id = ?
+	RETURNING updated_at
+	`, hash, formatTimestamp(now()), video.ID).Scan(&video.UpdatedAt)
+	if err != nil {
+		return err
+	}
+	if _, err := tx.Exec(`DELETE FROM video_password_attempts WHERE video_id = ?`, video.ID); err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	c.invalidateVideo(video.ID, video.UserID)
+	video.PasswordProtected = hash != ""
+	return nil
+}
+
+// GetVideoPasswordHash returns the bcrypt hash of the video's password,
+// empty if it has none.
+func (c Client) GetVideoPasswordHash(id uuid.UUID) (string, error) {
+	var hash string
+	err := c.db.QueryRow(`SELECT password_hash FROM videos WHERE id = ?`, id).Scan(&hash)
+	return hash, err
+}
+
+func (c Client) RecordVideoPasswordFailure(videoID uuid.UUID, ipAddress string) error {
+	_, err := c.db.Exec(`
+		INSERT INTO video_password_attempts (created_at, video_id, ip_address)
+		VALUES (?, ?, ?)
+	`, time.Now().UTC(), videoID, ipAddress)
+	return err
+}
+
+// GetVideoPasswordFailures counts wrong passwords entered for a video from
+// an address since the given time.
+func (c Client) GetVideoPasswordFailures(videoID uuid.UUID, ipAddress string, since time.Time) (LoginFailures, error) {
+	rows, err := c.db.Query(`
+		SELECT created_at
+		FROM video_password_attempts
+		WHERE video_id = ? AND ip_address = ? AND created_at > ?
+		ORDER BY created_at DESC
+	`, videoID, ipAddress, since)
+	if err != nil {
+		return LoginFailures{}, err
+	}
+	defer rows.Close()
+
+	var failures LoginFailures
+	for rows.Next() {
+		var createdAt time.Time
+		if err := rows.Scan(&createdAt); err != nil {
+			return LoginFailures{}, err
+		}
+		if failures.Count == 0 {
+			failures.LastFailureAt = createdAt
+		}
+		failures.Count++
+	}
+	return failures, rows.Err()
+}
@@ -0,0 +1,29 @@
+package database
+
+import (
+	"strings"
+)
+
+// Tags are stored comma separated, so they can't contain commas.
+func splitTags(tags string) []string {
+	if tags == "" {
+		return []string{}
+	}
+	return strings.Split(tags, ",")
+}
+
+// SetVideoTags replaces the video's tags.
+func (c Client) SetVideoTags(video *Video, tags []string) error {
+	err := c.db.QueryRow(`
+	UPDATE videos
+	SET tags = ?, updated_at = ?
+	WHERE id = ?
+	RETURNING updated_at
+	`, strings.Join(tags, ","), formatTimestamp(now()), video.ID).Scan(&video.UpdatedAt)
+	c.invalidateVideo(video.ID, video.UserID)
+	if err != nil {
+		return err
+	}
+	video.Tags = tags
+	return nil
+}
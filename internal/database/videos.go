@@ -3,43 +3,97 @@ package database
 import (
 	"database/sql"
 	"errors"
+	"strings"
 	"time"
 
 	"github.com/google/uuid"
 )
 
 type Video struct {
-	ID           uuid.UUID `json:"id"`
-	CreatedAt    time.Time `json:"created_at"`
-	UpdatedAt    time.Time `json:"updated_at"`
-	ThumbnailURL *string   `json:"thumbnail_url"`
-	VideoURL     *string   `json:"video_url"`
+	ID        uuid.UUID `json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+	// PublishedAt is set the first time the video gets a playable URL.
+	PublishedAt  *time.Time `json:"published_at"`
+	ThumbnailURL *string    `json:"thumbnail_url"`
+	VideoURL     *string    `json:"video_url"`
+	SizeBytes    int64      `json:"size_bytes"`
+	// PasswordProtected videos only hand out URLs to their owner and to
+	// viewers who know the password.
+	PasswordProtected bool `json:"password_protected"`
+	// ExpiresAt is when the video stops being playable by anyone but its
+	// owner. UnpublishedAt is set once the expiry job has handled it, and
+	// PurgeOnExpiry videos are deleted altogether at that point.
+	ExpiresAt     *time.Time `json:"expires_at"`
+	PurgeOnExpiry bool       `json:"purge_on_expiry"`
+	UnpublishedAt *time.Time `json:"unpublished_at"`
+	// DownloadsEnabled lets viewers get a download link, which only the
+	// owner can otherwise.
+	DownloadsEnabled bool `json:"downloads_enabled"`
+	// Tags are for the owner's own organizing.
+	Tags []string `json:"tags"`
 	CreateVideoParams
 }
 
+// ErrVideoModified is returned by conditional updates when the video changed
+// since it was read.
+var ErrVideoModified = errors.New("video was modified")
+
+const videoColumns = `id, created_at, updated_at, published_at, title, description, thumbnail_url, video_url, size_bytes, user_id, password_hash != '', expires_at, purge_on_expiry, unpublished_at, downloads_enabled, tags, metadata`
+
+func scanVideo(row rowScanner) (Video, error) {
+	var video Video
+	var tags, metadata string
+	err := row.Scan(
+		&video.ID,
+		&video.CreatedAt,
+		&video.UpdatedAt,
+		&video.PublishedAt,
+		&video.Title,
+		&video.Description,
+		&video.ThumbnailURL,
+		&video.VideoURL,
+		&video.SizeBytes,
+		&video.UserID,
+		&video.PasswordProtected,
+		&video.ExpiresAt,
+		&video.PurgeOnExpiry,
+		&video.UnpublishedAt,
+		&video.DownloadsEnabled,
+		&tags,
+		&metadata,
+	)
+	video.Tags = splitTags(tags)
+	video.Metadata = parseMetadata(metadata)
+	return video, err
+}
+
 type CreateVideoParams struct {
 	Title       string    `json:"title"`
 	Description string    `json:"description"`
 	UserID      uuid.UUID `json:"user_id"`
+	// Metadata holds the integrator's own key/value pairs, like a course ID
+	// or a SKU.
+	Metadata map[string]string `json:"metadata"`
 }
 
 func (c Client) GetVideos(userID uuid.UUID) ([]Video, error) {
+	if c.videoListCache != nil {
+		if videos, ok := c.videoListCache.get(userID); ok {
+			return append([]Video{}, videos...), nil
+		}
+	}
+
 	query := `
-	SELECT
-		id,
-		created_at,
-		updated_at,
-		title,
-		description,
-		thumbnail_url,
-		video_url,
-		user_id
+	SELECT ` + videoColumns + `
 	FROM videos
 	WHERE user_id = ?
-	ORDER BY created_at DESC
+	ORDER BY created_at DESC, id DESC
 	`
 
-	rows, err := c.db.Query(query, userID)
+	ctx, cancel := c.readContext()
+	defer cancel()
+	rows, err := c.reader.QueryContext(ctx, query, userID)
 	if err != nil {
 		return nil, err
 	}
@@ -47,22 +101,20 @@ func (c Client) GetVideos(userID uuid.UUID) ([]Video, error) {
 
 	videos := []Video{}
 	for rows.Next() {
-		var video Video
-		if err := rows.Scan(
-			&video.ID,
-			&video.CreatedAt,
-			&video.UpdatedAt,
-			&video.Title,
-			&video.Description,
-			&video.ThumbnailURL,
-			&video.VideoURL,
-			&video.UserID,
-		); err != nil {
+		video, err := scanVideo(rows)
+		if err != nil {
 			return nil, err
 		}
 		videos = append(videos, video)
 	}
 
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	if c.videoListCache != nil {
+		c.videoListCache.set(userID, append([]Video{}, videos...))
+	}
 	return videos, nil
 }
 
@@ -75,42 +127,36 @@ func (c Client) CreateVideo(params CreateVideoParams) (Video, error) {
 		updated_at,
 		title,
 		description,
-		user_id
-	) VALUES (?, CURRENT_TIMESTAMP, CURRENT_TIMESTAMP, ?, ?, ?)
+		user_id,
+		metadata
+	) VALUES (?, ?, ?, ?, ?, ?, ?)
 	`
-	_, err := c.db.Exec(query, id, params.Title, params.Description, params.UserID)
+	createdAt := formatTimestamp(now())
+	_, err := c.db.Exec(query, id, createdAt, createdAt, params.Title, params.Description, params.UserID, formatMetadata(params.Metadata))
 	if err != nil {
 		return Video{}, err
 	}
+	if c.videoListCache != nil {
+		c.videoListCache.delete(params.UserID)
+	}
 
 	return c.GetVideo(id)
 }
 
 func (c Client) GetVideo(id uuid.UUID) (Video, error) {
+	if c.videoCache != nil {
+		if video, ok := c.videoCache.get(id); ok {
+			return video, nil
+		}
+	}
+
 	query := `
-	SELECT
-		id,
-		created_at,
-		updated_at,
-		title,
-		description,
-		thumbnail_url,
-		video_url,
-		user_id
+	SELECT ` + videoColumns + `
 	FROM videos
 	WHERE id = ?
 	`
 
-	var video Video
-	err := c.db.QueryRow(query, id).Scan(
-		&video.ID,
-		&video.CreatedAt,
-		&video.UpdatedAt,
-		&video.Title,
-		&video.Description,
-		&video.ThumbnailURL,
-		&video.VideoURL,
-		&video.UserID)
+	video, err := scanVideo(c.db.QueryRow(query, id))
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
 			return Video{}, nil
@@ -118,10 +164,81 @@ func (c Client) GetVideo(id uuid.UUID) (Video, error) {
 		return Video{}, err
 	}
 
+	if c.videoCache != nil {
+		c.videoCache.set(id, video)
+	}
 	return video, nil
 }
 
-func (c Client) UpdateVideo(video Video) error {
+// SetVideoContentHash records the hex SHA-256 of the file the video was
+// made from, see FindVideoByContentHash.
+func (c Client) SetVideoContentHash(id uuid.UUID, sum string) error {
+	var userID uuid.UUID
+	err := c.db.QueryRow(`UPDATE videos SET content_sha256 = ? WHERE id = ? RETURNING user_id`, sum, id).Scan(&userID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	c.invalidateVideo(id, userID)
+	return nil
+}
+
+// FindVideoByContentHash returns the user's latest playable video made from
+// a file with the given SHA-256, or sql.ErrNoRows if there's none.
+func (c Client) FindVideoByContentHash(userID uuid.UUID, sum string) (Video, error) {
+	return scanVideo(c.db.QueryRow(`
+	SELECT `+videoColumns+`
+	FROM videos
+	WHERE user_id = ? AND content_sha256 = ? AND video_url IS NOT NULL
+	ORDER BY updated_at DESC
+	LIMIT 1
+	`, userID, sum))
+}
+
+// UpdateVideo saves the video's fields and refreshes its UpdatedAt and
+// PublishedAt to the stored values.
+func (c Client) UpdateVideo(video *Video) error {
+	return c.updateVideo(video, nil)
+}
+
+// UpdateVideoIfUnchanged is UpdateVideo for optimistic concurrency: it only
+// saves if nobody updated the video since it was read, going by UpdatedAt,
+// and returns ErrVideoModified otherwise.
+func (c Client) UpdateVideoIfUnchanged(video *Video) error {
+	return c.updateVideo(video, &video.UpdatedAt)
+}
+
+// PatchVideo saves the fields clients edit directly: title, description,
+// thumbnail URL, tags, metadata and downloads. Like UpdateVideoIfUnchanged
+// it returns ErrVideoModified if the video was updated since it was read,
+// since the patch was applied to what was read.
+func (c Client) PatchVideo(video *Video) error {
+	updatedAt := now()
+	err := c.db.QueryRow(`
+	UPDATE videos
+	SET
+		title = ?,
+		description = ?,
+		thumbnail_url = ?,
+		tags = ?,
+		metadata = ?,
+		downloads_enabled = ?,
+		updated_at = ?
+	WHERE id = ? AND updated_at = ?
+	RETURNING updated_at
+	`, video.Title, video.Description, video.ThumbnailURL, strings.Join(video.Tags, ","), formatMetadata(video.Metadata),
+		video.DownloadsEnabled, formatTimestamp(updatedAt), video.ID, formatTimestamp(video.UpdatedAt)).Scan(&video.UpdatedAt)
+	c.invalidateVideo(video.ID, video.UserID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return ErrVideoModified
+	}
+	return err
+}
+
+func (c Client) updateVideo(video *Video, ifUpdatedAt *time.Time) error {
+	updatedAt := now()
 	query := `
 	UPDATE videos
 	SET
@@ -129,27 +246,159 @@ func (c Client) UpdateVideo(video Video) error {
 		description = ?,
 		thumbnail_url = ?,
 		video_url = ?,
-		user_id = ?
+		size_bytes = ?,
+		user_id = ?,
+		updated_at = ?,
+		published_at = COALESCE(published_at, CASE WHEN ? IS NOT NULL THEN ? END)
 	WHERE id = ?
 	`
-
-	_, err := c.db.Exec(
-		query,
+	args := []any{
 		video.Title,
 		video.Description,
-		&video.ThumbnailURL,
-		&video.VideoURL,
+		video.ThumbnailURL,
+		video.VideoURL,
+		video.SizeBytes,
 		video.UserID,
+		formatTimestamp(updatedAt),
+		video.VideoURL,
+		formatTimestamp(updatedAt),
 		video.ID,
-	)
-	return err
+	}
+	if ifUpdatedAt != nil {
+		query += ` AND updated_at = ?`
+		args = append(args, formatTimestamp(*ifUpdatedAt))
+	}
+	query += ` RETURNING published_at`
+
+	var publishedAt *time.Time
+	err := c.db.QueryRow(query, args...).Scan(&publishedAt)
+	c.invalidateVideo(video.ID, video.UserID)
+	if errors.Is(err, sql.ErrNoRows) && ifUpdatedAt != nil {
+		return ErrVideoModified
+	}
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return err
+	}
+	video.UpdatedAt = updatedAt
+	video.PublishedAt = publishedAt
+	return nil
 }
 
+// videoRows are the rows of other tables that go when their video is
+// deleted, as a table and the condition matching the video's ID. Children
+// come before their parents.
+var videoRows = []struct{ table, where string }{
+	{"artifacts", "video_id = ?"},
+	{"video_takedowns", "video_id = ?"},
+	{"copyright_claims", "video_id = ?"},
+	{"embed_tokens", "video_id = ?"},
+	{"video_password_attempts", "video_id = ?"},
+	{"slugs", "target_type = '" + string(SlugTargetVideo) + "' AND target_id = ?"},
+	{"upload_session_parts", "token IN (SELECT token FROM upload_sessions WHERE video_id = ?)"},
+	{"upload_sessions", "video_id = ?"},
+	{"tus_uploads", "video_id = ?"},
+	{"queued_uploads", "video_id = ?"},
+	{"thumbnail_jobs", "video_id = ?"},
+	{"transcode_jobs", "video_id = ?"},
+	{"video_import_items", "video_id = ?"},
+	// The delete trigger queues the video.deleted event after these go.
+	{"cms_sync_events", "video_id = ?"},
+	{"processing_metrics", "video_id = ?"},
+	{"video_delivery_stats", "video_id = ?"},
+}
+
+// DeleteVideo removes a video and its artifact records. The objects
+// themselves have to be deleted from the bucket by the caller first.
 func (c Client) DeleteVideo(id uuid.UUID) error {
+	tx, err := c.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for _, rows := range videoRows {
+		if _, err := tx.Exec(`DELETE FROM `+rows.table+` WHERE `+rows.where, id); err != nil {
+			return err
+		}
+	}
+
 	query := `
 	DELETE FROM videos
 	WHERE id = ?
+	RETURNING user_id
 	`
-	_, err := c.db.Exec(query, id)
+	var userID uuid.UUID
+	err = tx.QueryRow(query, id).Scan(&userID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	c.invalidateVideo(id, userID)
+	return nil
+}
+
+// CountVideoRows returns how many rows DeleteVideo would delete from each
+// table, leaving out tables without any. It's empty if the video doesn't
+// exist.
+func (c Client) CountVideoRows(id uuid.UUID) (map[string]int, error) {
+	counts := map[string]int{}
+	tables := append(videoRows, struct{ table, where string }{"videos", "id = ?"})
+	for _, rows := range tables {
+		var n int
+		if err := c.db.QueryRow(`SELECT COUNT(*) FROM `+rows.table+` WHERE `+rows.where, id).Scan(&n); err != nil {
+			return nil, err
+		}
+		if n > 0 {
+			counts[rows.table] = n
+		}
+	}
+	return counts, nil
+}
+
+// invalidateVideo drops a video and its owner's list from the cache, along
+// with the list of a previous owner if it was cached under one.
+func (c Client) invalidateVideo(id, userID uuid.UUID) {
+	if c.videoCache == nil {
+		return
+	}
+	if cached, ok := c.videoCache.get(id); ok && cached.UserID != userID {
+		c.videoListCache.delete(cached.UserID)
+	}
+	c.videoCache.delete(id)
+	c.videoListCache.delete(userID)
+}
+
+// SetVideoDownloadsEnabled turns downloads of the video by viewers on or
+// off.
+func (c Client) SetVideoDownloadsEnabled(video *Video, enabled bool) error {
+	err := c.db.QueryRow(`
+	UPDATE videos
+	SET downloads_enabled = ?, updated_at = ?
+	WHERE id = ?
+	RETURNING updated_at
+	`, enabled, formatTimestamp(now()), video.ID).Scan(&video.UpdatedAt)
+	c.invalidateVideo(video.ID, video.UserID)
+	if err != nil {
+		return err
+	}
+	video.DownloadsEnabled = enabled
+	return nil
+}
+
+// SetVideoPublishedAt backdates when the video was published, e.g. to when
+// it was first published on another platform it was imported from.
+func (c Client) SetVideoPublishedAt(video *Video, publishedAt time.Time) error {
+	err := c.db.QueryRow(`
+	UPDATE videos
+	SET published_at = ?, updated_at = ?
+	WHERE id = ?
+	RETURNING published_at, updated_at
+	`, formatTimestamp(publishedAt), formatTimestamp(now()), video.ID).Scan(&video.PublishedAt, &video.UpdatedAt)
+	c.invalidateVideo(video.ID, video.UserID)
 	return err
 }
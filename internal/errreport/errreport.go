@@ -0,0 +1,154 @@
+// Package errreport sends errors to an error tracker.
+package errreport
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+type Level string
+
+const (
+	LevelError Level = "error"
+	LevelFatal Level = "fatal"
+)
+
+type Event struct {
+	Level   Level
+	Message string
+	Err     error
+	// Stack is set for panics.
+	Stack     []byte
+	RequestID string
+	Method    string
+	URL       string
+	// Tags are indexed by the tracker for searching, Extra is only shown.
+	Tags  map[string]string
+	Extra map[string]string
+}
+
+// Reporter delivers events to an error tracker.
+type Reporter interface {
+	Report(ctx context.Context, event Event) error
+}
+
+var httpClient = &http.Client{Timeout: 10 * time.Second}
+
+// Sentry reports to a Sentry project through its store endpoint.
+type Sentry struct {
+	storeURL  string
+	publicKey string
+	// Release and Environment are attached to every event.
+	Release     string
+	Environment string
+}
+
+// NewSentry parses a DSN like https://<key>@o0.ingest.sentry.io/<project>.
+func NewSentry(dsn string) (*Sentry, error) {
+	u, err := url.Parse(dsn)
+	if err != nil {
+		return nil, err
+	}
+	project := strings.Trim(u.Path, "/")
+	if u.User == nil || u.User.Username() == "" || project == "" || u.Host == "" {
+		return nil, errors.New("DSN must look like https://<key>@<host>/<project>")
+	}
+	return &Sentry{
+		storeURL:  fmt.Sprintf("%s://%s/api/%s/store/", u.Scheme, u.Host, project),
+		publicKey: u.User.Username(),
+	}, nil
+}
+
+type sentryException struct {
+	Type  string `json:"type"`
+	Value string `json:"value"`
+}
+
+type sentryEvent struct {
+	EventID     string            `json:"event_id"`
+	Timestamp   string            `json:"timestamp"`
+	Level       Level             `json:"level"`
+	Platform    string            `json:"platform"`
+	Logger      string            `json:"logger"`
+	Release     string            `json:"release,omitempty"`
+	Environment string            `json:"environment,omitempty"`
+	Message     string            `json:"message,omitempty"`
+	Exception   []sentryException `json:"exception,omitempty"`
+	Tags        map[string]string `json:"tags,omitempty"`
+	Extra       map[string]string `json:"extra,omitempty"`
+	Request     *sentryRequest    `json:"request,omitempty"`
+}
+
+type sentryRequest struct {
+	Method string `json:"method"`
+	URL    string `json:"url"`
+}
+
+func (s *Sentry) Report(ctx context.Context, event Event) error {
+	id := make([]byte, 16)
+	rand.Read(id)
+
+	payload := sentryEvent{
+		EventID:     hex.EncodeToString(id),
+		Timestamp:   time.Now().UTC().Format(time.RFC3339),
+		Level:       event.Level,
+		Platform:    "go",
+		Logger:      "tubely",
+		Release:     s.Release,
+		Environment: s.Environment,
+		Message:     event.Message,
+		Tags:        map[string]string{},
+		Extra:       map[string]string{},
+	}
+	if payload.Level == "" {
+		payload.Level = LevelError
+	}
+	if event.Err != nil {
+		payload.Exception = []sentryException{{Type: fmt.Sprintf("%T", event.Err), Value: event.Err.Error()}}
+	}
+	for k, v := range event.Tags {
+		payload.Tags[k] = v
+	}
+	for k, v := range event.Extra {
+		payload.Extra[k] = v
+	}
+	if event.RequestID != "" {
+		payload.Tags["request_id"] = event.RequestID
+	}
+	if len(event.Stack) > 0 {
+		payload.Extra["stack"] = string(event.Stack)
+	}
+	if event.Method != "" {
+		payload.Request = &sentryRequest{Method: event.Method, URL: event.URL}
+	}
+
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.storeURL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Sentry-Auth", fmt.Sprintf("Sentry sentry_version=7, sentry_client=tubely/1.0, sentry_key=%s", s.publicKey))
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode > 299 {
+		return fmt.Errorf("sentry responded with status %d", resp.StatusCode)
+	}
+	return nil
+}
@@ -0,0 +1,98 @@
+// Package i18n translates user-facing messages. Messages are identified by
+// their English text, gettext style, so untranslated strings still read
+// fine, and each carries a stable code clients can match on instead.
+package i18n
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// DefaultLanguage is the language messages are written in.
+const DefaultLanguage = "en"
+
+type Message struct {
+	Code string
+	// Translations maps language to text. The English text is the key the
+	// message is registered under.
+	Translations map[string]string
+}
+
+type Catalog struct {
+	languages []string
+	messages  map[string]Message
+}
+
+// NewCatalog creates a catalog for the given languages in addition to
+// DefaultLanguage. It panics if a message lacks one of them, so a missing
+// translation is caught at startup rather than shown as English.
+func NewCatalog(languages []string, messages map[string]Message) *Catalog {
+	for text, msg := range messages {
+		for _, lang := range languages {
+			if msg.Translations[lang] == "" {
+				panic(fmt.Sprintf("i18n: %q has no %s translation", text, lang))
+			}
+		}
+	}
+	return &Catalog{
+		languages: append([]string{DefaultLanguage}, languages...),
+		messages:  messages,
+	}
+}
+
+// Translate returns the code and localized text for an English message.
+// Messages that aren't in the catalog keep their text and have no code.
+func (c *Catalog) Translate(lang, text string) (code, translated string) {
+	msg, ok := c.messages[text]
+	if !ok {
+		return "", text
+	}
+	if t := msg.Translations[lang]; t != "" {
+		return msg.Code, t
+	}
+	return msg.Code, text
+}
+
+// Has reports whether text is in the catalog.
+func (c *Catalog) Has(text string) bool {
+	_, ok := c.messages[text]
+	return ok
+}
+
+// Negotiate picks the supported language the client prefers most from an
+// Accept-Language header, falling back to DefaultLanguage. Region subtags
+// are ignored, so "pt-BR" matches "pt".
+func (c *Catalog) Negotiate(acceptLanguage string) string {
+	type candidate struct {
+		lang string
+		q    float64
+	}
+	candidates := []candidate{}
+	for _, part := range strings.Split(acceptLanguage, ",") {
+		tag, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		q := 1.0
+		if value, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			parsed, err := strconv.ParseFloat(value, 64)
+			if err != nil {
+				continue
+			}
+			q = parsed
+		}
+		primary, _, _ := strings.Cut(strings.ToLower(strings.TrimSpace(tag)), "-")
+		if q > 0 && primary != "" {
+			candidates = append(candidates, candidate{primary, q})
+		}
+	}
+	sort.SliceStable(candidates, func(i, j int) bool { return candidates[i].q > candidates[j].q })
+
+	for _, cand := range candidates {
+		for _, lang := range c.languages {
+			if cand.lang == lang {
+				return lang
+			}
+		}
+	}
+	return DefaultLanguage
+}
@@ -0,0 +1,186 @@
+package inbound
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/mail"
+	"net/textproto"
+	"regexp"
+	"strings"
+)
+
+// maxTextSize bounds how much of an email's text is searched for links.
+const maxTextSize = 1 << 20
+
+var linkPattern = regexp.MustCompile(`https://[^\s<>"']+`)
+
+// SESNotification is what SES publishes to SNS for a received email. With an
+// S3 receipt action the email is in the bucket, with an SNS action it's the
+// Content, which SNS limits to 150KB.
+type SESNotification struct {
+	NotificationType string `json:"notificationType"`
+	Mail             struct {
+		MessageID     string `json:"messageId"`
+		Source        string `json:"source"`
+		CommonHeaders struct {
+			From    []string `json:"from"`
+			Subject string   `json:"subject"`
+		} `json:"commonHeaders"`
+	} `json:"mail"`
+	Receipt struct {
+		SPFVerdict   Verdict `json:"spfVerdict"`
+		DKIMVerdict  Verdict `json:"dkimVerdict"`
+		DMARCVerdict Verdict `json:"dmarcVerdict"`
+		VirusVerdict Verdict `json:"virusVerdict"`
+		Action       struct {
+			Type       string `json:"type"`
+			BucketName string `json:"bucketName"`
+			ObjectKey  string `json:"objectKey"`
+			Encoding   string `json:"encoding"`
+		} `json:"action"`
+	} `json:"receipt"`
+	Content string `json:"content"`
+}
+
+type Verdict struct {
+	Status string `json:"status"`
+}
+
+const verdictPass = "PASS"
+
+// Sender returns the From address if SES authenticated it: the email has to
+// pass DMARC, or SPF for an envelope sender on the same domain, and must
+// not carry a virus.
+func (n SESNotification) Sender() (string, error) {
+	if len(n.Mail.CommonHeaders.From) != 1 {
+		return "", errors.New("email doesn't have a single sender")
+	}
+	from, err := mail.ParseAddress(n.Mail.CommonHeaders.From[0])
+	if err != nil {
+		return "", err
+	}
+	if n.Receipt.VirusVerdict.Status == "FAIL" {
+		return "", errors.New("email failed the virus scan")
+	}
+	if n.Receipt.DMARCVerdict.Status == verdictPass {
+		return from.Address, nil
+	}
+	if n.Receipt.SPFVerdict.Status == verdictPass && strings.EqualFold(domain(n.Mail.Source), domain(from.Address)) {
+		return from.Address, nil
+	}
+	return "", fmt.Errorf("couldn't authenticate sender %s", from.Address)
+}
+
+func domain(address string) string {
+	_, d, _ := strings.Cut(address, "@")
+	return d
+}
+
+// RawContent returns the email carried by an SNS receipt action.
+func (n SESNotification) RawContent() (io.Reader, error) {
+	if n.Content == "" {
+		return nil, errors.New("notification doesn't carry the email")
+	}
+	if n.Receipt.Action.Encoding == "BASE64" {
+		return base64.NewDecoder(base64.StdEncoding, strings.NewReader(n.Content)), nil
+	}
+	return strings.NewReader(n.Content), nil
+}
+
+// Email is what's read from a received email besides its attachments.
+type Email struct {
+	Subject string
+	// Links are the https URLs in the email's text, in order and without
+	// duplicates.
+	Links []string
+}
+
+// AttachmentFunc receives an attachment's decoded content while the email
+// is parsed.
+type AttachmentFunc func(filename, contentType string, r io.Reader) error
+
+// ParseEmail reads a raw email, passing every attachment to attachment.
+func ParseEmail(r io.Reader, attachment AttachmentFunc) (Email, error) {
+	msg, err := mail.ReadMessage(r)
+	if err != nil {
+		return Email{}, err
+	}
+	email := Email{Subject: decodeHeader(msg.Header.Get("Subject"))}
+	seen := map[string]bool{}
+	err = walkPart(textproto.MIMEHeader(msg.Header), msg.Body, func(text string) {
+		for _, link := range linkPattern.FindAllString(text, -1) {
+			link = strings.TrimRight(link, ".,;:!?)]")
+			if !seen[link] {
+				seen[link] = true
+				email.Links = append(email.Links, link)
+			}
+		}
+	}, attachment)
+	return email, err
+}
+
+func walkPart(header textproto.MIMEHeader, body io.Reader, text func(string), attachment AttachmentFunc) error {
+	mediaType, params, err := mime.ParseMediaType(header.Get("Content-Type"))
+	if err != nil {
+		mediaType = "text/plain"
+	}
+	body = decodeBody(header.Get("Content-Transfer-Encoding"), body)
+
+	if strings.HasPrefix(mediaType, "multipart/") {
+		reader := multipart.NewReader(body, params["boundary"])
+		for {
+			part, err := reader.NextRawPart()
+			if errors.Is(err, io.EOF) {
+				return nil
+			}
+			if err != nil {
+				return err
+			}
+			if err := walkPart(part.Header, part, text, attachment); err != nil {
+				return err
+			}
+		}
+	}
+
+	disposition, dispositionParams, _ := mime.ParseMediaType(header.Get("Content-Disposition"))
+	filename := dispositionParams["filename"]
+	if filename == "" {
+		filename = params["name"]
+	}
+	if disposition == "attachment" || filename != "" {
+		return attachment(decodeHeader(filename), mediaType, body)
+	}
+	if mediaType == "text/plain" {
+		data, err := io.ReadAll(io.LimitReader(body, maxTextSize))
+		if err != nil {
+			return err
+		}
+		text(string(data))
+	}
+	return nil
+}
+
+func decodeBody(encoding string, body io.Reader) io.Reader {
+	switch strings.ToLower(strings.TrimSpace(encoding)) {
+	case "base64":
+		return base64.NewDecoder(base64.StdEncoding, body)
+	case "quoted-printable":
+		return quotedprintable.NewReader(body)
+	}
+	return body
+}
+
+// decodeHeader decodes RFC 2047 encoded words, keeping the header as is if
+// they're malformed.
+func decodeHeader(s string) string {
+	decoded, err := new(mime.WordDecoder).DecodeHeader(s)
+	if err != nil {
+		return s
+	}
+	return decoded
+}
@@ -0,0 +1,194 @@
+// Package inbound receives email through Amazon SES, which publishes every
+// received message to an SNS topic that posts it to the app.
+package inbound
+
+import (
+	"context"
+	"crypto"
+	"crypto/rsa"
+	_ "crypto/sha1"
+	_ "crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+)
+
+// SNS message types posted to HTTP subscriptions.
+const (
+	TypeSubscriptionConfirmation = "SubscriptionConfirmation"
+	TypeNotification             = "Notification"
+	TypeUnsubscribeConfirmation  = "UnsubscribeConfirmation"
+)
+
+var ErrInvalidSignature = errors.New("invalid SNS signature")
+
+// snsHost matches the hosts SNS serves signing certificates and
+// subscription URLs from, so a forged message can't point at its own.
+var snsHost = regexp.MustCompile(`^sns\.[a-z0-9-]+\.amazonaws\.com(\.cn)?$`)
+
+// SNSMessage is a message SNS posts to an HTTP subscription.
+type SNSMessage struct {
+	Type             string `json:"Type"`
+	MessageID        string `json:"MessageId"`
+	Token            string `json:"Token"`
+	TopicARN         string `json:"TopicArn"`
+	Subject          string `json:"Subject"`
+	Message          string `json:"Message"`
+	Timestamp        string `json:"Timestamp"`
+	SignatureVersion string `json:"SignatureVersion"`
+	Signature        string `json:"Signature"`
+	SigningCertURL   string `json:"SigningCertURL"`
+	SubscribeURL     string `json:"SubscribeURL"`
+}
+
+// SNS verifies messages posted by a single SNS topic.
+type SNS struct {
+	topicARN   string
+	httpClient *http.Client
+
+	mu    sync.Mutex
+	certs map[string]*x509.Certificate
+}
+
+func NewSNS(topicARN string) *SNS {
+	return &SNS{
+		topicARN:   topicARN,
+		httpClient: &http.Client{Timeout: 15 * time.Second},
+		certs:      map[string]*x509.Certificate{},
+	}
+}
+
+// Parse decodes a message posted by SNS and checks it was signed by SNS for
+// the configured topic.
+func (s *SNS) Parse(ctx context.Context, body []byte) (SNSMessage, error) {
+	var msg SNSMessage
+	if err := json.Unmarshal(body, &msg); err != nil {
+		return SNSMessage{}, err
+	}
+	if msg.TopicARN != s.topicARN {
+		return SNSMessage{}, fmt.Errorf("message is from topic %q", msg.TopicARN)
+	}
+
+	var hash crypto.Hash
+	switch msg.SignatureVersion {
+	case "1":
+		hash = crypto.SHA1
+	case "2":
+		hash = crypto.SHA256
+	default:
+		return SNSMessage{}, ErrInvalidSignature
+	}
+	signature, err := base64.StdEncoding.DecodeString(msg.Signature)
+	if err != nil {
+		return SNSMessage{}, ErrInvalidSignature
+	}
+	cert, err := s.certificate(ctx, msg.SigningCertURL)
+	if err != nil {
+		return SNSMessage{}, err
+	}
+	key, ok := cert.PublicKey.(*rsa.PublicKey)
+	if !ok {
+		return SNSMessage{}, ErrInvalidSignature
+	}
+
+	h := hash.New()
+	h.Write([]byte(msg.stringToSign()))
+	if err := rsa.VerifyPKCS1v15(key, hash, h.Sum(nil), signature); err != nil {
+		return SNSMessage{}, ErrInvalidSignature
+	}
+	return msg, nil
+}
+
+// stringToSign lists the message's signed fields as SNS documents them:
+// each name and value on their own line, in alphabetical order.
+func (m SNSMessage) stringToSign() string {
+	var fields [][2]string
+	if m.Type == TypeNotification {
+		fields = [][2]string{{"Message", m.Message}, {"MessageId", m.MessageID}, {"Subject", m.Subject},
+			{"Timestamp", m.Timestamp}, {"TopicArn", m.TopicARN}, {"Type", m.Type}}
+	} else {
+		fields = [][2]string{{"Message", m.Message}, {"MessageId", m.MessageID}, {"SubscribeURL", m.SubscribeURL},
+			{"Timestamp", m.Timestamp}, {"Token", m.Token}, {"TopicArn", m.TopicARN}, {"Type", m.Type}}
+	}
+
+	var b strings.Builder
+	for _, field := range fields {
+		// Only the subject is left out when it's empty.
+		if field[0] == "Subject" && field[1] == "" {
+			continue
+		}
+		b.WriteString(field[0] + "\n" + field[1] + "\n")
+	}
+	return b.String()
+}
+
+// certificate fetches the certificate at certURL, which has to be served by
+// SNS, and caches it since SNS signs with the same one for a long time.
+func (s *SNS) certificate(ctx context.Context, certURL string) (*x509.Certificate, error) {
+	u, err := url.Parse(certURL)
+	if err != nil || u.Scheme != "https" || !snsHost.MatchString(u.Host) || !strings.HasSuffix(u.Path, ".pem") {
+		return nil, ErrInvalidSignature
+	}
+
+	s.mu.Lock()
+	cert, ok := s.certs[certURL]
+	s.mu.Unlock()
+	if ok {
+		return cert, nil
+	}
+
+	data, err := s.get(ctx, certURL)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't fetch signing certificate: %w", err)
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("signing certificate isn't PEM encoded")
+	}
+	cert, err = x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	s.certs[certURL] = cert
+	s.mu.Unlock()
+	return cert, nil
+}
+
+// Confirm confirms the subscription of a SubscriptionConfirmation message,
+// after which SNS starts posting notifications.
+func (s *SNS) Confirm(ctx context.Context, msg SNSMessage) error {
+	u, err := url.Parse(msg.SubscribeURL)
+	if err != nil || u.Scheme != "https" || !snsHost.MatchString(u.Host) {
+		return fmt.Errorf("unexpected subscribe URL %q", msg.SubscribeURL)
+	}
+	_, err = s.get(ctx, msg.SubscribeURL)
+	return err
+}
+
+func (s *SNS) get(ctx context.Context, rawURL string) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, rawURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := s.httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%s responded with %s", req.URL.Host, resp.Status)
+	}
+	return io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+}
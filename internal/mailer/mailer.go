@@ -0,0 +1,56 @@
+package mailer
+
+import (
+	"fmt"
+	"log"
+	"net/smtp"
+	"strings"
+)
+
+type Client struct {
+	host     string
+	port     string
+	username string
+	password string
+	from     string
+}
+
+func NewClient(host, port, username, password, from string) Client {
+	return Client{
+		host:     host,
+		port:     port,
+		username: username,
+		password: password,
+		from:     from,
+	}
+}
+
+// Send delivers a plain text email. When no SMTP host is configured the
+// message is written to the log instead, which keeps local development
+// working without a mail server.
+func (c Client) Send(to, subject, body string) error {
+	if c.host == "" {
+		log.Printf("mailer: no SMTP host configured, would send to %s: %s\n%s", to, subject, body)
+		return nil
+	}
+
+	msg := strings.Join([]string{
+		"From: " + c.from,
+		"To: " + to,
+		"Subject: " + subject,
+		"MIME-Version: 1.0",
+		"Content-Type: text/plain; charset=\"utf-8\"",
+		"",
+		body,
+	}, "\r\n")
+
+	var auth smtp.Auth
+	if c.username != "" {
+		auth = smtp.PlainAuth("", c.username, c.password, c.host)
+	}
+	addr := fmt.Sprintf("%s:%s", c.host, c.port)
+	if err := smtp.SendMail(addr, auth, c.from, []string{to}, []byte(msg)); err != nil {
+		return fmt.Errorf("couldn't send email: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,118 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"text/template"
+)
+
+// HTTPAction sends a request built from Go templates over the Message, for
+// integrations without a channel of their own. The URL, header values and
+// body are templates; besides the builtins they can use json, which
+// encodes a value as JSON for building request bodies, e.g.
+//
+//	{"video": {{json .Data.video_id}}, "event": {{json .Event}}}
+type HTTPAction struct {
+	Method  string
+	URL     *template.Template
+	Headers map[string]*template.Template
+	Body    *template.Template
+}
+
+var templateFuncs = template.FuncMap{
+	"json": func(v any) (string, error) {
+		data, err := json.Marshal(v)
+		return string(data), err
+	},
+}
+
+// ParseHTTPAction parses the templates of an action.
+func ParseHTTPAction(method, rawURL string, headers map[string]string, body string) (HTTPAction, error) {
+	action := HTTPAction{Method: method, Headers: map[string]*template.Template{}}
+	var err error
+	action.URL, err = parseTemplate("url", rawURL)
+	if err != nil {
+		return HTTPAction{}, err
+	}
+	for name, value := range headers {
+		action.Headers[name], err = parseTemplate("header "+name, value)
+		if err != nil {
+			return HTTPAction{}, err
+		}
+	}
+	action.Body, err = parseTemplate("body", body)
+	if err != nil {
+		return HTTPAction{}, err
+	}
+	return action, nil
+}
+
+func parseTemplate(name, text string) (*template.Template, error) {
+	return template.New(name).Funcs(templateFuncs).Parse(text)
+}
+
+func render(t *template.Template, msg Message) (string, error) {
+	var b strings.Builder
+	if err := t.Execute(&b, msg); err != nil {
+		return "", err
+	}
+	return b.String(), nil
+}
+
+// Request renders the action's request for msg without sending it.
+func (a HTTPAction) Request(ctx context.Context, msg Message) (*http.Request, error) {
+	rawURL, err := render(a.URL, msg)
+	if err != nil {
+		return nil, err
+	}
+	u, err := url.Parse(strings.TrimSpace(rawURL))
+	if err != nil || (u.Scheme != "https" && u.Scheme != "http") || u.Host == "" {
+		return nil, fmt.Errorf("url template rendered %q, which isn't an http URL", rawURL)
+	}
+	body, err := render(a.Body, msg)
+	if err != nil {
+		return nil, err
+	}
+
+	var reader io.Reader
+	if body != "" {
+		reader = bytes.NewReader([]byte(body))
+	}
+	req, err := http.NewRequestWithContext(ctx, a.Method, u.String(), reader)
+	if err != nil {
+		return nil, err
+	}
+	if body != "" {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	for name, t := range a.Headers {
+		value, err := render(t, msg)
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set(name, value)
+	}
+	return req, nil
+}
+
+func (a HTTPAction) Notify(ctx context.Context, msg Message) error {
+	req, err := a.Request(ctx, msg)
+	if err != nil {
+		return err
+	}
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode > 299 {
+		return fmt.Errorf("action responded with status %d", resp.StatusCode)
+	}
+	return nil
+}
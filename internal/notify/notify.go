@@ -0,0 +1,99 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/mailer"
+)
+
+type Event string
+
+const (
+	EventProcessingFailed Event = "processing_failed"
+	EventModerationReport Event = "moderation_report"
+	EventQuotaBreach      Event = "quota_breach"
+	EventAbuseDetected    Event = "abuse_detected"
+
+	// Video lifecycle events are mostly of use to HTTP actions.
+	EventVideoCreated Event = "video_created"
+	EventVideoReady   Event = "video_ready"
+	EventVideoDeleted Event = "video_deleted"
+)
+
+var Events = []Event{
+	EventProcessingFailed, EventModerationReport, EventQuotaBreach, EventAbuseDetected,
+	EventVideoCreated, EventVideoReady, EventVideoDeleted,
+}
+
+type Message struct {
+	Event Event
+	Title string
+	Text  string
+	Time  time.Time
+	// Data holds the event's details, like the video_id and user_id, for
+	// HTTP action templates.
+	Data map[string]any
+}
+
+// Notifier delivers operational messages to a channel admins are watching.
+type Notifier interface {
+	Notify(ctx context.Context, msg Message) error
+}
+
+var httpClient = &http.Client{Timeout: 10 * time.Second}
+
+type Slack struct {
+	WebhookURL string
+}
+
+func (s Slack) Notify(ctx context.Context, msg Message) error {
+	return postJSON(ctx, s.WebhookURL, map[string]string{
+		"text": fmt.Sprintf("*%s*\n%s", msg.Title, msg.Text),
+	})
+}
+
+type Discord struct {
+	WebhookURL string
+}
+
+func (d Discord) Notify(ctx context.Context, msg Message) error {
+	return postJSON(ctx, d.WebhookURL, map[string]string{
+		"content": fmt.Sprintf("**%s**\n%s", msg.Title, msg.Text),
+	})
+}
+
+type Email struct {
+	Mailer mailer.Client
+	To     string
+}
+
+func (e Email) Notify(ctx context.Context, msg Message) error {
+	return e.Mailer.Send(e.To, "[Tubely] "+msg.Title, msg.Text)
+}
+
+func postJSON(ctx context.Context, url string, payload any) error {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode > 299 {
+		return fmt.Errorf("webhook responded with status %d", resp.StatusCode)
+	}
+	return nil
+}
@@ -0,0 +1,497 @@
+// Package qrcode encodes data as QR codes, in byte mode, using the smallest
+// version that fits. The encoding follows ISO/IEC 18004.
+package qrcode
+
+import (
+	"errors"
+	"image"
+	"image/color"
+)
+
+// ErrTooLong is returned when the data doesn't fit in the largest QR code
+// at the requested error correction level.
+var ErrTooLong = errors.New("data is too long for a QR code")
+
+// Level is how much of a code can be damaged or covered and still scan.
+type Level int
+
+const (
+	Low      Level = iota // about 7%
+	Medium                // about 15%
+	Quartile              // about 25%
+	High                  // about 30%
+)
+
+// ParseLevel parses the usual one letter names, L, M, Q and H.
+func ParseLevel(s string) (Level, bool) {
+	switch s {
+	case "L", "l":
+		return Low, true
+	case "M", "m":
+		return Medium, true
+	case "Q", "q":
+		return Quartile, true
+	case "H", "h":
+		return High, true
+	}
+	return 0, false
+}
+
+// formatBits is the level's value in the format information, which isn't
+// in the same order as the levels.
+func (l Level) formatBits() int {
+	return [...]int{1, 0, 3, 2}[l]
+}
+
+// eccCodewordsPerBlock and eccBlocks are indexed by level and version.
+var eccCodewordsPerBlock = [4][41]int{
+	{-1, 7, 10, 15, 20, 26, 18, 20, 24, 30, 18, 20, 24, 26, 30, 22, 24, 28, 30, 28, 28, 28, 28, 30, 30, 26, 28, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30},
+	{-1, 10, 16, 26, 18, 24, 16, 18, 22, 22, 26, 30, 22, 22, 24, 24, 28, 28, 26, 26, 26, 26, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28},
+	{-1, 13, 22, 18, 26, 18, 24, 18, 22, 20, 24, 28, 26, 24, 20, 30, 24, 28, 28, 26, 30, 28, 30, 30, 30, 30, 28, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30},
+	{-1, 17, 28, 22, 16, 22, 28, 26, 26, 24, 28, 24, 28, 22, 24, 24, 30, 28, 28, 26, 28, 30, 24, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30},
+}
+
+var eccBlocks = [4][41]int{
+	{-1, 1, 1, 1, 1, 1, 2, 2, 2, 2, 4, 4, 4, 4, 4, 6, 6, 6, 6, 7, 8, 8, 9, 9, 10, 12, 12, 12, 13, 14, 15, 16, 17, 18, 19, 19, 20, 21, 22, 24, 25},
+	{-1, 1, 1, 1, 2, 2, 4, 4, 4, 5, 5, 5, 8, 9, 9, 10, 10, 11, 13, 14, 16, 17, 17, 18, 20, 21, 23, 25, 26, 28, 29, 31, 33, 35, 37, 38, 40, 43, 45, 47, 49},
+	{-1, 1, 1, 2, 2, 4, 4, 6, 6, 8, 8, 8, 10, 12, 16, 12, 17, 16, 18, 21, 20, 23, 23, 25, 27, 29, 34, 34, 35, 38, 40, 43, 45, 48, 51, 53, 56, 59, 62, 65, 68},
+	{-1, 1, 1, 2, 4, 4, 4, 5, 6, 8, 8, 11, 11, 16, 16, 18, 16, 19, 21, 25, 25, 25, 34, 30, 32, 35, 37, 40, 42, 45, 48, 51, 54, 57, 60, 63, 66, 70, 74, 77, 81},
+}
+
+// Code is an encoded QR code.
+type Code struct {
+	// Size is the width and height in modules, without a quiet zone.
+	Size    int
+	version int
+	level   Level
+	dark    [][]bool
+	// function marks modules that aren't data, which masks leave alone.
+	function [][]bool
+}
+
+// Dark reports whether the module at x, y is dark.
+func (c *Code) Dark(x, y int) bool {
+	return c.dark[y][x]
+}
+
+// Encode encodes data at the level, using the smallest version it fits in.
+func Encode(data []byte, level Level) (*Code, error) {
+	version := 0
+	for v := 1; v <= 40; v++ {
+		countBits := 8
+		if v > 9 {
+			countBits = 16
+		}
+		if len(data) < 1<<countBits && 4+countBits+8*len(data) <= dataCodewords(v, level)*8 {
+			version = v
+			break
+		}
+	}
+	if version == 0 {
+		return nil, ErrTooLong
+	}
+
+	var bits bitBuffer
+	bits.append(0b0100, 4)
+	if version > 9 {
+		bits.append(len(data), 16)
+	} else {
+		bits.append(len(data), 8)
+	}
+	for _, b := range data {
+		bits.append(int(b), 8)
+	}
+	capacity := dataCodewords(version, level) * 8
+	bits.append(0, min(4, capacity-len(bits)))
+	bits.append(0, (8-len(bits)%8)%8)
+	for pad := 0xEC; len(bits) < capacity; pad ^= 0xEC ^ 0x11 {
+		bits.append(pad, 8)
+	}
+
+	size := version*4 + 17
+	c := &Code{Size: size, version: version, level: level}
+	c.dark = make([][]bool, size)
+	c.function = make([][]bool, size)
+	for i := range size {
+		c.dark[i] = make([]bool, size)
+		c.function[i] = make([]bool, size)
+	}
+	c.drawFunctionPatterns()
+	c.drawCodewords(c.addECCAndInterleave(bits.bytes()))
+
+	best, bestPenalty := 0, -1
+	for mask := range 8 {
+		c.applyMask(mask)
+		c.drawFormatBits(mask)
+		if penalty := c.penalty(); bestPenalty < 0 || penalty < bestPenalty {
+			best, bestPenalty = mask, penalty
+		}
+		c.applyMask(mask)
+	}
+	c.applyMask(best)
+	c.drawFormatBits(best)
+	return c, nil
+}
+
+// Image draws the code with the four module quiet zone scanners need, as
+// large as fits in size pixels but no smaller than a pixel per module.
+func (c *Code) Image(size int) *image.Paletted {
+	modules := c.Size + 8
+	scale := max(size/modules, 1)
+	img := image.NewPaletted(image.Rect(0, 0, modules*scale, modules*scale), color.Palette{color.White, color.Black})
+	for y := range c.Size {
+		for x := range c.Size {
+			if !c.dark[y][x] {
+				continue
+			}
+			for py := (y + 4) * scale; py < (y+5)*scale; py++ {
+				for px := (x + 4) * scale; px < (x+5)*scale; px++ {
+					img.SetColorIndex(px, py, 1)
+				}
+			}
+		}
+	}
+	return img
+}
+
+type bitBuffer []bool
+
+func (b *bitBuffer) append(value, n int) {
+	for i := n - 1; i >= 0; i-- {
+		*b = append(*b, value>>i&1 == 1)
+	}
+}
+
+func (b bitBuffer) bytes() []byte {
+	out := make([]byte, len(b)/8)
+	for i, bit := range b {
+		if bit {
+			out[i/8] |= 1 << (7 - i%8)
+		}
+	}
+	return out
+}
+
+// rawDataModules is how many modules of a version hold data and error
+// correction, after the function patterns and format and version
+// information.
+func rawDataModules(version int) int {
+	n := (16*version+128)*version + 64
+	if version >= 2 {
+		alignment := version/7 + 2
+		n -= (25*alignment-10)*alignment - 55
+		if version >= 7 {
+			n -= 36
+		}
+	}
+	return n
+}
+
+func dataCodewords(version int, level Level) int {
+	return rawDataModules(version)/8 - eccCodewordsPerBlock[level][version]*eccBlocks[level][version]
+}
+
+func alignmentPositions(version int) []int {
+	if version == 1 {
+		return nil
+	}
+	count := version/7 + 2
+	step := (version*8 + count*3 + 5) / (count*4 - 4) * 2
+	positions := make([]int, count)
+	positions[0] = 6
+	for i, pos := count-1, version*4+17-7; i >= 1; i, pos = i-1, pos-step {
+		positions[i] = pos
+	}
+	return positions
+}
+
+func (c *Code) setFunction(x, y int, dark bool) {
+	c.dark[y][x] = dark
+	c.function[y][x] = true
+}
+
+func (c *Code) drawFunctionPatterns() {
+	for i := range c.Size {
+		c.setFunction(6, i, i%2 == 0)
+		c.setFunction(i, 6, i%2 == 0)
+	}
+
+	for _, center := range [][2]int{{3, 3}, {c.Size - 4, 3}, {3, c.Size - 4}} {
+		for dy := -4; dy <= 4; dy++ {
+			for dx := -4; dx <= 4; dx++ {
+				x, y := center[0]+dx, center[1]+dy
+				if x < 0 || x >= c.Size || y < 0 || y >= c.Size {
+					continue
+				}
+				dist := max(abs(dx), abs(dy))
+				c.setFunction(x, y, dist != 2 && dist != 4)
+			}
+		}
+	}
+
+	positions := alignmentPositions(c.version)
+	last := len(positions) - 1
+	for i, x := range positions {
+		for j, y := range positions {
+			// The finder patterns are already there.
+			if i == 0 && j == 0 || i == 0 && j == last || i == last && j == 0 {
+				continue
+			}
+			for dy := -2; dy <= 2; dy++ {
+				for dx := -2; dx <= 2; dx++ {
+					c.setFunction(x+dx, y+dy, max(abs(dx), abs(dy)) != 1)
+				}
+			}
+		}
+	}
+
+	// Reserve the format information until a mask is picked.
+	c.drawFormatBits(0)
+	c.drawVersion()
+}
+
+func (c *Code) drawFormatBits(mask int) {
+	data := c.level.formatBits()<<3 | mask
+	rem := data
+	for range 10 {
+		rem = rem<<1 ^ (rem>>9)*0x537
+	}
+	bits := (data<<10 | rem) ^ 0x5412
+	bit := func(i int) bool { return bits>>i&1 == 1 }
+
+	for i := range 6 {
+		c.setFunction(8, i, bit(i))
+	}
+	c.setFunction(8, 7, bit(6))
+	c.setFunction(8, 8, bit(7))
+	c.setFunction(7, 8, bit(8))
+	for i := 9; i < 15; i++ {
+		c.setFunction(14-i, 8, bit(i))
+	}
+
+	for i := range 8 {
+		c.setFunction(c.Size-1-i, 8, bit(i))
+	}
+	for i := 8; i < 15; i++ {
+		c.setFunction(8, c.Size-15+i, bit(i))
+	}
+	c.setFunction(8, c.Size-8, true)
+}
+
+func (c *Code) drawVersion() {
+	if c.version < 7 {
+		return
+	}
+	rem := c.version
+	for range 12 {
+		rem = rem<<1 ^ (rem>>11)*0x1F25
+	}
+	bits := c.version<<12 | rem
+	for i := range 18 {
+		dark := bits>>i&1 == 1
+		a, b := c.Size-11+i%3, i/3
+		c.setFunction(a, b, dark)
+		c.setFunction(b, a, dark)
+	}
+}
+
+// addECCAndInterleave splits data into the version's blocks, appends each
+// block's error correction, and interleaves them the way they're placed.
+func (c *Code) addECCAndInterleave(data []byte) []byte {
+	numBlocks := eccBlocks[c.level][c.version]
+	eccLen := eccCodewordsPerBlock[c.level][c.version]
+	rawCodewords := rawDataModules(c.version) / 8
+	numShortBlocks := numBlocks - rawCodewords%numBlocks
+	shortBlockLen := rawCodewords / numBlocks
+
+	divisor := reedSolomonDivisor(eccLen)
+	blocks := make([][]byte, numBlocks)
+	k := 0
+	for i := range blocks {
+		n := shortBlockLen - eccLen
+		if i >= numShortBlocks {
+			n++
+		}
+		block := append([]byte{}, data[k:k+n]...)
+		k += n
+		ecc := reedSolomonRemainder(block, divisor)
+		if i < numShortBlocks {
+			// A placeholder keeps the blocks the same length, and is
+			// skipped when interleaving.
+			block = append(block, 0)
+		}
+		blocks[i] = append(block, ecc...)
+	}
+
+	result := make([]byte, 0, rawCodewords)
+	for i := range blocks[0] {
+		for j, block := range blocks {
+			if i != shortBlockLen-eccLen || j >= numShortBlocks {
+				result = append(result, block[i])
+			}
+		}
+	}
+	return result
+}
+
+// drawCodewords places data in the zigzag of two module wide columns, from
+// the bottom right corner, skipping function modules.
+func (c *Code) drawCodewords(data []byte) {
+	i := 0
+	for right := c.Size - 1; right >= 1; right -= 2 {
+		if right == 6 {
+			right = 5
+		}
+		for vert := range c.Size {
+			for j := range 2 {
+				x := right - j
+				y := vert
+				if (right+1)&2 == 0 {
+					y = c.Size - 1 - vert
+				}
+				if !c.function[y][x] && i < len(data)*8 {
+					c.dark[y][x] = data[i>>3]>>(7-i&7)&1 == 1
+					i++
+				}
+			}
+		}
+	}
+}
+
+// applyMask flips the data modules the mask selects. Applying it twice
+// undoes it.
+func (c *Code) applyMask(mask int) {
+	for y := range c.Size {
+		for x := range c.Size {
+			var flip bool
+			switch mask {
+			case 0:
+				flip = (x+y)%2 == 0
+			case 1:
+				flip = y%2 == 0
+			case 2:
+				flip = x%3 == 0
+			case 3:
+				flip = (x+y)%3 == 0
+			case 4:
+				flip = (x/3+y/2)%2 == 0
+			case 5:
+				flip = x*y%2+x*y%3 == 0
+			case 6:
+				flip = (x*y%2+x*y%3)%2 == 0
+			case 7:
+				flip = ((x+y)%2+x*y%3)%2 == 0
+			}
+			if flip && !c.function[y][x] {
+				c.dark[y][x] = !c.dark[y][x]
+			}
+		}
+	}
+}
+
+// penalty scores how hard the code is to scan, to pick the mask with the
+// lowest.
+func (c *Code) penalty() int {
+	at := func(x, y int, transposed bool) bool {
+		if transposed {
+			return c.dark[x][y]
+		}
+		return c.dark[y][x]
+	}
+
+	penalty := 0
+	finderLike := [2][11]bool{
+		{true, false, true, true, true, false, true, false, false, false, false},
+		{false, false, false, false, true, false, true, true, true, false, true},
+	}
+	for _, transposed := range []bool{false, true} {
+		for y := range c.Size {
+			run := 1
+			for x := 1; x <= c.Size; x++ {
+				if x < c.Size && at(x, y, transposed) == at(x-1, y, transposed) {
+					run++
+					continue
+				}
+				if run >= 5 {
+					penalty += run - 2
+				}
+				run = 1
+			}
+			for x := 0; x+11 <= c.Size; x++ {
+				for _, pattern := range finderLike {
+					matches := true
+					for k, dark := range pattern {
+						if at(x+k, y, transposed) != dark {
+							matches = false
+							break
+						}
+					}
+					if matches {
+						penalty += 40
+					}
+				}
+			}
+		}
+	}
+
+	dark := 0
+	for y := range c.Size {
+		for x := range c.Size {
+			if c.dark[y][x] {
+				dark++
+			}
+			if x > 0 && y > 0 && c.dark[y][x] == c.dark[y][x-1] && c.dark[y][x] == c.dark[y-1][x] && c.dark[y][x] == c.dark[y-1][x-1] {
+				penalty += 3
+			}
+		}
+	}
+	total := c.Size * c.Size
+	penalty += ((abs(dark*20-total*10)+total-1)/total - 1) * 10
+	return penalty
+}
+
+func reedSolomonDivisor(degree int) []byte {
+	result := make([]byte, degree)
+	result[degree-1] = 1
+	root := byte(1)
+	for range degree {
+		for j := range result {
+			result[j] = gfMultiply(result[j], root)
+			if j+1 < degree {
+				result[j] ^= result[j+1]
+			}
+		}
+		root = gfMultiply(root, 0x02)
+	}
+	return result
+}
+
+func reedSolomonRemainder(data, divisor []byte) []byte {
+	result := make([]byte, len(divisor))
+	for _, b := range data {
+		factor := b ^ result[0]
+		copy(result, result[1:])
+		result[len(result)-1] = 0
+		for i, d := range divisor {
+			result[i] ^= gfMultiply(d, factor)
+		}
+	}
+	return result
+}
+
+// gfMultiply multiplies in GF(2^8) modulo x^8 + x^4 + x^3 + x^2 + 1.
+func gfMultiply(x, y byte) byte {
+	z := 0
+	for i := 7; i >= 0; i-- {
+		z = z<<1 ^ (z>>7)*0x11D
+		z ^= int(y>>i&1) * int(x)
+	}
+	return byte(z)
+}
+
+func abs(n int) int {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
@@ -0,0 +1,111 @@
+package s3local
+
+import (
+	"errors"
+	"io"
+	"io/fs"
+	"mime"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// Dir keeps each bucket in a subdirectory of root, so objects survive
+// restarts and can be inspected with normal tools. Content types aren't
+// stored and are guessed from the key's extension instead.
+type Dir struct {
+	root string
+}
+
+func NewDir(root string) *Dir {
+	return &Dir{root: root}
+}
+
+func (d *Dir) Get(bucket, key string) (io.ReadSeekCloser, Object, error) {
+	f, err := os.Open(d.path(bucket, key))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, Object{}, ErrNotFound
+	}
+	if err != nil {
+		return nil, Object{}, err
+	}
+	info, err := f.Stat()
+	if err != nil || info.IsDir() {
+		f.Close()
+		return nil, Object{}, ErrNotFound
+	}
+	return f, Object{
+		Key:          key,
+		Size:         info.Size(),
+		LastModified: info.ModTime(),
+		ContentType:  mime.TypeByExtension(path.Ext(key)),
+	}, nil
+}
+
+func (d *Dir) Put(bucket, key string, body io.Reader, contentType string) error {
+	dst := d.path(bucket, key)
+	if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+		return err
+	}
+	// Write next to the destination and rename so readers never see a
+	// partial object.
+	tmp, err := os.CreateTemp(filepath.Dir(dst), ".upload-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	_, err = io.Copy(tmp, body)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), dst)
+}
+
+func (d *Dir) Delete(bucket, key string) error {
+	err := os.Remove(d.path(bucket, key))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	return err
+}
+
+func (d *Dir) List(bucket, prefix string) ([]Object, error) {
+	bucketRoot := d.path(bucket, "")
+	objects := []Object{}
+	err := filepath.WalkDir(bucketRoot, func(p string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if entry.IsDir() || strings.HasPrefix(entry.Name(), ".upload-") {
+			return nil
+		}
+		rel, err := filepath.Rel(bucketRoot, p)
+		if err != nil {
+			return err
+		}
+		key := filepath.ToSlash(rel)
+		if !strings.HasPrefix(key, prefix) {
+			return nil
+		}
+		info, err := entry.Info()
+		if err != nil {
+			return err
+		}
+		objects = append(objects, Object{Key: key, Size: info.Size(), LastModified: info.ModTime()})
+		return nil
+	})
+	if errors.Is(err, fs.ErrNotExist) {
+		return objects, nil
+	}
+	return objects, err
+}
+
+// path keeps keys from escaping the bucket directory.
+func (d *Dir) path(bucket, key string) string {
+	return filepath.Join(d.root, bucket, filepath.FromSlash(filepath.Clean("/"+key)))
+}
@@ -0,0 +1,82 @@
+package s3local
+
+import (
+	"bytes"
+	"io"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Memory keeps objects in memory, so everything is gone on restart.
+type Memory struct {
+	mu      sync.RWMutex
+	objects map[string]map[string]memoryObject
+}
+
+type memoryObject struct {
+	data []byte
+	Object
+}
+
+func NewMemory() *Memory {
+	return &Memory{objects: map[string]map[string]memoryObject{}}
+}
+
+func (m *Memory) Get(bucket, key string) (io.ReadSeekCloser, Object, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	obj, ok := m.objects[bucket][key]
+	if !ok {
+		return nil, Object{}, ErrNotFound
+	}
+	// Stored data is never modified, only replaced, so readers can share it.
+	return nopCloser{bytes.NewReader(obj.data)}, obj.Object, nil
+}
+
+func (m *Memory) Put(bucket, key string, body io.Reader, contentType string) error {
+	data, err := io.ReadAll(body)
+	if err != nil {
+		return err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.objects[bucket] == nil {
+		m.objects[bucket] = map[string]memoryObject{}
+	}
+	m.objects[bucket][key] = memoryObject{
+		data: data,
+		Object: Object{
+			Key:          key,
+			Size:         int64(len(data)),
+			LastModified: time.Now(),
+			ContentType:  contentType,
+		},
+	}
+	return nil
+}
+
+func (m *Memory) Delete(bucket, key string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.objects[bucket], key)
+	return nil
+}
+
+func (m *Memory) List(bucket, prefix string) ([]Object, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	objects := []Object{}
+	for key, obj := range m.objects[bucket] {
+		if strings.HasPrefix(key, prefix) {
+			objects = append(objects, obj.Object)
+		}
+	}
+	return objects, nil
+}
+
+type nopCloser struct {
+	io.ReadSeeker
+}
+
+func (nopCloser) Close() error { return nil }
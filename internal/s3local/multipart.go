@@ -0,0 +1,191 @@
+package s3local
+
+import (
+	"crypto/md5"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// multipartPrefix is where parts are kept until the upload completes. Keys
+// under it are left out of listings.
+const multipartPrefix = ".multipart/"
+
+type multipartUpload struct {
+	bucket, key string
+	contentType string
+	parts       map[int]string
+}
+
+type initiateMultipartUploadResult struct {
+	XMLName  xml.Name `xml:"InitiateMultipartUploadResult"`
+	Bucket   string   `xml:"Bucket"`
+	Key      string   `xml:"Key"`
+	UploadID string   `xml:"UploadId"`
+}
+
+func (s *Server) createMultipartUpload(w http.ResponseWriter, r *http.Request, bucket, key string) {
+	b := make([]byte, 16)
+	rand.Read(b)
+	id := hex.EncodeToString(b)
+
+	s.mu.Lock()
+	s.uploads[id] = &multipartUpload{
+		bucket:      bucket,
+		key:         key,
+		contentType: r.Header.Get("Content-Type"),
+		parts:       map[int]string{},
+	}
+	s.mu.Unlock()
+	writeXML(w, http.StatusOK, initiateMultipartUploadResult{Bucket: bucket, Key: key, UploadID: id})
+}
+
+func (s *Server) upload(w http.ResponseWriter, id, bucket, key string) (*multipartUpload, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	upload, ok := s.uploads[id]
+	if !ok || upload.bucket != bucket || upload.key != key {
+		writeError(w, http.StatusNotFound, "NoSuchUpload", "The specified upload does not exist.")
+		return nil, false
+	}
+	return upload, true
+}
+
+func (s *Server) uploadPart(w http.ResponseWriter, r *http.Request, bucket, key string) {
+	id := r.URL.Query().Get("uploadId")
+	upload, ok := s.upload(w, id, bucket, key)
+	if !ok {
+		return
+	}
+	number, err := strconv.Atoi(r.URL.Query().Get("partNumber"))
+	if err != nil || number < 1 || number > 10000 {
+		writeError(w, http.StatusBadRequest, "InvalidArgument", "Part number must be an integer between 1 and 10000.")
+		return
+	}
+
+	var body io.Reader = r.Body
+	if strings.Contains(r.Header.Get("Content-Encoding"), "aws-chunked") ||
+		strings.HasPrefix(r.Header.Get("X-Amz-Content-Sha256"), "STREAMING-") {
+		body = newChunkedReader(r.Body)
+	}
+	hash := md5.New()
+	partKey := fmt.Sprintf("%s%s/%05d", multipartPrefix, id, number)
+	if err := s.backend.Put(bucket, partKey, io.TeeReader(body, hash), ""); err != nil {
+		writeError(w, http.StatusInternalServerError, "InternalError", err.Error())
+		return
+	}
+	etag := `"` + hex.EncodeToString(hash.Sum(nil)) + `"`
+
+	s.mu.Lock()
+	upload.parts[number] = etag
+	s.mu.Unlock()
+	w.Header().Set("ETag", etag)
+	w.WriteHeader(http.StatusOK)
+}
+
+type completeMultipartUpload struct {
+	Parts []struct {
+		PartNumber int    `xml:"PartNumber"`
+		ETag       string `xml:"ETag"`
+	} `xml:"Part"`
+}
+
+type completeMultipartUploadResult struct {
+	XMLName xml.Name `xml:"CompleteMultipartUploadResult"`
+	Bucket  string   `xml:"Bucket"`
+	Key     string   `xml:"Key"`
+	ETag    string   `xml:"ETag"`
+}
+
+// completeMultipartUpload joins the parts into the object. Its ETag is the
+// MD5 of the part MD5s followed by the part count, like S3's.
+func (s *Server) completeMultipartUpload(w http.ResponseWriter, r *http.Request, bucket, key string) {
+	id := r.URL.Query().Get("uploadId")
+	upload, ok := s.upload(w, id, bucket, key)
+	if !ok {
+		return
+	}
+	if !s.checkNoneMatch(w, r, bucket, key) {
+		return
+	}
+	var req completeMultipartUpload
+	if err := xml.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "MalformedXML", err.Error())
+		return
+	}
+	if len(req.Parts) == 0 {
+		writeError(w, http.StatusBadRequest, "MalformedXML", "The upload must list at least one part.")
+		return
+	}
+	sort.Slice(req.Parts, func(i, j int) bool {
+		return req.Parts[i].PartNumber < req.Parts[j].PartNumber
+	})
+
+	s.mu.Lock()
+	readers := []io.Reader{}
+	closers := []io.Closer{}
+	etagHash := md5.New()
+	var invalid string
+	for _, part := range req.Parts {
+		if upload.parts[part.PartNumber] != part.ETag {
+			invalid = fmt.Sprintf("Part %d wasn't uploaded or its ETag doesn't match.", part.PartNumber)
+			break
+		}
+		sum, _ := hex.DecodeString(strings.Trim(part.ETag, `"`))
+		etagHash.Write(sum)
+	}
+	s.mu.Unlock()
+	if invalid != "" {
+		writeError(w, http.StatusBadRequest, "InvalidPart", invalid)
+		return
+	}
+
+	defer func() {
+		for _, c := range closers {
+			c.Close()
+		}
+	}()
+	for _, part := range req.Parts {
+		body, _, err := s.backend.Get(bucket, fmt.Sprintf("%s%s/%05d", multipartPrefix, id, part.PartNumber))
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, "InternalError", err.Error())
+			return
+		}
+		readers = append(readers, body)
+		closers = append(closers, body)
+	}
+	if err := s.backend.Put(bucket, key, io.MultiReader(readers...), upload.contentType); err != nil {
+		writeError(w, http.StatusInternalServerError, "InternalError", err.Error())
+		return
+	}
+	s.removeUpload(id)
+
+	etag := fmt.Sprintf(`"%s-%d"`, hex.EncodeToString(etagHash.Sum(nil)), len(req.Parts))
+	writeXML(w, http.StatusOK, completeMultipartUploadResult{Bucket: bucket, Key: key, ETag: etag})
+}
+
+func (s *Server) abortMultipartUpload(w http.ResponseWriter, r *http.Request, bucket, key string) {
+	id := r.URL.Query().Get("uploadId")
+	if _, ok := s.upload(w, id, bucket, key); !ok {
+		return
+	}
+	s.removeUpload(id)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// removeUpload forgets the upload and deletes its parts.
+func (s *Server) removeUpload(id string) {
+	s.mu.Lock()
+	upload := s.uploads[id]
+	delete(s.uploads, id)
+	s.mu.Unlock()
+	for number := range upload.parts {
+		s.backend.Delete(upload.bucket, fmt.Sprintf("%s%s/%05d", multipartPrefix, id, number))
+	}
+}
@@ -0,0 +1,424 @@
+// Package s3local serves the part of the S3 REST API that Tubely uses from a
+// local directory or from memory, so the app runs without an AWS account.
+// Requests must use path-style addressing (/bucket/key) and signatures aren't
+// checked; it's meant for development only.
+package s3local
+
+import (
+	"bufio"
+	"crypto/md5"
+	"encoding/hex"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+var ErrNotFound = errors.New("object not found")
+
+type Object struct {
+	Key          string
+	Size         int64
+	LastModified time.Time
+	ContentType  string
+}
+
+// Backend holds the objects. Buckets spring into existence on first write.
+type Backend interface {
+	Get(bucket, key string) (io.ReadSeekCloser, Object, error)
+	Put(bucket, key string, body io.Reader, contentType string) error
+	Delete(bucket, key string) error
+	List(bucket, prefix string) ([]Object, error)
+}
+
+type Server struct {
+	backend Backend
+	now     func() time.Time
+
+	mu      sync.Mutex
+	uploads map[string]*multipartUpload
+	// lifecycles are stored as sent, rules aren't applied.
+	lifecycles map[string][]byte
+}
+
+func New(backend Backend) *Server {
+	return &Server{
+		backend:    backend,
+		now:        time.Now,
+		uploads:    map[string]*multipartUpload{},
+		lifecycles: map[string][]byte{},
+	}
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	bucket, key, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/"), "/")
+	if bucket == "" || bucket == "." || bucket == ".." {
+		writeError(w, http.StatusBadRequest, "InvalidBucketName", "The specified bucket is not valid.")
+		return
+	}
+
+	if expired, err := s.presignExpired(r); err != nil {
+		writeError(w, http.StatusBadRequest, "AuthorizationQueryParametersError", err.Error())
+		return
+	} else if expired {
+		writeError(w, http.StatusForbidden, "AccessDenied", "Request has expired")
+		return
+	}
+
+	if key == "" {
+		switch {
+		case r.Method == http.MethodHead:
+			w.WriteHeader(http.StatusOK)
+		case r.Method == http.MethodGet && r.URL.Query().Get("list-type") == "2":
+			s.listObjects(w, r, bucket)
+		case r.Method == http.MethodPost && r.URL.Query().Has("delete"):
+			s.deleteObjects(w, r, bucket)
+		case r.URL.Query().Has("lifecycle"):
+			s.bucketLifecycle(w, r, bucket)
+		default:
+			writeError(w, http.StatusNotImplemented, "NotImplemented", "Bucket operation not supported.")
+		}
+		return
+	}
+
+	query := r.URL.Query()
+	switch {
+	case r.Method == http.MethodPost && query.Has("uploads"):
+		s.createMultipartUpload(w, r, bucket, key)
+	case r.Method == http.MethodPut && query.Has("uploadId"):
+		s.uploadPart(w, r, bucket, key)
+	case r.Method == http.MethodPost && query.Has("uploadId"):
+		s.completeMultipartUpload(w, r, bucket, key)
+	case r.Method == http.MethodDelete && query.Has("uploadId"):
+		s.abortMultipartUpload(w, r, bucket, key)
+	case query.Has("tagging"):
+		// Tags only matter to bucket rules, which aren't emulated.
+		w.WriteHeader(http.StatusOK)
+	case r.Method == http.MethodGet, r.Method == http.MethodHead:
+		s.getObject(w, r, bucket, key)
+	case r.Method == http.MethodPut:
+		s.putObject(w, r, bucket, key)
+	case r.Method == http.MethodDelete:
+		if err := s.backend.Delete(bucket, key); err != nil {
+			writeError(w, http.StatusInternalServerError, "InternalError", err.Error())
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		writeError(w, http.StatusNotImplemented, "NotImplemented", "Object operation not supported.")
+	}
+}
+
+// presignExpired reports whether r is a presigned URL past its expiry. The
+// signature itself isn't checked, but expiry is, so code handing out
+// presigned URLs behaves like it would against S3.
+func (s *Server) presignExpired(r *http.Request) (bool, error) {
+	query := r.URL.Query()
+	if !query.Has("X-Amz-Expires") {
+		return false, nil
+	}
+	signedAt, err := time.Parse("20060102T150405Z", query.Get("X-Amz-Date"))
+	if err != nil {
+		return false, errors.New("X-Amz-Date must be in ISO8601 basic format")
+	}
+	seconds, err := strconv.Atoi(query.Get("X-Amz-Expires"))
+	if err != nil || seconds < 1 || seconds > 604800 {
+		return false, errors.New("X-Amz-Expires must be between 1 and 604800 seconds")
+	}
+	return s.now().After(signedAt.Add(time.Duration(seconds) * time.Second)), nil
+}
+
+// responseOverrides are the GetObject query parameters that override
+// response headers.
+var responseOverrides = map[string]string{
+	"response-cache-control":       "Cache-Control",
+	"response-content-disposition": "Content-Disposition",
+	"response-content-type":        "Content-Type",
+}
+
+func (s *Server) getObject(w http.ResponseWriter, r *http.Request, bucket, key string) {
+	body, obj, err := s.backend.Get(bucket, key)
+	if errors.Is(err, ErrNotFound) {
+		writeError(w, http.StatusNotFound, "NoSuchKey", "The specified key does not exist.")
+		return
+	}
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "InternalError", err.Error())
+		return
+	}
+	defer body.Close()
+
+	contentType := obj.ContentType
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Accept-Ranges", "bytes")
+	// Presigned URLs can override response headers, e.g. to download a
+	// file as an attachment.
+	for param, header := range responseOverrides {
+		if v := r.URL.Query().Get(param); v != "" {
+			w.Header().Set(header, v)
+		}
+	}
+	http.ServeContent(w, r, "", obj.LastModified, body)
+}
+
+func (s *Server) putObject(w http.ResponseWriter, r *http.Request, bucket, key string) {
+	if !s.checkNoneMatch(w, r, bucket, key) {
+		return
+	}
+	if source := r.Header.Get("X-Amz-Copy-Source"); source != "" {
+		s.copyObject(w, source, bucket, key)
+		return
+	}
+
+	var body io.Reader = r.Body
+	if strings.Contains(r.Header.Get("Content-Encoding"), "aws-chunked") ||
+		strings.HasPrefix(r.Header.Get("X-Amz-Content-Sha256"), "STREAMING-") {
+		body = newChunkedReader(r.Body)
+	}
+
+	hash := md5.New()
+	err := s.backend.Put(bucket, key, io.TeeReader(body, hash), r.Header.Get("Content-Type"))
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "InternalError", err.Error())
+		return
+	}
+
+	w.Header().Set("ETag", `"`+hex.EncodeToString(hash.Sum(nil))+`"`)
+	w.WriteHeader(http.StatusOK)
+}
+
+type copyObjectResult struct {
+	XMLName      xml.Name `xml:"CopyObjectResult"`
+	ETag         string   `xml:"ETag"`
+	LastModified string   `xml:"LastModified"`
+}
+
+// copyObject copies the object named by an X-Amz-Copy-Source header, which
+// is "bucket/key" with the key URL-encoded. Only whole objects are copied.
+func (s *Server) copyObject(w http.ResponseWriter, source, bucket, key string) {
+	source, err := url.PathUnescape(strings.TrimPrefix(source, "/"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "InvalidArgument", "Copy Source must mention the source bucket and key: sourcebucket/sourcekey.")
+		return
+	}
+	srcBucket, srcKey, _ := strings.Cut(source, "/")
+	body, obj, err := s.backend.Get(srcBucket, srcKey)
+	if errors.Is(err, ErrNotFound) {
+		writeError(w, http.StatusNotFound, "NoSuchKey", "The specified key does not exist.")
+		return
+	}
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "InternalError", err.Error())
+		return
+	}
+	defer body.Close()
+
+	hash := md5.New()
+	if err := s.backend.Put(bucket, key, io.TeeReader(body, hash), obj.ContentType); err != nil {
+		writeError(w, http.StatusInternalServerError, "InternalError", err.Error())
+		return
+	}
+	writeXML(w, http.StatusOK, copyObjectResult{
+		ETag:         `"` + hex.EncodeToString(hash.Sum(nil)) + `"`,
+		LastModified: s.now().UTC().Format(time.RFC3339),
+	})
+}
+
+// checkNoneMatch rejects a conditional write with If-None-Match: * if the
+// key is taken. Unlike S3 the check isn't atomic with the write.
+func (s *Server) checkNoneMatch(w http.ResponseWriter, r *http.Request, bucket, key string) bool {
+	if r.Header.Get("If-None-Match") != "*" {
+		return true
+	}
+	body, _, err := s.backend.Get(bucket, key)
+	if errors.Is(err, ErrNotFound) {
+		return true
+	}
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "InternalError", err.Error())
+		return false
+	}
+	body.Close()
+	writeError(w, http.StatusPreconditionFailed, "PreconditionFailed", "At least one of the pre-conditions you specified did not hold")
+	return false
+}
+
+type listBucketResult struct {
+	XMLName     xml.Name       `xml:"ListBucketResult"`
+	Name        string         `xml:"Name"`
+	Prefix      string         `xml:"Prefix"`
+	KeyCount    int            `xml:"KeyCount"`
+	MaxKeys     int            `xml:"MaxKeys"`
+	IsTruncated bool           `xml:"IsTruncated"`
+	Contents    []objectResult `xml:"Contents"`
+}
+
+type objectResult struct {
+	Key          string `xml:"Key"`
+	LastModified string `xml:"LastModified"`
+	Size         int64  `xml:"Size"`
+	StorageClass string `xml:"StorageClass"`
+}
+
+// listObjects answers ListObjectsV2 with every matching key in one page.
+func (s *Server) listObjects(w http.ResponseWriter, r *http.Request, bucket string) {
+	prefix := r.URL.Query().Get("prefix")
+	objects, err := s.backend.List(bucket, prefix)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "InternalError", err.Error())
+		return
+	}
+	sort.Slice(objects, func(i, j int) bool {
+		return objects[i].Key < objects[j].Key
+	})
+
+	result := listBucketResult{Name: bucket, Prefix: prefix, MaxKeys: 1000}
+	for _, obj := range objects {
+		if strings.HasPrefix(obj.Key, multipartPrefix) {
+			continue
+		}
+		result.Contents = append(result.Contents, objectResult{
+			Key:          obj.Key,
+			LastModified: obj.LastModified.UTC().Format(time.RFC3339),
+			Size:         obj.Size,
+			StorageClass: "STANDARD",
+		})
+	}
+	result.KeyCount = len(result.Contents)
+	writeXML(w, http.StatusOK, result)
+}
+
+type objectIdentifier struct {
+	Key string `xml:"Key"`
+}
+
+type deleteRequest struct {
+	Objects []objectIdentifier `xml:"Object"`
+	Quiet   bool               `xml:"Quiet"`
+}
+
+type deleteResult struct {
+	XMLName xml.Name           `xml:"DeleteResult"`
+	Deleted []objectIdentifier `xml:"Deleted"`
+}
+
+func (s *Server) deleteObjects(w http.ResponseWriter, r *http.Request, bucket string) {
+	var req deleteRequest
+	if err := xml.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "MalformedXML", err.Error())
+		return
+	}
+
+	result := deleteResult{}
+	for _, obj := range req.Objects {
+		if err := s.backend.Delete(bucket, obj.Key); err != nil {
+			writeError(w, http.StatusInternalServerError, "InternalError", err.Error())
+			return
+		}
+		if !req.Quiet {
+			result.Deleted = append(result.Deleted, obj)
+		}
+	}
+	writeXML(w, http.StatusOK, result)
+}
+
+func (s *Server) bucketLifecycle(w http.ResponseWriter, r *http.Request, bucket string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	switch r.Method {
+	case http.MethodGet:
+		config, ok := s.lifecycles[bucket]
+		if !ok {
+			writeError(w, http.StatusNotFound, "NoSuchLifecycleConfiguration", "The lifecycle configuration does not exist.")
+			return
+		}
+		w.Header().Set("Content-Type", "application/xml")
+		w.Write(config)
+	case http.MethodPut:
+		config, err := io.ReadAll(r.Body)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "IncompleteBody", err.Error())
+			return
+		}
+		s.lifecycles[bucket] = config
+		w.WriteHeader(http.StatusOK)
+	case http.MethodDelete:
+		delete(s.lifecycles, bucket)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		writeError(w, http.StatusNotImplemented, "NotImplemented", "Bucket operation not supported.")
+	}
+}
+
+type errorResponse struct {
+	XMLName xml.Name `xml:"Error"`
+	Code    string   `xml:"Code"`
+	Message string   `xml:"Message"`
+}
+
+func writeError(w http.ResponseWriter, status int, code, message string) {
+	writeXML(w, status, errorResponse{Code: code, Message: message})
+}
+
+func writeXML(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/xml")
+	w.WriteHeader(status)
+	io.WriteString(w, xml.Header)
+	xml.NewEncoder(w).Encode(v)
+}
+
+// chunkedReader decodes an aws-chunked body: hex-sized chunks, each followed
+// by a signature extension, ending with a zero-length chunk and trailers.
+type chunkedReader struct {
+	r         *bufio.Reader
+	remaining int64
+	done      bool
+}
+
+func newChunkedReader(r io.Reader) *chunkedReader {
+	return &chunkedReader{r: bufio.NewReader(r)}
+}
+
+func (c *chunkedReader) Read(p []byte) (int, error) {
+	if c.done {
+		return 0, io.EOF
+	}
+	if c.remaining == 0 {
+		line, err := c.r.ReadString('\n')
+		if err != nil {
+			return 0, err
+		}
+		sizeHex, _, _ := strings.Cut(strings.TrimSpace(line), ";")
+		size, err := strconv.ParseInt(sizeHex, 16, 64)
+		if err != nil {
+			return 0, fmt.Errorf("invalid aws-chunked size %q", sizeHex)
+		}
+		if size == 0 {
+			// Trailers such as checksums aren't verified.
+			c.done = true
+			return 0, io.EOF
+		}
+		c.remaining = size
+	}
+
+	if int64(len(p)) > c.remaining {
+		p = p[:c.remaining]
+	}
+	n, err := c.r.Read(p)
+	c.remaining -= int64(n)
+	if c.remaining == 0 && err == nil {
+		// Each chunk's data is followed by CRLF.
+		_, err = c.r.Discard(2)
+	}
+	return n, err
+}
@@ -0,0 +1,84 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Dir is a Store backed by a local directory, used for the assets that are
+// served from disk rather than the bucket.
+type Dir struct {
+	root string
+}
+
+func NewDir(root string) *Dir {
+	return &Dir{root: root}
+}
+
+func (d *Dir) Name() string {
+	return "file://" + d.root
+}
+
+func (d *Dir) List(ctx context.Context, prefix string) ([]Object, error) {
+	objects := []Object{}
+	err := filepath.WalkDir(d.root, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if entry.IsDir() {
+			return nil
+		}
+		rel, err := filepath.Rel(d.root, path)
+		if err != nil {
+			return err
+		}
+		key := filepath.ToSlash(rel)
+		if !strings.HasPrefix(key, prefix) {
+			return nil
+		}
+		info, err := entry.Info()
+		if err != nil {
+			return err
+		}
+		objects = append(objects, Object{Key: key, Size: info.Size(), LastModified: info.ModTime()})
+		return nil
+	})
+	if errors.Is(err, fs.ErrNotExist) {
+		return objects, nil
+	}
+	return objects, err
+}
+
+func (d *Dir) Get(ctx context.Context, key string) (io.ReadCloser, error) {
+	f, err := os.Open(d.path(key))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, ErrNotFound
+	}
+	return f, err
+}
+
+func (d *Dir) Put(ctx context.Context, key string, body io.Reader, size int64, contentType string) error {
+	path := d.path(key)
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(f, body)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+// path keeps keys from escaping the root directory.
+func (d *Dir) path(key string) string {
+	return filepath.Join(d.root, filepath.FromSlash(filepath.Clean("/"+key)))
+}
@@ -0,0 +1,107 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/credentials"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+)
+
+type S3 struct {
+	client *s3.Client
+	bucket string
+}
+
+func NewS3(client *s3.Client, bucket string) *S3 {
+	return &S3{client: client, bucket: bucket}
+}
+
+// S3CompatibleConfig describes a bucket on any provider speaking the S3 API
+// (another AWS account, Cloudflare R2, Backblaze B2, MinIO...).
+type S3CompatibleConfig struct {
+	Endpoint        string
+	Region          string
+	Bucket          string
+	AccessKeyID     string
+	SecretAccessKey string
+}
+
+func NewS3Compatible(cfg S3CompatibleConfig) *S3 {
+	region := cfg.Region
+	if region == "" {
+		region = "auto"
+	}
+	client := s3.New(s3.Options{
+		Region:      region,
+		Credentials: credentials.NewStaticCredentialsProvider(cfg.AccessKeyID, cfg.SecretAccessKey, ""),
+	}, func(o *s3.Options) {
+		if cfg.Endpoint != "" {
+			o.BaseEndpoint = aws.String(cfg.Endpoint)
+			o.UsePathStyle = true
+		}
+	})
+	return NewS3(client, cfg.Bucket)
+}
+
+func (s *S3) Name() string {
+	return "s3://" + s.bucket
+}
+
+func (s *S3) List(ctx context.Context, prefix string) ([]Object, error) {
+	objects := []Object{}
+	paginator := s3.NewListObjectsV2Paginator(s.client, &s3.ListObjectsV2Input{
+		Bucket: aws.String(s.bucket),
+		Prefix: aws.String(prefix),
+	})
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("couldn't list %s: %w", s.Name(), err)
+		}
+		for _, obj := range page.Contents {
+			objects = append(objects, Object{
+				Key:          aws.ToString(obj.Key),
+				Size:         aws.ToInt64(obj.Size),
+				LastModified: aws.ToTime(obj.LastModified),
+			})
+		}
+	}
+	return objects, nil
+}
+
+func (s *S3) Get(ctx context.Context, key string) (io.ReadCloser, error) {
+	out, err := s.client.GetObject(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(s.bucket),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		var noSuchKey *types.NoSuchKey
+		if errors.As(err, &noSuchKey) {
+			return nil, ErrNotFound
+		}
+		return nil, fmt.Errorf("couldn't get %s from %s: %w", key, s.Name(), err)
+	}
+	return out.Body, nil
+}
+
+func (s *S3) Put(ctx context.Context, key string, body io.Reader, size int64, contentType string) error {
+	input := &s3.PutObjectInput{
+		Bucket:        aws.String(s.bucket),
+		Key:           aws.String(key),
+		Body:          body,
+		ContentLength: aws.Int64(size),
+	}
+	if contentType != "" {
+		input.ContentType = aws.String(contentType)
+	}
+	_, err := s.client.PutObject(ctx, input)
+	if err != nil {
+		return fmt.Errorf("couldn't put %s to %s: %w", key, s.Name(), err)
+	}
+	return nil
+}
@@ -0,0 +1,70 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"io"
+	"mime"
+	"path"
+	"strings"
+	"time"
+)
+
+var ErrNotFound = errors.New("object not found")
+
+type Object struct {
+	Key          string
+	Size         int64
+	LastModified time.Time
+}
+
+// Store is a bucket of objects on some provider. It's deliberately small so
+// that a backup target doesn't have to be S3 itself, only speak its API.
+type Store interface {
+	Name() string
+	List(ctx context.Context, prefix string) ([]Object, error)
+	Get(ctx context.Context, key string) (io.ReadCloser, error)
+	Put(ctx context.Context, key string, body io.Reader, size int64, contentType string) error
+}
+
+// Mirror copies every object under srcPrefix in src to dst, swapping the
+// prefix for dstPrefix. Objects already in dst with the same size are
+// skipped, so running it repeatedly only transfers what's new. It returns the
+// number of objects copied.
+func Mirror(ctx context.Context, dst Store, dstPrefix string, src Store, srcPrefix string) (int, error) {
+	srcObjects, err := src.List(ctx, srcPrefix)
+	if err != nil {
+		return 0, err
+	}
+	dstObjects, err := dst.List(ctx, dstPrefix)
+	if err != nil {
+		return 0, err
+	}
+	existing := make(map[string]int64, len(dstObjects))
+	for _, obj := range dstObjects {
+		existing[obj.Key] = obj.Size
+	}
+
+	copied := 0
+	for _, obj := range srcObjects {
+		dstKey := dstPrefix + strings.TrimPrefix(obj.Key, srcPrefix)
+		if size, ok := existing[dstKey]; ok && size == obj.Size {
+			continue
+		}
+		if err := Copy(ctx, dst, dstKey, src, obj); err != nil {
+			return copied, err
+		}
+		copied++
+	}
+	return copied, nil
+}
+
+// Copy streams a single object from src to dstKey in dst.
+func Copy(ctx context.Context, dst Store, dstKey string, src Store, obj Object) error {
+	body, err := src.Get(ctx, obj.Key)
+	if err != nil {
+		return err
+	}
+	defer body.Close()
+	return dst.Put(ctx, dstKey, body, obj.Size, mime.TypeByExtension(path.Ext(obj.Key)))
+}
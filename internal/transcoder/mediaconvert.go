@@ -0,0 +1,225 @@
+package transcoder
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/mediaconvert"
+	"github.com/aws/aws-sdk-go-v2/service/mediaconvert/types"
+	"github.com/google/uuid"
+)
+
+// MediaConvert submits jobs to AWS Elemental MediaConvert. Completion events
+// are expected to be "MediaConvert Job State Change" EventBridge events,
+// forwarded and signed by a relay (e.g. a small Lambda) using the shared
+// webhook secret.
+type MediaConvert struct {
+	client  *mediaconvert.Client
+	bucket  string
+	roleARN string
+	queue   string
+	// templates maps presets to MediaConvert job template names. Presets
+	// without a template use the built-in ladder from presetOutputs.
+	templates map[Preset]string
+}
+
+func NewMediaConvert(awsConfig aws.Config, bucket, roleARN, queue string, templates map[Preset]string) *MediaConvert {
+	return &MediaConvert{
+		client:    mediaconvert.NewFromConfig(awsConfig),
+		bucket:    bucket,
+		roleARN:   roleARN,
+		queue:     queue,
+		templates: templates,
+	}
+}
+
+// Per output-minute on-demand prices for the basic tier, used for estimates
+// only.
+const (
+	costPerMinuteSD  = 0.0075
+	costPerMinuteHD  = 0.015
+	costPerMinuteUHD = 0.03
+)
+
+func presetOutputs(preset Preset) []types.Output {
+	sd := mp4Output("_480p", 480, 2_000_000)
+	hd := mp4Output("_720p", 720, 5_000_000)
+	fhd := mp4Output("_1080p", 1080, 8_000_000)
+
+	switch preset {
+	case PresetSD:
+		return []types.Output{sd}
+	case PresetFHD:
+		return []types.Output{fhd, hd, sd}
+	default:
+		return []types.Output{hd, sd}
+	}
+}
+
+func estimateOutputCost(output Output) float64 {
+	minutes := float64(output.DurationMS) / 60000
+	switch {
+	case output.Height > 1080:
+		return minutes * costPerMinuteUHD
+	case output.Height >= 720:
+		return minutes * costPerMinuteHD
+	default:
+		return minutes * costPerMinuteSD
+	}
+}
+
+func (m *MediaConvert) Provider() string {
+	return "mediaconvert"
+}
+
+func (m *MediaConvert) Submit(ctx context.Context, videoID uuid.UUID, sourceKey, outputPrefix string, preset Preset) (string, error) {
+	input := &mediaconvert.CreateJobInput{
+		Role: aws.String(m.roleARN),
+		UserMetadata: map[string]string{
+			"video_id": videoID.String(),
+			"preset":   string(preset),
+		},
+		Settings: &types.JobSettings{
+			Inputs: []types.Input{{
+				FileInput:     aws.String(m.s3URI(sourceKey)),
+				VideoSelector: &types.VideoSelector{},
+				AudioSelectors: map[string]types.AudioSelector{
+					"Audio Selector 1": {DefaultSelection: types.AudioDefaultSelectionDefault},
+				},
+			}},
+		},
+	}
+	if template, ok := m.templates[preset]; ok {
+		// The template owns the output groups, including their destination.
+		input.JobTemplate = aws.String(template)
+	} else {
+		input.Settings.OutputGroups = []types.OutputGroup{{
+			Name: aws.String("File Group"),
+			OutputGroupSettings: &types.OutputGroupSettings{
+				Type: types.OutputGroupTypeFileGroupSettings,
+				FileGroupSettings: &types.FileGroupSettings{
+					Destination: aws.String(m.s3URI(strings.TrimSuffix(outputPrefix, "/") + "/")),
+				},
+			},
+			Outputs: presetOutputs(preset),
+		}}
+	}
+	if m.queue != "" {
+		input.Queue = aws.String(m.queue)
+	}
+
+	out, err := m.client.CreateJob(ctx, input)
+	if err != nil {
+		return "", fmt.Errorf("couldn't create MediaConvert job: %w", err)
+	}
+	if out.Job == nil || out.Job.Id == nil {
+		return "", errors.New("MediaConvert returned no job ID")
+	}
+	return *out.Job.Id, nil
+}
+
+func (m *MediaConvert) ParseCompletion(body []byte) (JobResult, error) {
+	var event struct {
+		Detail struct {
+			JobID        string `json:"jobId"`
+			Status       string `json:"status"`
+			ErrorCode    int    `json:"errorCode"`
+			ErrorMessage string `json:"errorMessage"`
+			Timing       struct {
+				StartTimeMillis  int64 `json:"startTimeMillis"`
+				FinishTimeMillis int64 `json:"finishTimeMillis"`
+			} `json:"timing"`
+			OutputGroupDetails []struct {
+				OutputDetails []struct {
+					OutputFilePaths []string `json:"outputFilePaths"`
+					DurationInMs    int64    `json:"durationInMs"`
+					VideoDetails    struct {
+						WidthInPx  int `json:"widthInPx"`
+						HeightInPx int `json:"heightInPx"`
+					} `json:"videoDetails"`
+				} `json:"outputDetails"`
+			} `json:"outputGroupDetails"`
+		} `json:"detail"`
+	}
+	if err := json.Unmarshal(body, &event); err != nil {
+		return JobResult{}, fmt.Errorf("couldn't parse MediaConvert event: %w", err)
+	}
+	if event.Detail.JobID == "" {
+		return JobResult{}, errors.New("MediaConvert event has no job ID")
+	}
+
+	result := JobResult{JobID: event.Detail.JobID}
+	if event.Detail.Timing.FinishTimeMillis > event.Detail.Timing.StartTimeMillis {
+		result.ProcessingMS = event.Detail.Timing.FinishTimeMillis - event.Detail.Timing.StartTimeMillis
+	}
+	switch event.Detail.Status {
+	case "COMPLETE":
+		result.Status = JobStatusComplete
+	case "ERROR", "CANCELED":
+		result.Status = JobStatusError
+		result.Error = fmt.Sprintf("%s %d: %s", event.Detail.Status, event.Detail.ErrorCode, event.Detail.ErrorMessage)
+	default:
+		result.Status = JobStatusSubmitted
+	}
+
+	for _, group := range event.Detail.OutputGroupDetails {
+		for _, detail := range group.OutputDetails {
+			for _, path := range detail.OutputFilePaths {
+				output := Output{
+					Key:        strings.TrimPrefix(path, "s3://"+m.bucket+"/"),
+					Width:      detail.VideoDetails.WidthInPx,
+					Height:     detail.VideoDetails.HeightInPx,
+					DurationMS: detail.DurationInMs,
+				}
+				result.Outputs = append(result.Outputs, output)
+				result.EstimatedCostUSD += estimateOutputCost(output)
+			}
+		}
+	}
+	return result, nil
+}
+
+func (m *MediaConvert) s3URI(key string) string {
+	return fmt.Sprintf("s3://%s/%s", m.bucket, key)
+}
+
+// mp4Output describes a progressive-download H.264/AAC MP4 scaled to the
+// given height, with moov placed at the front like the local faststart pass.
+func mp4Output(nameModifier string, height, maxBitrate int32) types.Output {
+	return types.Output{
+		NameModifier: aws.String(nameModifier),
+		ContainerSettings: &types.ContainerSettings{
+			Container: types.ContainerTypeMp4,
+			Mp4Settings: &types.Mp4Settings{
+				MoovPlacement: types.Mp4MoovPlacementProgressiveDownload,
+			},
+		},
+		VideoDescription: &types.VideoDescription{
+			Height: aws.Int32(height),
+			CodecSettings: &types.VideoCodecSettings{
+				Codec: types.VideoCodecH264,
+				H264Settings: &types.H264Settings{
+					RateControlMode: types.H264RateControlModeQvbr,
+					MaxBitrate:      aws.Int32(maxBitrate),
+					QvbrSettings: &types.H264QvbrSettings{
+						QvbrQualityLevel: aws.Int32(7),
+					},
+				},
+			},
+		},
+		AudioDescriptions: []types.AudioDescription{{
+			CodecSettings: &types.AudioCodecSettings{
+				Codec: types.AudioCodecAac,
+				AacSettings: &types.AacSettings{
+					Bitrate:    aws.Int32(96000),
+					CodingMode: types.AacCodingModeCodingMode20,
+					SampleRate: aws.Int32(48000),
+				},
+			},
+		}},
+	}
+}
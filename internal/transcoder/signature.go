@@ -0,0 +1,53 @@
+package transcoder
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	SignatureHeader = "X-Tubely-Signature"
+	TimestampHeader = "X-Tubely-Timestamp"
+
+	// maxSignatureAge bounds how old a signed webhook may be, so a captured
+	// request can't be replayed later.
+	maxSignatureAge = 5 * time.Minute
+)
+
+var ErrInvalidSignature = errors.New("invalid webhook signature")
+
+// Sign returns the signature for a webhook body sent at the given unix
+// timestamp: hex(HMAC-SHA256(secret, timestamp + "." + body)).
+func Sign(secret string, timestamp int64, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strconv.FormatInt(timestamp, 10)))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// VerifySignature checks the signature and timestamp headers of a webhook
+// request against its body.
+func VerifySignature(secret string, headers http.Header, body []byte, now time.Time) error {
+	timestamp, err := strconv.ParseInt(headers.Get(TimestampHeader), 10, 64)
+	if err != nil {
+		return ErrInvalidSignature
+	}
+	age := now.Sub(time.Unix(timestamp, 0))
+	if age > maxSignatureAge || age < -maxSignatureAge {
+		return ErrInvalidSignature
+	}
+
+	signature := strings.TrimPrefix(headers.Get(SignatureHeader), "sha256=")
+	expected := Sign(secret, timestamp, body)
+	if !hmac.Equal([]byte(signature), []byte(expected)) {
+		return ErrInvalidSignature
+	}
+	return nil
+}
@@ -0,0 +1,73 @@
+package transcoder
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/google/uuid"
+)
+
+type JobStatus string
+
+const (
+	JobStatusSubmitted JobStatus = "submitted"
+	JobStatusComplete  JobStatus = "complete"
+	JobStatusError     JobStatus = "error"
+)
+
+// Preset is a named quality level that decides which renditions a job
+// produces.
+type Preset string
+
+const (
+	PresetSD  Preset = "sd"
+	PresetHD  Preset = "hd"
+	PresetFHD Preset = "fhd"
+)
+
+func ParsePreset(s string) (Preset, error) {
+	switch p := Preset(s); p {
+	case PresetSD, PresetHD, PresetFHD:
+		return p, nil
+	}
+	return "", fmt.Errorf("unknown quality preset %q", s)
+}
+
+// Output is a single rendition written by an external transcoder.
+type Output struct {
+	Key        string
+	Width      int
+	Height     int
+	DurationMS int64
+}
+
+// JobResult is the provider independent content of a completion webhook.
+type JobResult struct {
+	JobID   string
+	Status  JobStatus
+	Outputs []Output
+	Error   string
+	// ProcessingMS is how long the service spent on the job.
+	ProcessingMS int64
+	// EstimatedCostUSD is the provider's list price for the outputs.
+	EstimatedCostUSD float64
+}
+
+// DurationMS returns the total duration of all outputs, which is what
+// transcoding services bill for.
+func (r JobResult) DurationMS() int64 {
+	var total int64
+	for _, output := range r.Outputs {
+		total += output.DurationMS
+	}
+	return total
+}
+
+// Transcoder delegates video processing to an external service. Jobs are
+// submitted after the original has been uploaded to the bucket, and the
+// service reports back through a signed webhook.
+type Transcoder interface {
+	Provider() string
+	Submit(ctx context.Context, videoID uuid.UUID, sourceKey, outputPrefix string, preset Preset) (string, error)
+	ParseCompletion(body []byte) (JobResult, error)
+}
@@ -0,0 +1,91 @@
+// Package validate checks API inputs field by field so handlers can reject
+// bad data up front with errors that point at the offending fields.
+package validate
+
+import (
+	"net/mail"
+	"net/url"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// Errors maps field names to what's wrong with them. Create it with
+// Errors{} and call Check for each rule; only the first failure per field is
+// kept.
+type Errors map[string]string
+
+func (e Errors) Check(ok bool, field, message string) {
+	if ok {
+		return
+	}
+	if _, exists := e[field]; !exists {
+		e[field] = message
+	}
+}
+
+// Err returns nil when every check passed.
+func (e Errors) Err() error {
+	if len(e) == 0 {
+		return nil
+	}
+	return e
+}
+
+func (e Errors) Error() string {
+	fields := make([]string, 0, len(e))
+	for field, message := range e {
+		fields = append(fields, field+" "+message)
+	}
+	sort.Strings(fields)
+	return strings.Join(fields, "; ")
+}
+
+// Required reports whether s has anything besides whitespace.
+func Required(s string) bool {
+	return strings.TrimSpace(s) != ""
+}
+
+// MaxLength counts characters rather than bytes.
+func MaxLength(s string, n int) bool {
+	return utf8.RuneCountInString(s) <= n
+}
+
+func MinLength(s string, n int) bool {
+	return utf8.RuneCountInString(s) >= n
+}
+
+// Email accepts a bare address, without a display name.
+func Email(s string) bool {
+	addr, err := mail.ParseAddress(s)
+	return err == nil && addr.Address == s && len(s) <= 254
+}
+
+func HTTPSURL(s string) bool {
+	u, err := url.Parse(s)
+	return err == nil && u.Scheme == "https" && u.Host != ""
+}
+
+// Hostname reports whether s is a lowercase DNS name such as
+// "blog.example.com", without a scheme, port or path.
+func Hostname(s string) bool {
+	return len(s) <= 253 && hostnamePattern.MatchString(s)
+}
+
+var hostnamePattern = regexp.MustCompile(`^([a-z0-9]([a-z0-9-]*[a-z0-9])?\.)*[a-z0-9]([a-z0-9-]*[a-z0-9])?$`)
+
+func OneOf[T comparable](v T, allowed ...T) bool {
+	for _, a := range allowed {
+		if v == a {
+			return true
+		}
+	}
+	return false
+}
+
+// Between reports whether t falls in [min, max].
+func Between(t, min, max time.Time) bool {
+	return !t.Before(min) && !t.After(max)
+}
@@ -0,0 +1,26 @@
+package main
+
+import (
+	"context"
+	"log"
+	"time"
+)
+
+// runPeriodically calls job every interval until ctx is cancelled. Errors are
+// logged and the job is simply tried again on the next tick.
+func runPeriodically(ctx context.Context, name string, interval time.Duration, job func(context.Context) error) {
+	log.Printf("Scheduling %s every %s", name, interval)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := job(ctx); err != nil {
+				log.Printf("Scheduled job %s failed: %v", name, err)
+			}
+		}
+	}
+}
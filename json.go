@@ -2,22 +2,72 @@ package main
 
 import (
 	"encoding/json"
+	"fmt"
 	"log"
 	"net/http"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/i18n"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/validate"
 )
 
+// respondWithError responds with msg translated into the request's
+// language, see messages.go, alongside a stable machine-readable code.
 func respondWithError(w http.ResponseWriter, code int, msg string, err error) {
+	respondWithErrorf(w, code, err, msg)
+}
+
+// respondWithErrorf is respondWithError for messages with arguments. The
+// format string is what's looked up in the catalog.
+func respondWithErrorf(w http.ResponseWriter, code int, err error, format string, args ...any) {
 	if err != nil {
 		log.Println(err)
 	}
 	if code > 499 {
-		log.Printf("Responding with 5XX error: %s", msg)
+		log.Printf("Responding with 5XX error: %s", fmt.Sprintf(format, args...))
+		reportResponseError(w, fmt.Sprintf(format, args...), err)
+	}
+
+	language := responseLanguage(w)
+	if code > 499 && language != i18n.DefaultLanguage && !errorMessages.Has(format) {
+		format, args = genericErrorMessage, nil
+	}
+	errorCode, translated := errorMessages.Translate(language, format)
+	if errorCode == "" {
+		errorCode = errorCodeForStatus(code)
 	}
+	if len(args) > 0 {
+		translated = fmt.Sprintf(translated, args...)
+	}
+
 	type errorResponse struct {
 		Error string `json:"error"`
+		Code  string `json:"code"`
 	}
 	respondWithJSON(w, code, errorResponse{
-		Error: msg,
+		Error: translated,
+		Code:  errorCode,
+	})
+}
+
+// respondWithValidationErrors rejects a request with the field-level errors
+// from the validate package.
+func respondWithValidationErrors(w http.ResponseWriter, errs validate.Errors) {
+	language := responseLanguage(w)
+	code, msg := errorMessages.Translate(language, "Invalid request")
+	fields := validate.Errors{}
+	for field, fieldMsg := range errs {
+		_, fields[field] = errorMessages.Translate(language, fieldMsg)
+	}
+
+	type errorResponse struct {
+		Error  string          `json:"error"`
+		Code   string          `json:"code"`
+		Fields validate.Errors `json:"fields"`
+	}
+	respondWithJSON(w, http.StatusUnprocessableEntity, errorResponse{
+		Error:  msg,
+		Code:   code,
+		Fields: fields,
 	})
 }
 
@@ -0,0 +1,310 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/aws/smithy-go"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/auth"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+)
+
+const (
+	auditEventLifecycleApplied = "lifecycle_applied"
+
+	// lifecycleRulePrefix marks the rules the app manages. Rules with other
+	// IDs were added by hand and are left alone.
+	lifecycleRulePrefix = "tubely-"
+	// trashPrefix is where objects go to be deleted later.
+	trashPrefix = "trash/"
+)
+
+// lifecycleConfig is the bucket hygiene the app asks S3 for. A zero number
+// of days leaves that rule out.
+type lifecycleConfig struct {
+	AbortMultipartDays   int32  `json:"abort_multipart_days"`
+	TrashDays            int32  `json:"trash_days"`
+	UploadDays           int32  `json:"upload_days"`
+	SourceTransitionDays int32  `json:"source_transition_days"`
+	SourceStorageClass   string `json:"source_storage_class"`
+}
+
+// lifecycleConfigFromEnv reads LIFECYCLE_ABORT_MULTIPART_DAYS (default 7),
+// LIFECYCLE_TRASH_DAYS (default 30), LIFECYCLE_UPLOAD_DAYS (default 1),
+// LIFECYCLE_SOURCE_TRANSITION_DAYS (default 30) and
+// LIFECYCLE_SOURCE_STORAGE_CLASS (default GLACIER_IR).
+func lifecycleConfigFromEnv() (lifecycleConfig, error) {
+	lc := lifecycleConfig{
+		AbortMultipartDays:   7,
+		TrashDays:            30,
+		UploadDays:           1,
+		SourceTransitionDays: 30,
+		SourceStorageClass:   string(types.TransitionStorageClassGlacierIr),
+	}
+	for name, days := range map[string]*int32{
+		"LIFECYCLE_ABORT_MULTIPART_DAYS":   &lc.AbortMultipartDays,
+		"LIFECYCLE_TRASH_DAYS":             &lc.TrashDays,
+		"LIFECYCLE_UPLOAD_DAYS":            &lc.UploadDays,
+		"LIFECYCLE_SOURCE_TRANSITION_DAYS": &lc.SourceTransitionDays,
+	} {
+		v := os.Getenv(name)
+		if v == "" {
+			continue
+		}
+		n, err := strconv.ParseInt(v, 10, 32)
+		if err != nil || n < 0 {
+			return lifecycleConfig{}, fmt.Errorf("%s must be a number of days", name)
+		}
+		*days = int32(n)
+	}
+	if class := os.Getenv("LIFECYCLE_SOURCE_STORAGE_CLASS"); class != "" {
+		valid := false
+		for _, c := range types.TransitionStorageClass("").Values() {
+			valid = valid || string(c) == class
+		}
+		if !valid {
+			return lifecycleConfig{}, fmt.Errorf("unknown LIFECYCLE_SOURCE_STORAGE_CLASS %q", class)
+		}
+		lc.SourceStorageClass = class
+	}
+	return lc, nil
+}
+
+// rules are the lifecycle rules lc stands for. Originals are matched by
+// the v1 prefix and by tag, since v2 keeps them under each video's prefix.
+func (lc lifecycleConfig) rules() []types.LifecycleRule {
+	rules := []types.LifecycleRule{}
+	if lc.AbortMultipartDays > 0 {
+		rules = append(rules, types.LifecycleRule{
+			ID:     aws.String(lifecycleRulePrefix + "abort-incomplete-multipart"),
+			Status: types.ExpirationStatusEnabled,
+			Filter: &types.LifecycleRuleFilter{Prefix: aws.String("")},
+			AbortIncompleteMultipartUpload: &types.AbortIncompleteMultipartUpload{
+				DaysAfterInitiation: aws.Int32(lc.AbortMultipartDays),
+			},
+		})
+	}
+	if lc.TrashDays > 0 {
+		rules = append(rules, types.LifecycleRule{
+			ID:         aws.String(lifecycleRulePrefix + "expire-trash"),
+			Status:     types.ExpirationStatusEnabled,
+			Filter:     &types.LifecycleRuleFilter{Prefix: aws.String(trashPrefix)},
+			Expiration: &types.LifecycleExpiration{Days: aws.Int32(lc.TrashDays)},
+		})
+	}
+	if lc.UploadDays > 0 {
+		rules = append(rules, types.LifecycleRule{
+			ID:         aws.String(lifecycleRulePrefix + "expire-uploads"),
+			Status:     types.ExpirationStatusEnabled,
+			Filter:     &types.LifecycleRuleFilter{Prefix: aws.String(uploadsPrefix)},
+			Expiration: &types.LifecycleExpiration{Days: aws.Int32(lc.UploadDays)},
+		})
+	}
+	if lc.SourceTransitionDays > 0 {
+		transitions := []types.Transition{{
+			Days:         aws.Int32(lc.SourceTransitionDays),
+			StorageClass: types.TransitionStorageClass(lc.SourceStorageClass),
+		}}
+		rules = append(rules, types.LifecycleRule{
+			ID:          aws.String(lifecycleRulePrefix + "transition-originals"),
+			Status:      types.ExpirationStatusEnabled,
+			Filter:      &types.LifecycleRuleFilter{Prefix: aws.String("originals/")},
+			Transitions: transitions,
+		}, types.LifecycleRule{
+			ID:     aws.String(lifecycleRulePrefix + "transition-sources"),
+			Status: types.ExpirationStatusEnabled,
+			Filter: &types.LifecycleRuleFilter{Tag: &types.Tag{
+				Key:   aws.String("artifact_kind"),
+				Value: aws.String(string(database.ArtifactKindSource)),
+			}},
+			Transitions: transitions,
+		})
+	}
+	return rules
+}
+
+// getLifecycleRules returns the bucket's rules, none if it has no
+// lifecycle configuration.
+func getLifecycleRules(ctx context.Context, client *s3.Client, bucket string) ([]types.LifecycleRule, error) {
+	out, err := client.GetBucketLifecycleConfiguration(ctx, &s3.GetBucketLifecycleConfigurationInput{
+		Bucket: aws.String(bucket),
+	})
+	var apiErr smithy.APIError
+	if errors.As(err, &apiErr) && apiErr.ErrorCode() == "NoSuchLifecycleConfiguration" {
+		return []types.LifecycleRule{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return out.Rules, nil
+}
+
+// planLifecycle returns the rules the bucket would have after applying
+// lc: its current ones with the app's replaced by lc's.
+func planLifecycle(ctx context.Context, client *s3.Client, bucket string, lc lifecycleConfig) ([]types.LifecycleRule, error) {
+	current, err := getLifecycleRules(ctx, client, bucket)
+	if err != nil {
+		return nil, err
+	}
+	rules := []types.LifecycleRule{}
+	for _, rule := range current {
+		if !strings.HasPrefix(aws.ToString(rule.ID), lifecycleRulePrefix) {
+			rules = append(rules, rule)
+		}
+	}
+	return append(rules, lc.rules()...), nil
+}
+
+// applyLifecycle replaces the app's rules in the bucket's lifecycle
+// configuration with lc's, keeping every rule added by hand. It returns
+// the resulting rules.
+func applyLifecycle(ctx context.Context, client *s3.Client, bucket string, lc lifecycleConfig) ([]types.LifecycleRule, error) {
+	rules, err := planLifecycle(ctx, client, bucket, lc)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(rules) == 0 {
+		_, err = client.DeleteBucketLifecycle(ctx, &s3.DeleteBucketLifecycleInput{Bucket: aws.String(bucket)})
+	} else {
+		_, err = client.PutBucketLifecycleConfiguration(ctx, &s3.PutBucketLifecycleConfigurationInput{
+			Bucket:                 aws.String(bucket),
+			LifecycleConfiguration: &types.BucketLifecycleConfiguration{Rules: rules},
+		})
+	}
+	if err != nil {
+		return nil, err
+	}
+	return rules, nil
+}
+
+// lifecycleRuleView is a lifecycle rule reduced to the parts the app uses,
+// for showing to admins.
+type lifecycleRuleView struct {
+	ID                 string `json:"id"`
+	Enabled            bool   `json:"enabled"`
+	Prefix             string `json:"prefix,omitempty"`
+	Tag                string `json:"tag,omitempty"`
+	AbortMultipartDays int32  `json:"abort_multipart_days,omitempty"`
+	ExpireDays         int32  `json:"expire_days,omitempty"`
+	TransitionDays     int32  `json:"transition_days,omitempty"`
+	StorageClass       string `json:"storage_class,omitempty"`
+	// Other is set for rules using features the view leaves out.
+	Other bool `json:"other,omitempty"`
+}
+
+func viewLifecycleRules(rules []types.LifecycleRule) []lifecycleRuleView {
+	views := make([]lifecycleRuleView, 0, len(rules))
+	for _, rule := range rules {
+		view := lifecycleRuleView{
+			ID:      aws.ToString(rule.ID),
+			Enabled: rule.Status == types.ExpirationStatusEnabled,
+			Prefix:  aws.ToString(rule.Prefix),
+		}
+		if f := rule.Filter; f != nil {
+			view.Prefix = aws.ToString(f.Prefix)
+			if f.Tag != nil {
+				view.Tag = aws.ToString(f.Tag.Key) + "=" + aws.ToString(f.Tag.Value)
+			}
+			view.Other = f.And != nil || f.ObjectSizeGreaterThan != nil || f.ObjectSizeLessThan != nil
+		}
+		if rule.AbortIncompleteMultipartUpload != nil {
+			view.AbortMultipartDays = aws.ToInt32(rule.AbortIncompleteMultipartUpload.DaysAfterInitiation)
+		}
+		if rule.Expiration != nil {
+			view.ExpireDays = aws.ToInt32(rule.Expiration.Days)
+			view.Other = view.Other || rule.Expiration.Date != nil || rule.Expiration.ExpiredObjectDeleteMarker != nil
+		}
+		if len(rule.Transitions) > 0 {
+			view.TransitionDays = aws.ToInt32(rule.Transitions[0].Days)
+			view.StorageClass = string(rule.Transitions[0].StorageClass)
+		}
+		view.Other = view.Other || len(rule.Transitions) > 1 ||
+			rule.NoncurrentVersionExpiration != nil || len(rule.NoncurrentVersionTransitions) > 0
+		views = append(views, view)
+	}
+	return views
+}
+
+type lifecycleResponse struct {
+	Config lifecycleConfig     `json:"config"`
+	Rules  []lifecycleRuleView `json:"rules"`
+	// InSync is false when the bucket's rules differ from the config's.
+	InSync bool `json:"in_sync"`
+	// DryRun is set when Rules are what applying would leave rather than
+	// what the bucket has.
+	DryRun bool `json:"dry_run,omitempty"`
+}
+
+func (cfg *apiConfig) lifecycleResponse(rules []types.LifecycleRule) lifecycleResponse {
+	current := viewLifecycleRules(rules)
+	managed := []lifecycleRuleView{}
+	for _, view := range current {
+		if strings.HasPrefix(view.ID, lifecycleRulePrefix) {
+			managed = append(managed, view)
+		}
+	}
+	return lifecycleResponse{
+		Config: cfg.lifecycle,
+		Rules:  current,
+		InSync: slices.Equal(managed, viewLifecycleRules(cfg.lifecycle.rules())),
+	}
+}
+
+// handlerAdminLifecycleGet shows the bucket's rules next to the config, so
+// drift is visible before applying.
+func (cfg *apiConfig) handlerAdminLifecycleGet(w http.ResponseWriter, r *http.Request) {
+	rules, err := getLifecycleRules(r.Context(), cfg.s3Client, cfg.s3Bucket)
+	if err != nil {
+		respondWithError(w, http.StatusBadGateway, "Couldn't get bucket lifecycle rules", err)
+		return
+	}
+	respondWithJSON(w, http.StatusOK, cfg.lifecycleResponse(rules))
+}
+
+func (cfg *apiConfig) handlerAdminLifecycleApply(w http.ResponseWriter, r *http.Request) {
+	token, err := auth.GetBearerToken(r.Header)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Couldn't find JWT", err)
+		return
+	}
+	adminID, err := cfg.validateJWT(token)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Couldn't validate JWT", err)
+		return
+	}
+
+	dryRun, err := parseDryRun(r)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "dry_run must be true or false", err)
+		return
+	}
+	if dryRun {
+		rules, err := planLifecycle(r.Context(), cfg.s3Client, cfg.s3Bucket, cfg.lifecycle)
+		if err != nil {
+			respondWithError(w, http.StatusBadGateway, "Couldn't get bucket lifecycle rules", err)
+			return
+		}
+		response := cfg.lifecycleResponse(rules)
+		response.DryRun = true
+		respondWithJSON(w, http.StatusOK, response)
+		return
+	}
+
+	rules, err := applyLifecycle(r.Context(), cfg.s3Client, cfg.s3Bucket, cfg.lifecycle)
+	if err != nil {
+		respondWithError(w, http.StatusBadGateway, "Couldn't update bucket lifecycle rules", err)
+		return
+	}
+	cfg.recordAuditEvent(r, auditEventLifecycleApplied, &adminID, "", fmt.Sprintf("bucket=%s rules=%d", cfg.s3Bucket, len(rules)))
+	respondWithJSON(w, http.StatusOK, cfg.lifecycleResponse(rules))
+}
@@ -0,0 +1,33 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/s3local"
+)
+
+// localS3Path is where s3local is mounted when it stands in for both S3 and
+// CloudFront. The server's S3 client and presigned URLs point here too.
+const localS3Path = "/local/s3"
+
+// localS3Backend returns where objects are kept when AWS isn't used: in
+// memory with MOCK_AWS=true, so uploads are lost on restart, or in
+// devDataDir in dev mode. It returns nil when the real S3 should be used.
+func localS3Backend(devMode bool) (s3local.Backend, error) {
+	if mock := os.Getenv("MOCK_AWS"); mock != "" {
+		mockAWS, err := strconv.ParseBool(mock)
+		if err != nil {
+			return nil, fmt.Errorf("invalid MOCK_AWS: %w", err)
+		}
+		if mockAWS {
+			return s3local.NewMemory(), nil
+		}
+	}
+	if devMode {
+		return s3local.NewDir(filepath.Join(devDataDir, "s3")), nil
+	}
+	return nil, nil
+}
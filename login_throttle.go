@@ -0,0 +1,69 @@
+package main
+
+import (
+	"time"
+)
+
+const (
+	loginAttemptWindow = time.Hour
+	// loginFreeAttempts is how many failures are allowed before delays kick in.
+	loginFreeAttempts = 3
+	// loginLockoutAttempts is how many failures lock an account until the
+	// attempt window has passed.
+	loginLockoutAttempts   = 10
+	loginIPLockoutAttempts = 50
+	maxLoginDelay          = 15 * time.Minute
+)
+
+// loginDelay returns how long a client has to wait after its last failure
+// before another attempt is accepted. The delay doubles with every failure
+// past the free attempts and becomes a lockout once the threshold is reached.
+func loginDelay(failures, lockoutThreshold int) time.Duration {
+	if failures >= lockoutThreshold {
+		return loginAttemptWindow
+	}
+	if failures < loginFreeAttempts {
+		return 0
+	}
+	// Stop doubling at the cap, since shifting much further overflows.
+	delay := time.Second
+	for range failures - loginFreeAttempts {
+		delay *= 2
+		if delay >= maxLoginDelay {
+			return maxLoginDelay
+		}
+	}
+	return delay
+}
+
+// loginRetryAfter reports how long the caller must wait before trying to log
+// in with the given email from the given address, or zero if they may try now.
+func (cfg *apiConfig) loginRetryAfter(email, ip string) (time.Duration, error) {
+	now := time.Now().UTC()
+	since := now.Add(-loginAttemptWindow)
+
+	accountFailures, err := cfg.db.GetLoginFailuresForEmail(email, since)
+	if err != nil {
+		return 0, err
+	}
+	ipFailures, err := cfg.db.GetLoginFailuresForIP(ip, since)
+	if err != nil {
+		return 0, err
+	}
+
+	var wait time.Duration
+	if accountFailures.Count > 0 {
+		until := accountFailures.LastFailureAt.Add(loginDelay(accountFailures.Count, loginLockoutAttempts))
+		wait = until.Sub(now)
+	}
+	if ipFailures.Count > 0 {
+		until := ipFailures.LastFailureAt.Add(loginDelay(ipFailures.Count, loginIPLockoutAttempts))
+		if d := until.Sub(now); d > wait {
+			wait = d
+		}
+	}
+	if wait < 0 {
+		return 0, nil
+	}
+	return wait, nil
+}
@@ -0,0 +1,39 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestLoginDelay(t *testing.T) {
+	for _, threshold := range []int{loginLockoutAttempts, loginIPLockoutAttempts} {
+		prev := time.Duration(0)
+		for failures := 0; failures <= threshold; failures++ {
+			delay := loginDelay(failures, threshold)
+			switch {
+			case failures >= threshold:
+				if delay != loginAttemptWindow {
+					t.Errorf("loginDelay(%d, %d) = %s, want lockout of %s", failures, threshold, delay, loginAttemptWindow)
+				}
+			case failures < loginFreeAttempts:
+				if delay != 0 {
+					t.Errorf("loginDelay(%d, %d) = %s, want 0", failures, threshold, delay)
+				}
+			default:
+				if delay < prev || delay <= 0 || delay > maxLoginDelay {
+					t.Errorf("loginDelay(%d, %d) = %s, want between %s and %s", failures, threshold, delay, prev, maxLoginDelay)
+				}
+			}
+			prev = delay
+		}
+	}
+}
+
+func TestLoginDelayCapped(t *testing.T) {
+	if got := loginDelay(loginIPLockoutAttempts-1, loginIPLockoutAttempts); got != maxLoginDelay {
+		t.Errorf("loginDelay just before lockout = %s, want %s", got, maxLoginDelay)
+	}
+	if got := loginDelay(loginFreeAttempts, loginIPLockoutAttempts); got != time.Second {
+		t.Errorf("loginDelay at the first delayed attempt = %s, want 1s", got)
+	}
+}
@@ -2,13 +2,31 @@ package main
 
 import (
 	"context"
+	"io/fs"
 	"log"
+	"net"
 	"net/http"
 	"os"
+	"strconv"
+	"strings"
+	"time"
 
+	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/credentials"
+	"github.com/aws/aws-sdk-go-v2/feature/s3/manager"
 	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/sts"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/abuse"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/accesslog"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/billing"
 	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/errreport"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/inbound"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/mailer"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/s3local"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/storage"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/transcoder"
 
 	"github.com/joho/godotenv"
 	_ "github.com/lib/pq"
@@ -23,8 +41,97 @@ type apiConfig struct {
 	s3Bucket         string
 	s3Region         string
 	s3Client         *s3.Client
+	s3Presign        *s3.PresignClient
+	s3Downloader     *manager.Downloader
+	multipart        multipartConfig
 	s3CfDistribution string
 	port             string
+	baseURL          string
+	mailer           mailer.Client
+
+	// transcoder is nil when videos are processed locally with ffmpeg.
+	transcoder              transcoder.Transcoder
+	transcoderWebhookSecret string
+	defaultTranscodePreset  transcoder.Preset
+
+	adminEmails map[string]bool
+
+	// stripe is nil when billing is disabled and everyone is on the free plan.
+	stripe *billing.Stripe
+
+	// inboundEmail is nil when videos can't be sent in by email.
+	inboundEmail       *inbound.SNS
+	inboundEmailBucket string
+
+	// accessLogBucket is empty when delivery logs aren't ingested.
+	accessLogBucket string
+	accessLogPrefix string
+	accessLogFormat accesslog.Format
+
+	// drStore is nil when disaster recovery backups are disabled.
+	drStore storage.Store
+
+	// backupStore is nil when scheduled database backups are disabled. It's
+	// a separate bucket so snapshots are never reachable via CloudFront.
+	backupStore storage.Store
+
+	// claimsAutoUnlist withholds videos while a copyright claim against them
+	// is open or disputed.
+	claimsAutoUnlist bool
+
+	// sitemap is nil when SITEMAP_INTERVAL turns it off.
+	sitemap *sitemapCache
+
+	// metadataIndexKeys are the video metadata keys listings can filter on.
+	metadataIndexKeys map[string]bool
+
+	// urlAbuse is nil when abuse detection for delivery URLs is disabled.
+	urlAbuse *abuse.Detector
+	// planRateLimits are the limits of plans overriding urlAbuse's own.
+	planRateLimits *planRateLimitCache
+
+	securityHeaders securityHeaders
+
+	featureFlags *featureFlagCache
+	maintenance  *maintenanceCache
+	debugLog     *debugLogger
+
+	// processingWindows pause processing, queueing uploads meanwhile.
+	processingWindows *processingWindowCache
+	// thumbnails are generated from uploads after they respond.
+	thumbnails *thumbnailQueue
+	uploads    *uploadRegistry
+	// uploadSlots limit the uploads each user has in flight.
+	uploadSlots *uploadSlots
+	// tus keeps tus uploads while they arrive, see tus.go.
+	tus *tusStore
+	// acceptedVideoTypes are the media types video uploads may have.
+	acceptedVideoTypes []string
+	// processingMetricsRetention is how long processing metrics are kept,
+	// 0 for good.
+	processingMetricsRetention time.Duration
+
+	// errorReporter is nil unless SENTRY_DSN is set.
+	errorReporter errreport.Reporter
+	// uploadAudit is nil unless UPLOAD_AUDIT is set.
+	uploadAudit *uploadAuditor
+	lifecycle   lifecycleConfig
+	// reconcileIgnore are key prefixes reconciliation never counts as
+	// orphaned, see reconciliation.go.
+	reconcileIgnore []string
+
+	// keyScheme names new objects, see object_keys.go.
+	keyScheme string
+	// presignTTL is zero unless artifact URLs are presigned, see
+	// artifact_urls.go.
+	presignTTL time.Duration
+	// directUploads is nil unless clients can get credentials to upload
+	// straight to the bucket, see direct_upload.go.
+	directUploads *directUploader
+
+	// localS3 is nil unless the bucket is emulated by s3local, in dev mode
+	// or with MOCK_AWS.
+	localS3 s3local.Backend
 }
 
 type thumbnail struct {
@@ -34,13 +141,77 @@ type thumbnail struct {
 
 func main() {
 	godotenv.Load(".env")
+	devMode := len(os.Args) > 1 && os.Args[1] == "--dev"
+	if devMode {
+		if err := applyDevDefaults(); err != nil {
+			log.Fatalf("Couldn't set up dev mode: %v", err)
+		}
+	}
+	if err := loadDefaultConfig(); err != nil {
+		log.Fatalf("Couldn't load default config: %v", err)
+	}
+
+	if len(os.Args) > 1 && !devMode {
+		if err := runCommand(os.Args[1:]); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
 
 	pathToDB := os.Getenv("DB_PATH")
 	if pathToDB == "" {
 		log.Fatal("DB_URL must be set")
 	}
 
-	db, err := database.NewClient(pathToDB)
+	var err error
+	dbOptions := database.Options{
+		ReadDSN:          os.Getenv("DB_READ_PATH"),
+		StatementTimeout: 30 * time.Second,
+		VideoCacheTTL:    30 * time.Second,
+	}
+	if n := os.Getenv("DB_MAX_OPEN_CONNS"); n != "" {
+		dbOptions.MaxOpenConns, err = strconv.Atoi(n)
+		if err != nil {
+			log.Fatalf("Invalid DB_MAX_OPEN_CONNS: %v", err)
+		}
+	}
+	if n := os.Getenv("DB_MAX_IDLE_CONNS"); n != "" {
+		dbOptions.MaxIdleConns, err = strconv.Atoi(n)
+		if err != nil {
+			log.Fatalf("Invalid DB_MAX_IDLE_CONNS: %v", err)
+		}
+	}
+	if lifetime := os.Getenv("DB_CONN_MAX_LIFETIME"); lifetime != "" {
+		dbOptions.ConnMaxLifetime, err = time.ParseDuration(lifetime)
+		if err != nil {
+			log.Fatalf("Invalid DB_CONN_MAX_LIFETIME: %v", err)
+		}
+	}
+	if timeout := os.Getenv("DB_STATEMENT_TIMEOUT"); timeout != "" {
+		dbOptions.StatementTimeout, err = time.ParseDuration(timeout)
+		if err != nil {
+			log.Fatalf("Invalid DB_STATEMENT_TIMEOUT: %v", err)
+		}
+	}
+
+	if ttl := os.Getenv("VIDEO_CACHE_TTL"); ttl != "" {
+		// 0 disables the cache, e.g. when running more than one instance.
+		dbOptions.VideoCacheTTL, err = time.ParseDuration(ttl)
+		if err != nil {
+			log.Fatalf("Invalid VIDEO_CACHE_TTL: %v", err)
+		}
+	}
+
+	dbOptions.MetadataIndexKeys = parseMetadataIndexKeys(os.Getenv("METADATA_INDEXED_KEYS"))
+	metadataIndexKeys := map[string]bool{}
+	for _, key := range dbOptions.MetadataIndexKeys {
+		if !database.ValidMetadataKey(key) {
+			log.Fatalf("Invalid METADATA_INDEXED_KEYS: %q isn't a valid metadata key", key)
+		}
+		metadataIndexKeys[key] = true
+	}
+
+	db, err := database.NewClientWithOptions(pathToDB, dbOptions)
 	if err != nil {
 		log.Fatalf("Couldn't connect to database: %v", err)
 	}
@@ -55,9 +226,17 @@ func main() {
 		log.Fatal("PLATFORM environment variable is not set")
 	}
 
+	appFiles, err := fs.Sub(embeddedApp, "app")
+	if err != nil {
+		log.Fatal(err)
+	}
 	filepathRoot := os.Getenv("FILEPATH_ROOT")
-	if filepathRoot == "" {
-		log.Fatal("FILEPATH_ROOT environment variable is not set")
+	if filepathRoot != "" {
+		appFiles = os.DirFS(filepathRoot)
+	}
+	app, err := newFrontend(appFiles, "/app/")
+	if err != nil {
+		log.Fatalf("Couldn't load frontend: %v", err)
 	}
 
 	assetsRoot := os.Getenv("ASSETS_ROOT")
@@ -65,31 +244,390 @@ func main() {
 		log.Fatal("ASSETS_ROOT environment variable is not set")
 	}
 
+	localS3, err := localS3Backend(devMode)
+	if err != nil {
+		log.Fatal(err)
+	}
+
 	s3Bucket := os.Getenv("S3_BUCKET")
+	if s3Bucket == "" && localS3 != nil {
+		s3Bucket = "tubely"
+	}
 	if s3Bucket == "" {
 		log.Fatal("S3_BUCKET environment variable is not set")
 	}
 
 	s3Region := os.Getenv("S3_REGION")
+	if s3Region == "" && localS3 != nil {
+		s3Region = "us-east-1"
+	}
 	if s3Region == "" {
 		log.Fatal("S3_REGION environment variable is not set")
 	}
 
+	port := os.Getenv("PORT")
+	if port == "" {
+		log.Fatal("PORT environment variable is not set")
+	}
+
+	baseURL := os.Getenv("BASE_URL")
+	if baseURL == "" {
+		baseURL = "http://localhost:" + port
+	}
+
+	// With PRESIGN_TTL set the bucket can stay private: clients get URLs
+	// presigned for that long instead of S3_CF_DISTRO ones.
+	var presignTTL time.Duration
+	if ttl := os.Getenv("PRESIGN_TTL"); ttl != "" {
+		presignTTL, err = time.ParseDuration(ttl)
+		if err != nil {
+			log.Fatalf("Invalid PRESIGN_TTL: %v", err)
+		}
+	}
+
 	s3CfDistribution := os.Getenv("S3_CF_DISTRO")
+	if s3CfDistribution == "" && localS3 != nil {
+		s3CfDistribution = baseURL + localS3Path + "/" + s3Bucket
+	}
 	if s3CfDistribution == "" {
 		log.Fatal("S3_CF_DISTRO environment variable is not set")
 	}
 
-	port := os.Getenv("PORT")
-	if port == "" {
-		log.Fatal("PORT environment variable is not set")
+	mailClient := mailer.NewClient(
+		os.Getenv("SMTP_HOST"),
+		os.Getenv("SMTP_PORT"),
+		os.Getenv("SMTP_USERNAME"),
+		os.Getenv("SMTP_PASSWORD"),
+		os.Getenv("SMTP_FROM"),
+	)
+
+	s3HTTP, err := s3HTTPConfigFromEnv()
+	if err != nil {
+		log.Fatal(err)
+	}
+	awsOptions := []func(*config.LoadOptions) error{config.WithRegion(s3Region), config.WithHTTPClient(s3HTTP.client())}
+	if localS3 != nil {
+		awsOptions = append(awsOptions,
+			config.WithCredentialsProvider(credentials.NewStaticCredentialsProvider("local", "local", "")),
+		)
+	}
+	awsConfig, err := config.LoadDefaultConfig(context.TODO(), awsOptions...)
+	if err != nil {
+		log.Fatal(err)
+	}
+	access, err := bucketAccessFromEnv(s3Bucket)
+	if err != nil {
+		log.Fatal(err)
+	}
+	// Fault injection is for testing retries and cleanup, never production.
+	s3Faults, mediaFaultRule, err := faultRulesFromEnv()
+	if err != nil {
+		log.Fatal(err)
+	}
+	if s3Faults != (faultRule{}) {
+		log.Printf("WARNING: injecting faults into S3 calls: %s", s3Faults)
+	}
+	if mediaFaultRule != (faultRule{}) {
+		log.Printf("WARNING: injecting faults into ffmpeg and ffprobe runs: %s", mediaFaultRule)
+		mediaFaults = mediaFaultRule
+	}
+	client := s3.NewFromConfig(awsConfig, tagS3Errors, injectS3Faults(s3Faults), access.options(awsConfig), func(o *s3.Options) {
+		if localS3 != nil {
+			// The server talks to its own s3local route.
+			o.BaseEndpoint = aws.String("http://localhost:" + port + localS3Path)
+			o.UsePathStyle = true
+		}
+	})
+	go warmCredentials(awsConfig)
+	s3Downloader, err := newS3Downloader(client)
+	if err != nil {
+		log.Fatal(err)
+	}
+	multipart, err := multipartConfigFromEnv()
+	if err != nil {
+		log.Fatal(err)
 	}
 
-	awsConfig, err := config.LoadDefaultConfig(context.TODO())
+	var videoTranscoder transcoder.Transcoder
+	transcoderWebhookSecret := os.Getenv("TRANSCODER_WEBHOOK_SECRET")
+	defaultTranscodePreset := transcoder.PresetHD
+	if preset := os.Getenv("TRANSCODER_DEFAULT_PRESET"); preset != "" {
+		defaultTranscodePreset, err = transcoder.ParsePreset(preset)
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+	switch mode := os.Getenv("TRANSCODER"); mode {
+	case "", "ffmpeg":
+	case "mediaconvert":
+		if localS3 != nil {
+			log.Fatal("TRANSCODER=mediaconvert needs a real bucket, it can't be used with local storage")
+		}
+		roleARN := os.Getenv("MEDIACONVERT_ROLE_ARN")
+		if roleARN == "" {
+			log.Fatal("MEDIACONVERT_ROLE_ARN environment variable is not set")
+		}
+		if transcoderWebhookSecret == "" {
+			log.Fatal("TRANSCODER_WEBHOOK_SECRET environment variable is not set")
+		}
+		// MEDIACONVERT_TEMPLATES maps presets to job templates, e.g. "sd=Tubely-SD,hd=Tubely-HD"
+		templates := map[transcoder.Preset]string{}
+		for _, pair := range strings.Split(os.Getenv("MEDIACONVERT_TEMPLATES"), ",") {
+			if pair == "" {
+				continue
+			}
+			name, template, ok := strings.Cut(pair, "=")
+			preset, err := transcoder.ParsePreset(strings.TrimSpace(name))
+			if !ok || err != nil {
+				log.Fatalf("Invalid MEDIACONVERT_TEMPLATES entry %q", pair)
+			}
+			templates[preset] = strings.TrimSpace(template)
+		}
+		videoTranscoder = transcoder.NewMediaConvert(awsConfig, s3Bucket, roleARN, os.Getenv("MEDIACONVERT_QUEUE"), templates)
+	default:
+		log.Fatalf("Unknown TRANSCODER %q, expected ffmpeg or mediaconvert", mode)
+	}
+
+	// With UPLOAD_ROLE_ARN set, clients can ask for credentials scoped to
+	// one video's upload prefix and upload with an AWS SDK.
+	var directUploads *directUploader
+	if roleARN := os.Getenv("UPLOAD_ROLE_ARN"); roleARN != "" {
+		if localS3 != nil {
+			log.Fatal("UPLOAD_ROLE_ARN needs a real bucket, it can't be used with local storage")
+		}
+		ttl := defaultUploadCredentialsTTL
+		if v := os.Getenv("UPLOAD_CREDENTIALS_TTL"); v != "" {
+			ttl, err = time.ParseDuration(v)
+			if err != nil {
+				log.Fatalf("Invalid UPLOAD_CREDENTIALS_TTL: %v", err)
+			}
+			if ttl < minUploadCredentialsTTL || ttl > maxUploadCredentialsTTL {
+				log.Fatalf("Invalid UPLOAD_CREDENTIALS_TTL: must be between %v and %v", minUploadCredentialsTTL, maxUploadCredentialsTTL)
+			}
+		}
+		directUploads = &directUploader{sts: sts.NewFromConfig(awsConfig), roleARN: roleARN, ttl: ttl}
+	}
+
+	var stripeClient *billing.Stripe
+	if stripeKey := os.Getenv("STRIPE_SECRET_KEY"); stripeKey != "" {
+		stripeWebhookSecret := os.Getenv("STRIPE_WEBHOOK_SECRET")
+		if stripeWebhookSecret == "" {
+			log.Fatal("STRIPE_WEBHOOK_SECRET environment variable is not set")
+		}
+		stripePriceID := os.Getenv("STRIPE_PRO_PRICE_ID")
+		if stripePriceID == "" {
+			log.Fatal("STRIPE_PRO_PRICE_ID environment variable is not set")
+		}
+		stripeClient = billing.NewStripe(stripeKey, stripeWebhookSecret, stripePriceID)
+	}
+
+	// INBOUND_EMAIL_TOPIC_ARN is the SNS topic SES publishes received mail
+	// to, which is subscribed to /api/webhooks/inbound_email.
+	var inboundEmail *inbound.SNS
+	if topicARN := os.Getenv("INBOUND_EMAIL_TOPIC_ARN"); topicARN != "" {
+		inboundEmail = inbound.NewSNS(topicARN)
+	}
+
+	accessLogFormat := accesslog.FormatCloudFront
+	if format := os.Getenv("ACCESS_LOG_FORMAT"); format != "" {
+		accessLogFormat, err = accesslog.ParseFormat(format)
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+	accessLogInterval := time.Hour
+	if interval := os.Getenv("ACCESS_LOG_INTERVAL"); interval != "" {
+		accessLogInterval, err = time.ParseDuration(interval)
+		if err != nil {
+			log.Fatalf("Invalid ACCESS_LOG_INTERVAL: %v", err)
+		}
+	}
+
+	drStore, err := drStoreFromEnv()
 	if err != nil {
 		log.Fatal(err)
 	}
-	client := s3.NewFromConfig(awsConfig)
+	drInterval := 24 * time.Hour
+	if interval := os.Getenv("DR_BACKUP_INTERVAL"); interval != "" {
+		drInterval, err = time.ParseDuration(interval)
+		if err != nil {
+			log.Fatalf("Invalid DR_BACKUP_INTERVAL: %v", err)
+		}
+	}
+
+	var backupStore storage.Store
+	if bucket := os.Getenv("DB_BACKUP_BUCKET"); bucket != "" {
+		// Backups stay in the app's account, whatever S3_ROLE_ARN is.
+		backupStore = storage.NewS3(s3.NewFromConfig(awsConfig, tagS3Errors), bucket)
+	}
+	backupInterval := 6 * time.Hour
+	if interval := os.Getenv("DB_BACKUP_INTERVAL"); interval != "" {
+		backupInterval, err = time.ParseDuration(interval)
+		if err != nil {
+			log.Fatalf("Invalid DB_BACKUP_INTERVAL: %v", err)
+		}
+	}
+
+	var errorReporter errreport.Reporter
+	if dsn := os.Getenv("SENTRY_DSN"); dsn != "" {
+		sentry, err := errreport.NewSentry(dsn)
+		if err != nil {
+			log.Fatalf("Invalid SENTRY_DSN: %v", err)
+		}
+		sentry.Release = readBuildInfo().Version
+		sentry.Environment = platform
+		errorReporter = sentry
+	}
+
+	var uploadAudit *uploadAuditor
+	if audit := os.Getenv("UPLOAD_AUDIT"); audit != "" {
+		enabled, err := strconv.ParseBool(audit)
+		if err != nil {
+			log.Fatalf("Invalid UPLOAD_AUDIT: %v", err)
+		}
+		if enabled {
+			uploadAudit = newUploadAuditor()
+		}
+	}
+
+	lifecycle, err := lifecycleConfigFromEnv()
+	if err != nil {
+		log.Fatalf("Invalid lifecycle configuration: %v", err)
+	}
+
+	// UPLOAD_CONCURRENCY_PER_USER=0 turns the limit off.
+	uploadsPerUser := 3
+	if n := os.Getenv("UPLOAD_CONCURRENCY_PER_USER"); n != "" {
+		uploadsPerUser, err = strconv.Atoi(n)
+		if err != nil || uploadsPerUser < 0 {
+			log.Fatalf("Invalid UPLOAD_CONCURRENCY_PER_USER %q, expected a number", n)
+		}
+	}
+
+	tus, err := tusStoreFromEnv()
+	if err != nil {
+		log.Fatalf("Couldn't create TUS_DIR: %v", err)
+	}
+
+	acceptedVideoTypes, err := acceptedVideoTypesFromEnv()
+	if err != nil {
+		log.Fatalf("Invalid ACCEPTED_VIDEO_TYPES: %v", err)
+	}
+
+	thumbnailWorkers := 2
+	if n := os.Getenv("THUMBNAIL_WORKERS"); n != "" {
+		thumbnailWorkers, err = strconv.Atoi(n)
+		if err != nil || thumbnailWorkers < 1 {
+			log.Fatalf("Invalid THUMBNAIL_WORKERS %q, expected a positive number", n)
+		}
+	}
+
+	reconcileInterval := 24 * time.Hour
+	if interval := os.Getenv("RECONCILE_INTERVAL"); interval != "" {
+		reconcileInterval, err = time.ParseDuration(interval)
+		if err != nil {
+			log.Fatalf("Invalid RECONCILE_INTERVAL: %v", err)
+		}
+	}
+
+	videoExpiryInterval := 5 * time.Minute
+	if interval := os.Getenv("VIDEO_EXPIRY_INTERVAL"); interval != "" {
+		videoExpiryInterval, err = time.ParseDuration(interval)
+		if err != nil {
+			log.Fatalf("Invalid VIDEO_EXPIRY_INTERVAL: %v", err)
+		}
+	}
+
+	// PROCESSING_METRICS_RETENTION=0 keeps processing metrics for good.
+	processingMetricsRetention := defaultProcessingMetricsRetention
+	if retention := os.Getenv("PROCESSING_METRICS_RETENTION"); retention != "" {
+		processingMetricsRetention, err = time.ParseDuration(retention)
+		if err != nil || processingMetricsRetention < 0 {
+			log.Fatalf("Invalid PROCESSING_METRICS_RETENTION %q, expected a duration like 2160h", retention)
+		}
+	}
+
+	// SITEMAP_INTERVAL=0 turns the sitemap off.
+	sitemapInterval := time.Hour
+	if interval := os.Getenv("SITEMAP_INTERVAL"); interval != "" {
+		sitemapInterval, err = time.ParseDuration(interval)
+		if err != nil {
+			log.Fatalf("Invalid SITEMAP_INTERVAL: %v", err)
+		}
+	}
+
+	// CMS_SYNC_INTERVAL=0 stops pushing to CMS syncs, which still queue
+	// events.
+	cmsSyncInterval := 15 * time.Second
+	if interval := os.Getenv("CMS_SYNC_INTERVAL"); interval != "" {
+		cmsSyncInterval, err = time.ParseDuration(interval)
+		if err != nil {
+			log.Fatalf("Invalid CMS_SYNC_INTERVAL: %v", err)
+		}
+	}
+
+	keyScheme := keySchemeV2
+	if scheme := os.Getenv("KEY_SCHEME"); scheme != "" {
+		keyScheme, err = parseKeyScheme(scheme)
+		if err != nil {
+			log.Fatalf("Invalid KEY_SCHEME: %v", err)
+		}
+	}
+
+	claimsAutoUnlist := false
+	if unlist := os.Getenv("CLAIMS_AUTO_UNLIST"); unlist != "" {
+		claimsAutoUnlist, err = strconv.ParseBool(unlist)
+		if err != nil {
+			log.Fatalf("Invalid CLAIMS_AUTO_UNLIST: %v", err)
+		}
+	}
+
+	// URL_ABUSE_MAX_REQUESTS=0 disables abuse detection.
+	abuseLimits := abuse.Limits{
+		Window:      time.Minute,
+		MaxRequests: 600,
+		MaxDistinct: 300,
+		BlockFor:    15 * time.Minute,
+	}
+	if n := os.Getenv("URL_ABUSE_MAX_REQUESTS"); n != "" {
+		abuseLimits.MaxRequests, err = strconv.Atoi(n)
+		if err != nil {
+			log.Fatalf("Invalid URL_ABUSE_MAX_REQUESTS: %v", err)
+		}
+	}
+	if n := os.Getenv("URL_ABUSE_MAX_DISTINCT"); n != "" {
+		abuseLimits.MaxDistinct, err = strconv.Atoi(n)
+		if err != nil {
+			log.Fatalf("Invalid URL_ABUSE_MAX_DISTINCT: %v", err)
+		}
+	}
+	if n := os.Getenv("URL_ABUSE_BURST"); n != "" {
+		abuseLimits.Burst, err = strconv.Atoi(n)
+		if err != nil {
+			log.Fatalf("Invalid URL_ABUSE_BURST: %v", err)
+		}
+	}
+	if d := os.Getenv("URL_ABUSE_BLOCK_DURATION"); d != "" {
+		abuseLimits.BlockFor, err = time.ParseDuration(d)
+		if err != nil {
+			log.Fatalf("Invalid URL_ABUSE_BLOCK_DURATION: %v", err)
+		}
+	}
+	var urlAbuse *abuse.Detector
+	if abuseLimits.MaxRequests > 0 {
+		urlAbuse = abuse.NewDetector(abuseLimits)
+	}
+
+	headers := defaultSecurityHeaders(baseURL, s3CfDistribution, "http://localhost:"+port)
+	if csp := os.Getenv("CONTENT_SECURITY_POLICY"); csp != "" {
+		headers.contentSecurityPolicy = csp
+	}
+	if csp := os.Getenv("EMBED_CONTENT_SECURITY_POLICY"); csp != "" {
+		headers.embedContentSecurityPolicy = csp
+	}
+	if policy := os.Getenv("REFERRER_POLICY"); policy != "" {
+		headers.referrerPolicy = policy
+	}
 
 	cfg := apiConfig{
 		db:               db,
@@ -99,9 +637,66 @@ func main() {
 		assetsRoot:       assetsRoot,
 		s3Bucket:         s3Bucket,
 		s3Client:         client,
+		s3Presign:        s3.NewPresignClient(client),
+		s3Downloader:     s3Downloader,
+		multipart:        multipart,
 		s3Region:         s3Region,
 		s3CfDistribution: s3CfDistribution,
 		port:             port,
+		baseURL:          baseURL,
+		mailer:           mailClient,
+
+		transcoder:              videoTranscoder,
+		transcoderWebhookSecret: transcoderWebhookSecret,
+		defaultTranscodePreset:  defaultTranscodePreset,
+
+		adminEmails: parseAdminEmails(os.Getenv("ADMIN_EMAILS")),
+
+		stripe: stripeClient,
+
+		inboundEmail:       inboundEmail,
+		inboundEmailBucket: os.Getenv("INBOUND_EMAIL_BUCKET"),
+
+		accessLogBucket: os.Getenv("ACCESS_LOG_BUCKET"),
+		accessLogPrefix: os.Getenv("ACCESS_LOG_PREFIX"),
+		accessLogFormat: accessLogFormat,
+
+		drStore:     drStore,
+		backupStore: backupStore,
+
+		claimsAutoUnlist: claimsAutoUnlist,
+
+		metadataIndexKeys: metadataIndexKeys,
+
+		urlAbuse:       urlAbuse,
+		planRateLimits: &planRateLimitCache{},
+
+		securityHeaders: headers,
+
+		featureFlags: &featureFlagCache{},
+		maintenance:  &maintenanceCache{},
+		debugLog:     newDebugLogger(os.Getenv("DEBUG_LOG_ROUTES")),
+
+		processingWindows: &processingWindowCache{},
+		thumbnails:        newThumbnailQueue(),
+		uploads:           newUploadRegistry(),
+		uploadSlots:       newUploadSlots(uploadsPerUser),
+		tus:               tus,
+
+		acceptedVideoTypes: acceptedVideoTypes,
+
+		errorReporter:   errorReporter,
+		uploadAudit:     uploadAudit,
+		lifecycle:       lifecycle,
+		reconcileIgnore: reconcileIgnorePrefixesFromEnv(),
+
+		processingMetricsRetention: processingMetricsRetention,
+
+		keyScheme:     keyScheme,
+		presignTTL:    presignTTL,
+		directUploads: directUploads,
+
+		localS3: localS3,
 	}
 
 	err = cfg.ensureAssetsDir()
@@ -109,33 +704,239 @@ func main() {
 		log.Fatalf("Couldn't create assets directory: %v", err)
 	}
 
+	preflightMode := os.Getenv("PREFLIGHT")
+	switch preflightMode {
+	case "":
+		preflightMode = preflightWarn
+	case preflightStrict, preflightWarn, preflightOff:
+	default:
+		log.Fatalf("Unknown PREFLIGHT %q, expected strict, warn or off", preflightMode)
+	}
+	if err := cfg.preflight(context.Background(), preflightMode); err != nil {
+		log.Fatal(err)
+	}
+
+	if n, err := cfg.db.InterruptVideoImports(importInterruptedMessage); err != nil {
+		log.Fatalf("Couldn't clean up interrupted imports: %v", err)
+	} else if n > 0 {
+		log.Printf("Marked %d imports interrupted by a restart", n)
+	}
+
+	if cfg.accessLogBucket != "" {
+		go runPeriodically(context.Background(), "access log ingestion", accessLogInterval, func(ctx context.Context) error {
+			_, err := cfg.ingestAccessLogs(ctx)
+			return err
+		})
+	}
+
+	if cfg.drStore != nil {
+		go runPeriodically(context.Background(), "disaster recovery backup", drInterval, cfg.runDRBackup)
+	}
+
+	if cfg.backupStore != nil {
+		go runPeriodically(context.Background(), "database backup", backupInterval, func(ctx context.Context) error {
+			_, err := uploadDBSnapshot(ctx, cfg.db, cfg.backupStore, dbBackupPrefix)
+			return err
+		})
+	}
+
+	go runPeriodically(context.Background(), "upload session expiry", uploadSessionCleanupInterval, cfg.runUploadSessionExpiry)
+	go runPeriodically(context.Background(), "tus upload expiry", uploadSessionCleanupInterval, cfg.runTusUploadExpiry)
+	go runPeriodically(context.Background(), "processing queue", processingQueueInterval, cfg.runProcessingQueue)
+	cfg.runThumbnailWorkers(thumbnailWorkers)
+	go runPeriodically(context.Background(), "thumbnail jobs", thumbnailJobInterval, cfg.runThumbnailJobs)
+
+	if processingMetricsRetention > 0 {
+		go runPeriodically(context.Background(), "processing metrics retention", processingMetricsRetentionInterval, cfg.runProcessingMetricsRetention)
+	}
+	if reconcileInterval > 0 {
+		go runPeriodically(context.Background(), "bucket reconciliation", reconcileInterval, cfg.runReconciliation)
+	}
+
+	if videoExpiryInterval > 0 {
+		go runPeriodically(context.Background(), "video expiry", videoExpiryInterval, cfg.runVideoExpiry)
+	}
+
+	if sitemapInterval > 0 {
+		cfg.sitemap = &sitemapCache{}
+		go runPeriodically(context.Background(), "sitemap generation", sitemapInterval, cfg.runSitemap)
+	}
+
+	if cmsSyncInterval > 0 {
+		go runPeriodically(context.Background(), "CMS sync", cmsSyncInterval, cfg.runCMSSync)
+	}
+
 	mux := http.NewServeMux()
-	appHandler := http.StripPrefix("/app", http.FileServer(http.Dir(filepathRoot)))
+	appHandler := http.StripPrefix("/app", app)
 	mux.Handle("/app/", appHandler)
 
-	assetsHandler := http.StripPrefix("/assets", http.FileServer(http.Dir(assetsRoot)))
-	mux.Handle("/assets/", noCacheMiddleware(assetsHandler))
+	assetsHandler := http.StripPrefix("/assets", assetCacheMiddleware(assetsRoot, http.FileServer(http.Dir(assetsRoot))))
+	mux.Handle("/assets/", assetsHandler)
+
+	if localS3 != nil {
+		mux.Handle(localS3Path+"/", http.StripPrefix(localS3Path, s3local.New(localS3)))
+	}
+
+	mux.HandleFunc("GET /api/build_info", handlerBuildInfo)
+	mux.HandleFunc("GET /api/openapi.json", handlerOpenAPI)
 
 	mux.HandleFunc("POST /api/login", cfg.handlerLogin)
 	mux.HandleFunc("POST /api/refresh", cfg.handlerRefresh)
 	mux.HandleFunc("POST /api/revoke", cfg.handlerRevoke)
 
 	mux.HandleFunc("POST /api/users", cfg.handlerUsersCreate)
+	mux.HandleFunc("GET /api/users/me/sessions", cfg.handlerSessionsList)
+	mux.HandleFunc("GET /api/users/me/features", cfg.handlerFeaturesGet)
+	mux.HandleFunc("DELETE /api/users/me/sessions/{sessionID}", cfg.handlerSessionRevoke)
+	mux.HandleFunc("POST /api/password_reset", cfg.handlerPasswordResetRequest)
+	mux.HandleFunc("POST /api/password_reset/confirm", cfg.handlerPasswordResetConfirm)
+	mux.HandleFunc("POST /api/email_verification", cfg.handlerEmailVerificationSend)
+	mux.HandleFunc("POST /api/email_verification/confirm", cfg.handlerEmailVerificationConfirm)
 
 	mux.HandleFunc("POST /api/videos", cfg.handlerVideoMetaCreate)
 	mux.HandleFunc("POST /api/thumbnail_upload/{videoID}", cfg.handlerUploadThumbnail)
 	mux.HandleFunc("POST /api/video_upload/{videoID}", cfg.handlerUploadVideo)
+	mux.HandleFunc("POST /api/video_upload/{videoID}/handshake", cfg.handlerUploadHandshake)
+	mux.HandleFunc("POST /api/video_upload/{videoID}/credentials", cfg.handlerUploadCredentials)
+	mux.HandleFunc("POST /api/video_upload/{videoID}/presign", cfg.handlerUploadPresign)
+	mux.HandleFunc("POST /api/video_upload/{videoID}/complete", cfg.handlerUploadComplete)
+	mux.HandleFunc("POST /api/video_upload/{videoID}/sessions", cfg.handlerUploadSessionCreate)
+	mux.HandleFunc("GET /api/upload_sessions/{token}", cfg.handlerUploadSessionGet)
+	mux.HandleFunc("PUT /api/upload_sessions/{token}/parts/{partNumber}", cfg.handlerUploadSessionPartPut)
+	mux.HandleFunc("POST /api/upload_sessions/{token}/complete", cfg.handlerUploadSessionComplete)
+	mux.HandleFunc("DELETE /api/upload_sessions/{token}", cfg.handlerUploadSessionDelete)
+	mux.HandleFunc("GET /api/processing_estimate", cfg.handlerProcessingEstimate)
+	mux.HandleFunc("OPTIONS /api/video_upload/{videoID}/tus", cfg.handlerTusOptions)
+	mux.HandleFunc("POST /api/video_upload/{videoID}/tus", cfg.handlerTusCreate)
+	mux.HandleFunc("OPTIONS /api/tus/{uploadID}", cfg.handlerTusOptions)
+	mux.HandleFunc("HEAD /api/tus/{uploadID}", cfg.handlerTusHead)
+	mux.HandleFunc("PATCH /api/tus/{uploadID}", cfg.handlerTusPatch)
+	mux.HandleFunc("DELETE /api/tus/{uploadID}", cfg.handlerTusDelete)
+	mux.HandleFunc("PUT /api/videos/{videoID}/audio_description", cfg.handlerAudioDescriptionUpload)
+	mux.HandleFunc("DELETE /api/videos/{videoID}/audio_description", cfg.handlerAudioDescriptionDelete)
+	mux.HandleFunc("PUT /api/videos/{videoID}/audio_tracks/{language}", cfg.handlerAudioTrackUpload)
+	mux.HandleFunc("DELETE /api/videos/{videoID}/audio_tracks/{language}", cfg.handlerAudioTrackDelete)
 	mux.HandleFunc("GET /api/videos", cfg.handlerVideosRetrieve)
 	mux.HandleFunc("GET /api/videos/{videoID}", cfg.handlerVideoGet)
+	mux.HandleFunc("PATCH /api/videos/{videoID}", cfg.handlerVideoPatch)
 	mux.HandleFunc("DELETE /api/videos/{videoID}", cfg.handlerVideoMetaDelete)
+	mux.HandleFunc("GET /api/videos/{videoID}/meta", cfg.handlerVideoMetaGet)
+	mux.HandleFunc("GET /api/videos/{videoID}/renditions", cfg.handlerRenditionsGet)
+	mux.HandleFunc("PUT /api/videos/{videoID}/password", cfg.handlerVideoPasswordSet)
+	mux.HandleFunc("DELETE /api/videos/{videoID}/password", cfg.handlerVideoPasswordDelete)
+	mux.HandleFunc("PUT /api/videos/{videoID}/expiry", cfg.handlerVideoExpirySet)
+	mux.HandleFunc("DELETE /api/videos/{videoID}/expiry", cfg.handlerVideoExpiryDelete)
+	mux.HandleFunc("GET /api/videos/{videoID}/download", cfg.handlerVideoDownload)
+	mux.HandleFunc("PUT /api/videos/{videoID}/downloads", cfg.handlerVideoDownloadsSet)
+	mux.HandleFunc("PUT /api/videos/{videoID}/metadata", cfg.handlerVideoMetadataSet)
+	mux.HandleFunc("POST /api/videos/batch", cfg.handlerVideosBatch)
+	mux.HandleFunc("POST /api/presign", cfg.handlerPresign)
+	mux.HandleFunc("GET /api/videos/{videoID}/delivery_stats", cfg.handlerVideoDeliveryStats)
+	mux.HandleFunc("POST /api/videos/{videoID}/appeal", cfg.handlerTakedownAppeal)
+	mux.HandleFunc("POST /api/videos/{videoID}/claims", cfg.handlerClaimCreate)
+	mux.HandleFunc("GET /api/videos/{videoID}/claims", cfg.handlerClaimsForVideo)
+	mux.HandleFunc("POST /api/claims/{claimID}/dispute", cfg.handlerClaimDispute)
+	mux.HandleFunc("POST /api/videos/{videoID}/embed_tokens", cfg.handlerEmbedTokenCreate)
+	mux.HandleFunc("GET /api/videos/{videoID}/embed_tokens", cfg.handlerEmbedTokensList)
+	mux.HandleFunc("DELETE /api/videos/{videoID}/embed_tokens/{token}", cfg.handlerEmbedTokenDelete)
+	mux.HandleFunc("POST /api/videos/{videoID}/slugs", cfg.handlerSlugCreate)
+	mux.HandleFunc("GET /api/videos/{videoID}/slugs", cfg.handlerSlugsList)
+	mux.HandleFunc("DELETE /api/videos/{videoID}/slugs/{slug}", cfg.handlerSlugDelete)
+	mux.HandleFunc("GET /api/videos/{videoID}/share/qr.png", cfg.handlerShareQR)
+	mux.HandleFunc("POST /api/cms_syncs", cfg.handlerCMSSyncCreate)
+	mux.HandleFunc("GET /api/cms_syncs", cfg.handlerCMSSyncsList)
+	mux.HandleFunc("DELETE /api/cms_syncs/{syncID}", cfg.handlerCMSSyncDelete)
+	mux.HandleFunc("GET /api/cms_syncs/{syncID}/events", cfg.handlerCMSSyncEvents)
+	mux.HandleFunc("POST /api/cms_syncs/{syncID}/replay", cfg.handlerCMSSyncReplay)
+	mux.HandleFunc("GET /v/{slug}", cfg.handlerSharePage)
+	mux.HandleFunc("GET /sitemap.xml", cfg.handlerSitemap)
+	mux.HandleFunc("GET /robots.txt", cfg.handlerRobots)
+	mux.HandleFunc("GET /v/{slug}/video", cfg.handlerSlugRedirect)
+
+	mux.HandleFunc("GET /embed/{id}", cfg.handlerEmbedPlayer)
+	mux.HandleFunc("GET /embed/{videoID}/media", cfg.handlerEmbedMedia)
+	mux.HandleFunc("GET /oembed", cfg.handlerOEmbed)
+
+	mux.HandleFunc("POST /api/webhooks/transcoder", cfg.handlerTranscoderWebhook)
+	mux.HandleFunc("POST /api/webhooks/stripe", cfg.handlerStripeWebhook)
+	mux.HandleFunc("POST /api/webhooks/inbound_email", cfg.handlerInboundEmailWebhook)
+
+	mux.HandleFunc("GET /api/users/me/usage", cfg.handlerUsageGet)
+	mux.HandleFunc("GET /api/users/me/videos/export", cfg.handlerVideosExport)
+	mux.HandleFunc("POST /api/imports/youtube", cfg.handlerVideoImportCreate)
+	mux.HandleFunc("GET /api/imports", cfg.handlerVideoImportsList)
+	mux.HandleFunc("GET /api/imports/{importID}", cfg.handlerVideoImportGet)
+	mux.HandleFunc("GET /api/billing/plan", cfg.handlerBillingPlanGet)
+	mux.HandleFunc("POST /api/billing/checkout", cfg.handlerBillingCheckout)
+
+	mux.HandleFunc("GET /api/admin/stats", cfg.middlewareAdminOnly(cfg.handlerAdminStats))
+	mux.HandleFunc("GET /api/admin/preflight", cfg.middlewareAdminOnly(cfg.handlerAdminPreflight))
+	mux.HandleFunc("GET /api/admin/diagnostics", cfg.middlewareAdminOnly(cfg.handlerAdminDiagnostics))
+	mux.HandleFunc("GET /api/admin/lifecycle", cfg.middlewareAdminOnly(cfg.handlerAdminLifecycleGet))
+	mux.HandleFunc("PUT /api/admin/lifecycle", cfg.middlewareAdminOnly(cfg.handlerAdminLifecycleApply))
+	mux.HandleFunc("GET /api/admin/reconciliation", cfg.middlewareAdminOnly(cfg.handlerAdminReconciliationGet))
+	mux.HandleFunc("GET /api/admin/usage", cfg.middlewareAdminOnly(cfg.handlerAdminUsageList))
+	mux.HandleFunc("POST /api/admin/storage_usage/recalculate", cfg.middlewareAdminOnly(cfg.handlerAdminStorageUsageRecalculate))
+	mux.HandleFunc("GET /api/admin/costs", cfg.middlewareAdminOnly(cfg.handlerAdminCosts))
+	mux.HandleFunc("GET /api/admin/processing_metrics", cfg.middlewareAdminOnly(cfg.handlerAdminProcessingMetrics))
+	mux.HandleFunc("GET /api/admin/backups", cfg.middlewareAdminOnly(cfg.handlerAdminBackupsList))
+	mux.HandleFunc("POST /api/admin/backups", cfg.middlewareAdminOnly(cfg.handlerAdminBackupCreate))
+	mux.HandleFunc("POST /api/admin/access_logs/ingest", cfg.middlewareAdminOnly(cfg.handlerAdminIngestAccessLogs))
+	mux.HandleFunc("GET /api/admin/notification_channels", cfg.middlewareAdminOnly(cfg.handlerNotificationChannelsList))
+	mux.HandleFunc("POST /api/admin/notification_channels", cfg.middlewareAdminOnly(cfg.handlerNotificationChannelCreate))
+	mux.HandleFunc("POST /api/admin/notification_channels/test", cfg.middlewareAdminOnly(cfg.handlerNotificationChannelTest))
+	mux.HandleFunc("DELETE /api/admin/notification_channels/{channelID}", cfg.middlewareAdminOnly(cfg.handlerNotificationChannelDelete))
+	mux.HandleFunc("GET /api/admin/http_actions", cfg.middlewareAdminOnly(cfg.handlerHTTPActionsList))
+	mux.HandleFunc("POST /api/admin/http_actions", cfg.middlewareAdminOnly(cfg.handlerHTTPActionCreate))
+	mux.HandleFunc("POST /api/admin/http_actions/{actionID}/test", cfg.middlewareAdminOnly(cfg.handlerHTTPActionTest))
+	mux.HandleFunc("DELETE /api/admin/http_actions/{actionID}", cfg.middlewareAdminOnly(cfg.handlerHTTPActionDelete))
+	mux.HandleFunc("GET /api/admin/takedowns", cfg.middlewareAdminOnly(cfg.handlerAdminTakedownsList))
+	mux.HandleFunc("POST /api/admin/takedowns/{videoID}", cfg.middlewareAdminOnly(cfg.handlerAdminTakedownCreate))
+	mux.HandleFunc("DELETE /api/admin/takedowns/{videoID}", cfg.middlewareAdminOnly(cfg.handlerAdminTakedownDelete))
+	mux.HandleFunc("POST /api/admin/takedowns/{videoID}/uphold", cfg.middlewareAdminOnly(cfg.handlerAdminTakedownUphold))
+	mux.HandleFunc("GET /api/admin/claims", cfg.middlewareAdminOnly(cfg.handlerAdminClaimsList))
+	mux.HandleFunc("POST /api/admin/claims/{claimID}/resolve", cfg.middlewareAdminOnly(cfg.handlerAdminClaimResolve))
+	mux.HandleFunc("GET /api/admin/maintenance", cfg.middlewareAdminOnly(cfg.handlerAdminMaintenanceGet))
+	mux.HandleFunc("PUT /api/admin/maintenance", cfg.middlewareAdminOnly(cfg.handlerAdminMaintenanceStart))
+	mux.HandleFunc("DELETE /api/admin/maintenance", cfg.middlewareAdminOnly(cfg.handlerAdminMaintenanceEnd))
+	mux.HandleFunc("GET /api/admin/processing_windows", cfg.middlewareAdminOnly(cfg.handlerAdminProcessingWindowsList))
+	mux.HandleFunc("POST /api/admin/processing_windows", cfg.middlewareAdminOnly(cfg.handlerAdminProcessingWindowCreate))
+	mux.HandleFunc("DELETE /api/admin/processing_windows/{windowID}", cfg.middlewareAdminOnly(cfg.handlerAdminProcessingWindowDelete))
+	mux.HandleFunc("GET /api/admin/feature_flags", cfg.middlewareAdminOnly(cfg.handlerAdminFeatureFlagsList))
+	mux.HandleFunc("PUT /api/admin/feature_flags/{name}", cfg.middlewareAdminOnly(cfg.handlerAdminFeatureFlagSet))
+	mux.HandleFunc("DELETE /api/admin/feature_flags/{name}", cfg.middlewareAdminOnly(cfg.handlerAdminFeatureFlagDelete))
+	mux.HandleFunc("GET /api/admin/debug_logging", cfg.middlewareAdminOnly(cfg.handlerAdminDebugLoggingGet))
+	mux.HandleFunc("PUT /api/admin/debug_logging", cfg.middlewareAdminOnly(cfg.handlerAdminDebugLoggingSet))
+	mux.HandleFunc("GET /api/admin/abuse/blocks", cfg.middlewareAdminOnly(cfg.handlerAdminAbuseBlocksList))
+	mux.HandleFunc("DELETE /api/admin/abuse/blocks/{key}", cfg.middlewareAdminOnly(cfg.handlerAdminAbuseBlockDelete))
+	mux.HandleFunc("GET /api/admin/rate_limits", cfg.middlewareAdminOnly(cfg.handlerAdminRateLimitsList))
+	mux.HandleFunc("PUT /api/admin/rate_limits/{plan}", cfg.middlewareAdminOnly(cfg.handlerAdminRateLimitSet))
+	mux.HandleFunc("DELETE /api/admin/rate_limits/{plan}", cfg.middlewareAdminOnly(cfg.handlerAdminRateLimitDelete))
 
 	mux.HandleFunc("POST /admin/reset", cfg.handlerReset)
 
 	srv := &http.Server{
 		Addr:    ":" + port,
-		Handler: mux,
+		Handler: middlewareRequestID(cfg.securityHeaders.middleware(middlewareLanguage(cfg.middlewareRecover(middlewareAPIVersion(cfg.middlewareMaintenance(cfg.debugLog.middleware(mux))))))),
 	}
 
-	log.Printf("Serving on: http://localhost:%s/app/\n", port)
-	log.Fatal(srv.ListenAndServe())
+	listener, err := net.Listen("tcp", srv.Addr)
+	if err != nil {
+		log.Fatal(err)
+	}
+	log.Printf("%s serving on: http://localhost:%s/app/\n", readBuildInfo(), port)
+	if addr := os.Getenv("DIAGNOSTICS_ADDR"); addr != "" {
+		go func() {
+			log.Printf("Serving pprof and diagnostics on: http://%s/debug/pprof/\n", addr)
+			log.Fatal(http.ListenAndServe(addr, diagnosticsHandler()))
+		}()
+	}
+	if devMode {
+		go func() {
+			if err := cfg.seedDevData(context.Background()); err != nil {
+				log.Printf("Couldn't seed dev data: %v", err)
+			}
+		}()
+	}
+	log.Fatal(srv.Serve(listener))
 }
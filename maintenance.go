@@ -0,0 +1,163 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/auth"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/validate"
+)
+
+const (
+	auditEventMaintenanceStarted = "maintenance_started"
+	auditEventMaintenanceEnded   = "maintenance_ended"
+
+	defaultMaintenanceRetryAfter = 5 * 60
+	maxMaintenanceReasonLength   = 500
+	// maintenanceCacheTTL is how long other instances may keep accepting
+	// writes after maintenance mode is turned on.
+	maintenanceCacheTTL = 5 * time.Second
+)
+
+type maintenanceCache struct {
+	mu          sync.Mutex
+	maintenance *database.Maintenance
+	loadedAt    time.Time
+}
+
+func (c *maintenanceCache) get(db database.Client) (*database.Maintenance, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if !c.loadedAt.IsZero() && time.Since(c.loadedAt) < maintenanceCacheTTL {
+		return c.maintenance, nil
+	}
+	m, err := db.GetMaintenance()
+	if err != nil {
+		return nil, err
+	}
+	c.maintenance = m
+	c.loadedAt = time.Now()
+	return m, nil
+}
+
+func (c *maintenanceCache) invalidate() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.loadedAt = time.Time{}
+}
+
+// maintenanceExempt lists what keeps working in maintenance mode besides
+// reads: admins, so they can run the migration and turn maintenance off
+// again, and signing in, so they can get a token to do so.
+func maintenanceExempt(r *http.Request) bool {
+	switch r.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		return true
+	}
+	path := r.URL.Path
+	if !strings.HasPrefix(path, "/api/") && !strings.HasPrefix(path, "/admin/") {
+		return true
+	}
+	return strings.HasPrefix(path, "/api/admin/") || path == "/api/login" || path == "/api/refresh"
+}
+
+// middlewareMaintenance rejects writes while maintenance mode is on, so
+// playback keeps working while the database or bucket is being moved.
+func (cfg *apiConfig) middlewareMaintenance(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if maintenanceExempt(r) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		m, err := cfg.maintenance.get(cfg.db)
+		if err != nil {
+			// Don't take the API down because the flag couldn't be read.
+			log.Printf("Couldn't check maintenance mode: %v", err)
+		}
+		if m == nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+		w.Header().Set("Retry-After", strconv.Itoa(m.RetryAfterSeconds))
+		respondWithError(w, http.StatusServiceUnavailable, "Tubely is down for maintenance, try again later", nil)
+	})
+}
+
+func (cfg *apiConfig) handlerAdminMaintenanceGet(w http.ResponseWriter, r *http.Request) {
+	type response struct {
+		Enabled bool `json:"enabled"`
+		*database.Maintenance
+	}
+
+	m, err := cfg.db.GetMaintenance()
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get maintenance mode", err)
+		return
+	}
+	respondWithJSON(w, http.StatusOK, response{Enabled: m != nil, Maintenance: m})
+}
+
+func (cfg *apiConfig) handlerAdminMaintenanceStart(w http.ResponseWriter, r *http.Request) {
+	type parameters struct {
+		database.SetMaintenanceParams
+	}
+
+	token, err := auth.GetBearerToken(r.Header)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Couldn't find JWT", err)
+		return
+	}
+	adminID, err := cfg.validateJWT(token)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Couldn't validate JWT", err)
+		return
+	}
+
+	decoder := json.NewDecoder(r.Body)
+	params := parameters{}
+	err = decoder.Decode(&params)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't decode parameters", err)
+		return
+	}
+	if params.RetryAfterSeconds == 0 {
+		params.RetryAfterSeconds = defaultMaintenanceRetryAfter
+	}
+
+	errs := validate.Errors{}
+	errs.Check(params.RetryAfterSeconds > 0 && params.RetryAfterSeconds <= 24*60*60, "retry_after_seconds", "must be between 1 and 86400")
+	errs.Check(validate.MaxLength(params.Reason, maxMaintenanceReasonLength), "reason", "is too long")
+	if errs.Err() != nil {
+		respondWithValidationErrors(w, errs)
+		return
+	}
+
+	m, err := cfg.db.SetMaintenance(adminID, params.SetMaintenanceParams)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't start maintenance mode", err)
+		return
+	}
+	cfg.maintenance.invalidate()
+	cfg.recordAuditEvent(r, auditEventMaintenanceStarted, &adminID, "", fmt.Sprintf("reason=%q", params.Reason))
+
+	respondWithJSON(w, http.StatusOK, m)
+}
+
+func (cfg *apiConfig) handlerAdminMaintenanceEnd(w http.ResponseWriter, r *http.Request) {
+	err := cfg.db.ClearMaintenance()
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't end maintenance mode", err)
+		return
+	}
+	cfg.maintenance.invalidate()
+	cfg.recordAuditEvent(r, auditEventMaintenanceEnded, nil, "", "")
+
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,211 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/google/uuid"
+)
+
+const (
+	thumbnailWidth = 640
+	previewWidth   = 320
+	// previewSeconds is how long the hover preview clip is.
+	previewSeconds = 3
+)
+
+// extractedMedia is what extractMedia learned about an upload.
+type extractedMedia struct {
+	probe videoProbe
+	// preview is nil when it couldn't be generated.
+	preview *database.CreateArtifactParams
+}
+
+// extractMedia probes the upload while generating a preview clip from it,
+// at once since each is a separate ffmpeg or ffprobe process reading the
+// same source file. The probe is the one the earlier steps already ran, as
+// the fast start remux only changes the container. Only the probe is
+// required: previews are nice to have, so their failures are logged and
+// reported instead of failing the upload. Thumbnails are generated after
+// the upload responds, by queueThumbnail.
+func (cfg *apiConfig) extractMedia(ctx context.Context, keys objectKey, src *sourceFile, audit *uploadAudit) (extractedMedia, error) {
+	media := extractedMedia{}
+	var probeErr error
+	var wg sync.WaitGroup
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		media.probe, probeErr = src.probe()
+	}()
+	wg.Add(1)
+	go func(src *sourceFile) {
+		defer wg.Done()
+		defer src.release()
+		media.preview = cfg.generateArtifact(ctx, keys, database.ArtifactKindPreview, "video/mp4", audit, func(out string) error {
+			return generatePreview(src.Name(), out)
+		})
+	}(src.acquire())
+	wg.Wait()
+
+	if probeErr != nil {
+		return extractedMedia{}, probeErr
+	}
+	return media, nil
+}
+
+// recordExtractedMedia replaces the video's generated preview, so one left
+// from a previous upload is removed even when generating a new one failed.
+func (cfg *apiConfig) recordExtractedMedia(ctx context.Context, media extractedMedia, videoID uuid.UUID) error {
+	artifacts := []database.CreateArtifactParams{}
+	if media.preview != nil {
+		artifacts = append(artifacts, *media.preview)
+	}
+	return cfg.replaceArtifacts(ctx, videoID, database.ArtifactKindPreview, artifacts)
+}
+
+// generateArtifact runs generate into a temp file and uploads the result.
+// It returns nil if either step fails.
+func (cfg *apiConfig) generateArtifact(ctx context.Context, keys objectKey, kind database.ArtifactKind, mediaType string, audit *uploadAudit, generate func(out string) error) *database.CreateArtifactParams {
+	artifact, err := cfg.uploadGeneratedArtifact(ctx, keys, kind, mediaType, audit, generate)
+	if err != nil {
+		log.Printf("Couldn't generate %s for video %s: %v", kind, keys.videoID, err)
+		cfg.reportError(errorEvent(fmt.Sprintf("Couldn't generate %s", kind), err))
+		return nil
+	}
+	return artifact
+}
+
+func (cfg *apiConfig) uploadGeneratedArtifact(ctx context.Context, keys objectKey, kind database.ArtifactKind, mediaType string, audit *uploadAudit, generate func(out string) error) (*database.CreateArtifactParams, error) {
+	tmp, err := os.CreateTemp("", fmt.Sprintf("tubely-%s_*%s", kind, mediaTypeToExtension(mediaType)))
+	if err != nil {
+		return nil, err
+	}
+	tmp.Close()
+	defer os.Remove(tmp.Name())
+
+	if err := generate(tmp.Name()); err != nil {
+		return nil, err
+	}
+	audit.trackTempFile(tmp.Name())
+
+	f, err := os.Open(tmp.Name())
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+
+	var key string
+	if strings.HasPrefix(mediaType, "image/") {
+		key, err = cfg.putContentAddressedImage(ctx, keys, kind, mediaType, f)
+	} else {
+		newKey := func() (string, error) {
+			return keys.derived(string(kind), mediaType), nil
+		}
+		key, _ = newKey()
+		key, err = putNewObject(key, newKey, func(key string) error {
+			if _, err := f.Seek(0, io.SeekStart); err != nil {
+				return err
+			}
+			_, err := cfg.s3Client.PutObject(ctx, &s3.PutObjectInput{
+				Bucket:      aws.String(cfg.s3Bucket),
+				Key:         aws.String(key),
+				Body:        f,
+				ContentType: aws.String(mediaType),
+				IfNoneMatch: aws.String("*"),
+				Tagging:     keys.tagging(kind),
+			})
+			return conditionalWriteError(err)
+		})
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &database.CreateArtifactParams{
+		VideoID:   keys.videoID,
+		Kind:      kind,
+		Key:       key,
+		SizeBytes: info.Size(),
+	}, nil
+}
+
+// putContentAddressedImage uploads an image under a key derived from its
+// contents, marked immutable so CDNs and browsers keep it. A new image gets a
+// new key, so nothing ever has to be invalidated. The key being taken means
+// the video already has this very image, which is kept.
+func (cfg *apiConfig) putContentAddressedImage(ctx context.Context, keys objectKey, kind database.ArtifactKind, mediaType string, f *os.File) (string, error) {
+	hash := sha256.New()
+	if _, err := io.Copy(hash, f); err != nil {
+		return "", err
+	}
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return "", err
+	}
+	key := keys.contentAddressed(string(kind), hash.Sum(nil), mediaType)
+	_, err := cfg.s3Client.PutObject(ctx, &s3.PutObjectInput{
+		Bucket:       aws.String(cfg.s3Bucket),
+		Key:          aws.String(key),
+		Body:         f,
+		ContentType:  aws.String(mediaType),
+		CacheControl: aws.String(immutableCacheControl),
+		IfNoneMatch:  aws.String("*"),
+		Tagging:      keys.tagging(kind),
+	})
+	if err := conditionalWriteError(err); err != nil && !errors.Is(err, errObjectExists) {
+		return "", err
+	}
+	return key, nil
+}
+
+// extractThumbnail writes a representative frame of the video as a JPEG.
+func extractThumbnail(inputFilePath, outputPath string) error {
+	return runFFmpeg(
+		"-y",
+		"-i", inputFilePath,
+		"-vf", fmt.Sprintf("thumbnail,scale=%d:-2", thumbnailWidth),
+		"-frames:v", "1",
+		outputPath,
+	)
+}
+
+// generatePreview writes a short, small and silent clip from the start of
+// the video, for players to show on hover.
+func generatePreview(inputFilePath, outputPath string) error {
+	return runFFmpeg(
+		"-y",
+		"-t", fmt.Sprint(previewSeconds),
+		"-i", inputFilePath,
+		"-an",
+		"-vf", fmt.Sprintf("scale=%d:-2", previewWidth),
+		"-c:v", "libx264", "-preset", "veryfast",
+		"-movflags", "faststart",
+		"-f", "mp4",
+		outputPath,
+	)
+}
+
+func runFFmpeg(args ...string) error {
+	cmd := exec.Command("ffmpeg", append([]string{"-v", "error"}, args...)...)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	if err := runMediaTool(cmd); err != nil {
+		return &mediaToolError{tool: "ffmpeg", stderr: stderr.String(), err: err}
+	}
+	return nil
+}
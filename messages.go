@@ -0,0 +1,597 @@
+package main
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/i18n"
+)
+
+// genericErrorMessage replaces server errors that have no translation, so
+// non-English clients never see an English error.
+const genericErrorMessage = "Something went wrong on our side, please try again later"
+
+// errorMessages translates the errors users can run into. Admin-only and
+// webhook errors stay English-only and fall back to a status-based code.
+var errorMessages = i18n.NewCatalog([]string{"es", "pt"}, map[string]i18n.Message{
+	genericErrorMessage: {Code: "internal_error", Translations: map[string]string{
+		"es": "Algo salió mal de nuestro lado, inténtalo de nuevo más tarde",
+		"pt": "Algo deu errado do nosso lado, tente novamente mais tarde",
+	}},
+	"Something went wrong on our side, quote request ID %s when reporting this": {Code: "internal_error", Translations: map[string]string{
+		"es": "Algo salió mal de nuestro lado, menciona el ID de solicitud %s al reportarlo",
+		"pt": "Algo deu errado do nosso lado, informe o ID de solicitação %s ao relatar o problema",
+	}},
+	"Invalid request": {Code: "invalid_request", Translations: map[string]string{
+		"es": "Solicitud no válida",
+		"pt": "Solicitação inválida",
+	}},
+
+	// Authentication
+	"Couldn't find JWT": {Code: "missing_token", Translations: map[string]string{
+		"es": "No se encontró el token de acceso",
+		"pt": "Token de acesso não encontrado",
+	}},
+	"Couldn't validate JWT": {Code: "invalid_token", Translations: map[string]string{
+		"es": "El token de acceso no es válido",
+		"pt": "O token de acesso é inválido",
+	}},
+	"Couldn't find token": {Code: "missing_token", Translations: map[string]string{
+		"es": "No se encontró el token",
+		"pt": "Token não encontrado",
+	}},
+	"Couldn't validate token": {Code: "invalid_token", Translations: map[string]string{
+		"es": "El token no es válido",
+		"pt": "O token é inválido",
+	}},
+	"Couldn't get user for refresh token": {Code: "invalid_refresh_token", Translations: map[string]string{
+		"es": "El token de actualización no es válido",
+		"pt": "O token de atualização é inválido",
+	}},
+	"Refresh token is invalid, expired or revoked": {Code: "invalid_refresh_token", Translations: map[string]string{
+		"es": "El token de actualización no es válido, caducó o fue revocado",
+		"pt": "O token de atualização é inválido, expirou ou foi revogado",
+	}},
+	"Incorrect email or password": {Code: "invalid_credentials", Translations: map[string]string{
+		"es": "Correo electrónico o contraseña incorrectos",
+		"pt": "E-mail ou senha incorretos",
+	}},
+	"Too many failed login attempts, try again later": {Code: "login_throttled", Translations: map[string]string{
+		"es": "Demasiados intentos fallidos de inicio de sesión, inténtalo más tarde",
+		"pt": "Muitas tentativas de login sem sucesso, tente novamente mais tarde",
+	}},
+	"Too many requests, try again later": {Code: "rate_limited", Translations: map[string]string{
+		"es": "Demasiadas solicitudes, inténtalo más tarde",
+		"pt": "Muitas solicitações, tente novamente mais tarde",
+	}},
+	"You have %d uploads in progress, wait for one to finish": {Code: "too_many_uploads", Translations: map[string]string{
+		"es": "Tienes %d subidas en curso, espera a que termine alguna",
+		"pt": "Você tem %d envios em andamento, aguarde um terminar",
+	}},
+	"Tubely is down for maintenance, try again later": {Code: "maintenance", Translations: map[string]string{
+		"es": "Tubely está en mantenimiento, inténtalo más tarde",
+		"pt": "O Tubely está em manutenção, tente novamente mais tarde",
+	}},
+	"Invalid or expired token": {Code: "invalid_or_expired_token", Translations: map[string]string{
+		"es": "El enlace no es válido o ha caducado",
+		"pt": "O link é inválido ou expirou",
+	}},
+	"Email is already verified": {Code: "email_already_verified", Translations: map[string]string{
+		"es": "El correo electrónico ya está verificado",
+		"pt": "O e-mail já foi verificado",
+	}},
+	"Admin access required": {Code: "admin_required", Translations: map[string]string{
+		"es": "Se requiere acceso de administrador",
+		"pt": "É necessário acesso de administrador",
+	}},
+	"Couldn't find user": {Code: "user_not_found", Translations: map[string]string{
+		"es": "No se encontró el usuario",
+		"pt": "Usuário não encontrado",
+	}},
+	"Couldn't find session": {Code: "session_not_found", Translations: map[string]string{
+		"es": "No se encontró la sesión",
+		"pt": "Sessão não encontrada",
+	}},
+
+	// Videos
+	"Invalid ID": {Code: "invalid_id", Translations: map[string]string{
+		"es": "ID no válido",
+		"pt": "ID inválido",
+	}},
+	"Invalid video ID": {Code: "invalid_id", Translations: map[string]string{
+		"es": "ID de video no válido",
+		"pt": "ID de vídeo inválido",
+	}},
+	"dry_run must be true or false": {Code: "invalid_dry_run", Translations: map[string]string{
+		"es": "dry_run debe ser true o false",
+		"pt": "dry_run deve ser true ou false",
+	}},
+	"Couldn't get video": {Code: "video_not_found", Translations: map[string]string{
+		"es": "No se encontró el video",
+		"pt": "Vídeo não encontrado",
+	}},
+	"You can't delete this video": {Code: "video_forbidden", Translations: map[string]string{
+		"es": "No puedes eliminar este video",
+		"pt": "Você não pode excluir este vídeo",
+	}},
+	"You can't view stats for this video": {Code: "video_forbidden", Translations: map[string]string{
+		"es": "No puedes ver las estadísticas de este video",
+		"pt": "Você não pode ver as estatísticas deste vídeo",
+	}},
+	"Not authorized to update video": {Code: "video_forbidden", Translations: map[string]string{
+		"es": "No tienes permiso para modificar este video",
+		"pt": "Você não tem permissão para alterar este vídeo",
+	}},
+	"Not authorized to view video": {Code: "video_forbidden", Translations: map[string]string{
+		"es": "No tienes permiso para ver el video",
+		"pt": "Sem permissão para ver o vídeo",
+	}},
+	"Storage quota exceeded for your plan": {Code: "storage_quota_exceeded", Translations: map[string]string{
+		"es": "Superaste el almacenamiento incluido en tu plan",
+		"pt": "Você excedeu o armazenamento do seu plano",
+	}},
+	"Videos on your plan can be at most %s long": {Code: "video_too_long", Translations: map[string]string{
+		"es": "Los videos de tu plan pueden durar como máximo %s",
+		"pt": "Os vídeos do seu plano podem ter no máximo %s",
+	}},
+	"Video was modified since %s": {Code: "video_modified", Translations: map[string]string{
+		"es": "El video se modificó después de %s",
+		"pt": "O vídeo foi modificado depois de %s",
+	}},
+	"This video has been removed": {Code: "video_removed", Translations: map[string]string{
+		"es": "Este video fue eliminado",
+		"pt": "Este vídeo foi removido",
+	}},
+	"This video is unavailable for legal reasons": {Code: "video_blocked", Translations: map[string]string{
+		"es": "Este video no está disponible por motivos legales",
+		"pt": "Este vídeo não está disponível por motivos legais",
+	}},
+	"This video is unavailable while a copyright claim is reviewed": {Code: "video_claimed", Translations: map[string]string{
+		"es": "Este video no está disponible mientras se revisa una reclamación de derechos de autor",
+		"pt": "Este vídeo não está disponível enquanto uma reclamação de direitos autorais é analisada",
+	}},
+	"Downloads are disabled for this video": {Code: "downloads_disabled", Translations: map[string]string{
+		"es": "Las descargas están desactivadas para este video",
+		"pt": "Os downloads estão desativados para este vídeo",
+	}},
+	"This video has expired": {Code: "video_expired", Translations: map[string]string{
+		"es": "Este video ha caducado",
+		"pt": "Este vídeo expirou",
+	}},
+	"This video isn't published": {Code: "video_unpublished", Translations: map[string]string{
+		"es": "Este video no está publicado",
+		"pt": "Este vídeo não está publicado",
+	}},
+	"An import is already running": {Code: "import_running", Translations: map[string]string{
+		"es": "Ya hay una importación en curso",
+		"pt": "Já existe uma importação em andamento",
+	}},
+	"Couldn't get import": {Code: "import_not_found", Translations: map[string]string{
+		"es": "No se pudo obtener la importación",
+		"pt": "Não foi possível obter a importação",
+	}},
+	"Invalid import ID": {Code: "invalid_id", Translations: map[string]string{
+		"es": "ID de importación no válido",
+		"pt": "ID de importação inválido",
+	}},
+	"Couldn't parse multipart form": {Code: "invalid_form", Translations: map[string]string{
+		"es": "No se pudo leer el formulario multipart",
+		"pt": "Não foi possível ler o formulário multipart",
+	}},
+	"Request body is too large": {Code: "body_too_large", Translations: map[string]string{
+		"es": "El cuerpo de la solicitud es demasiado grande",
+		"pt": "O corpo da solicitação é grande demais",
+	}},
+	"Request isn't a multipart form": {Code: "not_multipart", Translations: map[string]string{
+		"es": "La solicitud no es un formulario multipart",
+		"pt": "A solicitação não é um formulário multipart",
+	}},
+	"Request body was cut off": {Code: "truncated_body", Translations: map[string]string{
+		"es": "El cuerpo de la solicitud está incompleto",
+		"pt": "O corpo da solicitação está incompleto",
+	}},
+	"No file was uploaded for this video": {Code: "import_file_missing", Translations: map[string]string{
+		"es": "No se subió ningún archivo para este video",
+		"pt": "Nenhum arquivo foi enviado para este vídeo",
+	}},
+	"File URLs must be https": {Code: "import_file_url_invalid", Translations: map[string]string{
+		"es": "Las URL de archivos deben ser https",
+		"pt": "As URLs de arquivos devem ser https",
+	}},
+	"Couldn't download the video file": {Code: "import_download_failed", Translations: map[string]string{
+		"es": "No se pudo descargar el archivo de video",
+		"pt": "Não foi possível baixar o arquivo de vídeo",
+	}},
+	"The import was interrupted by a server restart": {Code: "import_interrupted", Translations: map[string]string{
+		"es": "La importación se interrumpió por un reinicio del servidor",
+		"pt": "A importação foi interrompida por uma reinicialização do servidor",
+	}},
+	"Videos can have at most " + strconv.Itoa(maxVideoTags) + " tags": {Code: "too_many_tags", Translations: map[string]string{
+		"es": "Los videos pueden tener como máximo " + strconv.Itoa(maxVideoTags) + " etiquetas",
+		"pt": "Os vídeos podem ter no máximo " + strconv.Itoa(maxVideoTags) + " tags",
+	}},
+	"This video is password protected": {Code: "video_password_required", Translations: map[string]string{
+		"es": "Este video está protegido con contraseña",
+		"pt": "Este vídeo é protegido por senha",
+	}},
+	"Incorrect video password": {Code: "incorrect_video_password", Translations: map[string]string{
+		"es": "La contraseña del video es incorrecta",
+		"pt": "A senha do vídeo está incorreta",
+	}},
+	"Too many incorrect passwords, try again later": {Code: "video_password_throttled", Translations: map[string]string{
+		"es": "Demasiadas contraseñas incorrectas, inténtalo de nuevo más tarde",
+		"pt": "Muitas senhas incorretas, tente novamente mais tarde",
+	}},
+	"You can't claim your own video": {Code: "own_video", Translations: map[string]string{
+		"es": "No puedes reclamar tu propio video",
+		"pt": "Você não pode reclamar o seu próprio vídeo",
+	}},
+	"Couldn't find claim": {Code: "claim_not_found", Translations: map[string]string{
+		"es": "No se encontró la reclamación",
+		"pt": "Reclamação não encontrada",
+	}},
+	"Only open claims can be disputed": {Code: "claim_closed", Translations: map[string]string{
+		"es": "Solo se pueden impugnar reclamaciones abiertas",
+		"pt": "Só é possível contestar reclamações abertas",
+	}},
+	"Video isn't taken down": {Code: "not_taken_down", Translations: map[string]string{
+		"es": "El video no fue retirado",
+		"pt": "O vídeo não foi retirado",
+	}},
+	"Takedown was already appealed": {Code: "already_appealed", Translations: map[string]string{
+		"es": "Ya apelaste la retirada de este video",
+		"pt": "Você já recorreu da retirada deste vídeo",
+	}},
+	"Video was modified during the upload": {Code: "video_modified", Translations: map[string]string{
+		"es": "El video se modificó durante la subida",
+		"pt": "O vídeo foi modificado durante o envio",
+	}},
+	"Couldn't parse form file": {Code: "missing_file", Translations: map[string]string{
+		"es": "No se pudo leer el archivo del formulario",
+		"pt": "Não foi possível ler o arquivo do formulário",
+	}},
+	"Couldn't read request body": {Code: "invalid_body", Translations: map[string]string{
+		"es": "No se pudo leer el cuerpo de la solicitud",
+		"pt": "Não foi possível ler o corpo da solicitação",
+	}},
+	"Invalid Content-Type": {Code: "invalid_content_type", Translations: map[string]string{
+		"es": "Content-Type no válido",
+		"pt": "Content-Type inválido",
+	}},
+	"Invalid media type": {Code: "unsupported_media_type", Translations: map[string]string{
+		"es": "Tipo de archivo no admitido",
+		"pt": "Tipo de arquivo não suportado",
+	}},
+	"The file's contents aren't a supported video": {Code: "unsupported_media_type", Translations: map[string]string{
+		"es": "El contenido del archivo no es un video admitido",
+		"pt": "O conteúdo do arquivo não é um vídeo suportado",
+	}},
+	"The file isn't a playable video": {Code: "invalid_video", Translations: map[string]string{
+		"es": "El archivo no es un video reproducible",
+		"pt": "O arquivo não é um vídeo reproduzível",
+	}},
+	"The file isn't a valid image": {Code: "invalid_image", Translations: map[string]string{
+		"es": "El archivo no es una imagen válida",
+		"pt": "O arquivo não é uma imagem válida",
+	}},
+	"Invalid media type, accepted types are %s": {Code: "unsupported_media_type", Translations: map[string]string{
+		"es": "Tipo de archivo no admitido, se aceptan %s",
+		"pt": "Tipo de arquivo não suportado, são aceitos %s",
+	}},
+	"Video file is too large": {Code: "file_too_large", Translations: map[string]string{
+		"es": "El archivo de video es demasiado grande",
+		"pt": "O arquivo de vídeo é grande demais",
+	}},
+	"Direct uploads aren't enabled": {Code: "direct_uploads_disabled", Translations: map[string]string{
+		"es": "Las subidas directas no están habilitadas",
+		"pt": "Os envios diretos não estão habilitados",
+	}},
+	"Couldn't find the uploaded file": {Code: "upload_not_found", Translations: map[string]string{
+		"es": "No se encontró el archivo subido",
+		"pt": "O arquivo enviado não foi encontrado",
+	}},
+	"Couldn't find upload session": {Code: "upload_session_not_found", Translations: map[string]string{
+		"es": "No se encontró la sesión de subida",
+		"pt": "Sessão de envio não encontrada",
+	}},
+	"Upload session expired": {Code: "upload_session_expired", Translations: map[string]string{
+		"es": "La sesión de subida expiró",
+		"pt": "A sessão de envio expirou",
+	}},
+	"Invalid part number": {Code: "invalid_part_number", Translations: map[string]string{
+		"es": "Número de parte no válido",
+		"pt": "Número de parte inválido",
+	}},
+	"Part %d must be %d bytes": {Code: "invalid_part_size", Translations: map[string]string{
+		"es": "La parte %d debe tener %d bytes",
+		"pt": "A parte %d deve ter %d bytes",
+	}},
+	"Upload is missing %d parts": {Code: "upload_incomplete", Translations: map[string]string{
+		"es": "A la subida le faltan %d partes",
+		"pt": "Faltam %d partes no envio",
+	}},
+	"Tus-Resumable must be 1.0.0": {Code: "tus_version_unsupported", Translations: map[string]string{
+		"es": "Tus-Resumable debe ser 1.0.0",
+		"pt": "Tus-Resumable deve ser 1.0.0",
+	}},
+	"Invalid Upload-Length": {Code: "invalid_upload_length", Translations: map[string]string{
+		"es": "Upload-Length no válido",
+		"pt": "Upload-Length inválido",
+	}},
+	"Invalid Upload-Metadata": {Code: "invalid_upload_metadata", Translations: map[string]string{
+		"es": "Upload-Metadata no válido",
+		"pt": "Upload-Metadata inválido",
+	}},
+	"Invalid Upload-Offset": {Code: "invalid_upload_offset", Translations: map[string]string{
+		"es": "Upload-Offset no válido",
+		"pt": "Upload-Offset inválido",
+	}},
+	"Content-Type must be application/offset+octet-stream": {Code: "invalid_patch_content_type", Translations: map[string]string{
+		"es": "Content-Type debe ser application/offset+octet-stream",
+		"pt": "Content-Type deve ser application/offset+octet-stream",
+	}},
+	"Content-Type must be application/merge-patch+json": {Code: "invalid_patch_content_type", Translations: map[string]string{
+		"es": "Content-Type debe ser application/merge-patch+json",
+		"pt": "Content-Type deve ser application/merge-patch+json",
+	}},
+	"Video was modified during the update": {Code: "video_modified", Translations: map[string]string{
+		"es": "El video se modificó durante la actualización",
+		"pt": "O vídeo foi modificado durante a atualização",
+	}},
+	"Upload-Offset must be %d, the bytes received so far": {Code: "upload_offset_mismatch", Translations: map[string]string{
+		"es": "Upload-Offset debe ser %d, los bytes recibidos hasta ahora",
+		"pt": "Upload-Offset deve ser %d, os bytes recebidos até agora",
+	}},
+	"Upload is already being sent": {Code: "upload_locked", Translations: map[string]string{
+		"es": "La subida ya se está enviando",
+		"pt": "O envio já está sendo feito",
+	}},
+	"Upload is longer than its Upload-Length": {Code: "upload_too_long", Translations: map[string]string{
+		"es": "La subida es más larga que su Upload-Length",
+		"pt": "O envio é maior que seu Upload-Length",
+	}},
+	"Couldn't find upload": {Code: "upload_not_found", Translations: map[string]string{
+		"es": "No se encontró la subida",
+		"pt": "Envio não encontrado",
+	}},
+	"Upload expired": {Code: "upload_expired", Translations: map[string]string{
+		"es": "La subida expiró",
+		"pt": "O envio expirou",
+	}},
+	"Invalid cursor": {Code: "invalid_cursor", Translations: map[string]string{
+		"es": "Cursor no válido",
+		"pt": "Cursor inválido",
+	}},
+	"limit must be between 1 and %d": {Code: "invalid_limit", Translations: map[string]string{
+		"es": "limit debe estar entre 1 y %d",
+		"pt": "limit deve estar entre 1 e %d",
+	}},
+	"Unknown API version": {Code: "unknown_api_version", Translations: map[string]string{
+		"es": "Versión de la API desconocida",
+		"pt": "Versão da API desconhecida",
+	}},
+	"Unknown field %q": {Code: "unknown_field", Translations: map[string]string{
+		"es": "Campo desconocido %q",
+		"pt": "Campo desconhecido %q",
+	}},
+
+	"Video hasn't been uploaded yet": {Code: "video_not_uploaded", Translations: map[string]string{
+		"es": "El video todavía no se ha subido",
+		"pt": "O vídeo ainda não foi enviado",
+	}},
+	"The file has no audio": {Code: "no_audio", Translations: map[string]string{
+		"es": "El archivo no tiene audio",
+		"pt": "O arquivo não tem áudio",
+	}},
+	"Video has no audio description": {Code: "audio_description_not_found", Translations: map[string]string{
+		"es": "El video no tiene audiodescripción",
+		"pt": "O vídeo não tem audiodescrição",
+	}},
+	"Metadata key %q isn't indexed for filtering": {Code: "metadata_key_not_indexed", Translations: map[string]string{
+		"es": "La clave de metadatos %q no está indexada para filtrar",
+		"pt": "A chave de metadados %q não está indexada para filtragem",
+	}},
+	"Couldn't find CMS sync": {Code: "cms_sync_not_found", Translations: map[string]string{
+		"es": "No se encontró la sincronización con el CMS",
+		"pt": "Sincronização com o CMS não encontrada",
+	}},
+	"You can't have more than %d CMS syncs": {Code: "too_many_cms_syncs", Translations: map[string]string{
+		"es": "No puedes tener más de %d sincronizaciones con CMS",
+		"pt": "Você não pode ter mais de %d sincronizações com CMS",
+	}},
+	"Couldn't find HTTP action": {Code: "http_action_not_found", Translations: map[string]string{
+		"es": "No se encontró la acción HTTP",
+		"pt": "Ação HTTP não encontrada",
+	}},
+	"Invalid language tag": {Code: "invalid_language", Translations: map[string]string{
+		"es": "Etiqueta de idioma no válida",
+		"pt": "Etiqueta de idioma inválida",
+	}},
+	"Video has no audio track in that language": {Code: "audio_track_not_found", Translations: map[string]string{
+		"es": "El video no tiene una pista de audio en ese idioma",
+		"pt": "O vídeo não tem uma faixa de áudio nesse idioma",
+	}},
+	"A video can't have more than %d audio tracks": {Code: "too_many_audio_tracks", Translations: map[string]string{
+		"es": "Un video no puede tener más de %d pistas de audio",
+		"pt": "Um vídeo não pode ter mais de %d faixas de áudio",
+	}},
+	"This video can't be embedded on this site": {Code: "embed_not_allowed", Translations: map[string]string{
+		"es": "Este video no se puede insertar en este sitio",
+		"pt": "Este vídeo não pode ser incorporado neste site",
+	}},
+	"Couldn't find embed token": {Code: "embed_token_not_found", Translations: map[string]string{
+		"es": "No se encontró el token de inserción",
+		"pt": "Token de incorporação não encontrado",
+	}},
+	"Couldn't find short link": {Code: "short_link_not_found", Translations: map[string]string{
+		"es": "No se encontró el enlace corto",
+		"pt": "Link curto não encontrado",
+	}},
+	"That short link is taken": {Code: "short_link_taken", Translations: map[string]string{
+		"es": "Ese enlace corto ya está en uso",
+		"pt": "Esse link curto já está em uso",
+	}},
+	"A video can't have more than %d short links": {Code: "too_many_short_links", Translations: map[string]string{
+		"es": "Un video no puede tener más de %d enlaces cortos",
+		"pt": "Um vídeo não pode ter mais de %d links curtos",
+	}},
+	"The sitemap isn't enabled": {Code: "sitemap_disabled", Translations: map[string]string{
+		"es": "El mapa del sitio no está habilitado",
+		"pt": "O mapa do site não está habilitado",
+	}},
+
+	// Billing
+	"Billing is not enabled": {Code: "billing_disabled", Translations: map[string]string{
+		"es": "La facturación no está habilitada",
+		"pt": "A cobrança não está habilitada",
+	}},
+	"Inbound email is not enabled": {Code: "inbound_email_disabled", Translations: map[string]string{
+		"es": "La recepción de correos no está habilitada",
+		"pt": "O recebimento de emails não está habilitado",
+	}},
+	"Already subscribed to the pro plan": {Code: "already_subscribed", Translations: map[string]string{
+		"es": "Ya tienes una suscripción al plan pro",
+		"pt": "Você já assina o plano pro",
+	}},
+
+	// Field validation, see validation.go
+	"is required": {Code: "required", Translations: map[string]string{
+		"es": "es obligatorio",
+		"pt": "é obrigatório",
+	}},
+	"is too long": {Code: "too_long", Translations: map[string]string{
+		"es": "es demasiado largo",
+		"pt": "é muito longo",
+	}},
+	"must be a valid email address": {Code: "invalid_email", Translations: map[string]string{
+		"es": "debe ser un correo electrónico válido",
+		"pt": "deve ser um e-mail válido",
+	}},
+	"must be at least " + strconv.Itoa(minPasswordLength) + " characters": {Code: "too_short", Translations: map[string]string{
+		"es": "debe tener al menos " + strconv.Itoa(minPasswordLength) + " caracteres",
+		"pt": "deve ter pelo menos " + strconv.Itoa(minPasswordLength) + " caracteres",
+	}},
+	"must be at most " + strconv.Itoa(maxPasswordBytes) + " bytes": {Code: "too_long", Translations: map[string]string{
+		"es": "debe tener como máximo " + strconv.Itoa(maxPasswordBytes) + " bytes",
+		"pt": "deve ter no máximo " + strconv.Itoa(maxPasswordBytes) + " bytes",
+	}},
+	"must be at most " + strconv.Itoa(maxTitleLength) + " characters": {Code: "too_long", Translations: map[string]string{
+		"es": "debe tener como máximo " + strconv.Itoa(maxTitleLength) + " caracteres",
+		"pt": "deve ter no máximo " + strconv.Itoa(maxTitleLength) + " caracteres",
+	}},
+	"must be at most " + strconv.Itoa(maxDescriptionLength) + " characters": {Code: "too_long", Translations: map[string]string{
+		"es": "debe tener como máximo " + strconv.Itoa(maxDescriptionLength) + " caracteres",
+		"pt": "deve ter no máximo " + strconv.Itoa(maxDescriptionLength) + " caracteres",
+	}},
+	"must be sd, hd or fhd": {Code: "invalid_choice", Translations: map[string]string{
+		"es": "debe ser sd, hd o fhd",
+		"pt": "deve ser sd, hd ou fhd",
+	}},
+	"must be csv or json": {Code: "invalid_choice", Translations: map[string]string{
+		"es": "debe ser csv o json",
+		"pt": "deve ser csv ou json",
+	}},
+	"must be between " + strconv.Itoa(minQRSize) + " and " + strconv.Itoa(maxQRSize): {Code: "out_of_range", Translations: map[string]string{
+		"es": "debe estar entre " + strconv.Itoa(minQRSize) + " y " + strconv.Itoa(maxQRSize),
+		"pt": "deve estar entre " + strconv.Itoa(minQRSize) + " e " + strconv.Itoa(maxQRSize),
+	}},
+	"must be L, M, Q or H": {Code: "invalid_choice", Translations: map[string]string{
+		"es": "debe ser L, M, Q o H",
+		"pt": "deve ser L, M, Q ou H",
+	}},
+	"must be 3 to 40 lowercase letters, digits or dashes": {Code: "invalid_slug", Translations: map[string]string{
+		"es": "debe tener de 3 a 40 letras minúsculas, dígitos o guiones",
+		"pt": "deve ter de 3 a 40 letras minúsculas, dígitos ou hífens",
+	}},
+	"must be a hex encoded SHA-256": {Code: "invalid_format", Translations: map[string]string{
+		"es": "debe ser un SHA-256 en hexadecimal",
+		"pt": "deve ser um SHA-256 em hexadecimal",
+	}},
+	"must be in the future": {Code: "out_of_range", Translations: map[string]string{
+		"es": "debe estar en el futuro",
+		"pt": "deve estar no futuro",
+	}},
+	"must be formatted as YYYY-MM": {Code: "invalid_format", Translations: map[string]string{
+		"es": "debe tener el formato AAAA-MM",
+		"pt": "deve estar no formato AAAA-MM",
+	}},
+	"must be between 2000-01 and the current month": {Code: "out_of_range", Translations: map[string]string{
+		"es": "debe estar entre 2000-01 y el mes actual",
+		"pt": "deve estar entre 2000-01 e o mês atual",
+	}},
+	"must be at most 1GB each": {Code: "too_long", Translations: map[string]string{
+		"es": "debe tener como máximo 1GB cada uno",
+		"pt": "deve ter no máximo 1GB cada",
+	}},
+	"must be a YouTube Takeout JSON or CSV file": {Code: "invalid_format", Translations: map[string]string{
+		"es": "debe ser un archivo JSON o CSV de YouTube Takeout",
+		"pt": "deve ser um arquivo JSON ou CSV do YouTube Takeout",
+	}},
+	"must list at least one video": {Code: "required", Translations: map[string]string{
+		"es": "debe incluir al menos un video",
+		"pt": "deve incluir pelo menos um vídeo",
+	}},
+	"must have at most " + strconv.Itoa(maxImportVideos) + " videos": {Code: "too_long", Translations: map[string]string{
+		"es": "debe tener como máximo " + strconv.Itoa(maxImportVideos) + " videos",
+		"pt": "deve ter no máximo " + strconv.Itoa(maxImportVideos) + " vídeos",
+	}},
+	"must be publish, unpublish, delete or tag": {Code: "invalid_choice", Translations: map[string]string{
+		"es": "debe ser publish, unpublish, delete o tag",
+		"pt": "deve ser publish, unpublish, delete ou tag",
+	}},
+	"must have at most " + strconv.Itoa(maxBatchVideos) + " videos": {Code: "too_long", Translations: map[string]string{
+		"es": "debe tener como máximo " + strconv.Itoa(maxBatchVideos) + " videos",
+		"pt": "deve ter no máximo " + strconv.Itoa(maxBatchVideos) + " vídeos",
+	}},
+	"can't contain empty tags": {Code: "required", Translations: map[string]string{
+		"es": "no puede contener etiquetas vacías",
+		"pt": "não pode conter tags vazias",
+	}},
+	"can't contain commas": {Code: "invalid_format", Translations: map[string]string{
+		"es": "no puede contener comas",
+		"pt": "não pode conter vírgulas",
+	}},
+	"must be at most " + strconv.Itoa(maxVideoTagSize) + " characters each": {Code: "too_long", Translations: map[string]string{
+		"es": "debe tener como máximo " + strconv.Itoa(maxVideoTagSize) + " caracteres cada una",
+		"pt": "deve ter no máximo " + strconv.Itoa(maxVideoTagSize) + " caracteres cada",
+	}},
+})
+
+// errorCodeForStatus is the code for messages that aren't in the catalog,
+// e.g. "bad_request" for a 400.
+func errorCodeForStatus(status int) string {
+	return strings.ToLower(strings.ReplaceAll(http.StatusText(status), " ", "_"))
+}
+
+type languageWriter struct {
+	http.ResponseWriter
+	language string
+}
+
+func (w *languageWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// middlewareLanguage negotiates the response language from Accept-Language
+// once per request, for respondWithError to pick up.
+func middlewareLanguage(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("Vary", "Accept-Language")
+		language := errorMessages.Negotiate(r.Header.Get("Accept-Language"))
+		next.ServeHTTP(&languageWriter{ResponseWriter: w, language: language}, r)
+	})
+}
+
+func responseLanguage(w http.ResponseWriter) string {
+	for {
+		if lw, ok := w.(*languageWriter); ok {
+			return lw.language
+		}
+		unwrapper, ok := w.(interface{ Unwrap() http.ResponseWriter })
+		if !ok {
+			return i18n.DefaultLanguage
+		}
+		w = unwrapper.Unwrap()
+	}
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/notify"
+)
+
+const notifyTimeout = 30 * time.Second
+
+// notify sends a message to every channel and HTTP action subscribed to the
+// event. data is the event's details for action templates. Delivery happens
+// in the background and failures are only logged, so a broken webhook never
+// fails the request that triggered it.
+func (cfg *apiConfig) notify(event notify.Event, title, text string, data map[string]any) {
+	msg := notify.Message{Event: event, Title: title, Text: text, Time: time.Now().UTC(), Data: data}
+	cfg.runHTTPActions(msg)
+
+	channels, err := cfg.db.GetNotificationChannelsForEvent(string(event))
+	if err != nil {
+		log.Printf("Couldn't load notification channels for %s: %v", event, err)
+		return
+	}
+	for _, channel := range channels {
+		notifier, err := cfg.notifierForChannel(channel)
+		if err != nil {
+			log.Printf("Skipping notification channel %s: %v", channel.ID, err)
+			continue
+		}
+		go func() {
+			ctx, cancel := context.WithTimeout(context.Background(), notifyTimeout)
+			defer cancel()
+			if err := notifier.Notify(ctx, msg); err != nil {
+				log.Printf("Couldn't notify %s channel %s: %v", channel.Kind, channel.ID, err)
+			}
+		}()
+	}
+}
+
+// videoEventData is the data of video lifecycle events.
+func videoEventData(video database.Video) map[string]any {
+	data := map[string]any{
+		"video_id":    video.ID,
+		"user_id":     video.UserID,
+		"title":       video.Title,
+		"description": video.Description,
+		"size_bytes":  video.SizeBytes,
+		"metadata":    video.Metadata,
+	}
+	if video.VideoURL != nil {
+		data["video_url"] = *video.VideoURL
+	}
+	return data
+}
+
+func (cfg *apiConfig) notifierForChannel(channel database.NotificationChannel) (notify.Notifier, error) {
+	switch channel.Kind {
+	case "slack":
+		return notify.Slack{WebhookURL: channel.Target}, nil
+	case "discord":
+		return notify.Discord{WebhookURL: channel.Target}, nil
+	case "email":
+		return notify.Email{Mailer: cfg.mailer, To: channel.Target}, nil
+	}
+	return nil, fmt.Errorf("unknown channel kind %q", channel.Kind)
+}
+
+// runHTTPActions sends the actions subscribed to msg's event, like notify
+// does for channels.
+func (cfg *apiConfig) runHTTPActions(msg notify.Message) {
+	actions, err := cfg.db.GetHTTPActionsForEvent(string(msg.Event))
+	if err != nil {
+		log.Printf("Couldn't load HTTP actions for %s: %v", msg.Event, err)
+		return
+	}
+	for _, action := range actions {
+		notifier, err := notify.ParseHTTPAction(action.Method, action.URL, action.Headers, action.Body)
+		if err != nil {
+			log.Printf("Skipping HTTP action %s: %v", action.ID, err)
+			continue
+		}
+		go func() {
+			ctx, cancel := context.WithTimeout(context.Background(), notifyTimeout)
+			defer cancel()
+			if err := notifier.Notify(ctx, msg); err != nil {
+				log.Printf("HTTP action %s (%s) failed: %v", action.ID, action.Name, err)
+			}
+		}()
+	}
+}
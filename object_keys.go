@@ -0,0 +1,226 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/url"
+	"path"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/aws/smithy-go"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/google/uuid"
+)
+
+// KEY_SCHEME picks how new objects are named. Artifacts store their full
+// key, so objects written under an older scheme keep working after a switch
+// and nothing has to be renamed.
+//
+//	v1: {landscape|portrait|other}/{random}.mp4, originals/{random}.mp4,
+//	    renditions/{videoID}/... and {thumbnail|preview}/{videoID}/...
+//	v2: users/{userID}/videos/{videoID}/{artifact}/...
+const (
+	keySchemeV1 = "v1"
+	keySchemeV2 = "v2"
+)
+
+func parseKeyScheme(s string) (string, error) {
+	switch s {
+	case keySchemeV1, keySchemeV2:
+		return s, nil
+	}
+	return "", fmt.Errorf("unknown key scheme %q, expected %s or %s", s, keySchemeV1, keySchemeV2)
+}
+
+// objectKey names the objects of one video under the configured scheme.
+type objectKey struct {
+	scheme      string
+	userID      uuid.UUID
+	videoID     uuid.UUID
+	environment string
+}
+
+func (cfg *apiConfig) objectKeys(userID, videoID uuid.UUID) objectKey {
+	return objectKey{scheme: cfg.keyScheme, userID: userID, videoID: videoID, environment: cfg.platform}
+}
+
+// tags are the S3 tags of the video's objects of one kind. Tags let
+// lifecycle rules, cost allocation reports and bulk cleanups select objects
+// without the database, whatever the key scheme.
+func (k objectKey) tags(kind database.ArtifactKind) []types.Tag {
+	return []types.Tag{
+		{Key: aws.String("user_id"), Value: aws.String(k.userID.String())},
+		{Key: aws.String("video_id"), Value: aws.String(k.videoID.String())},
+		{Key: aws.String("artifact_kind"), Value: aws.String(string(kind))},
+		{Key: aws.String("environment"), Value: aws.String(k.environment)},
+	}
+}
+
+// tagging is tags encoded for the Tagging field of uploads.
+func (k objectKey) tagging(kind database.ArtifactKind) *string {
+	values := url.Values{}
+	for _, tag := range k.tags(kind) {
+		values.Set(aws.ToString(tag.Key), aws.ToString(tag.Value))
+	}
+	return aws.String(values.Encode())
+}
+
+// video names the fast start encode. Only v1 needs the aspect ratio, which
+// is called lazily so v2 uploads skip the extra ffprobe run.
+func (k objectKey) video(mediaType string, aspectRatio func() (string, error)) (string, error) {
+	name := generateRandomNameWithExtensionType(mediaType)
+	if k.scheme == keySchemeV1 {
+		ratio, err := aspectRatio()
+		if err != nil {
+			return "", err
+		}
+		return path.Join(ratio, name), nil
+	}
+	return path.Join(k.videoPrefix(), "video", name), nil
+}
+
+// source names an original kept for the external transcoder.
+func (k objectKey) source(mediaType string) string {
+	name := generateRandomNameWithExtensionType(mediaType)
+	if k.scheme == keySchemeV1 {
+		return path.Join("originals", name)
+	}
+	return path.Join(k.videoPrefix(), "source", name)
+}
+
+// derived names a file generated from the video, such as its thumbnail,
+// under dir.
+func (k objectKey) derived(dir, mediaType string) string {
+	name := generateRandomNameWithExtensionType(mediaType)
+	if k.scheme == keySchemeV1 {
+		return path.Join(dir, k.videoID.String(), name)
+	}
+	return path.Join(k.videoPrefix(), dir, name)
+}
+
+// contentAddressed names a small generated image after its contents, under
+// dir like derived. Regenerating an identical image lands on the same key.
+func (k objectKey) contentAddressed(dir string, sum []byte, mediaType string) string {
+	name := contentAddressedName(sum, mediaType)
+	if k.scheme == keySchemeV1 {
+		return path.Join(dir, k.videoID.String(), name)
+	}
+	return path.Join(k.videoPrefix(), dir, name)
+}
+
+// copyOf names this video's copy of another video's artifact. File names
+// are random or content hashes, so they're kept wherever the key includes
+// the video ID; v1 videos and originals don't, so they get new names, in
+// the same aspect ratio directory for videos.
+func (k objectKey) copyOf(a database.Artifact) string {
+	name := path.Base(a.Key)
+	switch a.Kind {
+	case database.ArtifactKindVideo:
+		if k.scheme == keySchemeV1 {
+			return path.Join(path.Dir(a.Key), generateRandomName(path.Ext(name)))
+		}
+		return path.Join(k.videoPrefix(), "video", name)
+	case database.ArtifactKindSource:
+		if k.scheme == keySchemeV1 {
+			return path.Join("originals", generateRandomName(path.Ext(name)))
+		}
+		return path.Join(k.videoPrefix(), "source", name)
+	case database.ArtifactKindRendition:
+		return path.Join(k.renditions(), name)
+	}
+	if k.scheme == keySchemeV1 {
+		return path.Join(string(a.Kind), k.videoID.String(), name)
+	}
+	return path.Join(k.videoPrefix(), string(a.Kind), name)
+}
+
+// renditions is the prefix the transcoder writes its outputs under.
+func (k objectKey) renditions() string {
+	if k.scheme == keySchemeV1 {
+		return path.Join("renditions", k.videoID.String())
+	}
+	return path.Join(k.videoPrefix(), "renditions")
+}
+
+func (k objectKey) videoPrefix() string {
+	return path.Join(userKeyPrefix(k.userID), "videos", k.videoID.String())
+}
+
+// userKeyPrefix is where every v2 object of a user lives, so their storage
+// can be listed or removed without going through the database.
+func userKeyPrefix(userID uuid.UUID) string {
+	return "users/" + userID.String()
+}
+
+// deletePrefix removes every object under prefix. With v2 keys that catches
+// objects the artifacts table lost track of, such as the leftovers of an
+// upload that failed halfway.
+func (cfg *apiConfig) deletePrefix(ctx context.Context, prefix string) error {
+	keys, err := cfg.listPrefix(ctx, prefix)
+	if err != nil {
+		return err
+	}
+	return cfg.deleteObjects(ctx, keys)
+}
+
+// listPrefix returns the key of every object under prefix.
+func (cfg *apiConfig) listPrefix(ctx context.Context, prefix string) ([]string, error) {
+	keys := []string{}
+	paginator := s3.NewListObjectsV2Paginator(cfg.s3Client, &s3.ListObjectsV2Input{
+		Bucket: aws.String(cfg.s3Bucket),
+		Prefix: aws.String(prefix + "/"),
+	})
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return nil, err
+		}
+		for _, obj := range page.Contents {
+			keys = append(keys, aws.ToString(obj.Key))
+		}
+	}
+	return keys, nil
+}
+
+// errObjectExists is returned by writes made with If-None-Match: * when
+// the key is already taken.
+var errObjectExists = errors.New("object already exists")
+
+// maxNewKeyAttempts bounds how often putNewObject picks another key. With
+// 256 random bits per key even a second attempt means something is wrong.
+const maxNewKeyAttempts = 3
+
+// putNewObject writes an object under key. put must make a conditional
+// write, so an existing object is never overwritten, and return
+// errObjectExists when the key is taken, in which case it's called again
+// with a key from newKey. It returns the key written.
+func putNewObject(key string, newKey func() (string, error), put func(key string) error) (string, error) {
+	for attempt := 1; ; attempt++ {
+		err := put(key)
+		if !errors.Is(err, errObjectExists) {
+			return key, err
+		}
+		if attempt == maxNewKeyAttempts {
+			return "", fmt.Errorf("%d keys in a row were already taken: %w", attempt, err)
+		}
+		log.Printf("Key %s is already taken, retrying with a new key", key)
+		key, err = newKey()
+		if err != nil {
+			return "", err
+		}
+	}
+}
+
+// conditionalWriteError turns S3's answer to a failed If-None-Match: *
+// write into errObjectExists.
+func conditionalWriteError(err error) error {
+	var apiErr smithy.APIError
+	if errors.As(err, &apiErr) && apiErr.ErrorCode() == "PreconditionFailed" {
+		return fmt.Errorf("%w: %v", errObjectExists, err)
+	}
+	return err
+}
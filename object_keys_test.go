@@ -0,0 +1,48 @@
+package main
+
+import (
+	"path"
+	"strings"
+	"testing"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/google/uuid"
+)
+
+func FuzzObjectKeys(f *testing.F) {
+	f.Add("video/mp4", "thumbnail", true)
+	f.Add("image/png; x=../..", "preview", false)
+	f.Add("", "", true)
+	f.Fuzz(func(t *testing.T, mediaType, dir string, v2 bool) {
+		if dir == "" || path.Clean(dir) != dir || strings.HasPrefix(dir, "/") || strings.Contains(dir, "..") {
+			// Directories are constants in the app.
+			dir = "thumbnail"
+		}
+		k := objectKey{scheme: keySchemeV1, userID: uuid.New(), videoID: uuid.New(), environment: "test"}
+		if v2 {
+			k.scheme = keySchemeV2
+		}
+		videoKey, err := k.video(mediaType, func() (string, error) { return "landscape", nil })
+		if err != nil {
+			t.Fatal(err)
+		}
+		keys := []string{videoKey, k.source(mediaType), k.derived(dir, mediaType), k.contentAddressed(dir, []byte{1, 2, 3}, mediaType)}
+		for _, key := range keys {
+			if path.Clean(key) != key || strings.HasPrefix(key, "/") || strings.Contains(key, "..") {
+				t.Fatalf("key %q for %q isn't a clean relative key", key, mediaType)
+			}
+			if !strings.HasSuffix(key, mediaTypeToExtension(mediaType)) {
+				t.Fatalf("key %q for %q doesn't end in %q", key, mediaType, mediaTypeToExtension(mediaType))
+			}
+			if v2 && !strings.HasPrefix(key, k.videoPrefix()+"/") {
+				t.Fatalf("v2 key %q isn't under %q", key, k.videoPrefix())
+			}
+		}
+		for _, key := range keys {
+			a := database.Artifact{CreateArtifactParams: database.CreateArtifactParams{Kind: database.ArtifactKindThumbnail, Key: key}}
+			if copied := k.copyOf(a); path.Clean(copied) != copied || path.Ext(copied) != path.Ext(key) {
+				t.Fatalf("copyOf(%q) = %q", key, copied)
+			}
+		}
+	})
+}
@@ -0,0 +1,20 @@
+package main
+
+import (
+	_ "embed"
+	"net/http"
+)
+
+//go:generate go run ./cmd/tsclient
+
+// openapiSpec describes the API for clients. It's written by hand alongside
+// the handlers, and the TypeScript client in clients/typescript is generated
+// from it.
+//
+//go:embed openapi.json
+var openapiSpec []byte
+
+func handlerOpenAPI(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(openapiSpec)
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+)
+
+const (
+	defaultPageSize = 50
+	maxPageSize     = 100
+)
+
+// nextCursorHeader carries the cursor for the following page, so paged list
+// responses keep the same JSON shape as unpaged ones. It's absent on the
+// last page.
+const nextCursorHeader = "X-Next-Cursor"
+
+type pageParams struct {
+	after *database.VideoCursor
+	limit int
+}
+
+// parsePageParams reads ?limit= and ?cursor=. paged is false when neither is
+// given, in which case callers return the whole list as before.
+func parsePageParams(w http.ResponseWriter, r *http.Request) (params pageParams, paged bool, ok bool) {
+	query := r.URL.Query()
+	limitString, cursorString := query.Get("limit"), query.Get("cursor")
+	if limitString == "" && cursorString == "" {
+		return pageParams{}, false, true
+	}
+
+	params.limit = defaultPageSize
+	if limitString != "" {
+		limit, err := strconv.Atoi(limitString)
+		if err != nil || limit < 1 || limit > maxPageSize {
+			respondWithErrorf(w, http.StatusBadRequest, err, "limit must be between 1 and %d", maxPageSize)
+			return pageParams{}, false, false
+		}
+		params.limit = limit
+	}
+	if cursorString != "" {
+		cursor, err := database.DecodeVideoCursor(cursorString)
+		if err != nil {
+			respondWithError(w, http.StatusBadRequest, "Invalid cursor", err)
+			return pageParams{}, false, false
+		}
+		params.after = &cursor
+	}
+	return params, true, true
+}
@@ -0,0 +1,88 @@
+package client
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type User struct {
+	ID              uuid.UUID  `json:"id"`
+	CreatedAt       time.Time  `json:"created_at"`
+	UpdatedAt       time.Time  `json:"updated_at"`
+	EmailVerifiedAt *time.Time `json:"email_verified_at"`
+	Email           string     `json:"email"`
+	Plan            string     `json:"plan"`
+}
+
+// CreateUser signs up a user. It doesn't log them in.
+func (c *Client) CreateUser(ctx context.Context, email, password string) (*User, error) {
+	var user User
+	_, err := c.do(ctx, request{
+		method: http.MethodPost,
+		path:   "/users",
+		public: true,
+		body:   map[string]string{"email": email, "password": password},
+	}, &user)
+	if err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+// Login logs the client in. Its access token is refreshed as it expires
+// until Logout is called.
+func (c *Client) Login(ctx context.Context, email, password string) (*User, error) {
+	var resp struct {
+		User
+		Token        string `json:"token"`
+		RefreshToken string `json:"refresh_token"`
+	}
+	_, err := c.do(ctx, request{
+		method: http.MethodPost,
+		path:   "/login",
+		public: true,
+		body:   map[string]string{"email": email, "password": password},
+	}, &resp)
+	if err != nil {
+		return nil, err
+	}
+	c.setTokens(resp.Token, resp.RefreshToken)
+	return &resp.User, nil
+}
+
+// Refresh replaces the access token with a new one. Calls do this on their
+// own when the server rejects an expired token.
+func (c *Client) Refresh(ctx context.Context) error {
+	_, refreshToken := c.Tokens()
+	if refreshToken == "" {
+		return ErrNotLoggedIn
+	}
+	var resp struct {
+		Token string `json:"token"`
+	}
+	_, err := c.do(ctx, request{method: http.MethodPost, path: "/refresh", auth: refreshToken}, &resp)
+	if err != nil {
+		return err
+	}
+	c.setTokens(resp.Token, "")
+	return nil
+}
+
+// Logout revokes the refresh token and forgets both tokens.
+func (c *Client) Logout(ctx context.Context) error {
+	_, refreshToken := c.Tokens()
+	if refreshToken == "" {
+		return ErrNotLoggedIn
+	}
+	_, err := c.do(ctx, request{method: http.MethodPost, path: "/revoke", auth: refreshToken}, nil)
+	if err != nil {
+		return err
+	}
+	c.mu.Lock()
+	c.token, c.refreshToken = "", ""
+	c.mu.Unlock()
+	return nil
+}
@@ -0,0 +1,167 @@
+// Package client is a Go client for the Tubely API. It handles logging in
+// and refreshing tokens, uploading videos, including uploads that resume
+// where they left off, and managing videos.
+//
+//	c := client.New("https://tubely.example.com")
+//	if _, err := c.Login(ctx, email, password); err != nil {
+//		return err
+//	}
+//	video, err := c.CreateVideo(ctx, client.CreateVideoParams{Title: "Boots"})
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Client calls the API of one Tubely server. It's safe for concurrent use.
+type Client struct {
+	baseURL    string
+	httpClient *http.Client
+
+	mu           sync.Mutex
+	token        string
+	refreshToken string
+}
+
+type Option func(*Client)
+
+// WithHTTPClient sets the client requests are made with.
+func WithHTTPClient(httpClient *http.Client) Option {
+	return func(c *Client) {
+		c.httpClient = httpClient
+	}
+}
+
+// WithTokens starts the client with tokens saved from an earlier Login,
+// see Tokens.
+func WithTokens(token, refreshToken string) Option {
+	return func(c *Client) {
+		c.token = token
+		c.refreshToken = refreshToken
+	}
+}
+
+// New returns a client for the server at baseURL, e.g.
+// https://tubely.example.com.
+func New(baseURL string, opts ...Option) *Client {
+	c := &Client{
+		baseURL:    strings.TrimSuffix(baseURL, "/"),
+		httpClient: &http.Client{Timeout: 5 * time.Minute},
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c
+}
+
+// Tokens returns the client's current access and refresh tokens, which
+// change when the access token is refreshed.
+func (c *Client) Tokens() (token, refreshToken string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.token, c.refreshToken
+}
+
+func (c *Client) setTokens(token, refreshToken string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.token = token
+	if refreshToken != "" {
+		c.refreshToken = refreshToken
+	}
+}
+
+// request is an API call. Body is encoded as JSON unless it's a []byte or
+// an io.Reader, which are sent as is.
+type request struct {
+	method      string
+	path        string
+	body        any
+	contentType string
+	header      http.Header
+	// auth is the token to authenticate with instead of the access token.
+	auth string
+	// public requests are made without a token.
+	public bool
+}
+
+// do makes an API call and decodes the response into out if it isn't nil.
+// A request the server rejects because the access token expired is retried
+// once with a refreshed token, unless its body can't be sent again.
+func (c *Client) do(ctx context.Context, req request, out any) (*http.Response, error) {
+	resp, err := c.send(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	_, isReader := req.body.(io.Reader)
+	if resp.StatusCode == http.StatusUnauthorized && req.auth == "" && !req.public && !isReader {
+		_, refreshToken := c.Tokens()
+		if refreshToken != "" {
+			resp.Body.Close()
+			if err := c.Refresh(ctx); err != nil {
+				return nil, err
+			}
+			resp, err = c.send(ctx, req)
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		return resp, newAPIError(resp)
+	}
+	if out != nil {
+		if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+			return resp, fmt.Errorf("couldn't decode response: %w", err)
+		}
+	}
+	return resp, nil
+}
+
+func (c *Client) send(ctx context.Context, req request) (*http.Response, error) {
+	var body io.Reader
+	contentType := req.contentType
+	switch b := req.body.(type) {
+	case nil:
+	case []byte:
+		body = bytes.NewReader(b)
+	case io.Reader:
+		body = b
+	default:
+		data, err := json.Marshal(b)
+		if err != nil {
+			return nil, err
+		}
+		body = bytes.NewReader(data)
+		contentType = "application/json"
+	}
+
+	httpReq, err := http.NewRequestWithContext(ctx, req.method, c.baseURL+"/api/v2"+req.path, body)
+	if err != nil {
+		return nil, err
+	}
+	for name, values := range req.header {
+		httpReq.Header[name] = values
+	}
+	if contentType != "" {
+		httpReq.Header.Set("Content-Type", contentType)
+	}
+	token := req.auth
+	if token == "" && !req.public {
+		token, _ = c.Tokens()
+	}
+	if token != "" {
+		httpReq.Header.Set("Authorization", "Bearer "+token)
+	}
+	return c.httpClient.Do(httpReq)
+}
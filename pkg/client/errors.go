@@ -0,0 +1,80 @@
+package client
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+)
+
+// Errors an *APIError matches with errors.Is, by its status code.
+var (
+	ErrUnauthorized = errors.New("unauthorized")
+	ErrForbidden    = errors.New("forbidden")
+	ErrNotFound     = errors.New("not found")
+	ErrConflict     = errors.New("conflict")
+	ErrGone         = errors.New("gone")
+	ErrValidation   = errors.New("invalid request")
+	ErrRateLimited  = errors.New("rate limited")
+)
+
+// ErrNotLoggedIn is returned by calls that need a token before Login.
+var ErrNotLoggedIn = errors.New("client isn't logged in")
+
+// APIError is an error response from the server.
+type APIError struct {
+	StatusCode int
+	// Code identifies the error independently of the language Message is
+	// in.
+	Code    string
+	Message string
+	// Fields are the errors of individual fields of a rejected request, by
+	// field name.
+	Fields map[string]string
+}
+
+func (e *APIError) Error() string {
+	if e.Message == "" {
+		return fmt.Sprintf("tubely: %d %s", e.StatusCode, http.StatusText(e.StatusCode))
+	}
+	return fmt.Sprintf("tubely: %d %s", e.StatusCode, e.Message)
+}
+
+func (e *APIError) Is(target error) bool {
+	switch e.StatusCode {
+	case http.StatusUnauthorized:
+		return target == ErrUnauthorized
+	case http.StatusForbidden:
+		return target == ErrForbidden
+	case http.StatusNotFound:
+		return target == ErrNotFound
+	case http.StatusConflict:
+		return target == ErrConflict
+	case http.StatusGone:
+		return target == ErrGone
+	case http.StatusUnprocessableEntity:
+		return target == ErrValidation
+	case http.StatusTooManyRequests:
+		return target == ErrRateLimited
+	}
+	return false
+}
+
+func newAPIError(resp *http.Response) *APIError {
+	apiErr := &APIError{StatusCode: resp.StatusCode}
+	var body struct {
+		Error  string            `json:"error"`
+		Code   string            `json:"code"`
+		Fields map[string]string `json:"fields"`
+	}
+	// Errors from proxies in front of the server aren't JSON, in which case
+	// only the status is known.
+	data, _ := io.ReadAll(io.LimitReader(resp.Body, 1<<16))
+	if json.Unmarshal(data, &body) == nil {
+		apiErr.Code = body.Code
+		apiErr.Message = body.Error
+		apiErr.Fields = body.Fields
+	}
+	return apiErr
+}
@@ -0,0 +1,208 @@
+package client
+
+import (
+	"context"
+	"crypto/md5"
+	"encoding/base64"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/textproto"
+	"strconv"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type UploadParams struct {
+	// Quality is the preset the video is encoded with: sd, hd or fhd. The
+	// server picks one for the user's plan if it's empty.
+	Quality string
+}
+
+// Upload sends an mp4 video in a single request and returns the video once
+// the server accepted it, usually still processing. The upload starts over
+// if it's interrupted, so large files are better sent with
+// UploadResumable.
+func (c *Client) Upload(ctx context.Context, videoID uuid.UUID, video io.Reader, params UploadParams) (*Video, error) {
+	pr, pw := io.Pipe()
+	form := multipart.NewWriter(pw)
+	go func() {
+		pw.CloseWithError(writeUploadForm(form, video, params))
+	}()
+	defer pr.Close()
+
+	_, err := c.do(ctx, request{
+		method:      http.MethodPost,
+		path:        "/video_upload/" + videoID.String(),
+		body:        pr,
+		contentType: form.FormDataContentType(),
+	}, nil)
+	if err != nil {
+		return nil, err
+	}
+	return c.GetVideo(ctx, videoID)
+}
+
+func writeUploadForm(form *multipart.Writer, video io.Reader, params UploadParams) error {
+	if params.Quality != "" {
+		if err := form.WriteField("quality", params.Quality); err != nil {
+			return err
+		}
+	}
+	header := textproto.MIMEHeader{}
+	header.Set("Content-Disposition", `form-data; name="video"; filename="video.mp4"`)
+	header.Set("Content-Type", "video/mp4")
+	part, err := form.CreatePart(header)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(part, video); err != nil {
+		return err
+	}
+	return form.Close()
+}
+
+// UploadSession is an upload sent in parts, which can be resumed with its
+// Token until it expires.
+type UploadSession struct {
+	Token       string    `json:"token"`
+	CreatedAt   time.Time `json:"created_at"`
+	ExpiresAt   time.Time `json:"expires_at"`
+	VideoID     uuid.UUID `json:"video_id"`
+	SizeBytes   int64     `json:"size_bytes"`
+	ContentType string    `json:"content_type"`
+	Quality     string    `json:"quality"`
+	// PartSize is the size of every part but the last, which holds the rest
+	// of the file.
+	PartSize      int64 `json:"part_size"`
+	PartCount     int32 `json:"part_count"`
+	ReceivedBytes int64 `json:"received_bytes"`
+	// MissingParts are the numbers of the parts still to send, starting at
+	// 1.
+	MissingParts []int32 `json:"missing_parts"`
+}
+
+type CreateUploadSessionParams struct {
+	SizeBytes int64 `json:"size_bytes"`
+	// ContentType is video/mp4 if it's empty.
+	ContentType string `json:"content_type,omitempty"`
+	Quality     string `json:"quality,omitempty"`
+}
+
+func (c *Client) CreateUploadSession(ctx context.Context, videoID uuid.UUID, params CreateUploadSessionParams) (*UploadSession, error) {
+	var session UploadSession
+	_, err := c.do(ctx, request{
+		method: http.MethodPost,
+		path:   "/video_upload/" + videoID.String() + "/sessions",
+		body:   params,
+	}, &session)
+	if err != nil {
+		return nil, err
+	}
+	return &session, nil
+}
+
+// GetUploadSession returns a session with the parts the server is missing.
+// It fails with ErrGone once the session expired.
+func (c *Client) GetUploadSession(ctx context.Context, token string) (*UploadSession, error) {
+	var session UploadSession
+	_, err := c.do(ctx, request{method: http.MethodGet, path: "/upload_sessions/" + token}, &session)
+	if err != nil {
+		return nil, err
+	}
+	return &session, nil
+}
+
+// UploadPart sends one part of a session's file. The server checks it
+// against its MD5, so a part corrupted on the way is rejected rather than
+// assembled into the video.
+func (c *Client) UploadPart(ctx context.Context, token string, number int32, data []byte) (*UploadSession, error) {
+	sum := md5.Sum(data)
+	header := http.Header{}
+	header.Set("Content-MD5", base64.StdEncoding.EncodeToString(sum[:]))
+
+	var session UploadSession
+	_, err := c.do(ctx, request{
+		method:      http.MethodPut,
+		path:        "/upload_sessions/" + token + "/parts/" + strconv.Itoa(int(number)),
+		body:        data,
+		contentType: "application/octet-stream",
+		header:      header,
+	}, &session)
+	if err != nil {
+		return nil, err
+	}
+	return &session, nil
+}
+
+// CompleteUploadSession assembles the parts of a session into its video
+// and returns the video, usually still processing.
+func (c *Client) CompleteUploadSession(ctx context.Context, token string, videoID uuid.UUID) (*Video, error) {
+	_, err := c.do(ctx, request{method: http.MethodPost, path: "/upload_sessions/" + token + "/complete"}, nil)
+	if err != nil {
+		return nil, err
+	}
+	return c.GetVideo(ctx, videoID)
+}
+
+// DeleteUploadSession cancels an upload and discards the parts sent so far.
+func (c *Client) DeleteUploadSession(ctx context.Context, token string) error {
+	_, err := c.do(ctx, request{method: http.MethodDelete, path: "/upload_sessions/" + token}, nil)
+	return err
+}
+
+type ResumableUploadParams struct {
+	Quality string
+	// ContentType is video/mp4 if it's empty.
+	ContentType string
+	// Token resumes the session of an earlier upload of the same file
+	// instead of starting a new one.
+	Token string
+	// OnSession is called with the session before any part is sent, so the
+	// caller can save its Token to resume the upload after a restart.
+	OnSession func(*UploadSession)
+	// OnProgress is called after every part with the bytes the server has.
+	OnProgress func(received, total int64)
+}
+
+// UploadResumable sends a video in parts, only sending the parts the
+// server doesn't have yet when params.Token resumes an earlier upload. A
+// failed upload can be resumed with the same token until the session
+// expires.
+func (c *Client) UploadResumable(ctx context.Context, videoID uuid.UUID, file io.ReaderAt, size int64, params ResumableUploadParams) (*Video, error) {
+	var session *UploadSession
+	var err error
+	if params.Token != "" {
+		session, err = c.GetUploadSession(ctx, params.Token)
+	} else {
+		session, err = c.CreateUploadSession(ctx, videoID, CreateUploadSessionParams{
+			SizeBytes:   size,
+			ContentType: params.ContentType,
+			Quality:     params.Quality,
+		})
+	}
+	if err != nil {
+		return nil, err
+	}
+	if params.OnSession != nil {
+		params.OnSession(session)
+	}
+
+	buf := make([]byte, session.PartSize)
+	for _, number := range session.MissingParts {
+		offset := int64(number-1) * session.PartSize
+		n, err := io.ReadFull(io.NewSectionReader(file, offset, session.PartSize), buf)
+		if err != nil && err != io.ErrUnexpectedEOF {
+			return nil, err
+		}
+		updated, err := c.UploadPart(ctx, session.Token, number, buf[:n])
+		if err != nil {
+			return nil, err
+		}
+		if params.OnProgress != nil {
+			params.OnProgress(updated.ReceivedBytes, updated.SizeBytes)
+		}
+	}
+	return c.CompleteUploadSession(ctx, session.Token, session.VideoID)
+}
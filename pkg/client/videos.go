@@ -0,0 +1,148 @@
+package client
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type Video struct {
+	ID          uuid.UUID  `json:"id"`
+	CreatedAt   time.Time  `json:"created_at"`
+	UpdatedAt   time.Time  `json:"updated_at"`
+	PublishedAt *time.Time `json:"published_at"`
+	Title       string     `json:"title"`
+	Description string     `json:"description"`
+	SizeBytes   int64      `json:"size_bytes"`
+	UserID      uuid.UUID  `json:"user_id"`
+	// Status is draft, queued, processing, ready or failed. It's empty on
+	// the videos returned by CreateVideo and SetMetadata.
+	Status string `json:"status"`
+	// URLs are nil until a video was uploaded, and on the videos returned
+	// by CreateVideo and SetMetadata.
+	URLs *VideoURLs `json:"urls"`
+
+	PasswordProtected bool              `json:"password_protected"`
+	ExpiresAt         *time.Time        `json:"expires_at"`
+	PurgeOnExpiry     bool              `json:"purge_on_expiry"`
+	UnpublishedAt     *time.Time        `json:"unpublished_at"`
+	DownloadsEnabled  bool              `json:"downloads_enabled"`
+	Tags              []string          `json:"tags"`
+	Metadata          map[string]string `json:"metadata"`
+}
+
+// VideoURLs link to a video and its artifacts. Presigned URLs stop working
+// at ExpiresAt.
+type VideoURLs struct {
+	Video             *string     `json:"video"`
+	Thumbnail         *string     `json:"thumbnail"`
+	Preview           *string     `json:"preview"`
+	Captions          []Link      `json:"captions"`
+	Renditions        []Rendition `json:"renditions"`
+	Sprites           []Link      `json:"sprites"`
+	AudioDescriptions []Link      `json:"audio_descriptions"`
+	AudioTracks       []Link      `json:"audio_tracks"`
+	ExpiresAt         *time.Time  `json:"expires_at"`
+}
+
+type Link struct {
+	URL       string `json:"url"`
+	Width     int    `json:"width"`
+	Height    int    `json:"height"`
+	SizeBytes int64  `json:"size_bytes"`
+	Language  string `json:"language"`
+}
+
+type Rendition struct {
+	URL        string `json:"url"`
+	Width      int    `json:"width"`
+	Height     int    `json:"height"`
+	DurationMS int64  `json:"duration_ms"`
+	Codec      string `json:"codec"`
+}
+
+type CreateVideoParams struct {
+	Title       string            `json:"title"`
+	Description string            `json:"description"`
+	Metadata    map[string]string `json:"metadata,omitempty"`
+}
+
+func (c *Client) CreateVideo(ctx context.Context, params CreateVideoParams) (*Video, error) {
+	var video Video
+	_, err := c.do(ctx, request{method: http.MethodPost, path: "/videos", body: params}, &video)
+	if err != nil {
+		return nil, err
+	}
+	return &video, nil
+}
+
+func (c *Client) GetVideo(ctx context.Context, videoID uuid.UUID) (*Video, error) {
+	var video Video
+	_, err := c.do(ctx, request{method: http.MethodGet, path: "/videos/" + videoID.String()}, &video)
+	if err != nil {
+		return nil, err
+	}
+	return &video, nil
+}
+
+type ListVideosParams struct {
+	// Limit is the page size, 50 if it's 0.
+	Limit int
+	// Cursor is the NextCursor of the previous page.
+	Cursor string
+	// Metadata only lists videos with these metadata values.
+	Metadata map[string]string
+}
+
+type VideoPage struct {
+	Videos []Video
+	// NextCursor is empty on the last page.
+	NextCursor string
+}
+
+// ListVideos lists a page of the user's videos.
+func (c *Client) ListVideos(ctx context.Context, params ListVideosParams) (*VideoPage, error) {
+	query := url.Values{}
+	query.Set("limit", strconv.Itoa(params.Limit))
+	if params.Limit == 0 {
+		query.Set("limit", "50")
+	}
+	if params.Cursor != "" {
+		query.Set("cursor", params.Cursor)
+	}
+	for key, value := range params.Metadata {
+		query.Set("metadata."+key, value)
+	}
+
+	page := VideoPage{}
+	resp, err := c.do(ctx, request{method: http.MethodGet, path: "/videos?" + query.Encode()}, &page.Videos)
+	if err != nil {
+		return nil, err
+	}
+	page.NextCursor = resp.Header.Get("X-Next-Cursor")
+	return &page, nil
+}
+
+// DeleteVideo deletes a video with its files.
+func (c *Client) DeleteVideo(ctx context.Context, videoID uuid.UUID) error {
+	_, err := c.do(ctx, request{method: http.MethodDelete, path: "/videos/" + videoID.String()}, nil)
+	return err
+}
+
+// SetMetadata replaces a video's metadata.
+func (c *Client) SetMetadata(ctx context.Context, videoID uuid.UUID, metadata map[string]string) (*Video, error) {
+	var video Video
+	_, err := c.do(ctx, request{
+		method: http.MethodPut,
+		path:   "/videos/" + videoID.String() + "/metadata",
+		body:   metadata,
+	}, &video)
+	if err != nil {
+		return nil, err
+	}
+	return &video, nil
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+)
+
+// setLastModified exposes a video's updated_at so clients can make
+// conditional requests with If-Unmodified-Since.
+func setLastModified(w http.ResponseWriter, video database.Video) {
+	w.Header().Set("Last-Modified", video.UpdatedAt.UTC().Format(http.TimeFormat))
+}
+
+// checkUnmodifiedSince enforces an If-Unmodified-Since header against a
+// video, responding with 412 and returning false if it changed since. It
+// returns true when there's no (valid) header, as RFC 9110 requires.
+func checkUnmodifiedSince(w http.ResponseWriter, r *http.Request, video database.Video) bool {
+	header := r.Header.Get("If-Unmodified-Since")
+	if header == "" {
+		return true
+	}
+	since, err := http.ParseTime(header)
+	if err != nil {
+		return true
+	}
+	// HTTP dates only have second precision.
+	if video.UpdatedAt.Truncate(time.Second).After(since) {
+		setLastModified(w, video)
+		respondWithErrorf(w, http.StatusPreconditionFailed, nil, "Video was modified since %s", header)
+		return false
+	}
+	return true
+}
+
+// responseETag derives a weak ETag from the state a response is built from,
+// such as each video's ID and updated_at, rather than from the body, which
+// is cheaper and stays stable while nothing changes. Presigned URLs expire,
+// so with PRESIGN_TTL set the tag also changes every half TTL, before
+// clients are left holding URLs that no longer work.
+func (cfg *apiConfig) responseETag(state ...any) string {
+	h := sha256.New()
+	for _, part := range state {
+		fmt.Fprintf(h, "%v\x00", part)
+	}
+	if cfg.presignTTL > 0 {
+		fmt.Fprintf(h, "%d", time.Now().UnixNano()/int64(cfg.presignTTL/2))
+	}
+	return `W/"` + hex.EncodeToString(h.Sum(nil)[:16]) + `"`
+}
+
+// checkNoneMatch sets the ETag header and, if the client's If-None-Match
+// already has it, responds with 304 and returns false.
+func checkNoneMatch(w http.ResponseWriter, r *http.Request, etag string) bool {
+	w.Header().Set("ETag", etag)
+	header := r.Header.Get("If-None-Match")
+	if header == "" {
+		return true
+	}
+	// If-None-Match uses weak comparison, so W/ prefixes are ignored.
+	opaque := strings.TrimPrefix(etag, "W/")
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" || strings.TrimPrefix(candidate, "W/") == opaque {
+			w.WriteHeader(http.StatusNotModified)
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,190 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+)
+
+// PREFLIGHT decides what happens when a startup check fails: strict refuses
+// to start, warn (the default) starts degraded and logs the report, off
+// skips the checks.
+const (
+	preflightStrict = "strict"
+	preflightWarn   = "warn"
+	preflightOff    = "off"
+)
+
+type preflightCheck struct {
+	Name   string `json:"name"`
+	OK     bool   `json:"ok"`
+	Detail string `json:"detail"`
+	// Fix says what to do about a failed check.
+	Fix string `json:"fix,omitempty"`
+}
+
+type preflightReport struct {
+	Checks    []preflightCheck `json:"checks"`
+	CheckedAt time.Time        `json:"checked_at"`
+}
+
+func (report preflightReport) ok() bool {
+	for _, check := range report.Checks {
+		if !check.OK {
+			return false
+		}
+	}
+	return true
+}
+
+func (report preflightReport) String() string {
+	var b strings.Builder
+	b.WriteString("Preflight checks:\n")
+	for _, check := range report.Checks {
+		status := "ok  "
+		if !check.OK {
+			status = "FAIL"
+		}
+		fmt.Fprintf(&b, "  %s  %-13s %s\n", status, check.Name, check.Detail)
+		if !check.OK && check.Fix != "" {
+			fmt.Fprintf(&b, "        %-13s -> %s\n", "", check.Fix)
+		}
+	}
+	return b.String()
+}
+
+// runPreflight checks the dependencies the server can't work without. Each
+// check is independent, so one report lists everything that needs fixing.
+func (cfg *apiConfig) runPreflight(ctx context.Context) preflightReport {
+	report := preflightReport{CheckedAt: time.Now().UTC()}
+	if cfg.transcoder == nil {
+		report.Checks = append(report.Checks, checkMediaTool("ffmpeg"), checkMediaTool("ffprobe"))
+	}
+	report.Checks = append(report.Checks,
+		cfg.checkBucket(ctx),
+		cfg.checkAssetsDir(),
+		cfg.checkSchema(),
+	)
+	return report
+}
+
+func checkMediaTool(name string) preflightCheck {
+	check := preflightCheck{
+		Name: name,
+		Fix:  "install ffmpeg (https://ffmpeg.org/download.html) so " + name + " is on the PATH",
+	}
+	path, err := exec.LookPath(name)
+	if err != nil {
+		check.Detail = "not found on the PATH"
+		return check
+	}
+	var stdout bytes.Buffer
+	cmd := exec.Command(path, "-version")
+	cmd.Stdout = &stdout
+	if err := cmd.Run(); err != nil {
+		check.Detail = fmt.Sprintf("%s -version failed: %v", path, err)
+		return check
+	}
+	// e.g. "ffmpeg version 6.1.1-3ubuntu5 Copyright (c) 2000-2023 ..."
+	fields := strings.Fields(stdout.String())
+	check.Detail = path
+	if len(fields) >= 3 && fields[1] == "version" {
+		check.Detail = fields[2] + " at " + path
+	}
+	check.OK = true
+	return check
+}
+
+func (cfg *apiConfig) checkBucket(ctx context.Context) preflightCheck {
+	check := preflightCheck{Name: "s3 bucket"}
+	if cfg.localS3 != nil {
+		check.OK = true
+		check.Detail = fmt.Sprintf("%q on local storage", cfg.s3Bucket)
+		return check
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+	_, err := cfg.s3Client.HeadBucket(ctx, &s3.HeadBucketInput{Bucket: aws.String(cfg.s3Bucket)})
+	if err != nil {
+		check.Detail = fmt.Sprintf("can't access %q in %s: %v", cfg.s3Bucket, cfg.s3Region, err)
+		check.Fix = "check the AWS credentials (aws sts get-caller-identity) and that S3_BUCKET exists in S3_REGION"
+		return check
+	}
+	check.OK = true
+	check.Detail = fmt.Sprintf("%q in %s", cfg.s3Bucket, cfg.s3Region)
+	return check
+}
+
+func (cfg *apiConfig) checkAssetsDir() preflightCheck {
+	check := preflightCheck{
+		Name: "assets dir",
+		Fix:  "make ASSETS_ROOT a directory the server's user can write to",
+	}
+	f, err := os.CreateTemp(cfg.assetsRoot, ".preflight-*")
+	if err != nil {
+		check.Detail = fmt.Sprintf("can't write to %s: %v", cfg.assetsRoot, err)
+		return check
+	}
+	f.Close()
+	os.Remove(f.Name())
+	check.OK = true
+	check.Detail = cfg.assetsRoot + " is writable"
+	return check
+}
+
+func (cfg *apiConfig) checkSchema() preflightCheck {
+	check := preflightCheck{Name: "db schema"}
+	applied, latest, err := cfg.db.SchemaVersion()
+	if err != nil {
+		check.Detail = fmt.Sprintf("can't read the schema version: %v", err)
+		check.Fix = "check that DB_PATH points at a Tubely database"
+		return check
+	}
+	switch {
+	case applied > latest:
+		check.Detail = fmt.Sprintf("database is at %s, newer than this binary's %s", applied, latest)
+		check.Fix = "run the release that last migrated the database, or restore a backup (tubely db-restore)"
+	case applied < latest:
+		check.Detail = fmt.Sprintf("database is at %s, %s is pending", applied, latest)
+		check.Fix = "restart to apply the pending migrations and check the log for errors"
+	default:
+		check.OK = true
+		check.Detail = "at " + applied
+	}
+	return check
+}
+
+// preflight runs the startup checks according to mode. It only returns an
+// error in strict mode.
+func (cfg *apiConfig) preflight(ctx context.Context, mode string) error {
+	if mode == preflightOff {
+		return nil
+	}
+	report := cfg.runPreflight(ctx)
+	if report.ok() {
+		log.Print(report)
+		return nil
+	}
+	if mode == preflightStrict {
+		return fmt.Errorf("preflight checks failed, refusing to start (set PREFLIGHT=warn to start anyway)\n%s", report)
+	}
+	log.Printf("Starting degraded, some preflight checks failed\n%s", report)
+	return nil
+}
+
+// handlerAdminPreflight reruns the checks, so an operator can confirm a fix
+// without restarting.
+func (cfg *apiConfig) handlerAdminPreflight(w http.ResponseWriter, r *http.Request) {
+	report := cfg.runPreflight(r.Context())
+	respondWithJSON(w, http.StatusOK, report)
+}
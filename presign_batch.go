@@ -0,0 +1,209 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/abuse"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/auth"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/validate"
+	"github.com/google/uuid"
+)
+
+// maxPresignItems bounds a bulk presign, enough for a page of a gallery.
+const maxPresignItems = 100
+
+// presignableArtifacts are the artifact kinds clients can get URLs for.
+// Sources are only for the transcoder.
+var presignableArtifacts = []database.ArtifactKind{
+	database.ArtifactKindVideo,
+	database.ArtifactKindRendition,
+	database.ArtifactKindThumbnail,
+	database.ArtifactKindPreview,
+	database.ArtifactKindCaptions,
+	database.ArtifactKindSprite,
+	database.ArtifactKindAudioDescription,
+	database.ArtifactKindAudioTrack,
+}
+
+type presignItem struct {
+	VideoID  uuid.UUID             `json:"video_id"`
+	Artifact database.ArtifactKind `json:"artifact"`
+}
+
+type presignResult struct {
+	presignItem
+	Status int `json:"status"`
+	// URLs has one URL per artifact of the kind the video has, none for
+	// one it doesn't have yet, and is null for items that failed. Error and
+	// Code are set for those.
+	URLs  []artifactLink `json:"urls"`
+	Error string         `json:"error,omitempty"`
+	Code  string         `json:"code,omitempty"`
+}
+
+// handlerPresign resolves the URLs of many artifacts of the caller's
+// videos at once, so a gallery can get all its thumbnails in one request
+// rather than one per video. Each item succeeds or fails on its own, like
+// a batch.
+func (cfg *apiConfig) handlerPresign(w http.ResponseWriter, r *http.Request) {
+	type parameters struct {
+		Items []presignItem `json:"items"`
+	}
+	type response struct {
+		Results []presignResult `json:"results"`
+		// ExpiresAt is when the URLs stop working, with PRESIGN_TTL set.
+		ExpiresAt *time.Time `json:"expires_at,omitempty"`
+	}
+
+	token, err := auth.GetBearerToken(r.Header)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Couldn't find JWT", err)
+		return
+	}
+	userID, err := cfg.validateJWT(token)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Couldn't validate JWT", err)
+		return
+	}
+
+	params := parameters{}
+	if err := json.NewDecoder(r.Body).Decode(&params); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Couldn't decode parameters", err)
+		return
+	}
+	errs := validate.Errors{}
+	errs.Check(len(params.Items) > 0, "items", "is required")
+	errs.Check(len(params.Items) <= maxPresignItems, "items", "must have at most "+strconv.Itoa(maxPresignItems)+" items")
+	for _, item := range params.Items {
+		errs.Check(slices.Contains(presignableArtifacts, item.Artifact), "items",
+			"artifact must be video, rendition, thumbnail, preview, captions, sprite, audio_description or audio_track")
+	}
+	if errs.Err() != nil {
+		respondWithValidationErrors(w, errs)
+		return
+	}
+	ids := []uuid.UUID{}
+	kinds := []database.ArtifactKind{}
+	for _, item := range params.Items {
+		if !slices.Contains(ids, item.VideoID) {
+			ids = append(ids, item.VideoID)
+		}
+		if !slices.Contains(kinds, item.Artifact) {
+			kinds = append(kinds, item.Artifact)
+		}
+	}
+	// Transcoded videos have renditions instead of a video.
+	if slices.Contains(kinds, database.ArtifactKindVideo) && !slices.Contains(kinds, database.ArtifactKindRendition) {
+		kinds = append(kinds, database.ArtifactKindRendition)
+	}
+	videos, err := cfg.db.GetVideosByIDs(ids)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get videos", err)
+		return
+	}
+	unavailable, err := cfg.unavailableVideos(ids)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get takedowns", err)
+		return
+	}
+	artifacts, err := cfg.db.GetArtifactsForVideos(ids, kinds...)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get artifacts", err)
+		return
+	}
+
+	// Every URL counts against the URL limits like one from the single
+	// video endpoints would, so a batch can't be used to get around them.
+	issuanceKey := "user:" + userID.String()
+	var issuanceLimits abuse.Limits
+	if cfg.urlAbuse != nil {
+		issuanceLimits = cfg.urlLimitsFor(userID)
+	}
+
+	language := responseLanguage(w)
+	resp := response{Results: make([]presignResult, 0, len(params.Items))}
+	if cfg.presignTTL > 0 {
+		expiresAt := time.Now().Add(cfg.presignTTL).UTC()
+		resp.ExpiresAt = &expiresAt
+	}
+	for _, item := range params.Items {
+		video, ok := videos[item.VideoID]
+		result := presignResult{presignItem: item, Status: http.StatusOK}
+		var itemErr *batchItemError
+		switch {
+		case !ok:
+			itemErr = &batchItemError{status: http.StatusNotFound, msg: "Couldn't get video"}
+		case video.UserID != userID:
+			itemErr = &batchItemError{status: http.StatusForbidden, msg: "Not authorized to view video"}
+		case unavailable[video.ID]:
+			itemErr = &batchItemError{status: http.StatusGone, msg: "This video has been removed"}
+		case !cfg.allowURLIssuance(w, issuanceKey, issuanceLimits, video.ID.String()):
+			itemErr = &batchItemError{status: http.StatusTooManyRequests, msg: "Too many requests, try again later"}
+		default:
+			result.URLs, err = cfg.presignArtifacts(video, artifacts[video.ID], item.Artifact)
+			if err != nil {
+				itemErr = &batchItemError{status: http.StatusInternalServerError, msg: "Couldn't resolve video URLs", err: err}
+			}
+		}
+
+		if itemErr != nil {
+			if itemErr.err != nil {
+				log.Printf("Presigning %s of video %s failed: %v", item.Artifact, item.VideoID, itemErr.err)
+			}
+			result.Status = itemErr.status
+			result.Code, result.Error = errorMessages.Translate(language, itemErr.msg)
+			if result.Code == "" {
+				result.Code = errorCodeForStatus(itemErr.status)
+			}
+		}
+		resp.Results = append(resp.Results, result)
+	}
+	respondWithJSON(w, http.StatusOK, resp)
+}
+
+// presignArtifacts returns the URLs of the video's artifacts of kind. As
+// in videoURLsFromArtifacts, the video of a transcoded video is its largest
+// rendition and a thumbnail without an artifact is the uploaded one.
+func (cfg *apiConfig) presignArtifacts(video database.Video, artifacts []database.Artifact, kind database.ArtifactKind) ([]artifactLink, error) {
+	matching := []database.Artifact{}
+	for _, a := range artifacts {
+		if a.Kind == kind {
+			matching = append(matching, a)
+		}
+	}
+	if kind == database.ArtifactKindVideo && len(matching) == 0 {
+		var largest *database.Artifact
+		for i, a := range artifacts {
+			if a.Kind == database.ArtifactKindRendition && (largest == nil || a.Height > largest.Height) {
+				largest = &artifacts[i]
+			}
+		}
+		if largest != nil {
+			matching = append(matching, *largest)
+		}
+	}
+	if kind == database.ArtifactKindThumbnail && len(matching) == 0 && video.ThumbnailURL != nil {
+		return []artifactLink{{URL: *video.ThumbnailURL}}, nil
+	}
+
+	links := make([]artifactLink, 0, len(matching))
+	for _, a := range matching {
+		url, err := cfg.artifactURL(a.Key)
+		if err != nil {
+			return nil, err
+		}
+		links = append(links, artifactLink{URL: url, Width: a.Width, Height: a.Height, SizeBytes: a.SizeBytes, Language: a.Language})
+	}
+	if len(links) > 0 && (kind == database.ArtifactKindVideo || kind == database.ArtifactKindRendition) {
+		if err := cfg.db.RecordURLIssuance(video.UserID, video.SizeBytes); err != nil {
+			log.Printf("Couldn't record URL issuance for video %s: %v", video.ID, err)
+		}
+	}
+	return links, nil
+}
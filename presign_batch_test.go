@@ -0,0 +1,58 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/abuse"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+)
+
+func TestPresignCountsEveryItem(t *testing.T) {
+	cfg := newTestConfig(t)
+	cfg.urlAbuse = abuse.NewDetector(abuse.Limits{Window: time.Minute, MaxRequests: 1, MaxDistinct: 10, BlockFor: time.Minute})
+	cfg.planRateLimits = &planRateLimitCache{}
+	first, token := newTestVideo(t, cfg)
+	second, err := cfg.db.CreateVideo(database.CreateVideoParams{Title: "Second", UserID: first.UserID})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	body, err := json.Marshal(map[string]any{"items": []presignItem{
+		{VideoID: first.ID, Artifact: database.ArtifactKindThumbnail},
+		{VideoID: second.ID, Artifact: database.ArtifactKindThumbnail},
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	req := httptest.NewRequest(http.MethodPost, "/api/presign", bytes.NewReader(body))
+	req.Header.Set("Authorization", "Bearer "+token)
+	rec := httptest.NewRecorder()
+	cfg.handlerPresign(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d: %s", rec.Code, http.StatusOK, rec.Body)
+	}
+
+	var resp struct {
+		Results []presignResult `json:"results"`
+	}
+	if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+		t.Fatal(err)
+	}
+	if len(resp.Results) != 2 {
+		t.Fatalf("got %d results, want 2", len(resp.Results))
+	}
+	if got := resp.Results[0].Status; got != http.StatusOK {
+		t.Errorf("first item: status = %d, want %d", got, http.StatusOK)
+	}
+	if got := resp.Results[1].Status; got != http.StatusTooManyRequests {
+		t.Errorf("item over the limit: status = %d, want %d", got, http.StatusTooManyRequests)
+	}
+	if rec.Header().Get("Retry-After") == "" {
+		t.Error("no Retry-After once the caller is blocked")
+	}
+}
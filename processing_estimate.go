@@ -0,0 +1,145 @@
+package main
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/auth"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/transcoder"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/validate"
+)
+
+const (
+	// maxProcessingSamples is how many recent uploads processed with ffmpeg
+	// estimates are based on.
+	maxProcessingSamples = 100
+	// defaultProcessingBytesPerSecond is the guess for ffmpeg before any
+	// upload was processed: a fast start remux, the bulk of the work, runs
+	// at about disk speed.
+	defaultProcessingBytesPerSecond = 40 << 20
+	// defaultTranscodeSpeed is the guess for the transcoder before any job
+	// completed, as seconds of video transcoded per second.
+	defaultTranscodeSpeed = 2.0
+)
+
+// processingEstimate is how long an upload is expected to take to process
+// once it's received.
+type processingEstimate struct {
+	// Pipeline is "ffmpeg" or the transcoder's provider.
+	Pipeline         string  `json:"pipeline"`
+	EstimatedSeconds float64 `json:"estimated_seconds"`
+	// Samples is how many past uploads or jobs the estimate is based on,
+	// 0 when it's a default guess.
+	Samples int `json:"samples"`
+	// Queued is set while a processing window holds uploads back, which
+	// the estimate doesn't include.
+	Queued bool `json:"queued"`
+}
+
+// handlerProcessingEstimate estimates how long processing a file of
+// size_bytes and duration_ms would take for the user, from the throughput
+// of past uploads, so clients can set expectations before a big upload.
+// Uploads processed with ffmpeg take time with their size, transcoder jobs
+// with their duration.
+func (cfg *apiConfig) handlerProcessingEstimate(w http.ResponseWriter, r *http.Request) {
+	token, err := auth.GetBearerToken(r.Header)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Couldn't find JWT", err)
+		return
+	}
+	userID, err := cfg.validateJWT(token)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Couldn't validate JWT", err)
+		return
+	}
+
+	query := r.URL.Query()
+	size, sizeErr := strconv.ParseInt(query.Get("size_bytes"), 10, 64)
+	durationMS, durationErr := strconv.ParseInt(query.Get("duration_ms"), 10, 64)
+	errs := validate.Errors{}
+	errs.Check(sizeErr == nil && size > 0, "size_bytes", "must be a positive number")
+	errs.Check(size <= maxUploadLimit, "size_bytes", "must be at most 1GB")
+	errs.Check(durationErr == nil && durationMS > 0, "duration_ms", "must be a positive number")
+	preset := cfg.defaultTranscodePreset
+	if quality := query.Get("quality"); quality != "" {
+		preset, err = transcoder.ParsePreset(quality)
+		errs.Check(err == nil, "quality", "must be sd, hd or fhd")
+	}
+	if errs.Err() != nil {
+		respondWithValidationErrors(w, errs)
+		return
+	}
+
+	estimate := processingEstimate{Queued: cfg.activeProcessingWindow() != nil}
+	if !cfg.transcodesInCloud(userID) {
+		estimate.Pipeline = ffmpegPipeline
+		estimate.EstimatedSeconds = float64(size) / defaultProcessingBytesPerSecond
+		metrics, err := cfg.db.GetRecentProcessingMetrics(ffmpegPipeline, maxProcessingSamples)
+		if err != nil {
+			respondWithError(w, http.StatusInternalServerError, "Couldn't get processing metrics", err)
+			return
+		}
+		// Uploads of about the same size, or of any size if there are none
+		// yet, since small files spend proportionally longer starting ffmpeg.
+		var bucketBytes, bucketMS, bucketN, totalBytes, totalMS, n int64
+		for _, m := range metrics {
+			n++
+			totalBytes += m.SizeBytes
+			totalMS += m.TotalMS
+			if sizeBucket(m.SizeBytes) == sizeBucket(size) {
+				bucketN++
+				bucketBytes += m.SizeBytes
+				bucketMS += m.TotalMS
+			}
+		}
+		if bucketN > 0 && bucketBytes > 0 {
+			n, totalBytes, totalMS = bucketN, bucketBytes, bucketMS
+		}
+		if n > 0 && totalBytes > 0 {
+			estimate.EstimatedSeconds = float64(totalMS) / 1000 * float64(size) / float64(totalBytes)
+			estimate.Samples = int(n)
+		}
+		respondWithJSON(w, http.StatusOK, estimate)
+		return
+	}
+
+	_, limits, err := cfg.getUserLimits(userID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get plan limits", err)
+		return
+	}
+	preset = limits.CapPreset(preset)
+	stats, err := cfg.db.GetTranscodeStats()
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get transcoding stats", err)
+		return
+	}
+
+	// Jobs of the same preset, or of any preset if there are none yet.
+	var presetJobs, presetDurationMS, presetProcessingMS int64
+	var jobs, totalDurationMS, totalProcessingMS int64
+	for _, s := range stats {
+		if s.Provider != cfg.transcoder.Provider() || s.Status != string(transcoder.JobStatusComplete) {
+			continue
+		}
+		jobs += int64(s.Jobs)
+		totalDurationMS += s.DurationMS
+		totalProcessingMS += s.ProcessingMS
+		if s.Preset == string(preset) {
+			presetJobs += int64(s.Jobs)
+			presetDurationMS += s.DurationMS
+			presetProcessingMS += s.ProcessingMS
+		}
+	}
+	if presetJobs > 0 && presetDurationMS > 0 {
+		jobs, totalDurationMS, totalProcessingMS = presetJobs, presetDurationMS, presetProcessingMS
+	}
+
+	estimate.Pipeline = cfg.transcoder.Provider()
+	estimate.EstimatedSeconds = float64(durationMS) / 1000 / defaultTranscodeSpeed
+	if jobs > 0 && totalDurationMS > 0 {
+		estimate.EstimatedSeconds = float64(durationMS) * float64(totalProcessingMS) / float64(totalDurationMS) / 1000
+		estimate.Samples = int(jobs)
+	}
+	respondWithJSON(w, http.StatusOK, estimate)
+}
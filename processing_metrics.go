@@ -0,0 +1,201 @@
+package main
+
+import (
+	"context"
+	"log"
+	"math"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/validate"
+)
+
+const (
+	// ffmpegPipeline is the pipeline of uploads processed on the instance,
+	// as opposed to the transcoder's provider.
+	ffmpegPipeline = "ffmpeg"
+	// defaultProcessingMetricsRetention is how long processing metrics are
+	// kept unless PROCESSING_METRICS_RETENTION says otherwise.
+	defaultProcessingMetricsRetention = 90 * 24 * time.Hour
+	// processingMetricsRetentionInterval is how often old metrics are
+	// deleted.
+	processingMetricsRetentionInterval = 24 * time.Hour
+	// defaultProcessingReportDays is how far back the report goes unless
+	// ?days says otherwise.
+	defaultProcessingReportDays = 30
+)
+
+// Resolution and size buckets of the report, smallest first. A bucket is
+// the first one the video fits under.
+var (
+	resolutionBuckets = []struct {
+		name      string
+		maxHeight int
+	}{
+		{"unknown", 0},
+		{"sd", 719},
+		{"hd", 1079},
+		{"fhd", 1439},
+		{"uhd", math.MaxInt},
+	}
+	sizeBuckets = []struct {
+		name     string
+		maxBytes int64
+	}{
+		{"under_10mb", 10<<20 - 1},
+		{"10mb_100mb", 100<<20 - 1},
+		{"100mb_500mb", 500<<20 - 1},
+		{"over_500mb", math.MaxInt64},
+	}
+)
+
+func resolutionBucket(height int) int {
+	for i, b := range resolutionBuckets {
+		if height <= b.maxHeight {
+			return i
+		}
+	}
+	return len(resolutionBuckets) - 1
+}
+
+func sizeBucket(size int64) int {
+	for i, b := range sizeBuckets {
+		if size <= b.maxBytes {
+			return i
+		}
+	}
+	return len(sizeBuckets) - 1
+}
+
+// recordProcessingMetric stores how long an upload took to process. It's
+// only reporting, so failures are logged rather than failing the upload.
+func (cfg *apiConfig) recordProcessingMetric(metric database.ProcessingMetric) {
+	if err := cfg.db.CreateProcessingMetric(metric); err != nil {
+		log.Printf("Couldn't record processing metric of video %s: %v", metric.VideoID, err)
+	}
+}
+
+// runProcessingMetricsRetention deletes the metrics older than the
+// retention period.
+func (cfg *apiConfig) runProcessingMetricsRetention(ctx context.Context) error {
+	n, err := cfg.db.DeleteProcessingMetricsBefore(time.Now().Add(-cfg.processingMetricsRetention))
+	if err != nil {
+		return err
+	}
+	if n > 0 {
+		log.Printf("Deleted %d processing metrics older than %s", n, cfg.processingMetricsRetention)
+	}
+	return nil
+}
+
+// phasePercentiles are the median and 95th percentile of a processing
+// phase, in milliseconds.
+type phasePercentiles struct {
+	P50 int64 `json:"p50"`
+	P95 int64 `json:"p95"`
+}
+
+// processingReportGroup sums up the jobs of a pipeline in one resolution
+// and size bucket.
+type processingReportGroup struct {
+	Pipeline   string           `json:"pipeline"`
+	Resolution string           `json:"resolution"`
+	Size       string           `json:"size"`
+	Jobs       int              `json:"jobs"`
+	ProbeMS    phasePercentiles `json:"probe_ms"`
+	EncodeMS   phasePercentiles `json:"encode_ms"`
+	UploadMS   phasePercentiles `json:"upload_ms"`
+	TotalMS    phasePercentiles `json:"total_ms"`
+
+	resolution, size int
+	metrics          []database.ProcessingMetric
+}
+
+// handlerAdminProcessingMetrics reports how long processing took over the
+// last ?days (30 by default), as percentiles of each phase by pipeline,
+// resolution and file size, for capacity planning. ?pipeline narrows it to
+// "ffmpeg" or a transcoder provider.
+func (cfg *apiConfig) handlerAdminProcessingMetrics(w http.ResponseWriter, r *http.Request) {
+	type response struct {
+		Since  time.Time               `json:"since"`
+		Groups []processingReportGroup `json:"groups"`
+	}
+
+	days := defaultProcessingReportDays
+	if v := r.URL.Query().Get("days"); v != "" {
+		var err error
+		days, err = strconv.Atoi(v)
+		if err != nil || days < 1 || days > 3650 {
+			respondWithValidationErrors(w, validate.Errors{"days": "must be a number between 1 and 3650"})
+			return
+		}
+	}
+	since := time.Now().UTC().AddDate(0, 0, -days).Truncate(time.Second)
+
+	metrics, err := cfg.db.GetProcessingMetrics(r.URL.Query().Get("pipeline"), since)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get processing metrics", err)
+		return
+	}
+
+	type groupKey struct {
+		pipeline         string
+		resolution, size int
+	}
+	byKey := map[groupKey]*processingReportGroup{}
+	for _, m := range metrics {
+		key := groupKey{pipeline: m.Pipeline, resolution: resolutionBucket(m.Height), size: sizeBucket(m.SizeBytes)}
+		group, ok := byKey[key]
+		if !ok {
+			group = &processingReportGroup{
+				Pipeline:   key.pipeline,
+				Resolution: resolutionBuckets[key.resolution].name,
+				Size:       sizeBuckets[key.size].name,
+				resolution: key.resolution,
+				size:       key.size,
+			}
+			byKey[key] = group
+		}
+		group.metrics = append(group.metrics, m)
+	}
+
+	groups := make([]processingReportGroup, 0, len(byKey))
+	for _, group := range byKey {
+		group.Jobs = len(group.metrics)
+		group.ProbeMS = percentiles(group.metrics, func(m database.ProcessingMetric) int64 { return m.ProbeMS })
+		group.EncodeMS = percentiles(group.metrics, func(m database.ProcessingMetric) int64 { return m.EncodeMS })
+		group.UploadMS = percentiles(group.metrics, func(m database.ProcessingMetric) int64 { return m.UploadMS })
+		group.TotalMS = percentiles(group.metrics, func(m database.ProcessingMetric) int64 { return m.TotalMS })
+		groups = append(groups, *group)
+	}
+	slices.SortFunc(groups, func(a, b processingReportGroup) int {
+		if a.Pipeline != b.Pipeline {
+			return strings.Compare(a.Pipeline, b.Pipeline)
+		}
+		if a.resolution != b.resolution {
+			return a.resolution - b.resolution
+		}
+		return a.size - b.size
+	})
+
+	respondWithJSON(w, http.StatusOK, response{Since: since, Groups: groups})
+}
+
+// percentiles returns the nearest-rank median and 95th percentile of the
+// phase that ms reads.
+func percentiles(metrics []database.ProcessingMetric, ms func(database.ProcessingMetric) int64) phasePercentiles {
+	sorted := make([]int64, len(metrics))
+	for i, m := range metrics {
+		sorted[i] = ms(m)
+	}
+	slices.Sort(sorted)
+	rank := func(p int) int64 {
+		i := (len(sorted)*p + 99) / 100
+		return sorted[max(i-1, 0)]
+	}
+	return phasePercentiles{P50: rank(50), P95: rank(95)}
+}
@@ -0,0 +1,391 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/auth"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/notify"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/transcoder"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/validate"
+	"github.com/google/uuid"
+)
+
+const (
+	auditEventProcessingWindowCreated = "processing_window_created"
+	auditEventProcessingWindowDeleted = "processing_window_deleted"
+
+	maxProcessingWindowReasonLength = 500
+	// processingWindowCacheTTL is how long other instances may keep
+	// processing uploads after a window is added.
+	processingWindowCacheTTL = 30 * time.Second
+	// processingQueueInterval is how often queued uploads are checked for
+	// once no window is active.
+	processingQueueInterval = time.Minute
+	// maxQueuedUploadAttempts bounds how often a queued upload is retried
+	// after server errors, such as the bucket being unreachable.
+	maxQueuedUploadAttempts = 3
+)
+
+// queuedUploadsPrefix is where uploads wait while processing is paused.
+// They're removed once processed or when their video is deleted.
+const queuedUploadsPrefix = "queued/"
+
+type processingWindowCache struct {
+	mu       sync.Mutex
+	windows  []database.ProcessingWindow
+	loadedAt time.Time
+}
+
+func (c *processingWindowCache) get(db database.Client) ([]database.ProcessingWindow, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.windows != nil && time.Since(c.loadedAt) < processingWindowCacheTTL {
+		return c.windows, nil
+	}
+	windows, err := db.GetProcessingWindows()
+	if err != nil {
+		return nil, err
+	}
+	c.windows = windows
+	c.loadedAt = time.Now()
+	return windows, nil
+}
+
+func (c *processingWindowCache) invalidate() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.windows = nil
+}
+
+// parseTimeOfDay reads a time of day like "18:30" as minutes after
+// midnight.
+func parseTimeOfDay(s string) (int, error) {
+	t, err := time.Parse("15:04", s)
+	if err != nil {
+		return 0, err
+	}
+	return t.Hour()*60 + t.Minute(), nil
+}
+
+// processingWindowActive reports whether w pauses processing at t.
+func processingWindowActive(w database.ProcessingWindow, t time.Time) bool {
+	if w.StartsAt != nil && w.EndsAt != nil {
+		return !t.Before(*w.StartsAt) && t.Before(*w.EndsAt)
+	}
+	start, err := parseTimeOfDay(w.DailyStart)
+	if err != nil {
+		return false
+	}
+	end, err := parseTimeOfDay(w.DailyEnd)
+	if err != nil {
+		return false
+	}
+	loc, err := time.LoadLocation(w.Timezone)
+	if err != nil {
+		return false
+	}
+	local := t.In(loc)
+	minute := local.Hour()*60 + local.Minute()
+	if start <= end {
+		return minute >= start && minute < end
+	}
+	return minute >= start || minute < end
+}
+
+// activeProcessingWindow returns the window pausing processing right now,
+// or nil. Processing goes on if the windows can't be loaded.
+func (cfg *apiConfig) activeProcessingWindow() *database.ProcessingWindow {
+	windows, err := cfg.processingWindows.get(cfg.db)
+	if err != nil {
+		log.Printf("Couldn't load processing windows: %v", err)
+		return nil
+	}
+	now := time.Now()
+	for _, w := range windows {
+		if processingWindowActive(w, now) {
+			return &w
+		}
+	}
+	return nil
+}
+
+// queueVideoUpload stores the upload in the bucket to be processed once
+// processing resumes. What can be checked without encoding, the requested
+// quality and the duration limit of local processing, is checked now so
+// the client still hears about it.
+func (cfg *apiConfig) queueVideoUpload(ctx context.Context, upload videoUpload) (database.Video, int, *uploadError) {
+	video, userID := upload.video, upload.userID
+
+	if cfg.transcodesInCloud(userID) {
+		if upload.quality != "" {
+			if _, err := transcoder.ParsePreset(upload.quality); err != nil {
+				return video, 0, &uploadError{status: http.StatusUnprocessableEntity, fields: validate.Errors{"quality": "must be sd, hd or fhd"}}
+			}
+		}
+	} else {
+		duration, err := upload.file.duration()
+		if err != nil {
+			return video, 0, &uploadError{status: http.StatusInternalServerError, format: "Couldn't read video duration", err: err}
+		}
+		if duration > upload.limits.MaxDuration {
+			return video, 0, &uploadError{status: http.StatusForbidden, format: "Videos on your plan can be at most %s long", args: []any{upload.limits.MaxDuration}}
+		}
+	}
+
+	key := queuedUploadsPrefix + userID.String() + "/" + video.ID.String() + "/" + generateRandomNameWithExtensionType(upload.mediaType)
+	_, err := cfg.putFile(ctx, key, upload.mediaType, nil, upload.file.File)
+	if err != nil {
+		return video, 0, &uploadError{status: http.StatusInternalServerError, format: "Couldn't queue video for processing", err: err}
+	}
+
+	replaced, err := cfg.db.QueueUpload(database.QueuedUpload{
+		VideoID:   video.ID,
+		UserID:    userID,
+		S3Key:     key,
+		MediaType: upload.mediaType,
+		SizeBytes: upload.size,
+		Quality:   upload.quality,
+	})
+	if err != nil {
+		if err := cfg.deleteObjects(context.Background(), []string{key}); err != nil {
+			log.Printf("Couldn't delete queued upload %s: %v", key, err)
+		}
+		return video, 0, &uploadError{status: http.StatusInternalServerError, format: "Couldn't queue video for processing", err: err}
+	}
+	if replaced != "" {
+		if err := cfg.deleteObjects(ctx, []string{replaced}); err != nil {
+			log.Printf("Couldn't delete replaced queued upload %s: %v", replaced, err)
+		}
+	}
+	return video, http.StatusAccepted, nil
+}
+
+// runProcessingQueue is the scheduled job processing queued uploads, oldest
+// first, while no window is active. It stops as soon as a window starts.
+func (cfg *apiConfig) runProcessingQueue(ctx context.Context) error {
+	if err := cfg.db.DeleteEndedProcessingWindows(time.Now()); err != nil {
+		log.Printf("Couldn't delete ended processing windows: %v", err)
+	}
+	if cfg.activeProcessingWindow() != nil {
+		return nil
+	}
+	uploads, err := cfg.db.GetQueuedUploads()
+	if err != nil {
+		return fmt.Errorf("couldn't get queued uploads: %w", err)
+	}
+
+	failed := 0
+	for _, q := range uploads {
+		if cfg.activeProcessingWindow() != nil {
+			break
+		}
+		if err := cfg.processQueuedUpload(ctx, q); err != nil {
+			log.Printf("Couldn't process queued upload of video %s: %v", q.VideoID, err)
+			failed++
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("couldn't process %d of %d queued uploads", failed, len(uploads))
+	}
+	return nil
+}
+
+// processQueuedUpload processes one queued upload like it would have been
+// when it arrived. Server errors are retried on the next run, up to
+// maxQueuedUploadAttempts; other failures drop the upload and are reported
+// like failed processing.
+func (cfg *apiConfig) processQueuedUpload(ctx context.Context, q database.QueuedUpload) error {
+	video, err := cfg.db.GetVideo(q.VideoID)
+	if err != nil {
+		return err
+	}
+	if video.ID == uuid.Nil {
+		cfg.dropQueuedUpload(q)
+		return nil
+	}
+	_, limits, err := cfg.getUserLimits(q.UserID)
+	if err != nil {
+		return err
+	}
+
+	tempVidFile, err := createSourceFile()
+	if err != nil {
+		return err
+	}
+	defer tempVidFile.release()
+	contentHash, err := cfg.downloadObject(ctx, q.S3Key, tempVidFile.File)
+	if err != nil {
+		return fmt.Errorf("couldn't download %s: %w", q.S3Key, err)
+	}
+
+	_, _, uerr := cfg.processVideoNow(ctx, videoUpload{
+		video:       video,
+		userID:      q.UserID,
+		limits:      limits,
+		file:        tempVidFile,
+		mediaType:   q.MediaType,
+		size:        q.SizeBytes,
+		contentHash: contentHash,
+		quality:     q.Quality,
+	})
+	if uerr == nil {
+		cfg.dropQueuedUpload(q)
+		return nil
+	}
+	if uerr.status >= http.StatusInternalServerError && q.Attempts+1 < maxQueuedUploadAttempts {
+		if err := cfg.db.RetryQueuedUpload(q.VideoID); err != nil {
+			log.Printf("Couldn't count attempt at queued upload of video %s: %v", q.VideoID, err)
+		}
+		return uerr
+	}
+	cfg.notify(notify.EventProcessingFailed, "Queued video processing failed",
+		fmt.Sprintf("Couldn't process queued upload of video %s: %v", video.ID, uerr),
+		map[string]any{"video_id": video.ID, "user_id": video.UserID, "error": uerr.Error()})
+	cfg.dropQueuedUpload(q)
+	return uerr
+}
+
+// dropQueuedUpload removes the upload from the queue and its file from the
+// bucket.
+func (cfg *apiConfig) dropQueuedUpload(q database.QueuedUpload) {
+	if err := cfg.db.DeleteQueuedUpload(q.VideoID, q.S3Key); err != nil {
+		log.Printf("Couldn't remove queued upload of video %s: %v", q.VideoID, err)
+	}
+	if err := cfg.deleteObjects(context.Background(), []string{q.S3Key}); err != nil {
+		log.Printf("Couldn't delete queued upload %s: %v", q.S3Key, err)
+	}
+}
+
+func (cfg *apiConfig) handlerAdminProcessingWindowsList(w http.ResponseWriter, r *http.Request) {
+	type response struct {
+		// Active is the window pausing processing right now, if any.
+		Active  *database.ProcessingWindow  `json:"active"`
+		Windows []database.ProcessingWindow `json:"windows"`
+		Queued  []database.QueuedUpload     `json:"queued"`
+	}
+
+	windows, err := cfg.db.GetProcessingWindows()
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get processing windows", err)
+		return
+	}
+	queued, err := cfg.db.GetQueuedUploads()
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get queued uploads", err)
+		return
+	}
+	resp := response{Windows: windows, Queued: queued}
+	now := time.Now()
+	for _, window := range windows {
+		if processingWindowActive(window, now) {
+			resp.Active = &window
+			break
+		}
+	}
+	respondWithJSON(w, http.StatusOK, resp)
+}
+
+func (cfg *apiConfig) handlerAdminProcessingWindowCreate(w http.ResponseWriter, r *http.Request) {
+	type parameters struct {
+		database.CreateProcessingWindowParams
+	}
+
+	token, err := auth.GetBearerToken(r.Header)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Couldn't find JWT", err)
+		return
+	}
+	adminID, err := cfg.validateJWT(token)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Couldn't validate JWT", err)
+		return
+	}
+
+	params := parameters{}
+	if err := json.NewDecoder(r.Body).Decode(&params); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Couldn't decode parameters", err)
+		return
+	}
+
+	errs := validate.Errors{}
+	errs.Check(validate.MaxLength(params.Reason, maxProcessingWindowReasonLength), "reason", "must be at most "+strconv.Itoa(maxProcessingWindowReasonLength)+" characters")
+	daily := params.DailyStart != "" || params.DailyEnd != ""
+	freeze := params.StartsAt != nil || params.EndsAt != nil
+	errs.Check(daily != freeze, "daily_start", "either daily_start and daily_end or starts_at and ends_at are required")
+	if daily {
+		_, err := parseTimeOfDay(params.DailyStart)
+		errs.Check(err == nil, "daily_start", "must be a time of day like 18:00")
+		_, err = parseTimeOfDay(params.DailyEnd)
+		errs.Check(err == nil, "daily_end", "must be a time of day like 23:00")
+		errs.Check(params.DailyStart != params.DailyEnd, "daily_end", "must differ from daily_start")
+		if params.Timezone == "" {
+			params.Timezone = "UTC"
+		}
+		_, err = time.LoadLocation(params.Timezone)
+		errs.Check(err == nil, "timezone", "must be an IANA time zone like Europe/Berlin")
+	}
+	if freeze {
+		errs.Check(params.StartsAt != nil, "starts_at", "is required")
+		errs.Check(params.EndsAt != nil, "ends_at", "is required")
+		if params.StartsAt != nil && params.EndsAt != nil {
+			errs.Check(params.EndsAt.After(*params.StartsAt), "ends_at", "must be after starts_at")
+			errs.Check(params.EndsAt.After(time.Now()), "ends_at", "must be in the future")
+		}
+		errs.Check(params.Timezone == "", "timezone", "only applies to daily windows")
+	}
+	if errs.Err() != nil {
+		respondWithValidationErrors(w, errs)
+		return
+	}
+
+	window, err := cfg.db.CreateProcessingWindow(adminID, params.CreateProcessingWindowParams)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't create processing window", err)
+		return
+	}
+	cfg.processingWindows.invalidate()
+	detail := fmt.Sprintf("window=%s daily=%s-%s timezone=%s", window.ID, window.DailyStart, window.DailyEnd, window.Timezone)
+	if freeze {
+		detail = fmt.Sprintf("window=%s freeze=%s/%s", window.ID, window.StartsAt.Format(time.RFC3339), window.EndsAt.Format(time.RFC3339))
+	}
+	cfg.recordAuditEvent(r, auditEventProcessingWindowCreated, &adminID, "", detail)
+
+	respondWithJSON(w, http.StatusCreated, window)
+}
+
+// handlerAdminProcessingWindowDelete removes a window. Uploads it queued are
+// processed on the next run unless another window is active.
+func (cfg *apiConfig) handlerAdminProcessingWindowDelete(w http.ResponseWriter, r *http.Request) {
+	windowID, err := uuid.Parse(r.PathValue("windowID"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid ID", err)
+		return
+	}
+
+	if err := cfg.db.DeleteProcessingWindow(windowID); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't delete processing window", err)
+		return
+	}
+	cfg.processingWindows.invalidate()
+	cfg.recordAuditEvent(r, auditEventProcessingWindowDeleted, nil, "", "window="+windowID.String())
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// queuedUploadKey returns the key of the video's queued upload, or "" if it
+// has none.
+func (cfg *apiConfig) queuedUploadKey(videoID uuid.UUID) (string, error) {
+	q, err := cfg.db.GetQueuedUpload(videoID)
+	if err != nil || q == nil {
+		return "", err
+	}
+	return q.S3Key, nil
+}
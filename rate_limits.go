@@ -0,0 +1,175 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/abuse"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/auth"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/billing"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/validate"
+	"github.com/google/uuid"
+)
+
+const auditEventRateLimitChanged = "rate_limit_changed"
+
+// planRateLimitCacheTTL bounds how long other instances keep the old limits
+// after an admin changes a plan's.
+const planRateLimitCacheTTL = 30 * time.Second
+
+type planRateLimitCache struct {
+	mu       sync.Mutex
+	limits   map[billing.Plan]database.PlanRateLimit
+	loadedAt time.Time
+}
+
+func (c *planRateLimitCache) get(db database.Client) (map[billing.Plan]database.PlanRateLimit, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.limits != nil && time.Since(c.loadedAt) < planRateLimitCacheTTL {
+		return c.limits, nil
+	}
+	limits, err := db.GetPlanRateLimits()
+	if err != nil {
+		return nil, err
+	}
+	c.limits = make(map[billing.Plan]database.PlanRateLimit, len(limits))
+	for _, l := range limits {
+		c.limits[billing.Plan(l.Plan)] = l
+	}
+	c.loadedAt = time.Now()
+	return c.limits, nil
+}
+
+func (c *planRateLimitCache) invalidate() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.limits = nil
+}
+
+// urlLimitsFor returns the delivery URL limits of the user's plan, or the
+// defaults if their plan has none or it can't be looked up.
+func (cfg *apiConfig) urlLimitsFor(userID uuid.UUID) abuse.Limits {
+	limits := cfg.urlAbuse.Limits()
+	plan, _, err := cfg.getUserLimits(userID)
+	if err != nil {
+		log.Printf("Couldn't get plan of user %s: %v", userID, err)
+		return limits
+	}
+	overrides, err := cfg.planRateLimits.get(cfg.db)
+	if err != nil {
+		log.Printf("Couldn't load plan rate limits: %v", err)
+		return limits
+	}
+	if o, ok := overrides[plan]; ok {
+		limits.MaxRequests = o.MaxRequests
+		limits.MaxDistinct = o.MaxDistinct
+		limits.Burst = o.Burst
+	}
+	return limits
+}
+
+type rateLimitsView struct {
+	MaxRequests int `json:"max_requests"`
+	MaxDistinct int `json:"max_distinct"`
+	Burst       int `json:"burst"`
+}
+
+// handlerAdminRateLimitsList shows the default delivery URL limits and the
+// plans overriding them.
+func (cfg *apiConfig) handlerAdminRateLimitsList(w http.ResponseWriter, r *http.Request) {
+	type response struct {
+		WindowSeconds   float64                  `json:"window_seconds"`
+		BlockForSeconds float64                  `json:"block_for_seconds"`
+		Defaults        rateLimitsView           `json:"defaults"`
+		Plans           []database.PlanRateLimit `json:"plans"`
+	}
+
+	if cfg.urlAbuse == nil {
+		respondWithError(w, http.StatusNotFound, "Abuse detection is not enabled", nil)
+		return
+	}
+	plans, err := cfg.db.GetPlanRateLimits()
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get rate limits", err)
+		return
+	}
+	limits := cfg.urlAbuse.Limits()
+	respondWithJSON(w, http.StatusOK, response{
+		WindowSeconds:   limits.Window.Seconds(),
+		BlockForSeconds: limits.BlockFor.Seconds(),
+		Defaults:        rateLimitsView{MaxRequests: limits.MaxRequests, MaxDistinct: limits.MaxDistinct, Burst: limits.Burst},
+		Plans:           plans,
+	})
+}
+
+func (cfg *apiConfig) handlerAdminRateLimitSet(w http.ResponseWriter, r *http.Request) {
+	type parameters struct {
+		database.SetPlanRateLimitParams
+	}
+
+	plan, err := billing.ParsePlan(r.PathValue("plan"))
+	if err != nil {
+		respondWithError(w, http.StatusNotFound, "Unknown plan", err)
+		return
+	}
+
+	token, err := auth.GetBearerToken(r.Header)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Couldn't find JWT", err)
+		return
+	}
+	adminID, err := cfg.validateJWT(token)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Couldn't validate JWT", err)
+		return
+	}
+
+	params := parameters{}
+	if err := json.NewDecoder(r.Body).Decode(&params); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Couldn't decode parameters", err)
+		return
+	}
+
+	errs := validate.Errors{}
+	errs.Check(params.MaxRequests >= 0, "max_requests", "can't be negative")
+	errs.Check(params.MaxDistinct >= 0, "max_distinct", "can't be negative")
+	errs.Check(params.Burst >= 0, "burst", "can't be negative")
+	if errs.Err() != nil {
+		respondWithValidationErrors(w, errs)
+		return
+	}
+
+	if err := cfg.db.SetPlanRateLimit(string(plan), params.SetPlanRateLimitParams); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't set rate limit", err)
+		return
+	}
+	cfg.planRateLimits.invalidate()
+	cfg.recordAuditEvent(r, auditEventRateLimitChanged, &adminID, "", fmt.Sprintf("plan=%s max_requests=%d max_distinct=%d burst=%d",
+		plan, params.MaxRequests, params.MaxDistinct, params.Burst))
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handlerAdminRateLimitDelete puts the plan back on the default limits.
+func (cfg *apiConfig) handlerAdminRateLimitDelete(w http.ResponseWriter, r *http.Request) {
+	plan, err := billing.ParsePlan(r.PathValue("plan"))
+	if err != nil {
+		respondWithError(w, http.StatusNotFound, "Unknown plan", err)
+		return
+	}
+
+	if err := cfg.db.DeletePlanRateLimit(string(plan)); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't delete rate limit", err)
+		return
+	}
+	cfg.planRateLimits.invalidate()
+	cfg.recordAuditEvent(r, auditEventRateLimitChanged, nil, "", fmt.Sprintf("plan=%s reset to default", plan))
+
+	w.WriteHeader(http.StatusNoContent)
+}
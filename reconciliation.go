@@ -0,0 +1,255 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+)
+
+// reconcileGracePeriod keeps objects written this recently out of the
+// orphaned objects: uploads write their objects before recording them.
+const reconcileGracePeriod = time.Hour
+
+// reconciler compares a bucket with the artifacts table using a full
+// listing, which is paginated so it works for buckets of any size.
+type reconciler struct {
+	db     database.Client
+	client *s3.Client
+	bucket string
+	// ignorePrefixes hold objects the app doesn't track, which are never
+	// orphans.
+	ignorePrefixes []string
+}
+
+// reconcileIgnorePrefixesFromEnv returns trash/, uploads/ and queued/ along with
+// the comma separated RECONCILE_IGNORE_PREFIXES, e.g. for backups kept in
+// the same bucket.
+func reconcileIgnorePrefixesFromEnv() []string {
+	prefixes := []string{trashPrefix, uploadsPrefix, queuedUploadsPrefix}
+	for _, prefix := range strings.Split(os.Getenv("RECONCILE_IGNORE_PREFIXES"), ",") {
+		if prefix = strings.TrimSpace(prefix); prefix != "" {
+			prefixes = append(prefixes, prefix)
+		}
+	}
+	return prefixes
+}
+
+func (rc reconciler) ignored(key string) bool {
+	for _, prefix := range rc.ignorePrefixes {
+		if strings.HasPrefix(key, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// scan reports objects no artifact points at, artifacts whose object is
+// gone and artifacts whose recorded size is wrong. Artifacts are loaded
+// before the bucket is listed, so an upload finishing mid-scan can only
+// look like an orphan, which the grace period hides.
+func (rc reconciler) scan(ctx context.Context) (database.ReconciliationReport, error) {
+	artifacts, err := rc.db.ListArtifactObjects()
+	if err != nil {
+		return database.ReconciliationReport{}, fmt.Errorf("couldn't load artifacts: %w", err)
+	}
+	objects, err := listBucket(ctx, rc.client, rc.bucket, "")
+	if err != nil {
+		return database.ReconciliationReport{}, fmt.Errorf("couldn't list s3://%s: %w", rc.bucket, err)
+	}
+
+	report := database.ReconciliationReport{
+		Bucket:           rc.bucket,
+		ObjectsScanned:   int64(len(objects)),
+		ArtifactsChecked: int64(len(artifacts)),
+		Findings:         []database.ReconciliationFinding{},
+	}
+	inBucket := make(map[string]bucketObject, len(objects))
+	for _, obj := range objects {
+		inBucket[obj.key] = obj
+	}
+	recorded := make(map[string]bool, len(artifacts))
+	for _, a := range artifacts {
+		recorded[a.Key] = true
+		finding := database.ReconciliationFinding{
+			Key:          a.Key,
+			ArtifactID:   &a.ID,
+			VideoID:      &a.VideoID,
+			RecordedSize: &a.SizeBytes,
+		}
+		obj, ok := inBucket[a.Key]
+		switch {
+		case !ok:
+			finding.Kind = database.FindingMissingObject
+			report.MissingObjects++
+		case obj.size != a.SizeBytes:
+			finding.Kind = database.FindingSizeMismatch
+			finding.ObjectSize = &obj.size
+			report.SizeMismatches++
+		default:
+			continue
+		}
+		report.Findings = append(report.Findings, finding)
+	}
+
+	cutoff := time.Now().Add(-reconcileGracePeriod)
+	for _, obj := range objects {
+		if recorded[obj.key] || rc.ignored(obj.key) || obj.lastModified.After(cutoff) {
+			continue
+		}
+		report.Findings = append(report.Findings, database.ReconciliationFinding{
+			Kind:       database.FindingOrphanedObject,
+			Key:        obj.key,
+			ObjectSize: &obj.size,
+		})
+		report.OrphanedObjects++
+	}
+	return report, nil
+}
+
+// reconcileFixes picks which kinds of findings fix acts on.
+type reconcileFixes struct {
+	orphans, missing, sizes bool
+}
+
+// fix acts on the report's findings and returns how many it fixed. Each is
+// checked again first, since the scan may be out of date. Orphaned objects
+// are moved under trash/ rather than deleted, so the expire-trash lifecycle
+// rule removes them once nobody missed them. Artifacts whose object is gone
+// are removed, and wrong sizes are corrected.
+func (rc reconciler) fix(ctx context.Context, report database.ReconciliationReport, fixes reconcileFixes) (int, error) {
+	orphans := []database.ReconciliationFinding{}
+	fixed := 0
+	missing := []int64{}
+	for _, f := range report.Findings {
+		switch {
+		case f.Kind == database.FindingOrphanedObject && fixes.orphans:
+			orphans = append(orphans, f)
+		case f.Kind == database.FindingMissingObject && fixes.missing:
+			_, err := rc.head(ctx, f.Key)
+			var notFound *types.NotFound
+			if !errors.As(err, &notFound) {
+				log.Printf("Skipping %s, it's no longer missing: %v", f.Key, err)
+				continue
+			}
+			missing = append(missing, *f.ArtifactID)
+		case f.Kind == database.FindingSizeMismatch && fixes.sizes:
+			size, err := rc.head(ctx, f.Key)
+			if err != nil {
+				return fixed, fmt.Errorf("couldn't get size of %s: %w", f.Key, err)
+			}
+			if err := rc.db.UpdateArtifactSize(*f.ArtifactID, size); err != nil {
+				return fixed, err
+			}
+			fixed++
+		}
+	}
+
+	if err := rc.db.DeleteArtifactsByID(missing); err != nil {
+		return fixed, err
+	}
+	fixed += len(missing)
+
+	keys := make([]string, 0, len(orphans))
+	for _, f := range orphans {
+		keys = append(keys, f.Key)
+	}
+	owners, err := rc.db.FindVideosByKeys(keys)
+	if err != nil {
+		return fixed, err
+	}
+	for _, f := range orphans {
+		if _, ok := owners[f.Key]; ok {
+			log.Printf("Skipping %s, it's an artifact again", f.Key)
+			continue
+		}
+		if *f.ObjectSize > maxCopyObjectSize {
+			log.Printf("Skipping %s, at %d bytes it's too large to move to %s", f.Key, *f.ObjectSize, trashPrefix)
+			continue
+		}
+		if err := rc.trash(ctx, f.Key); err != nil {
+			return fixed, fmt.Errorf("couldn't move %s to %s: %w", f.Key, trashPrefix, err)
+		}
+		fixed++
+	}
+	return fixed, nil
+}
+
+func (rc reconciler) head(ctx context.Context, key string) (int64, error) {
+	out, err := rc.client.HeadObject(ctx, &s3.HeadObjectInput{
+		Bucket: aws.String(rc.bucket),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		return 0, err
+	}
+	return aws.ToInt64(out.ContentLength), nil
+}
+
+// trash moves key under trashPrefix, keeping the rest of its key.
+func (rc reconciler) trash(ctx context.Context, key string) error {
+	_, err := rc.client.CopyObject(ctx, &s3.CopyObjectInput{
+		Bucket:     aws.String(rc.bucket),
+		Key:        aws.String(trashPrefix + key),
+		CopySource: aws.String(url.PathEscape(rc.bucket + "/" + key)),
+	})
+	if err != nil {
+		return err
+	}
+	_, err = rc.client.DeleteObject(ctx, &s3.DeleteObjectInput{
+		Bucket: aws.String(rc.bucket),
+		Key:    aws.String(key),
+	})
+	return err
+}
+
+// scanAndSave runs a scan and saves its report.
+func (rc reconciler) scanAndSave(ctx context.Context) (database.ReconciliationReport, error) {
+	report, err := rc.scan(ctx)
+	if err != nil {
+		return database.ReconciliationReport{}, err
+	}
+	if err := rc.db.CreateReconciliationReport(&report); err != nil {
+		return database.ReconciliationReport{}, fmt.Errorf("couldn't save reconciliation report: %w", err)
+	}
+	return report, nil
+}
+
+// runReconciliation is the scheduled scan. It only reports; fixing is left
+// to the reconcile command so someone looks at the findings first.
+func (cfg *apiConfig) runReconciliation(ctx context.Context) error {
+	rc := reconciler{db: cfg.db, client: cfg.s3Client, bucket: cfg.s3Bucket, ignorePrefixes: cfg.reconcileIgnore}
+	report, err := rc.scanAndSave(ctx)
+	if err != nil {
+		return err
+	}
+	if len(report.Findings) > 0 {
+		log.Printf("Bucket reconciliation found %d orphaned objects, %d missing objects and %d size mismatches, see GET /api/admin/reconciliation",
+			report.OrphanedObjects, report.MissingObjects, report.SizeMismatches)
+	}
+	return nil
+}
+
+func (cfg *apiConfig) handlerAdminReconciliationGet(w http.ResponseWriter, r *http.Request) {
+	report, err := cfg.db.GetLatestReconciliationReport()
+	if errors.Is(err, sql.ErrNoRows) {
+		respondWithError(w, http.StatusNotFound, "Couldn't find a reconciliation report, none was made yet", err)
+		return
+	}
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get reconciliation report", err)
+		return
+	}
+	respondWithJSON(w, http.StatusOK, report)
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"runtime/debug"
+	"time"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/errreport"
+)
+
+const errorReportTimeout = 10 * time.Second
+
+// reportError sends event to the error tracker, if one is configured, in the
+// background. Failures are only logged.
+func (cfg *apiConfig) reportError(event errreport.Event) {
+	if cfg.errorReporter == nil {
+		return
+	}
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), errorReportTimeout)
+		defer cancel()
+		if err := cfg.errorReporter.Report(ctx, event); err != nil {
+			log.Printf("Couldn't report error to the error tracker: %v", err)
+		}
+	}()
+}
+
+// recoveryWriter remembers whether the handler started its response, since
+// a panic after that point can't be turned into a 500 anymore. It also
+// carries the request for reportResponseError.
+type recoveryWriter struct {
+	http.ResponseWriter
+	wroteHeader bool
+	cfg         *apiConfig
+	request     *http.Request
+}
+
+func (w *recoveryWriter) WriteHeader(status int) {
+	w.wroteHeader = true
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *recoveryWriter) Write(b []byte) (int, error) {
+	w.wroteHeader = true
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *recoveryWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// middlewareRecover turns a panicking handler into a 500 instead of letting
+// it take the connection down, and logs and reports the stack trace with
+// the request ID.
+func (cfg *apiConfig) middlewareRecover(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rw := &recoveryWriter{ResponseWriter: w, cfg: cfg, request: r}
+		defer func() {
+			p := recover()
+			if p == nil {
+				return
+			}
+			if p == http.ErrAbortHandler {
+				// Used on purpose to abort a response, net/http handles it.
+				panic(p)
+			}
+
+			stack := debug.Stack()
+			id := requestID(r)
+			log.Printf("panic serving %s %s (request %s): %v\n%s", r.Method, r.URL.Path, id, p, stack)
+			cfg.reportError(errreport.Event{
+				Level:     errreport.LevelFatal,
+				Message:   fmt.Sprintf("panic: %v", p),
+				Stack:     stack,
+				RequestID: id,
+				Method:    r.Method,
+				URL:       r.URL.Path,
+			})
+
+			if rw.wroteHeader {
+				return
+			}
+			respondWithErrorf(rw, http.StatusInternalServerError, nil, "Something went wrong on our side, quote request ID %s when reporting this", id)
+		}()
+		next.ServeHTTP(rw, r)
+	})
+}
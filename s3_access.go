@@ -0,0 +1,143 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/credentials/stscreds"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/aws/aws-sdk-go-v2/service/sts"
+	"github.com/aws/smithy-go/middleware"
+)
+
+// bucketAccess is how the app reaches a media bucket that lives in another
+// AWS account, or whose owner bills requests to the requester.
+type bucketAccess struct {
+	bucket        string
+	requesterPays bool
+	// expectedOwner is the account ID S3 checks the bucket belongs to, so a
+	// bucket name that's been taken over can't receive uploads.
+	expectedOwner string
+	roleARN       string
+	externalID    string
+}
+
+// bucketAccessFromEnv reads S3_REQUESTER_PAYS, S3_EXPECTED_BUCKET_OWNER,
+// S3_ROLE_ARN and S3_ROLE_EXTERNAL_ID for bucket.
+func bucketAccessFromEnv(bucket string) (bucketAccess, error) {
+	access := bucketAccess{
+		bucket:        bucket,
+		expectedOwner: os.Getenv("S3_EXPECTED_BUCKET_OWNER"),
+		roleARN:       os.Getenv("S3_ROLE_ARN"),
+		externalID:    os.Getenv("S3_ROLE_EXTERNAL_ID"),
+	}
+	if requesterPays := os.Getenv("S3_REQUESTER_PAYS"); requesterPays != "" {
+		var err error
+		access.requesterPays, err = strconv.ParseBool(requesterPays)
+		if err != nil {
+			return bucketAccess{}, fmt.Errorf("invalid S3_REQUESTER_PAYS: %w", err)
+		}
+	}
+	if access.expectedOwner != "" && !isAWSAccountID(access.expectedOwner) {
+		return bucketAccess{}, fmt.Errorf("invalid S3_EXPECTED_BUCKET_OWNER %q, expected a 12 digit account ID", access.expectedOwner)
+	}
+	if access.externalID != "" && access.roleARN == "" {
+		return bucketAccess{}, fmt.Errorf("S3_ROLE_EXTERNAL_ID is set without S3_ROLE_ARN")
+	}
+	return access, nil
+}
+
+func isAWSAccountID(s string) bool {
+	if len(s) != 12 {
+		return false
+	}
+	for _, r := range s {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// options returns the s3.Options for clients of the bucket. With a role,
+// the client assumes it for every call, while the rest of the app keeps
+// its own credentials.
+func (a bucketAccess) options(awsConfig aws.Config) func(*s3.Options) {
+	return func(o *s3.Options) {
+		if a.roleARN != "" {
+			o.Credentials = aws.NewCredentialsCache(stscreds.NewAssumeRoleProvider(sts.NewFromConfig(awsConfig), a.roleARN,
+				func(p *stscreds.AssumeRoleOptions) {
+					p.RoleSessionName = "tubely"
+					if a.externalID != "" {
+						p.ExternalID = aws.String(a.externalID)
+					}
+				}))
+		}
+		if !a.requesterPays && a.expectedOwner == "" {
+			return
+		}
+		o.APIOptions = append(o.APIOptions, func(stack *middleware.Stack) error {
+			return stack.Initialize.Add(middleware.InitializeMiddlewareFunc("BucketAccess",
+				func(ctx context.Context, in middleware.InitializeInput, next middleware.InitializeHandler) (middleware.InitializeOutput, middleware.Metadata, error) {
+					a.setParams(in.Parameters)
+					return next.HandleInitialize(ctx, in)
+				}), middleware.Before)
+		})
+	}
+}
+
+// setParams sets RequestPayer and ExpectedBucketOwner on calls to the
+// bucket. It goes by field name rather than listing operations, so calls
+// added later can't miss them; presigned URLs carry them as query
+// parameters.
+func (a bucketAccess) setParams(params any) {
+	v := reflect.ValueOf(params)
+	if v.Kind() != reflect.Pointer || v.Elem().Kind() != reflect.Struct {
+		return
+	}
+	v = v.Elem()
+	get := func(name string) string {
+		if f := v.FieldByName(name); f.IsValid() {
+			if s, ok := f.Interface().(*string); ok {
+				return aws.ToString(s)
+			}
+		}
+		return ""
+	}
+	set := func(name string, value reflect.Value) {
+		if f := v.FieldByName(name); f.IsValid() && f.CanSet() && f.Type() == value.Type() && f.IsZero() {
+			f.Set(value)
+		}
+	}
+
+	if get("Bucket") == a.bucket {
+		if a.requesterPays {
+			set("RequestPayer", reflect.ValueOf(types.RequestPayerRequester))
+		}
+		if a.expectedOwner != "" {
+			set("ExpectedBucketOwner", reflect.ValueOf(aws.String(a.expectedOwner)))
+		}
+	}
+	if a.expectedOwner == "" {
+		return
+	}
+	if strings.HasPrefix(get("CopySource"), a.bucket+"/") {
+		set("ExpectedSourceBucketOwner", reflect.ValueOf(aws.String(a.expectedOwner)))
+	}
+}
+
+// mediaBucketClient is a client for the media bucket, for the CLI commands
+// that work on it.
+func mediaBucketClient(awsConfig aws.Config, bucket string) (*s3.Client, error) {
+	access, err := bucketAccessFromEnv(bucket)
+	if err != nil {
+		return nil, err
+	}
+	return s3.NewFromConfig(awsConfig, access.options(awsConfig)), nil
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+
+	awshttp "github.com/aws/aws-sdk-go-v2/aws/transport/http"
+)
+
+// s3HTTPConfig tunes the HTTP client the AWS SDK sends requests with. Every
+// S3 call goes to the same host, so the SDK's default of 10 idle
+// connections per host makes concurrent multipart uploads reconnect for
+// most parts.
+type s3HTTPConfig struct {
+	maxIdleConns        int
+	maxIdleConnsPerHost int
+	// maxConnsPerHost caps connections in any state; 0 is no limit.
+	maxConnsPerHost int
+	idleConnTimeout time.Duration
+	connectTimeout  time.Duration
+	// responseHeaderTimeout bounds the wait for S3 to start answering, not
+	// the whole request, so large transfers aren't cut off; 0 is no limit.
+	responseHeaderTimeout time.Duration
+	http2                 bool
+}
+
+// s3HTTPConfigFromEnv reads S3_HTTP_MAX_IDLE_CONNS (default 100),
+// S3_HTTP_MAX_IDLE_CONNS_PER_HOST (default 100),
+// S3_HTTP_MAX_CONNS_PER_HOST (default no limit), S3_HTTP_IDLE_CONN_TIMEOUT
+// (default 90s), S3_HTTP_CONNECT_TIMEOUT (default 10s),
+// S3_HTTP_RESPONSE_HEADER_TIMEOUT (default no limit) and S3_HTTP2 (default
+// true).
+func s3HTTPConfigFromEnv() (s3HTTPConfig, error) {
+	c := s3HTTPConfig{
+		maxIdleConns:        100,
+		maxIdleConnsPerHost: 100,
+		idleConnTimeout:     90 * time.Second,
+		connectTimeout:      10 * time.Second,
+		http2:               true,
+	}
+	for name, n := range map[string]*int{
+		"S3_HTTP_MAX_IDLE_CONNS":          &c.maxIdleConns,
+		"S3_HTTP_MAX_IDLE_CONNS_PER_HOST": &c.maxIdleConnsPerHost,
+		"S3_HTTP_MAX_CONNS_PER_HOST":      &c.maxConnsPerHost,
+	} {
+		v := os.Getenv(name)
+		if v == "" {
+			continue
+		}
+		parsed, err := strconv.Atoi(v)
+		if err != nil || parsed < 0 {
+			return s3HTTPConfig{}, fmt.Errorf("%s must be a number of connections", name)
+		}
+		*n = parsed
+	}
+	for name, d := range map[string]*time.Duration{
+		"S3_HTTP_IDLE_CONN_TIMEOUT":       &c.idleConnTimeout,
+		"S3_HTTP_CONNECT_TIMEOUT":         &c.connectTimeout,
+		"S3_HTTP_RESPONSE_HEADER_TIMEOUT": &c.responseHeaderTimeout,
+	} {
+		v := os.Getenv(name)
+		if v == "" {
+			continue
+		}
+		parsed, err := time.ParseDuration(v)
+		if err != nil || parsed < 0 {
+			return s3HTTPConfig{}, fmt.Errorf("%s must be a duration", name)
+		}
+		*d = parsed
+	}
+	if v := os.Getenv("S3_HTTP2"); v != "" {
+		var err error
+		c.http2, err = strconv.ParseBool(v)
+		if err != nil {
+			return s3HTTPConfig{}, fmt.Errorf("invalid S3_HTTP2: %w", err)
+		}
+	}
+	return c, nil
+}
+
+// client builds the HTTP client. It starts from the SDK's own, so settings
+// not covered here keep the SDK's defaults.
+func (c s3HTTPConfig) client() *awshttp.BuildableClient {
+	return awshttp.NewBuildableClient().
+		WithTransportOptions(func(t *http.Transport) {
+			t.MaxIdleConns = c.maxIdleConns
+			t.MaxIdleConnsPerHost = c.maxIdleConnsPerHost
+			t.MaxConnsPerHost = c.maxConnsPerHost
+			t.IdleConnTimeout = c.idleConnTimeout
+			t.ResponseHeaderTimeout = c.responseHeaderTimeout
+			t.ForceAttemptHTTP2 = c.http2
+		}).
+		WithDialerOptions(func(d *net.Dialer) {
+			d.Timeout = c.connectTimeout
+		})
+}
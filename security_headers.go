@@ -0,0 +1,78 @@
+package main
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// securityHeaders are set on every response. The embed player gets its own
+// Content-Security-Policy, since it's meant to be framed by other sites.
+type securityHeaders struct {
+	contentSecurityPolicy string
+	// embedContentSecurityPolicy has no frame-ancestors directive; it's
+	// added per response, see embedFrameAncestors.
+	embedContentSecurityPolicy string
+	referrerPolicy             string
+	// hsts is only set when the app is served over https.
+	hsts bool
+}
+
+// defaultSecurityHeaders allows what the bundled frontend needs: its own
+// scripts, inline style attributes, and media from the asset server and
+// CloudFront.
+func defaultSecurityHeaders(baseURL string, mediaURLs ...string) securityHeaders {
+	media := "'self'"
+	for _, u := range mediaURLs {
+		if origin := urlOrigin(u); origin != "" {
+			media += " " + origin
+		}
+	}
+	return securityHeaders{
+		contentSecurityPolicy: "default-src 'self'; script-src 'self'; style-src 'self' 'unsafe-inline'; " +
+			"img-src " + media + " data: blob:; media-src " + media + " blob:; connect-src 'self'; " +
+			"object-src 'none'; base-uri 'self'; form-action 'self'; frame-ancestors 'none'",
+		embedContentSecurityPolicy: "default-src 'none'; style-src 'unsafe-inline'; " +
+			"img-src " + media + " data:; media-src " + media + "; base-uri 'none'; form-action 'none'",
+		referrerPolicy: "strict-origin-when-cross-origin",
+		hsts:           strings.HasPrefix(baseURL, "https://"),
+	}
+}
+
+func (h securityHeaders) middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		header := w.Header()
+		header.Set("X-Content-Type-Options", "nosniff")
+		header.Set("Referrer-Policy", h.referrerPolicy)
+		if h.hsts {
+			header.Set("Strict-Transport-Security", "max-age=63072000; includeSubDomains")
+		}
+
+		if strings.HasPrefix(r.URL.Path, "/embed/") {
+			header.Set("Content-Security-Policy", h.embedContentSecurityPolicy+"; frame-ancestors *")
+		} else {
+			header.Set("Content-Security-Policy", h.contentSecurityPolicy)
+			header.Set("X-Frame-Options", "DENY")
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// embedFrameAncestors narrows the embed policy to the sites an embed token
+// allows, once the token is known. Policies configured with their own
+// frame-ancestors keep it, as browsers use the first occurrence.
+func (h securityHeaders) embedFrameAncestors(w http.ResponseWriter, domains []string) {
+	sources := make([]string, 0, 2*len(domains))
+	for _, domain := range domains {
+		sources = append(sources, domain, "*."+domain)
+	}
+	w.Header().Set("Content-Security-Policy", h.embedContentSecurityPolicy+"; frame-ancestors "+strings.Join(sources, " "))
+}
+
+func urlOrigin(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil || u.Scheme == "" || u.Host == "" {
+		return ""
+	}
+	return u.Scheme + "://" + u.Host
+}
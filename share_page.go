@@ -0,0 +1,73 @@
+package main
+
+import (
+	"html/template"
+	"log"
+	"net/http"
+)
+
+var sharePageTemplate = template.Must(template.New("share").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<title>{{.Title}}</title>
+<link rel="canonical" href="{{.PageURL}}">
+<meta property="og:site_name" content="Tubely">
+<meta property="og:type" content="video.other">
+<meta property="og:title" content="{{.Title}}">
+{{- if .Description}}
+<meta property="og:description" content="{{.Description}}">
+<meta name="description" content="{{.Description}}">
+{{- end}}
+<meta property="og:url" content="{{.PageURL}}">
+{{- if .ImageURL}}
+<meta property="og:image" content="{{.ImageURL}}">
+{{- end}}
+<meta property="og:video" content="{{.URL}}">
+<meta property="og:video:secure_url" content="{{.URL}}">
+<meta property="og:video:type" content="video/mp4">
+<meta name="twitter:card" content="{{if .ImageURL}}summary_large_image{{else}}summary{{end}}">
+<meta name="twitter:title" content="{{.Title}}">
+{{- if .Description}}
+<meta name="twitter:description" content="{{.Description}}">
+{{- end}}
+{{- if .ImageURL}}
+<meta name="twitter:image" content="{{.ImageURL}}">
+{{- end}}
+<style>body{margin:0 auto;max-width:960px;padding:1rem;font-family:sans-serif}video{display:block;width:100%;background:#000}</style>
+</head>
+<body>
+<video controls playsinline preload="metadata" src="{{.URL}}"{{if .ImageURL}} poster="{{.ImageURL}}"{{end}}></video>
+<h1>{{.Title}}</h1>
+{{- if .Description}}
+<p>{{.Description}}</p>
+{{- end}}
+</body>
+</html>
+`))
+
+// handlerSharePage is where short links land: a page playing the video,
+// with the Open Graph and Twitter Card tags social platforms and chat apps
+// read to preview the link. The URLs in it are signed when the bucket is,
+// so it isn't cached.
+func (cfg *apiConfig) handlerSharePage(w http.ResponseWriter, r *http.Request) {
+	slug, target, ok := cfg.followSlug(w, r)
+	if !ok {
+		return
+	}
+
+	data := struct {
+		shareTarget
+		PageURL string
+	}{
+		shareTarget: target,
+		PageURL:     cfg.shortURL(slug.Slug),
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "private, no-store")
+	err := sharePageTemplate.Execute(w, data)
+	if err != nil {
+		log.Printf("Couldn't render share page for %s: %v", slug.Slug, err)
+	}
+}
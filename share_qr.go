@@ -0,0 +1,98 @@
+package main
+
+import (
+	"bytes"
+	"image/png"
+	"net/http"
+	"strconv"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/qrcode"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/validate"
+)
+
+const (
+	defaultQRSize = 512
+	minQRSize     = 64
+	maxQRSize     = 2048
+)
+
+// handlerShareQR renders a QR code of one of the video's short links, for
+// slides and printouts. ?slug= picks the link; otherwise it's the oldest
+// one, and a video without any gets one. ?size= is the image's width in
+// pixels and ?ec= the error correction level, L, M (the default), Q or H;
+// higher levels survive a logo printed over the code at the cost of denser
+// codes.
+func (cfg *apiConfig) handlerShareQR(w http.ResponseWriter, r *http.Request) {
+	video, ok := cfg.ownedVideo(w, r)
+	if !ok {
+		return
+	}
+
+	query := r.URL.Query()
+	size := defaultQRSize
+	level := qrcode.Medium
+	errs := validate.Errors{}
+	if s := query.Get("size"); s != "" {
+		var err error
+		size, err = strconv.Atoi(s)
+		errs.Check(err == nil && size >= minQRSize && size <= maxQRSize, "size",
+			"must be between "+strconv.Itoa(minQRSize)+" and "+strconv.Itoa(maxQRSize))
+	}
+	if ec := query.Get("ec"); ec != "" {
+		var ok bool
+		level, ok = qrcode.ParseLevel(ec)
+		errs.Check(ok, "ec", "must be L, M, Q or H")
+	}
+	if errs.Err() != nil {
+		respondWithValidationErrors(w, errs)
+		return
+	}
+
+	slugs, err := cfg.db.GetSlugsForTarget(database.SlugTargetVideo, video.ID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't retrieve short links", err)
+		return
+	}
+	var slug *database.Slug
+	for i := range slugs {
+		if query.Get("slug") == "" || slugs[i].Slug == query.Get("slug") {
+			slug = &slugs[i]
+			break
+		}
+	}
+	if slug == nil && query.Get("slug") != "" {
+		respondWithError(w, http.StatusNotFound, "Couldn't find short link", nil)
+		return
+	}
+	if slug == nil {
+		created, err := cfg.createRandomSlug(database.CreateSlugParams{
+			UserID:     video.UserID,
+			TargetType: database.SlugTargetVideo,
+			TargetID:   video.ID,
+		})
+		if err != nil {
+			respondWithError(w, http.StatusInternalServerError, "Couldn't create short link", err)
+			return
+		}
+		slug = &created
+	}
+
+	code, err := qrcode.Encode([]byte(cfg.shortURL(slug.Slug)), level)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't create QR code", err)
+		return
+	}
+	var buf bytes.Buffer
+	err = png.Encode(&buf, code.Image(size))
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't create QR code", err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "image/png")
+	w.Header().Set("Content-Length", strconv.Itoa(buf.Len()))
+	w.Header().Set("Cache-Control", "private, no-cache")
+	w.WriteHeader(http.StatusOK)
+	w.Write(buf.Bytes())
+}
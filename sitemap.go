@@ -0,0 +1,153 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/xml"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/google/uuid"
+)
+
+// maxSitemapURLs is the most a sitemap file may list.
+const maxSitemapURLs = 50000
+
+// sitemapCache holds the last generated sitemap, so crawlers fetching it
+// don't each query every video.
+type sitemapCache struct {
+	mu   sync.RWMutex
+	body []byte
+}
+
+func (c *sitemapCache) get() []byte {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.body
+}
+
+func (c *sitemapCache) set(body []byte) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.body = body
+}
+
+type sitemapURLSet struct {
+	XMLName    xml.Name     `xml:"urlset"`
+	Namespace  string       `xml:"xmlns,attr"`
+	VideoSpace string       `xml:"xmlns:video,attr"`
+	URLs       []sitemapURL `xml:"url"`
+}
+
+type sitemapURL struct {
+	Loc     string        `xml:"loc"`
+	LastMod string        `xml:"lastmod"`
+	Video   *sitemapVideo `xml:"video:video"`
+}
+
+// sitemapVideo is Google's video sitemap extension. The content location
+// is the short link's redirect rather than the file, whose URL can be
+// signed and expire before crawlers get to it.
+type sitemapVideo struct {
+	ThumbnailLoc    string   `xml:"video:thumbnail_loc"`
+	Title           string   `xml:"video:title"`
+	Description     string   `xml:"video:description"`
+	ContentLoc      string   `xml:"video:content_loc"`
+	Duration        int64    `xml:"video:duration,omitempty"`
+	PublicationDate string   `xml:"video:publication_date,omitempty"`
+	Tags            []string `xml:"video:tag"`
+}
+
+// runSitemap regenerates the sitemap. It lists the share pages of videos
+// anyone can watch, and only those with a short link: a video's ID alone
+// doesn't make it public, since owners share unlisted videos by ID.
+func (cfg *apiConfig) runSitemap(ctx context.Context) error {
+	videos, err := cfg.db.GetSitemapVideos(maxSitemapURLs)
+	if err != nil {
+		return fmt.Errorf("couldn't get videos: %w", err)
+	}
+
+	ids := make([]uuid.UUID, 0, len(videos))
+	plain := make([]database.Video, 0, len(videos))
+	for _, video := range videos {
+		ids = append(ids, video.ID)
+		plain = append(plain, video.Video)
+	}
+	unavailable, err := cfg.unavailableVideos(ids)
+	if err != nil {
+		return fmt.Errorf("couldn't check availability: %w", err)
+	}
+	urls, err := cfg.resolveVideoURLs(plain)
+	if err != nil {
+		return fmt.Errorf("couldn't resolve video URLs: %w", err)
+	}
+
+	set := sitemapURLSet{
+		Namespace:  "http://www.sitemaps.org/schemas/sitemap/0.9",
+		VideoSpace: "http://www.google.com/schemas/sitemap-video/1.1",
+		URLs:       []sitemapURL{},
+	}
+	for _, video := range videos {
+		if unavailable[video.ID] || unpublishedMessage(video.Video) != "" {
+			continue
+		}
+		entry := sitemapURL{
+			Loc:     cfg.shortURL(video.Slug),
+			LastMod: video.UpdatedAt.UTC().Format(time.RFC3339),
+		}
+		// Search engines skip video entries without a thumbnail.
+		if thumbnail := urls[video.ID].Thumbnail; thumbnail != nil {
+			entry.Video = &sitemapVideo{
+				ThumbnailLoc: *thumbnail,
+				Title:        video.Title,
+				Description:  video.Description,
+				ContentLoc:   cfg.shortURL(video.Slug) + "/video",
+				Duration:     video.DurationMS / 1000,
+				Tags:         video.Tags,
+			}
+			if video.PublishedAt != nil {
+				entry.Video.PublicationDate = video.PublishedAt.UTC().Format(time.RFC3339)
+			}
+		}
+		set.URLs = append(set.URLs, entry)
+	}
+
+	var buf bytes.Buffer
+	buf.WriteString(xml.Header)
+	if err := xml.NewEncoder(&buf).Encode(set); err != nil {
+		return fmt.Errorf("couldn't encode sitemap: %w", err)
+	}
+	cfg.sitemap.set(buf.Bytes())
+	return nil
+}
+
+func (cfg *apiConfig) handlerSitemap(w http.ResponseWriter, r *http.Request) {
+	if cfg.sitemap == nil {
+		respondWithError(w, http.StatusNotFound, "The sitemap isn't enabled", nil)
+		return
+	}
+	body := cfg.sitemap.get()
+	if body == nil {
+		if err := cfg.runSitemap(r.Context()); err != nil {
+			respondWithError(w, http.StatusInternalServerError, "Couldn't generate sitemap", err)
+			return
+		}
+		body = cfg.sitemap.get()
+	}
+	w.Header().Set("Content-Type", "application/xml; charset=utf-8")
+	w.Header().Set("Cache-Control", "public, max-age=3600")
+	w.Write(body)
+}
+
+// handlerRobots points crawlers at the sitemap.
+func (cfg *apiConfig) handlerRobots(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	fmt.Fprintln(w, "User-agent: *")
+	fmt.Fprintln(w, "Disallow: /api/")
+	if cfg.sitemap != nil {
+		fmt.Fprintf(w, "Sitemap: %s/sitemap.xml\n", cfg.baseURL)
+	}
+}
@@ -0,0 +1,262 @@
+package main
+
+import (
+	"crypto/rand"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"regexp"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/validate"
+)
+
+const (
+	// slugAlphabet leaves out characters that are easy to misread, like 0
+	// and o or 1 and l.
+	slugAlphabet = "23456789abcdefghijkmnpqrstuvwxyz"
+	slugLength   = 7
+	// slugAttempts is how many random slugs are tried at each length before
+	// trying a longer one.
+	slugAttempts = 3
+	maxSlugs     = 20
+)
+
+var customSlugPattern = regexp.MustCompile(`^[a-z0-9][a-z0-9-]{1,38}[a-z0-9]$`)
+
+type slugResponse struct {
+	database.Slug
+	ShortURL string `json:"short_url"`
+}
+
+func (cfg *apiConfig) shortURL(slug string) string {
+	return cfg.baseURL + "/v/" + slug
+}
+
+func randomSlug(length int) string {
+	b := make([]byte, length)
+	rand.Read(b)
+	for i := range b {
+		b[i] = slugAlphabet[int(b[i])%len(slugAlphabet)]
+	}
+	return string(b)
+}
+
+// createRandomSlug picks random slugs until one is free. Collisions get
+// likelier as slugs are used up, so after a few it moves to longer ones.
+func (cfg *apiConfig) createRandomSlug(params database.CreateSlugParams) (database.Slug, error) {
+	for length := slugLength; ; length++ {
+		for range slugAttempts {
+			slug, err := cfg.db.CreateSlug(randomSlug(length), params)
+			if errors.Is(err, database.ErrSlugTaken) {
+				continue
+			}
+			return slug, err
+		}
+	}
+}
+
+// handlerSlugCreate gives the video a short link. Without a slug in the
+// body, a random one is picked.
+func (cfg *apiConfig) handlerSlugCreate(w http.ResponseWriter, r *http.Request) {
+	type parameters struct {
+		Slug string `json:"slug"`
+	}
+
+	video, ok := cfg.ownedVideo(w, r)
+	if !ok {
+		return
+	}
+
+	params := parameters{}
+	if r.ContentLength != 0 {
+		err := json.NewDecoder(r.Body).Decode(&params)
+		if err != nil {
+			respondWithError(w, http.StatusBadRequest, "Couldn't decode parameters", err)
+			return
+		}
+	}
+	errs := validate.Errors{}
+	errs.Check(params.Slug == "" || customSlugPattern.MatchString(params.Slug), "slug",
+		"must be 3 to 40 lowercase letters, digits or dashes")
+	if errs.Err() != nil {
+		respondWithValidationErrors(w, errs)
+		return
+	}
+
+	existing, err := cfg.db.GetSlugsForTarget(database.SlugTargetVideo, video.ID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't retrieve short links", err)
+		return
+	}
+	if len(existing) >= maxSlugs {
+		respondWithErrorf(w, http.StatusConflict, nil, "A video can't have more than %d short links", maxSlugs)
+		return
+	}
+
+	createParams := database.CreateSlugParams{
+		UserID:     video.UserID,
+		TargetType: database.SlugTargetVideo,
+		TargetID:   video.ID,
+	}
+	var slug database.Slug
+	if params.Slug != "" {
+		slug, err = cfg.db.CreateSlug(params.Slug, createParams)
+	} else {
+		slug, err = cfg.createRandomSlug(createParams)
+	}
+	if errors.Is(err, database.ErrSlugTaken) {
+		respondWithError(w, http.StatusConflict, "That short link is taken", err)
+		return
+	}
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't create short link", err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusCreated, slugResponse{Slug: slug, ShortURL: cfg.shortURL(slug.Slug)})
+}
+
+func (cfg *apiConfig) handlerSlugsList(w http.ResponseWriter, r *http.Request) {
+	video, ok := cfg.ownedVideo(w, r)
+	if !ok {
+		return
+	}
+
+	slugs, err := cfg.db.GetSlugsForTarget(database.SlugTargetVideo, video.ID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't retrieve short links", err)
+		return
+	}
+
+	response := make([]slugResponse, 0, len(slugs))
+	for _, slug := range slugs {
+		response = append(response, slugResponse{Slug: slug, ShortURL: cfg.shortURL(slug.Slug)})
+	}
+	respondWithJSON(w, http.StatusOK, response)
+}
+
+func (cfg *apiConfig) handlerSlugDelete(w http.ResponseWriter, r *http.Request) {
+	video, ok := cfg.ownedVideo(w, r)
+	if !ok {
+		return
+	}
+
+	err := cfg.db.DeleteSlug(database.SlugTargetVideo, video.ID, r.PathValue("slug"))
+	if errors.Is(err, sql.ErrNoRows) {
+		respondWithError(w, http.StatusNotFound, "Couldn't find short link", err)
+		return
+	}
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't delete short link", err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// shareTarget is what a short link leads to.
+type shareTarget struct {
+	Title       string
+	Description string
+	// URL is where the link redirects to.
+	URL      string
+	ImageURL string
+}
+
+// slugTargets resolves a slug's target, by target type, responding and
+// returning false if the link can't be followed.
+var slugTargets = map[database.SlugTargetType]func(cfg *apiConfig, w http.ResponseWriter, r *http.Request, slug database.Slug) (shareTarget, bool){
+	database.SlugTargetVideo: (*apiConfig).videoShareTarget,
+}
+
+// videoShareTarget leads short links to the video's own URL, with the same
+// checks as handlerVideoGet.
+func (cfg *apiConfig) videoShareTarget(w http.ResponseWriter, r *http.Request, slug database.Slug) (shareTarget, bool) {
+	video, err := cfg.db.GetVideo(slug.TargetID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get video", err)
+		return shareTarget{}, false
+	}
+	if video.ID != slug.TargetID || video.VideoURL == nil {
+		respondWithError(w, http.StatusNotFound, "Couldn't get video", nil)
+		return shareTarget{}, false
+	}
+	if !cfg.checkVideoAvailable(w, video.ID) {
+		return shareTarget{}, false
+	}
+	if !cfg.checkVideoPublished(w, r, video) {
+		return shareTarget{}, false
+	}
+	if !cfg.checkVideoPassword(w, r, video) {
+		return shareTarget{}, false
+	}
+	if !cfg.checkURLIssuance(w, r, video.ID.String()) {
+		return shareTarget{}, false
+	}
+	err = cfg.db.RecordURLIssuance(video.UserID, video.SizeBytes)
+	if err != nil {
+		log.Printf("Couldn't record URL issuance for video %s: %v", video.ID, err)
+	}
+
+	urls, err := cfg.resolveVideoURLs([]database.Video{video})
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't resolve video URLs", err)
+		return shareTarget{}, false
+	}
+	videoURLs := urls[video.ID]
+	if videoURLs.Video == nil {
+		respondWithError(w, http.StatusNotFound, "Couldn't get video", nil)
+		return shareTarget{}, false
+	}
+	target := shareTarget{
+		Title:       video.Title,
+		Description: video.Description,
+		URL:         *videoURLs.Video,
+	}
+	if videoURLs.Thumbnail != nil {
+		target.ImageURL = *videoURLs.Thumbnail
+	}
+	return target, true
+}
+
+// followSlug resolves the short link in the path and counts the hit.
+func (cfg *apiConfig) followSlug(w http.ResponseWriter, r *http.Request) (database.Slug, shareTarget, bool) {
+	slug, err := cfg.db.GetSlug(r.PathValue("slug"))
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get short link", err)
+		return database.Slug{}, shareTarget{}, false
+	}
+	if slug == nil {
+		respondWithError(w, http.StatusNotFound, "Couldn't find short link", nil)
+		return database.Slug{}, shareTarget{}, false
+	}
+	resolve, ok := slugTargets[slug.TargetType]
+	if !ok {
+		respondWithError(w, http.StatusNotFound, "Couldn't find short link", nil)
+		return database.Slug{}, shareTarget{}, false
+	}
+	target, ok := resolve(cfg, w, r, *slug)
+	if !ok {
+		return database.Slug{}, shareTarget{}, false
+	}
+
+	err = cfg.db.RecordSlugHit(slug.Slug)
+	if err != nil {
+		log.Printf("Couldn't record hit on short link %s: %v", slug.Slug, err)
+	}
+	return *slug, target, true
+}
+
+// handlerSlugRedirect sends a short link straight to the file. The redirect
+// isn't cached, since where it goes can expire or stop being allowed.
+func (cfg *apiConfig) handlerSlugRedirect(w http.ResponseWriter, r *http.Request) {
+	_, target, ok := cfg.followSlug(w, r)
+	if !ok {
+		return
+	}
+	w.Header().Set("Cache-Control", "private, no-store")
+	http.Redirect(w, r, target.URL, http.StatusFound)
+}
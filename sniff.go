@@ -0,0 +1,131 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"image"
+	_ "image/jpeg"
+	_ "image/png"
+	"io"
+	"net/http"
+	"os/exec"
+)
+
+const (
+	// sniffLen is how much of a file sniffMediaType looks at. Matroska's
+	// DocType comes after a variable-length header, so it's more than the
+	// few bytes the other signatures need.
+	sniffLen = 64
+	// maxThumbnailPixels bounds the images decoded as thumbnails, since a
+	// small PNG can claim dimensions that take gigabytes to decode.
+	maxThumbnailPixels = 8192 * 8192
+)
+
+// errNoVideoStream is returned by probeVideo for files without video.
+var errNoVideoStream = errors.New("no video streams found")
+
+// sniffMediaType returns the media type of the file that starts with head,
+// going by its magic bytes, or "" if it isn't one the app takes. Unlike the
+// Content-Type a client sends, it can't be made to call a renamed
+// executable a video.
+func sniffMediaType(head []byte) string {
+	switch {
+	case len(head) >= 12 && string(head[4:8]) == "ftyp":
+		// MP4 and QuickTime are the same box format, told apart by the
+		// major brand.
+		if string(head[8:12]) == "qt  " {
+			return "video/quicktime"
+		}
+		return "video/mp4"
+	case len(head) >= 8 && (string(head[4:8]) == "moov" || string(head[4:8]) == "mdat" ||
+		string(head[4:8]) == "wide" || string(head[4:8]) == "free"):
+		// QuickTime files from before ftyp start with any top-level box.
+		return "video/quicktime"
+	case bytes.HasPrefix(head, []byte{0x1a, 0x45, 0xdf, 0xa3}):
+		if bytes.Contains(head, []byte("webm")) {
+			return "video/webm"
+		}
+		return "video/x-matroska"
+	case bytes.HasPrefix(head, []byte{0xff, 0xd8, 0xff}):
+		return "image/jpeg"
+	case bytes.HasPrefix(head, []byte("\x89PNG\r\n\x1a\n")):
+		return "image/png"
+	}
+	return ""
+}
+
+// sniffVideo sniffs the video r starts with, returning a reader of all of
+// r, the sniffed bytes included. The sniffed type replaces the one the
+// client claimed, which may be off for formats that share a container,
+// like a .mov sent as video/mp4.
+func (cfg *apiConfig) sniffVideo(r io.Reader) (io.Reader, string, *uploadError) {
+	br := bufio.NewReader(r)
+	head, err := br.Peek(sniffLen)
+	if err != nil && !errors.Is(err, io.EOF) {
+		return nil, "", formError(err)
+	}
+	mediaType, uerr := cfg.checkSniffedVideo(head)
+	if uerr != nil {
+		return nil, "", uerr
+	}
+	return br, mediaType, nil
+}
+
+// checkVideoContent sniffs an upload saved to a file, setting its media
+// type to the sniffed one, and checks that ffprobe finds a video in it.
+// The probe is the one processing runs anyway, so it's only extra work for
+// uploads sent to the transcoder.
+func (cfg *apiConfig) checkVideoContent(upload *videoUpload) *uploadError {
+	head := make([]byte, sniffLen)
+	n, err := upload.file.ReadAt(head, 0)
+	if err != nil && !errors.Is(err, io.EOF) {
+		return &uploadError{status: http.StatusInternalServerError, format: "Couldn't read video file", err: err}
+	}
+	mediaType, uerr := cfg.checkSniffedVideo(head[:n])
+	if uerr != nil {
+		return uerr
+	}
+	upload.mediaType = mediaType
+
+	_, err = upload.file.probe()
+	var exitErr *exec.ExitError
+	if errors.Is(err, errNoVideoStream) || errors.As(err, &exitErr) {
+		return &uploadError{status: http.StatusUnprocessableEntity, format: "The file isn't a playable video", err: err}
+	}
+	if err != nil {
+		return &uploadError{status: http.StatusInternalServerError, format: "Couldn't probe video", err: err}
+	}
+	return nil
+}
+
+func (cfg *apiConfig) checkSniffedVideo(head []byte) (string, *uploadError) {
+	mediaType := sniffMediaType(head)
+	if mediaType == "" {
+		return "", &uploadError{status: http.StatusBadRequest, format: "The file's contents aren't a supported video"}
+	}
+	return mediaType, cfg.checkVideoType(mediaType)
+}
+
+// checkImageContent decodes an uploaded image, returning an error if it
+// isn't an image of mediaType. r is read to the end.
+func checkImageContent(r io.Reader, mediaType string) error {
+	br := bufio.NewReader(r)
+	head, err := br.Peek(sniffLen)
+	if err != nil && !errors.Is(err, io.EOF) {
+		return err
+	}
+	if sniffed := sniffMediaType(head); sniffed != mediaType {
+		return errors.New("contents don't match the media type")
+	}
+	var buf bytes.Buffer
+	config, _, err := image.DecodeConfig(io.TeeReader(br, &buf))
+	if err != nil {
+		return err
+	}
+	if config.Width*config.Height > maxThumbnailPixels {
+		return errors.New("image is too large")
+	}
+	_, _, err = image.Decode(io.MultiReader(&buf, br))
+	return err
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"errors"
+	"log"
+	"os"
+	"sync"
+	"time"
+)
+
+// sourceFile is the local copy of an upload that every processing step
+// reads: ffprobe, the fast start remux, and thumbnail and preview
+// generation. It's written once and shared rather than copied per step.
+// Each user of the file holds a reference, and the file is closed, and
+// removed if it's a temp file, when the last one is released, so a step
+// that outlives the handler that saved the upload still has its input.
+type sourceFile struct {
+	*os.File
+	remove bool
+
+	mu   sync.Mutex
+	refs int
+
+	// probe runs ffprobe on the file once, for every step that needs its
+	// duration or dimensions.
+	probe func() (videoProbe, error)
+}
+
+// createSourceFile creates an empty temp file for an upload, holding one
+// reference.
+func createSourceFile() (*sourceFile, error) {
+	f, err := os.CreateTemp("", "tubely-upload_*.mp4")
+	if err != nil {
+		return nil, err
+	}
+	return newSourceFile(f, true), nil
+}
+
+// newSourceFile shares f, holding one reference. With remove, f is deleted
+// once it's released.
+func newSourceFile(f *os.File, remove bool) *sourceFile {
+	src := &sourceFile{File: f, remove: remove, refs: 1}
+	src.probe = sync.OnceValues(func() (videoProbe, error) {
+		return probeVideo(f.Name())
+	})
+	return src
+}
+
+// duration is how long the video is.
+func (f *sourceFile) duration() (time.Duration, error) {
+	probe, err := f.probe()
+	if err != nil {
+		return 0, err
+	}
+	if probe.DurationMS == 0 {
+		return 0, errors.New("couldn't read video duration")
+	}
+	return time.Duration(probe.DurationMS) * time.Millisecond, nil
+}
+
+// aspectRatio is the video's aspect ratio as calculateAspectRatio names it.
+func (f *sourceFile) aspectRatio() (string, error) {
+	probe, err := f.probe()
+	if err != nil {
+		return "", err
+	}
+	return calculateAspectRatio(probe.Width, probe.Height), nil
+}
+
+// acquire takes another reference to the file, to be released by whoever
+// it's handed to.
+func (f *sourceFile) acquire() *sourceFile {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.refs == 0 {
+		panic("acquire of released source file " + f.Name())
+	}
+	f.refs++
+	return f
+}
+
+// release drops a reference, cleaning up the file after the last one.
+func (f *sourceFile) release() {
+	f.mu.Lock()
+	f.refs--
+	last := f.refs == 0
+	f.mu.Unlock()
+	if !last {
+		return
+	}
+	f.Close()
+	if f.remove {
+		if err := os.Remove(f.Name()); err != nil && !os.IsNotExist(err) {
+			log.Printf("Couldn't remove source file %s: %v", f.Name(), err)
+		}
+	}
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"slices"
+
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/google/uuid"
+)
+
+// storageUsageReport compares the storage usage recorded for users with
+// the sizes of their objects in the bucket.
+type storageUsageReport struct {
+	UsersChecked   int  `json:"users_checked"`
+	ObjectsChecked int  `json:"objects_checked"`
+	Fixed          bool `json:"fixed"`
+	// Users are the users whose recorded usage was off.
+	Users []userStorageDrift `json:"users"`
+}
+
+type userStorageDrift struct {
+	UserID        uuid.UUID `json:"user_id"`
+	RecordedBytes int64     `json:"recorded_bytes"`
+	ActualBytes   int64     `json:"actual_bytes"`
+	// Findings are the artifacts whose object is gone or has another size.
+	Findings []database.ReconciliationFinding `json:"findings"`
+}
+
+// recalculateUsage recomputes the storage usage of one user, or every user
+// if userID is uuid.Nil, by checking each of their artifacts' objects with
+// HeadObject. Usage drifts when a delete fails halfway or objects are
+// changed in the bucket by hand. With fix, artifacts whose object is gone
+// are removed and wrong sizes corrected, so usage matches the bucket again.
+func (rc reconciler) recalculateUsage(ctx context.Context, userID uuid.UUID, fix bool) (storageUsageReport, error) {
+	byUser, err := rc.db.ListUserArtifactObjects(userID)
+	if err != nil {
+		return storageUsageReport{}, fmt.Errorf("couldn't load artifacts: %w", err)
+	}
+	users := make([]uuid.UUID, 0, len(byUser))
+	for id := range byUser {
+		users = append(users, id)
+	}
+	slices.SortFunc(users, func(a, b uuid.UUID) int { return slices.Compare(a[:], b[:]) })
+
+	report := storageUsageReport{UsersChecked: len(users), Fixed: fix, Users: []userStorageDrift{}}
+	for _, id := range users {
+		drift := userStorageDrift{UserID: id, Findings: []database.ReconciliationFinding{}}
+		missing := []int64{}
+		for _, a := range byUser[id] {
+			report.ObjectsChecked++
+			drift.RecordedBytes += a.SizeBytes
+			size, err := rc.head(ctx, a.Key)
+			var notFound *types.NotFound
+			if errors.As(err, &notFound) {
+				drift.Findings = append(drift.Findings, database.ReconciliationFinding{
+					Kind: database.FindingMissingObject, Key: a.Key, ArtifactID: &a.ID, VideoID: &a.VideoID, RecordedSize: &a.SizeBytes,
+				})
+				missing = append(missing, a.ID)
+				continue
+			}
+			if err != nil {
+				return report, fmt.Errorf("couldn't get size of %s: %w", a.Key, err)
+			}
+			drift.ActualBytes += size
+			if size == a.SizeBytes {
+				continue
+			}
+			drift.Findings = append(drift.Findings, database.ReconciliationFinding{
+				Kind: database.FindingSizeMismatch, Key: a.Key, ArtifactID: &a.ID, VideoID: &a.VideoID, RecordedSize: &a.SizeBytes, ObjectSize: &size,
+			})
+			if fix {
+				if err := rc.db.UpdateArtifactSize(a.ID, size); err != nil {
+					return report, err
+				}
+			}
+		}
+		if len(drift.Findings) == 0 {
+			continue
+		}
+		report.Users = append(report.Users, drift)
+
+		if fix {
+			if err := rc.db.DeleteArtifactsByID(missing); err != nil {
+				return report, err
+			}
+			if err := rc.db.RecordStorageUsage(id); err != nil {
+				log.Printf("Couldn't record storage usage of user %s: %v", id, err)
+			}
+		}
+	}
+	return report, nil
+}
+
+// handlerAdminStorageUsageRecalculate recalculates storage usage, for a
+// single user if user_id is given. It checks every object, so for large
+// buckets the recalculate-usage command is the better fit.
+func (cfg *apiConfig) handlerAdminStorageUsageRecalculate(w http.ResponseWriter, r *http.Request) {
+	type parameters struct {
+		UserID uuid.UUID `json:"user_id"`
+		Fix    bool      `json:"fix"`
+	}
+	params := parameters{}
+	if err := json.NewDecoder(r.Body).Decode(&params); err != nil && !errors.Is(err, io.EOF) {
+		respondWithError(w, http.StatusBadRequest, "Couldn't decode parameters", err)
+		return
+	}
+
+	rc := reconciler{db: cfg.db, client: cfg.s3Client, bucket: cfg.s3Bucket}
+	report, err := rc.recalculateUsage(r.Context(), params.UserID, params.Fix)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't recalculate storage usage", err)
+		return
+	}
+	respondWithJSON(w, http.StatusOK, report)
+}
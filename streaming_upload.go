@@ -0,0 +1,173 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strconv"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+)
+
+// multipartPartSize is the default size of the parts of multipart
+// uploads. Parts other than the last must be at least 5MB.
+const multipartPartSize = 8 << 20
+
+// multipartConfig is when and how files are uploaded in parts.
+type multipartConfig struct {
+	// threshold is the size from which files are uploaded in parts, since
+	// a single PutObject of a multi-GB file fails or times out.
+	threshold int64
+	// partSize is how much of an upload is held in memory at once.
+	partSize int64
+}
+
+// multipartConfigFromEnv reads S3_MULTIPART_THRESHOLD_MB (default 64) and
+// S3_MULTIPART_PART_MB (default 8, at least 5).
+func multipartConfigFromEnv() (multipartConfig, error) {
+	c := multipartConfig{threshold: 64 << 20, partSize: multipartPartSize}
+	if v := os.Getenv("S3_MULTIPART_THRESHOLD_MB"); v != "" {
+		mb, err := strconv.Atoi(v)
+		if err != nil || mb < 0 {
+			return multipartConfig{}, fmt.Errorf("S3_MULTIPART_THRESHOLD_MB must be a number of megabytes")
+		}
+		c.threshold = int64(mb) << 20
+	}
+	if v := os.Getenv("S3_MULTIPART_PART_MB"); v != "" {
+		mb, err := strconv.Atoi(v)
+		if err != nil || mb < 5 {
+			return multipartConfig{}, fmt.Errorf("S3_MULTIPART_PART_MB must be at least 5")
+		}
+		c.partSize = int64(mb) << 20
+	}
+	return c, nil
+}
+
+// putFile uploads f as a new object at key, in one request or, from the
+// multipart threshold on, in parts. Like other new objects it's only
+// written if key isn't taken, see putNewObject.
+func (cfg *apiConfig) putFile(ctx context.Context, key, contentType string, tagging *string, f *os.File) (int64, error) {
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return 0, err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		return 0, err
+	}
+	if info.Size() >= cfg.multipart.threshold {
+		return cfg.putObjectStream(ctx, key, contentType, tagging, f)
+	}
+	_, err = cfg.s3Client.PutObject(ctx, &s3.PutObjectInput{
+		Bucket:      aws.String(cfg.s3Bucket),
+		Key:         aws.String(key),
+		Body:        f,
+		ContentType: aws.String(contentType),
+		IfNoneMatch: aws.String("*"),
+		Tagging:     tagging,
+	})
+	if err != nil {
+		return 0, conditionalWriteError(err)
+	}
+	return info.Size(), nil
+}
+
+// putObjectStream uploads body, whose size isn't known up front, as a
+// multipart upload. It returns the object's size. The upload is aborted if
+// anything fails so no parts are left behind to be billed. Like other new
+// objects it's only completed if key isn't taken, see putNewObject.
+func (cfg *apiConfig) putObjectStream(ctx context.Context, key, contentType string, tagging *string, body io.Reader) (int64, error) {
+	created, err := cfg.s3Client.CreateMultipartUpload(ctx, &s3.CreateMultipartUploadInput{
+		Bucket:      aws.String(cfg.s3Bucket),
+		Key:         aws.String(key),
+		ContentType: aws.String(contentType),
+		Tagging:     tagging,
+	})
+	if err != nil {
+		return 0, err
+	}
+	size, err := cfg.uploadParts(ctx, key, created.UploadId, body)
+	if err != nil {
+		_, abortErr := cfg.s3Client.AbortMultipartUpload(context.Background(), &s3.AbortMultipartUploadInput{
+			Bucket:   aws.String(cfg.s3Bucket),
+			Key:      aws.String(key),
+			UploadId: created.UploadId,
+		})
+		if abortErr != nil {
+			log.Printf("Couldn't abort multipart upload of %s: %v", key, abortErr)
+		}
+		return 0, err
+	}
+	return size, nil
+}
+
+func (cfg *apiConfig) uploadParts(ctx context.Context, key string, uploadID *string, body io.Reader) (int64, error) {
+	var size int64
+	parts := []types.CompletedPart{}
+	buf := make([]byte, cfg.multipart.partSize)
+	for number := int32(1); ; number++ {
+		n, err := io.ReadFull(body, buf)
+		// ReadFull's own end of body errors aren't wrapped, unlike those of
+		// a body that fails with io.ErrUnexpectedEOF, like a cut off
+		// request, which mustn't complete the upload.
+		last := err == io.EOF || err == io.ErrUnexpectedEOF
+		if err != nil && !last {
+			return 0, err
+		}
+		// An empty body still needs one part to complete.
+		if n == 0 && len(parts) > 0 {
+			break
+		}
+		out, err := cfg.s3Client.UploadPart(ctx, &s3.UploadPartInput{
+			Bucket:     aws.String(cfg.s3Bucket),
+			Key:        aws.String(key),
+			UploadId:   uploadID,
+			PartNumber: aws.Int32(number),
+			Body:       bytes.NewReader(buf[:n]),
+		})
+		if err != nil {
+			return 0, fmt.Errorf("couldn't upload part %d: %w", number, err)
+		}
+		parts = append(parts, types.CompletedPart{ETag: out.ETag, PartNumber: aws.Int32(number)})
+		size += int64(n)
+		if last {
+			break
+		}
+	}
+
+	_, err := cfg.s3Client.CompleteMultipartUpload(ctx, &s3.CompleteMultipartUploadInput{
+		Bucket:          aws.String(cfg.s3Bucket),
+		Key:             aws.String(key),
+		UploadId:        uploadID,
+		MultipartUpload: &types.CompletedMultipartUpload{Parts: parts},
+		IfNoneMatch:     aws.String("*"),
+	})
+	if err != nil {
+		return 0, conditionalWriteError(err)
+	}
+	return size, nil
+}
+
+// uploadFragmentedVideo encodes inputFilePath as a fragmented MP4, with
+// codecArgs from mp4CodecArgs, and uploads ffmpeg's output as it's
+// produced, so the encode never touches the disk. It returns the uploaded
+// size.
+func (cfg *apiConfig) uploadFragmentedVideo(ctx context.Context, inputFilePath string, codecArgs []string, key string, tagging *string) (int64, error) {
+	pr, pw := io.Pipe()
+	encoded := make(chan struct{})
+	go func() {
+		defer close(encoded)
+		pw.CloseWithError(encodeFragmentedMP4(ctx, inputFilePath, codecArgs, pw))
+	}()
+
+	// A failed encode fails the upload with ffmpeg's error, and a failed
+	// upload stops ffmpeg, so err covers both.
+	size, err := cfg.putObjectStream(ctx, key, "video/mp4", tagging, pr)
+	pr.CloseWithError(err)
+	<-encoded
+	return size, err
+}
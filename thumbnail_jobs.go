@@ -0,0 +1,189 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/google/uuid"
+)
+
+const (
+	// thumbnailQueueSize is how many jobs wait for a worker before new ones
+	// are left to runThumbnailJobs. Each waiting job keeps its upload on
+	// disk.
+	thumbnailQueueSize = 100
+	// thumbnailJobInterval is how often jobs no worker finished are
+	// picked up.
+	thumbnailJobInterval = time.Minute
+	// thumbnailJobStaleAfter is how long a job can go unfinished before
+	// its worker is assumed gone, e.g. with a restart.
+	thumbnailJobStaleAfter = 5 * time.Minute
+	// maxThumbnailJobAttempts is how often a stale job is picked up before
+	// the video is left without a generated thumbnail.
+	maxThumbnailJobAttempts = 3
+)
+
+// thumbnailWork is a thumbnail job along with the upload to generate it
+// from.
+type thumbnailWork struct {
+	job database.ThumbnailJob
+	src *sourceFile
+}
+
+// thumbnailQueue hands thumbnail jobs to a fixed number of workers, so the
+// upload that queued one responds without waiting for it.
+type thumbnailQueue struct {
+	work chan thumbnailWork
+	// inFlight are the IDs of the jobs queued or running here, which
+	// runThumbnailJobs leaves alone.
+	inFlight sync.Map
+}
+
+func newThumbnailQueue() *thumbnailQueue {
+	return &thumbnailQueue{work: make(chan thumbnailWork, thumbnailQueueSize)}
+}
+
+// runThumbnailWorkers starts n workers generating the thumbnails handed to
+// the queue.
+func (cfg *apiConfig) runThumbnailWorkers(n int) {
+	for range n {
+		go func() {
+			for w := range cfg.thumbnails.work {
+				if err := cfg.generateThumbnail(context.Background(), w.job, w.src); err != nil {
+					log.Printf("Couldn't generate thumbnail of video %s: %v", w.job.VideoID, err)
+				}
+				w.src.release()
+				cfg.thumbnails.inFlight.Delete(w.job.ID)
+			}
+		}()
+	}
+}
+
+// queueThumbnail marks the video's thumbnail pending and hands src to a
+// worker to generate it from. When the queue is full, the job waits for
+// runThumbnailJobs instead.
+func (cfg *apiConfig) queueThumbnail(videoID uuid.UUID, src *sourceFile) error {
+	job, err := cfg.db.QueueThumbnailJob(videoID)
+	if err != nil {
+		return err
+	}
+	cfg.thumbnails.inFlight.Store(job.ID, true)
+	select {
+	case cfg.thumbnails.work <- thumbnailWork{job: job, src: src.acquire()}:
+	default:
+		src.release()
+		cfg.thumbnails.inFlight.Delete(job.ID)
+		log.Printf("Thumbnail queue is full, thumbnail of video %s is generated later", videoID)
+	}
+	return nil
+}
+
+// generateThumbnail runs a job, recording the thumbnail generated from src
+// unless the job was replaced or cancelled meanwhile, by another upload of
+// the video or an uploaded thumbnail. A thumbnail that can't be generated
+// leaves the video without one, as uploads did when it was generated
+// before responding.
+func (cfg *apiConfig) generateThumbnail(ctx context.Context, job database.ThumbnailJob, src *sourceFile) error {
+	video, err := cfg.db.GetVideo(job.VideoID)
+	if err != nil {
+		return err
+	}
+	if video.ID == uuid.Nil {
+		// Deleting the video deleted the job.
+		return nil
+	}
+
+	keys := cfg.objectKeys(video.UserID, video.ID)
+	thumbnail := cfg.generateArtifact(ctx, keys, database.ArtifactKindThumbnail, "image/jpeg", nil, func(out string) error {
+		return extractThumbnail(src.Name(), out)
+	})
+
+	// A discarded thumbnail is left in the bucket, since identical images
+	// share a key and it may be one the video still uses.
+	current, err := cfg.db.GetThumbnailJob(video.ID)
+	if err != nil {
+		return err
+	}
+	if current == nil || current.ID != job.ID {
+		return nil
+	}
+	artifacts := []database.CreateArtifactParams{}
+	if thumbnail != nil {
+		artifacts = append(artifacts, *thumbnail)
+	}
+	if err := cfg.replaceArtifacts(ctx, video.ID, database.ArtifactKindThumbnail, artifacts); err != nil {
+		return err
+	}
+	if err := cfg.db.DeleteThumbnailJob(job.ID); err != nil {
+		return err
+	}
+	// The thumbnail changes the video's URLs, so its ETag has to change
+	// too. A video updated meanwhile already has a new one.
+	err = cfg.db.UpdateVideoIfUnchanged(&video)
+	if err != nil && !errors.Is(err, database.ErrVideoModified) {
+		return err
+	}
+	return nil
+}
+
+// runThumbnailJobs is the scheduled job picking up thumbnail jobs no worker
+// finished, like those interrupted by a restart or that didn't fit in the
+// queue.
+func (cfg *apiConfig) runThumbnailJobs(ctx context.Context) error {
+	jobs, err := cfg.db.GetThumbnailJobs()
+	if err != nil {
+		return fmt.Errorf("couldn't get thumbnail jobs: %w", err)
+	}
+
+	failed := 0
+	for _, job := range jobs {
+		if time.Since(job.QueuedAt) < thumbnailJobStaleAfter {
+			break
+		}
+		if _, ok := cfg.thumbnails.inFlight.Load(job.ID); ok {
+			continue
+		}
+		if err := cfg.resumeThumbnailJob(ctx, job); err != nil {
+			log.Printf("Couldn't generate thumbnail of video %s: %v", job.VideoID, err)
+			failed++
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("couldn't generate %d thumbnails", failed)
+	}
+	return nil
+}
+
+// resumeThumbnailJob runs a stale job. Its upload is gone, so the thumbnail
+// is generated from the encoded video in the bucket.
+func (cfg *apiConfig) resumeThumbnailJob(ctx context.Context, job database.ThumbnailJob) error {
+	if job.Attempts >= maxThumbnailJobAttempts {
+		log.Printf("Giving up on thumbnail of video %s after %d attempts", job.VideoID, job.Attempts)
+		return cfg.db.DeleteThumbnailJob(job.ID)
+	}
+	if err := cfg.db.RetryThumbnailJob(job.ID); err != nil {
+		return err
+	}
+	artifacts, err := cfg.db.GetArtifacts(job.VideoID, database.ArtifactKindVideo)
+	if err != nil {
+		return err
+	}
+	if len(artifacts) == 0 {
+		return cfg.db.DeleteThumbnailJob(job.ID)
+	}
+
+	src, err := createSourceFile()
+	if err != nil {
+		return err
+	}
+	defer src.release()
+	if _, err := cfg.downloadObject(ctx, artifacts[0].Key, src.File); err != nil {
+		return fmt.Errorf("couldn't download %s: %w", artifacts[0].Key, err)
+	}
+	return cfg.generateThumbnail(ctx, job, src)
+}
@@ -0,0 +1,490 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/auth"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/transcoder"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/validate"
+	"github.com/google/uuid"
+)
+
+const (
+	// tusVersion is the only version of the tus protocol spoken here.
+	tusVersion = "1.0.0"
+	// tusExtensions are the tus extensions supported on top of the core
+	// protocol.
+	tusExtensions = "creation,termination,expiration"
+	// tusUploadTTL is how long a client has to finish a tus upload before
+	// its bytes are discarded.
+	tusUploadTTL = 24 * time.Hour
+)
+
+// tusStore keeps tus uploads on disk while their bytes arrive, each in a
+// file named after its ID. The file's size is how far the upload got, so
+// bytes received before a connection dropped are kept.
+type tusStore struct {
+	dir string
+	// sending are the IDs of the uploads a request is appending to.
+	sending sync.Map
+}
+
+// tusStoreFromEnv reads TUS_DIR, default tubely-tus in the temp directory,
+// and creates it.
+func tusStoreFromEnv() (*tusStore, error) {
+	dir := os.Getenv("TUS_DIR")
+	if dir == "" {
+		dir = filepath.Join(os.TempDir(), "tubely-tus")
+	}
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, err
+	}
+	return &tusStore{dir: dir}, nil
+}
+
+func (s *tusStore) path(id uuid.UUID) string {
+	return filepath.Join(s.dir, id.String())
+}
+
+// lock reserves the upload for one request, returning false if another
+// request has it.
+func (s *tusStore) lock(id uuid.UUID) bool {
+	_, taken := s.sending.LoadOrStore(id, true)
+	return !taken
+}
+
+func (s *tusStore) unlock(id uuid.UUID) {
+	s.sending.Delete(id)
+}
+
+// offset is how many bytes of the upload were received.
+func (s *tusStore) offset(id uuid.UUID) (int64, error) {
+	info, err := os.Stat(s.path(id))
+	if err != nil {
+		return 0, err
+	}
+	return info.Size(), nil
+}
+
+// remove deletes the upload's file, if it's still there.
+func (s *tusStore) remove(id uuid.UUID) error {
+	err := os.Remove(s.path(id))
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+// checkTusResumable responds with 412 and returns false unless the request
+// speaks the tus version supported here. Every tus response says which
+// version it speaks.
+func checkTusResumable(w http.ResponseWriter, r *http.Request) bool {
+	w.Header().Set("Tus-Resumable", tusVersion)
+	if r.Header.Get("Tus-Resumable") != tusVersion {
+		w.Header().Set("Tus-Version", tusVersion)
+		respondWithError(w, http.StatusPreconditionFailed, "Tus-Resumable must be 1.0.0", nil)
+		return false
+	}
+	return true
+}
+
+// parseTusMetadata parses an Upload-Metadata header: comma separated keys,
+// each followed by a space and its base64 value unless it has none.
+func parseTusMetadata(header string) (map[string]string, error) {
+	metadata := map[string]string{}
+	if strings.TrimSpace(header) == "" {
+		return metadata, nil
+	}
+	for _, pair := range strings.Split(header, ",") {
+		key, encoded, _ := strings.Cut(strings.TrimSpace(pair), " ")
+		if key == "" {
+			return nil, errors.New("empty metadata key")
+		}
+		value, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil {
+			return nil, err
+		}
+		metadata[key] = string(value)
+	}
+	return metadata, nil
+}
+
+// setTusUploadHeaders sets the headers telling a client where an upload
+// stands.
+func setTusUploadHeaders(w http.ResponseWriter, upload database.TusUpload, offset int64) {
+	w.Header().Set("Upload-Offset", strconv.FormatInt(offset, 10))
+	w.Header().Set("Upload-Length", strconv.FormatInt(upload.SizeBytes, 10))
+	w.Header().Set("Upload-Expires", upload.ExpiresAt.UTC().Format(http.TimeFormat))
+	w.Header().Set("Cache-Control", "no-store")
+}
+
+// handlerTusOptions tells tus clients what the server supports.
+func (cfg *apiConfig) handlerTusOptions(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Tus-Resumable", tusVersion)
+	w.Header().Set("Tus-Version", tusVersion)
+	w.Header().Set("Tus-Extension", tusExtensions)
+	w.Header().Set("Tus-Max-Size", strconv.Itoa(maxUploadLimit))
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handlerTusCreate starts a tus upload of the video's file. The Location
+// of the response is where the client sends the bytes, with
+// handlerTusPatch, and asks how far it got, with handlerTusHead.
+func (cfg *apiConfig) handlerTusCreate(w http.ResponseWriter, r *http.Request) {
+	if !checkTusResumable(w, r) {
+		return
+	}
+	video, ok := cfg.ownedVideo(w, r)
+	if !ok {
+		return
+	}
+
+	size, err := strconv.ParseInt(r.Header.Get("Upload-Length"), 10, 64)
+	if err != nil || size < 0 {
+		respondWithError(w, http.StatusBadRequest, "Invalid Upload-Length", err)
+		return
+	}
+	if size > maxUploadLimit {
+		respondWithError(w, http.StatusRequestEntityTooLarge, "Video file is too large", nil)
+		return
+	}
+	metadata, err := parseTusMetadata(r.Header.Get("Upload-Metadata"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid Upload-Metadata", err)
+		return
+	}
+	contentType := metadata["filetype"]
+	if contentType == "" {
+		contentType = "video/mp4"
+	}
+	quality := metadata["quality"]
+	if quality != "" {
+		if _, err := transcoder.ParsePreset(quality); err != nil {
+			respondWithValidationErrors(w, validate.Errors{"quality": "must be sd, hd or fhd"})
+			return
+		}
+	}
+	if uerr := cfg.checkVideoType(contentType); uerr != nil {
+		respondWithUploadError(w, uerr)
+		return
+	}
+
+	_, limits, err := cfg.getUserLimits(video.UserID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get plan limits", err)
+		return
+	}
+	err = cfg.checkStorageQuota(video.UserID, limits, size, video.SizeBytes)
+	if errors.Is(err, errStorageQuotaExceeded) {
+		respondWithError(w, http.StatusForbidden, "Storage quota exceeded for your plan", err)
+		return
+	}
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't check storage quota", err)
+		return
+	}
+
+	upload, err := cfg.db.CreateTusUpload(time.Now().UTC().Add(tusUploadTTL), database.CreateTusUploadParams{
+		UserID:      video.UserID,
+		VideoID:     video.ID,
+		SizeBytes:   size,
+		ContentType: contentType,
+		Quality:     quality,
+	})
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't create upload", err)
+		return
+	}
+	f, err := os.OpenFile(cfg.tus.path(upload.ID), os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0o600)
+	if err != nil {
+		if err := cfg.db.DeleteTusUpload(upload.ID); err != nil {
+			log.Printf("Couldn't delete tus upload %s: %v", upload.ID, err)
+		}
+		respondWithError(w, http.StatusInternalServerError, "Couldn't create upload", err)
+		return
+	}
+	f.Close()
+
+	setTusUploadHeaders(w, upload, 0)
+	w.Header().Set("Location", "/api/tus/"+upload.ID.String())
+	w.WriteHeader(http.StatusCreated)
+}
+
+// ownedTusUpload authenticates the request and returns the tus upload in
+// its path if it belongs to the user and hasn't expired. It responds and
+// returns false otherwise.
+func (cfg *apiConfig) ownedTusUpload(w http.ResponseWriter, r *http.Request) (database.TusUpload, bool) {
+	token, err := auth.GetBearerToken(r.Header)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Couldn't find JWT", err)
+		return database.TusUpload{}, false
+	}
+	userID, err := cfg.validateJWT(token)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Couldn't validate JWT", err)
+		return database.TusUpload{}, false
+	}
+
+	id, err := uuid.Parse(r.PathValue("uploadID"))
+	if err != nil {
+		respondWithError(w, http.StatusNotFound, "Couldn't find upload", err)
+		return database.TusUpload{}, false
+	}
+	upload, err := cfg.db.GetTusUpload(id)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get upload", err)
+		return database.TusUpload{}, false
+	}
+	if upload == nil || upload.UserID != userID {
+		respondWithError(w, http.StatusNotFound, "Couldn't find upload", nil)
+		return database.TusUpload{}, false
+	}
+	if !time.Now().Before(upload.ExpiresAt) {
+		respondWithError(w, http.StatusGone, "Upload expired", nil)
+		return database.TusUpload{}, false
+	}
+	return *upload, true
+}
+
+// handlerTusHead reports how many bytes of the upload the server has, so a
+// resuming client sends the rest from there.
+func (cfg *apiConfig) handlerTusHead(w http.ResponseWriter, r *http.Request) {
+	if !checkTusResumable(w, r) {
+		return
+	}
+	upload, ok := cfg.ownedTusUpload(w, r)
+	if !ok {
+		return
+	}
+	offset, err := cfg.tus.offset(upload.ID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get upload", err)
+		return
+	}
+	setTusUploadHeaders(w, upload, offset)
+	w.WriteHeader(http.StatusOK)
+}
+
+// handlerTusPatch appends the request body to the upload at Upload-Offset,
+// which has to be where the upload got to. Whatever arrives is kept, even
+// if the connection drops midway. Once every byte is there the file is
+// processed like a regular upload, and the response has the video.
+func (cfg *apiConfig) handlerTusPatch(w http.ResponseWriter, r *http.Request) {
+	if !checkTusResumable(w, r) {
+		return
+	}
+	upload, ok := cfg.ownedTusUpload(w, r)
+	if !ok {
+		return
+	}
+	if r.Header.Get("Content-Type") != "application/offset+octet-stream" {
+		respondWithError(w, http.StatusUnsupportedMediaType, "Content-Type must be application/offset+octet-stream", nil)
+		return
+	}
+	requestOffset, err := strconv.ParseInt(r.Header.Get("Upload-Offset"), 10, 64)
+	if err != nil || requestOffset < 0 {
+		respondWithError(w, http.StatusBadRequest, "Invalid Upload-Offset", err)
+		return
+	}
+
+	if !cfg.tus.lock(upload.ID) {
+		respondWithError(w, http.StatusLocked, "Upload is already being sent", nil)
+		return
+	}
+	defer cfg.tus.unlock(upload.ID)
+
+	f, err := os.OpenFile(cfg.tus.path(upload.ID), os.O_WRONLY|os.O_APPEND, 0)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't open upload", err)
+		return
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't open upload", err)
+		return
+	}
+	offset := info.Size()
+	if requestOffset != offset {
+		setTusUploadHeaders(w, upload, offset)
+		respondWithErrorf(w, http.StatusConflict, nil, "Upload-Offset must be %d, the bytes received so far", offset)
+		return
+	}
+
+	n, err := io.Copy(f, http.MaxBytesReader(w, r.Body, upload.SizeBytes-offset))
+	offset += n
+	setTusUploadHeaders(w, upload, offset)
+	var maxBytesErr *http.MaxBytesError
+	if errors.As(err, &maxBytesErr) {
+		respondWithError(w, http.StatusRequestEntityTooLarge, "Upload is longer than its Upload-Length", err)
+		return
+	}
+	if err != nil {
+		// Usually the client going away. The bytes that made it are kept
+		// for it to resume from.
+		respondWithFormError(w, err)
+		return
+	}
+	if offset < upload.SizeBytes {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	// Closed before processing, which removes the file once it's done.
+	f.Close()
+	cfg.completeTusUpload(w, r, upload)
+}
+
+// completeTusUpload processes an upload whose bytes have all arrived. If
+// the user has too many uploads in flight it's left as it is, for the
+// client to complete later with an empty PATCH.
+func (cfg *apiConfig) completeTusUpload(w http.ResponseWriter, r *http.Request, upload database.TusUpload) {
+	video, err := cfg.db.GetVideo(upload.VideoID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't find video", err)
+		return
+	}
+	if !cfg.checkVideoAvailable(w, video.ID) {
+		return
+	}
+	release, ok := cfg.acquireUploadSlot(w, upload.UserID)
+	if !ok {
+		return
+	}
+	defer release()
+
+	f, err := os.Open(cfg.tus.path(upload.ID))
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't open upload", err)
+		return
+	}
+	src := newSourceFile(f, true)
+	defer src.release()
+	if err := cfg.db.DeleteTusUpload(upload.ID); err != nil {
+		log.Printf("Couldn't delete completed tus upload %s: %v", upload.ID, err)
+	}
+
+	hash := sha256.New()
+	if _, err := io.Copy(hash, f); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't read upload", err)
+		return
+	}
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't reset file pointer", err)
+		return
+	}
+
+	_, limits, err := cfg.getUserLimits(upload.UserID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get plan limits", err)
+		return
+	}
+	err = cfg.checkStorageQuota(upload.UserID, limits, upload.SizeBytes, video.SizeBytes)
+	if errors.Is(err, errStorageQuotaExceeded) {
+		respondWithError(w, http.StatusForbidden, "Storage quota exceeded for your plan", err)
+		return
+	}
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't check storage quota", err)
+		return
+	}
+
+	cfg.processVideoUpload(w, r, videoUpload{
+		video:       video,
+		userID:      upload.UserID,
+		limits:      limits,
+		file:        src,
+		mediaType:   upload.ContentType,
+		size:        upload.SizeBytes,
+		contentHash: hex.EncodeToString(hash.Sum(nil)),
+		quality:     upload.Quality,
+	})
+}
+
+// handlerTusDelete cancels an upload and discards its bytes.
+func (cfg *apiConfig) handlerTusDelete(w http.ResponseWriter, r *http.Request) {
+	if !checkTusResumable(w, r) {
+		return
+	}
+	upload, ok := cfg.ownedTusUpload(w, r)
+	if !ok {
+		return
+	}
+	if !cfg.tus.lock(upload.ID) {
+		respondWithError(w, http.StatusLocked, "Upload is already being sent", nil)
+		return
+	}
+	defer cfg.tus.unlock(upload.ID)
+	if err := cfg.tus.remove(upload.ID); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't delete upload", err)
+		return
+	}
+	if err := cfg.db.DeleteTusUpload(upload.ID); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't delete upload", err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// runTusUploadExpiry discards the bytes of tus uploads that weren't
+// finished in time, and files left behind by uploads whose video was
+// deleted.
+func (cfg *apiConfig) runTusUploadExpiry(ctx context.Context) error {
+	uploads, err := cfg.db.GetExpiredTusUploads()
+	if err != nil {
+		return err
+	}
+	for _, upload := range uploads {
+		if err := cfg.tus.remove(upload.ID); err != nil {
+			return err
+		}
+		if err := cfg.db.DeleteTusUpload(upload.ID); err != nil {
+			return err
+		}
+	}
+
+	entries, err := os.ReadDir(cfg.tus.dir)
+	if err != nil {
+		return err
+	}
+	orphaned := 0
+	for _, entry := range entries {
+		id, err := uuid.Parse(entry.Name())
+		if err != nil {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil || time.Since(info.ModTime()) < tusUploadTTL {
+			continue
+		}
+		upload, err := cfg.db.GetTusUpload(id)
+		if err != nil {
+			return err
+		}
+		if upload != nil {
+			continue
+		}
+		if err := cfg.tus.remove(id); err != nil {
+			return err
+		}
+		orphaned++
+	}
+
+	if len(uploads)+orphaned > 0 {
+		log.Printf("Discarded %d expired tus uploads", len(uploads)+orphaned)
+	}
+	return nil
+}
@@ -0,0 +1,212 @@
+package main
+
+import (
+	"expvar"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"runtime/metrics"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	uploadAuditInterval = 50 * time.Millisecond
+	// maxRecentUploadAudits is how many results /debug/vars lists.
+	maxRecentUploadAudits = 20
+	// An upload whose heap growth reaches this share of its size, and at
+	// least minBufferedHeapBytes, was most likely read into memory whole.
+	bufferedHeapRatio    = 0.5
+	minBufferedHeapBytes = 8 << 20
+)
+
+const heapObjectsMetric = "/memory/classes/heap/objects:bytes"
+
+// uploadAuditor checks that uploads stream instead of being buffered, which
+// is easy to regress on when adding a pipeline step. With UPLOAD_AUDIT set,
+// every video upload samples the heap and its temp files while it runs and
+// the results are published under "upload_audit" in expvar. The heap is
+// shared and includes garbage that wasn't collected yet, so the numbers are
+// an upper bound: audit one upload at a time and compare against a baseline.
+type uploadAuditor struct {
+	mu       sync.Mutex
+	uploads  int64
+	buffered int64
+	maxHeap  int64
+	maxTemp  int64
+	recent   []uploadAuditResult
+}
+
+type uploadAuditResult struct {
+	Path          string    `json:"path"`
+	FinishedAt    time.Time `json:"finished_at"`
+	DurationMS    int64     `json:"duration_ms"`
+	BodyBytes     int64     `json:"body_bytes"`
+	PeakHeapBytes int64     `json:"peak_heap_bytes"`
+	PeakTempBytes int64     `json:"peak_temp_bytes"`
+	Buffered      bool      `json:"buffered"`
+}
+
+func newUploadAuditor() *uploadAuditor {
+	a := &uploadAuditor{recent: []uploadAuditResult{}}
+	expvar.Publish("upload_audit", expvar.Func(func() any { return a.stats() }))
+	return a
+}
+
+func (a *uploadAuditor) stats() any {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return struct {
+		Uploads          int64               `json:"uploads"`
+		Buffered         int64               `json:"buffered"`
+		MaxPeakHeapBytes int64               `json:"max_peak_heap_bytes"`
+		MaxPeakTempBytes int64               `json:"max_peak_temp_bytes"`
+		Recent           []uploadAuditResult `json:"recent"`
+	}{a.uploads, a.buffered, a.maxHeap, a.maxTemp, append([]uploadAuditResult{}, a.recent...)}
+}
+
+func (a *uploadAuditor) record(result uploadAuditResult) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.uploads++
+	if result.Buffered {
+		a.buffered++
+	}
+	a.maxHeap = max(a.maxHeap, result.PeakHeapBytes)
+	a.maxTemp = max(a.maxTemp, result.PeakTempBytes)
+	a.recent = append(a.recent, result)
+	if len(a.recent) > maxRecentUploadAudits {
+		a.recent = a.recent[1:]
+	}
+}
+
+// uploadAudit measures one upload. All its methods do nothing on a nil
+// audit, which is what start returns when auditing is off.
+type uploadAudit struct {
+	auditor   *uploadAuditor
+	path      string
+	started   time.Time
+	baseHeap  int64
+	body      *countingReader
+	done      chan struct{}
+	wg        sync.WaitGroup
+	mu        sync.Mutex
+	tempFiles []string
+	peakHeap  int64
+	peakTemp  int64
+}
+
+// start wraps r.Body to count what's read from it and starts sampling.
+func (a *uploadAuditor) start(r *http.Request) *uploadAudit {
+	if a == nil {
+		return nil
+	}
+	audit := &uploadAudit{
+		auditor:  a,
+		path:     r.URL.Path,
+		started:  time.Now(),
+		baseHeap: heapObjectsBytes(),
+		body:     &countingReader{ReadCloser: r.Body},
+		done:     make(chan struct{}),
+	}
+	r.Body = audit.body
+	audit.wg.Add(1)
+	go audit.sample()
+	return audit
+}
+
+func (u *uploadAudit) sample() {
+	defer u.wg.Done()
+	ticker := time.NewTicker(uploadAuditInterval)
+	defer ticker.Stop()
+	for {
+		u.measure()
+		select {
+		case <-u.done:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (u *uploadAudit) measure() {
+	heap := heapObjectsBytes() - u.baseHeap
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	var temp int64
+	for _, name := range u.tempFiles {
+		if info, err := os.Stat(name); err == nil {
+			temp += info.Size()
+		}
+	}
+	u.peakHeap = max(u.peakHeap, heap)
+	u.peakTemp = max(u.peakTemp, temp)
+}
+
+// trackTempFile counts name towards the upload's temp disk usage for as
+// long as it exists. Files written by ffmpeg are tracked once it's done,
+// so they're measured right away.
+func (u *uploadAudit) trackTempFile(name string) {
+	if u == nil {
+		return
+	}
+	u.mu.Lock()
+	u.tempFiles = append(u.tempFiles, name)
+	u.mu.Unlock()
+	u.measure()
+}
+
+// finish stops sampling and records the result. Requests that never got to
+// reading the upload aren't recorded.
+func (u *uploadAudit) finish() {
+	if u == nil {
+		return
+	}
+	close(u.done)
+	u.wg.Wait()
+	body := u.body.n.Load()
+	if body == 0 {
+		return
+	}
+	result := uploadAuditResult{
+		Path:          u.path,
+		FinishedAt:    time.Now().UTC(),
+		DurationMS:    time.Since(u.started).Milliseconds(),
+		BodyBytes:     body,
+		PeakHeapBytes: u.peakHeap,
+		PeakTempBytes: u.peakTemp,
+	}
+	result.Buffered = result.PeakHeapBytes >= minBufferedHeapBytes &&
+		float64(result.PeakHeapBytes) >= bufferedHeapRatio*float64(body)
+	u.auditor.record(result)
+	log.Printf("upload audit: %s read %d bytes in %dms, peak heap +%d bytes, peak temp files %d bytes",
+		result.Path, result.BodyBytes, result.DurationMS, result.PeakHeapBytes, result.PeakTempBytes)
+	if result.Buffered {
+		log.Printf("upload audit: %s grew the heap by %d bytes for a %d byte upload, it's probably being buffered in memory",
+			result.Path, result.PeakHeapBytes, result.BodyBytes)
+	}
+}
+
+type countingReader struct {
+	io.ReadCloser
+	n atomic.Int64
+}
+
+func (r *countingReader) Read(p []byte) (int, error) {
+	n, err := r.ReadCloser.Read(p)
+	r.n.Add(int64(n))
+	return n, err
+}
+
+// heapObjectsBytes reads the live heap without stopping the world, unlike
+// runtime.ReadMemStats.
+func heapObjectsBytes() int64 {
+	sample := []metrics.Sample{{Name: heapObjectsMetric}}
+	metrics.Read(sample)
+	if sample[0].Value.Kind() != metrics.KindUint64 {
+		return 0
+	}
+	return int64(sample[0].Value.Uint64())
+}
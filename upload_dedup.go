@@ -0,0 +1,77 @@
+package main
+
+import (
+	"net/http"
+	"sync"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/google/uuid"
+)
+
+// inFlightUploadKey identifies identical uploads: the same file, or the
+// same Idempotency-Key, sent by the same user for the same video.
+type inFlightUploadKey struct {
+	userID  uuid.UUID
+	videoID uuid.UUID
+	key     string
+}
+
+// inFlightUpload is an upload being processed. Its result is set by the
+// time done is closed.
+type inFlightUpload struct {
+	done   chan struct{}
+	video  database.Video
+	status int
+	err    *uploadError
+}
+
+// uploadRegistry coalesces identical uploads that arrive while the first
+// is still processing, like a double-clicked upload button sending the file
+// twice. Only the first is processed; the others wait for it and respond
+// with its result.
+type uploadRegistry struct {
+	mu       sync.Mutex
+	inFlight map[inFlightUploadKey]*inFlightUpload
+}
+
+func newUploadRegistry() *uploadRegistry {
+	return &uploadRegistry{inFlight: map[inFlightUploadKey]*inFlightUpload{}}
+}
+
+// uploadKey is the key of the upload the request sent: its Idempotency-Key
+// header if it has one, or else the file's SHA-256. A streamed upload's
+// hash isn't known until it's stored, so without the header it has no key
+// and isn't coalesced.
+func uploadKey(r *http.Request, upload videoUpload) (inFlightUploadKey, bool) {
+	key := "sha256:" + upload.contentHash
+	if idempotencyKey := r.Header.Get("Idempotency-Key"); idempotencyKey != "" {
+		key = "key:" + idempotencyKey
+	} else if upload.stream != nil {
+		return inFlightUploadKey{}, false
+	}
+	return inFlightUploadKey{userID: upload.userID, videoID: upload.video.ID, key: key}, true
+}
+
+// do runs process unless an identical upload is in flight, in which case
+// it waits for that one's result instead. coalesced reports which it was.
+func (reg *uploadRegistry) do(key inFlightUploadKey, process func() (database.Video, int, *uploadError)) (video database.Video, status int, uerr *uploadError, coalesced bool) {
+	reg.mu.Lock()
+	if u, ok := reg.inFlight[key]; ok {
+		reg.mu.Unlock()
+		<-u.done
+		return u.video, u.status, u.err, true
+	}
+	// Waiters get an error should process panic.
+	u := &inFlightUpload{done: make(chan struct{}), err: &uploadError{status: http.StatusInternalServerError, format: "Couldn't process video"}}
+	reg.inFlight[key] = u
+	reg.mu.Unlock()
+
+	defer func() {
+		reg.mu.Lock()
+		delete(reg.inFlight, key)
+		reg.mu.Unlock()
+		close(u.done)
+	}()
+	u.video, u.status, u.err = process()
+	return u.video, u.status, u.err, false
+}
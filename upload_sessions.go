@@ -0,0 +1,364 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/auth"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/transcoder"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/validate"
+)
+
+const (
+	// uploadSessionTTL is how long a client has to finish an upload session
+	// before its parts are discarded.
+	uploadSessionTTL             = 24 * time.Hour
+	uploadSessionCleanupInterval = time.Hour
+)
+
+// byteRange is a range of bytes, inclusive like HTTP ranges.
+type byteRange struct {
+	Start int64 `json:"start"`
+	End   int64 `json:"end"`
+}
+
+// uploadSessionResponse is a session with what the client needs to resume
+// it: which bytes the server has and which parts are left to send.
+type uploadSessionResponse struct {
+	database.UploadSession
+	PartCount     int32       `json:"part_count"`
+	ReceivedBytes int64       `json:"received_bytes"`
+	Ranges        []byteRange `json:"ranges"`
+	MissingParts  []int32     `json:"missing_parts"`
+}
+
+// uploadSessionPartCount is the number of parts a session's file is split
+// into. Every part is PartSize bytes except the last.
+func uploadSessionPartCount(session database.UploadSession) int32 {
+	return int32((session.SizeBytes + session.PartSize - 1) / session.PartSize)
+}
+
+// uploadSessionPartRange returns the bytes of the file that part number
+// holds.
+func uploadSessionPartRange(session database.UploadSession, number int32) byteRange {
+	start := int64(number-1) * session.PartSize
+	return byteRange{Start: start, End: min(start+session.PartSize, session.SizeBytes) - 1}
+}
+
+func newUploadSessionResponse(session database.UploadSession) uploadSessionResponse {
+	resp := uploadSessionResponse{
+		UploadSession: session,
+		PartCount:     uploadSessionPartCount(session),
+		Ranges:        []byteRange{},
+		MissingParts:  []int32{},
+	}
+	received := map[int32]bool{}
+	for _, part := range session.Parts {
+		received[part.Number] = true
+		resp.ReceivedBytes += part.SizeBytes
+	}
+	for number := int32(1); number <= resp.PartCount; number++ {
+		if !received[number] {
+			resp.MissingParts = append(resp.MissingParts, number)
+			continue
+		}
+		r := uploadSessionPartRange(session, number)
+		if n := len(resp.Ranges); n > 0 && resp.Ranges[n-1].End+1 == r.Start {
+			resp.Ranges[n-1].End = r.End
+		} else {
+			resp.Ranges = append(resp.Ranges, r)
+		}
+	}
+	return resp
+}
+
+// handlerUploadSessionCreate starts an upload the client sends in parts
+// with handlerUploadSessionPartPut. The token in the response is all it
+// needs to keep to resume the upload, e.g. after the app was restarted.
+func (cfg *apiConfig) handlerUploadSessionCreate(w http.ResponseWriter, r *http.Request) {
+	video, ok := cfg.ownedVideo(w, r)
+	if !ok {
+		return
+	}
+
+	type parameters struct {
+		SizeBytes   int64  `json:"size_bytes"`
+		ContentType string `json:"content_type"`
+		Quality     string `json:"quality"`
+	}
+	params := parameters{}
+	if err := json.NewDecoder(r.Body).Decode(&params); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Couldn't decode parameters", err)
+		return
+	}
+	if params.ContentType == "" {
+		params.ContentType = "video/mp4"
+	}
+
+	errs := validate.Errors{}
+	errs.Check(params.SizeBytes > 0, "size_bytes", "is required")
+	errs.Check(params.SizeBytes <= maxUploadLimit, "size_bytes", "must be at most 1GB")
+	if params.Quality != "" {
+		_, err := transcoder.ParsePreset(params.Quality)
+		errs.Check(err == nil, "quality", "must be sd, hd or fhd")
+	}
+	if errs.Err() != nil {
+		respondWithValidationErrors(w, errs)
+		return
+	}
+	if uerr := cfg.checkVideoType(params.ContentType); uerr != nil {
+		respondWithUploadError(w, uerr)
+		return
+	}
+
+	_, limits, err := cfg.getUserLimits(video.UserID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get plan limits", err)
+		return
+	}
+	err = cfg.checkStorageQuota(video.UserID, limits, params.SizeBytes, video.SizeBytes)
+	if errors.Is(err, errStorageQuotaExceeded) {
+		respondWithError(w, http.StatusForbidden, "Storage quota exceeded for your plan", err)
+		return
+	}
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't check storage quota", err)
+		return
+	}
+
+	token, err := auth.MakeRefreshToken()
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't create upload session", err)
+		return
+	}
+	key := directUploadPrefix(video.UserID, video.ID) + generateRandomNameWithExtensionType(params.ContentType)
+	created, err := cfg.s3Client.CreateMultipartUpload(r.Context(), &s3.CreateMultipartUploadInput{
+		Bucket:      aws.String(cfg.s3Bucket),
+		Key:         aws.String(key),
+		ContentType: aws.String(params.ContentType),
+	})
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't create upload session", err)
+		return
+	}
+
+	session, err := cfg.db.CreateUploadSession(token, time.Now().UTC().Add(uploadSessionTTL), database.CreateUploadSessionParams{
+		UserID:      video.UserID,
+		VideoID:     video.ID,
+		SizeBytes:   params.SizeBytes,
+		PartSize:    multipartPartSize,
+		ContentType: params.ContentType,
+		Quality:     params.Quality,
+		S3Key:       key,
+		S3UploadID:  aws.ToString(created.UploadId),
+	})
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't create upload session", err)
+		return
+	}
+	respondWithJSON(w, http.StatusCreated, newUploadSessionResponse(session))
+}
+
+// ownedUploadSession authenticates the request and returns the upload
+// session in its path if it belongs to the user and hasn't expired. It
+// responds and returns false otherwise.
+func (cfg *apiConfig) ownedUploadSession(w http.ResponseWriter, r *http.Request) (database.UploadSession, bool) {
+	token, err := auth.GetBearerToken(r.Header)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Couldn't find JWT", err)
+		return database.UploadSession{}, false
+	}
+	userID, err := cfg.validateJWT(token)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Couldn't validate JWT", err)
+		return database.UploadSession{}, false
+	}
+
+	session, err := cfg.db.GetUploadSession(r.PathValue("token"))
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get upload session", err)
+		return database.UploadSession{}, false
+	}
+	if session == nil || session.UserID != userID {
+		respondWithError(w, http.StatusNotFound, "Couldn't find upload session", nil)
+		return database.UploadSession{}, false
+	}
+	if !time.Now().Before(session.ExpiresAt) {
+		respondWithError(w, http.StatusGone, "Upload session expired", nil)
+		return database.UploadSession{}, false
+	}
+	return *session, true
+}
+
+// handlerUploadSessionGet reports which parts of the file the server has,
+// so a resuming client only sends the missing ones.
+func (cfg *apiConfig) handlerUploadSessionGet(w http.ResponseWriter, r *http.Request) {
+	session, ok := cfg.ownedUploadSession(w, r)
+	if !ok {
+		return
+	}
+	respondWithJSON(w, http.StatusOK, newUploadSessionResponse(session))
+}
+
+// handlerUploadSessionPartPut receives one part of the file as the raw
+// request body. Parts can be sent in any order, and sending a part again
+// replaces it.
+func (cfg *apiConfig) handlerUploadSessionPartPut(w http.ResponseWriter, r *http.Request) {
+	session, ok := cfg.ownedUploadSession(w, r)
+	if !ok {
+		return
+	}
+	number, err := strconv.ParseInt(r.PathValue("partNumber"), 10, 32)
+	if err != nil || number < 1 || int32(number) > uploadSessionPartCount(session) {
+		respondWithError(w, http.StatusBadRequest, "Invalid part number", err)
+		return
+	}
+	partRange := uploadSessionPartRange(session, int32(number))
+	size := partRange.End - partRange.Start + 1
+	if r.ContentLength != size {
+		respondWithErrorf(w, http.StatusBadRequest, nil, "Part %d must be %d bytes", number, size)
+		return
+	}
+
+	// The part is read into memory so S3 gets a body it can sign.
+	buf := make([]byte, size)
+	if _, err := io.ReadFull(http.MaxBytesReader(w, r.Body, size), buf); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Couldn't read request body", err)
+		return
+	}
+	input := &s3.UploadPartInput{
+		Bucket:        aws.String(cfg.s3Bucket),
+		Key:           aws.String(session.S3Key),
+		UploadId:      aws.String(session.S3UploadID),
+		PartNumber:    aws.Int32(int32(number)),
+		Body:          bytes.NewReader(buf),
+		ContentLength: aws.Int64(size),
+	}
+	// S3 rejects a part that doesn't match its Content-MD5, catching
+	// corruption on flaky mobile connections.
+	if md5 := r.Header.Get("Content-MD5"); md5 != "" {
+		input.ContentMD5 = aws.String(md5)
+	}
+	uploaded, err := cfg.s3Client.UploadPart(r.Context(), input)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't upload part", err)
+		return
+	}
+
+	part := database.UploadSessionPart{Number: int32(number), SizeBytes: size, ETag: aws.ToString(uploaded.ETag)}
+	if err := cfg.db.SetUploadSessionPart(session.Token, part); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't upload part", err)
+		return
+	}
+
+	updated, err := cfg.db.GetUploadSession(session.Token)
+	if err != nil || updated == nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get upload session", err)
+		return
+	}
+	respondWithJSON(w, http.StatusOK, newUploadSessionResponse(*updated))
+}
+
+// handlerUploadSessionComplete assembles the parts once they're all there
+// and processes the file like any other upload.
+func (cfg *apiConfig) handlerUploadSessionComplete(w http.ResponseWriter, r *http.Request) {
+	session, ok := cfg.ownedUploadSession(w, r)
+	if !ok {
+		return
+	}
+	if missing := newUploadSessionResponse(session).MissingParts; len(missing) > 0 {
+		respondWithErrorf(w, http.StatusConflict, nil, "Upload is missing %d parts", len(missing))
+		return
+	}
+
+	video, err := cfg.db.GetVideo(session.VideoID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't find video", err)
+		return
+	}
+	if !cfg.checkVideoAvailable(w, video.ID) {
+		return
+	}
+	// Taken before assembling, so a client told to wait can complete the
+	// session later.
+	release, ok := cfg.acquireUploadSlot(w, video.UserID)
+	if !ok {
+		return
+	}
+	defer release()
+
+	parts := make([]types.CompletedPart, 0, len(session.Parts))
+	for _, part := range session.Parts {
+		parts = append(parts, types.CompletedPart{PartNumber: aws.Int32(part.Number), ETag: aws.String(part.ETag)})
+	}
+	_, err = cfg.s3Client.CompleteMultipartUpload(r.Context(), &s3.CompleteMultipartUploadInput{
+		Bucket:          aws.String(cfg.s3Bucket),
+		Key:             aws.String(session.S3Key),
+		UploadId:        aws.String(session.S3UploadID),
+		MultipartUpload: &types.CompletedMultipartUpload{Parts: parts},
+	})
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't assemble upload", err)
+		return
+	}
+	if err := cfg.db.DeleteUploadSession(session.Token); err != nil {
+		log.Printf("Couldn't delete completed upload session for video %s: %v", video.ID, err)
+	}
+
+	cfg.processUploadedObject(w, r, video, session.S3Key, session.Quality)
+}
+
+// handlerUploadSessionDelete cancels an upload and discards its parts.
+func (cfg *apiConfig) handlerUploadSessionDelete(w http.ResponseWriter, r *http.Request) {
+	session, ok := cfg.ownedUploadSession(w, r)
+	if !ok {
+		return
+	}
+	if err := cfg.abortUploadSession(r.Context(), session); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't delete upload session", err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (cfg *apiConfig) abortUploadSession(ctx context.Context, session database.UploadSession) error {
+	_, err := cfg.s3Client.AbortMultipartUpload(ctx, &s3.AbortMultipartUploadInput{
+		Bucket:   aws.String(cfg.s3Bucket),
+		Key:      aws.String(session.S3Key),
+		UploadId: aws.String(session.S3UploadID),
+	})
+	var noSuchUpload *types.NoSuchUpload
+	if err != nil && !errors.As(err, &noSuchUpload) {
+		return err
+	}
+	return cfg.db.DeleteUploadSession(session.Token)
+}
+
+// runUploadSessionExpiry discards the parts of sessions that weren't
+// completed in time.
+func (cfg *apiConfig) runUploadSessionExpiry(ctx context.Context) error {
+	sessions, err := cfg.db.GetExpiredUploadSessions()
+	if err != nil {
+		return err
+	}
+	for _, session := range sessions {
+		if err := cfg.abortUploadSession(ctx, session); err != nil {
+			return err
+		}
+	}
+	if len(sessions) > 0 {
+		log.Printf("Discarded %d expired upload sessions", len(sessions))
+	}
+	return nil
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"net/http"
+	"sync"
+
+	"github.com/google/uuid"
+)
+
+// uploadSlots limits how many uploads each user has in flight at once, from
+// receiving the file until it's processed or handed to the transcoder, so
+// one user can't take up all the scratch disk and ffmpeg processes.
+type uploadSlots struct {
+	// perUser is the limit, 0 for none.
+	perUser int
+
+	mu       sync.Mutex
+	inFlight map[uuid.UUID]int
+}
+
+func newUploadSlots(perUser int) *uploadSlots {
+	return &uploadSlots{perUser: perUser, inFlight: map[uuid.UUID]int{}}
+}
+
+// acquire takes one of the user's slots. If they're all taken it returns
+// false, along with how many uploads the user has in flight.
+func (s *uploadSlots) acquire(userID uuid.UUID) (int, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	n := s.inFlight[userID]
+	if s.perUser > 0 && n >= s.perUser {
+		return n, false
+	}
+	s.inFlight[userID] = n + 1
+	return n + 1, true
+}
+
+func (s *uploadSlots) release(userID uuid.UUID) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.inFlight[userID] <= 1 {
+		delete(s.inFlight, userID)
+		return
+	}
+	s.inFlight[userID]--
+}
+
+// acquireUploadSlot takes one of the user's upload slots, or responds with
+// 429 and returns false when they're all taken. The caller releases the
+// slot once the upload is processed.
+func (cfg *apiConfig) acquireUploadSlot(w http.ResponseWriter, userID uuid.UUID) (release func(), ok bool) {
+	n, ok := cfg.uploadSlots.acquire(userID)
+	if !ok {
+		respondWithErrorf(w, http.StatusTooManyRequests, nil, "You have %d uploads in progress, wait for one to finish", n)
+		return nil, false
+	}
+	return func() { cfg.uploadSlots.release(userID) }, true
+}
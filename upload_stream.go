@@ -0,0 +1,125 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+)
+
+// maxVideoFormValuesSize bounds the fields sent along with a video file,
+// which are a few short values like quality.
+const maxVideoFormValuesSize = 64 << 10
+
+// videoForm is a video upload form read part by part rather than parsed
+// with ParseMultipartForm, which spools the whole file to disk before the
+// handler sees any of it.
+type videoForm struct {
+	// video is the "video" file part, read straight from the body.
+	video *multipart.Part
+	// values are the fields sent before the file. Fields after it aren't
+	// read, since the file may already be on its way to the bucket.
+	values url.Values
+	query  url.Values
+}
+
+// readVideoForm reads the request up to the start of its "video" file part,
+// keeping the fields before it. Other files are skipped. It returns
+// http.ErrMissingFile if there's no video.
+func readVideoForm(r *http.Request) (*videoForm, error) {
+	mr, err := r.MultipartReader()
+	if err != nil {
+		return nil, err
+	}
+	form := &videoForm{values: url.Values{}, query: r.URL.Query()}
+	left := int64(maxVideoFormValuesSize)
+	for {
+		part, err := mr.NextPart()
+		// Only a bare io.EOF is the end of the form. A wrapped one means
+		// the body was cut off.
+		if err == io.EOF {
+			return nil, http.ErrMissingFile
+		}
+		if err != nil {
+			return nil, err
+		}
+		if part.FormName() == "video" && part.FileName() != "" {
+			form.video = part
+			return form, nil
+		}
+		if part.FileName() != "" {
+			if _, err := io.Copy(io.Discard, part); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		value, err := io.ReadAll(io.LimitReader(part, left+1))
+		if err != nil {
+			return nil, err
+		}
+		left -= int64(len(value))
+		if left < 0 {
+			return nil, multipart.ErrMessageTooLarge
+		}
+		form.values.Add(part.FormName(), string(value))
+	}
+}
+
+// value is the named field, or the query parameter if there's no field, as
+// r.FormValue looks them up.
+func (f *videoForm) value(name string) string {
+	if vs, ok := f.values[name]; ok && len(vs) > 0 {
+		return vs[0]
+	}
+	return f.query.Get(name)
+}
+
+// uploadStream is a video file read from the request as it's uploaded to
+// the bucket, hashing it on the way, for uploads that don't need a local
+// copy to process.
+type uploadStream struct {
+	r    io.Reader
+	hash hash.Hash
+	read bool
+	// err is what failed reading the request, as opposed to writing to the
+	// bucket, which is the client's to hear about.
+	err error
+}
+
+func newUploadStream(r io.Reader) *uploadStream {
+	return &uploadStream{r: r, hash: sha256.New()}
+}
+
+func (s *uploadStream) Read(p []byte) (int, error) {
+	n, err := s.r.Read(p)
+	s.hash.Write(p[:n])
+	if err != nil && !errors.Is(err, io.EOF) {
+		s.err = err
+		return n, fmt.Errorf("couldn't read upload: %w", err)
+	}
+	return n, err
+}
+
+// contentHash is the hex SHA-256 of what was read, the whole file once
+// it's stored.
+func (s *uploadStream) contentHash() string {
+	return hex.EncodeToString(s.hash.Sum(nil))
+}
+
+// putStream uploads s as a new object at key, in parts, holding at most a
+// part in memory. Unlike a file it can only be read once, so a taken key
+// fails the upload rather than being retried with another, see
+// putNewObject.
+func (cfg *apiConfig) putStream(ctx context.Context, key, contentType string, tagging *string, s *uploadStream) (int64, error) {
+	if s.read {
+		return 0, fmt.Errorf("upload for %s was already read", key)
+	}
+	s.read = true
+	return cfg.putObjectStream(ctx, key, contentType, tagging, s)
+}
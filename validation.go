@@ -0,0 +1,137 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/notify"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/validate"
+	"github.com/google/uuid"
+)
+
+const (
+	maxTitleLength       = 200
+	maxDescriptionLength = 5000
+	minPasswordLength    = 8
+	// bcrypt silently ignores anything past 72 bytes.
+	maxPasswordBytes = 72
+	maxTokenLength   = 256
+
+	maxMetadataKeys        = 50
+	maxMetadataValueLength = 500
+
+	maxHTTPActionNameLength = 100
+	maxHTTPActionHeaders    = 20
+	maxHTTPActionTemplate   = 10000
+)
+
+func validateEmail(errs validate.Errors, email string) {
+	errs.Check(validate.Required(email), "email", "is required")
+	errs.Check(validate.Email(email), "email", "must be a valid email address")
+}
+
+// validateNewPassword applies to passwords being set, not to logins, so
+// accounts created before these rules can still sign in.
+func validateNewPassword(errs validate.Errors, password string) {
+	errs.Check(validate.MinLength(password, minPasswordLength), "password", "must be at least "+strconv.Itoa(minPasswordLength)+" characters")
+	errs.Check(len(password) <= maxPasswordBytes, "password", "must be at most "+strconv.Itoa(maxPasswordBytes)+" bytes")
+}
+
+func validateToken(errs validate.Errors, token string) {
+	errs.Check(validate.Required(token), "token", "is required")
+	errs.Check(len(token) <= maxTokenLength, "token", "is too long")
+}
+
+func validateVideoParams(errs validate.Errors, params database.CreateVideoParams) {
+	errs.Check(validate.Required(params.Title), "title", "is required")
+	errs.Check(validate.MaxLength(params.Title, maxTitleLength), "title", "must be at most "+strconv.Itoa(maxTitleLength)+" characters")
+	errs.Check(validate.MaxLength(params.Description, maxDescriptionLength), "description", "must be at most "+strconv.Itoa(maxDescriptionLength)+" characters")
+	validateMetadata(errs, params.Metadata)
+}
+
+func validateMetadata(errs validate.Errors, metadata map[string]string) {
+	errs.Check(len(metadata) <= maxMetadataKeys, "metadata", "must have at most "+strconv.Itoa(maxMetadataKeys)+" keys")
+	for key, value := range metadata {
+		errs.Check(database.ValidMetadataKey(key), "metadata", "has invalid key "+strconv.Quote(key)+", keys are lowercase letters, digits and underscores")
+		errs.Check(validate.MaxLength(value, maxMetadataValueLength), "metadata", "values must be at most "+strconv.Itoa(maxMetadataValueLength)+" characters")
+	}
+}
+
+func validateNotificationChannel(errs validate.Errors, params database.CreateNotificationChannelParams) {
+	errs.Check(validate.OneOf(params.Kind, "slack", "discord", "email"), "kind", "must be slack, discord or email")
+	switch params.Kind {
+	case "slack", "discord":
+		errs.Check(validate.HTTPSURL(params.Target), "target", "must be an https webhook URL")
+	case "email":
+		errs.Check(validate.Email(params.Target), "target", "must be an email address")
+	}
+
+	errs.Check(len(params.Events) > 0, "events", "must include at least one event")
+	for _, event := range params.Events {
+		errs.Check(validate.OneOf(notify.Event(event), notify.Events...), "events", "has unknown event "+strconv.Quote(event))
+	}
+}
+
+// sampleHTTPActionMessage is what actions are validated and tested with,
+// shaped like a video lifecycle event.
+func sampleHTTPActionMessage(event notify.Event) notify.Message {
+	return notify.Message{
+		Event: event,
+		Title: "Test action",
+		Text:  "This action is configured to run on Tubely events.",
+		Time:  time.Now().UTC(),
+		Data: videoEventData(database.Video{
+			ID: uuid.New(),
+			CreateVideoParams: database.CreateVideoParams{
+				Title:    "Sample video",
+				UserID:   uuid.New(),
+				Metadata: map[string]string{},
+			},
+		}),
+	}
+}
+
+func validateHTTPAction(errs validate.Errors, params database.CreateHTTPActionParams) {
+	errs.Check(validate.Required(params.Name), "name", "is required")
+	errs.Check(validate.MaxLength(params.Name, maxHTTPActionNameLength), "name", "must be at most "+strconv.Itoa(maxHTTPActionNameLength)+" characters")
+	errs.Check(len(params.Events) > 0, "events", "must include at least one event")
+	for _, event := range params.Events {
+		errs.Check(validate.OneOf(notify.Event(event), notify.Events...), "events", "has unknown event "+strconv.Quote(event))
+	}
+	errs.Check(validate.OneOf(params.Method, http.MethodGet, http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete),
+		"method", "must be GET, POST, PUT, PATCH or DELETE")
+	errs.Check(len(params.Headers) <= maxHTTPActionHeaders, "headers", "must have at most "+strconv.Itoa(maxHTTPActionHeaders)+" headers")
+	for name := range params.Headers {
+		errs.Check(validHeaderName(name), "headers", "has invalid header name "+strconv.Quote(name))
+	}
+	errs.Check(len(params.URL) <= maxHTTPActionTemplate, "url", "must be at most "+strconv.Itoa(maxHTTPActionTemplate)+" bytes")
+	errs.Check(len(params.Body) <= maxHTTPActionTemplate, "body", "must be at most "+strconv.Itoa(maxHTTPActionTemplate)+" bytes")
+
+	action, err := notify.ParseHTTPAction(params.Method, params.URL, params.Headers, params.Body)
+	if err != nil {
+		errs.Check(false, "template", err.Error())
+		return
+	}
+	// Rendering a sample catches templates that parse but can't produce a
+	// request, like a URL without a scheme.
+	_, err = action.Request(context.Background(), sampleHTTPActionMessage(notify.EventVideoCreated))
+	if err != nil {
+		errs.Check(false, "url", err.Error())
+	}
+}
+
+func validHeaderName(name string) bool {
+	if name == "" {
+		return false
+	}
+	for _, r := range name {
+		if !strings.ContainsRune("!#$%&'*+-.^_`|~", r) && !('a' <= r && r <= 'z') && !('A' <= r && r <= 'Z') && !('0' <= r && r <= '9') {
+			return false
+		}
+	}
+	return true
+}
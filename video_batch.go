@@ -0,0 +1,223 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/auth"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/validate"
+	"github.com/google/uuid"
+)
+
+const (
+	maxBatchVideos  = 100
+	maxVideoTags    = 20
+	maxVideoTagSize = 50
+)
+
+const (
+	batchActionPublish   = "publish"
+	batchActionUnpublish = "unpublish"
+	batchActionDelete    = "delete"
+	batchActionTag       = "tag"
+)
+
+// batchItemError is why one video of a batch failed, as it'd be reported
+// by the matching single-video endpoint.
+type batchItemError struct {
+	status int
+	msg    string
+	err    error
+}
+
+type batchResult struct {
+	VideoID uuid.UUID `json:"video_id"`
+	Status  int       `json:"status"`
+	// Error and Code are set for failed videos, Video for the others unless
+	// they were deleted, and Plan for deletes made as a dry run.
+	Error string          `json:"error,omitempty"`
+	Code  string          `json:"code,omitempty"`
+	Video *database.Video `json:"video,omitempty"`
+	Plan  *deletionPlan   `json:"plan,omitempty"`
+}
+
+type batchResponse struct {
+	DryRun    bool          `json:"dry_run,omitempty"`
+	Succeeded int           `json:"succeeded"`
+	Failed    int           `json:"failed"`
+	Results   []batchResult `json:"results"`
+}
+
+// normalizeTags lowercases and trims tags and drops duplicates.
+func normalizeTags(tags []string) []string {
+	normalized := []string{}
+	for _, tag := range tags {
+		tag = strings.ToLower(strings.TrimSpace(tag))
+		if !slices.Contains(normalized, tag) {
+			normalized = append(normalized, tag)
+		}
+	}
+	return normalized
+}
+
+func validateTags(errs validate.Errors, field string, tags []string) {
+	for _, tag := range tags {
+		errs.Check(validate.Required(tag), field, "can't contain empty tags")
+		errs.Check(!strings.Contains(tag, ","), field, "can't contain commas")
+		errs.Check(validate.MaxLength(tag, maxVideoTagSize), field, "must be at most "+strconv.Itoa(maxVideoTagSize)+" characters each")
+	}
+}
+
+// handlerVideosBatch applies one action to many of the caller's videos.
+// Each video is handled on its own, like the single-video endpoint would,
+// so some can fail while the rest succeed; the response reports every
+// video's outcome. Deletes can be made as a dry run with ?dry_run=true,
+// reporting what each would remove instead.
+func (cfg *apiConfig) handlerVideosBatch(w http.ResponseWriter, r *http.Request) {
+	type parameters struct {
+		Action     string      `json:"action"`
+		VideoIDs   []uuid.UUID `json:"video_ids"`
+		AddTags    []string    `json:"add_tags"`
+		RemoveTags []string    `json:"remove_tags"`
+	}
+
+	token, err := auth.GetBearerToken(r.Header)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Couldn't find JWT", err)
+		return
+	}
+	userID, err := cfg.validateJWT(token)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Couldn't validate JWT", err)
+		return
+	}
+
+	dryRun, err := parseDryRun(r)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "dry_run must be true or false", err)
+		return
+	}
+
+	params := parameters{}
+	if err := json.NewDecoder(r.Body).Decode(&params); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Couldn't decode parameters", err)
+		return
+	}
+	params.AddTags = normalizeTags(params.AddTags)
+	params.RemoveTags = normalizeTags(params.RemoveTags)
+
+	errs := validate.Errors{}
+	errs.Check(slices.Contains([]string{batchActionPublish, batchActionUnpublish, batchActionDelete, batchActionTag}, params.Action),
+		"action", "must be publish, unpublish, delete or tag")
+	errs.Check(len(params.VideoIDs) > 0, "video_ids", "is required")
+	errs.Check(len(params.VideoIDs) <= maxBatchVideos, "video_ids", "must have at most "+strconv.Itoa(maxBatchVideos)+" videos")
+	errs.Check(!dryRun || params.Action == batchActionDelete, "dry_run", "is only supported for delete")
+	if params.Action == batchActionTag {
+		errs.Check(len(params.AddTags)+len(params.RemoveTags) > 0, "add_tags", "is required")
+		validateTags(errs, "add_tags", params.AddTags)
+		validateTags(errs, "remove_tags", params.RemoveTags)
+	}
+	if errs.Err() != nil {
+		respondWithValidationErrors(w, errs)
+		return
+	}
+
+	ids := []uuid.UUID{}
+	for _, id := range params.VideoIDs {
+		if !slices.Contains(ids, id) {
+			ids = append(ids, id)
+		}
+	}
+	videos, err := cfg.db.GetVideosByIDs(ids)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get videos", err)
+		return
+	}
+
+	language := responseLanguage(w)
+	response := batchResponse{DryRun: dryRun, Results: make([]batchResult, 0, len(ids))}
+	for _, id := range ids {
+		video, ok := videos[id]
+		result := batchResult{VideoID: id, Status: http.StatusOK}
+		var itemErr *batchItemError
+		switch {
+		case !ok:
+			itemErr = &batchItemError{status: http.StatusNotFound, msg: "Couldn't get video"}
+		case video.UserID != userID:
+			itemErr = &batchItemError{status: http.StatusForbidden, msg: "Not authorized to update video"}
+		case dryRun:
+			plan, err := cfg.planVideoDeletion(r.Context(), video)
+			if err != nil {
+				itemErr = &batchItemError{status: http.StatusInternalServerError, msg: "Couldn't plan video deletion", err: err}
+			} else {
+				result.Plan = &plan
+			}
+		default:
+			itemErr = cfg.applyBatchAction(r.Context(), &video, params.Action, params.AddTags, params.RemoveTags)
+		}
+
+		switch {
+		case itemErr != nil:
+			if itemErr.err != nil {
+				log.Printf("Batch %s of video %s failed: %v", params.Action, id, itemErr.err)
+			}
+			result.Status = itemErr.status
+			result.Code, result.Error = errorMessages.Translate(language, itemErr.msg)
+			if result.Code == "" {
+				result.Code = errorCodeForStatus(itemErr.status)
+			}
+			response.Failed++
+		case dryRun:
+			response.Succeeded++
+		case params.Action == batchActionDelete:
+			result.Status = http.StatusNoContent
+			response.Succeeded++
+		default:
+			result.Video = &video
+			response.Succeeded++
+		}
+		response.Results = append(response.Results, result)
+	}
+	respondWithJSON(w, http.StatusOK, response)
+}
+
+// applyBatchAction applies action to one video, which the caller owns.
+func (cfg *apiConfig) applyBatchAction(ctx context.Context, video *database.Video, action string, addTags, removeTags []string) *batchItemError {
+	switch action {
+	case batchActionPublish:
+		if err := cfg.db.PublishVideo(video); err != nil {
+			return &batchItemError{status: http.StatusInternalServerError, msg: "Couldn't publish video", err: err}
+		}
+	case batchActionUnpublish:
+		if video.UnpublishedAt != nil {
+			return nil
+		}
+		if err := cfg.db.MarkVideoUnpublished(video); err != nil {
+			return &batchItemError{status: http.StatusInternalServerError, msg: "Couldn't unpublish video", err: err}
+		}
+	case batchActionDelete:
+		if err := cfg.purgeVideo(ctx, *video); err != nil {
+			return &batchItemError{status: http.StatusInternalServerError, msg: "Couldn't delete video", err: err}
+		}
+	case batchActionTag:
+		tags := []string{}
+		for _, tag := range append(video.Tags, addTags...) {
+			if !slices.Contains(removeTags, tag) && !slices.Contains(tags, tag) {
+				tags = append(tags, tag)
+			}
+		}
+		if len(tags) > maxVideoTags {
+			return &batchItemError{status: http.StatusUnprocessableEntity, msg: "Videos can have at most " + strconv.Itoa(maxVideoTags) + " tags"}
+		}
+		if err := cfg.db.SetVideoTags(video, tags); err != nil {
+			return &batchItemError{status: http.StatusInternalServerError, msg: "Couldn't tag video", err: err}
+		}
+	}
+	return nil
+}
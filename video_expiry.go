@@ -0,0 +1,136 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/auth"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/notify"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/validate"
+)
+
+// unpublishedMessage returns why viewers can't play the video, or "" if
+// they can. Expiry is checked whether or not the expiry job got to the
+// video yet.
+func unpublishedMessage(video database.Video) string {
+	if video.ExpiresAt != nil && !time.Now().Before(*video.ExpiresAt) {
+		return "This video has expired"
+	}
+	if video.UnpublishedAt != nil {
+		return "This video isn't published"
+	}
+	return ""
+}
+
+// checkVideoPublished responds with 410 and returns false if the video
+// expired or was unpublished and the caller isn't its owner.
+func (cfg *apiConfig) checkVideoPublished(w http.ResponseWriter, r *http.Request, video database.Video) bool {
+	msg := unpublishedMessage(video)
+	if msg == "" {
+		return true
+	}
+	if token, err := auth.GetBearerToken(r.Header); err == nil {
+		if userID, err := cfg.validateJWT(token); err == nil && userID == video.UserID {
+			return true
+		}
+	}
+	respondWithError(w, http.StatusGone, msg, nil)
+	return false
+}
+
+// handlerVideoExpirySet makes the video expire at expires_at, deleting it
+// then if purge is set.
+func (cfg *apiConfig) handlerVideoExpirySet(w http.ResponseWriter, r *http.Request) {
+	type parameters struct {
+		ExpiresAt *time.Time `json:"expires_at"`
+		Purge     bool       `json:"purge"`
+	}
+
+	video, ok := cfg.ownedVideo(w, r)
+	if !ok {
+		return
+	}
+
+	params := parameters{}
+	if err := json.NewDecoder(r.Body).Decode(&params); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Couldn't decode parameters", err)
+		return
+	}
+	errs := validate.Errors{}
+	errs.Check(params.ExpiresAt != nil, "expires_at", "is required")
+	if params.ExpiresAt != nil {
+		errs.Check(params.ExpiresAt.After(time.Now()), "expires_at", "must be in the future")
+	}
+	if errs.Err() != nil {
+		respondWithValidationErrors(w, errs)
+		return
+	}
+
+	if err := cfg.db.SetVideoExpiry(&video, params.ExpiresAt, params.Purge); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't set video expiry", err)
+		return
+	}
+	respondWithJSON(w, http.StatusOK, video)
+}
+
+// handlerVideoExpiryDelete keeps the video published indefinitely,
+// publishing it again if it already expired but wasn't purged.
+func (cfg *apiConfig) handlerVideoExpiryDelete(w http.ResponseWriter, r *http.Request) {
+	video, ok := cfg.ownedVideo(w, r)
+	if !ok {
+		return
+	}
+	if err := cfg.db.SetVideoExpiry(&video, nil, false); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't remove video expiry", err)
+		return
+	}
+	respondWithJSON(w, http.StatusOK, video)
+}
+
+// runVideoExpiry is the scheduled job unpublishing expired videos and
+// deleting those meant to be purged. A video failing to purge is retried on
+// the next run.
+func (cfg *apiConfig) runVideoExpiry(ctx context.Context) error {
+	videos, err := cfg.db.GetExpiredVideos(time.Now())
+	if err != nil {
+		return fmt.Errorf("couldn't get expired videos: %w", err)
+	}
+
+	failed := 0
+	for _, video := range videos {
+		if video.UnpublishedAt == nil {
+			if err := cfg.db.MarkVideoUnpublished(&video); err != nil {
+				return fmt.Errorf("couldn't unpublish video %s: %w", video.ID, err)
+			}
+		}
+		if !video.PurgeOnExpiry {
+			continue
+		}
+		if err := cfg.purgeVideo(ctx, video); err != nil {
+			log.Printf("Couldn't purge expired video %s: %v", video.ID, err)
+			failed++
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("couldn't purge %d of %d expired videos", failed, len(videos))
+	}
+	return nil
+}
+
+// purgeVideo deletes the video and all of its objects.
+func (cfg *apiConfig) purgeVideo(ctx context.Context, video database.Video) error {
+	if err := cfg.deleteVideoObjects(ctx, video.UserID, video.ID); err != nil {
+		return err
+	}
+	if err := cfg.db.DeleteVideo(video.ID); err != nil {
+		return err
+	}
+	cfg.recordStorageUsage(video.UserID)
+	cfg.notify(notify.EventVideoDeleted, "Video deleted", fmt.Sprintf("Video %s was deleted", video.ID), videoEventData(video))
+	return nil
+}
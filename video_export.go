@@ -0,0 +1,142 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/auth"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/validate"
+)
+
+var videoExportCSVHeader = []string{
+	"id", "title", "description", "created_at", "updated_at", "published_at",
+	"duration_ms", "size_bytes", "views", "delivered_bytes", "tags",
+	"password_protected", "downloads_enabled", "expires_at", "unpublished_at",
+}
+
+// csvCell keeps spreadsheets from running a title like "=HYPERLINK(...)" as
+// a formula.
+func csvCell(s string) string {
+	if s != "" && strings.ContainsRune("=+-@\t\r", rune(s[0])) {
+		return "'" + s
+	}
+	return s
+}
+
+func csvTime(t *time.Time) string {
+	if t == nil {
+		return ""
+	}
+	return t.UTC().Format(time.RFC3339)
+}
+
+func videoExportCSVRow(video database.VideoExport) []string {
+	return []string{
+		video.ID.String(),
+		csvCell(video.Title),
+		csvCell(video.Description),
+		csvTime(&video.CreatedAt),
+		csvTime(&video.UpdatedAt),
+		csvTime(video.PublishedAt),
+		strconv.FormatInt(video.DurationMS, 10),
+		strconv.FormatInt(video.SizeBytes, 10),
+		strconv.FormatInt(video.Views, 10),
+		strconv.FormatInt(video.DeliveredBytes, 10),
+		csvCell(strings.Join(video.Tags, ",")),
+		strconv.FormatBool(video.PasswordProtected),
+		strconv.FormatBool(video.DownloadsEnabled),
+		csvTime(video.ExpiresAt),
+		csvTime(video.UnpublishedAt),
+	}
+}
+
+// exportWriter remembers whether any of the export reached the client yet,
+// since until then a failure can still get an error response.
+type exportWriter struct {
+	http.ResponseWriter
+	started bool
+}
+
+func (w *exportWriter) Write(b []byte) (int, error) {
+	w.started = true
+	return w.ResponseWriter.Write(b)
+}
+
+// handlerVideosExport downloads the caller's whole catalog as CSV or JSON,
+// written while it's read from the database. Once the first row is out the
+// status can't change, so a failure after that only cuts the file short.
+func (cfg *apiConfig) handlerVideosExport(w http.ResponseWriter, r *http.Request) {
+	token, err := auth.GetBearerToken(r.Header)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Couldn't find JWT", err)
+		return
+	}
+	userID, err := cfg.validateJWT(token)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Couldn't validate JWT", err)
+		return
+	}
+
+	format := r.URL.Query().Get("format")
+	if format == "" {
+		format = "csv"
+	}
+	if format != "csv" && format != "json" {
+		respondWithValidationErrors(w, validate.Errors{"format": "must be csv or json"})
+		return
+	}
+
+	out := &exportWriter{ResponseWriter: w}
+	filename := fmt.Sprintf("videos-%s.%s", time.Now().UTC().Format("2006-01-02"), format)
+	w.Header().Set("Content-Disposition", `attachment; filename="`+filename+`"`)
+	w.Header().Set("Cache-Control", "private, no-store")
+
+	switch format {
+	case "csv":
+		w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+		writer := csv.NewWriter(out)
+		err = writer.Write(videoExportCSVHeader)
+		if err != nil {
+			break
+		}
+		err = cfg.db.ExportVideos(userID, func(video database.VideoExport) error {
+			return writer.Write(videoExportCSVRow(video))
+		})
+		if err == nil {
+			writer.Flush()
+			err = writer.Error()
+		}
+	case "json":
+		w.Header().Set("Content-Type", "application/json")
+		encoder := json.NewEncoder(out)
+		separator := "["
+		err = cfg.db.ExportVideos(userID, func(video database.VideoExport) error {
+			if _, err := fmt.Fprint(out, separator); err != nil {
+				return err
+			}
+			separator = ","
+			return encoder.Encode(video)
+		})
+		if err == nil {
+			if separator == "[" {
+				fmt.Fprint(out, "[")
+			}
+			fmt.Fprintln(out, "]")
+		}
+	}
+	if err != nil && !out.started {
+		w.Header().Del("Content-Disposition")
+		respondWithError(w, http.StatusInternalServerError, "Couldn't export videos", err)
+		return
+	}
+	if err != nil {
+		log.Printf("Couldn't finish exporting videos of user %s: %v", userID, err)
+	}
+}
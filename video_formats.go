@@ -0,0 +1,82 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"slices"
+	"strings"
+)
+
+// defaultAcceptedVideoTypes are the video types uploads may have unless
+// ACCEPTED_VIDEO_TYPES says otherwise.
+var defaultAcceptedVideoTypes = []string{"video/mp4", "video/quicktime", "video/webm", "video/x-matroska"}
+
+// passthroughVideoTypes are browser-safe formats that are stored as
+// uploaded. Every other type is converted to MP4 with ffmpeg.
+var passthroughVideoTypes = map[string]bool{
+	"video/webm": true,
+}
+
+// acceptedVideoTypesFromEnv reads ACCEPTED_VIDEO_TYPES, a comma-separated
+// list of video types ffmpeg can convert.
+func acceptedVideoTypesFromEnv() ([]string, error) {
+	v := os.Getenv("ACCEPTED_VIDEO_TYPES")
+	if v == "" {
+		return defaultAcceptedVideoTypes, nil
+	}
+	types := []string{}
+	for _, t := range strings.Split(v, ",") {
+		t = strings.ToLower(strings.TrimSpace(t))
+		if t == "" {
+			continue
+		}
+		if !slices.Contains(defaultAcceptedVideoTypes, t) {
+			return nil, fmt.Errorf("unsupported video type %q, expected some of %s", t, strings.Join(defaultAcceptedVideoTypes, ", "))
+		}
+		types = append(types, t)
+	}
+	if len(types) == 0 {
+		return nil, fmt.Errorf("no video types in %q", v)
+	}
+	return types, nil
+}
+
+// checkVideoType returns the error to respond with if uploads can't have
+// mediaType.
+func (cfg *apiConfig) checkVideoType(mediaType string) *uploadError {
+	if slices.Contains(cfg.acceptedVideoTypes, mediaType) {
+		return nil
+	}
+	return &uploadError{status: http.StatusBadRequest, format: "Invalid media type, accepted types are %s", args: []any{strings.Join(cfg.acceptedVideoTypes, ", ")}}
+}
+
+// storedVideoType is the type an upload of mediaType is stored as.
+func storedVideoType(mediaType string) string {
+	if passthroughVideoTypes[mediaType] {
+		return mediaType
+	}
+	return "video/mp4"
+}
+
+// mp4CodecArgs are the ffmpeg options converting an upload of mediaType,
+// probed as probe, to MP4. MP4s only get remuxed. Other containers have
+// their video copied when it's a codec browsers play from an MP4, and
+// transcoded to H.264 otherwise, while their audio, often in a codec MP4
+// players don't take, is transcoded to AAC. Streams beyond the first video
+// and audio, like subtitles and attachments in MKVs, are dropped.
+func mp4CodecArgs(mediaType string, probe videoProbe) []string {
+	if mediaType == "video/mp4" {
+		return []string{"-c", "copy"}
+	}
+	args := []string{"-map", "0:v:0", "-map", "0:a:0?", "-c:a", "aac"}
+	switch probe.Codec {
+	case "h264":
+		return append(args, "-c:v", "copy")
+	case "hevc":
+		// Safari only plays HEVC in MP4 tagged hvc1, while phones record
+		// hev1.
+		return append(args, "-c:v", "copy", "-tag:v", "hvc1")
+	}
+	return append(args, "-c:v", "libx264", "-preset", "veryfast", "-crf", "23", "-pix_fmt", "yuv420p")
+}
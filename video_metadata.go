@@ -0,0 +1,76 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/validate"
+)
+
+// metadataFilterPrefix starts the query parameters that filter video
+// listings by metadata, like ?metadata.course_id=cs101.
+const metadataFilterPrefix = "metadata."
+
+// parseMetadataIndexKeys reads the comma separated METADATA_INDEXED_KEYS.
+func parseMetadataIndexKeys(s string) []string {
+	keys := []string{}
+	for _, key := range strings.Split(s, ",") {
+		key = strings.TrimSpace(key)
+		if key != "" {
+			keys = append(keys, key)
+		}
+	}
+	return keys
+}
+
+// parseMetadataFilter reads the metadata filters of a listing. Only indexed
+// keys can be filtered on, so a listing never has to read every video's
+// metadata; it responds itself when a key isn't.
+func (cfg *apiConfig) parseMetadataFilter(w http.ResponseWriter, query url.Values) (database.VideoFilter, bool) {
+	filter := database.VideoFilter{}
+	for param, values := range query {
+		key, ok := strings.CutPrefix(param, metadataFilterPrefix)
+		if !ok {
+			continue
+		}
+		if !cfg.metadataIndexKeys[key] {
+			respondWithErrorf(w, http.StatusBadRequest, nil, "Metadata key %q isn't indexed for filtering", key)
+			return database.VideoFilter{}, false
+		}
+		if filter.Metadata == nil {
+			filter.Metadata = map[string]string{}
+		}
+		filter.Metadata[key] = values[0]
+	}
+	return filter, true
+}
+
+// handlerVideoMetadataSet replaces the video's metadata with the JSON
+// object of strings in the body.
+func (cfg *apiConfig) handlerVideoMetadataSet(w http.ResponseWriter, r *http.Request) {
+	video, ok := cfg.ownedVideo(w, r)
+	if !ok {
+		return
+	}
+
+	metadata := map[string]string{}
+	if err := json.NewDecoder(r.Body).Decode(&metadata); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Couldn't decode parameters", err)
+		return
+	}
+	errs := validate.Errors{}
+	validateMetadata(errs, metadata)
+	if errs.Err() != nil {
+		respondWithValidationErrors(w, errs)
+		return
+	}
+
+	if err := cfg.db.SetVideoMetadata(&video, metadata); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't update video metadata", err)
+		return
+	}
+	respondWithJSON(w, http.StatusOK, video)
+}
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"encoding/json"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/auth"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/validate"
+	"github.com/google/uuid"
+)
+
+// videoPasswordHeader carries a password-protected video's password, so
+// viewers without an account can play it.
+const videoPasswordHeader = "X-Video-Password"
+
+// videoPasswordRetryAfter reports how long the address has to wait before
+// trying another password for the video, using the same backoff as logins.
+func (cfg *apiConfig) videoPasswordRetryAfter(videoID uuid.UUID, ip string) (time.Duration, error) {
+	now := time.Now().UTC()
+	failures, err := cfg.db.GetVideoPasswordFailures(videoID, ip, now.Add(-loginAttemptWindow))
+	if err != nil {
+		return 0, err
+	}
+	if failures.Count == 0 {
+		return 0, nil
+	}
+	wait := failures.LastFailureAt.Add(loginDelay(failures.Count, loginLockoutAttempts)).Sub(now)
+	if wait < 0 {
+		return 0, nil
+	}
+	return wait, nil
+}
+
+// checkVideoPassword lets the request through if the video has no password,
+// the caller owns it or the request carries the password. Otherwise it
+// responds with 401, or 429 after too many wrong passwords, and returns
+// false.
+func (cfg *apiConfig) checkVideoPassword(w http.ResponseWriter, r *http.Request, video database.Video) bool {
+	if !video.PasswordProtected {
+		return true
+	}
+	if token, err := auth.GetBearerToken(r.Header); err == nil {
+		if userID, err := cfg.validateJWT(token); err == nil && userID == video.UserID {
+			return true
+		}
+	}
+	password := r.Header.Get(videoPasswordHeader)
+	if password == "" {
+		respondWithError(w, http.StatusUnauthorized, "This video is password protected", nil)
+		return false
+	}
+
+	ip := clientIP(r)
+	retryAfter, err := cfg.videoPasswordRetryAfter(video.ID, ip)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't check password attempts", err)
+		return false
+	}
+	if retryAfter > 0 {
+		w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(retryAfter.Seconds()))))
+		respondWithError(w, http.StatusTooManyRequests, "Too many incorrect passwords, try again later", nil)
+		return false
+	}
+
+	hash, err := cfg.db.GetVideoPasswordHash(video.ID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get video", err)
+		return false
+	}
+	if hash != "" && auth.CheckPasswordHash(password, hash) != nil {
+		if err := cfg.db.RecordVideoPasswordFailure(video.ID, ip); err != nil {
+			respondWithError(w, http.StatusInternalServerError, "Couldn't record password attempt", err)
+			return false
+		}
+		respondWithError(w, http.StatusUnauthorized, "Incorrect video password", nil)
+		return false
+	}
+	// Responses unlocked by a password mustn't be served to anyone else.
+	w.Header().Set("Cache-Control", "private, no-store")
+	return true
+}
+
+// handlerVideoPasswordSet sets or replaces the password viewers need to
+// play the video.
+func (cfg *apiConfig) handlerVideoPasswordSet(w http.ResponseWriter, r *http.Request) {
+	type parameters struct {
+		Password string `json:"password"`
+	}
+
+	video, ok := cfg.ownedVideo(w, r)
+	if !ok {
+		return
+	}
+
+	params := parameters{}
+	if err := json.NewDecoder(r.Body).Decode(&params); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Couldn't decode parameters", err)
+		return
+	}
+	errs := validate.Errors{}
+	validateNewPassword(errs, params.Password)
+	if errs.Err() != nil {
+		respondWithValidationErrors(w, errs)
+		return
+	}
+
+	hash, err := auth.HashPassword(params.Password)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't hash password", err)
+		return
+	}
+	if err := cfg.db.SetVideoPassword(&video, hash); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't set video password", err)
+		return
+	}
+	respondWithJSON(w, http.StatusOK, video)
+}
+
+// handlerVideoPasswordDelete makes the video playable without a password
+// again.
+func (cfg *apiConfig) handlerVideoPasswordDelete(w http.ResponseWriter, r *http.Request) {
+	video, ok := cfg.ownedVideo(w, r)
+	if !ok {
+		return
+	}
+	if err := cfg.db.SetVideoPassword(&video, ""); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't remove video password", err)
+		return
+	}
+	respondWithJSON(w, http.StatusOK, video)
+}
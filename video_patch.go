@@ -0,0 +1,180 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"mime"
+	"net/http"
+	"strconv"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/validate"
+)
+
+const (
+	mergePatchContentType = "application/merge-patch+json"
+	// maxPatchAttempts is how many times a patch is applied when the video
+	// keeps changing underneath it.
+	maxPatchAttempts = 3
+)
+
+// readOnlyVideoFields are the video's fields a patch can't change, since
+// they're derived or have endpoints of their own.
+var readOnlyVideoFields = map[string]bool{
+	"id":                 true,
+	"created_at":         true,
+	"updated_at":         true,
+	"published_at":       true,
+	"video_url":          true,
+	"size_bytes":         true,
+	"user_id":            true,
+	"password_protected": true,
+	"expires_at":         true,
+	"purge_on_expiry":    true,
+	"unpublished_at":     true,
+}
+
+// isJSONNull reports whether a member of a patch is null, which removes
+// the field rather than setting it.
+func isJSONNull(raw json.RawMessage) bool {
+	return bytes.Equal(bytes.TrimSpace(raw), []byte("null"))
+}
+
+// applyVideoPatch applies an RFC 7386 merge patch to video. Fields left
+// out of the patch are kept, and null clears the fields that can be empty:
+// description, thumbnail_url, tags and metadata. metadata is merged key by
+// key, with null removing a key. It reports fields of the wrong type, or
+// that can't be patched, in errs.
+func applyVideoPatch(errs validate.Errors, video *database.Video, patch map[string]json.RawMessage) {
+	for field, raw := range patch {
+		null := isJSONNull(raw)
+		switch field {
+		case "title":
+			errs.Check(!null, field, "can't be null")
+			if !null {
+				errs.Check(json.Unmarshal(raw, &video.Title) == nil, field, "must be a string")
+			}
+		case "description":
+			video.Description = ""
+			if !null {
+				errs.Check(json.Unmarshal(raw, &video.Description) == nil, field, "must be a string or null")
+			}
+		case "thumbnail_url":
+			// Thumbnails are uploaded, so the URL can only be cleared.
+			errs.Check(null, field, "can only be null, upload thumbnails to /api/thumbnail_upload/{videoID}")
+			video.ThumbnailURL = nil
+		case "tags":
+			tags := []string{}
+			if !null {
+				errs.Check(json.Unmarshal(raw, &tags) == nil, field, "must be an array of strings or null")
+			}
+			video.Tags = normalizeTags(tags)
+			errs.Check(len(video.Tags) <= maxVideoTags, field, "must have at most "+strconv.Itoa(maxVideoTags)+" tags")
+			validateTags(errs, field, video.Tags)
+		case "metadata":
+			if null {
+				video.Metadata = map[string]string{}
+				continue
+			}
+			values := map[string]*string{}
+			if json.Unmarshal(raw, &values) != nil {
+				errs.Check(false, field, "must be an object of strings or null")
+				continue
+			}
+			metadata := map[string]string{}
+			for key, value := range video.Metadata {
+				metadata[key] = value
+			}
+			for key, value := range values {
+				if value == nil {
+					delete(metadata, key)
+					continue
+				}
+				metadata[key] = *value
+			}
+			video.Metadata = metadata
+		case "downloads_enabled":
+			errs.Check(!null && json.Unmarshal(raw, &video.DownloadsEnabled) == nil, field, "must be true or false")
+		default:
+			if readOnlyVideoFields[field] {
+				errs.Check(false, field, "can't be changed with a patch")
+			} else {
+				errs.Check(false, field, "isn't a video field")
+			}
+		}
+	}
+	validateVideoParams(errs, video.CreateVideoParams)
+}
+
+// handlerVideoPatch updates the fields of the video that the JSON merge
+// patch in the body has, leaving the rest as they are. The patch is applied
+// to the video as it's stored when the update is saved: if the video
+// changes meanwhile it's applied again, or with If-Unmodified-Since, the
+// request fails with 412.
+func (cfg *apiConfig) handlerVideoPatch(w http.ResponseWriter, r *http.Request) {
+	video, ok := cfg.ownedVideo(w, r)
+	if !ok {
+		return
+	}
+	if !checkUnmodifiedSince(w, r, video) {
+		return
+	}
+
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if mediaType != mergePatchContentType {
+		w.Header().Set("Accept-Patch", mergePatchContentType)
+		respondWithError(w, http.StatusUnsupportedMediaType, "Content-Type must be application/merge-patch+json", nil)
+		return
+	}
+	// A merge patch that isn't an object replaces the whole resource,
+	// which a video can't be.
+	patch := map[string]json.RawMessage{}
+	if err := json.NewDecoder(r.Body).Decode(&patch); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Couldn't decode parameters", err)
+		return
+	}
+
+	for attempt := 1; ; attempt++ {
+		errs := validate.Errors{}
+		applyVideoPatch(errs, &video, patch)
+		if errs.Err() != nil {
+			respondWithValidationErrors(w, errs)
+			return
+		}
+
+		err := cfg.db.PatchVideo(&video)
+		if err == nil {
+			break
+		}
+		if !errors.Is(err, database.ErrVideoModified) {
+			respondWithError(w, http.StatusInternalServerError, "Couldn't update video information", err)
+			return
+		}
+		if r.Header.Get("If-Unmodified-Since") != "" || attempt == maxPatchAttempts {
+			respondWithError(w, http.StatusPreconditionFailed, "Video was modified during the update", err)
+			return
+		}
+		video, err = cfg.db.GetVideo(video.ID)
+		if err != nil {
+			respondWithError(w, http.StatusInternalServerError, "Couldn't find video", err)
+			return
+		}
+	}
+
+	// A cleared thumbnail stays cleared, so drop the generated one along
+	// with any still being generated.
+	if _, ok := patch["thumbnail_url"]; ok {
+		if err := cfg.db.CancelThumbnailJob(video.ID); err != nil {
+			respondWithError(w, http.StatusInternalServerError, "Couldn't update video information", err)
+			return
+		}
+		if err := cfg.replaceArtifacts(r.Context(), video.ID, database.ArtifactKindThumbnail, nil); err != nil {
+			respondWithError(w, http.StatusInternalServerError, "Couldn't update video information", err)
+			return
+		}
+	}
+
+	setLastModified(w, video)
+	respondWithJSON(w, http.StatusOK, video)
+}
@@ -0,0 +1,574 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/csv"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/auth"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/validate"
+	"github.com/google/uuid"
+)
+
+const (
+	importSourceYouTube = "youtube"
+
+	// maxImportLimit caps the whole import request, files included.
+	maxImportLimit        = 20 << 30
+	maxImportMetadataSize = 10 << 20
+	maxImportVideos       = 500
+
+	// importInterruptedMessage fails the videos an import didn't get to
+	// before the server stopped.
+	importInterruptedMessage = "The import was interrupted by a server restart"
+)
+
+// takeoutVideo is one video listed in a YouTube Takeout export, or found in
+// an email sent to the app.
+type takeoutVideo struct {
+	id          string
+	title       string
+	description string
+	tags        []string
+	publishedAt *time.Time
+	// fileURL is where to download the video from when its file isn't part
+	// of the import request.
+	fileURL string
+	// draft videos are unpublished until their owner publishes them.
+	draft bool
+}
+
+// parseTakeoutMetadata reads the video metadata of a Takeout export: the
+// videos.csv of newer exports, or the JSON of older ones, which is a list
+// of videos shaped like YouTube Data API resources.
+func parseTakeoutMetadata(data []byte) ([]takeoutVideo, error) {
+	data = bytes.TrimPrefix(bytes.TrimSpace(data), []byte("\ufeff"))
+	if len(data) > 0 && (data[0] == '[' || data[0] == '{') {
+		return parseTakeoutJSON(data)
+	}
+	return parseTakeoutCSV(data)
+}
+
+func parseTakeoutJSON(data []byte) ([]takeoutVideo, error) {
+	type jsonVideo struct {
+		ID      string `json:"id"`
+		Snippet struct {
+			Title       string     `json:"title"`
+			Description string     `json:"description"`
+			Tags        []string   `json:"tags"`
+			PublishedAt *time.Time `json:"publishedAt"`
+		} `json:"snippet"`
+		FileURL string `json:"file_url"`
+	}
+
+	var items []jsonVideo
+	if data[0] == '{' {
+		var list struct {
+			Items []jsonVideo `json:"items"`
+		}
+		if err := json.Unmarshal(data, &list); err != nil {
+			return nil, err
+		}
+		items = list.Items
+	} else if err := json.Unmarshal(data, &items); err != nil {
+		return nil, err
+	}
+
+	videos := make([]takeoutVideo, 0, len(items))
+	for _, item := range items {
+		if item.ID == "" {
+			return nil, errors.New("video without an id")
+		}
+		videos = append(videos, takeoutVideo{
+			id:          item.ID,
+			title:       item.Snippet.Title,
+			description: item.Snippet.Description,
+			tags:        item.Snippet.Tags,
+			publishedAt: item.Snippet.PublishedAt,
+			fileURL:     item.FileURL,
+		})
+	}
+	return videos, nil
+}
+
+func parseTakeoutCSV(data []byte) ([]takeoutVideo, error) {
+	reader := csv.NewReader(bytes.NewReader(data))
+	reader.FieldsPerRecord = -1
+	records, err := reader.ReadAll()
+	if err != nil {
+		return nil, err
+	}
+	if len(records) == 0 {
+		return nil, errors.New("no header row")
+	}
+
+	columns := map[string]int{}
+	for i, name := range records[0] {
+		columns[strings.ToLower(strings.TrimSpace(name))] = i
+	}
+	// Takeout's column names, falling back to plainer ones for hand-made
+	// files.
+	column := func(record []string, names ...string) string {
+		for _, name := range names {
+			if i, ok := columns[name]; ok && i < len(record) {
+				return strings.TrimSpace(record[i])
+			}
+		}
+		return ""
+	}
+	if _, ok := columns["video id"]; !ok {
+		return nil, errors.New("no Video ID column")
+	}
+
+	videos := make([]takeoutVideo, 0, len(records)-1)
+	for n, record := range records[1:] {
+		video := takeoutVideo{
+			id:          column(record, "video id"),
+			title:       column(record, "video title (original)", "video title", "title"),
+			description: column(record, "video description (original)", "video description", "description"),
+			fileURL:     column(record, "file url"),
+		}
+		if video.id == "" {
+			return nil, fmt.Errorf("row %d has no video ID", n+2)
+		}
+		if tags := column(record, "video tags", "tags"); tags != "" {
+			video.tags = strings.Split(tags, ",")
+		}
+		if published := column(record, "video publish timestamp", "published at"); published != "" {
+			t, err := time.Parse(time.RFC3339, published)
+			if err != nil {
+				return nil, fmt.Errorf("row %d: %w", n+2, err)
+			}
+			video.publishedAt = &t
+		}
+		videos = append(videos, video)
+	}
+	return videos, nil
+}
+
+// importTags keeps the tags a Tubely video can have, dropping the rest
+// rather than failing the video over them.
+func importTags(tags []string) []string {
+	kept := []string{}
+	for _, tag := range normalizeTags(tags) {
+		if tag == "" || strings.Contains(tag, ",") || !validate.MaxLength(tag, maxVideoTagSize) {
+			continue
+		}
+		if len(kept) == maxVideoTags {
+			break
+		}
+		kept = append(kept, tag)
+	}
+	return kept
+}
+
+// importFile is a video file staged on disk for an import.
+type importFile struct {
+	path      string
+	mediaType string
+}
+
+// importMediaType is the media type of a file from its Content-Type, or
+// from its name when that's missing or generic.
+func importMediaType(contentType, name string) string {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err == nil && mediaType != "application/octet-stream" {
+		return mediaType
+	}
+	mediaType, _, _ = mime.ParseMediaType(mime.TypeByExtension(strings.ToLower(path.Ext(name))))
+	return mediaType
+}
+
+// stageImportFile copies r into a new file in dir, failing if it's over
+// maxUploadLimit.
+func stageImportFile(dir string, r io.Reader) (string, error) {
+	f, err := os.CreateTemp(dir, "video_*")
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	n, err := io.Copy(f, io.LimitReader(r, maxUploadLimit+1))
+	if err != nil {
+		return "", err
+	}
+	if n > maxUploadLimit {
+		return "", errImportFileTooLarge
+	}
+	return f.Name(), nil
+}
+
+var errImportFileTooLarge = errors.New("file is over the upload limit")
+
+// importHTTPClient downloads the files of an import from the URLs in its
+// metadata. It refuses to connect to private addresses, so imports can't be
+// used to reach services on the server's network.
+var importHTTPClient = &http.Client{
+	Transport: &http.Transport{
+		DialContext: (&net.Dialer{
+			Timeout: 30 * time.Second,
+			Control: publicAddressesOnly,
+		}).DialContext,
+		TLSHandshakeTimeout:   10 * time.Second,
+		ResponseHeaderTimeout: 30 * time.Second,
+	},
+}
+
+func publicAddressesOnly(network, address string, _ syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	ip := net.ParseIP(host)
+	if ip == nil || ip.IsLoopback() || ip.IsPrivate() || ip.IsUnspecified() ||
+		ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() || ip.IsMulticast() {
+		return fmt.Errorf("%s isn't a public address", host)
+	}
+	return nil
+}
+
+func downloadImportFile(ctx context.Context, dir, fileURL string) (importFile, *uploadError) {
+	if !validate.HTTPSURL(fileURL) {
+		return importFile{}, &uploadError{status: http.StatusUnprocessableEntity, format: "File URLs must be https"}
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, fileURL, nil)
+	if err != nil {
+		return importFile{}, &uploadError{status: http.StatusUnprocessableEntity, format: "Couldn't download the video file", err: err}
+	}
+	resp, err := importHTTPClient.Do(req)
+	if err != nil {
+		return importFile{}, &uploadError{status: http.StatusBadGateway, format: "Couldn't download the video file", err: err}
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return importFile{}, &uploadError{status: http.StatusBadGateway, format: "Couldn't download the video file", err: fmt.Errorf("GET %s: %s", fileURL, resp.Status)}
+	}
+	if resp.ContentLength > maxUploadLimit {
+		return importFile{}, &uploadError{status: http.StatusRequestEntityTooLarge, format: "Video file is too large"}
+	}
+
+	filePath, err := stageImportFile(dir, resp.Body)
+	if errors.Is(err, errImportFileTooLarge) {
+		return importFile{}, &uploadError{status: http.StatusRequestEntityTooLarge, format: "Video file is too large"}
+	}
+	if err != nil {
+		return importFile{}, &uploadError{status: http.StatusBadGateway, format: "Couldn't download the video file", err: err}
+	}
+	u, _ := url.Parse(fileURL)
+	return importFile{path: filePath, mediaType: importMediaType(resp.Header.Get("Content-Type"), u.Path)}, nil
+}
+
+// handlerVideoImportCreate starts importing videos from a YouTube Takeout
+// export: a multipart form with the metadata file as "metadata" and any
+// number of video files as "files". Files are matched to videos by name,
+// since Takeout names them after the video's ID or title; videos without
+// one are downloaded from their file URL instead. The import runs in the
+// background and is reported by handlerVideoImportGet.
+func (cfg *apiConfig) handlerVideoImportCreate(w http.ResponseWriter, r *http.Request) {
+	token, err := auth.GetBearerToken(r.Header)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Couldn't find JWT", err)
+		return
+	}
+	userID, err := cfg.validateJWT(token)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Couldn't validate JWT", err)
+		return
+	}
+
+	running, err := cfg.db.HasRunningVideoImport(userID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't check imports", err)
+		return
+	}
+	if running {
+		respondWithError(w, http.StatusConflict, "An import is already running", nil)
+		return
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, maxImportLimit)
+	reader, err := r.MultipartReader()
+	if err != nil {
+		respondWithFormError(w, err)
+		return
+	}
+
+	dir, err := os.MkdirTemp("", "tubely-import_*")
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Issue creating temp file", err)
+		return
+	}
+	started := false
+	defer func() {
+		if !started {
+			os.RemoveAll(dir)
+		}
+	}()
+
+	var metadata []byte
+	// files are keyed by file name without the extension.
+	files := map[string]importFile{}
+	for {
+		part, err := reader.NextPart()
+		// A wrapped io.EOF is a body that was cut off.
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			respondWithFormError(w, err)
+			return
+		}
+		switch part.FormName() {
+		case "metadata":
+			metadata, err = io.ReadAll(io.LimitReader(part, maxImportMetadataSize+1))
+			if err != nil {
+				respondWithFormError(w, err)
+				return
+			}
+			if len(metadata) > maxImportMetadataSize {
+				respondWithValidationErrors(w, validate.Errors{"metadata": "is too long"})
+				return
+			}
+		case "files":
+			name := filepath.Base(part.FileName())
+			filePath, err := stageImportFile(dir, part)
+			if errors.Is(err, errImportFileTooLarge) {
+				respondWithValidationErrors(w, validate.Errors{"files": "must be at most 1GB each"})
+				return
+			}
+			if err != nil {
+				respondWithFormError(w, err)
+				return
+			}
+			files[strings.TrimSuffix(name, filepath.Ext(name))] = importFile{
+				path:      filePath,
+				mediaType: importMediaType(part.Header.Get("Content-Type"), name),
+			}
+		}
+		part.Close()
+	}
+
+	if metadata == nil {
+		respondWithValidationErrors(w, validate.Errors{"metadata": "is required"})
+		return
+	}
+	videos, err := parseTakeoutMetadata(metadata)
+	if err != nil {
+		respondWithValidationErrors(w, validate.Errors{"metadata": "must be a YouTube Takeout JSON or CSV file"})
+		return
+	}
+	errs := validate.Errors{}
+	errs.Check(len(videos) > 0, "metadata", "must list at least one video")
+	errs.Check(len(videos) <= maxImportVideos, "metadata", "must have at most "+strconv.Itoa(maxImportVideos)+" videos")
+	if errs.Err() != nil {
+		respondWithValidationErrors(w, errs)
+		return
+	}
+
+	items := make([]database.CreateVideoImportItemParams, 0, len(videos))
+	for _, video := range videos {
+		items = append(items, database.CreateVideoImportItemParams{SourceID: video.id, Title: video.title})
+	}
+	imp, err := cfg.db.CreateVideoImport(userID, importSourceYouTube, items)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't create import", err)
+		return
+	}
+
+	started = true
+	go cfg.runVideoImport(imp.ID, userID, videos, files, dir)
+	respondWithJSON(w, http.StatusAccepted, imp)
+}
+
+// runVideoImport imports the videos one by one, recording each outcome as
+// it goes, and removes the staged files when it's done.
+func (cfg *apiConfig) runVideoImport(importID, userID uuid.UUID, videos []takeoutVideo, files map[string]importFile, dir string) {
+	defer os.RemoveAll(dir)
+	ctx := context.Background()
+
+	for i, video := range videos {
+		status, msg := database.VideoImportItemImported, ""
+		videoID, err := cfg.importVideo(ctx, userID, video, files, dir)
+		if err != nil {
+			log.Printf("Couldn't import video %s for import %s: %v", video.id, importID, err)
+			status, msg = database.VideoImportItemFailed, err.message()
+		}
+		if err := cfg.db.UpdateVideoImportItem(importID, i, status, videoID, msg); err != nil {
+			log.Printf("Couldn't record progress of import %s: %v", importID, err)
+		}
+	}
+	if err := cfg.db.FinishVideoImport(importID); err != nil {
+		log.Printf("Couldn't finish import %s: %v", importID, err)
+	}
+}
+
+// importVideo creates one video of an import and processes its file like an
+// upload. A video whose file fails to process is deleted again, so failed
+// items don't leave empty drafts behind.
+func (cfg *apiConfig) importVideo(ctx context.Context, userID uuid.UUID, source takeoutVideo, files map[string]importFile, dir string) (*uuid.UUID, *uploadError) {
+	params := database.CreateVideoParams{Title: source.title, Description: source.description, UserID: userID}
+	errs := validate.Errors{}
+	validateVideoParams(errs, params)
+	if errs.Err() != nil {
+		return nil, &uploadError{status: http.StatusUnprocessableEntity, fields: errs}
+	}
+
+	file, ok := files[source.id]
+	if !ok {
+		file, ok = files[source.title]
+	}
+	if !ok {
+		if source.fileURL == "" {
+			return nil, &uploadError{status: http.StatusUnprocessableEntity, format: "No file was uploaded for this video"}
+		}
+		var uerr *uploadError
+		file, uerr = downloadImportFile(ctx, dir, source.fileURL)
+		if uerr != nil {
+			return nil, uerr
+		}
+		defer os.Remove(file.path)
+	}
+	if uerr := cfg.checkVideoType(file.mediaType); uerr != nil {
+		return nil, uerr
+	}
+
+	opened, err := os.Open(file.path)
+	if err != nil {
+		return nil, &uploadError{status: http.StatusInternalServerError, format: "Couldn't read video file", err: err}
+	}
+	f := newSourceFile(opened, false)
+	defer f.release()
+	hash := sha256.New()
+	size, err := io.Copy(hash, f)
+	if err != nil {
+		return nil, &uploadError{status: http.StatusInternalServerError, format: "Couldn't read video file", err: err}
+	}
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return nil, &uploadError{status: http.StatusInternalServerError, format: "Couldn't reset file pointer", err: err}
+	}
+
+	_, limits, err := cfg.getUserLimits(userID)
+	if err != nil {
+		return nil, &uploadError{status: http.StatusInternalServerError, format: "Couldn't get plan limits", err: err}
+	}
+	err = cfg.checkStorageQuota(userID, limits, size, 0)
+	if errors.Is(err, errStorageQuotaExceeded) {
+		return nil, &uploadError{status: http.StatusForbidden, format: "Storage quota exceeded for your plan", err: err}
+	}
+	if err != nil {
+		return nil, &uploadError{status: http.StatusInternalServerError, format: "Couldn't check storage quota", err: err}
+	}
+
+	video, err := cfg.db.CreateVideo(params)
+	if err != nil {
+		return nil, &uploadError{status: http.StatusInternalServerError, format: "Couldn't create video", err: err}
+	}
+	if source.draft {
+		if err := cfg.db.MarkVideoUnpublished(&video); err != nil {
+			log.Printf("Couldn't unpublish draft video %s: %v", video.ID, err)
+		}
+	}
+	if tags := importTags(source.tags); len(tags) > 0 {
+		if err := cfg.db.SetVideoTags(&video, tags); err != nil {
+			log.Printf("Couldn't tag imported video %s: %v", video.ID, err)
+		}
+	}
+
+	video, _, uerr := cfg.processVideo(ctx, videoUpload{
+		video:       video,
+		userID:      userID,
+		limits:      limits,
+		file:        f,
+		mediaType:   file.mediaType,
+		size:        size,
+		contentHash: hex.EncodeToString(hash.Sum(nil)),
+	})
+	if uerr != nil {
+		if err := cfg.purgeVideo(ctx, video); err != nil {
+			log.Printf("Couldn't delete video %s after its import failed: %v", video.ID, err)
+		}
+		return nil, uerr
+	}
+
+	if source.publishedAt != nil {
+		if err := cfg.db.SetVideoPublishedAt(&video, *source.publishedAt); err != nil {
+			log.Printf("Couldn't backdate imported video %s: %v", video.ID, err)
+		}
+	}
+	return &video.ID, nil
+}
+
+// handlerVideoImportGet reports an import's progress, video by video.
+func (cfg *apiConfig) handlerVideoImportGet(w http.ResponseWriter, r *http.Request) {
+	importID, err := uuid.Parse(r.PathValue("importID"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid import ID", err)
+		return
+	}
+	token, err := auth.GetBearerToken(r.Header)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Couldn't find JWT", err)
+		return
+	}
+	userID, err := cfg.validateJWT(token)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Couldn't validate JWT", err)
+		return
+	}
+
+	imp, err := cfg.db.GetVideoImport(importID)
+	if errors.Is(err, sql.ErrNoRows) || err == nil && imp.UserID != userID {
+		respondWithError(w, http.StatusNotFound, "Couldn't get import", err)
+		return
+	}
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get import", err)
+		return
+	}
+	language := responseLanguage(w)
+	for i, item := range imp.Items {
+		if item.Error != "" {
+			_, imp.Items[i].Error = errorMessages.Translate(language, item.Error)
+		}
+	}
+	respondWithJSON(w, http.StatusOK, imp)
+}
+
+func (cfg *apiConfig) handlerVideoImportsList(w http.ResponseWriter, r *http.Request) {
+	token, err := auth.GetBearerToken(r.Header)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Couldn't find JWT", err)
+		return
+	}
+	userID, err := cfg.validateJWT(token)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Couldn't validate JWT", err)
+		return
+	}
+
+	imports, err := cfg.db.GetVideoImports(userID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get imports", err)
+		return
+	}
+	respondWithJSON(w, http.StatusOK, imports)
+}